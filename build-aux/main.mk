@@ -115,6 +115,12 @@ image: .ko.yaml $(tools/ko) ## (Build) Build/tag the manager/agent container ima
 	localname=$$(GOFLAGS="-ldflags=-X=$(PKG_VERSION).Version=$(TELEPRESENCE_VERSION) -trimpath" GOOS=linux ko publish --local ./cmd/traffic) && \
 	docker tag "$$localname" $(TELEPRESENCE_REGISTRY)/tel2:$(patsubst v%,%,$(TELEPRESENCE_VERSION))
 
+.PHONY: client-image
+client-image: pkg/install/helm/telepresence-chart.tgz ## (Build) Build/tag the client container image used by 'telepresence connect --docker'
+	mkdir -p $(BUILDDIR)/client-image
+	CGO_ENABLED=0 GOOS=linux go build -trimpath -ldflags=-X=$(PKG_VERSION).Version=$(TELEPRESENCE_VERSION) -o $(BUILDDIR)/client-image ./cmd/telepresence
+	docker build -f build-aux/Dockerfile.client -t $(TELEPRESENCE_REGISTRY)/telepresence:$(patsubst v%,%,$(TELEPRESENCE_VERSION)) $(BUILDDIR)/client-image
+
 .PHONY: push-image
 push-image: image ## (Build) Push the manager/agent container image to $(TELEPRESENCE_REGISTRY)
 	docker push $(TELEPRESENCE_REGISTRY)/tel2-base:$(TELEPRESENCE_BASE_VERSION) && \
@@ -88,6 +88,14 @@ RBAC rules required to create an intercept in a namespace; excludes any rules th
   - "apps"
   resources: ["deployments", "replicasets", "statefulsets"]
   verbs: ["get", "list", "update", "patch"]
+- apiGroups:
+  - "argoproj.io"
+  resources: ["rollouts"]
+  verbs: ["get", "list", "update", "patch"]
+- apiGroups:
+  - "batch"
+  resources: ["jobs", "cronjobs"]
+  verbs: ["get", "patch"]
 - apiGroups:
   - "getambassador.io"
   resources: ["hosts", "mappings"]
@@ -10,8 +10,10 @@ import (
 
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/docker"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/logging"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/netns"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/rootd"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/commands"
@@ -51,6 +53,8 @@ func main() {
 		}
 		cmd.AddCommand(userd.Command(commands.GetCommands, []userd.DaemonService{}, []trafficmgr.SessionService{}))
 		cmd.AddCommand(rootd.Command())
+		cmd.AddCommand(docker.Command())
+		cmd.AddCommand(netns.Command())
 		if err := cmd.ExecuteContext(ctx); err != nil {
 			fmt.Fprintf(cmd.ErrOrStderr(), "%s: error: %v\n", cmd.CommandPath(), err)
 			os.Exit(1)
@@ -59,7 +63,7 @@ func main() {
 		cfg, err := client.LoadConfig(ctx)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to load config: %v", err)
-			os.Exit(1)
+			os.Exit(errcat.Config.ExitCode())
 		}
 		ctx = client.WithConfig(ctx, cfg)
 		cmd = cli.Command(ctx)
@@ -68,7 +72,8 @@ func main() {
 		})
 		if err := cmd.ExecuteContext(ctx); err != nil {
 			fmt.Fprintf(cmd.ErrOrStderr(), "%s: error: %v\n", cmd.CommandPath(), err)
-			if errcat.GetCategory(err) > errcat.NoLogs {
+			cat := errcat.GetCategory(err)
+			if cat > errcat.NoLogs {
 				summarizeLogs(ctx, cmd)
 				// If the user gets here, it might be an actual bug that they found, so
 				// point them to the `gather-logs` command in case they want to open an
@@ -78,7 +83,7 @@ func main() {
 					"telepresence_logs.zip to your github issue or create a new one: "+
 					"https://github.com/telepresenceio/telepresence/issues/new?template=Bug_report.md .")
 			}
-			os.Exit(1)
+			os.Exit(cat.ExitCode())
 		}
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +17,8 @@ import (
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/dpipe"
 	"github.com/telepresenceio/telepresence/v2/pkg/forwarder"
+	"github.com/telepresenceio/telepresence/v2/pkg/httprewrite"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 	"github.com/telepresenceio/telepresence/v2/pkg/restapi"
 	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
@@ -32,19 +35,32 @@ type Config struct {
 	ManagerHost string `env:"_TEL_AGENT_MANAGER_HOST,default=traffic-manager"`
 	ManagerPort int32  `env:"_TEL_AGENT_MANAGER_PORT,default=8081"`
 	APIPort     int32  `env:"TELEPRESENCE_API_PORT,default="`
+	HTTPRewrite string `env:"_TEL_AGENT_HTTP_REWRITE,default="`
+	ExitWithApp bool   `env:"_TEL_AGENT_EXIT_WITH_APP,default=false"`
+
+	TunnelTCPIdleTimeout time.Duration `env:"_TEL_AGENT_TUNNEL_TCP_IDLE_TIMEOUT,default="`
+	TunnelUDPIdleTimeout time.Duration `env:"_TEL_AGENT_TUNNEL_UDP_IDLE_TIMEOUT,default="`
+	TunnelKeepAlive      time.Duration `env:"_TEL_AGENT_TUNNEL_KEEPALIVE,default="`
 }
 
 var skipKeys = map[string]bool{
 	// Keys found in the Config
-	"_TEL_AGENT_NAME":         true,
-	"_TEL_AGENT_NAMESPACE":    true,
-	"_TEL_AGENT_POD_IP":       true,
-	"_TEL_AGENT_PORT":         true,
-	"_TEL_AGENT_APP_MOUNTS":   true,
-	"_TEL_AGENT_APP_PORT":     true,
-	"_TEL_AGENT_MANAGER_HOST": true,
-	"_TEL_AGENT_MANAGER_PORT": true,
-	"_TEL_AGENT_LOG_LEVEL":    true,
+	"_TEL_AGENT_NAME":          true,
+	"_TEL_AGENT_NAMESPACE":     true,
+	"_TEL_AGENT_POD_IP":        true,
+	"_TEL_AGENT_PORT":          true,
+	"_TEL_AGENT_APP_MOUNTS":    true,
+	"_TEL_AGENT_APP_PORT":      true,
+	"_TEL_AGENT_MANAGER_HOST":  true,
+	"_TEL_AGENT_MANAGER_PORT":  true,
+	"_TEL_AGENT_LOG_LEVEL":     true,
+	"_TEL_AGENT_LOG_FORMAT":    true,
+	"_TEL_AGENT_HTTP_REWRITE":  true,
+	"_TEL_AGENT_EXIT_WITH_APP": true,
+
+	"_TEL_AGENT_TUNNEL_TCP_IDLE_TIMEOUT": true,
+	"_TEL_AGENT_TUNNEL_UDP_IDLE_TIMEOUT": true,
+	"_TEL_AGENT_TUNNEL_KEEPALIVE":        true,
 
 	// Keys that aren't useful when running on the local machine
 	"HOME":     true,
@@ -210,6 +226,14 @@ func Main(ctx context.Context, args ...string) error {
 	}
 	dlog.Infof(ctx, "%+v", config)
 
+	var rewriteRules httprewrite.Rules
+	if config.HTTPRewrite != "" {
+		var err error
+		if rewriteRules, err = httprewrite.Parse(config.HTTPRewrite); err != nil {
+			return err
+		}
+	}
+
 	info := &rpc.AgentInfo{
 		Name:        config.Name,
 		PodIp:       config.PodIP,
@@ -226,27 +250,82 @@ func Main(ctx context.Context, args ...string) error {
 			Product: "telepresence",
 			Version: version.Version,
 		},
+		{
+			Name:    tlsMechanism,
+			Product: "telepresence",
+			Version: version.Version,
+		},
+		{
+			Name:    httpMechanism,
+			Product: "telepresence",
+			Version: version.Version,
+		},
 	}
 	info.Mechanisms = mechanisms
 
+	ctx = tunnel.WithTimeouts(ctx, tunnel.Timeouts{
+		TCPIdle:   config.TunnelTCPIdleTimeout,
+		UDPIdle:   config.TunnelUDPIdleTimeout,
+		KeepAlive: config.TunnelKeepAlive,
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	g := dgroup.NewGroup(ctx, dgroup.GroupConfig{
 		EnableSignalHandling: true,
 	})
 
+	if config.ExitWithApp {
+		// The pod belongs to a job, and it won't complete unless the agent exits too.
+		g.Go("app-monitor", func(ctx context.Context) error {
+			if err := waitForAppExit(ctx, "/proc", time.Second); err != nil {
+				// Failing the agent container would fail the job, so just keep going
+				dlog.Errorf(ctx, "unable to monitor the app: %v", err)
+				<-ctx.Done()
+				return nil
+			}
+			if ctx.Err() == nil {
+				dlog.Info(ctx, "The app has exited, shutting down")
+				cancel()
+			}
+			return nil
+		})
+	}
+
 	if err := config.AddSecretsMounts(ctx, info.Environment); err != nil {
 		dlog.Errorf(ctx, "There was a problem with agent mounts: %v", err)
 	}
 
 	sftpPortCh := make(chan int32)
+	webdavPortCh := make(chan int32)
+	webdavAuth := NewWebDAVAuth()
 	if config.HasMounts(ctx, info.Environment) && user == "" {
 		g.Go("sftp-server", func(ctx context.Context) error {
 			return SftpServer(ctx, sftpPortCh)
 		})
+		g.Go("webdav-server", func(ctx context.Context) error {
+			return WebDAVServer(ctx, webdavAuth, webdavPortCh)
+		})
 	} else {
 		close(sftpPortCh)
-		dlog.Info(ctx, "Not starting sftp-server ($APP_MOUNTS is empty or $USER is set)")
+		close(webdavPortCh)
+		dlog.Info(ctx, "Not starting sftp-server or webdav-server ($APP_MOUNTS is empty or $USER is set)")
 	}
 
+	keyExchange, err := NewKeyExchange()
+	if err != nil {
+		return err
+	}
+	g.Go("key-exchange", func(ctx context.Context) error {
+		lc := net.ListenConfig{}
+		l, err := lc.Listen(ctx, "tcp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(install.AgentKeyExchangePort)))
+		if err != nil {
+			// Not fatal, but intercepts with end-to-end encryption can't be activated
+			dlog.Errorf(ctx, "unable to listen for key exchanges: %v", err)
+			return nil
+		}
+		return KeyExchangeServer(ctx, keyExchange, l)
+	})
+
 	forwarderChan := make(chan *forwarder.Forwarder)
 
 	// Manage the forwarder
@@ -259,6 +338,7 @@ func Main(ctx context.Context, args ...string) error {
 		}
 
 		forwarder := forwarder.NewForwarder(lisAddr, "", config.AppPort)
+		forwarder.SetRewriteRules(rewriteRules)
 		forwarderChan <- forwarder
 
 		return forwarder.Serve(ctx)
@@ -278,7 +358,8 @@ func Main(ctx context.Context, args ...string) error {
 		}
 
 		sftpPort := <-sftpPortCh
-		state := NewState(forwarder, config.ManagerHost, config.Namespace, config.PodIP, sftpPort)
+		webdavPort := <-webdavPortCh
+		state := NewState(forwarder, config.ManagerHost, config.Namespace, config.PodIP, sftpPort, webdavPort, webdavAuth, keyExchange)
 
 		if config.APIPort != 0 {
 			dgroup.ParentGroup(ctx).Go("API-server", func(ctx context.Context) error {
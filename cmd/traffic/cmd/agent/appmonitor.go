@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// appExitGrace is the number of consecutive checks that must find no app processes before the app is
+// considered to have exited.
+const appExitGrace = 3
+
+// waitForAppExit returns when the processes of the other containers of the pod have terminated. It relies
+// on the pod sharing its process namespace, which is how the traffic-manager configures the pods of a job,
+// and waits for the given context to be done if that isn't the case.
+//
+// A process that lives in the same mount namespace as this process belongs to the traffic-agent container,
+// and PID 1 is the pause container of the pod. All other processes belong to the app.
+func waitForAppExit(ctx context.Context, procDir string, interval time.Duration) error {
+	selfNS, err := os.Readlink(filepath.Join(procDir, "self", "ns", "mnt"))
+	if err != nil {
+		return fmt.Errorf("unable to determine the mount namespace of the traffic-agent: %w", err)
+	}
+	if os.Getpid() == 1 || isAgentProcess(procDir, "1", selfNS) {
+		dlog.Warn(ctx, "The pod doesn't share its process namespace, so the traffic-agent can't tell when the app exits")
+		<-ctx.Done()
+		return nil
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	idle := 0
+	for idle < appExitGrace {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		n, err := countAppProcesses(procDir, selfNS)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			idle = 0
+		} else {
+			idle++
+		}
+	}
+	return nil
+}
+
+// countAppProcesses returns the number of processes found in the given proc directory that neither belong
+// to the traffic-agent nor is the pause container.
+func countAppProcesses(procDir, selfNS string) (int, error) {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || name == "1" {
+			continue
+		}
+		if _, err := strconv.Atoi(name); err != nil {
+			continue
+		}
+		if !isAgentProcess(procDir, name, selfNS) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// isAgentProcess returns true if the process with the given pid lives in the given mount namespace. The
+// mount namespace of a process that runs as another user can't be read, but such a process doesn't belong
+// to the traffic-agent anyway.
+func isAgentProcess(procDir, pid, selfNS string) bool {
+	ns, err := os.Readlink(filepath.Join(procDir, pid, "ns", "mnt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// The process is gone. Don't count it as an app process
+			return true
+		}
+		return false
+	}
+	return ns == selfNS
+}
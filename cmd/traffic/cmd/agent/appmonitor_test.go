@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// fakeProcess adds a process with the given pid and mount namespace to the given proc directory.
+func fakeProcess(t *testing.T, procDir, pid, mntNS string) {
+	t.Helper()
+	nsDir := filepath.Join(procDir, pid, "ns")
+	require.NoError(t, os.MkdirAll(nsDir, 0755))
+	require.NoError(t, os.Symlink(mntNS, filepath.Join(nsDir, "mnt")))
+}
+
+func Test_waitForAppExit(t *testing.T) {
+	procDir := t.TempDir()
+	fakeProcess(t, procDir, "self", "mnt:[3]")
+	fakeProcess(t, procDir, "1", "mnt:[1]")  // pause
+	fakeProcess(t, procDir, "7", "mnt:[2]")  // app
+	fakeProcess(t, procDir, "12", "mnt:[3]") // agent
+	fakeProcess(t, procDir, "20", "mnt:[3]") // readiness probe of the agent
+
+	n, err := countAppProcesses(procDir, "mnt:[3]")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	ctx, cancel := context.WithTimeout(dlog.NewTestContext(t, false), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- waitForAppExit(ctx, procDir, 10*time.Millisecond)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("waitForAppExit returned while the app was running")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.NoError(t, os.RemoveAll(filepath.Join(procDir, "7")))
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+		assert.NoError(t, ctx.Err(), "waitForAppExit should return before the context is done")
+	case <-ctx.Done():
+		t.Fatal("waitForAppExit didn't return when the app exited")
+	}
+}
+
+func Test_waitForAppExit_notShared(t *testing.T) {
+	// Without a shared process namespace, PID 1 is the agent itself
+	procDir := t.TempDir()
+	fakeProcess(t, procDir, "self", "mnt:[3]")
+	fakeProcess(t, procDir, "1", "mnt:[3]")
+
+	ctx, cancel := context.WithTimeout(dlog.NewTestContext(t, false), 100*time.Millisecond)
+	defer cancel()
+	require.NoError(t, waitForAppExit(ctx, procDir, 10*time.Millisecond))
+	assert.Error(t, ctx.Err(), "waitForAppExit should wait until the context is done")
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/blang/semver"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/datawire/dlib/dcontext"
@@ -116,7 +117,7 @@ func TalkToManager(ctx context.Context, address string, info *rpc.AgentInfo, sta
 	if err != nil {
 		return err
 	}
-	go tunnel.DialWaitLoop(ctx, manager, dialerStream, session.SessionId)
+	go tunnel.DialWaitLoop(ctx, manager, dialerStream, session.SessionId, nil)
 
 	// Deal with log-level changes
 	logLevelStream, err := manager.WatchLogLevel(ctx, &empty.Empty{})
@@ -138,6 +139,8 @@ func TalkToManager(ctx context.Context, address string, info *rpc.AgentInfo, sta
 	}
 	go interceptWaitLoop(ctx, cancel, snapshots, stream)
 
+	// reportedStats are the intercept stats that were last reported to the manager, keyed by intercept ID
+	reportedStats := make(map[string]*rpc.InterceptStats)
 	for {
 		select {
 		case <-ctx.Done():
@@ -153,12 +156,34 @@ func TalkToManager(ctx context.Context, address string, info *rpc.AgentInfo, sta
 		case <-ticker.C:
 		}
 
-		if _, err := manager.Remain(ctx, &rpc.RemainRequest{Session: session}); err != nil {
+		if _, err := manager.Remain(ctx, &rpc.RemainRequest{
+			Session:        session,
+			InterceptStats: changedInterceptStats(reportedStats, state.InterceptStats()),
+		}); err != nil {
 			return err
 		}
 	}
 }
 
+// changedInterceptStats returns the stats that differ from the reported ones, and updates the reported stats.
+func changedInterceptStats(reported map[string]*rpc.InterceptStats, stats []*rpc.InterceptStats) []*rpc.InterceptStats {
+	var changed []*rpc.InterceptStats
+	current := make(map[string]struct{}, len(stats))
+	for _, st := range stats {
+		current[st.InterceptId] = struct{}{}
+		if !proto.Equal(reported[st.InterceptId], st) {
+			reported[st.InterceptId] = st
+			changed = append(changed, st)
+		}
+	}
+	for id := range reported {
+		if _, ok := current[id]; !ok {
+			delete(reported, id)
+		}
+	}
+	return changed
+}
+
 func interceptWaitLoop(ctx context.Context, cancel context.CancelFunc, snapshots chan<- *rpc.InterceptInfoSnapshot, stream rpc.Manager_WatchInterceptsClient) {
 	defer cancel() // Drop the gRPC connection if we leave this function
 	for {
@@ -228,6 +253,15 @@ func GetLogLevel() string {
 	return level
 }
 
+// GetLogFormat will return the log format that this agent should use
+func GetLogFormat() string {
+	format, ok := os.LookupEnv(install.EnvPrefix + "LOG_FORMAT")
+	if !ok {
+		format = os.Getenv("LOG_FORMAT")
+	}
+	return format
+}
+
 func logLevelWaitLoop(ctx context.Context, logLevelStream rpc.Manager_WatchLogLevelClient) {
 	level := GetLogLevel()
 	timedLevel := log.NewTimedLevel(level, log.SetLevel)
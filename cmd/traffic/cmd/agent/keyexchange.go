@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+// confirmedKeyTTL is how long a confirmed client key is retained when no intercept uses it. A client confirms
+// the key of an intercept before it creates the intercept.
+const confirmedKeyTTL = 5 * time.Minute
+
+// keyExchangeTimeout is the time that a client has to complete an exchange.
+const keyExchangeTimeout = 10 * time.Second
+
+// KeyExchange holds the key pair that the traffic-agent uses for intercepts with end-to-end encryption, and the
+// public keys that clients have exchanged directly with it. A client exchanges the public key of an intercept
+// through a port-forward that the Kubernetes API server establishes, so unlike the keys that the traffic-manager
+// relays, the exchanged keys can't be substituted by the traffic-manager. An intercept is only encrypted, and
+// thus only activated, using a client key that has been exchanged.
+type KeyExchange struct {
+	private []byte
+	public  []byte
+
+	sync.Mutex
+
+	// confirmed are the client keys that have been exchanged, and when they were last exchanged
+	confirmed map[string]time.Time
+
+	// onConfirm is called after a client key has been exchanged
+	onConfirm func()
+}
+
+// NewKeyExchange creates the key pair of the traffic-agent.
+func NewKeyExchange() (*KeyExchange, error) {
+	private, public, err := tunnel.GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	return &KeyExchange{private: private, public: public, confirmed: make(map[string]time.Time)}, nil
+}
+
+// KeyExchangeServer accepts connections on the given listener, which should listen on the loopback interface
+// so that it's reachable through a port-forward but not from other pods. A client sends the public key of an
+// intercept, and the traffic-agent responds with its own public key.
+func KeyExchangeServer(ctx context.Context, kx *KeyExchange, l net.Listener) error {
+	// Accept doesn't actually return when the context is cancelled so
+	// it's explicitly closed here.
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	info := fmt.Sprintf("Key exchange server on %v", l.Addr())
+	dlog.Infof(ctx, "%s started", info)
+	defer dlog.Infof(ctx, "%s ended", info)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				return fmt.Errorf("%s stopped. %w", info, err)
+			}
+			return nil
+		}
+		go kx.exchange(ctx, conn)
+	}
+}
+
+func (kx *KeyExchange) exchange(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(keyExchangeTimeout))
+	clientPublic := make([]byte, tunnel.KeySize)
+	if _, err := io.ReadFull(conn, clientPublic); err != nil {
+		dlog.Debugf(ctx, "key exchange with %s failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	if _, err := conn.Write(kx.public); err != nil {
+		dlog.Debugf(ctx, "key exchange with %s failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	kx.Lock()
+	kx.confirmed[string(clientPublic)] = time.Now()
+	onConfirm := kx.onConfirm
+	kx.Unlock()
+	dlog.Debug(ctx, "A client has exchanged the key of an intercept")
+	if onConfirm != nil {
+		onConfirm()
+	}
+}
+
+// isConfirmed returns true if the given client key has been exchanged.
+func (kx *KeyExchange) isConfirmed(clientPublic []byte) bool {
+	kx.Lock()
+	_, ok := kx.confirmed[string(clientPublic)]
+	kx.Unlock()
+	return ok
+}
+
+// prune forgets the client keys that aren't in the given set, unless they were exchanged recently.
+func (kx *KeyExchange) prune(inUse map[string]struct{}) {
+	kx.Lock()
+	defer kx.Unlock()
+	for public, at := range kx.confirmed {
+		if _, ok := inUse[public]; !ok && time.Since(at) > confirmedKeyTTL {
+			delete(kx.confirmed, public)
+		}
+	}
+}
+
+func (kx *KeyExchange) setOnConfirm(f func()) {
+	kx.Lock()
+	kx.onConfirm = f
+	kx.Unlock()
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/blang/semver"
 
@@ -11,12 +14,14 @@ import (
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/forwarder"
 	"github.com/telepresenceio/telepresence/v2/pkg/restapi"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
 )
 
 type State interface {
 	HandleIntercepts(ctx context.Context, cepts []*manager.InterceptInfo) []*manager.ReviewInterceptRequest
 	SetManager(sessionInfo *manager.SessionInfo, manager manager.ManagerClient, version semver.Version)
 	AgentState() restapi.AgentState
+	InterceptStats() []*manager.InterceptStats
 }
 
 // State of the Traffic Agent.
@@ -29,16 +34,50 @@ type state struct {
 	namespace   string
 	podIP       string
 	sftpPort    int32
+	webdavPort  int32
+	webdavAuth  *WebDAVAuth
+	keyExchange *KeyExchange
+
+	// sniChosen maps the SNI hosts of chosen TLS intercepts to their intercept IDs
+	sniChosen map[string]string
+
+	// httpChosen maps the descriptions of the matchers of chosen HTTP intercepts to their intercept IDs
+	httpChosen map[string]string
+
+	// keysLock guards interceptKeys and encryptedCepts, which are also used when a client exchanges a key
+	keysLock sync.Mutex
+
+	// interceptKeys are the keys of the intercepts that use end-to-end encryption, keyed by intercept ID
+	interceptKeys map[string]*forwarder.InterceptKey
+
+	// encryptedCepts are the ACTIVE intercepts that use end-to-end encryption
+	encryptedCepts []*manager.InterceptInfo
+
+	// interceptIDs are the IDs of the intercepts given to the last call to HandleIntercepts
+	interceptIDs map[string]struct{}
 }
 
-func (s *state) Intercepts(_ context.Context, _ string, _ http.Header) (bool, error) {
-	// The OSS agent is either intercepting or it isn't. There's no way to tell what it is that's being intercepted.
-	return s.forwarder.Intercepting(), nil
+// tlsMechanism is the mechanism of intercepts that only intercept TLS connections for a given SNI host
+const tlsMechanism = "tls"
+
+// httpMechanism is the mechanism of intercepts that only intercept the HTTP requests with matching headers
+const httpMechanism = "http"
+
+func (s *state) Intercepts(_ context.Context, _ string, h http.Header) (bool, error) {
+	return s.forwarder.InterceptingRequest(h), nil
 }
 
-func NewState(forwarder *forwarder.Forwarder, managerHost, namespace, podIP string, sftpPort int32) State {
+// NewState returns the state of the traffic-agent. Intercepts with end-to-end encryption can't be activated
+// when the keyExchange is nil.
+func NewState(
+	forwarder *forwarder.Forwarder,
+	managerHost, namespace, podIP string,
+	sftpPort, webdavPort int32,
+	webdavAuth *WebDAVAuth,
+	keyExchange *KeyExchange,
+) State {
 	host, port := forwarder.Target()
-	return &state{
+	s := &state{
 		forwarder:   forwarder,
 		managerHost: managerHost,
 		appHost:     host,
@@ -46,21 +85,184 @@ func NewState(forwarder *forwarder.Forwarder, managerHost, namespace, podIP stri
 		namespace:   namespace,
 		podIP:       podIP,
 		sftpPort:    sftpPort,
+		webdavPort:  webdavPort,
+		webdavAuth:  webdavAuth,
+		keyExchange: keyExchange,
+		sniChosen:   make(map[string]string),
+		httpChosen:  make(map[string]string),
+	}
+	if keyExchange != nil {
+		keyExchange.setOnConfirm(s.confirmKeys)
 	}
+	return s
 }
 
 func (s *state) AgentState() restapi.AgentState {
 	return s
 }
 
+// InterceptStats returns the traffic counters of the intercepts that this agent has forwarded connections to.
+func (s *state) InterceptStats() []*manager.InterceptStats {
+	return s.forwarder.InterceptStats(s.interceptIDs)
+}
+
 func (s *state) SetManager(sessionInfo *manager.SessionInfo, manager manager.ManagerClient, version semver.Version) {
 	s.forwarder.SetManager(sessionInfo, manager, version)
 }
 
 func (s *state) HandleIntercepts(ctx context.Context, cepts []*manager.InterceptInfo) []*manager.ReviewInterceptRequest {
-	var chosenIntercept, activeIntercept *manager.InterceptInfo
-
 	dlog.Debug(ctx, "HandleIntercepts called")
+	if s.webdavAuth != nil {
+		s.webdavAuth.setIntercepts(cepts)
+	}
+
+	s.interceptIDs = make(map[string]struct{}, len(cepts))
+	for _, cept := range cepts {
+		s.interceptIDs[cept.Id] = struct{}{}
+	}
+
+	var tcpCepts, sniCepts, httpCepts []*manager.InterceptInfo
+	sniIDs := make(map[string]struct{})
+	httpIDs := make(map[string]struct{})
+	for _, cept := range cepts {
+		switch cept.Spec.Mechanism {
+		case tlsMechanism:
+			sniCepts = append(sniCepts, cept)
+			sniIDs[cept.Id] = struct{}{}
+		case httpMechanism:
+			httpCepts = append(httpCepts, cept)
+			httpIDs[cept.Id] = struct{}{}
+		default:
+			tcpCepts = append(tcpCepts, cept)
+		}
+	}
+
+	// Forget chosen TLS intercepts that were deleted by the user
+	for host, id := range s.sniChosen {
+		if _, ok := sniIDs[id]; !ok {
+			dlog.Infof(ctx, "The intercept of TLS connections for %q has been deleted", host)
+			delete(s.sniChosen, host)
+		}
+	}
+
+	// Forget chosen HTTP intercepts that were deleted by the user
+	for desc, id := range s.httpChosen {
+		if _, ok := httpIDs[id]; !ok {
+			dlog.Infof(ctx, "The intercept of %s has been deleted", desc)
+			delete(s.httpChosen, desc)
+		}
+	}
+
+	reviews := s.handleTCPIntercepts(ctx, tcpCepts)
+	reviews = append(reviews, s.handleSNIIntercepts(ctx, sniCepts)...)
+	reviews = append(reviews, s.handleHTTPIntercepts(ctx, httpCepts)...)
+	s.negotiateKeys(ctx, cepts, reviews)
+	return reviews
+}
+
+// negotiateKeys creates the keys of the intercepts with end-to-end encryption that are, or are about to
+// become, ACTIVE, and passes them on to the forwarder. A key is only created once the client has exchanged
+// its public key directly with the traffic-agent, so an intercept that is about to become ACTIVE keeps
+// WAITING until then. The public key of the agent is sent to the client in the ACTIVE review, and with each
+// intercepted connection.
+func (s *state) negotiateKeys(ctx context.Context, cepts []*manager.InterceptInfo, reviews []*manager.ReviewInterceptRequest) {
+	s.keysLock.Lock()
+	defer s.keysLock.Unlock()
+	ceptsByID := make(map[string]*manager.InterceptInfo, len(cepts))
+	inUse := make(map[string]struct{})
+	s.encryptedCepts = nil
+	for _, cept := range cepts {
+		ceptsByID[cept.Id] = cept
+		if len(cept.Spec.ClientPublicKey) > 0 {
+			inUse[string(cept.Spec.ClientPublicKey)] = struct{}{}
+			if cept.Disposition == manager.InterceptDispositionType_ACTIVE {
+				s.encryptedCepts = append(s.encryptedCepts, cept)
+			}
+		}
+	}
+	if s.interceptKeys == nil {
+		s.interceptKeys = make(map[string]*forwarder.InterceptKey)
+	}
+	for id := range s.interceptKeys {
+		if _, ok := ceptsByID[id]; !ok {
+			delete(s.interceptKeys, id)
+		}
+	}
+	if s.keyExchange != nil {
+		s.keyExchange.prune(inUse)
+	}
+	for _, cept := range s.encryptedCepts {
+		if _, err := s.ensureKey(cept); err != nil {
+			dlog.Errorf(ctx, "unable to create an encryption key for intercept %q: %v", cept.Id, err)
+		}
+	}
+	for _, review := range reviews {
+		cept := ceptsByID[review.Id]
+		if review.Disposition != manager.InterceptDispositionType_ACTIVE || len(cept.Spec.ClientPublicKey) == 0 {
+			continue
+		}
+		key, err := s.ensureKey(cept)
+		switch {
+		case err != nil:
+			dlog.Infof(ctx, "Setting intercept %q as AGENT_ERROR; unable to create an encryption key: %v", cept.Id, err)
+			review.Disposition = manager.InterceptDispositionType_AGENT_ERROR
+			review.Message = fmt.Sprintf("Unable to create an encryption key: %v", err)
+		case key == nil:
+			dlog.Infof(ctx, "Keeping intercept %q WAITING; the client has not exchanged its encryption key", cept.Id)
+			review.Disposition = manager.InterceptDispositionType_WAITING
+			review.Message = "Waiting for the client to exchange its encryption key with the traffic-agent"
+		default:
+			review.AgentPublicKey = key.Public
+		}
+	}
+	s.setForwarderKeys()
+}
+
+// confirmKeys creates the keys of the ACTIVE intercepts whose client key has just been exchanged, e.g. because
+// this traffic-agent was started after the intercept was created.
+func (s *state) confirmKeys() {
+	s.keysLock.Lock()
+	defer s.keysLock.Unlock()
+	for _, cept := range s.encryptedCepts {
+		_, _ = s.ensureKey(cept)
+	}
+	s.setForwarderKeys()
+}
+
+// ensureKey returns the key of the given intercept, creating it if necessary. It returns nil when the client
+// has yet to exchange the public key of the intercept. The keysLock must be held.
+func (s *state) ensureKey(cept *manager.InterceptInfo) (*forwarder.InterceptKey, error) {
+	if key, ok := s.interceptKeys[cept.Id]; ok {
+		return key, nil
+	}
+	if s.keyExchange == nil || !s.keyExchange.isConfirmed(cept.Spec.ClientPublicKey) {
+		return nil, nil
+	}
+	shared, err := tunnel.InterceptKey(s.keyExchange.private, cept.Spec.ClientPublicKey, cept.Id)
+	if err != nil {
+		return nil, err
+	}
+	key := &forwarder.InterceptKey{Public: s.keyExchange.public, Shared: shared}
+	if s.interceptKeys == nil {
+		s.interceptKeys = make(map[string]*forwarder.InterceptKey)
+	}
+	s.interceptKeys[cept.Id] = key
+	return key, nil
+}
+
+// setForwarderKeys passes a copy of the interceptKeys to the forwarder. The keysLock must be held.
+func (s *state) setForwarderKeys() {
+	keys := make(map[string]*forwarder.InterceptKey, len(s.interceptKeys))
+	for id, key := range s.interceptKeys {
+		keys[id] = key
+	}
+	s.forwarder.SetInterceptKeys(keys)
+}
+
+// handleTCPIntercepts handles the intercepts that intercept all TCP connections. Only one of them
+// can be active at any given time.
+func (s *state) handleTCPIntercepts(ctx context.Context, cepts []*manager.InterceptInfo) []*manager.ReviewInterceptRequest {
+	var chosenIntercept, activeIntercept *manager.InterceptInfo
 
 	// Find the chosen intercept if it still exists
 	if s.chosenID != "" {
@@ -116,7 +318,28 @@ func (s *state) HandleIntercepts(ctx context.Context, cepts []*manager.Intercept
 					Disposition:       manager.InterceptDispositionType_ACTIVE,
 					PodIp:             s.podIP,
 					SftpPort:          s.sftpPort,
-					MechanismArgsDesc: "all TCP connections",
+					WebdavPort:        s.webdavPort,
+					MechanismArgsDesc: interceptDesc(cept, "all TCP connections"),
+					Mirrored:          cept.Spec.Mirror,
+					TrafficPercentage: cept.Spec.TrafficPercentage,
+				})
+			case chosenIntercept == nil && len(s.sniChosen) > 0:
+				// Intercepts of TLS connections are in play, so reject this one.
+				dlog.Infof(ctx, "Setting intercept %q as AGENT_ERROR; as it conflicts with intercepts of TLS connections", cept.Id)
+				reviews = append(reviews, &manager.ReviewInterceptRequest{
+					Id:                cept.Id,
+					Disposition:       manager.InterceptDispositionType_AGENT_ERROR,
+					Message:           fmt.Sprintf("Conflicts with the intercepts of TLS connections for %s", s.sniHosts()),
+					MechanismArgsDesc: interceptDesc(cept, "all TCP connections"),
+				})
+			case chosenIntercept == nil && len(s.httpChosen) > 0:
+				// Intercepts of HTTP requests are in play, so reject this one.
+				dlog.Infof(ctx, "Setting intercept %q as AGENT_ERROR; as it conflicts with intercepts of HTTP requests", cept.Id)
+				reviews = append(reviews, &manager.ReviewInterceptRequest{
+					Id:                cept.Id,
+					Disposition:       manager.InterceptDispositionType_AGENT_ERROR,
+					Message:           fmt.Sprintf("Conflicts with the intercepts %s of HTTP requests", s.httpIntercepts()),
+					MechanismArgsDesc: interceptDesc(cept, "all TCP connections"),
 				})
 			case chosenIntercept == nil:
 				// We don't have an intercept in play, so choose this one. All
@@ -132,7 +355,10 @@ func (s *state) HandleIntercepts(ctx context.Context, cepts []*manager.Intercept
 					Disposition:       manager.InterceptDispositionType_ACTIVE,
 					PodIp:             s.podIP,
 					SftpPort:          s.sftpPort,
-					MechanismArgsDesc: "all TCP connections",
+					WebdavPort:        s.webdavPort,
+					MechanismArgsDesc: interceptDesc(cept, "all TCP connections"),
+					Mirrored:          cept.Spec.Mirror,
+					TrafficPercentage: cept.Spec.TrafficPercentage,
 				})
 			default:
 				// We already have an intercept in play, so reject this one.
@@ -147,7 +373,7 @@ func (s *state) HandleIntercepts(ctx context.Context, cepts []*manager.Intercept
 					Id:                cept.Id,
 					Disposition:       manager.InterceptDispositionType_AGENT_ERROR,
 					Message:           msg,
-					MechanismArgsDesc: "all TCP connections",
+					MechanismArgsDesc: interceptDesc(cept, "all TCP connections"),
 				})
 			}
 		}
@@ -156,6 +382,162 @@ func (s *state) HandleIntercepts(ctx context.Context, cepts []*manager.Intercept
 	return reviews
 }
 
+// handleSNIIntercepts handles the intercepts that intercept TLS connections for a given SNI host.
+// Any number of them can be active at the same time, as long as their hosts differ and no intercept
+// of all TCP connections is in play.
+func (s *state) handleSNIIntercepts(ctx context.Context, cepts []*manager.InterceptInfo) []*manager.ReviewInterceptRequest {
+	active := make(map[string]*manager.InterceptInfo)
+	reviews := []*manager.ReviewInterceptRequest{}
+	for _, cept := range cepts {
+		host := sniHost(cept)
+		desc := interceptDesc(cept, fmt.Sprintf("TLS connections for %q", host))
+		switch cept.Disposition {
+		case manager.InterceptDispositionType_ACTIVE:
+			id, ok := s.sniChosen[host]
+			if !ok && host != "" && s.chosenID == "" {
+				// Attach to an intercept that was made active before this agent started
+				s.sniChosen[host] = cept.Id
+				id = cept.Id
+			}
+			if id == cept.Id {
+				active[host] = cept
+			}
+		case manager.InterceptDispositionType_WAITING:
+			review := &manager.ReviewInterceptRequest{
+				Id:                cept.Id,
+				Disposition:       manager.InterceptDispositionType_AGENT_ERROR,
+				MechanismArgsDesc: desc,
+			}
+			chosenID, chosen := s.sniChosen[host]
+			switch {
+			case host == "":
+				review.Message = "No SNI host was given. Use --tls-sni to specify one"
+			case s.chosenID != "":
+				review.Message = fmt.Sprintf("Conflicts with intercept %q, which intercepts all TCP connections", s.chosenID)
+			case chosen && chosenID != cept.Id:
+				review.Message = fmt.Sprintf("Conflicts with intercept %q of TLS connections for %q", chosenID, host)
+			default:
+				dlog.Infof(ctx, "Setting intercept %q of TLS connections for %q as ACTIVE", cept.Id, host)
+				s.sniChosen[host] = cept.Id
+				review.Disposition = manager.InterceptDispositionType_ACTIVE
+				review.PodIp = s.podIP
+				review.SftpPort = s.sftpPort
+				review.WebdavPort = s.webdavPort
+				review.Mirrored = cept.Spec.Mirror
+				review.TrafficPercentage = cept.Spec.TrafficPercentage
+			}
+			if review.Disposition == manager.InterceptDispositionType_AGENT_ERROR {
+				dlog.Infof(ctx, "Setting intercept %q as AGENT_ERROR; %s", cept.Id, review.Message)
+			}
+			reviews = append(reviews, review)
+		}
+	}
+	s.forwarder.SetSNIIntercepts(active)
+	return reviews
+}
+
+// handleHTTPIntercepts handles the intercepts that intercept the HTTP requests that match their headers.
+// Any number of them can be active at the same time, as long as they match different requests and no
+// intercept of all TCP connections is in play. A request is routed to the intercept with the lowest ID
+// of those that it matches.
+func (s *state) handleHTTPIntercepts(ctx context.Context, cepts []*manager.InterceptInfo) []*manager.ReviewInterceptRequest {
+	var active []*forwarder.HTTPIntercept
+	reviews := []*manager.ReviewInterceptRequest{}
+	for _, cept := range cepts {
+		matchers, err := forwarder.ParseHTTPMatchers(cept)
+		desc := matchers.String()
+		switch cept.Disposition {
+		case manager.InterceptDispositionType_ACTIVE:
+			if err != nil {
+				continue
+			}
+			id, ok := s.httpChosen[desc]
+			if !ok && s.chosenID == "" {
+				// Attach to an intercept that was made active before this agent started
+				s.httpChosen[desc] = cept.Id
+				id = cept.Id
+			}
+			if id == cept.Id {
+				active = append(active, &forwarder.HTTPIntercept{InterceptInfo: cept, Matchers: matchers})
+			}
+		case manager.InterceptDispositionType_WAITING:
+			review := &manager.ReviewInterceptRequest{
+				Id:                cept.Id,
+				Disposition:       manager.InterceptDispositionType_AGENT_ERROR,
+				MechanismArgsDesc: interceptDesc(cept, desc),
+			}
+			chosenID, chosen := s.httpChosen[desc]
+			switch {
+			case err != nil:
+				review.Message = err.Error()
+			case s.chosenID != "":
+				review.Message = fmt.Sprintf("Conflicts with intercept %q, which intercepts all TCP connections", s.chosenID)
+			case chosen && chosenID != cept.Id:
+				review.Message = fmt.Sprintf("Conflicts with intercept %q of %s", chosenID, desc)
+			default:
+				dlog.Infof(ctx, "Setting intercept %q of %s as ACTIVE", cept.Id, desc)
+				s.httpChosen[desc] = cept.Id
+				review.Disposition = manager.InterceptDispositionType_ACTIVE
+				review.PodIp = s.podIP
+				review.SftpPort = s.sftpPort
+				review.WebdavPort = s.webdavPort
+				review.Mirrored = cept.Spec.Mirror
+				review.TrafficPercentage = cept.Spec.TrafficPercentage
+			}
+			if review.Disposition == manager.InterceptDispositionType_AGENT_ERROR {
+				dlog.Infof(ctx, "Setting intercept %q as AGENT_ERROR; %s", cept.Id, review.Message)
+			}
+			reviews = append(reviews, review)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Id < active[j].Id })
+	s.forwarder.SetHTTPIntercepts(active)
+	return reviews
+}
+
+// interceptDesc returns the given description of the traffic that an intercept intercepts, amended with the
+// percentage of that traffic that the intercept gets, and with whether the traffic is copied because the intercept
+// mirrors it.
+func interceptDesc(cept *manager.InterceptInfo, desc string) string {
+	if p := cept.Spec.TrafficPercentage; p > 0 && p < 100 {
+		desc = fmt.Sprintf("%d%% of %s", p, desc)
+	}
+	if cept.Spec.Mirror {
+		desc = "copies of " + desc
+	}
+	return desc
+}
+
+// httpIntercepts returns a comma separated list of the IDs of the chosen HTTP intercepts.
+func (s *state) httpIntercepts() string {
+	ids := make([]string, 0, len(s.httpChosen))
+	for _, id := range s.httpChosen {
+		ids = append(ids, fmt.Sprintf("%q", id))
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ", ")
+}
+
+// sniHost returns the SNI host that the given intercept of TLS connections intercepts.
+func sniHost(cept *manager.InterceptInfo) string {
+	for _, arg := range cept.Spec.MechanismArgs {
+		if strings.HasPrefix(arg, "--sni=") {
+			return strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(arg, "--sni="), "."))
+		}
+	}
+	return ""
+}
+
+// sniHosts returns a comma separated list of the SNI hosts of the chosen TLS intercepts.
+func (s *state) sniHosts() string {
+	hosts := make([]string, 0, len(s.sniChosen))
+	for host := range s.sniChosen {
+		hosts = append(hosts, fmt.Sprintf("%q", host))
+	}
+	sort.Strings(hosts)
+	return strings.Join(hosts, ", ")
+}
+
 func (s *state) Intercepting() bool {
 	return s.forwarder.Intercepting()
 }
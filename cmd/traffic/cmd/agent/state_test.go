@@ -3,6 +3,7 @@ package agent_test
 import (
 	"context"
 	"net"
+	"net/http"
 	"testing"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/agent"
 	"github.com/telepresenceio/telepresence/v2/pkg/forwarder"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
 )
 
 const (
@@ -21,7 +23,11 @@ const (
 )
 
 func makeFS(t *testing.T) (*forwarder.Forwarder, agent.State) {
-	lAddr, err := net.ResolveTCPAddr("tcp", ":1111")
+	return makeFSWithKeyExchange(t, nil)
+}
+
+func makeFSWithKeyExchange(t *testing.T, kx *agent.KeyExchange) (*forwarder.Forwarder, agent.State) {
+	lAddr, err := net.ResolveTCPAddr("tcp", ":0")
 	assert.NoError(t, err)
 
 	f := forwarder.NewForwarder(lAddr, appHost, appPort)
@@ -36,7 +42,7 @@ func makeFS(t *testing.T) (*forwarder.Forwarder, agent.State) {
 		return port == appPort
 	}, 1*time.Second, 10*time.Millisecond)
 
-	s := agent.NewState(f, mgrHost, "default", "xyz", 0)
+	s := agent.NewState(f, mgrHost, "default", "xyz", 0, 0, nil, kx)
 
 	return f, s
 }
@@ -137,3 +143,332 @@ func TestState_HandleIntercepts(t *testing.T) {
 	a.Len(reviews, 0)
 	a.False(f.Intercepting())
 }
+
+func TestState_HandleSNIIntercepts(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	f, s := makeFS(t)
+
+	tlsCept := func(id, host string) *rpc.InterceptInfo {
+		return &rpc.InterceptInfo{
+			Spec: &rpc.InterceptSpec{
+				Name:          id + "Name",
+				Client:        "user@" + id,
+				Agent:         "agentName",
+				Mechanism:     "tls",
+				MechanismArgs: []string{"--sni=" + host},
+				Namespace:     "default",
+			},
+			Id:          id,
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		}
+	}
+	cepts := []*rpc.InterceptInfo{
+		tlsCept("a", "a.example.com"),
+		tlsCept("b", "B.example.com"),
+		tlsCept("c", "a.example.com"),
+		tlsCept("d", ""),
+	}
+
+	// Intercepts of different hosts can coexist
+	reviews := s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 4)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[1].Disposition)
+	a.Equal(`TLS connections for "b.example.com"`, reviews[1].MechanismArgsDesc)
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[2].Disposition)
+	a.Equal(`Conflicts with intercept "a" of TLS connections for "a.example.com"`, reviews[2].Message)
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[3].Disposition)
+	a.False(f.Intercepting())
+
+	cepts[0].Disposition = rpc.InterceptDispositionType_ACTIVE
+	cepts[1].Disposition = rpc.InterceptDispositionType_ACTIVE
+	cepts = cepts[:2]
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 0)
+	a.True(f.Intercepting())
+
+	// An intercept of all TCP connections conflicts with them
+	cepts = append(cepts, &rpc.InterceptInfo{
+		Spec: &rpc.InterceptSpec{
+			Name:      "tcpName",
+			Client:    "user@tcp",
+			Agent:     "agentName",
+			Mechanism: "tcp",
+			Namespace: "default",
+		},
+		Id:          "tcp",
+		Disposition: rpc.InterceptDispositionType_WAITING,
+	})
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[0].Disposition)
+	a.Equal(`Conflicts with the intercepts of TLS connections for "a.example.com", "b.example.com"`, reviews[0].Message)
+
+	// Once they're gone, the intercept of all TCP connections can be chosen
+	reviews = s.HandleIntercepts(ctx, cepts[2:])
+	a.Len(reviews, 1)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+	a.False(f.Intercepting())
+
+	reviews = s.HandleIntercepts(ctx, nil)
+	a.Len(reviews, 0)
+	a.False(f.Intercepting())
+}
+
+func TestState_HandleHTTPIntercepts(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	f, s := makeFS(t)
+
+	httpCept := func(id string, matches ...string) *rpc.InterceptInfo {
+		args := make([]string, len(matches))
+		for i, m := range matches {
+			args[i] = "--match=" + m
+		}
+		return &rpc.InterceptInfo{
+			Spec: &rpc.InterceptSpec{
+				Name:          id + "Name",
+				Client:        "user@" + id,
+				Agent:         "agentName",
+				Mechanism:     "http",
+				MechanismArgs: args,
+				Namespace:     "default",
+			},
+			Id:          id,
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		}
+	}
+	cepts := []*rpc.InterceptInfo{
+		httpCept("a", "auto"),
+		httpCept("b", "x-dev=bob"),
+		httpCept("c", "X-Dev=bob"),
+		httpCept("d", "x-dev=(bob"),
+	}
+
+	// Intercepts of different requests can coexist
+	reviews := s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 4)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+	a.Equal(`HTTP requests that match all of: header("X-Telepresence-Intercept-Id") ~= regexp("a")`, reviews[0].MechanismArgsDesc)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[1].Disposition)
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[2].Disposition)
+	a.Equal(`Conflicts with intercept "b" of HTTP requests that match all of: header("X-Dev") ~= regexp("bob")`, reviews[2].Message)
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[3].Disposition)
+	a.Contains(reviews[3].Message, "invalid regular expression")
+	a.False(f.Intercepting())
+
+	cepts[0].Disposition = rpc.InterceptDispositionType_ACTIVE
+	cepts[1].Disposition = rpc.InterceptDispositionType_ACTIVE
+	cepts = cepts[:2]
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 0)
+	a.True(f.Intercepting())
+
+	intercepts := func(hdrs ...string) bool {
+		h := http.Header{}
+		for i := 0; i < len(hdrs); i += 2 {
+			h.Add(hdrs[i], hdrs[i+1])
+		}
+		ok, err := s.AgentState().Intercepts(ctx, "", h)
+		a.NoError(err)
+		return ok
+	}
+	a.True(intercepts("x-telepresence-intercept-id", "a"))
+	a.True(intercepts("x-dev", "bob"))
+	a.False(intercepts("x-dev", "bobby"))
+	a.False(intercepts())
+
+	// An intercept of all TCP connections conflicts with them
+	cepts = append(cepts, &rpc.InterceptInfo{
+		Spec: &rpc.InterceptSpec{
+			Name:      "tcpName",
+			Client:    "user@tcp",
+			Agent:     "agentName",
+			Mechanism: "tcp",
+			Namespace: "default",
+		},
+		Id:          "tcp",
+		Disposition: rpc.InterceptDispositionType_WAITING,
+	})
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[0].Disposition)
+	a.Equal(`Conflicts with the intercepts "a", "b" of HTTP requests`, reviews[0].Message)
+
+	reviews = s.HandleIntercepts(ctx, nil)
+	a.Len(reviews, 0)
+	a.False(f.Intercepting())
+}
+
+func TestState_HandleEncryptedIntercepts(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	kx, err := agent.NewKeyExchange()
+	a.NoError(err)
+	f, s := makeFSWithKeyExchange(t, kx)
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	a.NoError(err)
+	kxCtx, kxCancel := context.WithCancel(ctx)
+	defer kxCancel()
+	go func() {
+		_ = agent.KeyExchangeServer(kxCtx, kx, l)
+	}()
+	exchange := func(clientPublic []byte) []byte {
+		conn, err := net.Dial("tcp4", l.Addr().String())
+		a.NoError(err)
+		defer conn.Close()
+		agentPublic, err := tunnel.ExchangePublicKeys(conn, clientPublic)
+		a.NoError(err)
+		return agentPublic
+	}
+
+	_, clientPublic, err := tunnel.GenerateKeyPair()
+	a.NoError(err)
+	cepts := []*rpc.InterceptInfo{
+		{
+			Spec: &rpc.InterceptSpec{
+				Name:            "ceptName",
+				Client:          "user@host",
+				Agent:           "agentName",
+				Mechanism:       "tcp",
+				Namespace:       "default",
+				ClientPublicKey: clientPublic,
+			},
+			Id:          "intercept-01",
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		},
+	}
+
+	// A client key that hasn't been exchanged directly with the agent is not used
+	reviews := s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.Equal(rpc.InterceptDispositionType_WAITING, reviews[0].Disposition)
+	a.Empty(reviews[0].AgentPublicKey)
+
+	// The ACTIVE review carries the public key that the agent responded with in the exchange
+	agentPublic := exchange(clientPublic)
+	a.Len(agentPublic, tunnel.KeySize)
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+	a.Equal(agentPublic, reviews[0].AgentPublicKey)
+
+	// and the same key is used once the intercept is ACTIVE
+	cepts[0].Disposition = rpc.InterceptDispositionType_ACTIVE
+	cepts[0].AgentPublicKey = agentPublic
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 0)
+	a.True(f.Intercepting())
+
+	cepts[0].Disposition = rpc.InterceptDispositionType_WAITING
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.Equal(agentPublic, reviews[0].AgentPublicKey)
+
+	// A client key that the traffic-manager substituted is not used
+	_, substituted, err := tunnel.GenerateKeyPair()
+	a.NoError(err)
+	cepts[0].Spec.ClientPublicKey = substituted
+	cepts[0].Id = "intercept-02"
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.Equal(rpc.InterceptDispositionType_WAITING, reviews[0].Disposition)
+	a.Empty(reviews[0].AgentPublicKey)
+
+	// Intercepts without a client key are not encrypted
+	cepts[0].Spec.ClientPublicKey = nil
+	cepts[0].Id = "intercept-03"
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+	a.Empty(reviews[0].AgentPublicKey)
+}
+
+func TestState_HandleMirroredIntercepts(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	f, s := makeFS(t)
+
+	cepts := []*rpc.InterceptInfo{
+		{
+			Spec: &rpc.InterceptSpec{
+				Name:      "ceptName",
+				Client:    "user@host",
+				Agent:     "agentName",
+				Mechanism: "tcp",
+				Namespace: "default",
+				Mirror:    true,
+			},
+			Id:          "intercept-01",
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		},
+	}
+
+	// The ACTIVE review confirms that the traffic is mirrored
+	reviews := s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+	a.True(reviews[0].Mirrored)
+	a.Equal("copies of all TCP connections", reviews[0].MechanismArgsDesc)
+
+	// The app still serves the requests of a mirrored intercept
+	cepts[0].Disposition = rpc.InterceptDispositionType_ACTIVE
+	cepts[0].Mirrored = true
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 0)
+	a.True(f.Intercepting())
+	a.False(f.InterceptingRequest(http.Header{}))
+
+	// Intercepts that don't mirror divert the traffic
+	reviews = s.HandleIntercepts(ctx, nil)
+	a.Len(reviews, 0)
+	cepts[0].Spec.Mirror = false
+	cepts[0].Mirrored = false
+	cepts[0].Id = "intercept-02"
+	cepts[0].Disposition = rpc.InterceptDispositionType_WAITING
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.False(reviews[0].Mirrored)
+	a.Equal("all TCP connections", reviews[0].MechanismArgsDesc)
+	cepts[0].Disposition = rpc.InterceptDispositionType_ACTIVE
+	s.HandleIntercepts(ctx, cepts)
+	a.True(f.InterceptingRequest(http.Header{}))
+}
+
+func TestState_HandleInterceptsWithTrafficPercentage(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	_, s := makeFS(t)
+
+	cepts := []*rpc.InterceptInfo{
+		{
+			Spec: &rpc.InterceptSpec{
+				Name:              "ceptName",
+				Client:            "user@host",
+				Agent:             "agentName",
+				Mechanism:         "tcp",
+				Namespace:         "default",
+				TrafficPercentage: 10,
+			},
+			Id:          "intercept-01",
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		},
+	}
+
+	// The ACTIVE review confirms the percentage
+	reviews := s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+	a.Equal(int32(10), reviews[0].TrafficPercentage)
+	a.Equal("10% of all TCP connections", reviews[0].MechanismArgsDesc)
+
+	// A mirror of a percentage of the traffic
+	s.HandleIntercepts(ctx, nil)
+	cepts[0].Spec.Mirror = true
+	cepts[0].Id = "intercept-02"
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.Equal("copies of 10% of all TCP connections", reviews[0].MechanismArgsDesc)
+}
@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/datawire/dlib/dhttp"
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+// WebDAVServer creates a listener on the next available port, writes that port on the given channel, and then
+// serves the mounted volumes over WebDAV. Clients that can't use sshfs mount the volumes using this server,
+// and authenticate using the password of one of the intercepts that are given to the auth.
+func WebDAVServer(ctx context.Context, auth *WebDAVAuth, webdavPortCh chan<- int32) error {
+	defer close(webdavPortCh)
+
+	lc := net.ListenConfig{}
+	l, err := lc.Listen(ctx, "tcp4", ":0")
+	if err != nil {
+		return err
+	}
+	_, webdavPort, err := iputil.SplitToIPPort(l.Addr())
+	if err != nil {
+		_ = l.Close()
+		return err
+	}
+	webdavPortCh <- int32(webdavPort)
+
+	server := &dhttp.ServerConfig{Handler: auth.handler(newWebDAVHandler(install.TelAppMountPoint))}
+	info := fmt.Sprintf("WebDAV server on %v", l.Addr())
+	dlog.Infof(ctx, "%s started", info)
+	defer dlog.Infof(ctx, "%s ended", info)
+	if err := server.Serve(ctx, l); err != nil && err != ctx.Err() {
+		return fmt.Errorf("%s stopped. %w", info, err)
+	}
+	return nil
+}
+
+// newWebDAVHandler returns a handler that serves the given directory read-write, and read-only below
+// install.TelAppWebDAVReadOnlyPrefix or to requests that WebDAVAuth found to be read-only.
+func newWebDAVHandler(dir string) http.Handler {
+	ls := webdav.NewMemLS()
+	logger := func(r *http.Request, err error) {
+		if err != nil {
+			dlog.Debugf(r.Context(), "WebDAV %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	}
+	rw := &webdav.Handler{FileSystem: webdav.Dir(dir), LockSystem: ls, Logger: logger}
+	ro := &webdav.Handler{Prefix: install.TelAppWebDAVReadOnlyPrefix, FileSystem: webdav.Dir(dir), LockSystem: ls, Logger: logger}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := rw
+		if r.URL.Path == install.TelAppWebDAVReadOnlyPrefix || strings.HasPrefix(r.URL.Path, install.TelAppWebDAVReadOnlyPrefix+"/") {
+			h = ro
+		} else if !isReadOnly(r.Context()) {
+			rw.ServeHTTP(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+			h.ServeHTTP(w, r)
+		default:
+			// This includes LOCK, because locking an unmapped URL creates an empty file
+			http.Error(w, "the mount is read-only", http.StatusForbidden)
+		}
+	})
+}
+
+type readOnlyKey struct{}
+
+// isReadOnly returns true when the request was authenticated using the password of a read-only mount.
+func isReadOnly(ctx context.Context) bool {
+	ro, _ := ctx.Value(readOnlyKey{}).(bool)
+	return ro
+}
+
+// WebDAVAuth holds the hashes of the passwords that the clients of the current intercepts use to
+// authenticate to the WebDAV server. The clients send their password using HTTP basic authentication.
+// A client that authenticates using the password of an intercept with a read-only mount can only read,
+// regardless of the path that it requests.
+type WebDAVAuth struct {
+	sync.RWMutex
+	passwords []webdavPassword
+}
+
+type webdavPassword struct {
+	hash     []byte
+	readOnly bool
+}
+
+func NewWebDAVAuth() *WebDAVAuth {
+	return &WebDAVAuth{}
+}
+
+// setIntercepts replaces the accepted passwords with the ones of the given intercepts.
+func (a *WebDAVAuth) setIntercepts(cepts []*manager.InterceptInfo) {
+	var pws []webdavPassword
+	for _, cept := range cepts {
+		if h := cept.Spec.MountPasswordHash; len(h) == sha256.Size {
+			pws = append(pws, webdavPassword{hash: h, readOnly: cept.Spec.MountReadOnly})
+		}
+	}
+	a.Lock()
+	a.passwords = pws
+	a.Unlock()
+}
+
+// authorized returns true if the request is authenticated using the password of one of the intercepts, and
+// whether that intercept has a read-only mount.
+func (a *WebDAVAuth) authorized(r *http.Request) (ok, readOnly bool) {
+	user, password, ok := r.BasicAuth()
+	if !ok || user != install.TelAppWebDAVUser {
+		return false, false
+	}
+	hash := sha256.Sum256([]byte(password))
+	a.RLock()
+	defer a.RUnlock()
+	for _, pw := range a.passwords {
+		if subtle.ConstantTimeCompare(hash[:], pw.hash) == 1 {
+			return true, pw.readOnly
+		}
+	}
+	return false, false
+}
+
+func (a *WebDAVAuth) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, readOnly := a.authorized(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="telepresence"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if readOnly {
+			r = r.WithContext(context.WithValue(r.Context(), readOnlyKey{}, true))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+)
+
+func Test_newWebDAVHandler(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config"), []byte("remote"), 0o644))
+	h := newWebDAVHandler(dir)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/config", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "remote", rec.Body.String())
+
+	rec = serve(http.MethodPut, "/new", "local")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	data, err := os.ReadFile(filepath.Join(dir, "new"))
+	require.NoError(t, err)
+	assert.Equal(t, "local", string(data))
+
+	ro := install.TelAppWebDAVReadOnlyPrefix
+	rec = serve(http.MethodGet, ro+"/config", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "remote", rec.Body.String())
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete, "MKCOL", "MOVE", "LOCK", "PROPPATCH"} {
+		rec = serve(method, ro+"/config", "x")
+		assert.Equal(t, http.StatusForbidden, rec.Code, method)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "config"))
+	require.NoError(t, err)
+	assert.Equal(t, "remote", string(data))
+}
+
+func TestWebDAVAuth(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config"), []byte("remote"), 0o644))
+	auth := NewWebDAVAuth()
+	h := auth.handler(newWebDAVHandler(dir))
+
+	get := func(user, password string) int {
+		rq := httptest.NewRequest(http.MethodGet, "/config", nil)
+		if user != "" {
+			rq.SetBasicAuth(user, password)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, rq)
+		return rec.Code
+	}
+
+	hash := sha256.Sum256([]byte("secret"))
+	auth.setIntercepts([]*manager.InterceptInfo{
+		{Spec: &manager.InterceptSpec{Name: "a", MountPasswordHash: hash[:]}},
+		{Spec: &manager.InterceptSpec{Name: "b"}},
+	})
+	assert.Equal(t, http.StatusOK, get(install.TelAppWebDAVUser, "secret"))
+	assert.Equal(t, http.StatusUnauthorized, get("", ""))
+	assert.Equal(t, http.StatusUnauthorized, get(install.TelAppWebDAVUser, ""))
+	assert.Equal(t, http.StatusUnauthorized, get(install.TelAppWebDAVUser, "other"))
+	assert.Equal(t, http.StatusUnauthorized, get("admin", "secret"))
+
+	// The password of an intercept with a read-only mount can't be used to write, regardless of the path
+	roHash := sha256.Sum256([]byte("ro-secret"))
+	auth.setIntercepts([]*manager.InterceptInfo{
+		{Spec: &manager.InterceptSpec{Name: "a", MountPasswordHash: hash[:]}},
+		{Spec: &manager.InterceptSpec{Name: "c", MountPasswordHash: roHash[:], MountReadOnly: true}},
+	})
+	put := func(password, path string) int {
+		rq := httptest.NewRequest(http.MethodPut, path, strings.NewReader("local"))
+		rq.SetBasicAuth(install.TelAppWebDAVUser, password)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, rq)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, get(install.TelAppWebDAVUser, "ro-secret"))
+	assert.Equal(t, http.StatusForbidden, put("ro-secret", "/config"))
+	assert.Equal(t, http.StatusForbidden, put("ro-secret", install.TelAppWebDAVReadOnlyPrefix+"/config"))
+	data, err := os.ReadFile(filepath.Join(dir, "config"))
+	require.NoError(t, err)
+	assert.Equal(t, "remote", string(data))
+	assert.Equal(t, http.StatusCreated, put("secret", "/new"))
+
+	// The password stops working when its intercept ends
+	auth.setIntercepts(nil)
+	assert.Equal(t, http.StatusUnauthorized, get(install.TelAppWebDAVUser, "secret"))
+}
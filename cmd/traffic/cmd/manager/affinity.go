@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+// interceptDependent is an entry of the InterceptDependentsAnnotation.
+type interceptDependent struct {
+	name string
+	port int32
+}
+
+// parseInterceptDependents parses the value of the InterceptDependentsAnnotation, a comma separated list of
+// workload names, each optionally followed by a colon and the local port that the workload is run on, e.g.
+// "orders:8081,payments".
+func parseInterceptDependents(value string) ([]interceptDependent, error) {
+	var deps []interceptDependent
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		dep := interceptDependent{name: entry}
+		if i := strings.IndexByte(entry, ':'); i >= 0 {
+			port, err := strconv.ParseUint(entry[i+1:], 10, 16)
+			if err != nil || port == 0 {
+				return nil, fmt.Errorf("invalid port in %q", entry)
+			}
+			dep.name = entry[:i]
+			dep.port = int32(port)
+		}
+		if dep.name == "" {
+			return nil, fmt.Errorf("missing workload name in %q", entry)
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// workloadDependents returns the dependents declared by the given workload. The annotation is read from the
+// workload itself, and then from its pod template.
+func workloadDependents(wl k8sapi.Workload) ([]interceptDependent, error) {
+	value, ok := wl.GetAnnotations()[install.InterceptDependentsAnnotation]
+	if !ok {
+		value, ok = wl.GetPodTemplate().GetAnnotations()[install.InterceptDependentsAnnotation]
+	}
+	if !ok {
+		return nil, nil
+	}
+	deps, err := parseInterceptDependents(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s.%s: annotation %s: %w", wl.GetKind(), wl.GetName(), wl.GetNamespace(),
+			install.InterceptDependentsAnnotation, err)
+	}
+	return deps, nil
+}
+
+// GetInterceptAffinity returns the workloads that depend on the workload of the named intercept, together
+// with the intercepts that exist on them, so that the client can route a whole request chain to itself.
+func (m *Manager) GetInterceptAffinity(ctx context.Context, request *rpc.GetInterceptRequest) (*rpc.InterceptAffinity, error) {
+	ctx = managerutil.WithSessionInfo(ctx, request.GetSession())
+	sessionID := request.GetSession().GetSessionId()
+	interceptID, err := m.makeinterceptID(ctx, sessionID, request.GetName())
+	if err != nil {
+		return nil, err
+	}
+	ii, ok := m.state.GetIntercept(interceptID)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Intercept named %q not found", request.Name)
+	}
+	spec := ii.Spec
+	wl, err := k8sapi.GetWorkload(ctx, spec.Agent, spec.Namespace, spec.WorkloadKind)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "unable to get %s %s.%s: %v", spec.WorkloadKind, spec.Agent, spec.Namespace, err)
+	}
+
+	affinity := &rpc.InterceptAffinity{
+		Mechanism:     spec.Mechanism,
+		MechanismArgs: spec.MechanismArgs,
+	}
+	visited := map[string]struct{}{spec.Agent: {}}
+	queue := []k8sapi.Workload{wl}
+	for len(queue) > 0 {
+		wl, queue = queue[0], queue[1:]
+		deps, err := workloadDependents(wl)
+		if err != nil {
+			dlog.Error(ctx, err)
+			continue
+		}
+		for _, dep := range deps {
+			if _, ok := visited[dep.name]; ok {
+				continue
+			}
+			visited[dep.name] = struct{}{}
+			ad := &rpc.InterceptAffinity_Dependent{
+				Workload:  dep.name,
+				Namespace: spec.Namespace,
+				LocalPort: dep.port,
+			}
+			affinity.Dependents = append(affinity.Dependents, ad)
+			depWl, err := k8sapi.GetWorkload(ctx, dep.name, spec.Namespace, "")
+			if err != nil {
+				ad.Error = err.Error()
+				continue
+			}
+			queue = append(queue, depWl)
+			m.addDependentIntercepts(sessionID, ad)
+		}
+	}
+	return affinity, nil
+}
+
+// addDependentIntercepts records the existing intercepts on the given dependent in it.
+func (m *Manager) addDependentIntercepts(sessionID string, ad *rpc.InterceptAffinity_Dependent) {
+	for _, ii := range m.state.GetInterceptsByAgent(ad.Workload, ad.Namespace) {
+		if ii.ClientSession.GetSessionId() == sessionID {
+			ad.InterceptName = ii.Spec.Name
+		} else {
+			ad.OtherClients = append(ad.OtherClients, ii.Spec.Client)
+		}
+	}
+	sort.Strings(ad.OtherClients)
+}
@@ -0,0 +1,23 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseInterceptDependents(t *testing.T) {
+	deps, err := parseInterceptDependents(" orders:8081, payments ,,")
+	require.NoError(t, err)
+	assert.Equal(t, []interceptDependent{{name: "orders", port: 8081}, {name: "payments"}}, deps)
+
+	deps, err = parseInterceptDependents("")
+	require.NoError(t, err)
+	assert.Empty(t, deps)
+
+	for _, bad := range []string{"orders:http", "orders:0", ":8080", "orders:70000"} {
+		_, err = parseInterceptDependents(bad)
+		assert.Error(t, err, bad)
+	}
+}
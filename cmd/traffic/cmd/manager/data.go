@@ -3,7 +3,10 @@ package manager
 import (
 	"fmt"
 
+	"golang.org/x/net/http/httpguts"
+
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
 )
 
 func validateClient(client *rpc.ClientInfo) string {
@@ -67,6 +70,18 @@ func validateIntercept(spec *rpc.InterceptSpec) string {
 		return "namespace must not be empty"
 	case spec.Mechanism == "":
 		return "mechanism must not be empty"
+	case len(spec.ClientPublicKey) != 0 && len(spec.ClientPublicKey) != tunnel.KeySize:
+		return fmt.Sprintf("client public key must be %d bytes", tunnel.KeySize)
+	case spec.TrafficPercentage < 0 || spec.TrafficPercentage > 100:
+		return "traffic percentage must be between 1 and 100"
+	}
+	for n, v := range spec.IdentityHeaders {
+		if !httpguts.ValidHeaderFieldName(n) {
+			return fmt.Sprintf("invalid identity header name %q", n)
+		}
+		if !httpguts.ValidHeaderFieldValue(v) {
+			return fmt.Sprintf("invalid value for identity header %q", n)
+		}
 	}
 
 	return ""
@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/watchable"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+// workloadEvent is a Kubernetes Event to record on the workload of an intercept.
+type workloadEvent struct {
+	spec      *rpc.InterceptSpec
+	eventType string
+	reason    string
+	message   string
+}
+
+// runEventExportLoop records Kubernetes Events on the intercepted workloads when intercepts start,
+// end, or fail.
+func (m *Manager) runEventExportLoop(ctx context.Context) error {
+	dispositions := make(map[string]rpc.InterceptDispositionType)
+	for snapshot := range m.state.WatchIntercepts(ctx, nil) {
+		for _, update := range snapshot.Updates {
+			if ev := interceptEvent(dispositions, update); ev != nil {
+				wl, err := k8sapi.GetWorkload(ctx, ev.spec.Agent, ev.spec.Namespace, ev.spec.WorkloadKind)
+				if err != nil {
+					dlog.Errorf(ctx, "unable to record %s event: %v", ev.reason, err)
+					continue
+				}
+				managerutil.RecordWorkloadEvent(ctx, wl, ev.eventType, ev.reason, ev.message)
+			}
+		}
+	}
+	return nil
+}
+
+// interceptEvent returns the event that the given update warrants, if any. The dispositions map holds
+// the last known disposition of each intercept and is updated accordingly.
+func interceptEvent(dispositions map[string]rpc.InterceptDispositionType, update watchable.InterceptMapUpdate) *workloadEvent {
+	ii := update.Value
+	prev, known := dispositions[update.Key]
+	if update.Delete {
+		delete(dispositions, update.Key)
+		if prev != rpc.InterceptDispositionType_ACTIVE || ii == nil {
+			return nil
+		}
+		return &workloadEvent{
+			spec:      ii.Spec,
+			eventType: core.EventTypeNormal,
+			reason:    "InterceptEnded",
+			message:   fmt.Sprintf("Intercept %q by %s ended", ii.Spec.Name, ii.Spec.Client),
+		}
+	}
+	dispositions[update.Key] = ii.Disposition
+	if known && prev == ii.Disposition {
+		return nil
+	}
+	switch ii.Disposition {
+	case rpc.InterceptDispositionType_WAITING:
+		return nil
+	case rpc.InterceptDispositionType_ACTIVE:
+		return &workloadEvent{
+			spec:      ii.Spec,
+			eventType: core.EventTypeNormal,
+			reason:    "InterceptStarted",
+			message:   fmt.Sprintf("Intercept %q by %s started", ii.Spec.Name, ii.Spec.Client),
+		}
+	default:
+		return &workloadEvent{
+			spec:      ii.Spec,
+			eventType: core.EventTypeWarning,
+			reason:    "InterceptFailed",
+			message:   fmt.Sprintf("Intercept %q by %s failed: %s: %s", ii.Spec.Name, ii.Spec.Client, ii.Disposition, ii.Message),
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/watchable"
+)
+
+func Test_interceptEvent(t *testing.T) {
+	dispositions := make(map[string]rpc.InterceptDispositionType)
+	spec := &rpc.InterceptSpec{Name: "echo", Client: "alice@laptop", Agent: "echo", Namespace: "default"}
+	update := func(id string, disposition rpc.InterceptDispositionType, del bool) *workloadEvent {
+		return interceptEvent(dispositions, watchable.InterceptMapUpdate{
+			Key:    id,
+			Delete: del,
+			Value:  &rpc.InterceptInfo{Id: id, Spec: spec, Disposition: disposition, Message: "no agent"},
+		})
+	}
+
+	assert.Nil(t, update("s1:echo", rpc.InterceptDispositionType_WAITING, false))
+	ev := update("s1:echo", rpc.InterceptDispositionType_ACTIVE, false)
+	require.NotNil(t, ev)
+	assert.Equal(t, core.EventTypeNormal, ev.eventType)
+	assert.Equal(t, "InterceptStarted", ev.reason)
+	assert.Equal(t, `Intercept "echo" by alice@laptop started`, ev.message)
+
+	// An update that doesn't change the disposition doesn't warrant a new event
+	assert.Nil(t, update("s1:echo", rpc.InterceptDispositionType_ACTIVE, false))
+
+	ev = update("s1:echo", rpc.InterceptDispositionType_ACTIVE, true)
+	require.NotNil(t, ev)
+	assert.Equal(t, "InterceptEnded", ev.reason)
+	assert.Empty(t, dispositions)
+
+	ev = update("s2:echo", rpc.InterceptDispositionType_NO_AGENT, false)
+	require.NotNil(t, ev)
+	assert.Equal(t, core.EventTypeWarning, ev.eventType)
+	assert.Equal(t, "InterceptFailed", ev.reason)
+	assert.Equal(t, `Intercept "echo" by alice@laptop failed: NO_AGENT: no agent`, ev.message)
+
+	// An intercept that never became active doesn't end
+	assert.Nil(t, update("s2:echo", rpc.InterceptDispositionType_NO_AGENT, true))
+}
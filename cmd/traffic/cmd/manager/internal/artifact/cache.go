@@ -0,0 +1,172 @@
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datawire/dlib/dcontext"
+	"github.com/datawire/dlib/dlog"
+)
+
+// downloadTimeout is the maximum time that the download of one artifact may take.
+const downloadTimeout = 5 * time.Minute
+
+// ErrNotAllowed is returned by Cache.Open when the URL isn't an Ambassador Cloud URL.
+var ErrNotAllowed = errors.New("only Ambassador Cloud artifacts can be retrieved")
+
+// Cache is a file based cache of the artifacts that Ambassador Cloud serves over HTTPS. It enables
+// clients that lack direct access to Ambassador Cloud to retrieve those artifacts using their
+// connection to the traffic-manager.
+type Cache struct {
+	dir    string
+	host   string
+	ttl    time.Duration
+	client *http.Client
+
+	lock    sync.Mutex
+	fetches map[string]*fetch
+}
+
+// fetch is a download that is in progress. Concurrent requests for the same URL wait for it
+// instead of starting downloads of their own.
+type fetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewCache returns a Cache that stores its artifacts in the given directory, only serves artifacts
+// from the given host, and downloads a cached artifact again once it is older than ttl.
+func NewCache(dir, host string, ttl time.Duration, client *http.Client) *Cache {
+	return &Cache{
+		dir:     dir,
+		host:    host,
+		ttl:     ttl,
+		client:  client,
+		fetches: make(map[string]*fetch),
+	}
+}
+
+// Open returns the artifact at the given URL. The artifact is downloaded unless a copy that hasn't
+// expired is cached. An expired copy is returned when the download fails. The given header is
+// added to the download request, and it's part of the cache key, because it carries the credentials
+// that the artifact is downloaded with.
+func (c *Cache) Open(ctx context.Context, urlStr string, header http.Header) (*os.File, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" || !strings.EqualFold(u.Hostname(), c.host) {
+		return nil, fmt.Errorf("%w: %q", ErrNotAllowed, urlStr)
+	}
+	path := filepath.Join(c.dir, cacheKey(u.String(), header))
+
+	if st, err := os.Stat(path); err == nil && time.Since(st.ModTime()) < c.ttl {
+		return os.Open(path)
+	}
+
+	c.lock.Lock()
+	f, ok := c.fetches[path]
+	if !ok {
+		f = &fetch{done: make(chan struct{})}
+		c.fetches[path] = f
+
+		// The download must complete even if the request that triggered it is cancelled, because other
+		// requests might wait for it.
+		dctx := dcontext.WithoutCancel(ctx)
+		go func() {
+			f.err = c.download(dctx, u.String(), header, path)
+			c.lock.Lock()
+			delete(c.fetches, path)
+			c.lock.Unlock()
+			close(f.done)
+		}()
+	}
+	c.lock.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-f.done:
+	}
+	if f.err != nil {
+		if _, err := os.Stat(path); err == nil {
+			dlog.Warnf(ctx, "Serving expired copy of %s: %v", urlStr, f.err)
+			return os.Open(path)
+		}
+		return nil, f.err
+	}
+	return os.Open(path)
+}
+
+// cacheKey returns the name of the file that caches the artifact at the given URL when it's downloaded
+// using the given header.
+func cacheKey(urlStr string, header http.Header) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, urlStr)
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range header[k] {
+			_, _ = fmt.Fprintf(h, "\x00%s\x00%s", k, v)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// download retrieves the artifact at the given URL and stores it at path. The artifact is written to
+// a temporary file first so that a partial download never replaces a complete one.
+func (c *Cache) download(ctx context.Context, urlStr string, header http.Header, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	dlog.Debugf(ctx, "Downloading artifact %s", urlStr)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("artifact URL %q returned HTTP %v", urlStr, resp.StatusCode)
+	}
+
+	if err = os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, "download-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err = io.Copy(tmp, resp.Body); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,166 @@
+package artifact
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+func readAll(t *testing.T, f *os.File, err error) string {
+	t.Helper()
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestCache_Open(t *testing.T) {
+	var downloads int32
+	var fail int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		atomic.AddInt32(&downloads, 1)
+		assert.Equal(t, "secret", r.Header.Get("X-Ambassador-Api-Key"))
+		_, _ = io.WriteString(w, "artifact "+r.URL.Path)
+	}))
+	defer srv.Close()
+	su, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	ctx := dlog.NewTestContext(t, false)
+	c := NewCache(t.TempDir(), su.Hostname(), time.Hour, srv.Client())
+	hdr := http.Header{"X-Ambassador-Api-Key": []string{"secret"}}
+
+	// Concurrent requests for the same artifact result in one download
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := c.Open(ctx, srv.URL+"/bin/pro", hdr)
+			assert.Equal(t, "artifact /bin/pro", readAll(t, f, err))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&downloads))
+
+	// Expired artifacts are downloaded again, but served anyway when the download fails
+	c.ttl = 0
+	f, err := c.Open(ctx, srv.URL+"/bin/pro", hdr)
+	assert.Equal(t, "artifact /bin/pro", readAll(t, f, err))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&downloads))
+	atomic.StoreInt32(&fail, 1)
+	f, err = c.Open(ctx, srv.URL+"/bin/pro", hdr)
+	assert.Equal(t, "artifact /bin/pro", readAll(t, f, err))
+	_, err = c.Open(ctx, srv.URL+"/bin/other", hdr)
+	assert.Error(t, err)
+
+	_, err = c.Open(ctx, "https://example.com/bin/pro", hdr)
+	assert.ErrorIs(t, err, ErrNotAllowed)
+	_, err = c.Open(ctx, "http://"+su.Host+"/bin/pro", hdr)
+	assert.ErrorIs(t, err, ErrNotAllowed)
+}
+
+func TestCache_OpenCancelled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = io.WriteString(w, "slow")
+	}))
+	defer srv.Close()
+	su, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(dlog.NewTestContext(t, false), 100*time.Millisecond)
+	defer cancel()
+	c := NewCache(t.TempDir(), su.Hostname(), time.Hour, srv.Client())
+	_, err = c.Open(ctx, srv.URL+"/slow", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The download continues and completes
+	close(release)
+	assert.Eventually(t, func() bool {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return len(c.fetches) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	f, err := c.Open(dlog.NewTestContext(t, false), srv.URL+"/slow", nil)
+	assert.Equal(t, "slow", readAll(t, f, err))
+}
+
+func TestCache_OpenCredentials(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Ambassador-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, "licensed")
+	}))
+	defer srv.Close()
+	su, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	ctx := dlog.NewTestContext(t, false)
+	c := NewCache(t.TempDir(), su.Hostname(), time.Hour, srv.Client())
+	f, err := c.Open(ctx, srv.URL+"/bin/pro", http.Header{"X-Ambassador-Api-Key": []string{"secret"}})
+	assert.Equal(t, "licensed", readAll(t, f, err))
+
+	// A copy that was downloaded using one client's credentials isn't served to other clients
+	_, err = c.Open(ctx, srv.URL+"/bin/pro", http.Header{"X-Ambassador-Api-Key": []string{"other"}})
+	assert.Error(t, err)
+	_, err = c.Open(ctx, srv.URL+"/bin/pro", nil)
+	assert.Error(t, err)
+}
+
+func TestCache_OpenFirstCallerCancelled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = io.WriteString(w, "shared")
+	}))
+	defer srv.Close()
+	su, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	c := NewCache(t.TempDir(), su.Hostname(), time.Hour, srv.Client())
+	first, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := c.Open(first, srv.URL+"/shared", nil)
+		firstDone <- err
+	}()
+	require.Eventually(t, func() bool {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return len(c.fetches) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The second caller waits for the download that the first caller started
+	secondDone := make(chan string, 1)
+	go func() {
+		f, err := c.Open(dlog.NewTestContext(t, false), srv.URL+"/shared", nil)
+		secondDone <- readAll(t, f, err)
+	}()
+
+	// The first caller gives up, which doesn't affect the download
+	cancel()
+	assert.ErrorIs(t, <-firstDone, context.Canceled)
+	close(release)
+	assert.Equal(t, "shared", <-secondDone)
+}
@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+)
+
+// resolvConfPath is the resolv.conf that the kubelet generates for the traffic-manager's pod.
+const resolvConfPath = "/etc/resolv.conf"
+
+// defaultClusterDomain is used when the cluster domain can't be detected.
+const defaultClusterDomain = "cluster.local."
+
+// detectClusterDomain returns the fully qualified domain of the cluster. A domain that is configured using
+// the TELEPRESENCE_CLUSTER_DOMAIN environment variable takes precedence. Otherwise, the domain is taken from
+// the search path that the kubelet generates for the pod from its --cluster-domain, and as a last resort, from
+// the canonical name of the kubernetes.default.svc service.
+func detectClusterDomain(ctx context.Context, resolvConf string) string {
+	if domain := managerutil.GetEnv(ctx).ClusterDomain; domain != "" {
+		dlog.Infof(ctx, "Using the configured cluster domain %q", domain)
+		return fqdn(domain)
+	}
+	if domain, err := clusterDomainFromResolvConf(resolvConf); err != nil {
+		dlog.Infof(ctx, "Unable to determine cluster domain from %s: %v", resolvConf, err)
+	} else if domain != "" {
+		return domain
+	}
+
+	const apiSvc = "kubernetes.default.svc"
+	cn, err := net.LookupCNAME(apiSvc)
+	if err != nil || !strings.HasPrefix(cn, apiSvc+".") {
+		dlog.Infof(ctx, "Unable to determine cluster domain from CNAME of %s: %v", apiSvc, err)
+		return defaultClusterDomain
+	}
+	return cn[len(apiSvc)+1:]
+}
+
+// clusterDomainFromResolvConf returns the cluster domain found in the search path of the given resolv.conf,
+// i.e. the <domain> of its svc.<domain> entry, or an empty string if there's no such entry.
+func clusterDomainFromResolvConf(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0] != "search" {
+			continue
+		}
+		for _, sp := range fields[1:] {
+			sp = strings.TrimSuffix(sp, ".")
+			if strings.HasPrefix(sp, "svc.") && len(sp) > 4 {
+				return fqdn(sp[4:]), nil
+			}
+		}
+	}
+	return "", sc.Err()
+}
+
+func fqdn(domain string) string {
+	return strings.TrimSuffix(domain, ".") + "."
+}
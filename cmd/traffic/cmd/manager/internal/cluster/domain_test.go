@@ -0,0 +1,49 @@
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+)
+
+func Test_clusterDomainFromResolvConf(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "resolv.conf")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	domain, err := clusterDomainFromResolvConf(write(`nameserver 10.43.0.10
+search ambassador.svc.k8s.corp.example svc.k8s.corp.example k8s.corp.example
+options ndots:5
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "k8s.corp.example.", domain)
+
+	domain, err = clusterDomainFromResolvConf(write("nameserver 10.0.0.1\nsearch example.com\n"))
+	require.NoError(t, err)
+	assert.Empty(t, domain)
+
+	_, err = clusterDomainFromResolvConf(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func Test_detectClusterDomain(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "resolv.conf")
+	require.NoError(t, os.WriteFile(path, []byte("search default.svc.rancher.internal svc.rancher.internal\n"), 0600))
+
+	ctx := managerutil.WithEnv(dlog.NewTestContext(t, false), &managerutil.Env{})
+	assert.Equal(t, "rancher.internal.", detectClusterDomain(ctx, path))
+
+	// A configured domain takes precedence
+	ctx = managerutil.WithEnv(ctx, &managerutil.Env{ClusterDomain: "cluster.example"})
+	assert.Equal(t, "cluster.example.", detectClusterDomain(ctx, path))
+}
@@ -14,6 +14,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/informers"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 
 	"github.com/datawire/dlib/dlog"
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
@@ -37,9 +38,13 @@ type Info interface {
 	// their name
 	GetTrafficManagerPods(context.Context) ([]*corev1.Pod, error)
 
+	// WatchServices writes the services of the cluster, and then the changes to them, on the given stream
+	WatchServices(context.Context, rpc.Manager_WatchServicesServer) error
+
 	// GetTrafficAgentPods acquires all pods that have a `traffic-agent`
-	// container in their spec
-	GetTrafficAgentPods(context.Context, string) ([]*corev1.Pod, error)
+	// container in their spec, optionally restricted to a namespace and
+	// a label selector
+	GetTrafficAgentPods(ctx context.Context, agents, namespace, selector string) ([]*corev1.Pod, error)
 }
 
 type subnetRetriever interface {
@@ -54,6 +59,8 @@ type info struct {
 
 	// clusterID is the UID of the default namespace
 	clusterID string
+
+	services *serviceWatcher
 }
 
 func NewInfo(ctx context.Context) Info {
@@ -110,67 +117,56 @@ func NewInfo(ctx context.Context) Info {
 			Namespace: "openshift-dns",
 		},
 	}
+	var dnsIPs []net.IP
 	for _, dnsService := range dnsServices {
 		if svc, err := client.Services(dnsService.Namespace).Get(ctx, dnsService.Name, metav1.GetOptions{}); err == nil {
 			dlog.Infof(ctx, "Using DNS IP from %s.%s", svc.Name, svc.Namespace)
 			oi.KubeDnsIp = iputil.Parse(svc.Spec.ClusterIP)
+			if oi.KubeDnsIp != nil {
+				dnsIPs = append(dnsIPs, oi.KubeDnsIp)
+			}
+			for _, ip := range svc.Spec.ClusterIPs {
+				if pip := iputil.Parse(ip); pip != nil && !pip.Equal(oi.KubeDnsIp) {
+					dnsIPs = append(dnsIPs, pip)
+				}
+			}
 			break
 		}
 	}
 
-	apiSvc := "kubernetes.default.svc"
-	if cn, err := net.LookupCNAME(apiSvc); err != nil {
-		dlog.Infof(ctx, `Unable to determine cluster domain from CNAME of %s: %v"`, err, apiSvc)
-		oi.ClusterDomain = "cluster.local."
-	} else {
-		oi.ClusterDomain = cn[len(apiSvc)+1:]
-	}
+	oi.ClusterDomain = detectClusterDomain(ctx, resolvConfPath)
 	dlog.Infof(ctx, "Using cluster domain %q", oi.ClusterDomain)
 
 	// make an attempt to create a service with ClusterIP that is out of range and then
 	// check the error message for the correct range as suggested tin the second answer here:
 	//   https://stackoverflow.com/questions/44190607/how-do-you-find-the-cluster-service-cidr-of-a-kubernetes-cluster
 	// This requires an additional permission to create a service, which the traffic-manager
-	// should have.
+	// should have. The attempt is made once for each IP family so that both subnets of a
+	// dual-stack cluster are found.
 	env := managerutil.GetEnv(ctx)
-	svc := corev1.Service{
-		TypeMeta: metav1.TypeMeta{
-			Kind: "Service",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: env.ManagerNamespace,
-			Name:      "t2-tst-dummy",
-		},
-		Spec: corev1.ServiceSpec{
-			Ports:     []corev1.ServicePort{{Port: 443}},
-			ClusterIP: "1.1.1.1",
-		},
-	}
-	if _, err = client.Services(env.ManagerNamespace).Create(ctx, &svc, metav1.CreateOptions{}); err != nil {
-		svcCIDRrx := regexp.MustCompile(`range of valid IPs is (.*)$`)
-		if match := svcCIDRrx.FindStringSubmatch(err.Error()); match != nil {
-			var cidr *net.IPNet
-			if _, cidr, err = net.ParseCIDR(match[1]); err != nil {
-				dlog.Errorf(ctx, "unable to parse service CIDR %q", match[1])
-			} else {
-				dlog.Infof(ctx, "Extracting service subnet %v from create service error message", cidr)
-				oi.ServiceSubnet = iputil.IPNetToRPC(cidr)
-			}
-		} else {
-			dlog.Errorf(ctx, "unable to extract service subnet from error message %q", err.Error())
-		}
+	var serviceSubnets []*net.IPNet
+	for _, ip := range []string{"1.1.1.1", "1::1"} {
+		serviceSubnets = append(serviceSubnets, probeServiceSubnets(ctx, client, env.ManagerNamespace, ip)...)
 	}
 
-	if oi.ServiceSubnet == nil && oi.KubeDnsIp != nil {
+	if len(serviceSubnets) == 0 {
 		// Using a "kubectl cluster-info dump" or scanning all services generates a lot of unwanted traffic
 		// and would quite possibly also require elevated permissions, so instead, we derive the service subnet
-		// from the kubeDNS IP. This is cheating but a cluster may only have one service subnet and the mask is
-		// unlikely to cover less than half the bits.
-		dlog.Infof(ctx, "Deriving serviceSubnet from %s (the IP of kube-dns.kube-system)", net.IP(oi.KubeDnsIp))
-		bits := len(oi.KubeDnsIp) * 8
-		ones := bits / 2
-		mask := net.CIDRMask(ones, bits) // will yield a 16 bit mask on IPv4 and 64 bit mask on IPv6.
-		oi.ServiceSubnet = &rpc.IPNet{Ip: net.IP(oi.KubeDnsIp).Mask(mask), Mask: int32(ones)}
+		// from the kubeDNS IPs. This is cheating but a cluster may only have one service subnet per IP family
+		// and the mask is unlikely to cover less than half the bits.
+		for _, ip := range dnsIPs {
+			dlog.Infof(ctx, "Deriving serviceSubnet from %s (the IP of the cluster DNS service)", ip)
+			bits := len(ip) * 8
+			ones := bits / 2
+			mask := net.CIDRMask(ones, bits) // will yield a 16 bit mask on IPv4 and 64 bit mask on IPv6.
+			serviceSubnets = append(serviceSubnets, &net.IPNet{IP: ip.Mask(mask), Mask: mask})
+		}
+	}
+	for _, sn := range serviceSubnets {
+		oi.ServiceSubnets = append(oi.ServiceSubnets, iputil.IPNetToRPC(sn))
+	}
+	if len(oi.ServiceSubnets) > 0 {
+		oi.ServiceSubnet = oi.ServiceSubnets[0]
 	}
 
 	podCIDRStrategy := env.PodCIDRStrategy
@@ -192,9 +188,69 @@ func NewInfo(ctx context.Context) Info {
 	default:
 		dlog.Errorf(ctx, "invalid POD_CIDR_STRATEGY %q", podCIDRStrategy)
 	}
+
+	oi.services = newServiceWatcher()
+	go oi.services.run(ctx)
 	return &oi
 }
 
+// probeServiceSubnets attempts to create a service with the given, most likely out of range, ClusterIP and
+// returns the service subnets that are reported in the resulting error message.
+func probeServiceSubnets(ctx context.Context, client typedcorev1.CoreV1Interface, namespace, clusterIP string) []*net.IPNet {
+	svc := corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind: "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      "t2-tst-dummy",
+		},
+		Spec: corev1.ServiceSpec{
+			Ports:     []corev1.ServicePort{{Port: 443}},
+			ClusterIP: clusterIP,
+		},
+	}
+	_, err := client.Services(namespace).Create(ctx, &svc, metav1.CreateOptions{})
+	if err == nil {
+		// Very unlikely, but the IP happened to be in range.
+		_ = client.Services(namespace).Delete(ctx, svc.Name, metav1.DeleteOptions{})
+		return nil
+	}
+	cidrs, err := parseServiceSubnets(err.Error())
+	if err != nil {
+		if net.ParseIP(clusterIP).To4() == nil {
+			// Single-stack IPv4 clusters will reject the IPv6 address without revealing a range
+			dlog.Debugf(ctx, "unable to extract IPv6 service subnet: %v", err)
+		} else {
+			dlog.Error(ctx, err)
+		}
+		return nil
+	}
+	dlog.Infof(ctx, "Extracting service subnets %v from create service error message", cidrs)
+	return cidrs
+}
+
+var svcCIDRrx = regexp.MustCompile(`range of valid IPs is (.*)$`)
+
+// parseServiceSubnets extracts the service subnets from the error message that the API server returns when
+// a service is created using an invalid ClusterIP. The message contains a comma separated list when the
+// cluster is dual-stack.
+func parseServiceSubnets(msg string) ([]*net.IPNet, error) {
+	match := svcCIDRrx.FindStringSubmatch(msg)
+	if match == nil {
+		return nil, fmt.Errorf("unable to extract service subnet from error message %q", msg)
+	}
+	var cidrs []*net.IPNet
+	for _, s := range strings.Split(match[1], ",") {
+		_, cidr, err := net.ParseCIDR(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse service CIDR %q", s)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
 func (oi *info) watchNodeSubnets(ctx context.Context) bool {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -287,6 +343,10 @@ func (oi *info) Watch(ctx context.Context, oiStream rpc.Manager_WatchClusterInfo
 	return nil
 }
 
+func (oi *info) WatchServices(ctx context.Context, stream rpc.Manager_WatchServicesServer) error {
+	return oi.services.watch(ctx, stream)
+}
+
 func (oi *info) GetClusterID() string {
 	return oi.clusterID
 }
@@ -294,11 +354,13 @@ func (oi *info) GetClusterID() string {
 // clusterInfo must be called with accLock locked
 func (oi *info) clusterInfo() *rpc.ClusterInfo {
 	ci := &rpc.ClusterInfo{
-		KubeDnsIp:     oi.KubeDnsIp,
-		ServiceSubnet: oi.ServiceSubnet,
-		PodSubnets:    make([]*rpc.IPNet, len(oi.PodSubnets)),
-		ClusterDomain: oi.ClusterDomain,
+		KubeDnsIp:      oi.KubeDnsIp,
+		ServiceSubnet:  oi.ServiceSubnet,
+		ServiceSubnets: make([]*rpc.IPNet, len(oi.ServiceSubnets)),
+		PodSubnets:     make([]*rpc.IPNet, len(oi.PodSubnets)),
+		ClusterDomain:  oi.ClusterDomain,
 	}
+	copy(ci.ServiceSubnets, oi.ServiceSubnets)
 	copy(ci.PodSubnets, oi.PodSubnets)
 	return ci
 }
@@ -320,14 +382,15 @@ func toRPCSubnets(cidrMap subnet.Set) []*rpc.IPNet {
 }
 
 // GetTrafficAgentPods gets all pods that have a `traffic-agent` container
-// in them.
-func (oi *info) GetTrafficAgentPods(ctx context.Context, agents string) ([]*corev1.Pod, error) {
+// in them. An empty namespace means all namespaces, and an empty selector
+// means all pods.
+func (oi *info) GetTrafficAgentPods(ctx context.Context, agents, namespace, selector string) ([]*corev1.Pod, error) {
 	// We don't get agents if they explicitly say false
 	if agents == "None" {
 		return nil, nil
 	}
 	client := k8sapi.GetK8sInterface(ctx).CoreV1()
-	podList, err := client.Pods("").List(ctx, metav1.ListOptions{})
+	podList, err := client.Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
 	if err != nil {
 		return nil, err
 	}
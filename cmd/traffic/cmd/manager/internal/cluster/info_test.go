@@ -0,0 +1,59 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseServiceSubnets(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "IPv4",
+			msg:  `Service "t2-tst-dummy" is invalid: spec.clusterIPs: Invalid value: []string{"1.1.1.1"}: failed to allocated ip:1.1.1.1 with error:provided IP is not in the valid range. The range of valid IPs is 10.96.0.0/12`,
+			want: []string{"10.96.0.0/12"},
+		},
+		{
+			name: "IPv6",
+			msg:  `Service "t2-tst-dummy" is invalid: spec.clusterIPs: Invalid value: []string{"1::1"}: failed to allocated ip:1::1 with error:provided IP is not in the valid range. The range of valid IPs is fd00:10:96::/112`,
+			want: []string{"fd00:10:96::/112"},
+		},
+		{
+			name: "dual-stack",
+			msg:  `The range of valid IPs is 10.96.0.0/12, fd00:10:96::/112`,
+			want: []string{"10.96.0.0/12", "fd00:10:96::/112"},
+		},
+		{
+			name:    "no range",
+			msg:     `Service "t2-tst-dummy" is invalid: spec.ipFamilies[0]: Invalid value: "IPv6": not configured on this cluster`,
+			wantErr: true,
+		},
+		{
+			name:    "bad CIDR",
+			msg:     `The range of valid IPs is 10.96.0.0/99`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseServiceSubnets(tt.msg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			gs := make([]string, len(got))
+			for i, sn := range got {
+				gs[i] = sn.String()
+			}
+			assert.Equal(t, tt.want, gs)
+		})
+	}
+}
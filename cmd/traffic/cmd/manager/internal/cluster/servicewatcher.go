@@ -0,0 +1,193 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+// serviceWatcher keeps track of the services of the cluster using a shared informer, and distributes the
+// changes to its subscribers. All clients share the same informer, so the load on the API server doesn't
+// grow with the number of clients.
+type serviceWatcher struct {
+	lock        sync.Mutex
+	services    map[string]*rpc.ServiceInfo // keyed by "name.namespace"
+	subscribers map[*serviceSubscriber]struct{}
+	synced      chan struct{}
+}
+
+// serviceSubscriber collects the updates that haven't yet been sent to a subscriber. An update replaces
+// a pending update of the same service, so a slow subscriber only gets the latest state of each service.
+type serviceSubscriber struct {
+	pending map[string]*rpc.ServiceUpdate
+	ready   chan struct{}
+}
+
+func newServiceWatcher() *serviceWatcher {
+	return &serviceWatcher{
+		services:    make(map[string]*rpc.ServiceInfo),
+		subscribers: make(map[*serviceSubscriber]struct{}),
+		synced:      make(chan struct{}),
+	}
+}
+
+// run starts the informer and blocks until the given context is done.
+func (w *serviceWatcher) run(ctx context.Context) {
+	informerFactory := informers.NewSharedInformerFactory(k8sapi.GetK8sInterface(ctx), 0)
+	informer := informerFactory.Core().V1().Services().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if svc, ok := obj.(*corev1.Service); ok {
+				w.update(serviceInfo(svc), false)
+			}
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			if svc, ok := newObj.(*corev1.Service); ok {
+				w.update(serviceInfo(svc), false)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if dfu, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = dfu.Obj
+			}
+			if svc, ok := obj.(*corev1.Service); ok {
+				w.update(serviceInfo(svc), true)
+			}
+		},
+	})
+	informerFactory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return
+	}
+	w.lock.Lock()
+	dlog.Infof(ctx, "Watching %d services", len(w.services))
+	w.lock.Unlock()
+	close(w.synced)
+	<-ctx.Done()
+}
+
+func serviceInfo(svc *corev1.Service) *rpc.ServiceInfo {
+	si := &rpc.ServiceInfo{Name: svc.Name, Namespace: svc.Namespace}
+	ips := svc.Spec.ClusterIPs
+	if len(ips) == 0 && svc.Spec.ClusterIP != "" {
+		ips = []string{svc.Spec.ClusterIP}
+	}
+	for _, ip := range ips {
+		if pip := iputil.Parse(ip); pip != nil {
+			si.ClusterIps = append(si.ClusterIps, pip)
+		}
+	}
+	return si
+}
+
+func serviceKey(si *rpc.ServiceInfo) string {
+	return si.Name + "." + si.Namespace
+}
+
+func equalIPs(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *serviceWatcher) update(si *rpc.ServiceInfo, deleted bool) {
+	key := serviceKey(si)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if deleted {
+		if _, ok := w.services[key]; !ok {
+			return
+		}
+		delete(w.services, key)
+	} else {
+		if old, ok := w.services[key]; ok && equalIPs(old.ClusterIps, si.ClusterIps) {
+			// Only changes that affect the clients are distributed.
+			return
+		}
+		w.services[key] = si
+	}
+	update := &rpc.ServiceUpdate{Service: si, Deleted: deleted}
+	for sub := range w.subscribers {
+		sub.pending[key] = update
+		select {
+		case sub.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// subscribe returns a new subscriber together with the snapshot of all current services.
+func (w *serviceWatcher) subscribe() (*serviceSubscriber, *rpc.ServiceSnapshot) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	sub := &serviceSubscriber{pending: make(map[string]*rpc.ServiceUpdate), ready: make(chan struct{}, 1)}
+	w.subscribers[sub] = struct{}{}
+	snapshot := &rpc.ServiceSnapshot{Updates: make([]*rpc.ServiceUpdate, 0, len(w.services))}
+	for _, si := range w.services {
+		snapshot.Updates = append(snapshot.Updates, &rpc.ServiceUpdate{Service: si})
+	}
+	return sub, snapshot
+}
+
+func (w *serviceWatcher) unsubscribe(sub *serviceSubscriber) {
+	w.lock.Lock()
+	delete(w.subscribers, sub)
+	w.lock.Unlock()
+}
+
+// next returns the pending updates of the given subscriber, or nil if there are none.
+func (w *serviceWatcher) next(sub *serviceSubscriber) *rpc.ServiceSnapshot {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(sub.pending) == 0 {
+		return nil
+	}
+	snapshot := &rpc.ServiceSnapshot{Updates: make([]*rpc.ServiceUpdate, 0, len(sub.pending))}
+	for key, update := range sub.pending {
+		snapshot.Updates = append(snapshot.Updates, update)
+		delete(sub.pending, key)
+	}
+	return snapshot
+}
+
+// watch sends a snapshot of all services on the given stream, once the informer has synced, and then a
+// snapshot of the changes each time services are added, modified, or deleted.
+func (w *serviceWatcher) watch(ctx context.Context, stream rpc.Manager_WatchServicesServer) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-w.synced:
+	}
+	sub, snapshot := w.subscribe()
+	defer w.unsubscribe(sub)
+	for {
+		if err := stream.Send(snapshot); err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("WatchServices failed to send update, %v", err))
+		}
+		for snapshot = nil; snapshot == nil; snapshot = w.next(sub) {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-sub.ready:
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+func testService(name, clusterIP string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+		Spec:       corev1.ServiceSpec{ClusterIP: clusterIP},
+	}
+}
+
+func TestServiceWatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+	cs := fake.NewSimpleClientset(testService("one", "10.0.0.1"))
+	ctx = k8sapi.WithK8sInterface(ctx, cs)
+
+	w := newServiceWatcher()
+	go w.run(ctx)
+	select {
+	case <-w.synced:
+	case <-time.After(5 * time.Second):
+		t.Fatal("informer didn't sync")
+	}
+
+	sub, snapshot := w.subscribe()
+	defer w.unsubscribe(sub)
+	require.Len(t, snapshot.Updates, 1)
+	assert.Equal(t, "one", snapshot.Updates[0].Service.Name)
+	assert.Equal(t, net.IP{10, 0, 0, 1}, net.IP(snapshot.Updates[0].Service.ClusterIps[0]))
+
+	nextSnapshot := func() *rpc.ServiceSnapshot {
+		t.Helper()
+		select {
+		case <-sub.ready:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update was received")
+		}
+		return w.next(sub)
+	}
+
+	svcs := cs.CoreV1().Services("ns")
+	_, err := svcs.Create(ctx, testService("two", "10.0.0.2"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	snapshot = nextSnapshot()
+	require.Len(t, snapshot.Updates, 1)
+	assert.Equal(t, "two", snapshot.Updates[0].Service.Name)
+	assert.False(t, snapshot.Updates[0].Deleted)
+
+	// A change that doesn't affect the cluster IPs isn't distributed
+	svc := testService("two", "10.0.0.2")
+	svc.Labels = map[string]string{"app": "two"}
+	_, err = svcs.Update(ctx, svc, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, svcs.Delete(ctx, "one", metav1.DeleteOptions{}))
+	snapshot = nextSnapshot()
+	require.Len(t, snapshot.Updates, 1)
+	assert.Equal(t, "one", snapshot.Updates[0].Service.Name)
+	assert.True(t, snapshot.Updates[0].Deleted)
+	assert.Nil(t, w.next(sub))
+}
+
+func TestServiceWatcher_coalesce(t *testing.T) {
+	w := newServiceWatcher()
+	sub, snapshot := w.subscribe()
+	assert.Empty(t, snapshot.Updates)
+
+	w.update(serviceInfo(testService("svc", "10.0.0.1")), false)
+	w.update(serviceInfo(testService("svc", "10.0.0.2")), false)
+	w.update(serviceInfo(testService("svc", "10.0.0.2")), true)
+
+	// Only the latest state of a service is sent to a subscriber that hasn't kept up
+	snapshot = w.next(sub)
+	require.Len(t, snapshot.Updates, 1)
+	assert.True(t, snapshot.Updates[0].Deleted)
+	assert.Nil(t, w.next(sub))
+
+	// An unsubscribed subscriber receives nothing
+	w.unsubscribe(sub)
+	w.update(serviceInfo(testService("svc", "10.0.0.3")), false)
+	assert.Nil(t, w.next(sub))
+}
@@ -6,22 +6,26 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	admission "k8s.io/api/admission/v1"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
+	"github.com/datawire/dlib/dcontext"
 	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/httprewrite"
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+	"github.com/telepresenceio/telepresence/v2/pkg/log"
 )
 
 var podResource = meta.GroupVersionResource{Version: "v1", Group: "", Resource: "pods"}
 var findMatchingService = install.FindMatchingService
 
-func agentInjector(ctx context.Context, req *admission.AdmissionRequest) ([]patchOperation, error) {
+func agentInjector(ctx context.Context, req *admission.AdmissionRequest) (patches []patchOperation, err error) {
 	// This handler should only get called on Pod objects as per the MutatingWebhookConfiguration in the YAML file.
 	// Pod objects are immutable, hence we only care about the CREATE event.
 	// Applying patches to Pods instead of Deployments means we don't have side effects on
@@ -62,11 +66,35 @@ func agentInjector(ctx context.Context, req *admission.AdmissionRequest) ([]patc
 		return nil, nil
 	}
 
+	if env := managerutil.GetEnv(ctx); !env.IsManagedNamespace(podNamespace) {
+		dlog.Debugf(ctx, "The %s pod is in namespace %s which isn't managed by the traffic-manager; skipping", refPodName, podNamespace)
+		return nil, nil
+	}
+
 	if pod.Annotations[install.InjectAnnotation] != "enabled" {
 		dlog.Debugf(ctx, `The %s pod has not enabled %s container injection through %q annotation; skipping`,
 			refPodName, install.AgentContainerName, install.InjectAnnotation)
 		return nil, nil
 	}
+	defer func() {
+		switch {
+		case err != nil:
+			recordInjectionEvent(ctx, &pod, podNamespace, core.EventTypeWarning, "AgentInjectionFailed",
+				fmt.Sprintf("Unable to inject %s into pod %s: %v", install.AgentContainerName, refPodName, err))
+		case len(patches) > 0:
+			recordInjectionEvent(ctx, &pod, podNamespace, core.EventTypeNormal, "AgentInjected",
+				fmt.Sprintf("Injected %s into pod %s", install.AgentContainerName, refPodName))
+		}
+	}()
+
+	var rewriteRules httprewrite.Rules
+	if rd, ok := pod.Annotations[install.HTTPRewriteAnnotation]; ok {
+		if rewriteRules, err = httprewrite.Parse(rd); err != nil {
+			err = fmt.Errorf("the %s pod has an invalid %q annotation: %w", refPodName, install.HTTPRewriteAnnotation, err)
+			dlog.Error(ctx, err)
+			return nil, err
+		}
+	}
 
 	svcName := pod.Annotations[install.ServiceNameAnnotation]
 	svc, err := findMatchingService(ctx, "", svcName, podNamespace, pod.Labels)
@@ -75,9 +103,18 @@ func agentInjector(ctx context.Context, req *admission.AdmissionRequest) ([]patc
 		return nil, err
 	}
 
+	// The ContainerNameAnnotation optionally names the container whose environment, volume mounts, and port are
+	// used by the agent in a pod with multiple containers.
+	cns, err := install.SelectContainers(pod.Spec.Containers, pod.Annotations[install.ContainerNameAnnotation])
+	if err != nil {
+		err = fmt.Errorf("the %s pod has an invalid %q annotation: %w", refPodName, install.ContainerNameAnnotation, err)
+		dlog.Error(ctx, err)
+		return nil, err
+	}
+
 	// The ServicePortAnnotation is expected to contain a string that identifies the service port.
 	portNameOrNumber := pod.Annotations[install.ServicePortAnnotation]
-	servicePort, appContainer, containerPortIndex, err := install.FindMatchingPort(pod.Spec.Containers, portNameOrNumber, svc)
+	servicePort, appContainer, containerPortIndex, err := install.FindMatchingPort(cns, portNameOrNumber, svc)
 	if err != nil {
 		err := fmt.Errorf("unable to find port to intercept; try the %s annotation: %w", install.ServicePortAnnotation, err)
 		dlog.Error(ctx, err)
@@ -88,16 +125,6 @@ func agentInjector(ctx context.Context, req *admission.AdmissionRequest) ([]patc
 		return nil, nil
 	}
 
-	env := managerutil.GetEnv(ctx)
-	ports := appContainer.Ports
-	for i := range ports {
-		if ports[i].ContainerPort == env.AgentPort {
-			err := fmt.Errorf("the %s pod container %s is exposing the same port (%d) as the %s sidecar", refPodName, appContainer.Name, env.AgentPort, install.AgentContainerName)
-			dlog.Info(ctx, err)
-			return nil, err
-		}
-	}
-
 	var appPort core.ContainerPort
 	switch {
 	case containerPortIndex >= 0:
@@ -114,23 +141,51 @@ func agentInjector(ctx context.Context, req *admission.AdmissionRequest) ([]patc
 		return nil, fmt.Errorf("container port unexpectedly not found in %s", refPodName)
 	}
 
+	// The ports that the traffic-agent listens to must not collide with ports that are used by other containers
+	// in the pod, or the agent will end up in a CrashLoopBackOff.
+	env := managerutil.GetEnv(ctx)
+	agentPort := env.AgentPort
+	apiPort := env.APIPort
+	remapped := install.ResolvePortConflicts(&pod.Spec, []int32{appPort.ContainerPort}, &agentPort, &apiPort)
+
 	// Create patch operations to add the traffic-agent sidecar
 	dlog.Infof(ctx, "Injecting %s into pod %s", install.AgentContainerName, refPodName)
 
-	var patches []patchOperation
+	if len(remapped) > 0 {
+		mapping := install.PortMappingString(remapped)
+		dlog.Infof(ctx, "The %s pod already uses some of the %s ports, remapped using %s", refPodName, install.AgentContainerName, mapping)
+		patches = addAnnotation(&pod, install.AgentPortsAnnotation, mapping, patches)
+	}
+	resources, err := install.AgentResources(core.ResourceRequirements(env.AgentResources), pod.Annotations)
+	if err != nil {
+		dlog.Error(ctx, err)
+		return nil, err
+	}
+	redirectMode, err := podRedirectMode(&pod, env.AgentRedirectMode)
+	if err != nil {
+		dlog.Error(ctx, err)
+		return nil, err
+	}
+	if redirectMode == install.RedirectIPTables && servicePort.TargetPort.Type == intstr.String {
+		// Leave the named port of the app container alone and redirect to the agent using
+		// iptables, just like when the service targets the port by number.
+		sp := *servicePort
+		sp.TargetPort = intstr.FromInt(int(appPort.ContainerPort))
+		servicePort = &sp
+	}
 	setGID := false
 	if servicePort.TargetPort.Type == intstr.Int || svc.Spec.ClusterIP == "None" {
-		patches = addInitContainer(ctx, &pod, servicePort, &appPort, patches)
+		patches = addInitContainer(ctx, &pod, servicePort, &appPort, agentPort, resources, patches)
 		setGID = true
 	} else {
 		patches = hidePorts(&pod, appContainer, servicePort.TargetPort.StrVal, patches)
 	}
 	tpEnv := make(map[string]string)
-	if env.APIPort != 0 {
-		tpEnv["TELEPRESENCE_API_PORT"] = strconv.Itoa(int(env.APIPort))
+	if apiPort != 0 {
+		tpEnv["TELEPRESENCE_API_PORT"] = strconv.Itoa(int(apiPort))
 	}
 	patches = addTPEnv(&pod, appContainer, tpEnv, patches)
-	patches, err = addAgentContainer(ctx, svc, &pod, servicePort, appContainer, &appPort, setGID, podName, podNamespace, patches)
+	patches, err = addAgentContainer(ctx, svc, &pod, servicePort, appContainer, &appPort, agentPort, apiPort, setGID, rewriteRules, resources, podName, podNamespace, patches)
 	if err != nil {
 		return nil, err
 	}
@@ -138,7 +193,96 @@ func agentInjector(ctx context.Context, req *admission.AdmissionRequest) ([]patc
 	return patches, nil
 }
 
-func addInitContainer(ctx context.Context, pod *core.Pod, svcPort *core.ServicePort, appPort *core.ContainerPort, patches []patchOperation) []patchOperation {
+// podRedirectMode returns the redirect mode declared by the RedirectModeAnnotation of the given pod, or the
+// given default when the pod has no such annotation.
+func podRedirectMode(pod *core.Pod, dflt install.RedirectMode) (install.RedirectMode, error) {
+	mode, ok := pod.Annotations[install.RedirectModeAnnotation]
+	if !ok {
+		return dflt, nil
+	}
+	rm, err := install.NewRedirectMode(mode)
+	if err != nil {
+		return dflt, fmt.Errorf("annotation %s: %w", install.RedirectModeAnnotation, err)
+	}
+	return rm, nil
+}
+
+// recordInjectionEvent records a Kubernetes Event on the workload that owns the given pod. The pod is about to
+// be created, so the workload is looked up in a goroutine that doesn't delay the admission response.
+func recordInjectionEvent(ctx context.Context, pod *core.Pod, namespace, eventType, reason, message string) {
+	if k8sapi.GetK8sInterface(ctx) == nil {
+		return
+	}
+	owners := pod.OwnerReferences
+	ctx = dcontext.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		wl, err := ownerWorkload(ctx, owners, namespace)
+		if err != nil {
+			dlog.Errorf(ctx, "unable to record %s event: %v", reason, err)
+			return
+		}
+		if wl != nil {
+			managerutil.RecordWorkloadEvent(ctx, wl, eventType, reason, message)
+		}
+	}()
+}
+
+// ownerWorkload returns the workload that controls a pod with the given owners, i.e. its StatefulSet, its
+// ReplicaSet, the Deployment or Argo Rollout of its ReplicaSet, its Job, or the CronJob of its Job. It returns
+// nil when no such workload exists.
+func ownerWorkload(ctx context.Context, owners []meta.OwnerReference, namespace string) (k8sapi.Workload, error) {
+	for i := range owners {
+		owner := &owners[i]
+		if owner.Controller == nil || !*owner.Controller {
+			continue
+		}
+		switch owner.Kind {
+		case "StatefulSet":
+			return k8sapi.GetStatefulSet(ctx, owner.Name, namespace)
+		case "Job":
+			job, err := k8sapi.GetJob(ctx, owner.Name, namespace)
+			if err != nil {
+				return nil, err
+			}
+			for _, jobOwner := range job.GetOwnerReferences() {
+				if jobOwner.Controller != nil && *jobOwner.Controller && jobOwner.Kind == "CronJob" {
+					return k8sapi.GetCronJob(ctx, jobOwner.Name, namespace)
+				}
+			}
+			return job, nil
+		case "ReplicaSet":
+			rs, err := k8sapi.GetReplicaSet(ctx, owner.Name, namespace)
+			if err != nil {
+				return nil, err
+			}
+			for _, rsOwner := range rs.GetOwnerReferences() {
+				if rsOwner.Controller == nil || !*rsOwner.Controller {
+					continue
+				}
+				switch {
+				case rsOwner.Kind == "Deployment":
+					return k8sapi.GetDeployment(ctx, rsOwner.Name, namespace)
+				case k8sapi.IsRolloutOwner(rsOwner.APIVersion, rsOwner.Kind):
+					return k8sapi.GetRollout(ctx, rsOwner.Name, namespace)
+				}
+			}
+			return rs, nil
+		}
+	}
+	return nil, nil
+}
+
+func addInitContainer(
+	ctx context.Context,
+	pod *core.Pod,
+	svcPort *core.ServicePort,
+	appPort *core.ContainerPort,
+	agentPort int32,
+	resources core.ResourceRequirements,
+	patches []patchOperation,
+) []patchOperation {
 	env := managerutil.GetEnv(ctx)
 	proto := svcPort.Protocol
 	if proto == "" {
@@ -146,13 +290,14 @@ func addInitContainer(ctx context.Context, pod *core.Pod, svcPort *core.ServiceP
 	}
 	containerPort := core.ContainerPort{
 		Protocol:      proto,
-		ContainerPort: env.AgentPort,
+		ContainerPort: agentPort,
 	}
 	container := install.InitContainer(
 		env.AgentRegistry+"/"+env.AgentImage,
 		containerPort,
 		int(appPort.ContainerPort),
 	)
+	container.Resources = resources
 
 	if pod.Spec.InitContainers == nil {
 		patches = append(patches, patchOperation{
@@ -203,7 +348,10 @@ func addAgentContainer(
 	svcPort *core.ServicePort,
 	appContainer *core.Container,
 	appPort *core.ContainerPort,
+	agentPort, apiPort int32,
 	setGID bool,
+	rewriteRules httprewrite.Rules,
+	resources core.ResourceRequirements,
 	podName, namespace string,
 	patches []patchOperation,
 ) ([]patchOperation, error) {
@@ -240,6 +388,10 @@ func addAgentContainer(
 				tokens := strings.Split(owner.Name, "-")
 				agentName = strings.Join(tokens[:len(tokens)-1], "-")
 				break owners
+			case "Job":
+				// If it's owned by a job, then it's the same as the job, or as the cronjob that created the job
+				agentName = jobAgentName(ctx, owner.Name, namespace)
+				break owners
 			}
 		}
 	}
@@ -259,29 +411,94 @@ func addAgentContainer(
 	}
 	containerPort := core.ContainerPort{
 		Protocol:      proto,
-		ContainerPort: env.AgentPort,
+		ContainerPort: agentPort,
 	}
 	if svcPort.TargetPort.Type == intstr.String {
 		containerPort.Name = svcPort.TargetPort.StrVal
 	}
+	agentContainer := install.AgentContainer(
+		agentName,
+		env.AgentRegistry+"/"+env.AgentImage,
+		appContainer,
+		containerPort,
+		int(appPort.ContainerPort),
+		k8sapi.GetAppProto(ctx, env.AppProtocolStrategy, svcPort),
+		int(apiPort),
+		env.ManagerNamespace,
+		setGID,
+	)
+	agentContainer.Resources = resources
+	if len(rewriteRules) > 0 {
+		// The rules are passed in their validated and compacted form
+		agentContainer.Env = append(agentContainer.Env, core.EnvVar{
+			Name:  install.EnvPrefix + "HTTP_REWRITE",
+			Value: rewriteRules.String(),
+		})
+	}
+	agentContainer.Env = append(agentContainer.Env,
+		install.AgentTunnelEnv(env.AgentTunnelTCPIdleTimeout, env.AgentTunnelUDPIdleTimeout, env.AgentTunnelKeepAlive)...)
+	if env.LogFormat == log.FormatJSON {
+		// Let the agent log in the same format as the traffic-manager
+		agentContainer.Env = append(agentContainer.Env, install.AgentLogFormatEnv(env.LogFormat))
+	}
+	if k8sapi.IsJobPod(pod.OwnerReferences) {
+		// The pod of a job isn't done until all its containers have terminated, so the agent must exit when the
+		// app is done. It uses the shared process namespace to find out when that happens.
+		agentContainer.Env = append(agentContainer.Env, install.AgentExitWithAppEnv())
+		if pod.Spec.ShareProcessNamespace == nil || !*pod.Spec.ShareProcessNamespace {
+			patches = append(patches, patchOperation{
+				Op:    "add",
+				Path:  "/spec/shareProcessNamespace",
+				Value: true,
+			})
+		}
+	}
 	patches = append(patches, patchOperation{
-		Op:   "add",
-		Path: "/spec/containers/-",
-		Value: install.AgentContainer(
-			agentName,
-			env.AgentRegistry+"/"+env.AgentImage,
-			appContainer,
-			containerPort,
-			int(appPort.ContainerPort),
-			k8sapi.GetAppProto(ctx, env.AppProtocolStrategy, svcPort),
-			int(env.APIPort),
-			env.ManagerNamespace,
-			setGID,
-		)})
+		Op:    "add",
+		Path:  "/spec/containers/-",
+		Value: agentContainer,
+	})
 
 	return patches, nil
 }
 
+// jobAgentName returns the name of the agent of a pod that is owned by the given job. That's the name of
+// the CronJob that created the job, so that the agent keeps its name across the scheduled jobs, or the name
+// of the job itself.
+func jobAgentName(ctx context.Context, jobName, namespace string) string {
+	if k8sapi.GetK8sInterface(ctx) == nil {
+		return jobName
+	}
+	job, err := k8sapi.GetJob(ctx, jobName, namespace)
+	if err != nil {
+		dlog.Errorf(ctx, "unable to get job %s.%s: %v", jobName, namespace, err)
+		return jobName
+	}
+	for _, owner := range job.GetOwnerReferences() {
+		if owner.Controller != nil && *owner.Controller && owner.Kind == "CronJob" {
+			return owner.Name
+		}
+	}
+	return jobName
+}
+
+// addAnnotation creates a patch operation that adds the given annotation to the pod
+func addAnnotation(pod *core.Pod, key, value string, patches []patchOperation) []patchOperation {
+	if pod.Annotations == nil {
+		patches = append(patches, patchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: map[string]string{},
+		})
+	}
+	// The key must be escaped according to RFC 6901 since it contains a slash
+	return append(patches, patchOperation{
+		Op:    "add",
+		Path:  "/metadata/annotations/" + strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1"),
+		Value: value,
+	})
+}
+
 // addTPEnv adds telepresence specific environment variables to the app container
 func addTPEnv(pod *core.Pod, cn *core.Container, env map[string]string, patches []patchOperation) []patchOperation {
 	if len(env) == 0 {
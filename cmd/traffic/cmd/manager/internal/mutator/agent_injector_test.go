@@ -10,14 +10,19 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	admission "k8s.io/api/admission/v1"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
 	core "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
 
 	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
 )
 
 const serviceAccountMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
@@ -150,6 +155,25 @@ func TestTrafficAgentInjector(t *testing.T) {
 			defaultSvcFinder,
 			nil,
 		},
+		{
+			"Skip Precondition: Namespace not managed",
+			toAdmissionRequest(podResource, core.Pod{
+				ObjectMeta: meta.ObjectMeta{Annotations: map[string]string{
+					install.InjectAnnotation: "enabled",
+				}, Namespace: "some-ns", Name: "some-name"},
+				Spec: core.PodSpec{
+					Containers: []core.Container{
+						{Ports: []core.ContainerPort{}},
+					},
+				},
+			}),
+			"",
+			"",
+			defaultSvcFinder,
+			&managerutil.Env{
+				ManagedNamespaces: managerutil.Namespaces{"other-ns"},
+			},
+		},
 		{
 			"Skip Precondition: Sidecar already injected",
 			toAdmissionRequest(podResource, core.Pod{
@@ -200,27 +224,64 @@ func TestTrafficAgentInjector(t *testing.T) {
 			nil,
 		},
 		{
-			"Error Precondition: Sidecar has port collision",
+			"Apply Patch: Sidecar has port collision",
 			toAdmissionRequest(podResource, core.Pod{
 				ObjectMeta: meta.ObjectMeta{
 					Annotations: map[string]string{
 						install.InjectAnnotation: "enabled",
 					},
 					Labels: map[string]string{
-						"serivce": "some-name",
+						"service": "some-name",
 					},
 					Namespace: "some-ns",
 					Name:      "some-name"},
 				Spec: core.PodSpec{
 					Containers: []core.Container{
-						{Ports: []core.ContainerPort{
-							{Name: "http", ContainerPort: env.AgentPort},
-						}},
+						{
+							Name:  "some-app-name",
+							Image: "some-app-image",
+							Ports: []core.ContainerPort{
+								{Name: "http", ContainerPort: env.AgentPort},
+							},
+						},
+						{
+							Name:  "some-sidecar",
+							Image: "some-sidecar-image",
+							Ports: []core.ContainerPort{
+								{Name: "metrics", ContainerPort: 8080, HostPort: 9901},
+							},
+						},
 					},
 				},
 			}),
+			`[` +
+				`{"op":"add","path":"/metadata/annotations/telepresence.getambassador.io~1agent-ports","value":"9900=9902"},` +
+				`{"op":"replace","path":"/spec/containers/0/ports/0/name","value":"tm-http"},` +
+				`{"op":"add","path":"/spec/containers/-","value":{` +
+				`"name":"traffic-agent",` +
+				`"image":"docker.io/datawire/tel2:2.3.1",` +
+				`"args":["agent"],` +
+				`"ports":[{"name":"http","containerPort":9902,"protocol":"TCP"}],` +
+				`"env":[` +
+				`{"name":"TELEPRESENCE_CONTAINER","value":"some-app-name"},` +
+				`{"name":"_TEL_AGENT_LOG_LEVEL","value":"info"},` +
+				`{"name":"_TEL_AGENT_NAME","value":"some-name"},` +
+				`{"name":"_TEL_AGENT_NAMESPACE","valueFrom":{"fieldRef":{"fieldPath":"metadata.namespace"}}},` +
+				`{"name":"_TEL_AGENT_POD_IP","valueFrom":{"fieldRef":{"fieldPath":"status.podIP"}}},` +
+				`{"name":"_TEL_AGENT_APP_PORT","value":"9900"},` +
+				`{"name":"_TEL_AGENT_PORT","value":"9902"},` +
+				`{"name":"_TEL_AGENT_MANAGER_HOST","value":"traffic-manager.default"}` +
+				`],` +
+				`"resources":{},` +
+				`"volumeMounts":[{"name":"traffic-annotations","mountPath":"/tel_pod_info"}],` +
+				`"readinessProbe":{"exec":{"command":["/bin/stat","/tmp/agent/ready"]}}` +
+				`}},` +
+				`{"op":"add","path":"/spec/volumes/-","value":{` +
+				`"name":"traffic-annotations",` +
+				`"downwardAPI":{"items":[{"path":"annotations","fieldRef":{"fieldPath":"metadata.annotations"}}]}` +
+				`}}` +
+				`]`,
 			"",
-			"is exposing the same port (9900) as the traffic-agent sidecar",
 			defaultSvcFinder,
 			nil,
 		},
@@ -276,6 +337,179 @@ func TestTrafficAgentInjector(t *testing.T) {
 			defaultSvcFinder,
 			nil,
 		},
+		{
+			"Apply Patch: Job pod",
+			toAdmissionRequest(podResource, core.Pod{
+				ObjectMeta: meta.ObjectMeta{
+					Annotations: map[string]string{
+						install.InjectAnnotation: "enabled",
+					},
+					Labels: map[string]string{
+						"service": "some-name",
+					},
+					OwnerReferences: []meta.OwnerReference{{
+						APIVersion: "batch/v1",
+						Kind:       "Job",
+						Name:       "some-job",
+						Controller: func() *bool { b := true; return &b }(),
+					}},
+					Namespace: "some-ns",
+					Name:      "some-job-x7k2p"},
+				Spec: core.PodSpec{
+					Containers: []core.Container{{
+						Name:  "some-app-name",
+						Image: "some-app-image",
+						Ports: []core.ContainerPort{{
+							Name: "http", ContainerPort: 8888},
+						}},
+					},
+				},
+			}),
+			`[` +
+				`{"op":"replace","path":"/spec/containers/0/ports/0/name","value":"tm-http"},` +
+				`{"op":"add","path":"/spec/shareProcessNamespace","value":true},` +
+				`{"op":"add","path":"/spec/containers/-","value":{` +
+				`"name":"traffic-agent",` +
+				`"image":"docker.io/datawire/tel2:2.3.1",` +
+				`"args":["agent"],` +
+				`"ports":[{"name":"http","containerPort":9900,"protocol":"TCP"}],` +
+				`"env":[` +
+				`{"name":"TELEPRESENCE_CONTAINER","value":"some-app-name"},` +
+				`{"name":"_TEL_AGENT_LOG_LEVEL","value":"info"},` +
+				`{"name":"_TEL_AGENT_NAME","value":"some-job"},` +
+				`{"name":"_TEL_AGENT_NAMESPACE","valueFrom":{"fieldRef":{"fieldPath":"metadata.namespace"}}},` +
+				`{"name":"_TEL_AGENT_POD_IP","valueFrom":{"fieldRef":{"fieldPath":"status.podIP"}}},` +
+				`{"name":"_TEL_AGENT_APP_PORT","value":"8888"},` +
+				`{"name":"_TEL_AGENT_PORT","value":"9900"},` +
+				`{"name":"_TEL_AGENT_MANAGER_HOST","value":"traffic-manager.default"},` +
+				`{"name":"_TEL_AGENT_EXIT_WITH_APP","value":"true"}` +
+				`],` +
+				`"resources":{},` +
+				`"volumeMounts":[{"name":"traffic-annotations","mountPath":"/tel_pod_info"}],` +
+				`"readinessProbe":{"exec":{"command":["/bin/stat","/tmp/agent/ready"]}}` +
+				`}},` +
+				`{"op":"add","path":"/spec/volumes/-","value":{` +
+				`"name":"traffic-annotations",` +
+				`"downwardAPI":{"items":[{"path":"annotations","fieldRef":{"fieldPath":"metadata.annotations"}}]}` +
+				`}}` +
+				`]`,
+			"",
+			defaultSvcFinder,
+			nil,
+		},
+		{
+			"Error Precondition: Unknown container name",
+			toAdmissionRequest(podResource, core.Pod{
+				ObjectMeta: meta.ObjectMeta{
+					Annotations: map[string]string{
+						install.InjectAnnotation:        "enabled",
+						install.ContainerNameAnnotation: "worker",
+					},
+					Labels: map[string]string{
+						"service": "some-name",
+					},
+					Namespace: "some-ns",
+					Name:      "some-name"},
+				Spec: core.PodSpec{
+					Containers: []core.Container{{
+						Name:  "some-app-name",
+						Image: "some-app-image",
+						Ports: []core.ContainerPort{{
+							Name: "http", ContainerPort: 8888},
+						}},
+					},
+				},
+			}),
+			"",
+			`found no container named "worker", the containers are: some-app-name`,
+			defaultSvcFinder,
+			nil,
+		},
+		{
+			"Error Precondition: Invalid HTTP rewrite rules",
+			toAdmissionRequest(podResource, core.Pod{
+				ObjectMeta: meta.ObjectMeta{
+					Annotations: map[string]string{
+						install.InjectAnnotation:      "enabled",
+						install.HTTPRewriteAnnotation: `[{"pathPrefix": "api", "request": {"remove": ["Cookie"]}}]`,
+					},
+					Labels: map[string]string{
+						"service": "some-name",
+					},
+					Namespace: "some-ns",
+					Name:      "some-name"},
+				Spec: core.PodSpec{
+					Containers: []core.Container{{
+						Name:  "some-app-name",
+						Image: "some-app-image",
+						Ports: []core.ContainerPort{{
+							Name: "http", ContainerPort: 8888},
+						}},
+					},
+				},
+			}),
+			"",
+			"pathPrefix \"api\" must start with a slash",
+			defaultSvcFinder,
+			nil,
+		},
+		{
+			"Apply Patch: HTTP rewrite rules",
+			toAdmissionRequest(podResource, core.Pod{
+				ObjectMeta: meta.ObjectMeta{
+					Annotations: map[string]string{
+						install.InjectAnnotation: "enabled",
+						install.HTTPRewriteAnnotation: `
+- request:
+    set:
+      Authorization: Bearer dev`,
+					},
+					Labels: map[string]string{
+						"service": "some-name",
+					},
+					Namespace: "some-ns",
+					Name:      "some-name"},
+				Spec: core.PodSpec{
+					Containers: []core.Container{{
+						Name:  "some-app-name",
+						Image: "some-app-image",
+						Ports: []core.ContainerPort{{
+							Name: "http", ContainerPort: 8888},
+						}},
+					},
+				},
+			}),
+			`[` +
+				`{"op":"replace","path":"/spec/containers/0/ports/0/name","value":"tm-http"},` +
+				`{"op":"add","path":"/spec/containers/-","value":{` +
+				`"name":"traffic-agent",` +
+				`"image":"docker.io/datawire/tel2:2.3.1",` +
+				`"args":["agent"],` +
+				`"ports":[{"name":"http","containerPort":9900,"protocol":"TCP"}],` +
+				`"env":[` +
+				`{"name":"TELEPRESENCE_CONTAINER","value":"some-app-name"},` +
+				`{"name":"_TEL_AGENT_LOG_LEVEL","value":"info"},` +
+				`{"name":"_TEL_AGENT_NAME","value":"some-name"},` +
+				`{"name":"_TEL_AGENT_NAMESPACE","valueFrom":{"fieldRef":{"fieldPath":"metadata.namespace"}}},` +
+				`{"name":"_TEL_AGENT_POD_IP","valueFrom":{"fieldRef":{"fieldPath":"status.podIP"}}},` +
+				`{"name":"_TEL_AGENT_APP_PORT","value":"8888"},` +
+				`{"name":"_TEL_AGENT_PORT","value":"9900"},` +
+				`{"name":"_TEL_AGENT_MANAGER_HOST","value":"traffic-manager.default"},` +
+				`{"name":"_TEL_AGENT_HTTP_REWRITE","value":"[{\"request\":{\"set\":{\"Authorization\":\"Bearer dev\"}}}]"}` +
+				`],` +
+				`"resources":{},` +
+				`"volumeMounts":[{"name":"traffic-annotations","mountPath":"/tel_pod_info"}],` +
+				`"readinessProbe":{"exec":{"command":["/bin/stat","/tmp/agent/ready"]}}` +
+				`}},` +
+				`{"op":"add","path":"/spec/volumes/-","value":{` +
+				`"name":"traffic-annotations",` +
+				`"downwardAPI":{"items":[{"path":"annotations","fieldRef":{"fieldPath":"metadata.annotations"}}]}` +
+				`}}` +
+				`]`,
+			"",
+			defaultSvcFinder,
+			nil,
+		},
 		{
 			"Apply Patch: Telepresence API Port",
 			toAdmissionRequest(podResource, core.Pod{
@@ -685,6 +919,100 @@ func TestTrafficAgentInjector(t *testing.T) {
 			defaultSvcFinder,
 			nil,
 		},
+		{
+			"Apply Patch: Named port with iptables redirect mode",
+			toAdmissionRequest(podResource, core.Pod{
+				ObjectMeta: meta.ObjectMeta{
+					Annotations: map[string]string{
+						install.InjectAnnotation:       "enabled",
+						install.RedirectModeAnnotation: "iptables",
+					},
+					Labels: map[string]string{
+						"service": "some-name",
+					},
+					Namespace: "some-ns",
+					Name:      "some-name"},
+				Spec: core.PodSpec{
+					Containers: []core.Container{{
+						Name:  "some-app-name",
+						Image: "some-app-image",
+						Ports: []core.ContainerPort{{
+							Name: "http", ContainerPort: 8888},
+						}},
+					},
+				},
+			}),
+			`[` +
+				`{"op":"add","path":"/spec/initContainers","value":[]},` +
+				`{"op":"add","path":"/spec/initContainers/-","value":{` +
+				`"name":"tel-agent-init",` +
+				`"image":"docker.io/datawire/tel2:2.3.1",` +
+				`"args":["agent-init"],` +
+				`"env":[` +
+				`{"name":"APP_PORT","value":"8888"},` +
+				`{"name":"AGENT_PORT","value":"9900"},` +
+				`{"name":"AGENT_PROTOCOL","value":"TCP"}` +
+				`],` +
+				`"resources":{},` +
+				`"securityContext":{"capabilities":{"add":["NET_ADMIN"]}}` +
+				`}},` +
+				`{"op":"add","path":"/spec/containers/-","value":{` +
+				`"name":"traffic-agent",` +
+				`"image":"docker.io/datawire/tel2:2.3.1",` +
+				`"args":["agent"],` +
+				`"ports":[{"containerPort":9900,"protocol":"TCP"}],` +
+				`"env":[` +
+				`{"name":"TELEPRESENCE_CONTAINER","value":"some-app-name"},` +
+				`{"name":"_TEL_AGENT_LOG_LEVEL","value":"info"},` +
+				`{"name":"_TEL_AGENT_NAME","value":"some-name"},` +
+				`{"name":"_TEL_AGENT_NAMESPACE","valueFrom":{"fieldRef":{"fieldPath":"metadata.namespace"}}},` +
+				`{"name":"_TEL_AGENT_POD_IP","valueFrom":{"fieldRef":{"fieldPath":"status.podIP"}}},` +
+				`{"name":"_TEL_AGENT_APP_PORT","value":"8888"},` +
+				`{"name":"_TEL_AGENT_PORT","value":"9900"},` +
+				`{"name":"_TEL_AGENT_MANAGER_HOST","value":"traffic-manager.default"}` +
+				`],` +
+				`"resources":{},` +
+				`"volumeMounts":[{"name":"traffic-annotations","mountPath":"/tel_pod_info"}],` +
+				`"readinessProbe":{"exec":{"command":["/bin/stat","/tmp/agent/ready"]}},` +
+				`"securityContext":{"runAsUser":7777,"runAsGroup":7777,"runAsNonRoot":true}` +
+				`}},` +
+				`{"op":"add","path":"/spec/volumes/-","value":{` +
+				`"name":"traffic-annotations",` +
+				`"downwardAPI":{"items":[{"path":"annotations","fieldRef":{"fieldPath":"metadata.annotations"}}]}` +
+				`}}` +
+				`]`,
+			"",
+			defaultSvcFinder,
+			nil,
+		},
+		{
+			"Error Precondition: Invalid redirect mode",
+			toAdmissionRequest(podResource, core.Pod{
+				ObjectMeta: meta.ObjectMeta{
+					Annotations: map[string]string{
+						install.InjectAnnotation:       "enabled",
+						install.RedirectModeAnnotation: "nftables",
+					},
+					Labels: map[string]string{
+						"service": "some-name",
+					},
+					Namespace: "some-ns",
+					Name:      "some-name"},
+				Spec: core.PodSpec{
+					Containers: []core.Container{{
+						Name:  "some-app-name",
+						Image: "some-app-image",
+						Ports: []core.ContainerPort{{
+							Name: "http", ContainerPort: 8888},
+						}},
+					},
+				},
+			}),
+			"",
+			`invalid RedirectMode: "nftables"`,
+			defaultSvcFinder,
+			nil,
+		},
 	}
 
 	for _, test := range tests {
@@ -698,8 +1026,11 @@ func TestTrafficAgentInjector(t *testing.T) {
 				ae := reflect.ValueOf(test.envAdditions).Elem()
 				for i := ae.NumField() - 1; i >= 0; i-- {
 					ef := ae.Field(i)
-					if (ef.Kind() == reflect.String || ef.Kind() == reflect.Int32) && !ef.IsZero() {
-						ne.Field(i).Set(ef)
+					switch ef.Kind() {
+					case reflect.String, reflect.Int32, reflect.Slice:
+						if !ef.IsZero() {
+							ne.Field(i).Set(ef)
+						}
 					}
 				}
 				ctx = managerutil.WithEnv(ctx, &newEnv)
@@ -722,6 +1053,72 @@ func TestTrafficAgentInjector(t *testing.T) {
 	}
 }
 
+func Test_ownerWorkload(t *testing.T) {
+	yes := true
+	controller := func(kind, name string) []meta.OwnerReference {
+		return []meta.OwnerReference{{Kind: kind, Name: name, Controller: &yes}}
+	}
+	ctx := k8sapi.WithK8sInterface(context.Background(), fake.NewSimpleClientset(
+		&apps.Deployment{ObjectMeta: meta.ObjectMeta{Name: "echo", Namespace: "default"}},
+		&apps.ReplicaSet{ObjectMeta: meta.ObjectMeta{
+			Name:            "echo-697464c6c5",
+			Namespace:       "default",
+			OwnerReferences: controller("Deployment", "echo"),
+		}},
+		&apps.ReplicaSet{ObjectMeta: meta.ObjectMeta{Name: "standalone", Namespace: "default"}},
+		&apps.ReplicaSet{ObjectMeta: meta.ObjectMeta{
+			Name:      "canary-5d8f9c7b6",
+			Namespace: "default",
+			OwnerReferences: []meta.OwnerReference{
+				{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", Name: "canary", Controller: &yes},
+			},
+		}},
+		&apps.StatefulSet{ObjectMeta: meta.ObjectMeta{Name: "db", Namespace: "default"}},
+		&batch.Job{ObjectMeta: meta.ObjectMeta{Name: "migrate", Namespace: "default"}},
+		&batch.CronJob{ObjectMeta: meta.ObjectMeta{Name: "report", Namespace: "default"}},
+		&batch.Job{ObjectMeta: meta.ObjectMeta{
+			Name:            "report-27384756",
+			Namespace:       "default",
+			OwnerReferences: controller("CronJob", "report"),
+		}},
+	))
+
+	wl, err := ownerWorkload(ctx, controller("ReplicaSet", "echo-697464c6c5"), "default")
+	require.NoError(t, err)
+	assert.Equal(t, "Deployment", wl.GetKind())
+	assert.Equal(t, "echo", wl.GetName())
+
+	wl, err = ownerWorkload(ctx, controller("ReplicaSet", "standalone"), "default")
+	require.NoError(t, err)
+	assert.Equal(t, "ReplicaSet", wl.GetKind())
+
+	wl, err = ownerWorkload(ctx, controller("StatefulSet", "db"), "default")
+	require.NoError(t, err)
+	assert.Equal(t, "StatefulSet", wl.GetKind())
+
+	wl, err = ownerWorkload(ctx, controller("Job", "migrate"), "default")
+	require.NoError(t, err)
+	assert.Equal(t, "Job", wl.GetKind())
+
+	wl, err = ownerWorkload(ctx, controller("Job", "report-27384756"), "default")
+	require.NoError(t, err)
+	assert.Equal(t, "CronJob", wl.GetKind())
+	assert.Equal(t, "report", wl.GetName())
+	assert.Equal(t, "report", jobAgentName(ctx, "report-27384756", "default"))
+	assert.Equal(t, "migrate", jobAgentName(ctx, "migrate", "default"))
+
+	wl, err = ownerWorkload(ctx, nil, "default")
+	require.NoError(t, err)
+	assert.Nil(t, wl)
+
+	_, err = ownerWorkload(ctx, controller("ReplicaSet", "missing"), "default")
+	assert.Error(t, err)
+
+	// The ReplicaSet is attributed to its Rollout, which the fake clientset can't retrieve
+	_, err = ownerWorkload(ctx, controller("ReplicaSet", "canary-5d8f9c7b6"), "default")
+	assert.True(t, errors2.IsNotFound(err))
+}
+
 func requireContains(t *testing.T, err error, expected string) {
 	if expected == "" {
 		require.NoError(t, err)
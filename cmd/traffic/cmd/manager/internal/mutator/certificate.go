@@ -0,0 +1,179 @@
+package mutator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+// certCheckInterval is how often the expiry of the served certificate is checked.
+const certCheckInterval = time.Hour
+
+// certificate is the TLS certificate that the mutator serves. It's reloaded when the mounted files change,
+// i.e. when the secret that they're mounted from is updated, so a certificate that is renewed by other
+// means than the traffic-manager takes effect without a restart.
+type certificate struct {
+	sync.Mutex
+	certPath string
+	keyPath  string
+	modTime  time.Time
+	cert     *tls.Certificate
+}
+
+func loadCertificate(certPath, keyPath string) (*certificate, error) {
+	c := &certificate{certPath: certPath, keyPath: keyPath}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload loads the certificate from its files unless they are unchanged since they were last loaded.
+func (c *certificate) reload() error {
+	c.Lock()
+	defer c.Unlock()
+	st, err := os.Stat(c.certPath)
+	if err != nil {
+		return err
+	}
+	if c.cert != nil && st.ModTime().Equal(c.modTime) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return err
+	}
+	c.cert = &cert
+	c.modTime = st.ModTime()
+	return nil
+}
+
+func (c *certificate) get() *tls.Certificate {
+	c.Lock()
+	defer c.Unlock()
+	return c.cert
+}
+
+func (c *certificate) set(cert *tls.Certificate) {
+	c.Lock()
+	c.cert = cert
+	c.Unlock()
+}
+
+// getCertificate is used as the GetCertificate function of the tls.Config of the mutator. A failure to
+// reload the certificate is logged, and the last certificate that was loaded is returned.
+func (c *certificate) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if err := c.reload(); err != nil {
+		dlog.Errorf(hello.Context(), "unable to reload the agent-injector certificate: %v", err)
+	}
+	return c.get(), nil
+}
+
+// rotateCertificateLoop renews the certificate of the mutator and the CA that it is signed with when either
+// of them expires within the renewBefore duration of the environment. A zero duration disables the renewal.
+func rotateCertificateLoop(ctx context.Context, c *certificate) error {
+	env := managerutil.GetEnv(ctx)
+	if env.AgentInjectorCertRenewBefore <= 0 || env.AgentInjectorSecret == "" {
+		dlog.Info(ctx, "Automatic renewal of the agent-injector certificate is disabled")
+		return nil
+	}
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := rotateCertificateIfExpiring(ctx, c); err != nil {
+			dlog.Errorf(ctx, "unable to renew the agent-injector certificate: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func rotateCertificateIfExpiring(ctx context.Context, c *certificate) error {
+	env := managerutil.GetEnv(ctx)
+	secrets := k8sapi.GetK8sInterface(ctx).CoreV1().Secrets(env.ManagerNamespace)
+	secret, err := secrets.Get(ctx, env.AgentInjectorSecret, meta.GetOptions{})
+	if err != nil {
+		return err
+	}
+	oldCAPem := secret.Data["ca.pem"]
+	expires := c.get().Leaf.NotAfter
+	if block, _ := pem.Decode(oldCAPem); block != nil {
+		if ca, err := x509.ParseCertificate(block.Bytes); err == nil && ca.NotAfter.Before(expires) {
+			expires = ca.NotAfter
+		}
+	}
+	if time.Until(expires) > env.AgentInjectorCertRenewBefore {
+		return nil
+	}
+	dlog.Infof(ctx, "The agent-injector certificate expires %s, renewing it", expires.Format(time.RFC3339))
+
+	crtPem, keyPem, caPem, err := install.GenerateKeys(env.ManagerNamespace)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(crtPem, keyPem)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return err
+	}
+
+	// The webhook must trust the new CA before the new certificate is served. The old CA is kept in the
+	// bundle so that a request that is served with the old certificate still succeeds.
+	if env.AgentInjectorWebhook != "" {
+		if err = updateCABundle(ctx, env.AgentInjectorWebhook, append(caPem, oldCAPem...)); err != nil {
+			return err
+		}
+	}
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	secret.Data["ca.pem"] = caPem
+	secret.Data["crt.pem"] = crtPem
+	secret.Data["key.pem"] = keyPem
+	if _, err = secrets.Update(ctx, secret, meta.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to update secret %s.%s: %w", secret.Name, secret.Namespace, err)
+	}
+	c.set(&cert)
+	dlog.Infof(ctx, "The agent-injector certificate was renewed and expires %s", cert.Leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// updateCABundle sets the CA bundle of all webhooks of the given MutatingWebhookConfiguration.
+func updateCABundle(ctx context.Context, name string, caBundle []byte) error {
+	whs := k8sapi.GetK8sInterface(ctx).AdmissionregistrationV1().MutatingWebhookConfigurations()
+	wc, err := whs.Get(ctx, name, meta.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if len(wc.Webhooks) == 0 {
+		return errors.New("mutating webhook configuration " + name + " has no webhooks")
+	}
+	for i := range wc.Webhooks {
+		wc.Webhooks[i].ClientConfig.CABundle = caBundle
+	}
+	if _, err = whs.Update(ctx, wc, meta.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to update mutating webhook configuration %s: %w", name, err)
+	}
+	return nil
+}
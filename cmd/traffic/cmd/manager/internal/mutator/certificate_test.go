@@ -0,0 +1,109 @@
+package mutator
+
+import (
+	"bytes"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admreg "k8s.io/api/admissionregistration/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+func writeCertificate(t *testing.T, dir string, modTime time.Time) (crtPem, keyPem, caPem []byte) {
+	crtPem, keyPem, caPem, err := install.GenerateKeys("ambassador")
+	require.NoError(t, err)
+	certPath := filepath.Join(dir, tlsCertFile)
+	require.NoError(t, os.WriteFile(certPath, crtPem, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tlsKeyFile), keyPem, 0600))
+	require.NoError(t, os.Chtimes(certPath, modTime, modTime))
+	return crtPem, keyPem, caPem
+}
+
+func certificateDER(t *testing.T, c *certificate) []byte {
+	cert, err := c.getCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	return cert.Certificate[0]
+}
+
+func TestCertificate_reload(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeCertificate(t, dir, now.Add(-time.Minute))
+	c, err := loadCertificate(filepath.Join(dir, tlsCertFile), filepath.Join(dir, tlsKeyFile))
+	require.NoError(t, err)
+	first := certificateDER(t, c)
+	assert.Equal(t, first, certificateDER(t, c))
+
+	// An updated secret is picked up without a restart
+	writeCertificate(t, dir, now)
+	assert.NotEqual(t, first, certificateDER(t, c))
+}
+
+func TestRotateCertificateIfExpiring(t *testing.T) {
+	const (
+		secretName  = "mutator-webhook-tls"
+		webhookName = "agent-injector-webhook-ambassador"
+	)
+	dir := t.TempDir()
+	crtPem, keyPem, caPem := writeCertificate(t, dir, time.Now())
+	c, err := loadCertificate(filepath.Join(dir, tlsCertFile), filepath.Join(dir, tlsKeyFile))
+	require.NoError(t, err)
+	served := certificateDER(t, c)
+
+	cs := fake.NewSimpleClientset(
+		&core.Secret{
+			ObjectMeta: meta.ObjectMeta{Name: secretName, Namespace: "ambassador"},
+			Data:       map[string][]byte{"ca.pem": caPem, "crt.pem": crtPem, "key.pem": keyPem},
+		},
+		&admreg.MutatingWebhookConfiguration{
+			ObjectMeta: meta.ObjectMeta{Name: webhookName},
+			Webhooks: []admreg.MutatingWebhook{{
+				Name:         "agent-injector.getambassador.io",
+				ClientConfig: admreg.WebhookClientConfig{CABundle: caPem},
+			}},
+		},
+	)
+	ctx := k8sapi.WithK8sInterface(dlog.NewTestContext(t, false), cs)
+	env := &managerutil.Env{
+		ManagerNamespace:             "ambassador",
+		AgentInjectorSecret:          secretName,
+		AgentInjectorWebhook:         webhookName,
+		AgentInjectorCertRenewBefore: 24 * time.Hour,
+	}
+	ctx = managerutil.WithEnv(ctx, env)
+
+	// The certificate doesn't expire within a day, so nothing happens
+	require.NoError(t, rotateCertificateIfExpiring(ctx, c))
+	assert.Equal(t, served, certificateDER(t, c))
+
+	// The CA expires within two years, so the certificate is renewed
+	env.AgentInjectorCertRenewBefore = 2 * 365 * 24 * time.Hour
+	require.NoError(t, rotateCertificateIfExpiring(ctx, c))
+	assert.NotEqual(t, served, certificateDER(t, c))
+
+	secret, err := cs.CoreV1().Secrets("ambassador").Get(ctx, secretName, meta.GetOptions{})
+	require.NoError(t, err)
+	newCAPem := secret.Data["ca.pem"]
+	assert.NotEqual(t, caPem, newCAPem)
+	newCert, err := tls.X509KeyPair(secret.Data["crt.pem"], secret.Data["key.pem"])
+	require.NoError(t, err)
+	assert.Equal(t, newCert.Certificate[0], certificateDER(t, c))
+
+	wc, err := cs.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, webhookName, meta.GetOptions{})
+	require.NoError(t, err)
+	caBundle := wc.Webhooks[0].ClientConfig.CABundle
+	assert.True(t, bytes.HasPrefix(caBundle, newCAPem))
+	assert.True(t, bytes.HasSuffix(caBundle, caPem))
+}
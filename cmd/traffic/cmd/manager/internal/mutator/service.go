@@ -2,6 +2,7 @@ package mutator
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,6 +18,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 
+	"github.com/datawire/dlib/dgroup"
 	"github.com/datawire/dlib/dhttp"
 	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
@@ -79,16 +81,32 @@ func ServeMutator(ctx context.Context) error {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	server := &dhttp.ServerConfig{Handler: mux}
-	addr := ":" + strconv.Itoa(install.MutatorWebhookPortHTTPS)
-	dlog.Infof(ctx, "Mutating webhook service is listening on %v", addr)
-	err := server.ListenAndServeTLS(ctx, addr, certPath, keyPath)
+	cert, err := loadCertificate(certPath, keyPath)
 	if err != nil {
-		err = fmt.Errorf("mutating webhook service stopped. %w", err)
-		return err
+		return fmt.Errorf("unable to load the mutating webhook certificate: %w", err)
 	}
-	dlog.Info(ctx, "Mutating webhook service stopped")
-	return nil
+	server := &dhttp.ServerConfig{
+		Handler: mux,
+		TLSConfig: &tls.Config{
+			GetCertificate: cert.getCertificate,
+			MinVersion:     tls.VersionTLS12,
+		},
+	}
+
+	g := dgroup.NewGroup(ctx, dgroup.GroupConfig{})
+	g.Go("server", func(ctx context.Context) error {
+		addr := ":" + strconv.Itoa(install.MutatorWebhookPortHTTPS)
+		dlog.Infof(ctx, "Mutating webhook service is listening on %v", addr)
+		if err := server.ListenAndServeTLS(ctx, addr, "", ""); err != nil {
+			return fmt.Errorf("mutating webhook service stopped. %w", err)
+		}
+		dlog.Info(ctx, "Mutating webhook service stopped")
+		return nil
+	})
+	g.Go("cert-rotation", func(ctx context.Context) error {
+		return rotateCertificateLoop(ctx, cert)
+	})
+	return g.Wait()
 }
 
 // Skip mutate requests in these namespaces
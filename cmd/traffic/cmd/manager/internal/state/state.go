@@ -28,7 +28,7 @@ type SessionState interface {
 	LastMarked() time.Time
 	SetLastMarked(lastMarked time.Time)
 	Dials() <-chan *rpc.DialRequest
-	EstablishBidiPipe(context.Context, tunnel.Stream) (tunnel.Endpoint, error)
+	EstablishBidiPipe(ctx context.Context, stream tunnel.Stream, interceptID string, agentPublicKey []byte, compression string) (tunnel.Endpoint, error)
 	OnConnect(context.Context, tunnel.Stream) (tunnel.Endpoint, error)
 }
 
@@ -48,8 +48,16 @@ type sessionState struct {
 
 // EstablishBidiPipe registers the given stream as waiting for a matching stream to arrive in a call
 // to Tunnel, sends a DialRequest to the owner of this sessionState, and then waits. When the call
-// arrives, a BidiPipe connecting the two streams is returned.
-func (ss *sessionState) EstablishBidiPipe(ctx context.Context, stream tunnel.Stream) (tunnel.Endpoint, error) {
+// arrives, a BidiPipe connecting the two streams is returned. The interceptID and agentPublicKey are
+// only set when the stream belongs to an intercept with end-to-end encryption. The compression is the
+// tunnel compression that the client of the session wants, and is passed on in the DialRequest.
+func (ss *sessionState) EstablishBidiPipe(
+	ctx context.Context,
+	stream tunnel.Stream,
+	interceptID string,
+	agentPublicKey []byte,
+	compression string,
+) (tunnel.Endpoint, error) {
 	// Dispatch directly to agent and let the dial happen there
 	bidiPipeCh := make(chan tunnel.Endpoint)
 	id := stream.ID()
@@ -67,7 +75,14 @@ func (ss *sessionState) EstablishBidiPipe(ctx context.Context, stream tunnel.Str
 	select {
 	case <-ss.done:
 		return nil, status.Error(codes.Canceled, "session cancelled")
-	case ss.dials <- &rpc.DialRequest{ConnId: []byte(id), RoundtripLatency: int64(stream.RoundtripLatency()), DialTimeout: int64(stream.DialTimeout())}:
+	case ss.dials <- &rpc.DialRequest{
+		ConnId:           []byte(id),
+		RoundtripLatency: int64(stream.RoundtripLatency()),
+		DialTimeout:      int64(stream.DialTimeout()),
+		InterceptId:      interceptID,
+		AgentPublicKey:   agentPublicKey,
+		Compression:      compression,
+	}:
 	}
 
 	// Wait for the client/agent to connect. Allow extra time for the call
@@ -179,8 +194,14 @@ type State struct {
 	sessions         map[string]SessionState              // info for all sessions
 	interceptAPIKeys map[string]string                    // InterceptIDs mapped to the APIKey used to create them
 	agentsByName     map[string]map[string]*rpc.AgentInfo // indexed copy of `agents`
-	timedLogLevel    log.TimedLevel
-	logLevelCond     sync.Cond
+
+	// interceptStats are the traffic counters that agents report for intercepts, keyed by intercept ID and
+	// agent session ID. The counters of an agent are retained when its session ends, so that the sums that
+	// are stored in the intercepts never decrease.
+	interceptStats map[string]map[string]*rpc.InterceptStats
+
+	timedLogLevel log.TimedLevel
+	logLevelCond  sync.Cond
 }
 
 func NewState(ctx context.Context) *State {
@@ -189,6 +210,7 @@ func NewState(ctx context.Context) *State {
 		sessions:         make(map[string]SessionState),
 		interceptAPIKeys: make(map[string]string),
 		agentsByName:     make(map[string]map[string]*rpc.AgentInfo),
+		interceptStats:   make(map[string]map[string]*rpc.InterceptStats),
 		timedLogLevel:    log.NewTimedLevel(os.Getenv("LOG_LEVEL"), log.SetLevel),
 		logLevelCond:     sync.Cond{L: &sync.Mutex{}},
 	}
@@ -318,6 +340,7 @@ func (s *State) unlockedRemoveSession(sessionID string) {
 				// Client went away:
 				// Delete it.
 				s.intercepts.Delete(interceptID)
+				delete(s.interceptStats, interceptID)
 			} else if errCode, errMsg := s.unlockedCheckAgentsForIntercept(intercept); errCode != 0 {
 				// Refcount went to zero:
 				// Tell the client, so that the client can tell us to delete it.
@@ -496,11 +519,27 @@ func (s *State) WatchAgents(
 
 // Intercepts //////////////////////////////////////////////////////////////////////////////////////
 
-func (s *State) AddIntercept(sessionID, apiKey string, spec *rpc.InterceptSpec) (*rpc.InterceptInfo, error) {
+// AddIntercept adds an intercept for the given client session. When idempotencyKey is non-empty and the
+// session already has an intercept that was created with that key, then that intercept is returned instead
+// of a new one, provided that it has the same name.
+func (s *State) AddIntercept(sessionID, apiKey, idempotencyKey string, spec *rpc.InterceptSpec) (*rpc.InterceptInfo, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if idempotencyKey != "" {
+		if existing := s.unlockedInterceptByIdempotencyKey(sessionID, idempotencyKey); existing != nil {
+			if existing.Spec.Name != spec.Name {
+				return nil, status.Errorf(codes.AlreadyExists,
+					"idempotency key %q is already used by intercept %q", idempotencyKey, existing.Spec.Name)
+			}
+			return existing, nil
+		}
+	}
+
 	interceptID := fmt.Sprintf("%s:%s", sessionID, spec.Name)
+	if _, ok := s.intercepts.Load(interceptID); ok {
+		return nil, status.Errorf(codes.AlreadyExists, "Intercept named %q already exists", spec.Name)
+	}
 	s.interceptAPIKeys[interceptID] = apiKey
 	cept := &rpc.InterceptInfo{
 		Spec:        spec,
@@ -510,7 +549,8 @@ func (s *State) AddIntercept(sessionID, apiKey string, spec *rpc.InterceptSpec)
 		ClientSession: &rpc.SessionInfo{
 			SessionId: sessionID,
 		},
-		ApiKey: apiKey,
+		ApiKey:         apiKey,
+		IdempotencyKey: idempotencyKey,
 	}
 
 	// Wrap each potential-state-change in a
@@ -532,6 +572,23 @@ func (s *State) AddIntercept(sessionID, apiKey string, spec *rpc.InterceptSpec)
 	return cept, nil
 }
 
+// InterceptByIdempotencyKey returns the intercept of the given client session that was created with the
+// given idempotency key, or nil if no such intercept exists.
+func (s *State) InterceptByIdempotencyKey(sessionID, idempotencyKey string) *rpc.InterceptInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unlockedInterceptByIdempotencyKey(sessionID, idempotencyKey)
+}
+
+func (s *State) unlockedInterceptByIdempotencyKey(sessionID, idempotencyKey string) *rpc.InterceptInfo {
+	for _, ii := range s.intercepts.LoadAllMatching(func(_ string, ii *rpc.InterceptInfo) bool {
+		return ii.IdempotencyKey == idempotencyKey && ii.ClientSession.SessionId == sessionID
+	}) {
+		return ii
+	}
+	return nil
+}
+
 // getAgentsInterceptedByClient returns the session IDs for each agent that are currently
 // intercepted by the client with the given client session ID.
 func (s *State) getAgentsInterceptedByClient(clientSessionID string) []string {
@@ -590,9 +647,46 @@ func (s *State) UpdateIntercept(interceptID string, apply func(*rpc.InterceptInf
 
 func (s *State) RemoveIntercept(interceptID string) bool {
 	_, didDelete := s.intercepts.LoadAndDelete(interceptID)
+	s.mu.Lock()
+	delete(s.interceptStats, interceptID)
+	s.mu.Unlock()
 	return didDelete
 }
 
+// UpdateInterceptStats records the traffic counters that the agent with the given session ID reports for its
+// intercepts, and updates the stats of each intercept with the sum of the counters of all its agents. Counters
+// for intercepts that don't belong to the agent are ignored.
+func (s *State) UpdateInterceptStats(agentSessionID string, stats []*rpc.InterceptStats) {
+	agent := s.GetAgent(agentSessionID)
+	if agent == nil {
+		return
+	}
+	for _, st := range stats {
+		ii, ok := s.intercepts.Load(st.InterceptId)
+		if !ok || ii.Spec.Agent != agent.Name || ii.Spec.Namespace != agent.Namespace {
+			continue
+		}
+		s.mu.Lock()
+		byAgent, ok := s.interceptStats[st.InterceptId]
+		if !ok {
+			byAgent = make(map[string]*rpc.InterceptStats)
+			s.interceptStats[st.InterceptId] = byAgent
+		}
+		byAgent[agentSessionID] = st
+		sum := &rpc.InterceptStats{InterceptId: st.InterceptId}
+		for _, as := range byAgent {
+			sum.Connections += as.Connections
+			sum.ActiveConnections += as.ActiveConnections
+			sum.BytesIn += as.BytesIn
+			sum.BytesOut += as.BytesOut
+		}
+		s.mu.Unlock()
+		s.UpdateIntercept(st.InterceptId, func(ii *rpc.InterceptInfo) {
+			ii.Stats = sum
+		})
+	}
+}
+
 // GetInterceptAPIKey returns the first non-empty apiKey associated with an intercept IDs.
 // We use this fuction as a last resort if we need to garbage collect intercepts when
 // there are no active sessions.
@@ -607,6 +701,19 @@ func (s *State) GetInterceptAPIKey() string {
 	return ""
 }
 
+// UpdateInterceptAPIKey replaces the apiKey of the given intercept, e.g. when the client has rotated
+// its keys. It returns the updated intercept, or nil if no such intercept exists.
+func (s *State) UpdateInterceptAPIKey(interceptID, apiKey string) *rpc.InterceptInfo {
+	s.mu.Lock()
+	if _, ok := s.interceptAPIKeys[interceptID]; ok {
+		s.interceptAPIKeys[interceptID] = apiKey
+	}
+	s.mu.Unlock()
+	return s.UpdateIntercept(interceptID, func(intercept *rpc.InterceptInfo) {
+		intercept.ApiKey = apiKey
+	})
+}
+
 // RemoveInterceptAPIKey removes the associated APIKey for an Intercept ID
 // Only call on an intercept that has been deleted.
 func (s *State) RemoveInterceptAPIKey(interceptID string) bool {
@@ -625,6 +732,13 @@ func (s *State) GetIntercept(interceptID string) (*rpc.InterceptInfo, bool) {
 	return s.intercepts.Load(interceptID)
 }
 
+// GetInterceptsByAgent returns the intercepts of all clients on the agent with the given name and namespace.
+func (s *State) GetInterceptsByAgent(name, namespace string) map[string]*rpc.InterceptInfo {
+	return s.intercepts.LoadAllMatching(func(_ string, ii *rpc.InterceptInfo) bool {
+		return ii.Spec.Agent == name && ii.Spec.Namespace == namespace
+	})
+}
+
 func (s *State) WatchIntercepts(
 	ctx context.Context,
 	filter func(sessionID string, intercept *rpc.InterceptInfo) bool,
@@ -662,29 +776,48 @@ func (s *State) Tunnel(ctx context.Context, stream tunnel.Stream) error {
 	// intercept is active, to a dialer here in the traffic-agent.
 	//
 	// A traffic-agent must always extend the tunnel to the client that it is currently intercepted
-	// by, and hence, start by sending the sessionID of that client on the tunnel.
+	// by, and hence, start by sending the sessionID of that client on the tunnel, along with the ID of
+	// the intercept. When the intercept uses end-to-end encryption, the agent also sends its public key
+	// so that the client can derive the key of the stream. The manager just relays the encrypted payload.
 	var peerSession SessionState
+	var interceptID string
+	var agentPublicKey []byte
+	var compression string
 	if _, ok := ss.(*agentSessionState); ok {
 		// traffic-agent, so obtain the desired client session
 		m, err := stream.Receive(ctx)
 		if err != nil {
 			return status.Errorf(codes.FailedPrecondition, "failed to read first message from agent tunnel %q: %v", sessionID, err)
 		}
-		if m.Code() != tunnel.Session {
+		var peerID string
+		switch m.Code() {
+		case tunnel.Session:
+			peerID = tunnel.GetSession(m)
+		case tunnel.InterceptSession:
+			if peerID, interceptID, agentPublicKey, err = tunnel.GetInterceptSession(m); err != nil {
+				return status.Errorf(codes.FailedPrecondition, "unable to read InterceptSession from agent %q: %v", sessionID, err)
+			}
+		default:
 			return status.Errorf(codes.FailedPrecondition, "unable to read ClientSession from agent %q", sessionID)
 		}
-		peerID := tunnel.GetSession(m)
 		s.mu.Lock()
 		peerSession = s.sessions[peerID]
 		s.mu.Unlock()
+		if peerSession == nil && len(agentPublicKey) > 0 {
+			// The payload is encrypted, so dialing here is pointless
+			return status.Errorf(codes.NotFound, "client session %q not found", peerID)
+		}
 	} else {
+		// The traffic-agent compresses its end of the tunnel the way the client wants. The client
+		// uses its own configuration.
 		peerSession = s.getRandomAgentSession(sessionID)
+		compression = s.GetClient(sessionID).GetTunnelCompression()
 	}
 
 	var endPoint tunnel.Endpoint
 	if peerSession != nil {
 		var err error
-		if endPoint, err = peerSession.EstablishBidiPipe(ctx, stream); err != nil {
+		if endPoint, err = peerSession.EstablishBidiPipe(ctx, stream, interceptID, agentPublicKey, compression); err != nil {
 			return err
 		}
 	} else {
@@ -5,6 +5,10 @@ import (
 	"testing"
 	"time"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
 	manager "github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
 	testdata "github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/test"
 )
@@ -122,4 +126,120 @@ func TestStateInternal(topT *testing.T) {
 		a.False(state.Mark(c2, clock.Now()))
 		a.False(state.Mark(c3, clock.Now()))
 	})
+
+	topT.Run("intercept-idempotency", func(t *testing.T) {
+		a := assertNew(t)
+
+		clock := &FakeClock{}
+		state := manager.NewState(ctx)
+		c1 := state.AddClient(testClients["alice"], clock.Now())
+		c2 := state.AddClient(testClients["bob"], clock.Now())
+
+		spec := &rpc.InterceptSpec{
+			Name:      "first",
+			Namespace: "default",
+			Client:    testClients["alice"].Name,
+			Agent:     testAgents["hello"].Name,
+			Mechanism: "tcp",
+		}
+		first, err := state.AddIntercept(c1, "", "key-1", spec)
+		a.NoError(err)
+		a.Equal("key-1", first.IdempotencyKey)
+		a.Equal(first, state.InterceptByIdempotencyKey(c1, "key-1"))
+		a.Nil(state.InterceptByIdempotencyKey(c2, "key-1"))
+
+		// A retry returns the intercept that was already created
+		retry, err := state.AddIntercept(c1, "", "key-1", spec)
+		a.NoError(err)
+		a.Equal(first.Id, retry.Id)
+
+		// The same key can't be used for another intercept
+		other := &rpc.InterceptSpec{
+			Name:      "second",
+			Namespace: "default",
+			Client:    testClients["alice"].Name,
+			Agent:     testAgents["hello"].Name,
+			Mechanism: "tcp",
+		}
+		_, err = state.AddIntercept(c1, "", "key-1", other)
+		a.Equal(codes.AlreadyExists, status.Code(err))
+		_, ok := state.GetIntercept(c1 + ":second")
+		a.False(ok)
+
+		// A different key doesn't make a duplicate name acceptable
+		_, err = state.AddIntercept(c1, "", "key-2", spec)
+		a.Equal(codes.AlreadyExists, status.Code(err))
+
+		// Keys are scoped to the client session
+		bobs, err := state.AddIntercept(c2, "", "key-1", spec)
+		a.NoError(err)
+		a.NotEqual(first.Id, bobs.Id)
+	})
+
+	topT.Run("intercept-api-key", func(t *testing.T) {
+		a := assertNew(t)
+
+		clock := &FakeClock{}
+		state := manager.NewState(ctx)
+		c1 := state.AddClient(testClients["alice"], clock.Now())
+
+		cept, err := state.AddIntercept(c1, "old-key", "", &rpc.InterceptSpec{
+			Name:      "rotated",
+			Namespace: "default",
+			Client:    testClients["alice"].Name,
+			Agent:     testAgents["hello"].Name,
+			Mechanism: "tcp",
+		})
+		a.NoError(err)
+		a.Equal("old-key", cept.ApiKey)
+		a.Equal("old-key", state.GetInterceptAPIKey())
+
+		updated := state.UpdateInterceptAPIKey(cept.Id, "new-key")
+		a.NotNil(updated)
+		a.Equal("new-key", updated.ApiKey)
+		a.Equal("new-key", state.GetInterceptAPIKey())
+		a.Nil(state.UpdateInterceptAPIKey(c1+":missing", "new-key"))
+	})
+
+	topT.Run("intercept-stats", func(t *testing.T) {
+		a := assertNew(t)
+
+		clock := &FakeClock{}
+		state := manager.NewState(ctx)
+		c1 := state.AddClient(testClients["alice"], clock.Now())
+		d1 := state.AddAgent(testAgents["demo1"], clock.Now())
+		d2 := state.AddAgent(testAgents["demo2"], clock.Now())
+		h := state.AddAgent(testAgents["hello"], clock.Now())
+
+		cept, err := state.AddIntercept(c1, "", "", &rpc.InterceptSpec{
+			Name:      "demo",
+			Namespace: "default",
+			Client:    testClients["alice"].Name,
+			Agent:     testAgents["demo1"].Name,
+			Mechanism: "tcp",
+		})
+		a.NoError(err)
+
+		stats := func(conns, bytes int64) []*rpc.InterceptStats {
+			return []*rpc.InterceptStats{{InterceptId: cept.Id, Connections: conns, BytesIn: bytes, BytesOut: bytes}}
+		}
+		state.UpdateInterceptStats(d1, stats(2, 100))
+		state.UpdateInterceptStats(d2, stats(1, 50))
+
+		// An agent for another workload can't report stats for the intercept
+		state.UpdateInterceptStats(h, stats(10, 1000))
+
+		ii, ok := state.GetIntercept(cept.Id)
+		a.True(ok)
+		a.Equal(int64(3), ii.Stats.Connections)
+		a.Equal(int64(150), ii.Stats.BytesIn)
+
+		// The counters of an agent are replaced by its next report, and retained when it departs
+		state.UpdateInterceptStats(d1, stats(3, 200))
+		state.RemoveSession(ctx, d2)
+		state.UpdateInterceptStats(d1, stats(4, 300))
+		ii, _ = state.GetIntercept(cept.Id)
+		a.Equal(int64(5), ii.Stats.Connections)
+		a.Equal(int64(350), ii.Stats.BytesOut)
+	})
 }
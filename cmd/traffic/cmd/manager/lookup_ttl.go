@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// resolvConf is the resolver configuration of the traffic-manager's pod.
+const resolvConf = "/etc/resolv.conf"
+
+// lookupTTL returns the smallest time to live of the A and AAAA records of the given host, as reported by
+// the first nameserver of the given configuration, or zero when it can't be determined. The search path of
+// the configuration is applied in the same way as when the host is resolved by the Go resolver.
+func lookupTTL(ctx context.Context, cfg *dns.ClientConfig, host string) time.Duration {
+	if len(cfg.Servers) == 0 {
+		return 0
+	}
+	server := net.JoinHostPort(cfg.Servers[0], cfg.Port)
+	c := dns.Client{Timeout: 2 * time.Second}
+	for _, name := range cfg.NameList(host) {
+		found := false
+		var ttl uint32
+		for _, qType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			q := new(dns.Msg)
+			q.SetQuestion(name, qType)
+			r, _, err := c.ExchangeContext(ctx, q, server)
+			if err != nil {
+				dlog.Debugf(ctx, "unable to query %s for the TTL of %s: %v", server, name, err)
+				return 0
+			}
+			for _, rr := range r.Answer {
+				if h := rr.Header(); !found || h.Ttl < ttl {
+					found = true
+					ttl = h.Ttl
+				}
+			}
+		}
+		if found {
+			return time.Duration(ttl) * time.Second
+		}
+	}
+	return 0
+}
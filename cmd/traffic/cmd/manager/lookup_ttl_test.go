@@ -0,0 +1,59 @@
+package manager
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+func Test_lookupTTL(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &dns.Server{
+		PacketConn: pc,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			q := r.Question[0]
+			switch {
+			case q.Name == "api.example.com." && q.Qtype == dns.TypeA:
+				m.Answer = []dns.RR{
+					&dns.A{Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: net.IP{10, 0, 0, 1}},
+					&dns.A{Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 120}, A: net.IP{10, 0, 0, 2}},
+				}
+			case q.Name == "api.example.com." && q.Qtype == dns.TypeAAAA:
+				m.Answer = []dns.RR{
+					&dns.AAAA{Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 600}, AAAA: net.ParseIP("fd00::1")},
+				}
+			case q.Name == "db.ns.svc.cluster.local." && q.Qtype == dns.TypeA:
+				m.Answer = []dns.RR{
+					&dns.A{Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 5}, A: net.IP{10, 0, 0, 3}},
+				}
+			default:
+				m.Rcode = dns.RcodeNameError
+			}
+			_ = w.WriteMsg(m)
+		}),
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	defer func() { _ = srv.Shutdown() }()
+
+	cfg := &dns.ClientConfig{
+		Servers: []string{"127.0.0.1"},
+		Search:  []string{"ns.svc.cluster.local", "svc.cluster.local", "cluster.local"},
+		Port:    strconv.Itoa(pc.LocalAddr().(*net.UDPAddr).Port),
+		Ndots:   5,
+	}
+	assert.Equal(t, 120*time.Second, lookupTTL(ctx, cfg, "api.example.com"))
+	assert.Equal(t, 5*time.Second, lookupTTL(ctx, cfg, "db"))
+	assert.Equal(t, time.Duration(0), lookupTTL(ctx, cfg, "missing.example.com"))
+	assert.Equal(t, time.Duration(0), lookupTTL(ctx, &dns.ClientConfig{}, "api.example.com"))
+}
@@ -2,6 +2,7 @@ package manager
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
@@ -17,10 +18,12 @@ import (
 	"github.com/datawire/dlib/dhttp"
 	"github.com/datawire/dlib/dlog"
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	managerv2 "github.com/telepresenceio/telepresence/rpc/v2/manager/v2"
 	"github.com/telepresenceio/telepresence/rpc/v2/systema"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/mutator"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/watchable"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
 	"github.com/telepresenceio/telepresence/v2/pkg/version"
 )
@@ -56,6 +59,12 @@ func Main(ctx context.Context, args ...string) error {
 
 	g.Go("intercept-gc", mgr.runInterceptGCLoop)
 
+	// Record Kubernetes Events on the intercepted workloads when intercepts start, end, or fail
+	g.Go("event-export", mgr.runEventExportLoop)
+
+	// Post intercept and traffic-agent lifecycle events to the configured webhook
+	g.Go("webhook-export", mgr.runWebhookLoop)
+
 	// This goroutine is responsible for informing System A of intercepts (and
 	// relevant metadata like domains) that have been garbage collected. This
 	// ensures System A doesn't list preview URLs + intercepts that no longer
@@ -74,6 +83,20 @@ func (m *Manager) serveHTTP(ctx context.Context) error {
 	if mz, ok := env.MaxReceiveSize.AsInt64(); ok {
 		opts = append(opts, grpc.MaxRecvMsgSize(int(mz)))
 	}
+	var ca *install.MTLSCA
+	var tlsConfig *tls.Config
+	if env.MTLSPort != 0 {
+		var err error
+		if ca, err = loadMTLSCA(); err != nil {
+			return err
+		}
+		if tlsConfig, err = mtlsTLSConfig(ctx, ca); err != nil {
+			return err
+		}
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(m.mtlsUnaryInterceptor),
+			grpc.ChainStreamInterceptor(m.mtlsStreamInterceptor))
+	}
 
 	grpcHandler := grpc.NewServer(opts...)
 	httpHandler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -90,9 +113,31 @@ func (m *Manager) serveHTTP(ctx context.Context) error {
 	}
 
 	rpc.RegisterManagerServer(grpcHandler, m)
+	managerv2.RegisterManagerServer(grpcHandler, &serviceV2{m: m})
 	grpc_health_v1.RegisterHealthServer(grpcHandler, &HealthChecker{})
 
-	return sc.ListenAndServe(ctx, host+":"+port)
+	if tlsConfig == nil {
+		return sc.ListenAndServe(ctx, host+":"+port)
+	}
+
+	// The traffic-agents keep using the plaintext port. Client sessions must use the mTLS port, and obtain
+	// their certificates from the bootstrap port, which only listens on the loopback interface.
+	g := dgroup.NewGroup(ctx, dgroup.GroupConfig{})
+	g.Go("plaintext", func(ctx context.Context) error {
+		return sc.ListenAndServe(ctx, host+":"+port)
+	})
+	g.Go("mtls", func(ctx context.Context) error {
+		mtlsSC := &dhttp.ServerConfig{
+			Handler:   sc.Handler,
+			TLSConfig: tlsConfig,
+		}
+		return mtlsSC.ListenAndServeTLS(ctx, fmt.Sprintf("%s:%d", host, env.MTLSPort), "", "")
+	})
+	g.Go("mtls-bootstrap", func(ctx context.Context) error {
+		bootstrapSC := &dhttp.ServerConfig{Handler: mtlsBootstrapHandler(ca)}
+		return bootstrapSC.ListenAndServe(ctx, fmt.Sprintf("127.0.0.1:%d", install.ManagerPortMTLSBootstrap))
+	})
+	return g.Wait()
 }
 
 func (m *Manager) runInterceptGCLoop(ctx context.Context) error {
@@ -2,11 +2,21 @@ package managerutil
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/sethvargo/go-envconfig"
+	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
 	"github.com/telepresenceio/telepresence/v2/pkg/version"
 )
@@ -18,6 +28,13 @@ type Env struct {
 	SystemAHost string `env:"SYSTEMA_HOST,default=app.getambassador.io"`
 	SystemAPort string `env:"SYSTEMA_PORT,default=443"`
 
+	// SystemADisabled prevents all calls to Ambassador Cloud, e.g. in air-gapped clusters.
+	SystemADisabled bool `env:"SYSTEMA_DISABLED,default=false"`
+
+	// SystemACACert is a PEM encoded bundle of certificate authorities that are trusted, in addition to
+	// the system's, when talking to a self-hosted Ambassador Cloud.
+	SystemACACert string `env:"SYSTEMA_CA_CERT,default="`
+
 	ManagerNamespace    string                     `env:"MANAGER_NAMESPACE,default="`
 	AgentRegistry       string                     `env:"TELEPRESENCE_REGISTRY,default=docker.io/datawire"`
 	AgentImage          string                     `env:"TELEPRESENCE_AGENT_IMAGE,default="`
@@ -28,6 +45,125 @@ type Env struct {
 
 	PodCIDRStrategy string `env:"POD_CIDR_STRATEGY,default=auto"`
 	PodCIDRs        string `env:"POD_CIDRS,default="`
+
+	// ClusterDomain overrides the cluster domain that is otherwise detected from the pod's resolv.conf.
+	ClusterDomain string `env:"TELEPRESENCE_CLUSTER_DOMAIN,default="`
+
+	ArtifactCacheTTL time.Duration `env:"TELEPRESENCE_ARTIFACT_CACHE_TTL,default=1h"`
+
+	LogFormat string `env:"LOG_FORMAT,default="`
+
+	AgentResources    AgentResources       `env:"TELEPRESENCE_AGENT_RESOURCES,default="`
+	AgentRedirectMode install.RedirectMode `env:"TELEPRESENCE_AGENT_REDIRECT_MODE,default="`
+
+	AgentTunnelTCPIdleTimeout time.Duration `env:"TELEPRESENCE_AGENT_TUNNEL_TCP_IDLE_TIMEOUT,default="`
+	AgentTunnelUDPIdleTimeout time.Duration `env:"TELEPRESENCE_AGENT_TUNNEL_UDP_IDLE_TIMEOUT,default="`
+	AgentTunnelKeepAlive      time.Duration `env:"TELEPRESENCE_AGENT_TUNNEL_KEEPALIVE,default="`
+
+	InterceptRequireIdentity   bool `env:"TELEPRESENCE_INTERCEPT_REQUIRE_IDENTITY,default=false"`
+	InterceptRequireEncryption bool `env:"TELEPRESENCE_INTERCEPT_REQUIRE_ENCRYPTION,default=false"`
+
+	ManagedNamespaces Namespaces `env:"TELEPRESENCE_MANAGED_NAMESPACES,default="`
+
+	// AgentInjectorSecret and AgentInjectorWebhook are the names of the secret that holds the certificate of
+	// the agent-injector and of its MutatingWebhookConfiguration. The certificate is renewed when it expires
+	// within AgentInjectorCertRenewBefore, unless that duration is zero.
+	AgentInjectorSecret          string        `env:"TELEPRESENCE_AGENT_INJECTOR_SECRET,default="`
+	AgentInjectorWebhook         string        `env:"TELEPRESENCE_AGENT_INJECTOR_WEBHOOK,default="`
+	AgentInjectorCertRenewBefore time.Duration `env:"TELEPRESENCE_AGENT_INJECTOR_CERT_RENEW_BEFORE,default=720h"`
+
+	// MTLSPort is the port where clients authenticate using mutual TLS. When set, client sessions are
+	// rejected on the ServerPort, which is then used by traffic-agents only.
+	MTLSPort int32 `env:"TELEPRESENCE_MTLS_PORT,default="`
+
+	// WebhookURL is where intercept and traffic-agent lifecycle events are posted. WebhookSecret, when set,
+	// is used to sign the posted events.
+	WebhookURL    string `env:"TELEPRESENCE_WEBHOOK_URL,default="`
+	WebhookSecret string `env:"TELEPRESENCE_WEBHOOK_SECRET,default="`
+}
+
+// ErrSystemADisabled is returned by operations that require Ambassador Cloud when SystemADisabled is set.
+var ErrSystemADisabled = errors.New("Ambassador Cloud is disabled")
+
+// SystemATLSConfig returns the TLS configuration to use when talking to the given Ambassador Cloud host.
+func (e *Env) SystemATLSConfig(serverName string) (*tls.Config, error) {
+	if e.SystemADisabled {
+		return nil, ErrSystemADisabled
+	}
+	cfg := &tls.Config{ServerName: serverName}
+	if e.SystemACACert == "" {
+		return cfg, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM([]byte(e.SystemACACert)) {
+		return nil, errors.New("SYSTEMA_CA_CERT contains no PEM encoded certificates")
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+// SystemAHTTPClient returns the client to use for HTTP requests to Ambassador Cloud.
+func (e *Env) SystemAHTTPClient() (*http.Client, error) {
+	if e.SystemADisabled {
+		return nil, ErrSystemADisabled
+	}
+	if e.SystemACACert == "" {
+		return http.DefaultClient, nil
+	}
+	tlsCfg, err := e.SystemATLSConfig("")
+	if err != nil {
+		return nil, err
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsCfg
+	return &http.Client{Transport: tr}, nil
+}
+
+// Namespaces is a list of namespaces, decoded from a string where the names are separated by commas or
+// whitespace.
+type Namespaces []string
+
+func (ns *Namespaces) EnvDecode(val string) error {
+	names := strings.FieldsFunc(val, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(names) == 0 {
+		names = nil
+	}
+	*ns = names
+	return nil
+}
+
+// IsManagedNamespace returns true if the traffic-manager may watch, inject traffic-agents into, and serve
+// intercepts for, the given namespace. All namespaces are managed unless ManagedNamespaces is set.
+func (e *Env) IsManagedNamespace(namespace string) bool {
+	if len(e.ManagedNamespaces) == 0 {
+		return true
+	}
+	for _, ns := range e.ManagedNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// AgentResources are the resource requests and limits of the injected traffic-agent containers, decoded
+// from JSON, e.g. {"limits":{"cpu":"100m","memory":"128Mi"}}.
+type AgentResources core.ResourceRequirements
+
+func (ar *AgentResources) EnvDecode(val string) error {
+	var rr core.ResourceRequirements
+	if val != "" {
+		if err := json.Unmarshal([]byte(val), &rr); err != nil {
+			return fmt.Errorf("invalid agent resources %q: %w", val, err)
+		}
+	}
+	*ar = AgentResources(rr)
+	return nil
 }
 
 type envKey struct{}
@@ -5,11 +5,14 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/version"
 )
 
@@ -29,16 +32,18 @@ func TestEnvconfig(t *testing.T) {
 	}()
 
 	defaults := managerutil.Env{
-		User:            "",
-		ServerHost:      "",
-		ServerPort:      "8081",
-		SystemAHost:     "app.getambassador.io",
-		SystemAPort:     "443",
-		AgentRegistry:   "docker.io/datawire",
-		AgentImage:      "tel2:" + strings.TrimPrefix(version.Version, "v"),
-		AgentPort:       9900,
-		MaxReceiveSize:  resource.MustParse("4Mi"),
-		PodCIDRStrategy: "auto",
+		User:                         "",
+		ServerHost:                   "",
+		ServerPort:                   "8081",
+		SystemAHost:                  "app.getambassador.io",
+		SystemAPort:                  "443",
+		AgentRegistry:                "docker.io/datawire",
+		AgentImage:                   "tel2:" + strings.TrimPrefix(version.Version, "v"),
+		AgentPort:                    9900,
+		MaxReceiveSize:               resource.MustParse("4Mi"),
+		PodCIDRStrategy:              "auto",
+		ArtifactCacheTTL:             time.Hour,
+		AgentInjectorCertRenewBefore: 720 * time.Hour,
 	}
 
 	testcases := map[string]struct {
@@ -57,6 +62,63 @@ func TestEnvconfig(t *testing.T) {
 				e.SystemAHost = "app.getambassador.io"
 			},
 		},
+		"systema-disabled": {
+			Input: map[string]string{
+				"SYSTEMA_DISABLED": "true",
+			},
+			Output: func(e *managerutil.Env) {
+				e.SystemADisabled = true
+			},
+		},
+		"agent-redirect-mode": {
+			Input: map[string]string{
+				"TELEPRESENCE_AGENT_REDIRECT_MODE": "iptables",
+			},
+			Output: func(e *managerutil.Env) {
+				e.AgentRedirectMode = install.RedirectIPTables
+			},
+		},
+		"agent-resources": {
+			Input: map[string]string{
+				"TELEPRESENCE_AGENT_RESOURCES": `{"limits":{"cpu":"100m","memory":"128Mi"}}`,
+			},
+			Output: func(e *managerutil.Env) {
+				e.AgentResources.Limits = core.ResourceList{
+					core.ResourceCPU:    resource.MustParse("100m"),
+					core.ResourceMemory: resource.MustParse("128Mi"),
+				}
+			},
+		},
+		"agent-tunnel": {
+			Input: map[string]string{
+				"TELEPRESENCE_AGENT_TUNNEL_TCP_IDLE_TIMEOUT": "12h",
+				"TELEPRESENCE_AGENT_TUNNEL_KEEPALIVE":        "30s",
+			},
+			Output: func(e *managerutil.Env) {
+				e.AgentTunnelTCPIdleTimeout = 12 * time.Hour
+				e.AgentTunnelKeepAlive = 30 * time.Second
+			},
+		},
+		"managed-namespaces": {
+			Input: map[string]string{
+				"TELEPRESENCE_MANAGED_NAMESPACES": "dev, staging\tprod",
+			},
+			Output: func(e *managerutil.Env) {
+				e.ManagedNamespaces = managerutil.Namespaces{"dev", "staging", "prod"}
+			},
+		},
+		"agent-injector": {
+			Input: map[string]string{
+				"TELEPRESENCE_AGENT_INJECTOR_SECRET":            "mutator-webhook-tls",
+				"TELEPRESENCE_AGENT_INJECTOR_WEBHOOK":           "agent-injector-webhook-ambassador",
+				"TELEPRESENCE_AGENT_INJECTOR_CERT_RENEW_BEFORE": "0",
+			},
+			Output: func(e *managerutil.Env) {
+				e.AgentInjectorSecret = "mutator-webhook-tls"
+				e.AgentInjectorWebhook = "agent-injector-webhook-ambassador"
+				e.AgentInjectorCertRenewBefore = 0
+			},
+		},
 	}
 
 	for tcName, tc := range testcases {
@@ -82,3 +144,13 @@ func TestEnvconfig(t *testing.T) {
 		})
 	}
 }
+
+func TestIsManagedNamespace(t *testing.T) {
+	env := managerutil.Env{}
+	assert.True(t, env.IsManagedNamespace("dev"))
+
+	env.ManagedNamespaces = managerutil.Namespaces{"dev", "staging"}
+	assert.True(t, env.IsManagedNamespace("dev"))
+	assert.True(t, env.IsManagedNamespace("staging"))
+	assert.False(t, env.IsManagedNamespace("prod"))
+}
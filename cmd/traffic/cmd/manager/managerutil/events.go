@@ -0,0 +1,23 @@
+package managerutil
+
+import (
+	"context"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+// EventComponent is the source component of the Kubernetes Events that the traffic-manager records.
+const EventComponent = "traffic-manager"
+
+// RecordWorkloadEvent records a Kubernetes Event of the given type and reason on the given workload, so
+// that telepresence activity is shown by "kubectl describe" and seen by tools that watch Events. The Events
+// are informational, so errors are logged and otherwise ignored.
+func RecordWorkloadEvent(ctx context.Context, wl k8sapi.Workload, eventType, reason, message string) {
+	if k8sapi.GetK8sInterface(ctx) == nil {
+		return
+	}
+	if err := k8sapi.RecordWorkloadEvent(ctx, wl, EventComponent, eventType, reason, message); err != nil {
+		dlog.Errorf(ctx, "unable to record %s event on %s %s.%s: %v", reason, wl.GetKind(), wl.GetName(), wl.GetNamespace(), err)
+	}
+}
@@ -0,0 +1,43 @@
+package managerutil_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+func TestRecordWorkloadEvent(t *testing.T) {
+	dep := &apps.Deployment{ObjectMeta: meta.ObjectMeta{Name: "echo", Namespace: "default", UID: "echo-uid"}}
+	ki := fake.NewSimpleClientset(dep)
+	ctx := k8sapi.WithK8sInterface(context.Background(), ki)
+
+	managerutil.RecordWorkloadEvent(ctx, k8sapi.Deployment(dep), core.EventTypeNormal, "InterceptStarted", "started")
+
+	evs, err := ki.CoreV1().Events("default").List(ctx, meta.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, evs.Items, 1)
+	ev := evs.Items[0]
+	assert.Equal(t, core.ObjectReference{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       "echo",
+		Namespace:  "default",
+		UID:        "echo-uid",
+	}, ev.InvolvedObject)
+	assert.Equal(t, "InterceptStarted", ev.Reason)
+	assert.Equal(t, "started", ev.Message)
+	assert.Equal(t, core.EventTypeNormal, ev.Type)
+	assert.Equal(t, managerutil.EventComponent, ev.Source.Component)
+
+	// Without a Kubernetes interface, nothing is recorded
+	managerutil.RecordWorkloadEvent(context.Background(), k8sapi.Deployment(dep), core.EventTypeNormal, "InterceptStarted", "started")
+}
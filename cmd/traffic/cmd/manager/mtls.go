@@ -0,0 +1,174 @@
+package manager
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+)
+
+const (
+	mtlsDir                = `/var/run/secrets/mtls`
+	arriveAsClientMethod   = "/telepresence.manager.Manager/ArriveAsClient"
+	arriveAsClientV2Method = "/telepresence.manager.v2.Manager/ArriveAsClient"
+	mtlsServerCertValidFor = 365 * 24 * time.Hour
+	mtlsClientCertValidFor = 24 * time.Hour
+	maxCertificateRequest  = 16 * 1024
+)
+
+// loadMTLSCA reads the CA that is mounted from the install.ManagerMTLSSecretName secret.
+func loadMTLSCA() (*install.MTLSCA, error) {
+	certPem, err := os.ReadFile(filepath.Join(mtlsDir, install.MTLSCACertFile))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the mTLS CA certificate: %w", err)
+	}
+	keyPem, err := os.ReadFile(filepath.Join(mtlsDir, install.MTLSCAKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the mTLS CA private key: %w", err)
+	}
+	return install.ParseMTLSCA(certPem, keyPem)
+}
+
+// mtlsTLSConfig returns the TLS configuration of the MTLSPort. The traffic-manager issues its own server
+// certificate using the given CA, and only accepts clients that present a certificate that is signed by
+// that CA.
+func mtlsTLSConfig(ctx context.Context, ca *install.MTLSCA) (*tls.Config, error) {
+	ns := managerutil.GetEnv(ctx).ManagerNamespace
+	name := install.ManagerAppName + "." + ns
+	cert, err := ca.IssueCertificate(name, []string{install.ManagerAppName, name, name + ".svc"}, x509.ExtKeyUsageServerAuth, mtlsServerCertValidFor)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.CertPool(),
+		NextProtos:   []string{"h2"},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// mtlsBootstrapHandler signs the PEM encoded certificate requests that clients post to the
+// install.MTLSBootstrapPath and responds with the PEM encoded client certificate followed by the CA
+// certificate. The handler is served on the loopback interface only, so it can't be reached from other
+// pods. Clients reach it using a Kubernetes port-forward, which means that the permission to create
+// pods/portforward on the traffic-manager pod is what grants a client certificate.
+func mtlsBootstrapHandler(ca *install.MTLSCA) http.Handler {
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != install.MTLSBootstrapPath {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		csrPem, err := io.ReadAll(io.LimitReader(r.Body, maxCertificateRequest))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		certPem, err := ca.SignClientCertificateRequest(csrPem, mtlsClientCertValidFor)
+		if err != nil {
+			dlog.Errorf(r.Context(), "unable to sign client certificate request: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		_, _ = w.Write(append(certPem, caPem...))
+	})
+}
+
+// isMTLSPeer returns true if the peer of the given context presented a verified client certificate.
+func isMTLSPeer(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	ti, ok := p.AuthInfo.(credentials.TLSInfo)
+	return ok && len(ti.State.VerifiedChains) > 0
+}
+
+type sessionRequest interface {
+	GetSession() *rpc.SessionInfo
+}
+
+func requestSessionID(req interface{}) string {
+	switch r := req.(type) {
+	case *rpc.SessionInfo:
+		return r.GetSessionId()
+	case sessionRequest:
+		return r.GetSession().GetSessionId()
+	default:
+		return ""
+	}
+}
+
+// checkMTLSSession returns a PermissionDenied error if mTLS is enabled and the given client session is used
+// by a peer that didn't authenticate using a client certificate. Agent sessions are never affected, because
+// the traffic-agents use the plaintext port.
+func (m *Manager) checkMTLSSession(ctx context.Context, sessionID string) error {
+	if !m.mtlsEnabled() || sessionID == "" || isMTLSPeer(ctx) || m.state.GetClient(sessionID) == nil {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied,
+		"client sessions must authenticate using mutual TLS on port %s", install.ManagerPortMTLSName)
+}
+
+func (m *Manager) mtlsEnabled() bool {
+	env := managerutil.GetEnv(m.ctx)
+	return env != nil && env.MTLSPort != 0
+}
+
+func (m *Manager) checkMTLS(ctx context.Context, method string, req interface{}) error {
+	if (method == arriveAsClientMethod || method == arriveAsClientV2Method) && m.mtlsEnabled() && !isMTLSPeer(ctx) {
+		return status.Errorf(codes.PermissionDenied,
+			"clients must authenticate using mutual TLS on port %s", install.ManagerPortMTLSName)
+	}
+	return m.checkMTLSSession(ctx, requestSessionID(req))
+}
+
+func (m *Manager) mtlsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := m.checkMTLS(ctx, info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (m *Manager) mtlsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &mtlsServerStream{ServerStream: ss, mgr: m, method: info.FullMethod})
+}
+
+// mtlsServerStream checks each message that it receives, so that the session of a server streaming call
+// such as WatchIntercepts is checked before the call is handled.
+type mtlsServerStream struct {
+	grpc.ServerStream
+	mgr    *Manager
+	method string
+}
+
+func (s *mtlsServerStream) RecvMsg(msg interface{}) error {
+	if err := s.ServerStream.RecvMsg(msg); err != nil {
+		return err
+	}
+	return s.mgr.checkMTLS(s.Context(), s.method, msg)
+}
@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+)
+
+func TestManager_checkMTLS(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	plainCtx := peer.NewContext(ctx, &peer.Peer{})
+	tlsCtx := peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{}}},
+	}}})
+	unverifiedCtx := peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{}})
+
+	newManager := func(mtlsPort int32) (*Manager, string, string) {
+		mctx := managerutil.WithEnv(ctx, &managerutil.Env{MTLSPort: mtlsPort})
+		m := &Manager{ctx: mctx, state: state.NewState(mctx)}
+		now := time.Now()
+		clientID := m.state.AddClient(&rpc.ClientInfo{Name: "jane@host", InstallId: "x", Product: "telepresence", Version: "2.5.0"}, now)
+		agentID := m.state.AddAgent(&rpc.AgentInfo{Name: "echo", Namespace: "default", Product: "telepresence", Version: "2.5.0"}, now)
+		return m, clientID, agentID
+	}
+
+	assertDenied := func(t *testing.T, err error) {
+		t.Helper()
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		m, clientID, _ := newManager(0)
+		assert.NoError(t, m.checkMTLS(plainCtx, arriveAsClientMethod, &rpc.ClientInfo{}))
+		assert.NoError(t, m.checkMTLS(plainCtx, "/telepresence.manager.Manager/WatchIntercepts", &rpc.SessionInfo{SessionId: clientID}))
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		m, clientID, agentID := newManager(8082)
+		assertDenied(t, m.checkMTLS(plainCtx, arriveAsClientMethod, &rpc.ClientInfo{}))
+		assertDenied(t, m.checkMTLS(unverifiedCtx, arriveAsClientMethod, &rpc.ClientInfo{}))
+		assert.NoError(t, m.checkMTLS(tlsCtx, arriveAsClientMethod, &rpc.ClientInfo{}))
+		assertDenied(t, m.checkMTLS(plainCtx, arriveAsClientV2Method, &rpc.ClientInfo{}))
+		assert.NoError(t, m.checkMTLS(tlsCtx, arriveAsClientV2Method, &rpc.ClientInfo{}))
+
+		// Client sessions can only be used over mTLS
+		watch := "/telepresence.manager.Manager/WatchIntercepts"
+		assertDenied(t, m.checkMTLS(plainCtx, watch, &rpc.SessionInfo{SessionId: clientID}))
+		assertDenied(t, m.checkMTLS(plainCtx, "/telepresence.manager.Manager/CreateIntercept",
+			&rpc.CreateInterceptRequest{Session: &rpc.SessionInfo{SessionId: clientID}}))
+		assertDenied(t, m.checkMTLSSession(plainCtx, clientID))
+		assert.NoError(t, m.checkMTLS(tlsCtx, watch, &rpc.SessionInfo{SessionId: clientID}))
+
+		// Agents are unaffected
+		assert.NoError(t, m.checkMTLS(plainCtx, "/telepresence.manager.Manager/ArriveAsAgent", &rpc.AgentInfo{}))
+		assert.NoError(t, m.checkMTLS(plainCtx, watch, &rpc.SessionInfo{SessionId: agentID}))
+		assert.NoError(t, m.checkMTLSSession(plainCtx, agentID))
+	})
+}
+
+func TestMTLSBootstrapHandler(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "traffic-manager-mtls-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(48 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDer, err := x509.CreateCertificate(cryptorand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caKeyDer, err := x509.MarshalECPrivateKey(caKey)
+	require.NoError(t, err)
+	ca, err := install.ParseMTLSCA(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: caKeyDer}))
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	require.NoError(t, err)
+	csrDer, err := x509.CreateCertificateRequest(cryptorand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "jane@host"}}, key)
+	require.NoError(t, err)
+	csrPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDer})
+
+	h := mtlsBootstrapHandler(ca)
+	post := func(path string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return w
+	}
+
+	w := post(install.MTLSBootstrapPath, csrPem)
+	require.Equal(t, http.StatusOK, w.Code)
+	block, rest := pem.Decode(w.Body.Bytes())
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	assert.NoError(t, cert.CheckSignatureFrom(ca.Cert))
+	assert.Equal(t, "jane@host", cert.Subject.CommonName)
+	assert.WithinDuration(t, time.Now().Add(mtlsClientCertValidFor), cert.NotAfter, time.Minute)
+	block, _ = pem.Decode(rest)
+	require.NotNil(t, block)
+	assert.Equal(t, ca.Cert.Raw, block.Bytes)
+
+	assert.Equal(t, http.StatusBadRequest, post(install.MTLSBootstrapPath, []byte("garbage")).Code)
+	assert.Equal(t, http.StatusNotFound, post("/other", csrPem).Code)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, install.MTLSBootstrapPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
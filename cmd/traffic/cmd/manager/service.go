@@ -1,20 +1,24 @@
 package manager
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"sort"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/miekg/dns"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
@@ -22,6 +26,7 @@ import (
 	"github.com/datawire/dlib/dlog"
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/rpc/v2/systema"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/artifact"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/cluster"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
@@ -43,6 +48,7 @@ type Manager struct {
 	state       *state.State
 	systema     *systemaPool
 	clusterInfo cluster.Info
+	artifacts   *artifact.Cache
 
 	rpc.UnsafeManagerServer
 }
@@ -63,6 +69,12 @@ func NewManager(ctx context.Context) *Manager {
 		state:       state.NewState(ctx),
 		clusterInfo: cluster.NewInfo(ctx),
 	}
+	env := managerutil.GetEnv(ctx)
+	if hc, err := env.SystemAHTTPClient(); err == nil {
+		ret.artifacts = artifact.NewCache(artifactCacheDir, env.SystemAHost, env.ArtifactCacheTTL, hc)
+	} else if !errors.Is(err, managerutil.ErrSystemADisabled) {
+		dlog.Errorf(ctx, "unable to create the Ambassador Cloud client: %v", err)
+	}
 	ret.systema = NewSystemAPool(ret)
 	return ret
 }
@@ -108,6 +120,9 @@ func (m *Manager) GetLicense(ctx context.Context, _ *empty.Empty) (*rpc.License,
 // from within a cluster
 func (m *Manager) CanConnectAmbassadorCloud(ctx context.Context, _ *empty.Empty) (*rpc.AmbassadorCloudConnection, error) {
 	env := managerutil.GetEnv(ctx)
+	if env.SystemADisabled {
+		return &rpc.AmbassadorCloudConnection{CanConnect: false}, nil
+	}
 	timeout := 2 * time.Second
 	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%s", env.SystemAHost, env.SystemAPort), timeout)
 	if err != nil {
@@ -131,6 +146,71 @@ func (m *Manager) GetTelepresenceAPI(ctx context.Context, e *empty.Empty) (*rpc.
 	return &rpc.TelepresenceAPIInfo{Port: env.APIPort}, nil
 }
 
+// GetClientRequirements returns the settings that the traffic-manager runs with
+func (m *Manager) GetClientRequirements(ctx context.Context, e *empty.Empty) (*rpc.ClientRequirements, error) {
+	env := managerutil.GetEnv(ctx)
+	return &rpc.ClientRequirements{
+		AgentRegistry:       env.AgentRegistry,
+		AgentImage:          env.AgentImage,
+		ApiPort:             env.APIPort,
+		AppProtocolStrategy: env.AppProtocolStrategy.String(),
+		MaxReceiveSize:      env.MaxReceiveSize.Value(),
+	}, nil
+}
+
+// artifactCacheDir is where Ambassador Cloud artifacts are cached. The helm chart mounts an emptyDir volume
+// here since the root filesystem of the traffic-manager is read-only.
+const artifactCacheDir = "/tmp/artifacts"
+
+// artifactChunkSize is the size of the chunks that GetCloudArtifact sends. It must be well below
+// the max receive size of the clients.
+const artifactChunkSize = 64 * 1024
+
+// GetCloudArtifact streams an Ambassador Cloud artifact from the traffic-manager's cache.
+func (m *Manager) GetCloudArtifact(request *rpc.CloudArtifactRequest, stream rpc.Manager_GetCloudArtifactServer) error {
+	ctx := managerutil.WithSessionInfo(stream.Context(), request.GetSession())
+	dlog.Debugf(ctx, "GetCloudArtifact called %s", request.Url)
+
+	// Artifacts are only served to clients, and the cache keeps the artifacts that are downloaded using
+	// different credentials apart, so a client never gets an artifact that it isn't authorized to download.
+	sessionID := request.GetSession().GetSessionId()
+	client := m.state.GetClient(sessionID)
+	if client == nil {
+		return status.Errorf(codes.NotFound, "Client session %q not found", sessionID)
+	}
+	var header http.Header
+	if apiKey := client.GetApiKey(); apiKey != "" {
+		header = http.Header{"X-Ambassador-Api-Key": []string{apiKey}}
+	}
+	if m.artifacts == nil {
+		return status.Error(codes.FailedPrecondition, "the traffic-manager has no access to Ambassador Cloud")
+	}
+	f, err := m.artifacts.Open(ctx, request.Url, header)
+	if err != nil {
+		if errors.Is(err, artifact.ErrNotAllowed) {
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer f.Close()
+
+	buf := make([]byte, artifactChunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&rpc.CloudArtifactChunk{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+}
+
 // ArriveAsClient establishes a session between a client and the Manager.
 func (m *Manager) ArriveAsClient(ctx context.Context, client *rpc.ClientInfo) (*rpc.SessionInfo, error) {
 	dlog.Debug(ctx, "ArriveAsClient called")
@@ -153,6 +233,10 @@ func (m *Manager) ArriveAsAgent(ctx context.Context, agent *rpc.AgentInfo) (*rpc
 	if val := validateAgent(agent); val != "" {
 		return nil, status.Errorf(codes.InvalidArgument, val)
 	}
+	if env := managerutil.GetEnv(ctx); env != nil && !env.IsManagedNamespace(agent.Namespace) {
+		return nil, status.Errorf(codes.PermissionDenied,
+			"namespace %s is not managed by the traffic-manager", agent.Namespace)
+	}
 
 	sessionID := m.state.AddAgent(agent, m.clock.Now())
 
@@ -167,6 +251,9 @@ func (m *Manager) Remain(_ context.Context, req *rpc.RemainRequest) (*empty.Empt
 	if ok := m.state.MarkSession(req, m.clock.Now()); !ok {
 		return nil, status.Errorf(codes.NotFound, "Session %q not found", req.GetSession().GetSessionId())
 	}
+	if len(req.InterceptStats) > 0 {
+		m.state.UpdateInterceptStats(req.GetSession().GetSessionId(), req.InterceptStats)
+	}
 
 	return &empty.Empty{}, nil
 }
@@ -318,8 +405,22 @@ func (m *Manager) CreateIntercept(ctx context.Context, ciReq *rpc.CreateIntercep
 	if val := validateIntercept(spec); val != "" {
 		return nil, status.Errorf(codes.InvalidArgument, val)
 	}
+	if env := managerutil.GetEnv(ctx); env != nil {
+		if !env.IsManagedNamespace(spec.Namespace) {
+			return nil, status.Errorf(codes.PermissionDenied,
+				"namespace %s is not managed by the traffic-manager", spec.Namespace)
+		}
+		if env.InterceptRequireIdentity && len(spec.IdentityHeaders) == 0 {
+			return nil, status.Errorf(codes.FailedPrecondition,
+				"the traffic-manager requires intercepts to be identified; declare intercept.identityHeaders in the client's config.yml")
+		}
+		if env.InterceptRequireEncryption && len(spec.ClientPublicKey) == 0 {
+			return nil, status.Errorf(codes.FailedPrecondition,
+				"the traffic-manager requires intercepts to be encrypted; use the --encrypt flag")
+		}
+	}
 
-	return m.state.AddIntercept(sessionID, apiKey, spec)
+	return m.state.AddIntercept(sessionID, apiKey, ciReq.IdempotencyKey, spec)
 }
 
 func (m *Manager) makeinterceptID(ctx context.Context, sessionID string, name string) (string, error) {
@@ -349,6 +450,16 @@ func (m *Manager) UpdateIntercept(ctx context.Context, req *rpc.UpdateInterceptR
 
 	dlog.Debugf(ctx, "UpdateIntercept called: %s", interceptID)
 
+	if apiKey := req.GetApiKey(); apiKey != "" {
+		intercept := m.state.UpdateInterceptAPIKey(interceptID, apiKey)
+		if intercept == nil {
+			return nil, status.Errorf(codes.NotFound, "Intercept with ID %q not found for this session", interceptID)
+		}
+		if req.PreviewDomainAction == nil {
+			return intercept, nil
+		}
+	}
+
 	switch action := req.PreviewDomainAction.(type) {
 	case *rpc.UpdateInterceptRequest_AddPreviewDomain:
 		var domain string
@@ -457,6 +568,14 @@ func (m *Manager) RemoveIntercept(ctx context.Context, riReq *rpc.RemoveIntercep
 		return nil, status.Errorf(codes.NotFound, "Client session %q not found", sessionID)
 	}
 
+	if name == "" && riReq.IdempotencyKey != "" {
+		ii := m.state.InterceptByIdempotencyKey(sessionID, riReq.IdempotencyKey)
+		if ii == nil {
+			return nil, status.Errorf(codes.NotFound, "Intercept with idempotency key %q not found", riReq.IdempotencyKey)
+		}
+		name = ii.Spec.Name
+	}
+
 	if !m.state.RemoveIntercept(sessionID + ":" + name) {
 		return nil, status.Errorf(codes.NotFound, "Intercept named %q not found", name)
 	}
@@ -503,8 +622,32 @@ func (m *Manager) ReviewIntercept(ctx context.Context, rIReq *rpc.ReviewIntercep
 			intercept.Message = rIReq.Message
 			intercept.PodIp = rIReq.PodIp
 			intercept.SftpPort = rIReq.SftpPort
+			intercept.WebdavPort = rIReq.WebdavPort
 			intercept.MechanismArgsDesc = rIReq.MechanismArgsDesc
 			intercept.Headers = rIReq.Headers
+			intercept.AgentPublicKey = rIReq.AgentPublicKey
+			intercept.Mirrored = rIReq.Mirrored
+			intercept.TrafficPercentage = rIReq.TrafficPercentage
+
+			// An agent that doesn't know about end-to-end encryption will not provide a key
+			if intercept.Disposition == rpc.InterceptDispositionType_ACTIVE &&
+				len(intercept.Spec.ClientPublicKey) > 0 && len(intercept.AgentPublicKey) != tunnel.KeySize {
+				intercept.Disposition = rpc.InterceptDispositionType_AGENT_ERROR
+				intercept.Message = "the traffic-agent does not support end-to-end encryption"
+			}
+
+			// An agent that doesn't know about mirroring would divert the traffic
+			if intercept.Disposition == rpc.InterceptDispositionType_ACTIVE && intercept.Spec.Mirror && !intercept.Mirrored {
+				intercept.Disposition = rpc.InterceptDispositionType_AGENT_ERROR
+				intercept.Message = "the traffic-agent does not support mirroring"
+			}
+
+			// An agent that doesn't know about traffic percentages would divert all traffic
+			if intercept.Disposition == rpc.InterceptDispositionType_ACTIVE &&
+				intercept.Spec.TrafficPercentage != 0 && intercept.TrafficPercentage != intercept.Spec.TrafficPercentage {
+				intercept.Disposition = rpc.InterceptDispositionType_AGENT_ERROR
+				intercept.Message = "the traffic-agent does not support traffic percentages"
+			}
 		}
 	})
 
@@ -521,6 +664,9 @@ func (m *Manager) Tunnel(server rpc.Manager_TunnelServer) error {
 	if err != nil {
 		return status.Errorf(codes.FailedPrecondition, "failed to connect stream: %v", err)
 	}
+	if err = m.checkMTLSSession(ctx, stream.SessionID()); err != nil {
+		return err
+	}
 	return m.state.Tunnel(ctx, stream)
 }
 
@@ -560,6 +706,7 @@ func (m *Manager) LookupHost(ctx context.Context, request *rpc.LookupHostRequest
 		}
 	}
 
+	var ttl time.Duration
 	if count == 0 {
 		if addrs, err := net.DefaultResolver.LookupHost(ctx, request.Host); err != nil {
 			if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
@@ -573,12 +720,21 @@ func (m *Manager) LookupHost(ctx context.Context, request *rpc.LookupHostRequest
 				ips[i] = iputil.Parse(addr)
 			}
 			dlog.Debugf(ctx, "LookupHost on traffic-manager: %s -> %s", request.Host, ips)
+			if request.Ttl {
+				if cfg, err := dns.ClientConfigFromFile(resolvConf); err == nil {
+					ttl = lookupTTL(ctx, cfg, request.Host)
+				}
+			}
 		}
 	}
 	if ips == nil {
 		ips = iputil.IPs{}
 	}
-	return &rpc.LookupHostResponse{Ips: ips.BytesSlice()}, nil
+	rsp := &rpc.LookupHostResponse{Ips: ips.BytesSlice()}
+	if ttl > 0 {
+		rsp.Ttl = durationpb.New(ttl)
+	}
+	return rsp, nil
 }
 
 func (m *Manager) AgentLookupHostResponse(ctx context.Context, response *rpc.LookupHostAgentResponse) (*empty.Empty, error) {
@@ -633,6 +789,17 @@ func (m *Manager) GetLogs(ctx context.Context, request *rpc.GetLogsRequest) (*rp
 				plo := &corev1.PodLogOptions{
 					Container: container,
 				}
+				if since := request.Since; since != nil {
+					secs := int64(since.AsDuration().Seconds())
+					if secs < 1 {
+						// The API server rejects values less than one second
+						secs = 1
+					}
+					plo.SinceSeconds = &secs
+				}
+				if tail := request.TailLines; tail > 0 {
+					plo.TailLines = &tail
+				}
 				// Since the same named workload could exist in multiple namespaces
 				// we add the namespace into the name so that it's easier to make
 				// sense of the logs
@@ -676,7 +843,7 @@ func (m *Manager) GetLogs(ctx context.Context, request *rpc.GetLogsRequest) (*rp
 		wg.Wait()
 	}
 	// Get the pods that have traffic-agents
-	agentPods, err := m.clusterInfo.GetTrafficAgentPods(ctx, request.Agents)
+	agentPods, err := m.clusterInfo.GetTrafficAgentPods(ctx, request.Agents, request.AgentsNamespace, request.AgentsSelector)
 	if err != nil {
 		errMsg += fmt.Sprintf("error getting traffic-agent pods: %s\n", err)
 	} else {
@@ -703,6 +870,89 @@ func (m *Manager) GetLogs(ctx context.Context, request *rpc.GetLogsRequest) (*rp
 	return resp, nil
 }
 
+func (m *Manager) StreamLogs(request *rpc.StreamLogsRequest, stream rpc.Manager_StreamLogsServer) error {
+	ctx := stream.Context()
+	dlog.Debugf(ctx, "StreamLogs called")
+
+	type podContainer struct {
+		pod       *corev1.Pod
+		container string
+	}
+	var pcs []podContainer
+	agentPods, err := m.clusterInfo.GetTrafficAgentPods(ctx, request.Agents, request.AgentsNamespace, request.AgentsSelector)
+	if err != nil {
+		return status.Errorf(codes.Internal, "error getting traffic-agent pods: %v", err)
+	}
+	for _, pod := range agentPods {
+		pcs = append(pcs, podContainer{pod: pod, container: "traffic-agent"})
+	}
+	if request.TrafficManager {
+		managerPods, err := m.clusterInfo.GetTrafficManagerPods(ctx)
+		if err != nil {
+			return status.Errorf(codes.Internal, "error getting traffic-manager pods: %v", err)
+		}
+		for _, pod := range managerPods {
+			pcs = append(pcs, podContainer{pod: pod, container: "traffic-manager"})
+		}
+	}
+
+	// Lines are read concurrently from all pods, but a grpc stream must only be sent to from one goroutine.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lines := make(chan *rpc.LogLine)
+	wg := sync.WaitGroup{}
+	wg.Add(len(pcs))
+	ki := k8sapi.GetK8sInterface(ctx)
+	for _, pc := range pcs {
+		go func(pc podContainer) {
+			defer wg.Done()
+			podAndNs := fmt.Sprintf("%s.%s", pc.pod.Name, pc.pod.Namespace)
+			send := func(line string) bool {
+				select {
+				case <-ctx.Done():
+					return false
+				case lines <- &rpc.LogLine{Pod: podAndNs, Container: pc.container, Line: line}:
+					return true
+				}
+			}
+			plo := &corev1.PodLogOptions{
+				Container: pc.container,
+				Follow:    request.Follow,
+			}
+			if tail := request.TailLines; tail > 0 {
+				plo.TailLines = &tail
+			}
+			podLogs, err := ki.CoreV1().Pods(pc.pod.Namespace).GetLogs(pc.pod.Name, plo).Stream(ctx)
+			if err != nil {
+				send(fmt.Sprintf("Failed to get logs: %v", err))
+				return
+			}
+			defer podLogs.Close()
+			sc := bufio.NewScanner(podLogs)
+			sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+			for sc.Scan() {
+				if !send(sc.Text()) {
+					return
+				}
+			}
+			if err := sc.Err(); err != nil && ctx.Err() == nil {
+				send(fmt.Sprintf("Failed reading log: %v", err))
+			}
+		}(pc)
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	for line := range lines {
+		if err := stream.Send(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *Manager) SetLogLevel(ctx context.Context, request *rpc.LogLevelRequest) (*empty.Empty, error) {
 	m.state.SetTempLogLevel(ctx, request)
 	return &empty.Empty{}, nil
@@ -733,6 +983,12 @@ func (m *Manager) WatchClusterInfo(session *rpc.SessionInfo, stream rpc.Manager_
 	return m.clusterInfo.Watch(ctx, stream)
 }
 
+func (m *Manager) WatchServices(session *rpc.SessionInfo, stream rpc.Manager_WatchServicesServer) error {
+	ctx := managerutil.WithSessionInfo(stream.Context(), session)
+	dlog.Debugf(ctx, "WatchServices called")
+	return m.clusterInfo.WatchServices(ctx, stream)
+}
+
 // expire removes stale sessions.
 func (m *Manager) expire(ctx context.Context) {
 	m.state.ExpireSessions(ctx, m.clock.Now().Add(-15*time.Second))
@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	managerv2 "github.com/telepresenceio/telepresence/rpc/v2/manager/v2"
+)
+
+// serviceV2 implements the versioned managerv2.ManagerServer by delegating to the Manager. Changes to the
+// behavior of the Manager must not break the contract of the versioned service.
+type serviceV2 struct {
+	managerv2.UnsafeManagerServer
+	m *Manager
+}
+
+func (s *serviceV2) Version(ctx context.Context, e *empty.Empty) (*rpc.VersionInfo2, error) {
+	return s.m.Version(ctx, e)
+}
+
+func (s *serviceV2) ArriveAsClient(ctx context.Context, client *rpc.ClientInfo) (*rpc.SessionInfo, error) {
+	return s.m.ArriveAsClient(ctx, client)
+}
+
+func (s *serviceV2) Remain(ctx context.Context, req *rpc.RemainRequest) (*empty.Empty, error) {
+	return s.m.Remain(ctx, req)
+}
+
+func (s *serviceV2) Depart(ctx context.Context, session *rpc.SessionInfo) (*empty.Empty, error) {
+	return s.m.Depart(ctx, session)
+}
+
+func (s *serviceV2) WatchAgents(session *rpc.SessionInfo, stream managerv2.Manager_WatchAgentsServer) error {
+	return s.m.WatchAgents(session, stream)
+}
+
+// WatchIntercepts differs from the unversioned method in that it requires a session, so that a client can't
+// watch the intercepts of other clients.
+func (s *serviceV2) WatchIntercepts(session *rpc.SessionInfo, stream managerv2.Manager_WatchInterceptsServer) error {
+	if session.GetSessionId() == "" {
+		return status.Error(codes.InvalidArgument, "a session ID is required")
+	}
+	return s.m.WatchIntercepts(session, stream)
+}
+
+func (s *serviceV2) CreateIntercept(ctx context.Context, req *rpc.CreateInterceptRequest) (*rpc.InterceptInfo, error) {
+	return s.m.CreateIntercept(ctx, req)
+}
+
+func (s *serviceV2) RemoveIntercept(ctx context.Context, req *rpc.RemoveInterceptRequest2) (*empty.Empty, error) {
+	return s.m.RemoveIntercept(ctx, req)
+}
+
+func (s *serviceV2) GetIntercept(ctx context.Context, req *rpc.GetInterceptRequest) (*rpc.InterceptInfo, error) {
+	return s.m.GetIntercept(ctx, req)
+}
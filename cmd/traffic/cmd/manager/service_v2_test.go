@@ -0,0 +1,22 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
+)
+
+func TestServiceV2_WatchIntercepts(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	s := &serviceV2{m: &Manager{ctx: ctx, state: state.NewState(ctx)}}
+
+	// Unlike the unversioned service, the versioned one doesn't let anyone watch all intercepts
+	err := s.WatchIntercepts(&rpc.SessionInfo{}, nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
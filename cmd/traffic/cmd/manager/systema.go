@@ -114,10 +114,14 @@ func (p *systemaPool) Get() (systemarpc.SystemACRUDClient, error) {
 		host := env.SystemAHost
 		port := env.SystemAPort
 
+		tlsCfg, err := env.SystemATLSConfig(host)
+		if err != nil {
+			return nil, err
+		}
 		ctx, cancel := context.WithCancel(dgroup.WithGoroutineName(p.mgr.ctx, "/systema"))
 		client, wait, err := systema.ConnectToSystemA(
 			ctx, p.mgr, net.JoinHostPort(host, port),
-			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{ServerName: host})),
+			grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)),
 			grpc.WithPerRPCCredentials(&systemaCredentials{p.mgr}))
 		if err != nil {
 			cancel()
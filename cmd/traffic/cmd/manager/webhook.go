@@ -0,0 +1,232 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/datawire/dlib/dgroup"
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/watchable"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+)
+
+const (
+	webhookInterceptCreated = "intercept.created"
+	webhookInterceptLeft    = "intercept.left"
+	webhookAgentInstalled   = "agent.installed"
+	webhookAgentRemoved     = "agent.removed"
+
+	// webhookSignatureHeader holds the hex encoded HMAC-SHA256 of the body when a webhook secret is configured.
+	webhookSignatureHeader = "X-Telepresence-Signature"
+
+	webhookQueueSize = 100
+	webhookAttempts  = 3
+	webhookTimeout   = 10 * time.Second
+)
+
+// webhookEvent is the JSON body that is posted to the webhook URL. The Text is a human-readable summary,
+// which makes the events directly usable with e.g. Slack incoming webhooks.
+type webhookEvent struct {
+	Type      string            `json:"type"`
+	Time      time.Time         `json:"time"`
+	Text      string            `json:"text"`
+	Intercept *webhookIntercept `json:"intercept,omitempty"`
+	Agent     *webhookAgent     `json:"agent,omitempty"`
+}
+
+type webhookIntercept struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Client    string `json:"client"`
+	Workload  string `json:"workload"`
+	Namespace string `json:"namespace"`
+}
+
+type webhookAgent struct {
+	Workload  string `json:"workload"`
+	Namespace string `json:"namespace"`
+	Version   string `json:"version"`
+}
+
+// runWebhookLoop posts intercept and agent lifecycle events to the configured webhook URL, if any.
+func (m *Manager) runWebhookLoop(ctx context.Context) error {
+	env := managerutil.GetEnv(ctx)
+	if env.WebhookURL == "" {
+		return nil
+	}
+	events := make(chan *webhookEvent, webhookQueueSize)
+	post := func(ev *webhookEvent) {
+		select {
+		case events <- ev:
+		default:
+			dlog.Errorf(ctx, "webhook queue is full, dropping %s event", ev.Type)
+		}
+	}
+
+	g := dgroup.NewGroup(ctx, dgroup.GroupConfig{})
+	g.Go("intercepts", func(ctx context.Context) error {
+		known := make(map[string]struct{})
+		for snapshot := range m.state.WatchIntercepts(ctx, nil) {
+			for _, update := range snapshot.Updates {
+				if ev := interceptWebhookEvent(known, update); ev != nil {
+					post(ev)
+				}
+			}
+		}
+		return nil
+	})
+	g.Go("agents", func(ctx context.Context) error {
+		sessions := make(map[string]string)
+		counts := make(map[string]int)
+		for snapshot := range m.state.WatchAgents(ctx, nil) {
+			for _, update := range snapshot.Updates {
+				if ev := agentWebhookEvent(sessions, counts, update); ev != nil {
+					post(ev)
+				}
+			}
+		}
+		return nil
+	})
+	g.Go("sender", func(ctx context.Context) error {
+		client := &http.Client{Timeout: webhookTimeout}
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case ev := <-events:
+				if err := sendWebhookEvent(ctx, client, env.WebhookURL, env.WebhookSecret, ev); err != nil {
+					dlog.Errorf(ctx, "unable to post %s event to webhook: %v", ev.Type, err)
+				}
+			}
+		}
+	})
+	return g.Wait()
+}
+
+// interceptWebhookEvent returns the event that the given update warrants, if any. The known map holds the
+// IDs of the intercepts that have been reported as created and is updated accordingly.
+func interceptWebhookEvent(known map[string]struct{}, update watchable.InterceptMapUpdate) *webhookEvent {
+	ii := update.Value
+	if ii == nil {
+		return nil
+	}
+	_, isKnown := known[update.Key]
+	var evType, verb string
+	switch {
+	case update.Delete && isKnown:
+		delete(known, update.Key)
+		evType, verb = webhookInterceptLeft, "left"
+	case !update.Delete && !isKnown:
+		known[update.Key] = struct{}{}
+		evType, verb = webhookInterceptCreated, "created"
+	default:
+		return nil
+	}
+	spec := ii.Spec
+	return &webhookEvent{
+		Type: evType,
+		Time: time.Now(),
+		Text: fmt.Sprintf("Intercept %q of %s.%s by %s %s", spec.Name, spec.Agent, spec.Namespace, spec.Client, verb),
+		Intercept: &webhookIntercept{
+			ID:        ii.Id,
+			Name:      spec.Name,
+			Client:    spec.Client,
+			Workload:  spec.Agent,
+			Namespace: spec.Namespace,
+		},
+	}
+}
+
+// agentWebhookEvent returns the event that the given update warrants, if any. An agent is installed when
+// the first traffic-agent of a workload arrives, and removed when the last one departs. The sessions map
+// holds the workload of each agent session, and counts holds the number of sessions of each workload.
+func agentWebhookEvent(sessions map[string]string, counts map[string]int, update watchable.AgentMapUpdate) *webhookEvent {
+	ai := update.Value
+	if ai == nil {
+		return nil
+	}
+	workload := ai.Name + "." + ai.Namespace
+	var evType, verb string
+	if update.Delete {
+		if _, ok := sessions[update.Key]; !ok {
+			return nil
+		}
+		delete(sessions, update.Key)
+		if counts[workload]--; counts[workload] > 0 {
+			return nil
+		}
+		delete(counts, workload)
+		evType, verb = webhookAgentRemoved, "removed from"
+	} else {
+		if _, ok := sessions[update.Key]; ok {
+			return nil
+		}
+		sessions[update.Key] = workload
+		if counts[workload]++; counts[workload] > 1 {
+			return nil
+		}
+		evType, verb = webhookAgentInstalled, "installed in"
+	}
+	return &webhookEvent{
+		Type: evType,
+		Time: time.Now(),
+		Text: fmt.Sprintf("Traffic agent %s %s", verb, workload),
+		Agent: &webhookAgent{
+			Workload:  ai.Name,
+			Namespace: ai.Namespace,
+			Version:   ai.Version,
+		},
+	}
+}
+
+// sendWebhookEvent posts the event, retrying with an increasing delay when the post fails.
+func sendWebhookEvent(ctx context.Context, client *http.Client, url, secret string, ev *webhookEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		if err = postWebhook(ctx, client, url, secret, body); err == nil || attempt == webhookAttempts {
+			return err
+		}
+		dlog.Debugf(ctx, "webhook post failed, retrying in %s: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func postWebhook(ctx context.Context, client *http.Client, url, secret string, body []byte) error {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	rq.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		_, _ = mac.Write(body)
+		rq.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	rs, err := client.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+	_, _ = io.Copy(io.Discard, rs.Body)
+	if rs.StatusCode < 200 || rs.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", rs.Status)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/watchable"
+)
+
+func Test_interceptWebhookEvent(t *testing.T) {
+	known := make(map[string]struct{})
+	spec := &rpc.InterceptSpec{Name: "echo", Client: "alice@laptop", Agent: "echo", Namespace: "default"}
+	update := func(id string, disposition rpc.InterceptDispositionType, del bool) *webhookEvent {
+		return interceptWebhookEvent(known, watchable.InterceptMapUpdate{
+			Key:    id,
+			Delete: del,
+			Value:  &rpc.InterceptInfo{Id: id, Spec: spec, Disposition: disposition},
+		})
+	}
+
+	ev := update("s1:echo", rpc.InterceptDispositionType_WAITING, false)
+	require.NotNil(t, ev)
+	assert.Equal(t, webhookInterceptCreated, ev.Type)
+	assert.Equal(t, `Intercept "echo" of echo.default by alice@laptop created`, ev.Text)
+	assert.Equal(t, &webhookIntercept{ID: "s1:echo", Name: "echo", Client: "alice@laptop", Workload: "echo", Namespace: "default"}, ev.Intercept)
+
+	// Changes in disposition don't warrant new events
+	assert.Nil(t, update("s1:echo", rpc.InterceptDispositionType_ACTIVE, false))
+
+	ev = update("s1:echo", rpc.InterceptDispositionType_ACTIVE, true)
+	require.NotNil(t, ev)
+	assert.Equal(t, webhookInterceptLeft, ev.Type)
+	assert.Empty(t, known)
+
+	// Deleting an unknown intercept is a no-op
+	assert.Nil(t, update("s2:echo", rpc.InterceptDispositionType_ACTIVE, true))
+}
+
+func Test_agentWebhookEvent(t *testing.T) {
+	sessions := make(map[string]string)
+	counts := make(map[string]int)
+	update := func(sessionID string, del bool) *webhookEvent {
+		return agentWebhookEvent(sessions, counts, watchable.AgentMapUpdate{
+			Key:    sessionID,
+			Delete: del,
+			Value:  &rpc.AgentInfo{Name: "echo", Namespace: "default", Version: "2.5.0"},
+		})
+	}
+
+	ev := update("a1", false)
+	require.NotNil(t, ev)
+	assert.Equal(t, webhookAgentInstalled, ev.Type)
+	assert.Equal(t, "Traffic agent installed in echo.default", ev.Text)
+	assert.Equal(t, &webhookAgent{Workload: "echo", Namespace: "default", Version: "2.5.0"}, ev.Agent)
+
+	// More replicas of the same workload
+	assert.Nil(t, update("a2", false))
+	assert.Nil(t, update("a2", false))
+	assert.Nil(t, update("a1", true))
+	assert.Nil(t, update("a1", true))
+
+	ev = update("a2", true)
+	require.NotNil(t, ev)
+	assert.Equal(t, webhookAgentRemoved, ev.Type)
+	assert.Equal(t, "Traffic agent removed from echo.default", ev.Text)
+	assert.Empty(t, sessions)
+	assert.Empty(t, counts)
+}
+
+func Test_sendWebhookEvent(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	var bodies [][]byte
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cr3t"))
+		_, _ = mac.Write(body)
+		assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), r.Header.Get(webhookSignatureHeader))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+		status = http.StatusOK
+	}))
+	defer srv.Close()
+
+	ev := &webhookEvent{Type: webhookAgentInstalled, Text: "Traffic agent installed in echo.default"}
+	require.NoError(t, sendWebhookEvent(ctx, srv.Client(), srv.URL, "s3cr3t", ev))
+
+	// The first attempt failed
+	require.Len(t, bodies, 2)
+	var posted webhookEvent
+	require.NoError(t, json.Unmarshal(bodies[1], &posted))
+	assert.Equal(t, ev.Type, posted.Type)
+	assert.Equal(t, ev.Text, posted.Text)
+}
@@ -13,8 +13,8 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/log"
 )
 
-func doMain(fn func(ctx context.Context, args ...string) error, logLevel string, args ...string) {
-	ctx := log.MakeBaseLogger(context.Background(), logLevel)
+func doMain(fn func(ctx context.Context, args ...string) error, logLevel, logFormat string, args ...string) {
+	ctx := log.MakeBaseLogger(context.Background(), logLevel, logFormat)
 
 	if err := fn(ctx, args...); err != nil {
 		dlog.Errorf(ctx, "quit: %v", err)
@@ -24,14 +24,15 @@ func doMain(fn func(ctx context.Context, args ...string) error, logLevel string,
 
 func main() {
 	level := os.Getenv("LOG_LEVEL")
+	format := os.Getenv("LOG_FORMAT")
 	if len(os.Args) > 1 {
 		switch name := os.Args[1]; name {
 		case "agent":
-			doMain(agent.Main, agent.GetLogLevel(), os.Args[2:]...)
+			doMain(agent.Main, agent.GetLogLevel(), agent.GetLogFormat(), os.Args[2:]...)
 		case "manager":
-			doMain(manager.Main, level, os.Args[2:]...)
+			doMain(manager.Main, level, format, os.Args[2:]...)
 		case "agent-init":
-			doMain(agentinit.Main, level, os.Args[2:]...)
+			doMain(agentinit.Main, level, format, os.Args[2:]...)
 		default:
 			fmt.Println("traffic: unknown command:", name)
 			os.Exit(127)
@@ -41,12 +42,12 @@ func main() {
 
 	switch name := filepath.Base(os.Args[0]); name {
 	case "traffic-agent":
-		doMain(agent.Main, agent.GetLogLevel(), os.Args[1:]...)
+		doMain(agent.Main, agent.GetLogLevel(), agent.GetLogFormat(), os.Args[1:]...)
 	case "traffic-agent-init":
-		doMain(agentinit.Main, level, os.Args[1:]...)
+		doMain(agentinit.Main, level, format, os.Args[1:]...)
 	case "traffic-manager":
 		fallthrough
 	default:
-		doMain(manager.Main, level, os.Args[1:]...)
+		doMain(manager.Main, level, format, os.Args[1:]...)
 	}
 }
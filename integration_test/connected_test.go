@@ -1,6 +1,7 @@
 package integration_test
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/stretchr/testify/suite"
@@ -26,6 +27,19 @@ func (s *connectedSuite) Test_ReportsVersionFromDaemon() {
 	s.Contains(stdout, fmt.Sprintf("User Daemon: %s", s.TelepresenceVersion()))
 }
 
+func (s *connectedSuite) Test_ReportsVersionAsJSON() {
+	stdout := itest.TelepresenceOk(s.Context(), "version", "--output", "json")
+	var vi map[string]struct {
+		Version string `json:"version"`
+		Status  string `json:"status"`
+	}
+	s.Require().NoError(json.Unmarshal([]byte(stdout), &vi))
+	for _, component := range []string{"client", "rootDaemon", "userDaemon", "trafficManager"} {
+		s.Equal("ok", vi[component].Status, component)
+		s.Equal(s.TelepresenceVersion(), vi[component].Version, component)
+	}
+}
+
 func (s *connectedSuite) Test_Status() {
 	stdout := itest.TelepresenceOk(s.Context(), "status")
 	s.Contains(stdout, "Root Daemon: Running")
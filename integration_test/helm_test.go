@@ -51,7 +51,7 @@ func (s *helmSuite) Test_HelmCannotInterceptInUnmanagedNamespace() {
 	ctx := s.Context()
 	_, stderr, err := itest.Telepresence(ctx, "intercept", "--namespace", s.appSpace2, "--mount", "false", s.ServiceName(), "--port", "9090")
 	s.Error(err)
-	s.Contains(stderr, `No interceptable deployment, replicaset, or statefulset matching echo found`)
+	s.Contains(stderr, `No interceptable deployment, replicaset, statefulset, rollout, job, or cronjob matching echo found`)
 }
 
 func (s *helmSuite) Test_HelmWebhookInjectsInManagedNamespace() {
@@ -18,6 +18,7 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/k8s"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/trafficmgr"
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/install/helm"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
 	"github.com/telepresenceio/telepresence/v2/pkg/version"
 )
@@ -45,7 +46,7 @@ func (is *installSuite) Test_FindTrafficManager_notPresent() {
 	is.Error(err, "expected find to not find traffic-manager deployment")
 }
 
-func (is *installSuite) Test_EnsureManager_updateFromLegacy() {
+func (is *installSuite) Test_HelmInstall_updateFromLegacy() {
 	require := is.Require()
 	ctx := is.Context()
 
@@ -66,7 +67,7 @@ func (is *installSuite) Test_EnsureManager_updateFromLegacy() {
 	is.findTrafficManagerPresent(ctx, is.ManagerNamespace())
 }
 
-func (is *installSuite) Test_EnsureManager_toleratesFailedInstall() {
+func (is *installSuite) Test_HelmInstall_toleratesFailedInstall() {
 	require := is.Require()
 	ctx := is.Context()
 
@@ -83,27 +84,26 @@ func (is *installSuite) Test_EnsureManager_toleratesFailedInstall() {
 			PrivateHelm: 30 * time.Second,
 		},
 	})
-	ctx, ti := is.installer(ctx)
-	require.Error(ti.EnsureManager(ctx))
+	require.Error(is.installManager(ctx, is.ManagerNamespace()))
 	restoreVersion()
 
 	var err error
 	require.Eventually(func() bool {
-		err = ti.EnsureManager(ctx)
+		err = is.installManager(ctx, is.ManagerNamespace())
 		return err == nil
 	}, 20*time.Second, 5*time.Second, "Unable to install proper manager after failed install: %v", err)
 }
 
-func (is *installSuite) Test_EnsureManager_toleratesLeftoverState() {
+func (is *installSuite) Test_HelmInstall_toleratesLeftoverState() {
 	require := is.Require()
 	ctx := is.Context()
 
-	ctx, ti := is.installer(ctx)
-	require.NoError(ti.EnsureManager(ctx))
+	ctx, _ = is.installer(ctx)
+	require.NoError(is.installManager(ctx, is.ManagerNamespace()))
 	defer is.UninstallTrafficManager(ctx, is.ManagerNamespace())
 
 	is.UninstallTrafficManager(ctx, is.ManagerNamespace())
-	require.NoError(ti.EnsureManager(ctx))
+	require.NoError(is.installManager(ctx, is.ManagerNamespace()))
 	require.Eventually(func() bool {
 		obj, err := k8sapi.GetDeployment(ctx, install.ManagerAppName, is.ManagerNamespace())
 		if err != nil {
@@ -119,16 +119,17 @@ func (is *installSuite) Test_RemoveManagerAndAgents_canUninstall() {
 	ctx := is.Context()
 	ctx, ti := is.installer(ctx)
 
-	require.NoError(ti.EnsureManager(ctx))
+	require.NoError(is.installManager(ctx, is.ManagerNamespace()))
+	require.NoError(ti.EnsureManager(ctx, nil))
 	require.NoError(ti.RemoveManagerAndAgents(ctx, false, []*manager.AgentInfo{}))
 	// We want to make sure that we can re-install the agent after it's been uninstalled,
-	// so try to ensureManager again.
-	require.NoError(ti.EnsureManager(ctx))
+	// so try to install it again.
+	require.NoError(is.installManager(ctx, is.ManagerNamespace()))
 	// Uninstall the agent one last time -- this should behave the same way as the previous uninstall
 	require.NoError(ti.RemoveManagerAndAgents(ctx, false, []*manager.AgentInfo{}))
 }
 
-func (is *installSuite) Test_EnsureManager_upgrades() {
+func (is *installSuite) Test_HelmUpgrade_upgrades() {
 	// TODO: In order to properly check that an upgrade works, we need to install
 	//  an older version first, which in turn will entail building that version
 	//  and publishing an image fore it. The way the test looks right now, it just
@@ -136,16 +137,16 @@ func (is *installSuite) Test_EnsureManager_upgrades() {
 	is.T().Skip()
 	require := is.Require()
 	ctx := is.Context()
-	ctx, ti := is.installer(ctx)
+	ctx, _ = is.installer(ctx)
 
-	require.NoError(ti.EnsureManager(ctx))
+	require.NoError(is.installManager(ctx, is.ManagerNamespace()))
 	defer is.UninstallTrafficManager(ctx, is.ManagerNamespace())
 
 	sv := version.Version
 	version.Version = "v3.0.0-bogus"
 	restoreVersion := func() { version.Version = sv }
 	defer restoreVersion()
-	require.Error(ti.EnsureManager(ctx))
+	require.Error(is.upgradeManager(ctx, is.ManagerNamespace()))
 
 	require.Eventually(func() bool {
 		obj, err := k8sapi.GetDeployment(ctx, install.ManagerAppName, is.ManagerNamespace())
@@ -157,7 +158,15 @@ func (is *installSuite) Test_EnsureManager_upgrades() {
 	}, 30*time.Second, 5*time.Second, "timeout waiting for deployment to update")
 
 	restoreVersion()
-	require.NoError(ti.EnsureManager(ctx))
+	require.NoError(is.upgradeManager(ctx, is.ManagerNamespace()))
+}
+
+func (is *installSuite) Test_EnsureManager_notInstalled() {
+	ctx := is.Context()
+	ctx, ti := is.installer(ctx)
+	err := ti.EnsureManager(ctx, nil)
+	is.Require().Error(err)
+	is.Contains(err.Error(), "telepresence helm install")
 }
 
 func (is *installSuite) Test_EnsureManager_doesNotChangeExistingHelm() {
@@ -190,7 +199,7 @@ func (is *installSuite) Test_EnsureManager_doesNotChangeExistingHelm() {
 
 	ctx, ti := is.installer(ctx)
 
-	require.NoError(ti.EnsureManager(ctx))
+	require.NoError(ti.EnsureManager(ctx, nil))
 
 	dep, err := k8sapi.GetDeployment(ctx, install.ManagerAppName, is.ManagerNamespace())
 	require.NoError(err)
@@ -212,11 +221,12 @@ func (is *installSuite) Test_findTrafficManager_differentNamespace_present() {
 }
 
 func (is *installSuite) findTrafficManagerPresent(ctx context.Context, namespace string) {
-	ctx, kc := is.cluster(ctx, namespace)
 	require := is.Require()
+	require.NoError(is.installManager(ctx, namespace))
+	ctx, kc := is.cluster(ctx, namespace)
 	ti, err := trafficmgr.NewTrafficManagerInstaller(kc)
 	require.NoError(err)
-	require.NoError(ti.EnsureManager(ctx))
+	require.NoError(ti.EnsureManager(ctx, nil))
 	require.Eventually(func() bool {
 		dep, err := k8sapi.GetDeployment(ctx, install.ManagerAppName, namespace)
 		if err != nil {
@@ -248,3 +258,13 @@ func (is *installSuite) installer(ctx context.Context) (context.Context, traffic
 	is.Require().NoError(err)
 	return ctx, ti
 }
+
+func (is *installSuite) installManager(ctx context.Context, managerNamespace string) error {
+	ctx, kc := is.cluster(ctx, managerNamespace)
+	return helm.InstallTrafficManager(ctx, kc.ConfigFlags, managerNamespace, &helm.Request{})
+}
+
+func (is *installSuite) upgradeManager(ctx context.Context, managerNamespace string) error {
+	ctx, kc := is.cluster(ctx, managerNamespace)
+	return helm.UpgradeTrafficManager(ctx, kc.ConfigFlags, managerNamespace, &helm.Request{})
+}
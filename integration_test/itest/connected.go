@@ -24,7 +24,8 @@ func WithConnection(np NamespacePair, f func(ctx context.Context, ch NamespacePa
 
 func (ch *connected) setup(ctx context.Context) bool {
 	t := getT(ctx)
-	// Start once with default user to ensure that the auto-installer can run OK.
+	// Install the traffic-manager and connect once with default user to ensure that the installer can run OK.
+	TelepresenceOk(WithUser(ctx, "default"), "helm", "install")
 	stdout := TelepresenceOk(WithUser(ctx, "default"), "connect")
 	require.Contains(t, stdout, "Connected to context default")
 	TelepresenceQuitOk(ctx)
@@ -14,6 +14,9 @@ func (s *notConnectedSuite) Test_Uninstall() {
 	ctx := itest.WithUser(s.Context(), "default")
 	itest.TelepresenceOk(ctx, "connect")
 
+	// Restore the traffic-manager for the tests that follow
+	defer itest.TelepresenceOk(ctx, "helm", "install")
+
 	names := func() (string, error) {
 		return itest.KubectlOut(ctx, s.ManagerNamespace(),
 			"get", "svc,deploy", "traffic-manager",
@@ -35,6 +38,14 @@ func (s *notConnectedSuite) Test_Uninstall() {
 	stdout = itest.TelepresenceOk(ctx, "list", "--namespace", s.AppNamespace(), "--agents")
 	require.Contains(stdout, jobname+": ready to intercept (traffic-agent already installed)")
 
+	// A dry run lists what would be removed but leaves everything in place
+	stdout = itest.TelepresenceOk(ctx, "uninstall", "--everything", "--dry-run")
+	require.Contains(stdout, "Restart Deployment "+jobname+"."+s.AppNamespace())
+	require.Contains(stdout, "Remove Deployment traffic-manager."+s.ManagerNamespace())
+	stdout, err = names()
+	require.NoError(err)
+	require.Equal(2, len(strings.Split(stdout, " ")), "the dry run removed the traffic-manager")
+
 	// The telepresence-test-developer will not be able to uninstall everything
 	stdout = itest.TelepresenceOk(ctx, "uninstall", "--everything")
 	itest.AssertQuitOutput(ctx, stdout)
@@ -49,6 +49,7 @@ func (s *notConnectedSuite) Test_WebhookAgentImageFromConfig() {
 	// Restore the traffic-manager at the end of this function
 	ctx := itest.WithUser(s.Context(), "default")
 	defer func() {
+		itest.TelepresenceOk(ctx, "helm", "install")
 		itest.TelepresenceOk(ctx, "connect")
 		itest.TelepresenceDisconnectOk(ctx)
 	}()
@@ -80,6 +81,7 @@ func (s *notConnectedSuite) Test_WebhookAgentImageFromConfig() {
 	uninstallEverything()
 
 	// And reinstall it
+	itest.TelepresenceOk(ctxAI, "helm", "install")
 	itest.TelepresenceOk(ctxAI, "connect")
 
 	// When this function ends we uninstall the manager
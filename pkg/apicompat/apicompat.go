@@ -0,0 +1,240 @@
+// Package apicompat computes the public surface of the Telepresence gRPC APIs and verifies that
+// changes to it are backward compatible.
+//
+// The surface of an API is a sorted list of elements, one for each service method, message field,
+// and enum value. Each element has a key that identifies it (e.g. the message name and field
+// number) and a signature that describes it (e.g. the field name and type). A change is backward
+// compatible as long as no element is removed and no element changes its signature. Elements that
+// are marked as deprecated in the .proto file may be removed, but only after having been released
+// as deprecated for at least DeprecationWindow minor releases. The golden file records the release
+// in which each element was deprecated.
+package apicompat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// DeprecationWindow is the number of minor releases that a deprecated element must be released in
+// before it can be removed.
+const DeprecationWindow = 1
+
+// Element is one element of an API surface.
+type Element struct {
+	Key        string
+	Signature  string
+	Deprecated bool
+
+	// DeprecatedIn is the "major.minor" release in which a deprecated element was deprecated.
+	DeprecatedIn string
+}
+
+const deprecatedPrefix = " [deprecated in "
+
+func (e *Element) String() string {
+	s := e.Key + " = " + e.Signature
+	if e.Deprecated {
+		s += deprecatedPrefix + e.DeprecatedIn + "]"
+	}
+	return s
+}
+
+// Surface is a list of elements sorted by key.
+type Surface []*Element
+
+// SurfaceOf returns the surface of all services, messages, and enums declared in the given file.
+func SurfaceOf(fd protoreflect.FileDescriptor) Surface {
+	var s Surface
+	svcs := fd.Services()
+	for i := 0; i < svcs.Len(); i++ {
+		svc := svcs.Get(i)
+		methods := svc.Methods()
+		for j := 0; j < methods.Len(); j++ {
+			m := methods.Get(j)
+			sig := fmt.Sprintf("(%s%s) returns (%s%s)",
+				streamPrefix(m.IsStreamingClient()), m.Input().FullName(),
+				streamPrefix(m.IsStreamingServer()), m.Output().FullName())
+			s = append(s, &Element{
+				Key:        fmt.Sprintf("rpc %s.%s", svc.FullName(), m.Name()),
+				Signature:  sig,
+				Deprecated: m.Options().(*descriptorpb.MethodOptions).GetDeprecated(),
+			})
+		}
+	}
+	s = appendMessages(s, fd.Messages())
+	s = appendEnums(s, fd.Enums())
+	sort.Slice(s, func(i, j int) bool { return s[i].Key < s[j].Key })
+	return s
+}
+
+func streamPrefix(streaming bool) string {
+	if streaming {
+		return "stream "
+	}
+	return ""
+}
+
+func appendMessages(s Surface, msgs protoreflect.MessageDescriptors) Surface {
+	for i := 0; i < msgs.Len(); i++ {
+		msg := msgs.Get(i)
+		if msg.IsMapEntry() {
+			continue
+		}
+		fields := msg.Fields()
+		for j := 0; j < fields.Len(); j++ {
+			f := fields.Get(j)
+			s = append(s, &Element{
+				Key:        fmt.Sprintf("field %s#%d", msg.FullName(), f.Number()),
+				Signature:  fmt.Sprintf("%s %s", f.Name(), fieldType(f)),
+				Deprecated: f.Options().(*descriptorpb.FieldOptions).GetDeprecated(),
+			})
+		}
+		s = appendMessages(s, msg.Messages())
+		s = appendEnums(s, msg.Enums())
+	}
+	return s
+}
+
+func appendEnums(s Surface, enums protoreflect.EnumDescriptors) Surface {
+	for i := 0; i < enums.Len(); i++ {
+		enum := enums.Get(i)
+		values := enum.Values()
+		for j := 0; j < values.Len(); j++ {
+			v := values.Get(j)
+			s = append(s, &Element{
+				Key:        fmt.Sprintf("enum %s#%d", enum.FullName(), v.Number()),
+				Signature:  string(v.Name()),
+				Deprecated: v.Options().(*descriptorpb.EnumValueOptions).GetDeprecated(),
+			})
+		}
+	}
+	return s
+}
+
+func fieldType(f protoreflect.FieldDescriptor) string {
+	if f.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", fieldType(f.MapKey()), fieldType(f.MapValue()))
+	}
+	var t string
+	switch f.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		t = string(f.Message().FullName())
+	case protoreflect.EnumKind:
+		t = string(f.Enum().FullName())
+	default:
+		t = f.Kind().String()
+	}
+	if f.IsList() {
+		t = "repeated " + t
+	}
+	return t
+}
+
+// Write writes the surface in the golden file format, one element per line.
+func (s Surface) Write(w io.Writer) error {
+	for _, e := range s {
+		if _, err := fmt.Fprintln(w, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read reads a surface that was written using Write.
+func Read(r io.Reader) (Surface, error) {
+	var s Surface
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		eq := strings.Index(line, " = ")
+		if eq < 0 {
+			return nil, fmt.Errorf("malformed line %q", line)
+		}
+		e := &Element{Key: line[:eq], Signature: line[eq+3:]}
+		if dp := strings.LastIndex(e.Signature, deprecatedPrefix); dp >= 0 && strings.HasSuffix(e.Signature, "]") {
+			e.DeprecatedIn = e.Signature[dp+len(deprecatedPrefix) : len(e.Signature)-1]
+			if _, err := parseRelease(e.DeprecatedIn); err != nil {
+				return nil, fmt.Errorf("malformed line %q: %w", line, err)
+			}
+			e.Signature = e.Signature[:dp]
+			e.Deprecated = true
+		}
+		s = append(s, e)
+	}
+	return s, sc.Err()
+}
+
+// RecordDeprecations sets the release in which each deprecated element of the current surface was
+// deprecated. That's the release recorded in the released surface for elements that were already
+// deprecated there, and the given "major.minor" release for the others.
+func (s Surface) RecordDeprecations(released Surface, release string) {
+	rm := released.byKey()
+	for _, e := range s {
+		switch {
+		case !e.Deprecated:
+			e.DeprecatedIn = ""
+		case rm[e.Key] != nil && rm[e.Key].Deprecated:
+			e.DeprecatedIn = rm[e.Key].DeprecatedIn
+		default:
+			e.DeprecatedIn = release
+		}
+	}
+}
+
+func (s Surface) byKey() map[string]*Element {
+	m := make(map[string]*Element, len(s))
+	for _, e := range s {
+		m[e.Key] = e
+	}
+	return m
+}
+
+// parseRelease parses a "major.minor" release.
+func parseRelease(release string) (semver.Version, error) {
+	v, err := semver.ParseTolerant(release)
+	if err != nil {
+		return v, fmt.Errorf("invalid release %q: %w", release, err)
+	}
+	return v, nil
+}
+
+// Incompatibilities returns a description of each change from the released surface to the current
+// surface that isn't backward compatible, given the "major.minor" release that the current surface
+// belongs to. Removal of an element is allowed when the released element was deprecated at least
+// DeprecationWindow minor releases before the current release.
+func Incompatibilities(released, current Surface, release string) []string {
+	rv, err := parseRelease(release)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	cm := current.byKey()
+	var problems []string
+	for _, re := range released {
+		ce, ok := cm[re.Key]
+		switch {
+		case !ok && !re.Deprecated:
+			problems = append(problems, fmt.Sprintf("%s was removed without first being deprecated", re.Key))
+		case !ok:
+			dv, err := parseRelease(re.DeprecatedIn)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", re.Key, err))
+			} else if dv.Major == rv.Major && rv.Minor < dv.Minor+DeprecationWindow {
+				problems = append(problems, fmt.Sprintf("%s was deprecated in %s and can't be removed before %d.%d",
+					re.Key, re.DeprecatedIn, dv.Major, dv.Minor+DeprecationWindow))
+			}
+		case ce.Signature != re.Signature:
+			problems = append(problems, fmt.Sprintf("%s changed from %q to %q", re.Key, re.Signature, ce.Signature))
+		}
+	}
+	return problems
+}
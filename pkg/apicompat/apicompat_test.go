@@ -0,0 +1,142 @@
+package apicompat
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/common"
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/connector/v2alpha"
+	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	managerv2 "github.com/telepresenceio/telepresence/rpc/v2/manager/v2"
+)
+
+// publicAPIs are the APIs that external integrators may depend on. The versioned services only declare
+// methods. Their messages are declared, and guarded, by the unversioned APIs.
+var publicAPIs = map[string]protoreflect.FileDescriptor{
+	"common":            common.File_rpc_common_version_proto,
+	"connector":         connector.File_rpc_connector_connector_proto,
+	"connector.v2alpha": v2alpha.File_rpc_connector_v2alpha_connector_proto,
+	"daemon":            daemon.File_rpc_daemon_daemon_proto,
+	"manager":           manager.File_rpc_manager_manager_proto,
+	"manager.v2":        managerv2.File_rpc_manager_v2_manager_proto,
+}
+
+// currentRelease returns the "major.minor" release that is being developed, i.e. the one of the
+// topmost release heading in the CHANGELOG.
+func currentRelease(t *testing.T) string {
+	f, err := os.Open(filepath.Join("..", "..", "CHANGELOG.md"))
+	require.NoError(t, err)
+	defer f.Close()
+	rx := regexp.MustCompile(`^### (\d+\.\d+)\.\d+`)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if m := rx.FindStringSubmatch(sc.Text()); m != nil {
+			return m[1]
+		}
+	}
+	require.NoError(t, sc.Err())
+	t.Fatal("no release heading found in CHANGELOG.md")
+	return ""
+}
+
+func TestCompatibility(t *testing.T) {
+	release := currentRelease(t)
+	for name, fd := range publicAPIs {
+		name, fd := name, fd
+		t.Run(name, func(t *testing.T) {
+			goldenFile := filepath.Join("testdata", name+".golden")
+			f, err := os.Open(goldenFile)
+			require.NoError(t, err)
+			released, err := Read(f)
+			_ = f.Close()
+			require.NoError(t, err)
+
+			current := SurfaceOf(fd)
+			current.RecordDeprecations(released, release)
+			if problems := Incompatibilities(released, current, release); len(problems) > 0 {
+				t.Fatalf("incompatible changes to the %s API:\n  %s", name, strings.Join(problems, "\n  "))
+			}
+
+			buf := bytes.Buffer{}
+			require.NoError(t, current.Write(&buf))
+			if os.Getenv("DEV_TELEPRESENCE_GENERATE_GOLD") != "" {
+				require.NoError(t, os.WriteFile(goldenFile, buf.Bytes(), 0644))
+				return
+			}
+			wbuf := bytes.Buffer{}
+			require.NoError(t, released.Write(&wbuf))
+			assert.Equal(t, wbuf.String(), buf.String(), "compatible changes were made to the %s API. Run the test with DEV_TELEPRESENCE_GENERATE_GOLD=y to update %s", name, goldenFile)
+		})
+	}
+}
+
+func TestIncompatibilities(t *testing.T) {
+	released := Surface{
+		{Key: "field a.B#1", Signature: "name string"},
+		{Key: "field a.B#2", Signature: "old string", Deprecated: true, DeprecatedIn: "2.5"},
+		{Key: "rpc a.S.M", Signature: "(a.B) returns (a.B)"},
+	}
+	assert.Empty(t, Incompatibilities(released, released, "2.5"))
+
+	// Removing a deprecated element after the deprecation window and adding new elements is OK
+	current := Surface{
+		{Key: "field a.B#1", Signature: "name string"},
+		{Key: "field a.B#3", Signature: "new string"},
+		{Key: "rpc a.S.M", Signature: "(a.B) returns (a.B)"},
+	}
+	assert.Empty(t, Incompatibilities(released, current, "2.6"))
+	assert.Empty(t, Incompatibilities(released, current, "3.0"))
+
+	// Removing it in the release that deprecated it is not
+	problems := Incompatibilities(released, current, "2.5")
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "can't be removed before 2.6")
+
+	// Removing a non-deprecated element, or changing a signature, is not
+	current = Surface{
+		{Key: "field a.B#1", Signature: "name int32"},
+	}
+	assert.Len(t, Incompatibilities(released, current, "2.6"), 2)
+}
+
+func TestSurface_RecordDeprecations(t *testing.T) {
+	released := Surface{
+		{Key: "field a.B#1", Signature: "name string"},
+		{Key: "field a.B#2", Signature: "old string", Deprecated: true, DeprecatedIn: "2.4"},
+		{Key: "field a.B#3", Signature: "back string", Deprecated: true, DeprecatedIn: "2.4"},
+	}
+	current := Surface{
+		{Key: "field a.B#1", Signature: "name string", Deprecated: true},
+		{Key: "field a.B#2", Signature: "old string", Deprecated: true},
+		{Key: "field a.B#3", Signature: "back string"},
+	}
+	current.RecordDeprecations(released, "2.5")
+	assert.Equal(t, "2.5", current[0].DeprecatedIn, "newly deprecated in the current release")
+	assert.Equal(t, "2.4", current[1].DeprecatedIn, "the deprecation release is kept")
+	assert.Equal(t, "", current[2].DeprecatedIn)
+
+	// Deprecating an element and removing it in the same release is caught, because the deprecation
+	// is recorded in the current release.
+	assert.NotEmpty(t, Incompatibilities(Surface{current[0]}, nil, "2.5"))
+}
+
+func TestReadWrite(t *testing.T) {
+	s := SurfaceOf(connector.File_rpc_connector_connector_proto)
+	s = append(s, &Element{Key: "field a.B#2", Signature: "old string", Deprecated: true, DeprecatedIn: "2.5"})
+	buf := bytes.Buffer{}
+	require.NoError(t, s.Write(&buf))
+	r, err := Read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, s, r)
+}
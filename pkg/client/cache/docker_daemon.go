@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"os"
+)
+
+const dockerDaemonFile = "docker-daemon.json"
+
+// DockerDaemon describes the container that runs the daemons when Telepresence is connected using
+// "telepresence connect --docker".
+type DockerDaemon struct {
+	// Container is the name of the container
+	Container string `json:"container"`
+
+	// ConnectorAddress is the host address where the connector's gRPC API is published
+	ConnectorAddress string `json:"connectorAddress"`
+
+	// DaemonAddress is the host address where the root daemon's gRPC API is published
+	DaemonAddress string `json:"daemonAddress"`
+
+	// Token is the secret that clients send to the published ports before the gRPC traffic starts
+	Token string `json:"token"`
+}
+
+// SaveDockerDaemonToUserCache saves the provided daemon container to user cache and returns an error if
+// something goes wrong while marshalling or persisting. The file is encrypted because it contains the token.
+func SaveDockerDaemonToUserCache(ctx context.Context, dd *DockerDaemon) error {
+	return SaveSecretToUserCache(ctx, dd, dockerDaemonFile)
+}
+
+// LoadDockerDaemonFromUserCache gets the daemon container from cache. A nil value is returned if the
+// file does not exist. An error is returned if something goes wrong while loading or unmarshalling.
+func LoadDockerDaemonFromUserCache(ctx context.Context) (*DockerDaemon, error) {
+	var dd DockerDaemon
+	err := LoadSecretFromUserCache(ctx, &dd, dockerDaemonFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &dd, nil
+}
+
+// DeleteDockerDaemonFromUserCache removes the daemon container cache if exists or returns an error. An attempt
+// to remove a non existing cache is a no-op and the function returns nil.
+func DeleteDockerDaemonFromUserCache(ctx context.Context) error {
+	return DeleteFromUserCache(ctx, dockerDaemonFile)
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/keychain"
+	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+)
+
+const (
+	keychainService = "telepresence"
+	keychainAccount = "user-cache-key"
+)
+
+// encryptedPrefix starts the content of all encrypted cache files. It is followed by the nonce and the
+// AES-256-GCM sealed JSON.
+var encryptedPrefix = []byte("telepresence-encrypted-v1\n")
+
+var (
+	userCacheKeysMu sync.Mutex
+	userCacheKeys   = make(map[keychain.Keychain][]byte)
+	unavailable     = make(map[keychain.Keychain]error)
+	plaintextWarned sync.Once
+)
+
+// userCacheKey returns the key that encrypts secrets in the user cache. The key is kept in the keychain of
+// the operating system and is created there on first use when create is true.
+func userCacheKey(ctx context.Context, create bool) ([]byte, error) {
+	kc := keychain.Get(ctx)
+	userCacheKeysMu.Lock()
+	defer userCacheKeysMu.Unlock()
+	if key, ok := userCacheKeys[kc]; ok {
+		return key, nil
+	}
+	if err, ok := unavailable[kc]; ok {
+		return nil, err
+	}
+	var key []byte
+	encKey, err := kc.Get(ctx, keychainService, keychainAccount)
+	switch {
+	case err == nil:
+		if key, err = base64.StdEncoding.DecodeString(encKey); err == nil && len(key) != 32 {
+			err = fmt.Errorf("the %s key in the keychain has an invalid length", keychainAccount)
+		}
+	case create && errors.Is(err, keychain.ErrNotFound):
+		key = make([]byte, 32)
+		if _, err = rand.Read(key); err == nil {
+			err = kc.Set(ctx, keychainService, keychainAccount, base64.StdEncoding.EncodeToString(key))
+		}
+	}
+	if err != nil {
+		// Don't retry a keychain that isn't there on each save.
+		if errors.Is(err, keychain.ErrUnavailable) {
+			unavailable[kc] = err
+		}
+		return nil, err
+	}
+	userCacheKeys[kc] = key
+	return key, nil
+}
+
+// UserCacheKeyName is the name, i.e. the service and account, of the keychain entry that holds the key that
+// encrypts secrets in the user cache.
+const UserCacheKeyName = keychainService + "/" + keychainAccount
+
+// HasUserCacheKey returns true if the keychain holds the key that encrypts secrets in the user cache. A
+// keychain that can't be used holds no key.
+func HasUserCacheKey(ctx context.Context) (bool, error) {
+	_, err := keychain.Get(ctx).Get(ctx, keychainService, keychainAccount)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, keychain.ErrNotFound), errors.Is(err, keychain.ErrUnavailable):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// DeleteUserCacheKey removes the key that encrypts secrets in the user cache from the keychain. Files that were
+// encrypted using the key can't be decrypted afterwards.
+func DeleteUserCacheKey(ctx context.Context) error {
+	kc := keychain.Get(ctx)
+	if err := kc.Delete(ctx, keychainService, keychainAccount); err != nil {
+		return err
+	}
+	userCacheKeysMu.Lock()
+	delete(userCacheKeys, kc)
+	userCacheKeysMu.Unlock()
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encrypt(key, plaintext []byte, file string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(append([]byte{}, encryptedPrefix...), nonce...)
+	// The file name is authenticated so that the content of one file can't be passed off as another.
+	return gcm.Seal(out, nonce, plaintext, []byte(file)), nil
+}
+
+func decrypt(key, content []byte, file string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	content = content[len(encryptedPrefix):]
+	if len(content) < gcm.NonceSize() {
+		return nil, errors.New("encrypted content is truncated")
+	}
+	return gcm.Open(nil, content[:gcm.NonceSize()], content[gcm.NonceSize():], []byte(file))
+}
+
+// SaveSecretToUserCache is like SaveToUserCache but encrypts the content using a key that is kept in the
+// keychain of the operating system, so that the file is useless in a copy of the user's home directory. The
+// file is saved unencrypted when no keychain is available.
+func SaveSecretToUserCache(ctx context.Context, object interface{}, file string) error {
+	content, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	if key, err := userCacheKey(ctx, true); err == nil {
+		if content, err = encrypt(key, content, file); err != nil {
+			return err
+		}
+	} else {
+		plaintextWarned.Do(func() {
+			dlog.Warnf(ctx, "credentials in the user cache are not encrypted because the keychain can't be used: %v", err)
+		})
+	}
+	dir, err := ensureCacheDir(ctx)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, file), content, 0600)
+}
+
+// LoadSecretFromUserCache loads a file that was saved using SaveSecretToUserCache. A file that was saved
+// unencrypted, e.g. by an older version of Telepresence, is encrypted in place when a keychain is available.
+//
+// A file that can't be decrypted, because its key is no longer in the keychain, is reported as not existing
+// so that callers treat it as they would a missing file. The user will then have to log in again.
+func LoadSecretFromUserCache(ctx context.Context, dest interface{}, file string) error {
+	dir, err := filelocation.AppUserCacheDir(ctx)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, file)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(content, encryptedPrefix) {
+		if err = json.Unmarshal(content, dest); err != nil {
+			return err
+		}
+		if _, err = userCacheKey(ctx, true); err == nil {
+			if err = SaveSecretToUserCache(ctx, dest, file); err != nil {
+				dlog.Warnf(ctx, "unable to encrypt %s: %v", path, err)
+			}
+		}
+		return nil
+	}
+	key, err := userCacheKey(ctx, false)
+	if err == nil {
+		content, err = decrypt(key, content, file)
+	}
+	if err != nil {
+		dlog.Warnf(ctx, "unable to decrypt %s: %v", path, err)
+		return &os.PathError{Op: "decrypt", Path: path, Err: os.ErrNotExist}
+	}
+	return json.Unmarshal(content, dest)
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/keychain"
+	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+)
+
+type unavailableKeychain struct{}
+
+func (unavailableKeychain) Get(context.Context, string, string) (string, error) {
+	return "", keychain.ErrUnavailable
+}
+
+func (unavailableKeychain) Set(context.Context, string, string, string) error {
+	return keychain.ErrUnavailable
+}
+
+func (unavailableKeychain) Delete(context.Context, string, string) error {
+	return keychain.ErrUnavailable
+}
+
+type secretData struct {
+	Token string `json:"token"`
+}
+
+func TestSecretUserCache(t *testing.T) {
+	newContext := func(t *testing.T, kc keychain.Keychain) (context.Context, string) {
+		ctx := filelocation.WithUserHomeDir(dlog.NewTestContext(t, false), t.TempDir())
+		ctx = filelocation.WithGOOS(ctx, "linux")
+		dir, err := filelocation.AppUserCacheDir(ctx)
+		require.NoError(t, err)
+		return keychain.WithKeychain(ctx, kc), dir
+	}
+	readFile := func(t *testing.T, path string) []byte {
+		t.Helper()
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return content
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		ctx, dir := newContext(t, &keychain.InMemory{})
+		require.NoError(t, SaveSecretToUserCache(ctx, &secretData{Token: "s3cr3t"}, "secret.json"))
+		content := readFile(t, filepath.Join(dir, "secret.json"))
+		assert.True(t, bytes.HasPrefix(content, encryptedPrefix))
+		assert.NotContains(t, string(content), "s3cr3t")
+
+		var sd secretData
+		require.NoError(t, LoadSecretFromUserCache(ctx, &sd, "secret.json"))
+		assert.Equal(t, "s3cr3t", sd.Token)
+
+		// The content is bound to the file name
+		require.NoError(t, os.Rename(filepath.Join(dir, "secret.json"), filepath.Join(dir, "other.json")))
+		err := LoadSecretFromUserCache(ctx, &sd, "other.json")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("migrates plaintext", func(t *testing.T) {
+		ctx, dir := newContext(t, &keychain.InMemory{})
+		require.NoError(t, SaveToUserCache(ctx, &secretData{Token: "s3cr3t"}, "secret.json"))
+		assert.False(t, bytes.HasPrefix(readFile(t, filepath.Join(dir, "secret.json")), encryptedPrefix))
+
+		var sd secretData
+		require.NoError(t, LoadSecretFromUserCache(ctx, &sd, "secret.json"))
+		assert.Equal(t, "s3cr3t", sd.Token)
+		assert.True(t, bytes.HasPrefix(readFile(t, filepath.Join(dir, "secret.json")), encryptedPrefix))
+	})
+
+	t.Run("key lost", func(t *testing.T) {
+		kc := &keychain.InMemory{}
+		ctx, _ := newContext(t, kc)
+		require.NoError(t, SaveSecretToUserCache(ctx, &secretData{Token: "s3cr3t"}, "secret.json"))
+
+		// A new keychain doesn't have the key
+		ctx = keychain.WithKeychain(ctx, &keychain.InMemory{})
+		var sd secretData
+		err := LoadSecretFromUserCache(ctx, &sd, "secret.json")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("no keychain", func(t *testing.T) {
+		ctx, dir := newContext(t, unavailableKeychain{})
+		require.NoError(t, SaveSecretToUserCache(ctx, &secretData{Token: "s3cr3t"}, "secret.json"))
+		assert.False(t, bytes.HasPrefix(readFile(t, filepath.Join(dir, "secret.json")), encryptedPrefix))
+
+		var sd secretData
+		require.NoError(t, LoadSecretFromUserCache(ctx, &sd, "secret.json"))
+		assert.Equal(t, "s3cr3t", sd.Token)
+	})
+}
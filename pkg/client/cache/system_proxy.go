@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"context"
+	"os"
+)
+
+const systemProxyFile = "system-proxy.json"
+
+// AutoProxy is the proxy auto-config setting of a network service, or of the current user on Windows, where
+// the service is empty.
+type AutoProxy struct {
+	Service string `json:"service,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+// SystemProxy holds the proxy auto-config settings that the system proxy had before Telepresence changed them.
+type SystemProxy struct {
+	AutoProxies []AutoProxy `json:"autoProxies"`
+}
+
+// SaveSystemProxyToUserCache saves the provided system proxy settings to user cache and returns an error if
+// something goes wrong while marshalling or persisting.
+func SaveSystemProxyToUserCache(ctx context.Context, sp *SystemProxy) error {
+	return SaveToUserCache(ctx, sp, systemProxyFile)
+}
+
+// LoadSystemProxyFromUserCache gets the system proxy settings from cache. A nil value is returned if the
+// file does not exist. An error is returned if something goes wrong while loading or unmarshalling.
+func LoadSystemProxyFromUserCache(ctx context.Context) (*SystemProxy, error) {
+	var sp SystemProxy
+	err := LoadFromUserCache(ctx, &sp, systemProxyFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &sp, nil
+}
+
+// DeleteSystemProxyFromUserCache removes the system proxy settings cache if exists or returns an error. An
+// attempt to remove a non existing cache is a no-op and the function returns nil.
+func DeleteSystemProxyFromUserCache(ctx context.Context) error {
+	return DeleteFromUserCache(ctx, systemProxyFile)
+}
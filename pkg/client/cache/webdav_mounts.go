@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"context"
+	"os"
+)
+
+const webdavMountsFile = "webdav-mounts.json"
+
+// SaveWebDAVMountsToUserCache saves the provided WebDAV mounts, a map of URLs keyed by mount point, to user
+// cache and returns an error if something goes wrong while marshalling or persisting.
+func SaveWebDAVMountsToUserCache(ctx context.Context, mounts map[string]string) error {
+	if len(mounts) == 0 {
+		return DeleteWebDAVMountsFromUserCache(ctx)
+	}
+	return SaveToUserCache(ctx, mounts, webdavMountsFile)
+}
+
+// LoadWebDAVMountsFromUserCache gets the WebDAV mounts from cache. An empty map is returned if the
+// file does not exist. An error is returned if something goes wrong while loading or unmarshalling.
+func LoadWebDAVMountsFromUserCache(ctx context.Context) (map[string]string, error) {
+	var mounts map[string]string
+	err := LoadFromUserCache(ctx, &mounts, webdavMountsFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		return make(map[string]string), nil
+	}
+	return mounts, nil
+}
+
+// DeleteWebDAVMountsFromUserCache removes the WebDAV mounts cache if exists or returns an error. An attempt
+// to remove a non existing cache is a no-op and the function returns nil.
+func DeleteWebDAVMountsFromUserCache(ctx context.Context) error {
+	return DeleteFromUserCache(ctx, webdavMountsFile)
+}
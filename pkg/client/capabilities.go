@@ -0,0 +1,71 @@
+package client
+
+// Capabilities of the connector API that were added after api_version 3 was introduced. The connector reports them in
+// the VersionInfo that it returns from its Version call, so that IDE plugins and other integrations can check that a
+// feature is supported instead of comparing version numbers. A capability is never removed without first having
+// been released as deprecated.
+const (
+	// CapabilityProxyOnly means that ConnectRequest.proxy_address is supported.
+	CapabilityProxyOnly = "proxy-only"
+
+	// CapabilitySetMappedNamespaces means that the SetMappedNamespaces call is supported.
+	CapabilitySetMappedNamespaces = "set-mapped-namespaces"
+
+	// CapabilityListFilters means that ListRequest.kinds and label_selector are supported.
+	CapabilityListFilters = "list-filters"
+
+	// CapabilityWorkloadSelector means that CreateInterceptRequest.workload_selector is supported.
+	CapabilityWorkloadSelector = "workload-selector"
+
+	// CapabilityIdempotentIntercepts means that CreateInterceptRequest.idempotency_key is supported.
+	CapabilityIdempotentIntercepts = "idempotent-intercepts"
+
+	// CapabilityEncryptedIntercepts means that CreateInterceptRequest.encrypt is supported.
+	CapabilityEncryptedIntercepts = "encrypted-intercepts"
+
+	// CapabilityRemoveAllIntercepts means that the RemoveAllIntercepts call is supported.
+	CapabilityRemoveAllIntercepts = "remove-all-intercepts"
+
+	// CapabilityInterceptStats means that InterceptInfo.stats is populated.
+	CapabilityInterceptStats = "intercept-stats"
+
+	// CapabilityLoopbackForwards means that ConnectInfo.port_forward_fallback and loopback_forwards are populated.
+	CapabilityLoopbackForwards = "loopback-forwards"
+
+	// CapabilityProgress means that the ConnectWithProgress and CreateInterceptWithProgress calls are supported.
+	CapabilityProgress = "progress"
+
+	// CapabilityMirroredIntercepts means that InterceptSpec.mirror is supported.
+	CapabilityMirroredIntercepts = "mirrored-intercepts"
+
+	// CapabilityTrafficPercentage means that InterceptSpec.traffic_percentage is supported.
+	CapabilityTrafficPercentage = "traffic-percentage"
+)
+
+// Capabilities returns the capabilities of the connector API.
+func Capabilities() []string {
+	return []string{
+		CapabilityProxyOnly,
+		CapabilitySetMappedNamespaces,
+		CapabilityListFilters,
+		CapabilityWorkloadSelector,
+		CapabilityIdempotentIntercepts,
+		CapabilityEncryptedIntercepts,
+		CapabilityRemoveAllIntercepts,
+		CapabilityInterceptStats,
+		CapabilityLoopbackForwards,
+		CapabilityProgress,
+		CapabilityMirroredIntercepts,
+		CapabilityTrafficPercentage,
+	}
+}
+
+// HasCapability returns true if the given capabilities, as reported by a daemon, include the given capability.
+func HasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
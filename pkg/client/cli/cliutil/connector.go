@@ -19,6 +19,8 @@ import (
 	"github.com/datawire/dlib/dgroup"
 	"github.com/telepresenceio/telepresence/rpc/v2/connector"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/docker"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/proc"
 )
 
@@ -45,6 +47,32 @@ func WithStartedConnector(ctx context.Context, withNotify bool, fn func(context.
 
 type connectorConnCtxKey struct{}
 
+// launchConnector starts the connector and waits for its socket to appear. Nothing is started if
+// another command started the connector while this one was waiting for the start lock, and false
+// is returned.
+func launchConnector() (bool, error) {
+	if running, err := client.SocketExists(client.ConnectorSocketName); err != nil || running {
+		return false, err
+	}
+	fmt.Fprintln(infoOutput, "Launching Telepresence User Daemon")
+	if err := proc.StartInBackground(client.GetExe(), "connector-foreground"); err != nil {
+		return false, errcat.Daemon.Newf("failed to launch the connector service: %w", err)
+	}
+	if err := client.WaitUntilSocketAppears("connector", client.ConnectorSocketName, 10*time.Second); err != nil {
+		return false, errcat.Daemon.Newf("connector service did not start: %w", err)
+	}
+	return true, nil
+}
+
+// dialConnector dials the connector of the daemon container when one is running, and the connector
+// socket otherwise.
+func dialConnector(ctx context.Context) (*grpc.ClientConn, error) {
+	if dd := docker.RunningDaemon(ctx); dd != nil {
+		return docker.Dial(ctx, dd.ConnectorAddress, dd.Token)
+	}
+	return client.DialSocket(ctx, client.ConnectorSocketName)
+}
+
 func withConnector(ctx context.Context, maybeStart bool, withNotify bool, fn func(context.Context, connector.ConnectorClient) error) error {
 	if untyped := ctx.Value(connectorConnCtxKey{}); untyped != nil {
 		conn := untyped.(*grpc.ClientConn)
@@ -56,28 +84,25 @@ func withConnector(ctx context.Context, maybeStart bool, withNotify bool, fn fun
 	started := false
 	for {
 		var err error
-		conn, err = client.DialSocket(ctx, client.ConnectorSocketName)
+		conn, err = dialConnector(ctx)
 		if err == nil {
 			break
 		}
 		if errors.Is(err, os.ErrNotExist) {
 			err = ErrNoUserDaemon
 			if maybeStart {
-				fmt.Println("Launching Telepresence User Daemon")
-				if err = proc.StartInBackground(client.GetExe(), "connector-foreground"); err != nil {
-					return fmt.Errorf("failed to launch the connector service: %w", err)
+				if err = client.WithStartLock(ctx, "connector", func() (err error) {
+					started, err = launchConnector()
+					return err
+				}); err != nil {
+					return err
 				}
-
-				if err = client.WaitUntilSocketAppears("connector", client.ConnectorSocketName, 10*time.Second); err != nil {
-					return fmt.Errorf("connector service did not start: %w", err)
-				}
-
 				maybeStart = false
-				started = true
 				continue
 			}
+			return err
 		}
-		return err
+		return errcat.Daemon.New(err)
 	}
 	defer conn.Close()
 	ctx = context.WithValue(ctx, connectorConnCtxKey{}, conn)
@@ -113,7 +138,7 @@ func withConnector(ctx context.Context, maybeStart bool, withNotify bool, fn fun
 				}
 				return err
 			}
-			fmt.Println(strings.TrimRight(msg.Message, "\n"))
+			fmt.Fprintln(infoOutput, strings.TrimRight(msg.Message, "\n"))
 		}
 	})
 	grp.Go("main", func(ctx context.Context) error {
@@ -124,15 +149,15 @@ func withConnector(ctx context.Context, maybeStart bool, withNotify bool, fn fun
 }
 
 func UserDaemonDisconnect(ctx context.Context, quitUserDaemon bool) error {
-	fmt.Print("Telepresence Traffic Manager ")
+	fmt.Fprint(infoOutput, "Telepresence Traffic Manager ")
 	err := WithStartedConnector(ctx, false, func(ctx context.Context, connectorClient connector.ConnectorClient) (err error) {
 		defer func() {
 			if err == nil {
-				fmt.Println("done")
+				fmt.Fprintln(infoOutput, "done")
 			}
 		}()
 		if quitUserDaemon {
-			fmt.Print("quitting...")
+			fmt.Fprint(infoOutput, "quitting...")
 		} else {
 			var ci *connector.ConnectInfo
 			if ci, err = connectorClient.Status(ctx, &empty.Empty{}); err != nil {
@@ -141,7 +166,7 @@ func UserDaemonDisconnect(ctx context.Context, quitUserDaemon bool) error {
 			if ci.Error == connector.ConnectInfo_DISCONNECTED {
 				return ErrNoUserDaemon
 			}
-			fmt.Print("disconnecting...")
+			fmt.Fprint(infoOutput, "disconnecting...")
 			if _, err = connectorClient.Disconnect(ctx, &empty.Empty{}); status.Code(err) != codes.Unimplemented {
 				// nil or not unimplemented
 				return err
@@ -153,11 +178,17 @@ func UserDaemonDisconnect(ctx context.Context, quitUserDaemon bool) error {
 		}
 		return err
 	})
+	if quitUserDaemon {
+		// The daemon container ends when its connector quits, but it's stopped here too in case it didn't.
+		if stopErr := docker.Stop(ctx); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
 	if err != nil && (errors.Is(err, ErrNoUserDaemon) || grpcStatus.Code(err) == grpcCodes.Unavailable) {
 		if quitUserDaemon {
-			fmt.Println("had already quit")
+			fmt.Fprintln(infoOutput, "had already quit")
 		} else {
-			fmt.Println("is already disconnected")
+			fmt.Fprintln(infoOutput, "is already disconnected")
 		}
 		err = nil
 	}
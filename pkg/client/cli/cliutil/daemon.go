@@ -15,6 +15,8 @@ import (
 
 	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/docker"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
 	"github.com/telepresenceio/telepresence/v2/pkg/proc"
 )
@@ -22,7 +24,7 @@ import (
 var ErrNoNetwork = errors.New("telepresence network is not established")
 
 func launchDaemon(ctx context.Context) error {
-	fmt.Println("Launching Telepresence Root Daemon")
+	fmt.Fprintln(infoOutput, "Launching Telepresence Root Daemon")
 
 	// Ensure that the logfile is present before the daemon starts so that it isn't created with
 	// root permissions.
@@ -53,6 +55,22 @@ func launchDaemon(ctx context.Context) error {
 	return proc.StartInBackgroundAsRoot(ctx, client.GetExe(), "daemon-foreground", logDir, configDir)
 }
 
+// startDaemon launches the root daemon and waits for its socket to appear. Nothing is started if
+// another command started the daemon while this one was waiting for the start lock, and false is
+// returned.
+func startDaemon(ctx context.Context) (bool, error) {
+	if running, err := client.SocketExists(client.DaemonSocketName); err != nil || running {
+		return false, err
+	}
+	if err := launchDaemon(ctx); err != nil {
+		return false, errcat.Daemon.Newf("failed to launch the daemon service: %w", err)
+	}
+	if err := client.WaitUntilSocketAppears("daemon", client.DaemonSocketName, 10*time.Second); err != nil {
+		return false, errcat.Daemon.Newf("daemon service did not start: %w", err)
+	}
+	return true, nil
+}
+
 // WithNetwork (1) ensures that the daemon is running, (2) establishes a connection to it, and (3)
 // runs the given function with that connection.
 //
@@ -67,6 +85,15 @@ func WithStartedNetwork(ctx context.Context, fn func(context.Context, daemon.Dae
 	return withNetwork(ctx, false, fn)
 }
 
+// dialDaemon dials the root daemon of the daemon container when one is running, and the daemon
+// socket otherwise.
+func dialDaemon(ctx context.Context) (*grpc.ClientConn, error) {
+	if dd := docker.RunningDaemon(ctx); dd != nil {
+		return docker.Dial(ctx, dd.DaemonAddress, dd.Token)
+	}
+	return client.DialSocket(ctx, client.DaemonSocketName)
+}
+
 func withNetwork(ctx context.Context, maybeStart bool, fn func(context.Context, daemon.DaemonClient) error) error {
 	type daemonConnCtxKey struct{}
 	if untyped := ctx.Value(daemonConnCtxKey{}); untyped != nil {
@@ -79,27 +106,25 @@ func withNetwork(ctx context.Context, maybeStart bool, fn func(context.Context,
 	started := false
 	for {
 		var err error
-		conn, err = client.DialSocket(ctx, client.DaemonSocketName)
+		conn, err = dialDaemon(ctx)
 		if err == nil {
 			break
 		}
 		if errors.Is(err, os.ErrNotExist) {
 			err = ErrNoNetwork
 			if maybeStart {
-				if err = launchDaemon(ctx); err != nil {
-					return fmt.Errorf("failed to launch the daemon service: %w", err)
-				}
-
-				if err = client.WaitUntilSocketAppears("daemon", client.DaemonSocketName, 10*time.Second); err != nil {
-					return fmt.Errorf("daemon service did not start: %w", err)
+				if err = client.WithStartLock(ctx, "daemon", func() (err error) {
+					started, err = startDaemon(ctx)
+					return err
+				}); err != nil {
+					return err
 				}
-
 				maybeStart = false
-				started = true
 				continue
 			}
+			return err
 		}
-		return err
+		return errcat.Daemon.New(err)
 	}
 	defer conn.Close()
 	ctx = context.WithValue(ctx, daemonConnCtxKey{}, conn)
@@ -134,15 +159,15 @@ func Disconnect(ctx context.Context, quitUserDaemon, quitRootDaemon bool) (err e
 			err = client.WaitUntilSocketVanishes("root daemon", client.DaemonSocketName, 5*time.Second)
 		}
 	}()
-	fmt.Print("Telepresence Network ")
+	fmt.Fprint(infoOutput, "Telepresence Network ")
 	err = WithStartedNetwork(ctx, func(ctx context.Context, daemonClient daemon.DaemonClient) (err error) {
 		defer func() {
 			if err == nil {
-				fmt.Println("done")
+				fmt.Fprintln(infoOutput, "done")
 			}
 		}()
 		if quitRootDaemon {
-			fmt.Print("quitting...")
+			fmt.Fprint(infoOutput, "quitting...")
 		} else {
 			var ds *daemon.DaemonStatus
 			if ds, err = daemonClient.Status(ctx, &empty.Empty{}); err != nil {
@@ -151,7 +176,7 @@ func Disconnect(ctx context.Context, quitUserDaemon, quitRootDaemon bool) (err e
 			if ds.OutboundConfig == nil {
 				return ErrNoNetwork
 			}
-			fmt.Print("disconnecting...")
+			fmt.Fprint(infoOutput, "disconnecting...")
 			if _, err = daemonClient.Disconnect(ctx, &empty.Empty{}); status.Code(err) != codes.Unimplemented {
 				// nil or not unimplemented
 				return err
@@ -163,9 +188,9 @@ func Disconnect(ctx context.Context, quitUserDaemon, quitRootDaemon bool) (err e
 	})
 	if errors.Is(err, ErrNoNetwork) {
 		if quitRootDaemon {
-			fmt.Println("had already quit")
+			fmt.Fprintln(infoOutput, "had already quit")
 		} else {
-			fmt.Println("is already disconnected")
+			fmt.Fprintln(infoOutput, "is already disconnected")
 		}
 		err = nil
 	}
@@ -1,7 +1,9 @@
 package cliutil
 
 import (
+	"bytes"
 	"context"
+	"io"
 
 	"google.golang.org/grpc"
 
@@ -16,3 +18,40 @@ func WithManager(ctx context.Context, fn func(context.Context, manager.ManagerCl
 		return fn(ctx, managerClient)
 	})
 }
+
+// WithStartedManager is like WithManager, but returns ErrNoUserDaemon if the connector is not already
+// running, rather than starting it.
+func WithStartedManager(ctx context.Context, fn func(context.Context, manager.ManagerClient) error) error {
+	return WithStartedConnector(ctx, false, func(ctx context.Context, _ connector.ConnectorClient) error {
+		conn := ctx.Value(connectorConnCtxKey{}).(*grpc.ClientConn)
+		managerClient := manager.NewManagerClient(conn)
+		return fn(ctx, managerClient)
+	})
+}
+
+// GetCloudArtifact retrieves the Ambassador Cloud artifact at the given URL through the traffic-manager. This
+// enables workstations that lack direct access to Ambassador Cloud to retrieve artifacts that the cluster can
+// access.
+func GetCloudArtifact(ctx context.Context, url string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := WithManager(ctx, func(ctx context.Context, managerClient manager.ManagerClient) error {
+		stream, err := managerClient.GetCloudArtifact(ctx, &manager.CloudArtifactRequest{Url: url})
+		if err != nil {
+			return err
+		}
+		for {
+			chunk, err := stream.Recv()
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			buf.Write(chunk.Data)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
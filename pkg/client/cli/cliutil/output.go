@@ -0,0 +1,16 @@
+package cliutil
+
+import (
+	"io"
+	"os"
+)
+
+// infoOutput is where the messages about daemons being launched or stopped, and the notifications from the
+// user daemon, are written.
+var infoOutput io.Writer = os.Stdout
+
+// SetInfoOutput sets the writer for the messages about daemons being launched or stopped, and for the
+// notifications from the user daemon. It's os.Stdout unless set.
+func SetInfoOutput(w io.Writer) {
+	infoOutput = w
+}
@@ -8,10 +8,24 @@ import (
 	empty "google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/auth/authdata"
 )
 
+// cloudError categorizes an error from a call to the user daemon that involves Ambassador Cloud. Errors that
+// already have a category keep it, and errors caused by a user daemon that went away are daemon errors.
+func cloudError(err error) error {
+	switch {
+	case err == nil || errcat.GetCategory(err) != errcat.Unknown:
+		return err
+	case grpcStatus.Code(err) == grpcCodes.Unavailable:
+		return errcat.Daemon.New(err)
+	default:
+		return errcat.Cloud.New(err)
+	}
+}
+
 // EnsureLoggedIn ensures that the user is logged in to Ambassador Cloud.  An error is returned if
 // login fails.  The result code will indicate if this is a new login or if it resued an existing
 // login.  If the `apikey` argument is empty an interactive login is performed; if it is non-empty
@@ -28,12 +42,17 @@ func EnsureLoggedIn(ctx context.Context, apikey string) (connector.LoginResult_C
 
 // ClientEnsureLoggedIn is like EnsureLoggedIn but uses an already acquired ConnectorClient.
 func ClientEnsureLoggedIn(ctx context.Context, apikey string, connectorClient connector.ConnectorClient) (connector.LoginResult_Code, error) {
+	if client.GetConfig(ctx).Cloud.Disabled {
+		return connector.LoginResult_UNSPECIFIED, client.ErrCloudDisabled
+	}
 	resp, err := connectorClient.Login(ctx, &connector.LoginRequest{
 		ApiKey: apikey,
 	})
 	if err != nil {
 		if grpcStatus.Code(err) == grpcCodes.PermissionDenied {
 			err = errcat.User.New(grpcStatus.Convert(err).Message())
+		} else {
+			err = cloudError(err)
 		}
 		return connector.LoginResult_UNSPECIFIED, err
 	}
@@ -74,6 +93,9 @@ func EnsureLoggedOut(ctx context.Context) error {
 // HasLoggedIn returns true if either the user has an active login session or an expired login
 // session, and returns false if either the user has never logged in or has explicitly logged out.
 func HasLoggedIn(ctx context.Context) bool {
+	if client.GetConfig(ctx).Cloud.Disabled {
+		return false
+	}
 	_, err := authdata.LoadUserInfoFromUserCache(ctx)
 	return err == nil
 }
@@ -86,7 +108,7 @@ func GetCloudUserInfo(ctx context.Context, autoLogin bool, refresh bool) (*conne
 			AutoLogin: autoLogin,
 			Refresh:   refresh,
 		})
-		return err
+		return cloudError(err)
 	})
 	if err != nil {
 		return nil, err
@@ -102,7 +124,7 @@ func GetCloudAPIKey(ctx context.Context, description string, autoLogin bool) (st
 			AutoLogin:   autoLogin,
 			Description: description,
 		})
-		return err
+		return cloudError(err)
 	})
 	if err != nil {
 		return "", err
@@ -110,6 +132,28 @@ func GetCloudAPIKey(ctx context.Context, description string, autoLogin bool) (st
 	return keyData.GetApiKey(), nil
 }
 
+// RotateCloudAPIKeys replaces the cached API key with the given description, or all of them when the
+// description is empty, and revokes the replaced keys.
+func RotateCloudAPIKeys(ctx context.Context, description string) (*connector.RotateKeysResult, error) {
+	if client.GetConfig(ctx).Cloud.Disabled {
+		return nil, client.ErrCloudDisabled
+	}
+	var result *connector.RotateKeysResult
+	err := WithConnector(ctx, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
+		var err error
+		result, err = connectorClient.RotateCloudAPIKeys(ctx, &connector.RotateKeysRequest{
+			Description: description,
+		})
+		return err
+	})
+	if grpcStatus.Code(err) == grpcCodes.NotFound {
+		err = errcat.User.New(grpcStatus.Convert(err).Message())
+	} else {
+		err = cloudError(err)
+	}
+	return result, err
+}
+
 // GetCloudLicense communicates with system a to get the jwt version of the
 // license, puts it in a kubernetes secret, and then writes that secret to the
 // output file for the user to apply to their cluster
@@ -120,7 +164,7 @@ func GetCloudLicense(ctx context.Context, outputFile, id string) (string, string
 		licenseData, err = connectorClient.GetCloudLicense(ctx, &connector.LicenseRequest{
 			Id: id,
 		})
-		return err
+		return cloudError(err)
 	})
 	if err != nil {
 		return "", "", err
@@ -0,0 +1,19 @@
+package cliutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	grpcCodes "google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+func Test_cloudError(t *testing.T) {
+	assert.NoError(t, cloudError(nil))
+	assert.Equal(t, errcat.Cloud, errcat.GetCategory(cloudError(errors.New("unable to reach auth.datawire.io"))))
+	assert.Equal(t, errcat.Daemon, errcat.GetCategory(cloudError(grpcStatus.Error(grpcCodes.Unavailable, "connection refused"))))
+	assert.Equal(t, errcat.User, errcat.GetCategory(cloudError(errcat.User.New("login aborted"))))
+}
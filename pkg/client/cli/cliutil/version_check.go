@@ -2,7 +2,6 @@ package cliutil
 
 import (
 	"context"
-	"fmt"
 
 	"google.golang.org/grpc"
 	empty "google.golang.org/protobuf/types/known/emptypb"
@@ -21,10 +20,11 @@ func versionCheck(ctx context.Context, daemonType string, client interface {
 	// Ensure that the already running daemon has the correct version
 	vi, err := client.Version(ctx, &empty.Empty{})
 	if err != nil {
-		return fmt.Errorf("unable to retrieve version of %s Daemon: %w", daemonType, err)
+		return errcat.Daemon.Newf("unable to retrieve version of %s Daemon: %w", daemonType, err)
 	}
 	if version.Version != vi.Version {
-		return errcat.User.Newf("version mismatch. Client %s != %s Daemon %s, please quit telepresence and reconnect", version.Version, daemonType, vi.Version)
+		return errcat.User.Newf("version mismatch. Client %s != %s Daemon %s, please run \"telepresence quit -s\" and reconnect",
+			version.Version, daemonType, vi.Version)
 	}
 	return nil
 }
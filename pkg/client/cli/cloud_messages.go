@@ -2,7 +2,6 @@ package cli
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net/url"
 	"os"
@@ -51,9 +50,13 @@ func getCloudMessages(ctx context.Context, systemaURL string) (*systema.CommandM
 	if err != nil {
 		return &systema.CommandMessageResponse{}, err
 	}
+	tlsCfg, err := client.GetConfig(ctx).Cloud.TLSConfig(u.Hostname())
+	if err != nil {
+		return &systema.CommandMessageResponse{}, err
+	}
 	conn, err := grpc.DialContext(ctx,
 		(&url.URL{Scheme: "dns", Path: "/" + u.Host}).String(),
-		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{ServerName: u.Hostname()})))
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
 	if err != nil {
 		return &systema.CommandMessageResponse{}, err
 	}
@@ -111,7 +114,7 @@ func raiseCloudMessage(cmd *cobra.Command, _ []string) error {
 	// If the user has specified they are in an air-gapped cluster,
 	// we shouldn't try to get messages
 	cloudCfg := client.GetConfig(cmd.Context()).Cloud
-	if cloudCfg.SkipLogin {
+	if cloudCfg.NoLogin() {
 		return nil
 	}
 
@@ -100,6 +100,7 @@ func Command(ctx context.Context) *cobra.Command {
 		Short:              "Connect your workstation to a Kubernetes cluster",
 		Long:               help,
 		RunE:               RunSubcommands,
+		PersistentPreRunE:  setupOutput,
 		SilenceErrors:      true, // main() will handle it after .ExecuteContext() returns
 		SilenceUsage:       true, // our FlagErrorFunc will handle it
 		DisableFlagParsing: true, // Bc of the legacyCommand parsing, see legacy_command.go
@@ -136,10 +137,10 @@ func Command(ctx context.Context) *cobra.Command {
 	}
 	rootCmd.InitDefaultHelpCmd()
 	static := cliutil.CommandGroups{
-		"Session Commands": []*cobra.Command{connectCommand(), LoginCommand(), LogoutCommand(), LicenseCommand(), statusCommand(), quitCommand()},
-		"Traffic Commands": []*cobra.Command{listCommand(), interceptCommand(ctx), leaveCommand(), previewCommand()},
-		"Debug Commands":   []*cobra.Command{loglevelCommand(), gatherLogsCommand()},
-		"Other Commands":   []*cobra.Command{versionCommand(), uninstallCommand(), dashboardCommand(), ClusterIdCommand(), genYAMLCommand(), vpnDiagCommand()},
+		"Session Commands": []*cobra.Command{connectCommand(), runCommand(), LoginCommand(), LogoutCommand(), APIKeyCommand(), LicenseCommand(), statusCommand(), sessionCommand(), quitCommand()},
+		"Traffic Commands": []*cobra.Command{listCommand(), interceptCommand(ctx), leaveCommand(), previewCommand(), curlCommand(), replayCommand()},
+		"Debug Commands":   []*cobra.Command{loglevelCommand(), gatherLogsCommand(), logsCommand(), dnsLookupCommand(), testConnectionCommand()},
+		"Other Commands":   []*cobra.Command{versionCommand(), configCommand(), helmCommand(), checkRBACCommand(), uninstallCommand(), dashboardCommand(), ClusterIdCommand(), genYAMLCommand(), genConfigCommand(), vpnDiagCommand(), migrateCommand(), completionCommand()},
 	}
 	for name, cmds := range static {
 		if _, ok := groups[name]; !ok {
@@ -196,6 +197,9 @@ func initGlobalFlagGroups() {
 	})
 
 	globalFlagGroups = []cliutil.FlagGroup{{
+		Name:  "output flags",
+		Flags: outputFlags(),
+	}, {
 		Name: "other Telepresence flags",
 		Flags: func() *pflag.FlagSet {
 			flags := pflag.NewFlagSet("", 0)
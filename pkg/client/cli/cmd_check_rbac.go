@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	auth "k8s.io/api/authorization/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	authclient "k8s.io/client-go/kubernetes/typed/authorization/v1"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/k8s"
+)
+
+// rbacCheck is a group of permissions that the user must have in order to use a feature of telepresence.
+type rbacCheck struct {
+	feature     string
+	permissions []auth.ResourceAttributes
+}
+
+func checkRBACCommand() *cobra.Command {
+	var kubeFlags *pflag.FlagSet
+	cmd := &cobra.Command{
+		Use:  "check-rbac",
+		Args: cobra.NoArgs,
+
+		Short: "Check that the current kubernetes user has the permissions that telepresence needs",
+		Long: `Check, using SelfSubjectAccessReviews, that the current kubernetes user has the permissions needed to
+connect to the cluster, to have traffic-agents injected into workloads, and to intercept workloads. Permissions
+for agent injection and intercepts are checked in the namespace given by the --namespace flag, or the namespace of
+the current kubeconfig context. Each missing permission is printed.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			flagMap := kubeFlagMap(kubeFlags)
+			namespace := flagMap["namespace"]
+			cfg, err := k8s.NewConfig(ctx, flagMap)
+			if err != nil {
+				return err
+			}
+			if namespace == "" {
+				namespace = cfg.Namespace
+			}
+			restConfig, err := cfg.ConfigFlags.ToRESTConfig()
+			if err != nil {
+				return err
+			}
+			ki, err := kubernetes.NewForConfig(restConfig)
+			if err != nil {
+				return err
+			}
+			checks := rbacChecks(cfg.GetManagerNamespace(), namespace)
+			return checkRBAC(ctx, cmd.OutOrStdout(), ki.AuthorizationV1().SelfSubjectAccessReviews(), checks)
+		},
+	}
+	kubeFlags = pflag.NewFlagSet("Kubernetes flags", 0)
+	genericclioptions.NewConfigFlags(false).AddFlags(kubeFlags)
+	cmd.Flags().AddFlagSet(kubeFlags)
+	return cmd
+}
+
+// rbacChecks returns the permissions that telepresence needs when the traffic-manager is installed in
+// managerNamespace and workloads in namespace are intercepted.
+func rbacChecks(managerNamespace, namespace string) []rbacCheck {
+	perms := func(ns, group string, resources, verbs []string) []auth.ResourceAttributes {
+		ras := make([]auth.ResourceAttributes, 0, len(resources)*len(verbs))
+		for _, resource := range resources {
+			subresource := ""
+			if i := strings.IndexByte(resource, '/'); i > 0 {
+				resource, subresource = resource[:i], resource[i+1:]
+			}
+			for _, verb := range verbs {
+				ras = append(ras, auth.ResourceAttributes{
+					Namespace:   ns,
+					Group:       group,
+					Resource:    resource,
+					Subresource: subresource,
+					Verb:        verb,
+				})
+			}
+		}
+		return ras
+	}
+	join := func(rass ...[]auth.ResourceAttributes) []auth.ResourceAttributes {
+		var all []auth.ResourceAttributes
+		for _, ras := range rass {
+			all = append(all, ras...)
+		}
+		return all
+	}
+	return []rbacCheck{
+		{
+			feature: "connect",
+			permissions: join(
+				perms("", "", []string{"namespaces", "services"}, []string{"get", "list", "watch"}),
+				perms(managerNamespace, "", []string{"pods"}, []string{"get", "list"}),
+				perms(managerNamespace, "", []string{"pods/portforward"}, []string{"create"}),
+			),
+		},
+		{
+			feature: "agent injection",
+			permissions: join(
+				perms(namespace, "apps", []string{"deployments", "replicasets", "statefulsets"}, []string{"get", "list", "update", "patch"}),
+				perms(namespace, "batch", []string{"jobs", "cronjobs"}, []string{"get", "patch"}),
+				perms(namespace, "", []string{"services"}, []string{"update"}),
+			),
+		},
+		{
+			feature: "intercept",
+			permissions: join(
+				perms(namespace, "", []string{"pods"}, []string{"get", "list", "watch", "create", "delete"}),
+				perms(namespace, "", []string{"endpoints"}, []string{"get", "list", "watch"}),
+			),
+		},
+	}
+}
+
+// checkRBAC reviews each permission of the given checks and prints the outcome of each check, followed by the
+// permissions that are missing. An error is returned when a permission is missing or can't be reviewed.
+func checkRBAC(ctx context.Context, out io.Writer, ssar authclient.SelfSubjectAccessReviewInterface, checks []rbacCheck) error {
+	missingCount := 0
+	for _, check := range checks {
+		var missing []string
+		for i := range check.permissions {
+			ra := &check.permissions[i]
+			review, err := ssar.Create(ctx, &auth.SelfSubjectAccessReview{
+				Spec: auth.SelfSubjectAccessReviewSpec{ResourceAttributes: ra},
+			}, meta.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("unable to review permission to %s: %w", describePermission(ra), err)
+			}
+			if !review.Status.Allowed {
+				missing = append(missing, describePermission(ra))
+			}
+		}
+		if len(missing) == 0 {
+			fmt.Fprintf(out, "%s: ok\n", check.feature)
+			continue
+		}
+		fmt.Fprintf(out, "%s: missing %d permissions\n", check.feature, len(missing))
+		for _, m := range missing {
+			fmt.Fprintf(out, "  cannot %s\n", m)
+		}
+		missingCount += len(missing)
+	}
+	if missingCount > 0 {
+		return errcat.User.Newf("%d required permissions are missing", missingCount)
+	}
+	return nil
+}
+
+// describePermission returns a description of the given attributes in the form "<verb> <resource>[/<subresource>]
+// [.<group>] in namespace <namespace>" or, when the namespace is empty, "cluster-wide".
+func describePermission(ra *auth.ResourceAttributes) string {
+	resource := ra.Resource
+	if ra.Subresource != "" {
+		resource += "/" + ra.Subresource
+	}
+	if ra.Group != "" {
+		resource += "." + ra.Group
+	}
+	if ra.Namespace == "" {
+		return fmt.Sprintf("%s %s cluster-wide", ra.Verb, resource)
+	}
+	return fmt.Sprintf("%s %s in namespace %s", ra.Verb, resource, ra.Namespace)
+}
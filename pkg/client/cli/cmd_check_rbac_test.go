@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	auth "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func Test_checkRBAC(t *testing.T) {
+	ki := fake.NewSimpleClientset()
+	ki.PrependReactor("create", "selfsubjectaccessreviews", func(action ktesting.Action) (bool, runtime.Object, error) {
+		review := action.(ktesting.CreateAction).GetObject().(*auth.SelfSubjectAccessReview)
+		ra := review.Spec.ResourceAttributes
+		// Everything is allowed except updates of workloads and port-forwards
+		review.Status.Allowed = !(ra.Group == "apps" && ra.Verb == "update") && ra.Subresource != "portforward"
+		return true, review, nil
+	})
+
+	out := &strings.Builder{}
+	err := checkRBAC(context.Background(), out, ki.AuthorizationV1().SelfSubjectAccessReviews(), rbacChecks("ambassador", "dev"))
+	require.Error(t, err)
+	assert.Equal(t, "4 required permissions are missing", err.Error())
+	assert.Equal(t, `connect: missing 1 permissions
+  cannot create pods/portforward in namespace ambassador
+agent injection: missing 3 permissions
+  cannot update deployments.apps in namespace dev
+  cannot update replicasets.apps in namespace dev
+  cannot update statefulsets.apps in namespace dev
+intercept: ok
+`, out.String())
+}
+
+func Test_describePermission(t *testing.T) {
+	assert.Equal(t, "list namespaces cluster-wide", describePermission(&auth.ResourceAttributes{Verb: "list", Resource: "namespaces"}))
+	assert.Equal(t, "patch deployments.apps in namespace dev",
+		describePermission(&auth.ResourceAttributes{Namespace: "dev", Group: "apps", Verb: "patch", Resource: "deployments"}))
+}
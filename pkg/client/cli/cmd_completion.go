@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+// completionTimeout bounds the time that a completion spends querying the user daemon, so that a daemon that is
+// slow to respond doesn't hang the shell.
+const completionTimeout = 2 * time.Second
+
+func completionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:       "completion <bash|zsh|fish|powershell>",
+		Args:      cobra.ExactValidArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+
+		Short: "Generate a shell completion script",
+		Long: `Generate a shell completion script for the given shell.
+
+The completion of workload names, namespaces, and intercept names queries the user daemon, so they are only
+completed when a session is connected. Completions never start the daemons or connect.
+
+To load the completions in the current bash shell:
+
+  source <(telepresence completion bash)
+
+To load them in zsh:
+
+  source <(telepresence completion zsh)
+
+To load them in fish:
+
+  telepresence completion fish | source
+
+To load them in PowerShell:
+
+  telepresence completion powershell | Out-String | Invoke-Expression`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := cmd.Root()
+			out := cmd.OutOrStdout()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletion(out)
+			case "zsh":
+				return root.GenZshCompletion(out)
+			case "fish":
+				return root.GenFishCompletion(out, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(out)
+			default:
+				return errcat.User.Newf("unsupported shell %q", args[0])
+			}
+		},
+	}
+}
+
+// withCompletionSession calls the given function with a client for the user daemon and the status of its session,
+// provided that the daemon is running and connected. It never starts a daemon or creates a session.
+func withCompletionSession(cmd *cobra.Command, f func(context.Context, connector.ConnectorClient, *connector.ConnectInfo) error) {
+	// Cobra doesn't propagate the context to the command that is completed, only to the root.
+	ctx := cmd.Context()
+	if ctx == nil {
+		if ctx = cmd.Root().Context(); ctx == nil {
+			ctx = context.Background()
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+	err := cliutil.WithStartedConnector(ctx, false, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
+		ci, err := connectorClient.Status(ctx, &empty.Empty{})
+		if err != nil || ci.Error == connector.ConnectInfo_DISCONNECTED {
+			return err
+		}
+		return f(ctx, connectorClient, ci)
+	})
+	if err != nil {
+		cobra.CompDebugln(err.Error(), false)
+	}
+}
+
+// completeInterceptableWorkloads completes the name of a workload that can be intercepted in the namespace given
+// by the --namespace flag, or in the namespace of the session.
+func completeInterceptableWorkloads(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if cmd.ArgsLenAtDash() >= 0 {
+		// The command to run in the context of the intercept
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeWorkloadFlag(cmd, args, toComplete)
+}
+
+// completeWorkloadFlag completes the --workload flag of the intercept command.
+func completeWorkloadFlag(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	namespace, _ := cmd.Flags().GetString("namespace")
+	var names []string
+	withCompletionSession(cmd, func(ctx context.Context, connectorClient connector.ConnectorClient, _ *connector.ConnectInfo) (err error) {
+		names, err = workloadCompletions(ctx, connectorClient, namespace, toComplete)
+		return err
+	})
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeMappedNamespaces completes the name of a namespace that is mapped by the current session.
+func completeMappedNamespaces(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var names []string
+	withCompletionSession(cmd, func(_ context.Context, _ connector.ConnectorClient, ci *connector.ConnectInfo) error {
+		names = namespaceCompletions(ci, toComplete)
+		return nil
+	})
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeInterceptNames completes the name of an intercept of the current session.
+func completeInterceptNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	withCompletionSession(cmd, func(_ context.Context, _ connector.ConnectorClient, ci *connector.ConnectInfo) error {
+		names = interceptCompletions(ci, toComplete)
+		return nil
+	})
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// workloadCompletions returns the names of the interceptable workloads in the given namespace that start with the
+// given prefix, each with the kind of the workload as its description.
+func workloadCompletions(ctx context.Context, connectorClient connector.ConnectorClient, namespace, prefix string) ([]string, error) {
+	r, err := connectorClient.List(ctx, &connector.ListRequest{Filter: connector.ListRequest_INTERCEPTABLE, Namespace: namespace})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, wl := range r.Workloads {
+		if strings.HasPrefix(wl.Name, prefix) {
+			names = append(names, wl.Name+"\t"+wl.WorkloadResourceType)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// namespaceCompletions returns the mapped namespaces of the session that start with the given prefix.
+func namespaceCompletions(ci *connector.ConnectInfo, prefix string) []string {
+	var names []string
+	for _, ns := range ci.MappedNamespaces {
+		if strings.HasPrefix(ns, prefix) {
+			names = append(names, ns)
+		}
+	}
+	return names
+}
+
+// interceptCompletions returns the names of the intercepts of the session that start with the given prefix, each
+// with the intercepted workload as its description.
+func interceptCompletions(ci *connector.ConnectInfo, prefix string) []string {
+	var names []string
+	for _, ii := range ci.GetIntercepts().GetIntercepts() {
+		spec := ii.Spec
+		if strings.HasPrefix(spec.Name, prefix) {
+			names = append(names, spec.Name+"\t"+spec.Agent+"."+spec.Namespace)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+type listConnector struct {
+	connector.UnimplementedConnectorServer
+	namespace string
+}
+
+func (lc *listConnector) List(_ context.Context, lr *connector.ListRequest) (*connector.WorkloadInfoSnapshot, error) {
+	lc.namespace = lr.Namespace
+	return &connector.WorkloadInfoSnapshot{Workloads: []*connector.WorkloadInfo{
+		{Name: "web", WorkloadResourceType: "Deployment"},
+		{Name: "echo", WorkloadResourceType: "StatefulSet"},
+		{Name: "echo-easy", WorkloadResourceType: "Rollout"},
+	}}, nil
+}
+
+func TestWorkloadCompletions(t *testing.T) {
+	lc := &listConnector{}
+	names, err := workloadCompletions(context.Background(), testConnectorClient(t, lc), "blue", "ec")
+	require.NoError(t, err)
+	assert.Equal(t, "blue", lc.namespace)
+	assert.Equal(t, []string{"echo\tStatefulSet", "echo-easy\tRollout"}, names)
+}
+
+func TestNamespaceCompletions(t *testing.T) {
+	ci := &connector.ConnectInfo{MappedNamespaces: []string{"blue", "default", "green"}}
+	assert.Equal(t, []string{"blue", "default", "green"}, namespaceCompletions(ci, ""))
+	assert.Equal(t, []string{"green"}, namespaceCompletions(ci, "g"))
+	assert.Empty(t, namespaceCompletions(ci, "x"))
+}
+
+func TestInterceptCompletions(t *testing.T) {
+	ci := &connector.ConnectInfo{Intercepts: &manager.InterceptInfoSnapshot{Intercepts: []*manager.InterceptInfo{
+		{Spec: &manager.InterceptSpec{Name: "web-blue", Agent: "web", Namespace: "blue"}},
+		{Spec: &manager.InterceptSpec{Name: "echo", Agent: "echo", Namespace: "default"}},
+	}}}
+	assert.Equal(t, []string{"echo\techo.default", "web-blue\tweb.blue"}, interceptCompletions(ci, ""))
+	assert.Equal(t, []string{"web-blue\tweb.blue"}, interceptCompletions(ci, "w"))
+	assert.Empty(t, interceptCompletions(&connector.ConnectInfo{}, ""))
+}
+
+func TestCompletionCommand(t *testing.T) {
+	root := &cobra.Command{Use: "telepresence"}
+	root.AddCommand(completionCommand())
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		out := &bytes.Buffer{}
+		root.SetOut(out)
+		root.SetArgs([]string{"completion", shell})
+		require.NoError(t, root.Execute(), shell)
+		assert.Contains(t, out.String(), "telepresence", shell)
+	}
+	root.SetArgs([]string{"completion", "tcsh"})
+	root.SetErr(&bytes.Buffer{})
+	assert.Error(t, root.Execute())
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	grpcCodes "google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/k8s"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+func configCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  "config",
+		Args: OnlySubcommands,
+
+		Short: "Show, change, and validate the Telepresence configuration",
+		RunE:  RunSubcommands,
+	}
+	cmd.AddCommand(configGetCommand(), configSetCommand(), configValidateCommand(), applyRoutesCommand())
+	return cmd
+}
+
+func configGetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:  "get [<key>]",
+		Args: cobra.MaximumNArgs(1),
+
+		Short: "Show the effective configuration, or the value of one section or key, e.g. timeouts.agentInstall",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key := ""
+			if len(args) > 0 {
+				key = args[0]
+			}
+			lines, err := client.ConfigValues(client.GetConfig(cmd.Context()), key)
+			if err != nil {
+				return errcat.User.New(err)
+			}
+			out := cmd.OutOrStdout()
+			for _, line := range lines {
+				fmt.Fprintln(out, line)
+			}
+			return nil
+		},
+	}
+}
+
+func configSetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:  "set <key> <value>",
+		Args: cobra.ExactArgs(2),
+
+		Short: "Set a value in the user's config.yml, e.g. timeouts.agentInstall 2m",
+		Long: "Set a value in the user's config.yml. The value is parsed as YAML and the resulting configuration is " +
+			"validated before it is written. Running daemons pick up the change without a restart.",
+		RunE: configSet,
+	}
+}
+
+func configSet(cmd *cobra.Command, args []string) error {
+	file := client.GetConfigFile(cmd.Context())
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if data, err = client.SetConfigValue(data, args[0], args[1]); err != nil {
+		return errcat.Config.New(err)
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err = os.WriteFile(file, data, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Set %s to %s in %s\n", args[0], args[1], file)
+	return nil
+}
+
+type configValidator struct {
+	kubeconfig  string
+	kubeContext string
+}
+
+func configValidateCommand() *cobra.Command {
+	cv := configValidator{}
+	cmd := &cobra.Command{
+		Use:  "validate [<file> ...]",
+		Args: cobra.ArbitraryArgs,
+
+		Short: "Validate config.yml files and the telepresence.io extension of the kubeconfig",
+		Long: "Validate the given config.yml files, or all config.yml files that Telepresence reads and the " +
+			"telepresence.io extension of the cluster in the current kubeconfig context when no files are given. " +
+			"Unknown keys are reported together with the key that was probably meant.",
+		RunE: cv.run,
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&cv.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to validate")
+	flags.StringVar(&cv.kubeContext, "context", "", "The name of the kubeconfig context to validate")
+	return cmd
+}
+
+func (cv *configValidator) run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	out := cmd.OutOrStdout()
+	files := args
+	checkKubeconfig := len(args) == 0
+	if checkKubeconfig {
+		var err error
+		if files, err = client.GetConfigFiles(ctx); err != nil {
+			return err
+		}
+	}
+
+	problemCount := 0
+	report := func(source string, problems []string, err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		if len(problems) == 0 {
+			fmt.Fprintf(out, "%s: OK\n", source)
+			return
+		}
+		for _, p := range problems {
+			fmt.Fprintf(out, "%s: %s\n", source, p)
+		}
+		problemCount += len(problems)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			if len(args) == 0 && os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		problems, err := client.ValidateConfig(data)
+		report(file, problems, err)
+	}
+	if checkKubeconfig {
+		kubeFlags := make(map[string]string)
+		if cv.kubeconfig != "" {
+			kubeFlags["kubeconfig"] = cv.kubeconfig
+		}
+		if cv.kubeContext != "" {
+			kubeFlags["context"] = cv.kubeContext
+		}
+		ctxName, problems, err := k8s.ValidateExtension(kubeFlags)
+		if ctxName == "" && len(kubeFlags) == 0 {
+			// No usable kubeconfig. That's only a problem when one was given explicitly.
+			fmt.Fprintf(out, "kubeconfig: not validated: %v\n", err)
+		} else {
+			report(fmt.Sprintf("kubeconfig context %q", ctxName), problems, err)
+		}
+	}
+	if problemCount > 0 {
+		return errcat.Config.Newf("found %d problem(s) in the configuration", problemCount)
+	}
+	return nil
+}
+
+func applyRoutesCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:  "apply-routes",
+		Args: cobra.NoArgs,
+
+		Short: "Apply changed also-proxy and never-proxy subnets and hosts to the current session",
+		Long: "Re-read the also-proxy and never-proxy subnets from the telepresence.io extension of the kubeconfig " +
+			"and update the routes of the current session, without the need to quit and connect again.",
+		RunE: applyRoutes,
+	}
+}
+
+func applyRoutes(cmd *cobra.Command, _ []string) error {
+	err := cliutil.WithStartedConnector(cmd.Context(), false, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
+		ri, err := connectorClient.ApplyRoutes(ctx, &empty.Empty{})
+		if err != nil {
+			switch grpcStatus.Code(err) {
+			case grpcCodes.Unavailable:
+				return errcat.User.New("telepresence is not connected")
+			case grpcCodes.FailedPrecondition:
+				return errcat.User.New(grpcStatus.Convert(err).Message())
+			}
+			return err
+		}
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "Also Proxy : (%d subnets)\n", len(ri.AlsoProxySubnets))
+		for _, subnet := range ri.AlsoProxySubnets {
+			fmt.Fprintf(out, "  - %s\n", iputil.IPNetFromRPC(subnet))
+		}
+		fmt.Fprintf(out, "Never Proxy: (%d subnets)\n", len(ri.NeverProxySubnets))
+		for _, subnet := range ri.NeverProxySubnets {
+			fmt.Fprintf(out, "  - %s\n", iputil.IPNetFromRPC(subnet))
+		}
+		if len(ri.AlsoProxyHosts) > 0 {
+			fmt.Fprintf(out, "Also Proxy hosts: (%d)\n", len(ri.AlsoProxyHosts))
+			for _, host := range ri.AlsoProxyHosts {
+				fmt.Fprintf(out, "  - %s\n", host)
+			}
+		}
+		if len(ri.NeverProxyHosts) > 0 {
+			fmt.Fprintf(out, "Never Proxy hosts: (%d)\n", len(ri.NeverProxyHosts))
+			for _, host := range ri.NeverProxyHosts {
+				fmt.Fprintf(out, "  - %s\n", host)
+			}
+		}
+		for _, sc := range ri.SubnetConflicts {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s\n", sc)
+		}
+		return nil
+	})
+	if errors.Is(err, cliutil.ErrNoUserDaemon) {
+		err = errcat.User.New("telepresence is not connected")
+	}
+	return err
+}
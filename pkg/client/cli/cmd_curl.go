@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/restapi"
+)
+
+type curlInfo struct {
+	method             string
+	headers            []string
+	data               string
+	include            bool
+	noInterceptHeaders bool
+}
+
+func curlCommand() *cobra.Command {
+	ci := &curlInfo{}
+	cmd := &cobra.Command{
+		Use:   "curl [flags] <url>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Send an HTTP request to a cluster service",
+		Long: `Send an HTTP request to a cluster service using the current session.
+
+Cluster names are resolved through the session, and the headers that match your personal intercept
+of the targeted service are added automatically. The command reports whether your intercept or the
+workload in the cluster is expected to serve the response.`,
+		RunE: ci.curl,
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&ci.method, "request", "X", "", "The HTTP method to use. Defaults to GET, or POST when --data is given")
+	flags.StringArrayVarP(&ci.headers, "header", "H", nil, `Extra header to send, in the form "Name: value"`)
+	flags.StringVarP(&ci.data, "data", "d", "", "The request body")
+	flags.BoolVarP(&ci.include, "include", "i", false, "Include the response status and headers in the output")
+	flags.BoolVar(&ci.noInterceptHeaders, "no-intercept-headers", false, "Don't add the headers of your personal intercept")
+	return cmd
+}
+
+func (ci *curlInfo) curl(cmd *cobra.Command, args []string) error {
+	u, err := url.Parse(args[0])
+	if err != nil || u.Host == "" {
+		return errcat.User.Newf("invalid URL %q", args[0])
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errcat.User.Newf("unsupported URL scheme %q", u.Scheme)
+	}
+	method := ci.method
+	if method == "" {
+		method = http.MethodGet
+		if ci.data != "" {
+			method = http.MethodPost
+		}
+	}
+	var body io.Reader
+	if ci.data != "" {
+		body = strings.NewReader(ci.data)
+	}
+
+	return withConnector(cmd, false, nil, func(ctx context.Context, cs *connectorState) error {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+		if err != nil {
+			return err
+		}
+		for _, h := range ci.headers {
+			colon := strings.IndexByte(h, ':')
+			if colon <= 0 {
+				return errcat.User.Newf("invalid header %q, must be in the form \"Name: value\"", h)
+			}
+			req.Header.Add(strings.TrimSpace(h[:colon]), strings.TrimSpace(h[colon+1:]))
+		}
+
+		svc, ns := serviceAndNamespace(u.Hostname())
+		ii, err := findIntercept(ctx, cs, svc, ns)
+		if err != nil {
+			return err
+		}
+		served := "the cluster workload, unless another user's intercept matches the request"
+		if ii != nil {
+			switch {
+			case ii.Spec.Mechanism == "tcp":
+				served = fmt.Sprintf("your intercept %q, which intercepts all traffic", ii.Spec.Name)
+			case ii.Spec.Mechanism == "tls":
+				if u.Scheme == "https" && interceptsSNI(ii, u.Hostname()) {
+					served = fmt.Sprintf("your intercept %q", ii.Spec.Name)
+				}
+			case !ci.noInterceptHeaders:
+				hdrs, ok := interceptHeaders(ii)
+				for k, v := range hdrs {
+					req.Header.Set(k, v)
+				}
+				if ok {
+					served = fmt.Sprintf("your intercept %q", ii.Spec.Name)
+				} else {
+					fmt.Fprintf(cmd.ErrOrStderr(), "Unable to derive headers for all matchers of intercept %q\n", ii.Spec.Name)
+				}
+			}
+		}
+
+		hc := &http.Client{}
+		if cs.ProxyAddress != "" {
+			// No root daemon, so names must be resolved and connections routed by the proxy
+			hc.Transport = &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "socks5", Host: cs.ProxyAddress})}
+		}
+		rsp, err := hc.Do(req)
+		if err != nil {
+			return err
+		}
+		defer rsp.Body.Close()
+
+		stdout := cmd.OutOrStdout()
+		if ci.include {
+			fmt.Fprintf(stdout, "%s %s\n", rsp.Proto, rsp.Status)
+			_ = rsp.Header.Write(stdout)
+			fmt.Fprintln(stdout)
+		}
+		if _, err = io.Copy(stdout, rsp.Body); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "\nServed by: %s\n", served)
+		return nil
+	})
+}
+
+// serviceAndNamespace returns the service name and namespace of a cluster host name such as
+// "svc", "svc.ns", or "svc.ns.svc.cluster.local". The namespace is empty when not given.
+func serviceAndNamespace(host string) (string, string) {
+	parts := strings.Split(strings.TrimSuffix(host, "."), ".")
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// findIntercept returns the caller's active intercept of the given service, or nil if there is none.
+func findIntercept(ctx context.Context, cs *connectorState, svc, ns string) (*manager.InterceptInfo, error) {
+	r, err := cs.userD.List(ctx, &connector.ListRequest{Filter: connector.ListRequest_INTERCEPTS, Namespace: ns})
+	if err != nil {
+		return nil, err
+	}
+	for _, wl := range r.Workloads {
+		ii := wl.InterceptInfo
+		if ii == nil || ii.Disposition != manager.InterceptDispositionType_ACTIVE {
+			continue
+		}
+		if ii.Spec.ServiceName == svc || ii.Spec.Agent == svc {
+			return ii, nil
+		}
+	}
+	return nil, nil
+}
+
+// interceptsSNI returns true if the given intercept of TLS connections intercepts the given host.
+func interceptsSNI(ii *manager.InterceptInfo, host string) bool {
+	for _, arg := range ii.Spec.MechanismArgs {
+		if strings.EqualFold(arg, "--sni="+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// interceptHeaders returns the headers that make a request match the given intercept. The returned
+// boolean is false when a matcher uses a regular expression that a header value can't be derived from.
+func interceptHeaders(ii *manager.InterceptInfo) (map[string]string, bool) {
+	hdrs := make(map[string]string)
+	ok := true
+	for _, arg := range ii.Spec.MechanismArgs {
+		if !strings.HasPrefix(arg, "--match=") {
+			continue
+		}
+		switch m := strings.TrimPrefix(arg, "--match="); m {
+		case "all":
+		case "auto":
+			hdrs[restapi.HeaderInterceptID] = ii.Id
+		default:
+			eq := strings.IndexByte(m, '=')
+			if eq <= 0 {
+				ok = false
+				continue
+			}
+			v := m[eq+1:]
+			if regexp.QuoteMeta(v) != v {
+				ok = false
+				continue
+			}
+			hdrs[m[:eq]] = v
+		}
+	}
+	return hdrs, ok
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/restapi"
+)
+
+func Test_serviceAndNamespace(t *testing.T) {
+	tests := []struct {
+		host string
+		svc  string
+		ns   string
+	}{
+		{"echo", "echo", ""},
+		{"echo.default", "echo", "default"},
+		{"echo.default.svc.cluster.local.", "echo", "default"},
+	}
+	for _, tt := range tests {
+		svc, ns := serviceAndNamespace(tt.host)
+		assert.Equal(t, tt.svc, svc, tt.host)
+		assert.Equal(t, tt.ns, ns, tt.host)
+	}
+}
+
+func Test_interceptHeaders(t *testing.T) {
+	ii := &manager.InterceptInfo{
+		Id: "abc:echo",
+		Spec: &manager.InterceptSpec{
+			MechanismArgs: []string{"--match=auto", "--match=x-user=jane", "--plaintext=false"},
+		},
+	}
+	hdrs, ok := interceptHeaders(ii)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{restapi.HeaderInterceptID: "abc:echo", "x-user": "jane"}, hdrs)
+
+	ii.Spec.MechanismArgs = []string{"--match=x-user=ja.*"}
+	hdrs, ok = interceptHeaders(ii)
+	assert.False(t, ok)
+	assert.Empty(t, hdrs)
+}
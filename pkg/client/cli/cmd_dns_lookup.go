@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+type dnsLookupInfo struct {
+	qType string
+}
+
+// dnsLookupResult is the result of the dns-lookup command, as printed with --output json.
+type dnsLookupResult struct {
+	Name             string   `json:"name"`
+	Type             string   `json:"type"`
+	Path             string   `json:"path"`
+	ClusterExclusion string   `json:"cluster_exclusion,omitempty"`
+	Rcode            string   `json:"rcode"`
+	Records          []string `json:"records,omitempty"`
+	Duration         string   `json:"duration"`
+}
+
+func dnsLookupCommand() *cobra.Command {
+	dl := &dnsLookupInfo{}
+	cmd := withJSONOutput(&cobra.Command{
+		Use:   "dns-lookup [flags] <name>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Resolve a name using the DNS resolver of the current session",
+		Long: `Resolve a name using the DNS resolver of the current session and show how it was resolved.
+
+The path is one of "cluster" (resolved by the cluster's DNS), "suffix-resolver" (forwarded to a resolver
+configured for the name's suffix), "upstream" (forwarded to a configured upstream resolver), "local"
+(forwarded to the host's original resolver), or "none" (not resolved by telepresence). When the name
+isn't looked up in the cluster, the reason, such as the excluded suffix that it matched, is shown too.`,
+		RunE: dl.lookup,
+	})
+	cmd.Flags().StringVarP(&dl.qType, "type", "t", "A", `The query type, e.g. "A", "AAAA", "CNAME", or "SRV"`)
+	return cmd
+}
+
+func (dl *dnsLookupInfo) lookup(cmd *cobra.Command, args []string) error {
+	return withConnector(cmd, false, nil, func(ctx context.Context, cs *connectorState) error {
+		if cs.rootD == nil {
+			return errcat.User.New("the session doesn't use the DNS resolver of the root daemon")
+		}
+		rsp, err := cs.rootD.LookupDNS(ctx, &daemon.DNSRequest{Name: args[0], Type: dl.qType})
+		if err != nil {
+			return err
+		}
+		res := &dnsLookupResult{
+			Name:             args[0],
+			Type:             dl.qType,
+			Path:             rsp.Path,
+			ClusterExclusion: rsp.ClusterExclusion,
+			Rcode:            rsp.Rcode,
+			Records:          rsp.Records,
+			Duration:         roundDuration(rsp.Duration.AsDuration()),
+		}
+		return printResult(cmd, res, res.print)
+	})
+}
+
+func (r *dnsLookupResult) print(out io.Writer) {
+	fmt.Fprintf(out, "Name:     %s\n", r.Name)
+	fmt.Fprintf(out, "Type:     %s\n", r.Type)
+	fmt.Fprintf(out, "Path:     %s\n", r.Path)
+	if r.ClusterExclusion != "" {
+		fmt.Fprintf(out, "Cluster:  not consulted, %s\n", r.ClusterExclusion)
+	}
+	fmt.Fprintf(out, "Rcode:    %s\n", r.Rcode)
+	fmt.Fprintf(out, "Time:     %s\n", r.Duration)
+	if len(r.Records) == 0 {
+		fmt.Fprintln(out, "Records:  none")
+		return
+	}
+	fmt.Fprintln(out, "Records:")
+	for _, rr := range r.Records {
+		fmt.Fprintf(out, "  %s\n", rr)
+	}
+}
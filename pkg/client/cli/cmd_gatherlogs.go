@@ -10,9 +10,11 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
@@ -29,6 +31,10 @@ type gatherLogsArgs struct {
 	trafficManager bool
 	anon           bool
 	podYaml        bool
+	since          time.Duration
+	tail           int64
+	agentsNs       string
+	agentsSelector string
 }
 
 func gatherLogsCommand() *cobra.Command {
@@ -58,6 +64,12 @@ telepresence gather-logs --traffic-manager=False --traffic-agents=echo-easy-6848
 
 # Get logs from everything except the daemons
 telepresence gather-logs --daemons=None
+
+# Get the last hour of logs, but no more than 1000 lines from each log
+telepresence gather-logs --since=1h --tail=1000
+
+# Get logs from the traffic-agents in pods labeled app=echo in the staging namespace
+telepresence gather-logs --traffic-agents-namespace=staging --traffic-agents-selector=app=echo
 `,
 
 		RunE: func(cmd *cobra.Command, _ []string) error {
@@ -71,6 +83,11 @@ telepresence gather-logs --daemons=None
 	flags.StringVar(&gl.trafficAgents, "traffic-agents", "all", "Traffic-agents to collect logs from: all, name substring, None")
 	flags.BoolVarP(&gl.anon, "anonymize", "a", false, "To anonymize pod names + namespaces from the logs")
 	flags.BoolVarP(&gl.podYaml, "get-pod-yaml", "y", false, "Get the yaml of any pods you are getting logs for")
+	flags.DurationVar(&gl.since, "since", 0, "Only get log lines newer than a relative duration like 5s, 2m, or 3h")
+	flags.Int64Var(&gl.tail, "tail", 0, "Only get this many lines from the end of each log")
+	flags.StringVar(&gl.agentsNs, "traffic-agents-namespace", "", "Only get logs from traffic-agents in this namespace")
+	flags.StringVar(&gl.agentsSelector, "traffic-agents-selector", "",
+		"Only get logs from traffic-agents in pods that match this label selector, e.g. app=echo")
 	return cmd
 }
 
@@ -108,6 +125,12 @@ func (gl *gatherLogsArgs) gatherLogs(ctx context.Context, cmd *cobra.Command, st
 	} else if !strings.HasSuffix(gl.outputFile, ".zip") {
 		return errcat.User.New("output file must end in .zip")
 	}
+	if gl.since < 0 {
+		return errcat.User.New("--since must be a positive duration")
+	}
+	if gl.tail < 0 {
+		return errcat.User.New("--tail must be a positive number")
+	}
 
 	// Create a temporary directory where we will store the logs before we zip
 	// them for export
@@ -144,6 +167,7 @@ func (gl *gatherLogsArgs) gatherLogs(ctx context.Context, cmd *cobra.Command, st
 	scout.SetMetadatum(dc, "traffic_agent_logs", gl.trafficAgents)
 	scout.SetMetadatum(dc, "get_pod_yaml", gl.podYaml)
 	scout.SetMetadatum(dc, "anonymized_logs", gl.anon)
+	scout.SetMetadatum(dc, "filtered_logs", gl.since > 0 || gl.tail > 0 || gl.agentsNs != "" || gl.agentsSelector != "")
 	scout.Report(dc, "used_gather_logs")
 
 	// Get all logs from the logDir that match the daemons the user cares about.
@@ -159,7 +183,11 @@ func (gl *gatherLogsArgs) gatherLogs(ctx context.Context, cmd *cobra.Command, st
 			if strings.Contains(entry.Name(), logType) {
 				srcFile := fmt.Sprintf("%s/%s", logDir, entry.Name())
 				dstFile := fmt.Sprintf("%s/%s", exportDir, entry.Name())
-				if err := copyFiles(dstFile, srcFile); err != nil {
+				var since time.Time
+				if gl.since > 0 {
+					since = time.Now().Add(-gl.since)
+				}
+				if err := copyLogFile(dstFile, srcFile, since, gl.tail); err != nil {
 					// We don't want to fail / exit abruptly if we can't copy certain
 					// files, but we do want the user to know we were unsuccessful
 					fmt.Fprintf(stderr, "failed exporting %s: %s\n", entry.Name(), err)
@@ -175,9 +203,15 @@ func (gl *gatherLogsArgs) gatherLogs(ctx context.Context, cmd *cobra.Command, st
 		// To get logs from the components in the kubernetes cluster, we ask the
 		// traffic-manager.
 		rq := &manager.GetLogsRequest{
-			TrafficManager: gl.trafficManager,
-			Agents:         gl.trafficAgents,
-			GetPodYaml:     gl.podYaml,
+			TrafficManager:  gl.trafficManager,
+			Agents:          gl.trafficAgents,
+			GetPodYaml:      gl.podYaml,
+			TailLines:       gl.tail,
+			AgentsNamespace: gl.agentsNs,
+			AgentsSelector:  gl.agentsSelector,
+		}
+		if gl.since > 0 {
+			rq.Since = durationpb.New(gl.since)
 		}
 		err = withConnector(cmd, false, nil, func(_ context.Context, _ *connectorState) error {
 			err = cliutil.WithManager(ctx, func(ctx context.Context, managerClient manager.ManagerClient) error {
@@ -270,6 +304,73 @@ func writeResponseToFiles(lr *manager.LogsResponse, anonymizer *anonymizer, expo
 	return nil
 }
 
+// copyLogFile copies a log file from one location into another. Lines older than since are
+// skipped unless since is zero, and only the last tail lines are copied unless tail is zero.
+// Lines that don't start with a timestamp, such as the continuation lines of a stack trace,
+// are considered to be as old as the line before them.
+func copyLogFile(dstFile, srcFile string, since time.Time, tail int64) error {
+	if since.IsZero() && tail == 0 {
+		return copyFiles(dstFile, srcFile)
+	}
+	src, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var lines []string
+	keep := since.IsZero()
+	sc := bufio.NewScanner(src)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if !keep {
+			if ts, ok := logLineTime(line); ok {
+				keep = !ts.Before(since)
+			}
+		}
+		if !keep {
+			continue
+		}
+		lines = append(lines, line)
+		if tail > 0 && int64(len(lines)) > tail {
+			lines = lines[1:]
+		}
+	}
+	if err = sc.Err(); err != nil {
+		return err
+	}
+
+	dst, err := os.Create(dstFile)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	w := bufio.NewWriter(dst)
+	for _, line := range lines {
+		if _, err = w.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// logLineTime returns the timestamp of a log line written in either the text or the JSON log format.
+func logLineTime(line string) (time.Time, bool) {
+	if strings.HasPrefix(line, "{") {
+		if je, err := log.ParseJSONEntry([]byte(line)); err == nil {
+			return je.Time, true
+		}
+		return time.Time{}, false
+	}
+	if len(line) >= len(log.TimestampFormat) {
+		if ts, err := time.ParseInLocation(log.TimestampFormat, line[:len(log.TimestampFormat)], time.Local); err == nil {
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
 // copyFiles copies files from one location into another.
 func copyFiles(dstFile, srcFile string) error {
 	srcWriter, err := os.Open(srcFile)
@@ -2,10 +2,13 @@ package cli
 
 import (
 	"archive/zip"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,6 +18,7 @@ import (
 
 	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+	"github.com/telepresenceio/telepresence/v2/pkg/log"
 )
 
 func Test_gatherLogsZipFiles(t *testing.T) {
@@ -163,6 +167,64 @@ func Test_gatherLogsCopyFiles(t *testing.T) {
 	}
 }
 
+func Test_gatherLogsCopyLogFile(t *testing.T) {
+	now := time.Now()
+	ts := func(ago time.Duration) string {
+		return now.Add(-ago).Format(log.TimestampFormat)
+	}
+	dir := t.TempDir()
+	srcFile := filepath.Join(dir, "connector.log")
+	require.NoError(t, os.WriteFile(srcFile, []byte(fmt.Sprintf(`%s info    old line
+%s error   older than an hour
+goroutine 1 [running]:
+%s info    recent line
+goroutine 2 [running]:
+%s debug   latest line
+`, ts(3*time.Hour), ts(2*time.Hour), ts(30*time.Minute), ts(time.Minute))), 0o600))
+
+	read := func(since time.Time, tail int64) []string {
+		dstFile := filepath.Join(dir, "copy.log")
+		require.NoError(t, copyLogFile(dstFile, srcFile, since, tail))
+		data, err := os.ReadFile(dstFile)
+		require.NoError(t, err)
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+
+	lines := read(now.Add(-time.Hour), 0)
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "recent line")
+	assert.Equal(t, "goroutine 2 [running]:", lines[1])
+
+	lines = read(time.Time{}, 2)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "goroutine 2 [running]:", lines[0])
+	assert.Contains(t, lines[1], "latest line")
+
+	lines = read(now.Add(-time.Hour), 1)
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "latest line")
+}
+
+func Test_gatherLogsCopyJSONLogFile(t *testing.T) {
+	now := time.Now()
+	entry := func(ago time.Duration, msg string) string {
+		data, err := json.Marshal(&log.JSONEntry{Time: now.Add(-ago), Level: "info", Message: msg})
+		require.NoError(t, err)
+		return string(data)
+	}
+	dir := t.TempDir()
+	srcFile := filepath.Join(dir, "connector.log")
+	require.NoError(t, os.WriteFile(srcFile, []byte(entry(2*time.Hour, "old line")+"\n"+entry(time.Minute, "latest line")+"\n"), 0o600))
+
+	dstFile := filepath.Join(dir, "copy.log")
+	require.NoError(t, copyLogFile(dstFile, srcFile, now.Add(-time.Hour), 0))
+	data, err := os.ReadFile(dstFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"msg":"latest line"`)
+}
+
 func Test_gatherLogsNoK8s(t *testing.T) {
 	type testcase struct {
 		name       string
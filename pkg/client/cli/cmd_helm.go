@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	admreg "k8s.io/api/admissionregistration/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/k8s"
+	"github.com/telepresenceio/telepresence/v2/pkg/install/helm"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+type helmArgs struct {
+	kubeFlags   *pflag.FlagSet
+	valuesFiles []string
+	values      []string
+	reuseValues bool
+
+	webhookFailurePolicy     string
+	webhookNamespaceSelector string
+}
+
+func helmCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  "helm",
+		Args: OnlySubcommands,
+
+		Short: "Install, upgrade, or uninstall the traffic-manager",
+		Long: `Install, upgrade, or uninstall the traffic-manager using the Helm chart that is embedded in telepresence.
+
+The traffic-manager is installed in the namespace given by the manager.namespace of the kubeconfig extension,
+the cluster.managerNamespace of the config, or the TELEPRESENCE_MANAGER_NAMESPACE environment variable, and
+defaults to "ambassador".`,
+		RunE: RunSubcommands,
+	}
+	cmd.AddCommand(helmInstallCommand(), helmUpgradeCommand(), helmUninstallCommand())
+	return cmd
+}
+
+func helmInstallCommand() *cobra.Command {
+	ha := &helmArgs{}
+	cmd := &cobra.Command{
+		Use:   "install",
+		Args:  cobra.NoArgs,
+		Short: "Install the traffic-manager",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			req, err := ha.request()
+			if err != nil {
+				return err
+			}
+			return ha.run(cmd, "Traffic Manager installed", func(ctx context.Context, cfg *k8s.Config) error {
+				return helm.InstallTrafficManager(ctx, cfg.ConfigFlags, cfg.GetManagerNamespace(), req)
+			})
+		},
+	}
+	ha.addFlags(cmd, false)
+	return cmd
+}
+
+func helmUpgradeCommand() *cobra.Command {
+	ha := &helmArgs{}
+	cmd := &cobra.Command{
+		Use:   "upgrade",
+		Args:  cobra.NoArgs,
+		Short: "Upgrade the traffic-manager to the version of this client",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			req, err := ha.request()
+			if err != nil {
+				return err
+			}
+			return ha.run(cmd, "Traffic Manager upgraded", func(ctx context.Context, cfg *k8s.Config) error {
+				return helm.UpgradeTrafficManager(ctx, cfg.ConfigFlags, cfg.GetManagerNamespace(), req)
+			})
+		},
+	}
+	ha.addFlags(cmd, true)
+	return cmd
+}
+
+func helmUninstallCommand() *cobra.Command {
+	ha := &helmArgs{}
+	cmd := &cobra.Command{
+		Use:   "uninstall",
+		Args:  cobra.NoArgs,
+		Short: "Uninstall the traffic-manager",
+		Long: `Uninstall the traffic-manager. Use "telepresence uninstall --everything" to also remove the
+traffic-agents from the workloads.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return ha.run(cmd, "Traffic Manager uninstalled", func(ctx context.Context, cfg *k8s.Config) error {
+				// A session can't survive the removal of its traffic-manager
+				if err := cliutil.Disconnect(ctx, false, false); err != nil {
+					return err
+				}
+				return helm.UninstallTrafficManager(ctx, cfg.ConfigFlags, cfg.GetManagerNamespace())
+			})
+		},
+	}
+	ha.addKubeFlags(cmd)
+	return cmd
+}
+
+func (ha *helmArgs) addFlags(cmd *cobra.Command, upgrade bool) {
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&ha.valuesFiles, "values", "f", nil,
+		"Specify values in a YAML file (can specify multiple)")
+	flags.StringArrayVar(&ha.values, "set", nil,
+		"Set values on the command line, e.g. --set key1=val1,key2=val2 (can specify multiple)")
+	flags.StringVar(&ha.webhookFailurePolicy, "webhook-failure-policy", "",
+		`The failure policy of the agent-injector webhook, "Ignore" or "Fail"`)
+	flags.StringVar(&ha.webhookNamespaceSelector, "webhook-namespace-selector", "",
+		`A label selector, e.g. "env in (dev,test)", for the namespaces where the agent-injector webhook is called`)
+	if upgrade {
+		flags.BoolVar(&ha.reuseValues, "reuse-values", false,
+			"Reuse the values of the installed release and merge in the values given on the command line")
+	}
+	ha.addKubeFlags(cmd)
+}
+
+func (ha *helmArgs) addKubeFlags(cmd *cobra.Command) {
+	ha.kubeFlags = pflag.NewFlagSet("Kubernetes flags", 0)
+	kubeConfig := genericclioptions.NewConfigFlags(false)
+	kubeConfig.Namespace = nil // the namespace is the manager namespace
+	kubeConfig.AddFlags(ha.kubeFlags)
+	cmd.Flags().AddFlagSet(ha.kubeFlags)
+}
+
+func (ha *helmArgs) request() (*helm.Request, error) {
+	req := &helm.Request{
+		ValuesFiles: ha.valuesFiles,
+		Values:      ha.values,
+		ReuseValues: ha.reuseValues,
+	}
+	webhook := make(map[string]interface{})
+	switch ha.webhookFailurePolicy {
+	case "":
+	case string(admreg.Ignore), string(admreg.Fail):
+		webhook["failurePolicy"] = ha.webhookFailurePolicy
+	default:
+		return nil, errcat.User.Newf(`invalid webhook failure policy %q, must be "Ignore" or "Fail"`, ha.webhookFailurePolicy)
+	}
+	if ha.webhookNamespaceSelector != "" {
+		selector, err := meta.ParseToLabelSelector(ha.webhookNamespaceSelector)
+		if err != nil {
+			return nil, errcat.User.Newf("invalid webhook namespace selector: %w", err)
+		}
+		webhook["namespaceSelector"] = selector
+	}
+	if len(webhook) > 0 {
+		var err error
+		vals := map[string]interface{}{"agentInjector": map[string]interface{}{"webhook": webhook}}
+		if req.ValuesJSON, err = json.Marshal(vals); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// run loads the kubernetes config selected by the kubernetes flags, and calls f with a context that provides
+// the kubernetes interface. The given message is printed when f succeeds.
+func (ha *helmArgs) run(cmd *cobra.Command, done string, f func(context.Context, *k8s.Config) error) error {
+	ctx := cmd.Context()
+	cfg, err := k8s.NewConfig(ctx, kubeFlagMap(ha.kubeFlags))
+	if err != nil {
+		return err
+	}
+	restConfig, err := cfg.ConfigFlags.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+	ki, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	if err = f(k8sapi.WithK8sInterface(ctx, ki), cfg); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s in namespace %s\n", done, cfg.GetManagerNamespace())
+	return nil
+}
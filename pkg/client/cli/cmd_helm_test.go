@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelmArgs_request(t *testing.T) {
+	ha := &helmArgs{values: []string{"logLevel=debug"}}
+	req, err := ha.request()
+	require.NoError(t, err)
+	assert.Empty(t, req.ValuesJSON)
+
+	ha.webhookFailurePolicy = "Fail"
+	ha.webhookNamespaceSelector = "env in (dev,test),team=blue"
+	req, err = ha.request()
+	require.NoError(t, err)
+	vals, err := req.UserValues()
+	require.NoError(t, err)
+	assert.Equal(t, "debug", vals["logLevel"])
+	webhook := vals["agentInjector"].(map[string]interface{})["webhook"].(map[string]interface{})
+	assert.Equal(t, "Fail", webhook["failurePolicy"])
+	selector := webhook["namespaceSelector"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"team": "blue"}, selector["matchLabels"])
+	assert.Len(t, selector["matchExpressions"], 1)
+
+	ha.webhookFailurePolicy = "Retry"
+	_, err = ha.request()
+	assert.Error(t, err)
+
+	ha.webhookFailurePolicy = ""
+	ha.webhookNamespaceSelector = "env in dev"
+	_, err = ha.request()
+	assert.Error(t, err)
+}
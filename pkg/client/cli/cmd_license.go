@@ -2,27 +2,52 @@ package cli
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	k8sjson "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
 
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/k8s"
 )
 
+// licenseSecretName is the name of the secret that the traffic-manager reads its license from.
+const licenseSecretName = "systema-license"
+
+// defaultLicenseHostDomain is the host domain of licenses that are read from a file.
+const defaultLicenseHostDomain = "auth.datawire.io"
+
+type licenseCreateFlags struct {
+	id          string
+	outputFile  string
+	licenseFile string
+	hostDomain  string
+}
+
+func (f *licenseCreateFlags) addFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&f.id, "id", "i", "", "The id associated with your license.")
+	flags.StringVarP(&f.outputFile, "output-file", "o", "", "The file where you want the license secret to be output to")
+	flags.StringVarP(&f.licenseFile, "license-file", "f", "", "The file containing your license if you've downloaded it already")
+	flags.StringVarP(&f.hostDomain, "host-domain", "d", defaultLicenseHostDomain, "The host domain providing your license")
+}
+
 func LicenseCommand() *cobra.Command {
-	var flags struct {
-		id          string
-		outputFile  string
-		licenseFile string
-		hostDomain  string
-	}
+	var flags licenseCreateFlags
 	cmd := &cobra.Command{
 		Use:  "license [flags]",
 		Args: cobra.NoArgs,
@@ -30,18 +55,104 @@ func LicenseCommand() *cobra.Command {
 		Short: "Get License from Ambassador Cloud",
 		Long: `Get License from Ambassador Cloud. For more information on what
 licenses are used for, head to:
-https://www.getambassador.io/docs/telepresence/latest/reference/cluster-config/`,
+https://www.getambassador.io/docs/telepresence/latest/reference/cluster-config/
+
+Without a subcommand, this is the same as "telepresence license create".`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return getCloudLicense(cmd.Context(), cmd.OutOrStdout(),
+				flags.id, flags.outputFile, flags.licenseFile, flags.hostDomain)
+		},
+	}
+	flags.addFlags(cmd.Flags())
+	cmd.AddCommand(licenseCreateCommand(), licenseStatusCommand(), licenseRenewCommand())
+	return cmd
+}
+
+func licenseCreateCommand() *cobra.Command {
+	var flags licenseCreateFlags
+	cmd := &cobra.Command{
+		Use:  "create [flags]",
+		Args: cobra.NoArgs,
+
+		Short: "Create the Kubernetes secret manifest for a license",
+		Long: `Create the manifest of the Kubernetes secret that the traffic-manager reads its license from. The
+license is either retrieved from Ambassador Cloud using its --id, or read from a --license-file, which
+makes it possible to create the manifest for an air-gapped cluster. Apply the manifest with kubectl.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return getCloudLicense(cmd.Context(), cmd.OutOrStdout(),
 				flags.id, flags.outputFile, flags.licenseFile, flags.hostDomain)
 		},
 	}
+	flags.addFlags(cmd.Flags())
+	return cmd
+}
+
+func licenseStatusCommand() *cobra.Command {
+	var licenseFile string
+	var kubeFlags *pflag.FlagSet
+	cmd := &cobra.Command{
+		Use:  "status [flags]",
+		Args: cobra.NoArgs,
+
+		Short: "Show the expiry and entitlements of a license",
+		Long: `Show the expiry and entitlements of the license in the given --license-file, or, when no file is given,
+of the license in the cluster's "systema-license" secret. The license isn't verified.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			license, hostDomain, err := loadLicense(cmd.Context(), licenseFile, kubeFlags)
+			if err != nil {
+				return err
+			}
+			li, err := parseLicense(license)
+			if err != nil {
+				return err
+			}
+			li.print(cmd.OutOrStdout(), hostDomain, time.Now())
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&licenseFile, "license-file", "f", "", "The file containing the license, or the license secret manifest")
+	kubeFlags = pflag.NewFlagSet("Kubernetes flags", 0)
+	genericclioptions.NewConfigFlags(false).AddFlags(kubeFlags)
+	cmd.Flags().AddFlagSet(kubeFlags)
+	return cmd
+}
 
-	cmd.Flags().StringVarP(&flags.id, "id", "i", "", "The id associated with your license.")
+func licenseRenewCommand() *cobra.Command {
+	var id, licenseFile, outputFile string
+	var kubeFlags *pflag.FlagSet
+	cmd := &cobra.Command{
+		Use:  "renew [flags]",
+		Args: cobra.NoArgs,
 
-	cmd.Flags().StringVarP(&flags.outputFile, "output-file", "o", "", "The file where you want the license secret to be output to")
-	cmd.Flags().StringVarP(&flags.licenseFile, "license-file", "f", "", "The file containing your license if you've downloaded it already")
-	cmd.Flags().StringVarP(&flags.hostDomain, "host-domain", "d", "auth.datawire.io", "The host domain providing your license")
+		Short: "Get a new copy of a license from Ambassador Cloud",
+		Long: `Get a new copy of a license from Ambassador Cloud and create the manifest of the Kubernetes secret for
+it. The license is identified by its --id, or by the id of the license in the given --license-file, or, when
+neither is given, of the license in the cluster's "systema-license" secret. Apply the manifest with kubectl.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if id == "" {
+				license, _, err := loadLicense(ctx, licenseFile, kubeFlags)
+				if err != nil {
+					return err
+				}
+				li, err := parseLicense(license)
+				if err != nil {
+					return err
+				}
+				if id = li.ID; id == "" {
+					return errcat.User.New("the license has no id, please use the --id flag")
+				}
+			}
+			return getCloudLicense(ctx, cmd.OutOrStdout(), id, outputFile, "", "")
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&id, "id", "i", "", "The id of the license to renew")
+	flags.StringVarP(&licenseFile, "license-file", "f", "", "The file containing the license to renew, or its secret manifest")
+	flags.StringVarP(&outputFile, "output-file", "o", "", "The file where you want the license secret to be output to")
+	kubeFlags = pflag.NewFlagSet("Kubernetes flags", 0)
+	genericclioptions.NewConfigFlags(false).AddFlags(kubeFlags)
+	flags.AddFlagSet(kubeFlags)
 	return cmd
 }
 
@@ -98,16 +209,16 @@ func createSecretFromLicense(ctx context.Context, writer io.Writer, license, hos
 			APIVersion: "v1",
 		},
 		ObjectMeta: meta.ObjectMeta{
-			Namespace: "ambassador",
-			Name:      "systema-license",
+			Namespace: client.GetManagerNamespace(ctx),
+			Name:      licenseSecretName,
 		},
 		Data: map[string][]byte{
 			"license":    []byte(license),
 			"hostDomain": []byte(hostDomain),
 		},
 	}
-	serializer := json.NewSerializerWithOptions(json.DefaultMetaFactory, nil, nil,
-		json.SerializerOptions{
+	serializer := k8sjson.NewSerializerWithOptions(k8sjson.DefaultMetaFactory, nil, nil,
+		k8sjson.SerializerOptions{
 			Yaml:   true,
 			Pretty: true,
 			Strict: true,
@@ -119,3 +230,147 @@ func createSecretFromLicense(ctx context.Context, writer io.Writer, license, hos
 	}
 	return nil
 }
+
+// loadLicense returns the license and its host domain. They are read from the given file, which contains
+// either the license itself or the manifest of its secret, or, when no file is given, from the license
+// secret in the cluster.
+func loadLicense(ctx context.Context, licenseFile string, kubeFlags *pflag.FlagSet) (string, string, error) {
+	if licenseFile != "" {
+		contents, err := os.ReadFile(licenseFile)
+		if err != nil {
+			return "", "", err
+		}
+		if license := strings.TrimSpace(string(contents)); strings.Count(license, ".") == 2 && !strings.ContainsAny(license, " \n") {
+			return license, defaultLicenseHostDomain, nil
+		}
+		var secret core.Secret
+		if err := yaml.NewYAMLOrJSONDecoder(strings.NewReader(string(contents)), 1000).Decode(&secret); err != nil {
+			return "", "", errcat.User.Newf("%s contains neither a license nor a license secret: %v", licenseFile, err)
+		}
+		return licenseFromSecret(&secret)
+	}
+
+	cfg, err := k8s.NewConfig(ctx, kubeFlagMap(kubeFlags))
+	if err != nil {
+		return "", "", err
+	}
+	restConfig, err := cfg.ConfigFlags.ToRESTConfig()
+	if err != nil {
+		return "", "", err
+	}
+	ki, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := ki.CoreV1().Secrets(cfg.GetManagerNamespace()).Get(ctx, licenseSecretName, meta.GetOptions{})
+	if err != nil {
+		return "", "", errcat.User.Newf("unable to get the license secret of the cluster: %v", err)
+	}
+	return licenseFromSecret(secret)
+}
+
+func licenseFromSecret(secret *core.Secret) (string, string, error) {
+	license := strings.TrimSpace(string(secret.Data["license"]))
+	if license == "" {
+		return "", "", errcat.User.Newf("secret %s has no license", secret.Name)
+	}
+	return license, string(secret.Data["hostDomain"]), nil
+}
+
+// licenseInfo is the information in the claims of a license.
+type licenseInfo struct {
+	ID        string
+	Subject   string
+	Issuer    string
+	IssuedAt  time.Time
+	NotBefore time.Time
+	Expires   time.Time
+
+	// Entitlements are all claims that aren't registered JWT claims
+	Entitlements map[string]interface{}
+}
+
+// parseLicense returns the information in the claims of the given JWT formatted license. The signature
+// of the license is not verified.
+func parseLicense(license string) (*licenseInfo, error) {
+	parts := strings.Split(license, ".")
+	if len(parts) != 3 {
+		return nil, errcat.User.New("the license is not a JSON Web Token")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, errcat.User.Newf("unable to decode the license claims: %v", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, errcat.User.Newf("unable to parse the license claims: %v", err)
+	}
+	li := &licenseInfo{Entitlements: make(map[string]interface{})}
+	for k, v := range claims {
+		switch k {
+		case "jti":
+			li.ID = fmt.Sprint(v)
+		case "sub":
+			li.Subject = fmt.Sprint(v)
+		case "iss":
+			li.Issuer = fmt.Sprint(v)
+		case "iat":
+			li.IssuedAt = claimTime(v)
+		case "nbf":
+			li.NotBefore = claimTime(v)
+		case "exp":
+			li.Expires = claimTime(v)
+		case "aud":
+		default:
+			li.Entitlements[k] = v
+		}
+	}
+	return li, nil
+}
+
+func claimTime(v interface{}) time.Time {
+	if secs, ok := v.(float64); ok {
+		return time.Unix(int64(secs), 0).UTC()
+	}
+	return time.Time{}
+}
+
+func (li *licenseInfo) print(out io.Writer, hostDomain string, now time.Time) {
+	printField := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(out, "%-12s: %s\n", name, value)
+		}
+	}
+	printTime := func(name string, t time.Time) {
+		if !t.IsZero() {
+			printField(name, t.Format(time.RFC3339))
+		}
+	}
+	printField("ID", li.ID)
+	printField("Subject", li.Subject)
+	printField("Issuer", li.Issuer)
+	printField("Host domain", hostDomain)
+	printTime("Issued", li.IssuedAt)
+	printTime("Not before", li.NotBefore)
+	switch {
+	case li.Expires.IsZero():
+		printField("Expires", "never")
+	case li.Expires.After(now):
+		printField("Expires", fmt.Sprintf("%s (in %s)", li.Expires.Format(time.RFC3339), li.Expires.Sub(now).Round(time.Minute)))
+	default:
+		printField("Expires", fmt.Sprintf("%s (expired %s ago)", li.Expires.Format(time.RFC3339), now.Sub(li.Expires).Round(time.Minute)))
+	}
+	if len(li.Entitlements) == 0 {
+		return
+	}
+	names := make([]string, 0, len(li.Entitlements))
+	for name := range li.Entitlements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(out, "Entitlements:")
+	for _, name := range names {
+		v, _ := json.Marshal(li.Entitlements[name])
+		fmt.Fprintf(out, "  %s: %s\n", name, v)
+	}
+}
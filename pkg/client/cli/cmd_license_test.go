@@ -3,14 +3,18 @@ package cli
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/yaml"
 
 	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
 )
 
 // getLicenseString is a helper function for reading the
@@ -77,4 +81,57 @@ func Test_createLicenseSecret(t *testing.T) {
 	}
 	assert.Equal(t, string(secret.Data["hostDomain"]), hostDomain)
 	assert.Equal(t, string(secret.Data["license"]), license)
+	assert.Equal(t, "ambassador", secret.Namespace)
+
+	// The secret is created in the configured manager namespace
+	cfg := client.Config{Cluster: client.Cluster{ManagerNamespace: "telepresence"}}
+	if err = getCloudLicense(client.WithConfig(ctx, &cfg), stdout, "", secretFile, licenseFile, hostDomain); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err = getSecret(secretFile); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "telepresence", secret.Namespace)
+}
+
+func Test_licenseStatus(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+
+	// The license file has the claims {"sub":"1234567890","name":"John Doe","iat":1516239022}
+	license, hostDomain, err := loadLicense(ctx, "testdata/license", nil)
+	require.NoError(t, err)
+	assert.Equal(t, defaultLicenseHostDomain, hostDomain)
+	li, err := parseLicense(license)
+	require.NoError(t, err)
+	assert.Equal(t, "1234567890", li.Subject)
+	assert.Equal(t, time.Unix(1516239022, 0).UTC(), li.IssuedAt)
+	assert.True(t, li.Expires.IsZero())
+	assert.Equal(t, map[string]interface{}{"name": "John Doe"}, li.Entitlements)
+
+	out := &strings.Builder{}
+	li.print(out, hostDomain, time.Now())
+	assert.Equal(t, ""+
+		"Subject     : 1234567890\n"+
+		"Host domain : auth.datawire.io\n"+
+		"Issued      : 2018-01-18T01:30:22Z\n"+
+		"Expires     : never\n"+
+		"Entitlements:\n"+
+		"  name: \"John Doe\"\n", out.String())
+
+	li.Expires = li.IssuedAt.Add(24 * time.Hour)
+	out.Reset()
+	li.print(out, "", li.IssuedAt.Add(25*time.Hour))
+	assert.Contains(t, out.String(), "Expires     : 2018-01-19T01:30:22Z (expired 1h0m0s ago)\n")
+
+	// The license can also be read from the secret manifest created by "telepresence license create"
+	secretFile := filepath.Join(t.TempDir(), "secret.yaml")
+	stdout := dlog.StdLogger(ctx, dlog.LogLevelInfo).Writer()
+	require.NoError(t, getCloudLicense(ctx, stdout, "", secretFile, "testdata/license", "test.datawire.io"))
+	secretLicense, hostDomain, err := loadLicense(ctx, secretFile, nil)
+	require.NoError(t, err)
+	assert.Equal(t, license, secretLicense)
+	assert.Equal(t, "test.datawire.io", hostDomain)
+
+	_, err = parseLicense("not a license")
+	assert.Error(t, err)
 }
@@ -2,7 +2,6 @@ package cli
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net"
 	"strings"
@@ -20,24 +19,33 @@ type listInfo struct {
 	debug             bool
 	namespace         string
 	json              bool
+	kinds             []string
+	labelSelector     string
 }
 
 func listCommand() *cobra.Command {
 	s := &listInfo{}
-	cmd := &cobra.Command{
+	cmd := withJSONOutput(&cobra.Command{
 		Use:  "list",
 		Args: cobra.NoArgs,
 
 		Short: "List current intercepts",
 		RunE:  s.list,
-	}
+	})
 	flags := cmd.Flags()
 	flags.BoolVarP(&s.onlyIntercepts, "intercepts", "i", false, "intercepts only")
+	flags.BoolVar(&s.onlyIntercepts, "intercepted-only", false, "intercepted workloads only, same as --intercepts")
 	flags.BoolVarP(&s.onlyAgents, "agents", "a", false, "with installed agents only")
 	flags.BoolVarP(&s.onlyInterceptable, "only-interceptable", "o", true, "interceptable workloads only")
 	flags.BoolVar(&s.debug, "debug", false, "include debugging information")
 	flags.StringVarP(&s.namespace, "namespace", "n", "", "If present, the namespace scope for this CLI request")
+	_ = cmd.RegisterFlagCompletionFunc("namespace", completeMappedNamespaces)
 	flags.BoolVarP(&s.json, "json", "j", false, "output as json array")
+	_ = flags.MarkDeprecated("json", "use --output json")
+	flags.StringSliceVar(&s.kinds, "kind", nil,
+		"workload kinds to list (Deployment, ReplicaSet, StatefulSet, or Rollout). Can be repeated or comma separated")
+	flags.StringVarP(&s.labelSelector, "label-selector", "l", "",
+		"kubernetes label selector that the listed workloads must match, e.g. 'app=web,tier!=backend'")
 	return cmd
 }
 
@@ -57,15 +65,27 @@ func (s *listInfo) list(cmd *cobra.Command, _ []string) error {
 		default:
 			filter = connector.ListRequest_EVERYTHING
 		}
-		r, err = cs.userD.List(ctx, &connector.ListRequest{Filter: filter, Namespace: s.namespace})
+		r, err = cs.userD.List(ctx, &connector.ListRequest{
+			Filter:        filter,
+			Namespace:     s.namespace,
+			Kinds:         s.kinds,
+			LabelSelector: s.labelSelector,
+		})
 		return err
 	})
 	if err != nil {
 		return err
 	}
-	stdout := cmd.OutOrStdout()
+	stdout := resultOutput(cmd)
+	if s.json || outputFormat(cmd) == outputFormatJSON {
+		workloads := r.Workloads
+		if workloads == nil {
+			workloads = []*connector.WorkloadInfo{}
+		}
+		return writeJSON(stdout, workloads)
+	}
 	if len(r.Workloads) == 0 {
-		fmt.Fprintln(stdout, "No Workloads (Deployments, StatefulSets, or ReplicaSets)")
+		fmt.Fprintln(stdout, "No Workloads (Deployments, StatefulSets, ReplicaSets, or Rollouts)")
 		return nil
 	}
 
@@ -96,21 +116,12 @@ func (s *listInfo) list(cmd *cobra.Command, _ []string) error {
 		}
 	}
 
-	if s.json {
-		msg, err := json.Marshal(r.Workloads)
-		if err != nil {
-			fmt.Fprintf(stdout, "json marshal error: %v", err)
+	for _, workload := range r.Workloads {
+		if workload.Name == "" {
+			// Local-only, so use name of intercept
+			fmt.Fprintf(stdout, "%-*s: local-only intercept\n", nameLen, workload.InterceptInfo.Spec.Name)
 		} else {
-			fmt.Fprintf(stdout, "%s", msg)
-		}
-	} else {
-		for _, workload := range r.Workloads {
-			if workload.Name == "" {
-				// Local-only, so use name of intercept
-				fmt.Fprintf(stdout, "%-*s: local-only intercept\n", nameLen, workload.InterceptInfo.Spec.Name)
-			} else {
-				fmt.Fprintf(stdout, "%-*s: %s\n", nameLen, workload.Name, state(workload))
-			}
+			fmt.Fprintf(stdout, "%-*s: %s\n", nameLen, workload.Name, state(workload))
 		}
 	}
 	return nil
@@ -168,14 +179,12 @@ func DescribeIntercept(ii *manager.InterceptInfo, volumeMountsPrevented error, d
 		return ii.MechanismArgsDesc
 	}()})
 
+	if debug {
+		fields = append(fields, kv{"Traffic", describeInterceptStats(ii.Stats)})
+	}
+
 	if ii.PreviewDomain != "" {
-		previewURL := ii.PreviewDomain
-		// Right now SystemA gives back domains with the leading "https://", but
-		// let's not rely on that.
-		if !strings.HasPrefix(previewURL, "https://") && !strings.HasPrefix(previewURL, "http://") {
-			previewURL = "https://" + previewURL
-		}
-		fields = append(fields, kv{"Preview URL", previewURL})
+		fields = append(fields, kv{"Preview URL", previewURL(ii.PreviewDomain)})
 	}
 	if l5Hostname := ii.GetPreviewSpec().GetIngress().GetL5Host(); l5Hostname != "" {
 		fields = append(fields, kv{"Layer 5 Hostname", l5Hostname})
@@ -196,3 +205,23 @@ func DescribeIntercept(ii *manager.InterceptInfo, volumeMountsPrevented error, d
 	}
 	return msg
 }
+
+// describeInterceptStats returns a one line description of the traffic counters of an intercept.
+func describeInterceptStats(st *manager.InterceptStats) string {
+	return fmt.Sprintf("%d connections (%d active), %s in, %s out",
+		st.GetConnections(), st.GetActiveConnections(), formatByteCount(st.GetBytesIn()), formatByteCount(st.GetBytesOut()))
+}
+
+// formatByteCount formats a number of bytes using binary prefixes, e.g. "1.5 KiB".
+func formatByteCount(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for q := n / unit; q >= unit; q /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
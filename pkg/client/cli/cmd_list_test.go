@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+func TestDescribeInterceptStats(t *testing.T) {
+	assert.Equal(t, "0 connections (0 active), 0 B in, 0 B out", describeInterceptStats(nil))
+	assert.Equal(t, "12 connections (2 active), 1023 B in, 1.5 KiB out", describeInterceptStats(&manager.InterceptStats{
+		Connections:       12,
+		ActiveConnections: 2,
+		BytesIn:           1023,
+		BytesOut:          1536,
+	}))
+	assert.Equal(t, "3.0 MiB", formatByteCount(3<<20))
+	assert.Equal(t, "1.0 GiB", formatByteCount(1<<30))
+}
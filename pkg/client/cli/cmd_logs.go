@@ -0,0 +1,377 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+)
+
+type logsArgs struct {
+	follow         bool
+	daemons        string
+	trafficManager bool
+	trafficAgents  string
+	tail           int64
+	agentsNs       string
+	agentsSelector string
+	noColor        bool
+}
+
+// logFollowInterval is how often a followed log file is checked for new lines.
+const logFollowInterval = 250 * time.Millisecond
+
+func logsCommand() *cobra.Command {
+	la := &logsArgs{}
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Args:  cobra.NoArgs,
+		Short: "Show the logs of the user and root daemons, and optionally the traffic-manager and traffic-agents.",
+		Long: `Show the logs of the user and root daemons, and optionally the traffic-manager and traffic-agents,
+merged into one stream where each line is prefixed with the name of its source. Use --follow to keep
+streaming new lines as they are logged.`,
+		Example: `Here are a few examples of how you can use this command:
+# Follow the logs of the user and root daemons
+telepresence logs -f
+
+# Follow the logs of the daemons, the traffic-manager, and the traffic-agents of pods that have "echo-easy" in the name
+telepresence logs -f --traffic-manager --traffic-agents=echo-easy
+
+# Show the last 100 lines of the traffic-manager log
+telepresence logs --daemons=None --traffic-manager --tail=100
+`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return la.logs(cmd)
+		},
+	}
+	flags := cmd.Flags()
+	flags.BoolVarP(&la.follow, "follow", "f", false, "Keep streaming new log lines as they are logged")
+	flags.StringVar(&la.daemons, "daemons", "all", "The daemons you want logs from: all, root, user, None")
+	flags.BoolVar(&la.trafficManager, "traffic-manager", false, "If you want logs from the traffic-manager")
+	flags.StringVar(&la.trafficAgents, "traffic-agents", "None", "Traffic-agents to show logs from: all, name substring, None")
+	flags.Int64Var(&la.tail, "tail", 10, "Show this many lines from the end of each log before following it. Use 0 to show all lines")
+	flags.StringVar(&la.agentsNs, "traffic-agents-namespace", "", "Only show logs from traffic-agents in this namespace")
+	flags.StringVar(&la.agentsSelector, "traffic-agents-selector", "",
+		"Only show logs from traffic-agents in pods that match this label selector, e.g. app=echo")
+	flags.BoolVar(&la.noColor, "no-color", false, "Don't colorize the source prefix of each line")
+	return cmd
+}
+
+// logLine is a line from the log of one of the sources that the logs command shows.
+type logLine struct {
+	source string
+	line   string
+
+	// remote is true for lines logged in the cluster, where the timestamps are in UTC
+	remote bool
+}
+
+func (la *logsArgs) logs(cmd *cobra.Command) error {
+	var daemonLogs []string
+	switch la.daemons {
+	case "all":
+		daemonLogs = []string{"connector", "daemon"}
+	case "root":
+		daemonLogs = []string{"daemon"}
+	case "user":
+		daemonLogs = []string{"connector"}
+	case "None":
+	default:
+		return errcat.User.New("Options for --daemons are: all, root, user, or None")
+	}
+	if la.tail < 0 {
+		return errcat.User.New("--tail must be a positive number")
+	}
+	fromCluster := la.trafficManager || la.trafficAgents != "None"
+	if len(daemonLogs) == 0 && !fromCluster {
+		return errcat.User.New("no logs selected")
+	}
+
+	ctx := cmd.Context()
+	logDir, err := filelocation.AppUserLogDir(ctx)
+	if err != nil {
+		return errcat.User.New(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lines := make(chan logLine)
+	errs := make(chan error, len(daemonLogs)+1)
+	wg := sync.WaitGroup{}
+	wg.Add(len(daemonLogs))
+	for _, name := range daemonLogs {
+		go func(name string) {
+			defer wg.Done()
+			if err := tailLogFile(ctx, filepath.Join(logDir, name+".log"), la.tail, la.follow, func(line string) bool {
+				return sendLogLine(ctx, lines, logLine{source: name, line: line})
+			}); err != nil {
+				errs <- fmt.Errorf("%s: %w", name, err)
+			}
+		}(name)
+	}
+	if fromCluster {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := la.streamClusterLogs(ctx, cmd, lines); err != nil {
+				errs <- fmt.Errorf("error getting logs from kubernetes components: %w", err)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+		close(errs)
+	}()
+
+	stdout := cmd.OutOrStdout()
+	color := !la.noColor && os.Getenv("NO_COLOR") == "" && stdout == os.Stdout && term.IsTerminal(int(os.Stdout.Fd()))
+	lp := newLogPrinter(stdout, color)
+	if la.follow {
+		for ll := range lines {
+			lp.print(ll)
+		}
+	} else {
+		var all []logLine
+		for ll := range lines {
+			all = append(all, ll)
+		}
+		for _, ll := range mergeLogLines(all) {
+			lp.print(ll)
+		}
+	}
+	for err := range errs {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+	}
+	return nil
+}
+
+func sendLogLine(ctx context.Context, lines chan<- logLine, ll logLine) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case lines <- ll:
+		return true
+	}
+}
+
+// streamClusterLogs asks the traffic-manager to stream the logs of itself and the traffic-agents.
+func (la *logsArgs) streamClusterLogs(ctx context.Context, cmd *cobra.Command, lines chan<- logLine) error {
+	rq := &manager.StreamLogsRequest{
+		TrafficManager:  la.trafficManager,
+		Agents:          la.trafficAgents,
+		TailLines:       la.tail,
+		AgentsNamespace: la.agentsNs,
+		AgentsSelector:  la.agentsSelector,
+		Follow:          la.follow,
+	}
+	return withConnector(cmd, false, nil, func(_ context.Context, _ *connectorState) error {
+		return cliutil.WithManager(ctx, func(ctx context.Context, managerClient manager.ManagerClient) error {
+			stream, err := managerClient.StreamLogs(ctx, rq)
+			if err != nil {
+				return err
+			}
+			for {
+				ll, err := stream.Recv()
+				if err != nil {
+					if errors.Is(err, io.EOF) || ctx.Err() != nil {
+						return nil
+					}
+					return err
+				}
+				source := ll.Pod
+				if ll.Container == "traffic-manager" {
+					source = "traffic-manager"
+				}
+				if !sendLogLine(ctx, lines, logLine{source: source, line: ll.Line, remote: true}) {
+					return nil
+				}
+			}
+		})
+	})
+}
+
+// tailLogFile calls emit for each of the last tail lines of the given file, or for all of them when tail is
+// zero. When follow is true, it then keeps calling emit for each new line that is appended to the file until
+// the context is cancelled or emit returns false. A file that is rotated is reopened. A missing file is
+// awaited when following.
+func tailLogFile(ctx context.Context, path string, tail int64, follow bool, emit func(string) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if !(follow && os.IsNotExist(err)) {
+			return err
+		}
+		f = nil
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	if f != nil {
+		last, err := lastLines(f, tail)
+		if err != nil {
+			return err
+		}
+		for _, line := range last {
+			if !emit(line) {
+				return nil
+			}
+		}
+	}
+	if !follow {
+		return nil
+	}
+
+	var rd *bufio.Reader
+	if f != nil {
+		rd = bufio.NewReader(f)
+	}
+	var partial string
+	ticker := time.NewTicker(logFollowInterval)
+	defer ticker.Stop()
+	for {
+		if rd != nil {
+			for {
+				s, err := rd.ReadString('\n')
+				if err != nil {
+					// Retain the incomplete line until the rest of it has been written
+					partial += s
+					break
+				}
+				if !emit(strings.TrimRight(partial+s, "\r\n")) {
+					return nil
+				}
+				partial = ""
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// Reopen the file when it has been replaced or truncated by a log rotation
+		st, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if f != nil {
+			fst, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			pos, err := f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			if os.SameFile(st, fst) && st.Size() >= pos {
+				continue
+			}
+			f.Close()
+		}
+		if f, err = os.Open(path); err != nil {
+			f, rd = nil, nil
+			continue
+		}
+		rd = bufio.NewReader(f)
+		partial = ""
+	}
+}
+
+// lastLines reads the given file to its end and returns its last n lines, or all of them if n is zero.
+func lastLines(f *os.File, n int64) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+		if n > 0 && int64(len(lines)) > 2*n {
+			// Keep the memory footprint down when reading large files
+			lines = append(lines[:0], lines[int64(len(lines))-n:]...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if n > 0 && int64(len(lines)) > n {
+		lines = lines[int64(len(lines))-n:]
+	}
+	// The scanner may have read beyond the last line terminator
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// mergeLogLines sorts the given lines by their timestamps, retaining the order of the lines of each source.
+// A line without a timestamp, such as a line of a stack trace, stays with the line that precedes it.
+func mergeLogLines(lines []logLine) []logLine {
+	type timedLine struct {
+		logLine
+		ts time.Time
+	}
+	lastTS := make(map[string]time.Time)
+	tls := make([]timedLine, len(lines))
+	for i, ll := range lines {
+		ts, ok := logLineTime(ll.line)
+		if ok {
+			if ll.remote {
+				ts = time.Date(ts.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), time.UTC)
+			}
+			lastTS[ll.source] = ts
+		} else {
+			ts = lastTS[ll.source]
+		}
+		tls[i] = timedLine{logLine: ll, ts: ts}
+	}
+	sort.SliceStable(tls, func(i, j int) bool {
+		return tls[i].ts.Before(tls[j].ts)
+	})
+	for i, tl := range tls {
+		lines[i] = tl.logLine
+	}
+	return lines
+}
+
+// logSourceColors are the ANSI colors of the source prefixes. Red is omitted since it suggests an error.
+var logSourceColors = []int{36, 32, 33, 35, 34, 96, 92, 93, 95, 94}
+
+// logPrinter prints log lines prefixed with their source. The prefix of each source has its own color.
+type logPrinter struct {
+	out    io.Writer
+	color  bool
+	colors map[string]int
+}
+
+func newLogPrinter(out io.Writer, color bool) *logPrinter {
+	return &logPrinter{out: out, color: color, colors: make(map[string]int)}
+}
+
+func (lp *logPrinter) print(ll logLine) {
+	if !lp.color {
+		fmt.Fprintf(lp.out, "%s | %s\n", ll.source, ll.line)
+		return
+	}
+	c, ok := lp.colors[ll.source]
+	if !ok {
+		c = logSourceColors[len(lp.colors)%len(logSourceColors)]
+		lp.colors[ll.source] = c
+	}
+	fmt.Fprintf(lp.out, "\x1b[%dm%s\x1b[0m | %s\n", c, ll.source, ll.line)
+}
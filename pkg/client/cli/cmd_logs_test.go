@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_tailLogFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "connector.log")
+	require.NoError(t, os.WriteFile(path, []byte("one\ntwo\nthree\nfour\n"), 0o600))
+
+	collect := func(tail int64) []string {
+		var lines []string
+		require.NoError(t, tailLogFile(context.Background(), path, tail, false, func(line string) bool {
+			lines = append(lines, line)
+			return true
+		}))
+		return lines
+	}
+	assert.Equal(t, []string{"three", "four"}, collect(2))
+	assert.Equal(t, []string{"one", "two", "three", "four"}, collect(0))
+	assert.Equal(t, []string{"one", "two", "three", "four"}, collect(10))
+
+	assert.Error(t, tailLogFile(context.Background(), filepath.Join(dir, "daemon.log"), 0, false, func(string) bool { return true }))
+}
+
+func Test_tailLogFileFollow(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "connector.log")
+	require.NoError(t, os.WriteFile(path, []byte("one\ntwo\n"), 0o600))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	lines := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- tailLogFile(ctx, path, 1, true, func(line string) bool {
+			lines <- line
+			return true
+		})
+	}()
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-ctx.Done():
+			return ""
+		}
+	}
+	assert.Equal(t, "two", next())
+
+	// Lines are emitted once they are complete
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString("thr")
+	require.NoError(t, err)
+	time.Sleep(2 * logFollowInterval)
+	_, err = f.WriteString("ee\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, "three", next())
+
+	if runtime.GOOS != "windows" {
+		// A rotated file is reopened. Windows doesn't allow renaming a file that is open.
+		require.NoError(t, os.Rename(path, filepath.Join(dir, "connector-old.log")))
+		require.NoError(t, os.WriteFile(path, []byte("four\n"), 0o600))
+		assert.Equal(t, "four", next())
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func Test_mergeLogLines(t *testing.T) {
+	ts := func(sec int) string {
+		return time.Date(2021, 10, 1, 12, 0, sec, 0, time.Local).Format("2006-01-02 15:04:05.0000")
+	}
+	lines := []logLine{
+		{source: "connector", line: ts(1) + " info    first"},
+		{source: "connector", line: ts(4) + " error   fourth"},
+		{source: "connector", line: "  stack trace of fourth"},
+		{source: "daemon", line: ts(2) + " info    second"},
+		{source: "daemon", line: ts(5) + " info    fifth"},
+		{source: "daemon", line: ts(3) + " info    third, but logged after fifth"},
+	}
+	merged := mergeLogLines(append([]logLine{}, lines...))
+	assert.Equal(t, []logLine{lines[0], lines[3], lines[5], lines[1], lines[2], lines[4]}, merged)
+}
+
+func Test_logPrinter(t *testing.T) {
+	buf := bytes.Buffer{}
+	lp := newLogPrinter(&buf, false)
+	lp.print(logLine{source: "daemon", line: "hello"})
+	assert.Equal(t, "daemon | hello\n", buf.String())
+
+	buf.Reset()
+	lp = newLogPrinter(&buf, true)
+	lp.print(logLine{source: "daemon", line: "hello"})
+	lp.print(logLine{source: "connector", line: "hi"})
+	lp.print(logLine{source: "daemon", line: "again"})
+	assert.Equal(t, "\x1b[36mdaemon\x1b[0m | hello\n\x1b[32mconnector\x1b[0m | hi\n\x1b[36mdaemon\x1b[0m | again\n", buf.String())
+}
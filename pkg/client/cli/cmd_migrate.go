@@ -0,0 +1,342 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/shellquote"
+)
+
+// migration is the result of migrating one command or configuration entry of another tool.
+type migration struct {
+	// origin describes what was migrated, e.g. "line 3" or "okteto dev \"api\""
+	origin string
+
+	// command is the equivalent telepresence command, or empty if there is none
+	command string
+
+	// notes about features that weren't migrated, or that behave differently in telepresence
+	notes []string
+}
+
+func migrateCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:  "migrate",
+		Args: OnlySubcommands,
+
+		Short: "Migrate from Telepresence 1, okteto, or ksync.",
+		Long: `Read the command lines of Telepresence 1, or the configuration of okteto or ksync, and write a shell script
+with the equivalent telepresence commands. Features that have no equivalent are flagged by comments in the script.`,
+		RunE: RunSubcommands,
+	}
+	cmd.PersistentFlags().StringVar(&output, "output", "-",
+		"Path to the file to place the output in. Defaults to '-' which means stdout.")
+
+	subCommand := func(use, short, long, defaultFile string, migrate func([]byte) ([]migration, error)) *cobra.Command {
+		return &cobra.Command{
+			Use:   use,
+			Args:  cobra.MaximumNArgs(1),
+			Short: short,
+			Long:  long,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				file := defaultFile
+				if len(args) == 1 {
+					file = args[0]
+				}
+				if file == "" {
+					return errcat.User.New("a file to migrate is required")
+				}
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return errcat.User.New(err)
+				}
+				ms, err := migrate(data)
+				if err != nil {
+					return errcat.User.Newf("unable to migrate %s: %w", file, err)
+				}
+				if output == "-" {
+					return writeMigrationScript(cmd.OutOrStdout(), file, ms)
+				}
+				buf := bytes.Buffer{}
+				if err = writeMigrationScript(&buf, file, ms); err != nil {
+					return err
+				}
+				return os.WriteFile(output, buf.Bytes(), 0o755)
+			},
+		}
+	}
+
+	ksyncFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		ksyncFile = filepath.Join(home, ".ksync", "ksync.yaml")
+	}
+	cmd.AddCommand(
+		subCommand("telepresence1 <file>",
+			"Migrate Telepresence 1 command lines.",
+			`Migrate the Telepresence 1 command lines that are found in the given file, e.g. a shell script or a
+Makefile. Lines that don't contain a Telepresence 1 command are ignored.`,
+			"", migrateTelepresence1),
+		subCommand("okteto [<file>]",
+			"Migrate an okteto manifest.",
+			`Migrate the development containers of an okteto manifest into intercepts. The file defaults to
+okteto.yml in the current directory.`,
+			"okteto.yml", migrateOkteto),
+		subCommand("ksync [<file>]",
+			"Migrate a ksync configuration.",
+			`Migrate the specs of a ksync configuration. The file defaults to ~/.ksync/ksync.yaml.`,
+			ksyncFile, migrateKsync),
+	)
+	return cmd
+}
+
+func writeMigrationScript(w io.Writer, source string, ms []migration) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#!/bin/sh\n# Generated by \"telepresence migrate\" from %s.\n", source)
+	fmt.Fprintln(bw, "# Review the notes before running the commands.")
+	if len(ms) == 0 {
+		fmt.Fprintln(bw, "# Nothing to migrate was found.")
+	}
+	for _, m := range ms {
+		fmt.Fprintf(bw, "\n# %s\n", m.origin)
+		for _, note := range m.notes {
+			fmt.Fprintf(bw, "# NOTE: %s\n", note)
+		}
+		if m.command != "" {
+			fmt.Fprintln(bw, m.command)
+		}
+	}
+	return bw.Flush()
+}
+
+// migrateTelepresence1 translates the Telepresence 1 command lines in the given text. Lines that end with a
+// backslash are joined with the next line.
+func migrateTelepresence1(data []byte) ([]migration, error) {
+	var ms []migration
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		startNo := lineNo
+		line := sc.Text()
+		for strings.HasSuffix(line, `\`) && sc.Scan() {
+			lineNo++
+			line = line[:len(line)-1] + " " + sc.Text()
+		}
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			if f != "telepresence" && !strings.HasSuffix(f, "/telepresence") {
+				continue
+			}
+			if i+1 == len(fields) || !strings.HasPrefix(fields[i+1], "-") {
+				// Telepresence 1 had no subcommands, so this is a telepresence command already
+				break
+			}
+			tpCmd, msg, lc, err := translateLegacyCmd(fields[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", startNo, err)
+			}
+			if tpCmd == "" {
+				if len(lc.unsupportedFlags) == 0 {
+					// Not a Telepresence 1 command
+					break
+				}
+				msg += "Unable to translate this command\n"
+			}
+			m := migration{origin: fmt.Sprintf("line %d: %s", startNo, strings.Join(fields[i:], " "))}
+			if tpCmd != "" {
+				m.command = "telepresence " + tpCmd
+			}
+			for _, note := range strings.Split(strings.TrimSpace(msg), "\n") {
+				if note != "" {
+					m.notes = append(m.notes, note)
+				}
+			}
+			ms = append(ms, m)
+			break
+		}
+	}
+	return ms, sc.Err()
+}
+
+// migrateOkteto translates the development containers of an okteto manifest into intercepts. Both the
+// single container manifest and the manifest with a "dev" section are supported.
+func migrateOkteto(data []byte) ([]migration, error) {
+	var manifest map[string]interface{}
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	devs, ok := manifest["dev"].(map[string]interface{})
+	if !ok {
+		return []migration{migrateOktetoDev("", manifest, nil)}, nil
+	}
+
+	var ms []migration
+	var topNotes []string
+	defaults := make(map[string]interface{})
+	for _, key := range sortedKeys(manifest) {
+		switch key {
+		case "dev", "name":
+		case "namespace", "context":
+			defaults[key] = manifest[key]
+		default:
+			topNotes = append(topNotes, fmt.Sprintf("The %q section has no equivalent in telepresence", key))
+		}
+	}
+	if len(topNotes) > 0 {
+		ms = append(ms, migration{origin: "okteto manifest", notes: topNotes})
+	}
+	for _, name := range sortedKeys(devs) {
+		dev, ok := devs[name].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("dev %q is not a map", name)
+		}
+		ms = append(ms, migrateOktetoDev(name, dev, defaults))
+	}
+	return ms, nil
+}
+
+func migrateOktetoDev(name string, dev, defaults map[string]interface{}) migration {
+	if n, ok := dev["name"].(string); ok && n != "" {
+		name = n
+	}
+	m := migration{origin: fmt.Sprintf("okteto dev %q", name)}
+	if name == "" {
+		m.notes = append(m.notes, "The manifest has no name, so the workload to intercept is unknown")
+		return m
+	}
+	for k, v := range defaults {
+		if _, ok := dev[k]; !ok {
+			dev[k] = v
+		}
+	}
+
+	args := []string{"intercept", name}
+	var cmdline []string
+	for _, key := range sortedKeys(dev) {
+		value := dev[key]
+		switch key {
+		case "name":
+		case "namespace", "context":
+			args = append(args, "--"+key, fmt.Sprint(value))
+		case "command":
+			switch value := value.(type) {
+			case string:
+				cmdline = []string{"sh", "-c", value}
+			case []interface{}:
+				for _, v := range value {
+					cmdline = append(cmdline, fmt.Sprint(v))
+				}
+			}
+		case "forward":
+			fwArgs, notes := oktetoForwards(value)
+			args = append(args, fwArgs...)
+			m.notes = append(m.notes, notes...)
+		case "sync":
+			m.notes = append(m.notes, "Telepresence doesn't sync files since the code runs locally. The remote "+
+				"container's volumes are mounted locally instead, see --mount")
+		case "image":
+			m.notes = append(m.notes, fmt.Sprintf("The command runs on this workstation. Use --docker-run to run it "+
+				"in a container created from %s instead", value))
+		case "environment":
+			m.notes = append(m.notes, "The environment isn't migrated. The command inherits the environment of the "+
+				"intercepted container; set additional variables in the shell, or in a file used with --docker-run --env-file")
+		default:
+			m.notes = append(m.notes, fmt.Sprintf("The %q setting has no equivalent in telepresence", key))
+		}
+	}
+	if len(cmdline) > 0 {
+		args = append(args, "--")
+		args = append(args, cmdline...)
+	}
+	m.command = shellquote.ShellString("telepresence", args)
+	return m
+}
+
+// oktetoForwards translates okteto port forwards on the form "<local>:<remote>". The first one becomes the
+// port of the intercept and the others become --to-pod forwards, which require the local and remote ports to
+// be equal.
+func oktetoForwards(value interface{}) (args, notes []string) {
+	fws, ok := value.([]interface{})
+	if !ok {
+		return nil, []string{"The forward setting isn't a list and was ignored"}
+	}
+	for _, fw := range fws {
+		s, ok := fw.(string)
+		parts := strings.Split(s, ":")
+		if !ok || len(parts) != 2 {
+			notes = append(notes, fmt.Sprintf("The forward %v isn't on the form <local>:<remote> and was ignored", fw))
+			continue
+		}
+		local, err1 := strconv.ParseUint(parts[0], 10, 16)
+		remote, err2 := strconv.ParseUint(parts[1], 10, 16)
+		switch {
+		case err1 != nil || err2 != nil:
+			notes = append(notes, fmt.Sprintf("The forward %s doesn't use port numbers and was ignored", s))
+		case len(args) == 0:
+			args = append(args, "--port", fmt.Sprintf("%d:%d", local, remote))
+		case local == remote:
+			args = append(args, "--to-pod", parts[1])
+		default:
+			notes = append(notes, fmt.Sprintf("The forward %s was ignored since --to-pod requires equal ports", s))
+		}
+	}
+	return args, notes
+}
+
+// migrateKsync flags the specs of a ksync configuration. Telepresence doesn't sync files into the cluster,
+// so there are no equivalent commands, only advice on how to intercept the workload instead.
+func migrateKsync(data []byte) ([]migration, error) {
+	var cfg struct {
+		Spec []struct {
+			Name       string   `yaml:"name"`
+			Namespace  string   `yaml:"namespace"`
+			Pod        string   `yaml:"pod"`
+			Selector   []string `yaml:"selector"`
+			LocalPath  string   `yaml:"localpath"`
+			RemotePath string   `yaml:"remotepath"`
+		} `yaml:"spec"`
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	ms := make([]migration, len(cfg.Spec))
+	for i, spec := range cfg.Spec {
+		pods := spec.Pod
+		if pods == "" {
+			pods = "pods matching " + strings.Join(spec.Selector, ",")
+		}
+		if spec.Namespace != "" {
+			pods += " in namespace " + spec.Namespace
+		}
+		ms[i] = migration{
+			origin: fmt.Sprintf("ksync spec %q", spec.Name),
+			notes: []string{
+				fmt.Sprintf("ksync syncs %s to %s of %s. Telepresence runs the code locally instead", spec.LocalPath, spec.RemotePath, pods),
+				"Intercept the workload of those pods and run the code from " + spec.LocalPath + ": " +
+					"telepresence intercept <workload> --port <local port>[:<service port>] -- <command>",
+			},
+		}
+	}
+	return ms, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_migrateTelepresence1(t *testing.T) {
+	ms, err := migrateTelepresence1([]byte(`#!/bin/sh
+echo "starting"
+telepresence --swap-deployment myserver --expose 9090 \
+  --run python3 -m http.server 9090
+telepresence intercept echo --port 8080
+/usr/local/bin/telepresence --swap-deployment other --method inject-tcp --run-shell
+telepresence --not-real-param
+`))
+	require.NoError(t, err)
+	require.Len(t, ms, 3)
+
+	assert.Equal(t, "line 3: telepresence --swap-deployment myserver --expose 9090 --run python3 -m http.server 9090", ms[0].origin)
+	assert.Equal(t, "telepresence intercept myserver --port 9090 -- python3 -m http.server 9090", ms[0].command)
+	assert.Empty(t, ms[0].notes)
+
+	assert.Equal(t, "telepresence intercept other -- bash", ms[1].command)
+	assert.Len(t, ms[1].notes, 1)
+
+	assert.Empty(t, ms[2].command)
+	assert.Equal(t, []string{
+		"The following flags used don't have a direct translation to Telepresence: --not-real-param",
+		"Unable to translate this command",
+	}, ms[2].notes)
+}
+
+func Test_migrateOkteto(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands are quoted for cmd.exe on windows")
+	}
+	ms, err := migrateOkteto([]byte(`
+namespace: dev
+build:
+  api:
+    context: .
+dev:
+  api:
+    command: ["npm", "run", "dev"]
+    forward:
+      - 8080:80
+      - 9229:9229
+      - 5432:postgres:5432
+    sync:
+      - .:/usr/src/app
+    image: node:16
+  worker:
+    context: staging
+    command: go run ./cmd/worker --verbose
+`))
+	require.NoError(t, err)
+	require.Len(t, ms, 3)
+
+	assert.Equal(t, "okteto manifest", ms[0].origin)
+	assert.Equal(t, []string{`The "build" section has no equivalent in telepresence`}, ms[0].notes)
+
+	assert.Equal(t, `okteto dev "api"`, ms[1].origin)
+	assert.Equal(t, "telepresence intercept api --port 8080:80 --to-pod 9229 --namespace dev -- npm run dev", ms[1].command)
+	assert.Len(t, ms[1].notes, 3)
+
+	assert.Equal(t, "telepresence intercept worker --context staging --namespace dev -- sh -c 'go run ./cmd/worker --verbose'", ms[2].command)
+	assert.Empty(t, ms[2].notes)
+
+	// A manifest without a dev section describes one development container
+	ms, err = migrateOkteto([]byte(`
+name: api
+forward:
+  - 3000:3000
+environment:
+  DEBUG: "true"
+`))
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	assert.Equal(t, "telepresence intercept api --port 3000:3000", ms[0].command)
+	assert.Len(t, ms[0].notes, 1)
+
+	_, err = migrateOkteto([]byte("dev:\n  api: 3\n"))
+	assert.Error(t, err)
+}
+
+func Test_migrateKsync(t *testing.T) {
+	ms, err := migrateKsync([]byte(`
+spec:
+- name: app
+  namespace: default
+  selector:
+  - app=app
+  localpath: /home/alice/app
+  remotepath: /code
+`))
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	assert.Equal(t, `ksync spec "app"`, ms[0].origin)
+	assert.Empty(t, ms[0].command)
+	assert.Equal(t, "ksync syncs /home/alice/app to /code of pods matching app=app in namespace default. "+
+		"Telepresence runs the code locally instead", ms[0].notes[0])
+}
+
+func Test_writeMigrationScript(t *testing.T) {
+	buf := bytes.Buffer{}
+	require.NoError(t, writeMigrationScript(&buf, "okteto.yml", []migration{{
+		origin:  `okteto dev "api"`,
+		command: "telepresence intercept api --port 8080:80",
+		notes:   []string{"The \"sync\" setting is ignored"},
+	}}))
+	assert.Equal(t, `#!/bin/sh
+# Generated by "telepresence migrate" from okteto.yml.
+# Review the notes before running the commands.
+
+# okteto dev "api"
+# NOTE: The "sync" setting is ignored
+telepresence intercept api --port 8080:80
+`, buf.String())
+}
@@ -66,7 +66,7 @@ func previewCommand() *cobra.Command {
 					if err != nil {
 						return err
 					}
-					fmt.Println(DescribeIntercept(intercept, nil, false))
+					fmt.Fprintln(cmd.OutOrStdout(), DescribeIntercept(intercept, nil, false))
 					return nil
 				})
 			})
@@ -92,7 +92,7 @@ func previewCommand() *cobra.Command {
 					if err != nil {
 						return err
 					}
-					fmt.Println(DescribeIntercept(intercept, nil, false))
+					fmt.Fprintln(cmd.OutOrStdout(), DescribeIntercept(intercept, nil, false))
 					return nil
 				})
 			})
@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/recording"
+)
+
+type replayInfo struct {
+	to               string
+	intercept        string
+	path             string
+	includeTruncated bool
+	timeout          time.Duration
+}
+
+// replayResult is the result of replaying one recorded request, as printed with --output json.
+type replayResult struct {
+	Method         string `json:"method"`
+	URI            string `json:"uri"`
+	Target         string `json:"target,omitempty"`
+	RecordedStatus int    `json:"recorded_status,omitempty"`
+	Status         int    `json:"status,omitempty"`
+	Skipped        string `json:"skipped,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+func replayCommand() *cobra.Command {
+	ri := &replayInfo{}
+	cmd := withJSONOutput(&cobra.Command{
+		Use:   "replay [flags] <file>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Send the requests that an intercept recorded to the local handler",
+		Long: `Send the HTTP requests that were recorded by "telepresence intercept --record <file>" to the local
+handler again, in the order that they were recorded, and report the status of each response next to the
+status of the recorded response.
+
+The requests are sent to the address of the local handler that received them, unless --to is given. A
+request whose body was truncated by the recording is skipped unless --include-truncated is given. No
+connection to the cluster is needed.`,
+		RunE: ri.replay,
+	})
+	flags := cmd.Flags()
+	flags.StringVar(&ri.to, "to", "", "The host:port to send the requests to instead of the recorded address of the local handler")
+	flags.StringVar(&ri.intercept, "intercept", "", "Only replay the requests recorded by the intercept with this name")
+	flags.StringVar(&ri.path, "path", "", "Only replay the requests whose URI matches this regular expression")
+	flags.BoolVar(&ri.includeTruncated, "include-truncated", false, "Also replay requests whose body was truncated by the recording")
+	flags.DurationVar(&ri.timeout, "timeout", 30*time.Second, "The maximum time to wait for each response")
+	return cmd
+}
+
+func (ri *replayInfo) replay(cmd *cobra.Command, args []string) error {
+	var pathRx *regexp.Regexp
+	if ri.path != "" {
+		var err error
+		if pathRx, err = regexp.Compile(ri.path); err != nil {
+			return errcat.User.Newf("invalid --path: %w", err)
+		}
+	}
+	if ri.to != "" {
+		if _, _, err := net.SplitHostPort(ri.to); err != nil {
+			return errcat.User.Newf("invalid --to: %w", err)
+		}
+	}
+	exs, err := recording.ReadFile(args[0])
+	if err != nil {
+		return errcat.User.New(err)
+	}
+
+	hc := &http.Client{
+		Timeout: ri.timeout,
+		// The response to the request is what's of interest, not where a redirect leads
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	ctx := cmd.Context()
+	var results []*replayResult
+	failed := 0
+	for _, ex := range exs {
+		if ri.intercept != "" && ex.Intercept != ri.intercept || pathRx != nil && !pathRx.MatchString(ex.Request.URI) {
+			continue
+		}
+		res := ri.send(ctx, hc, ex)
+		if res.Error != "" {
+			failed++
+		}
+		results = append(results, res)
+	}
+	if err = printResult(cmd, results, func(out io.Writer) { printReplayResults(out, results) }); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return errcat.User.Newf("%d of %d requests could not be replayed", failed, len(results))
+	}
+	return nil
+}
+
+// send sends the request of the given exchange and returns the result.
+func (ri *replayInfo) send(ctx context.Context, hc *http.Client, ex *recording.Exchange) *replayResult {
+	rq := ex.Request
+	res := &replayResult{Method: rq.Method, URI: rq.URI, Target: ri.to}
+	if res.Target == "" {
+		res.Target = ex.Target
+	}
+	if ex.Response != nil {
+		res.RecordedStatus = ex.Response.Status
+	}
+	if rq.BodyTruncated && !ri.includeTruncated {
+		res.Skipped = "the recorded body is truncated"
+		return res
+	}
+	if res.Target == "" {
+		res.Error = "the recording has no target, use --to"
+		return res
+	}
+	req, err := http.NewRequestWithContext(ctx, rq.Method, "http://"+res.Target+rq.URI, bytes.NewReader(rq.Body))
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	for k, vs := range rq.Header {
+		// The length is that of the recorded body, which may be truncated, and a redacted credential would
+		// only make the handler reject the request
+		if k == "Content-Length" {
+			continue
+		}
+		for _, v := range vs {
+			if v != recording.Redacted {
+				req.Header.Add(k, v)
+			}
+		}
+	}
+	if rq.Host != "" {
+		req.Host = rq.Host
+	}
+	rsp, err := hc.Do(req)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	_ = rsp.Body.Close()
+	res.Status = rsp.StatusCode
+	return res
+}
+
+func printReplayResults(out io.Writer, results []*replayResult) {
+	if len(results) == 0 {
+		fmt.Fprintln(out, "No recorded requests to replay")
+		return
+	}
+	for _, r := range results {
+		recorded := "no recorded response"
+		if r.RecordedStatus != 0 {
+			recorded = fmt.Sprintf("recorded %d", r.RecordedStatus)
+		}
+		switch {
+		case r.Skipped != "":
+			fmt.Fprintf(out, "%s %s: skipped, %s\n", r.Method, r.URI, r.Skipped)
+		case r.Error != "":
+			fmt.Fprintf(out, "%s %s: %s (%s)\n", r.Method, r.URI, r.Error, recorded)
+		case r.Status != r.RecordedStatus && r.RecordedStatus != 0:
+			fmt.Fprintf(out, "%s %s: %d, differs from the %s\n", r.Method, r.URI, r.Status, recorded)
+		default:
+			fmt.Fprintf(out, "%s %s: %d (%s)\n", r.Method, r.URI, r.Status, recorded)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/recording"
+)
+
+func TestReplay_send(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got, gotBody = r, string(body)
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer srv.Close()
+	target := strings.TrimPrefix(srv.URL, "http://")
+
+	ctx := context.Background()
+	ri := &replayInfo{timeout: time.Second}
+	hc := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	ex := &recording.Exchange{
+		Target: target,
+		Request: &recording.Request{
+			Method: http.MethodPost,
+			URI:    "/orders?id=7",
+			Host:   "orders.example.com",
+			Header: http.Header{"X-Test": {"yes"}, "Content-Length": {"999"}, "Authorization": {recording.Redacted}},
+			Body:   []byte(`{"id":7}`),
+		},
+		Response: &recording.Response{Status: http.StatusInternalServerError},
+	}
+
+	// The recorded request is sent to the recorded target, and a redirect isn't followed
+	res := ri.send(ctx, hc, ex)
+	assert.Empty(t, res.Error)
+	assert.Equal(t, http.StatusFound, res.Status)
+	assert.Equal(t, http.StatusInternalServerError, res.RecordedStatus)
+	require.NotNil(t, got)
+	assert.Equal(t, "/orders?id=7", got.RequestURI)
+	assert.Equal(t, "orders.example.com", got.Host)
+	assert.Equal(t, "yes", got.Header.Get("X-Test"))
+	assert.Empty(t, got.Header.Values("Authorization"))
+	assert.Equal(t, `{"id":7}`, gotBody)
+
+	// A truncated body is only sent when asked to
+	got = nil
+	ex.Request.BodyTruncated = true
+	res = ri.send(ctx, hc, ex)
+	assert.NotEmpty(t, res.Skipped)
+	assert.Nil(t, got)
+	ri.includeTruncated = true
+	res = ri.send(ctx, hc, ex)
+	assert.Empty(t, res.Skipped)
+	assert.NotNil(t, got)
+
+	// A request without a target needs --to
+	ex.Target = ""
+	res = ri.send(ctx, hc, ex)
+	assert.NotEmpty(t, res.Error)
+	ri.to = target
+	res = ri.send(ctx, hc, ex)
+	assert.Empty(t, res.Error)
+	assert.Equal(t, target, res.Target)
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/spf13/cobra"
+	grpcCodes "google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/proc"
+)
+
+func runCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "run -- <command> [args...]",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "Run a command with its traffic routed through the cluster",
+		Long: `Run a command with its traffic routed through the cluster.
+
+When the session was started with "telepresence connect --process-routing", only the traffic of the command,
+and of the processes that it starts, is routed through the cluster, and the rest of the workstation is left
+alone. A session is started that way when there is none, and it ends when the command exits. The command
+is given the proxy environment variables of a proxy-only session, and runs as is in a session that routes
+the traffic of all processes. When the workstation lacks what process routing needs, a warning is printed and
+a new session routes the traffic of all processes.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request := &connector.ConnectRequest{}
+			if runtime.GOOS == "linux" {
+				if err := client.CheckProcessRouting(); err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %v. A new session routes the traffic of all processes\n", err)
+				} else {
+					request.ProcessRouting = true
+				}
+			}
+			return withConnector(cmd, false, request, func(ctx context.Context, cs *connectorState) error {
+				return runThroughSession(ctx, cs, args)
+			})
+		},
+	}
+}
+
+// runThroughSession runs the given command line so that its traffic goes through the session. When the session
+// uses process routing, the traffic of this process is routed, and the command inherits that.
+func runThroughSession(ctx context.Context, cs *connectorState, args []string) error {
+	var env map[string]string
+	switch {
+	case cs.ProxyAddress != "":
+		env = proxyEnv(cs.ProxyAddress)
+	case cs.rootD != nil:
+		if err := routeThisProcess(ctx, cs); err != nil {
+			return err
+		}
+	}
+	return proc.Run(ctx, env, args[0], args[1:]...)
+}
+
+// routeThisProcess asks the root daemon to route the traffic of this process, and of the processes that it
+// starts, through the session. It's a no-op when the session routes the traffic of all processes.
+func routeThisProcess(ctx context.Context, cs *connectorState) error {
+	if _, err := cs.rootD.RouteProcess(ctx, &empty.Empty{}); err != nil {
+		switch grpcStatus.Code(err) {
+		case grpcCodes.FailedPrecondition:
+			// The traffic of all processes is routed
+		case grpcCodes.Unimplemented:
+			return errcat.User.New(grpcStatus.Convert(err).Message())
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+)
+
+// savedSession is the content of a file written by "telepresence session save". The intercepts use the
+// same format as the intercept specification files.
+type savedSession struct {
+	Context    string           `yaml:"context,omitempty"`
+	Intercepts []*interceptSpec `yaml:"intercepts"`
+}
+
+func sessionCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  "session",
+		Args: OnlySubcommands,
+
+		Short: "Save and restore the connection and intercepts of a session",
+		RunE:  RunSubcommands,
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "save <name>",
+			Args:  cobra.ExactArgs(1),
+			Short: "Save the current connection and intercepts under the given name",
+			RunE:  sessionSave,
+		},
+		&cobra.Command{
+			Use:   "restore <name>",
+			Args:  cobra.ExactArgs(1),
+			Short: "Connect and recreate the intercepts of a saved session",
+			RunE:  sessionRestore,
+		},
+		&cobra.Command{
+			Use:   "list",
+			Args:  cobra.NoArgs,
+			Short: "List the saved sessions",
+			RunE:  sessionList,
+		},
+	)
+	return cmd
+}
+
+// sessionsDir returns the directory where the saved sessions are stored.
+func sessionsDir(ctx context.Context) (string, error) {
+	dir, err := filelocation.AppUserConfigDir(ctx)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sessions"), nil
+}
+
+func sessionFile(ctx context.Context, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", errcat.User.Newf("invalid session name %q", name)
+	}
+	dir, err := sessionsDir(ctx)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".yaml"), nil
+}
+
+func sessionSave(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	file, err := sessionFile(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	var ss *savedSession
+	err = withConnector(cmd, true, nil, func(ctx context.Context, cs *connectorState) error {
+		r, err := cs.userD.List(ctx, &connector.ListRequest{Filter: connector.ListRequest_INTERCEPTS})
+		if err != nil {
+			return err
+		}
+		ss = newSavedSession(cs.ClusterContext, r.Workloads)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(ss)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	if err = os.WriteFile(file, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Saved session %q with %d intercept(s) to %s\n", args[0], len(ss.Intercepts), file)
+	return nil
+}
+
+func sessionRestore(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	file, err := sessionFile(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errcat.User.Newf("there is no saved session named %q", args[0])
+		}
+		return err
+	}
+	var ss savedSession
+	if err = yaml.Unmarshal(data, &ss); err != nil {
+		return errcat.User.Newf("unable to parse session file %s: %w", file, err)
+	}
+	request := &connector.ConnectRequest{}
+	if ss.Context != "" {
+		request.KubeFlags = map[string]string{"context": ss.Context}
+	}
+	if len(ss.Intercepts) == 0 {
+		return withConnector(cmd, true, request, func(_ context.Context, _ *connectorState) error {
+			return nil
+		})
+	}
+	return interceptFromSpecs(cmd, request, ss.Intercepts)
+}
+
+func sessionList(cmd *cobra.Command, _ []string) error {
+	dir, err := sessionsDir(cmd.Context())
+	if err != nil {
+		return err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return err
+	}
+	stdout := cmd.OutOrStdout()
+	if len(files) == 0 {
+		fmt.Fprintln(stdout, "No saved sessions")
+		return nil
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		fmt.Fprintln(stdout, strings.TrimSuffix(filepath.Base(file), ".yaml"))
+	}
+	return nil
+}
+
+// newSavedSession creates a savedSession from the given context and the intercepted workloads. Local-only
+// intercepts and the intercepts of other clients are skipped.
+func newSavedSession(clusterContext string, workloads []*connector.WorkloadInfo) *savedSession {
+	ss := &savedSession{Context: clusterContext}
+	for _, wl := range workloads {
+		if wl.Name == "" || wl.InterceptInfo == nil || wl.InterceptInfo.Spec == nil {
+			continue
+		}
+		ss.Intercepts = append(ss.Intercepts, interceptSpecFromInfo(wl.InterceptInfo))
+	}
+	return ss
+}
+
+// interceptSpecFromInfo returns a spec that recreates the given intercept. Matchers that were selected
+// automatically, e.g. with "--http-match=auto", aren't saved, so they are selected anew on restore.
+func interceptSpecFromInfo(ii *manager.InterceptInfo) *interceptSpec {
+	spec := ii.Spec
+	is := &interceptSpec{
+		Name:      spec.Name,
+		Workload:  spec.Agent,
+		Namespace: spec.Namespace,
+		Service:   spec.ServiceName,
+		Port:      strconv.Itoa(int(spec.TargetPort)),
+		Mount:     "false",
+		Encrypt:   len(spec.ClientPublicKey) > 0,
+	}
+	if spec.ServicePortIdentifier != "" {
+		is.Port += ":" + spec.ServicePortIdentifier
+	}
+	if spec.MountPoint != "" {
+		is.Mount = "true"
+	}
+	for _, p := range spec.ExtraPorts {
+		is.ToPod = append(is.ToPod, strconv.Itoa(int(p)))
+	}
+	for _, arg := range spec.MechanismArgs {
+		if kv := strings.TrimPrefix(arg, "--match="); kv != arg {
+			if eq := strings.IndexByte(kv, '='); eq > 0 {
+				if is.Headers == nil {
+					is.Headers = make(map[string]string)
+				}
+				is.Headers[kv[:eq]] = kv[eq+1:]
+			}
+		}
+	}
+	preview := ii.PreviewDomain != ""
+	is.PreviewURL = &preview
+	return is
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+func Test_newSavedSession(t *testing.T) {
+	ss := newSavedSession("minikube", []*connector.WorkloadInfo{
+		{
+			Name:      "orders",
+			Namespace: "shop",
+			InterceptInfo: &manager.InterceptInfo{
+				Spec: &manager.InterceptSpec{
+					Name:                  "orders-shop",
+					Agent:                 "orders",
+					Namespace:             "shop",
+					ServiceName:           "orders",
+					TargetPort:            8080,
+					ServicePortIdentifier: "http",
+					MountPoint:            "/tmp/telfs-1234",
+					ExtraPorts:            []int32{9090},
+					MechanismArgs:         []string{"--match=x-dev=alice", "--plaintext=false"},
+				},
+				PreviewDomain: "abc.preview.edgestack.me",
+			},
+		},
+		{Name: "payments", Namespace: "shop"},
+		{InterceptInfo: &manager.InterceptInfo{Spec: &manager.InterceptSpec{Name: "local"}}},
+	})
+	require.Len(t, ss.Intercepts, 1)
+	assert.Equal(t, "minikube", ss.Context)
+
+	spec := ss.Intercepts[0]
+	assert.Equal(t, "orders-shop", spec.Name)
+	assert.Equal(t, "orders", spec.Workload)
+	assert.Equal(t, "8080:http", spec.Port)
+	assert.Equal(t, "true", spec.Mount)
+	assert.Equal(t, []string{"9090"}, spec.ToPod)
+	assert.Equal(t, map[string]string{"x-dev": "alice"}, spec.Headers)
+	require.NotNil(t, spec.PreviewURL)
+	assert.True(t, *spec.PreviewURL)
+
+	// The saved intercepts must be readable as an intercept specification file
+	data, err := yaml.Marshal(&interceptSpecFile{Intercepts: ss.Intercepts})
+	require.NoError(t, err)
+	sf, err := parseInterceptSpecFile(data)
+	require.NoError(t, err)
+	assert.Equal(t, spec, sf.Intercepts[0])
+}
+
+func Test_sessionFile(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`} {
+		_, err := sessionFile(context.Background(), name)
+		assert.Error(t, err, name)
+	}
+}
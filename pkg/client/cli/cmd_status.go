@@ -4,164 +4,577 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/blang/semver"
 	"github.com/spf13/cobra"
+	grpcCodes "google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/telepresenceio/telepresence/rpc/v2/connector"
 	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 )
 
+type statusInfo struct {
+	network bool
+}
+
+// statusJSON is the document that "telepresence status --output json" prints.
+type statusJSON struct {
+	RootDaemon *rootDaemonStatus  `json:"rootDaemon"`
+	UserDaemon *userDaemonStatus  `json:"userDaemon"`
+	Network    *networkConfigJSON `json:"network,omitempty"`
+}
+
+type rootDaemonStatus struct {
+	Running           bool           `json:"running"`
+	Version           string         `json:"version,omitempty"`
+	APIVersion        int32          `json:"apiVersion,omitempty"`
+	DNS               *rootDaemonDNS `json:"dns,omitempty"`
+	AlsoProxySubnets  []string       `json:"alsoProxySubnets,omitempty"`
+	AlsoProxyHosts    []string       `json:"alsoProxyHosts,omitempty"`
+	ProcessRouting    bool           `json:"processRouting,omitempty"`
+	NeverProxySubnets []string       `json:"neverProxySubnets,omitempty"`
+	NeverProxyHosts   []string       `json:"neverProxyHosts,omitempty"`
+	SubnetConflicts   []string       `json:"subnetConflicts,omitempty"`
+	status            *daemon.DaemonStatus
+}
+
+type rootDaemonDNS struct {
+	LocalIP          string            `json:"localIP,omitempty"`
+	RemoteIP         string            `json:"remoteIP,omitempty"`
+	IncludeSuffixes  []string          `json:"includeSuffixes"`
+	ExcludeSuffixes  []string          `json:"excludeSuffixes"`
+	SuffixNamespaces map[string]string `json:"suffixNamespaces,omitempty"`
+	LookupTimeout    string            `json:"lookupTimeout,omitempty"`
+}
+
+type userDaemonStatus struct {
+	Running           bool              `json:"running"`
+	Version           string            `json:"version,omitempty"`
+	APIVersion        int32             `json:"apiVersion,omitempty"`
+	AmbassadorCloud   string            `json:"ambassadorCloud,omitempty"`
+	Connected         bool              `json:"connected"`
+	Status            string            `json:"status,omitempty"`
+	Error             string            `json:"error,omitempty"`
+	KubernetesServer  string            `json:"kubernetesServer,omitempty"`
+	KubernetesContext string            `json:"kubernetesContext,omitempty"`
+	ManagerVersion    string            `json:"managerVersion,omitempty"`
+	ManagerNamespace  string            `json:"managerNamespace,omitempty"`
+	ProxyAddress      string            `json:"proxyAddress,omitempty"`
+	InCluster         bool              `json:"inCluster,omitempty"`
+	Agents            []agentVersion    `json:"agents,omitempty"`
+	Intercepts        []interceptStatus `json:"intercepts,omitempty"`
+	ci                *connector.ConnectInfo
+}
+
+type interceptStatus struct {
+	Name   string `json:"name"`
+	Client string `json:"client"`
+}
+
 func statusCommand() *cobra.Command {
-	return &cobra.Command{
+	si := &statusInfo{}
+	cmd := withJSONOutput(&cobra.Command{
 		Use:  "status",
 		Args: cobra.NoArgs,
 
 		Short: "Show connectivity status",
-		RunE:  status,
-	}
+		RunE:  si.run,
+	})
+	flags := cmd.Flags()
+	flags.BoolVar(&si.network, "network", false, "Show the routes, DNS configuration, and TUN device of the current session")
+	addOutputFlag(cmd)
+	return cmd
 }
 
-// status will retrieve connectivity status from the daemon and print it on stdout.
-func status(cmd *cobra.Command, _ []string) error {
-	if err := daemonStatus(cmd); err != nil {
+// run retrieves the connectivity status from the daemons and prints it on stdout.
+func (si *statusInfo) run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	rs, err := getRootDaemonStatus(ctx)
+	if err != nil {
 		return err
 	}
-
-	if err := connectorStatus(cmd); err != nil {
+	us, err := getUserDaemonStatus(ctx)
+	if err != nil {
 		return err
 	}
-
-	return nil
+	doc := &statusJSON{RootDaemon: rs, UserDaemon: us}
+	var nc *daemon.NetworkConfig
+	if si.network {
+		if nc, err = getNetworkConfig(ctx); err != nil {
+			return err
+		}
+		doc.Network = newNetworkConfigJSON(nc)
+	}
+	return printResult(cmd, doc, func(out io.Writer) {
+		rs.print(out)
+		us.print(out)
+		if nc != nil {
+			printNetworkConfig(out, nc)
+		}
+	})
 }
 
-func daemonStatus(cmd *cobra.Command) error {
-	out := cmd.OutOrStdout()
-
-	err := cliutil.WithStartedNetwork(cmd.Context(), func(ctx context.Context, daemonClient daemon.DaemonClient) error {
-		var err error
-		status, err := daemonClient.Status(cmd.Context(), &empty.Empty{})
+func getRootDaemonStatus(ctx context.Context) (*rootDaemonStatus, error) {
+	rs := &rootDaemonStatus{}
+	err := cliutil.WithStartedNetwork(ctx, func(ctx context.Context, daemonClient daemon.DaemonClient) error {
+		status, err := daemonClient.Status(ctx, &empty.Empty{})
 		if err != nil {
 			return err
 		}
-		version, err := daemonClient.Version(cmd.Context(), &empty.Empty{})
+		version, err := daemonClient.Version(ctx, &empty.Empty{})
 		if err != nil {
 			return err
 		}
-
-		fmt.Fprintln(out, "Root Daemon: Running")
-		fmt.Fprintf(out, "  Version   : %s (api %d)\n", version.Version, version.ApiVersion)
+		rs.Running = true
+		rs.Version = version.Version
+		rs.APIVersion = version.ApiVersion
+		rs.status = status
 		if obc := status.OutboundConfig; obc != nil {
 			dns := obc.Dns
-			fmt.Fprintf(out, "  DNS       :\n")
+			rs.DNS = &rootDaemonDNS{
+				IncludeSuffixes:  append([]string{}, dns.IncludeSuffixes...),
+				ExcludeSuffixes:  append([]string{}, dns.ExcludeSuffixes...),
+				SuffixNamespaces: dns.SuffixNamespaces,
+			}
 			if dns.LocalIp != nil {
-				// Local IP is only set when the overriding resolver is used
-				fmt.Fprintf(out, "    Local IP        : %v\n", net.IP(dns.LocalIp))
+				rs.DNS.LocalIP = net.IP(dns.LocalIp).String()
+			}
+			if dns.RemoteIp != nil {
+				rs.DNS.RemoteIP = net.IP(dns.RemoteIp).String()
+			}
+			if dns.LookupTimeout != nil {
+				rs.DNS.LookupTimeout = dns.LookupTimeout.AsDuration().String()
 			}
-			fmt.Fprintf(out, "    Remote IP       : %v\n", net.IP(dns.RemoteIp))
-			fmt.Fprintf(out, "    Exclude suffixes: %v\n", dns.ExcludeSuffixes)
-			fmt.Fprintf(out, "    Include suffixes: %v\n", dns.IncludeSuffixes)
-			fmt.Fprintf(out, "    Timeout         : %v\n", dns.LookupTimeout.AsDuration())
-			fmt.Fprintf(out, "  Also Proxy : (%d subnets)\n", len(obc.AlsoProxySubnets))
-			fmt.Fprintf(out, "  Never Proxy: (%d subnets)\n", len(obc.NeverProxySubnets))
 			for _, subnet := range obc.AlsoProxySubnets {
-				fmt.Fprintf(out, "    - %s\n", iputil.IPNetFromRPC(subnet))
+				rs.AlsoProxySubnets = append(rs.AlsoProxySubnets, iputil.IPNetFromRPC(subnet).String())
+			}
+			for _, subnet := range obc.NeverProxySubnets {
+				rs.NeverProxySubnets = append(rs.NeverProxySubnets, iputil.IPNetFromRPC(subnet).String())
 			}
+			rs.AlsoProxyHosts = obc.AlsoProxyHosts
+			rs.ProcessRouting = obc.ProcessRouting
+			rs.NeverProxyHosts = obc.NeverProxyHosts
+		}
+		for _, sc := range status.SubnetConflicts {
+			rs.SubnetConflicts = append(rs.SubnetConflicts, client.DescribeSubnetConflict(sc))
 		}
 		return nil
 	})
-	if err != nil {
-		if errors.Is(err, cliutil.ErrNoNetwork) {
-			fmt.Fprintln(out, "Root Daemon: Not running")
-			return nil
+	if err != nil && !errors.Is(err, cliutil.ErrNoNetwork) {
+		return nil, err
+	}
+	return rs, nil
+}
+
+func (rs *rootDaemonStatus) print(out io.Writer) {
+	if !rs.Running {
+		fmt.Fprintln(out, "Root Daemon: Not running")
+		return
+	}
+	status := rs.status
+	fmt.Fprintln(out, "Root Daemon: Running")
+	fmt.Fprintf(out, "  Version   : %s (api %d)\n", rs.Version, rs.APIVersion)
+	if obc := status.OutboundConfig; obc != nil {
+		dns := obc.Dns
+		fmt.Fprintf(out, "  DNS       :\n")
+		if dns.LocalIp != nil {
+			// Local IP is only set when the overriding resolver is used
+			fmt.Fprintf(out, "    Local IP        : %v\n", net.IP(dns.LocalIp))
+		}
+		fmt.Fprintf(out, "    Remote IP       : %v\n", net.IP(dns.RemoteIp))
+		fmt.Fprintf(out, "    Exclude suffixes: %v\n", dns.ExcludeSuffixes)
+		fmt.Fprintf(out, "    Include suffixes: %v\n", dns.IncludeSuffixes)
+		if len(dns.SuffixNamespaces) > 0 {
+			fmt.Fprintf(out, "    Suffix mappings : %s\n", formatSuffixNamespaces(dns.SuffixNamespaces))
+		}
+		fmt.Fprintf(out, "    Timeout         : %v\n", dns.LookupTimeout.AsDuration())
+		if cs := status.DnsCacheStats; cs != nil {
+			fmt.Fprintf(out, "    Cache           : %s\n", formatCacheStats(cs))
+		}
+		if obc.ProcessRouting {
+			fmt.Fprintln(out, "  Routing    : only processes started with telepresence run")
+		}
+		fmt.Fprintf(out, "  Also Proxy : (%d subnets)\n", len(obc.AlsoProxySubnets))
+		fmt.Fprintf(out, "  Never Proxy: (%d subnets)\n", len(obc.NeverProxySubnets))
+		if len(obc.AlsoProxyHosts) > 0 {
+			fmt.Fprintf(out, "  Also Proxy hosts : %v\n", obc.AlsoProxyHosts)
+		}
+		if len(obc.NeverProxyHosts) > 0 {
+			fmt.Fprintf(out, "  Never Proxy hosts: %v\n", obc.NeverProxyHosts)
+		}
+		for _, subnet := range rs.AlsoProxySubnets {
+			fmt.Fprintf(out, "    - %s\n", subnet)
+		}
+	}
+	if cs := status.ConnectionStats; cs != nil {
+		fmt.Fprintf(out, "  Connections: %s\n", formatConnectionStats(cs))
+	}
+	if len(rs.SubnetConflicts) > 0 {
+		fmt.Fprintf(out, "  Subnet conflicts: (%d)\n", len(rs.SubnetConflicts))
+		for _, sc := range rs.SubnetConflicts {
+			fmt.Fprintf(out, "    - %s\n", sc)
 		}
-		return err
 	}
-	return nil
 }
 
-func connectorStatus(cmd *cobra.Command) error {
-	out := cmd.OutOrStdout()
+// formatCacheStats returns a one line summary of the given DNS cache statistics.
+func formatCacheStats(cs *daemon.DNSCacheStats) string {
+	hits := cs.Hits + cs.NegativeHits
+	rate := 0.0
+	if total := hits + cs.Misses; total > 0 {
+		rate = 100 * float64(hits) / float64(total)
+	}
+	return fmt.Sprintf("%.1f%% hit rate (%d hits, %d negative hits, %d misses), %d entries",
+		rate, cs.Hits, cs.NegativeHits, cs.Misses, cs.Entries)
+}
 
-	err := cliutil.WithStartedConnector(cmd.Context(), false, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
-		fmt.Fprintln(out, "User Daemon: Running")
+// formatConnectionStats returns a one line summary of the given connection statistics.
+func formatConnectionStats(cs *daemon.ConnectionStats) string {
+	limit := func(v int64) string {
+		if v == 0 {
+			return "no limit"
+		}
+		return "max " + strconv.FormatInt(v, 10)
+	}
+	return fmt.Sprintf("%d active (%s, %d held back), %d bytes buffered (%s, %d packets dropped)",
+		cs.Connections, limit(cs.MaxConnections), cs.RejectedConnections,
+		cs.BufferedBytes, limit(cs.MaxBufferedBytes), cs.DroppedPackets)
+}
+
+// formatSuffixNamespaces returns the given DNS suffix to namespace mappings, sorted by suffix.
+func formatSuffixNamespaces(sns map[string]string) string {
+	sfxs := make([]string, 0, len(sns))
+	for sfx := range sns {
+		sfxs = append(sfxs, sfx)
+	}
+	sort.Strings(sfxs)
+	for i, sfx := range sfxs {
+		sfxs[i] = sfx + " -> " + sns[sfx]
+	}
+	return strings.Join(sfxs, ", ")
+}
 
-		type kv struct {
-			Key   string
-			Value string
+// describeAgentVersions returns a summary of the number of agents per version, newest version first. Versions that
+// are older than the given traffic-manager version are flagged.
+func describeAgentVersions(managerVersion string, agents []*manager.AgentInfo) string {
+	counts := make(map[string]int)
+	for _, a := range agents {
+		counts[a.Version]++
+	}
+	versions := make([]string, 0, len(counts))
+	for v := range counts {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		vi, erri := semver.ParseTolerant(versions[i])
+		vj, errj := semver.ParseTolerant(versions[j])
+		if erri != nil || errj != nil {
+			return versions[i] > versions[j]
 		}
-		var fields []kv
-		defer func() {
-			klen := 0
-			for _, kv := range fields {
-				if len(kv.Key) > klen {
-					klen = len(kv.Key)
-				}
-			}
-			for _, kv := range fields {
-				vlines := strings.Split(strings.TrimSpace(kv.Value), "\n")
-				fmt.Fprintf(out, "  %-*s: %s\n", klen, kv.Key, vlines[0])
-				for _, vline := range vlines[1:] {
-					fmt.Fprintf(out, "    %s\n", vline)
-				}
-			}
-		}()
+		return vi.GT(vj)
+	})
+
+	mv, mvErr := semver.ParseTolerant(managerVersion)
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "%d total\n", len(agents))
+	for _, v := range versions {
+		fmt.Fprintf(&sb, "%s: %d", v, counts[v])
+		if av, err := semver.ParseTolerant(v); err == nil && mvErr == nil && av.LT(mv) {
+			sb.WriteString(" (older than the traffic-manager)")
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
 
+func getUserDaemonStatus(ctx context.Context) (*userDaemonStatus, error) {
+	us := &userDaemonStatus{}
+	err := cliutil.WithStartedConnector(ctx, false, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
 		version, err := connectorClient.Version(ctx, &empty.Empty{})
 		if err != nil {
 			return err
 		}
-		fields = append(fields, kv{"Version", fmt.Sprintf("%s (api %d)", version.Version, version.ApiVersion)})
+		us.Running = true
+		us.Version = version.Version
+		us.APIVersion = version.ApiVersion
 
 		if !cliutil.HasLoggedIn(ctx) {
-			fields = append(fields, kv{"Ambassador Cloud", "Logged out"})
+			us.AmbassadorCloud = "Logged out"
 		} else if _, err := cliutil.GetCloudUserInfo(ctx, false, true); err != nil {
-			fields = append(fields, kv{"Ambassador Cloud", "Login expired (or otherwise no-longer-operational)"})
+			us.AmbassadorCloud = "Login expired (or otherwise no-longer-operational)"
 		} else {
-			fields = append(fields, kv{"Ambassador Cloud", "Logged in"})
+			us.AmbassadorCloud = "Logged in"
 		}
 
 		status, err := connectorClient.Status(ctx, &empty.Empty{})
 		if err != nil {
 			return err
 		}
+		us.ci = status
 		switch status.Error {
 		case connector.ConnectInfo_UNSPECIFIED, connector.ConnectInfo_ALREADY_CONNECTED:
-			fields = append(fields, kv{"Status", "Connected"})
+			us.Connected = true
+			us.Status = "Connected"
 		case connector.ConnectInfo_MUST_RESTART:
-			fields = append(fields, kv{"Status", "Connected, but must restart"})
+			us.Connected = true
+			us.Status = "Connected, but must restart"
 		case connector.ConnectInfo_DISCONNECTED:
-			fields = append(fields, kv{"Status", "Not connected"})
+			us.Status = "Not connected"
 			return nil
 		case connector.ConnectInfo_CLUSTER_FAILED:
-			fields = append(fields, kv{"Status", "Not connected, error talking to cluster"})
-			fields = append(fields, kv{"Error", status.ErrorText})
+			us.Status = "Not connected, error talking to cluster"
+			us.Error = status.ErrorText
 			return nil
 		case connector.ConnectInfo_TRAFFIC_MANAGER_FAILED:
-			fields = append(fields, kv{"Status", "Not connected, error talking to in-cluster Telepresence traffic-manager"})
-			fields = append(fields, kv{"Error", status.ErrorText})
+			us.Status = "Not connected, error talking to in-cluster Telepresence traffic-manager"
+			us.Error = status.ErrorText
+			return nil
+		case connector.ConnectInfo_DAEMON_FAILED:
+			us.Status = "Not connected, error talking to the root daemon"
+			us.Error = status.ErrorText
 			return nil
 		}
+		us.KubernetesServer = status.ClusterServer
+		us.KubernetesContext = status.ClusterContext
+		us.ManagerVersion = status.ManagerVersion
+		us.ManagerNamespace = status.ManagerNamespace
+		us.ProxyAddress = status.ProxyAddress
+		us.InCluster = status.InCluster
+		us.Agents = agentVersions(status.GetAgents().GetAgents())
+		for _, icept := range status.GetIntercepts().GetIntercepts() {
+			us.Intercepts = append(us.Intercepts, interceptStatus{Name: icept.Spec.Name, Client: icept.Spec.Client})
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, cliutil.ErrNoUserDaemon) {
+		return nil, err
+	}
+	return us, nil
+}
+
+func (us *userDaemonStatus) print(out io.Writer) {
+	if !us.Running {
+		fmt.Fprintln(out, "User Daemon: Not running")
+		return
+	}
+	fmt.Fprintln(out, "User Daemon: Running")
+
+	type kv struct {
+		Key   string
+		Value string
+	}
+	fields := []kv{
+		{"Version", fmt.Sprintf("%s (api %d)", us.Version, us.APIVersion)},
+		{"Ambassador Cloud", us.AmbassadorCloud},
+		{"Status", us.Status},
+	}
+	if us.Error != "" {
+		fields = append(fields, kv{"Error", us.Error})
+	}
+	if status := us.ci; us.Connected && status != nil {
 		fields = append(fields, kv{"Kubernetes server", status.ClusterServer})
 		fields = append(fields, kv{"Kubernetes context", status.ClusterContext})
+		if status.ManagerVersion != "" {
+			fields = append(fields, kv{"Traffic Manager", fmt.Sprintf("%s (namespace %s)", status.ManagerVersion, status.ManagerNamespace)})
+		}
+		fields = append(fields, kv{"Traffic Agents", describeAgentVersions(status.ManagerVersion, status.GetAgents().GetAgents())})
+		if status.ProxyAddress != "" {
+			fields = append(fields, kv{"Proxy", status.ProxyAddress})
+		}
+		if status.ProxyAutoConfigUrl != "" {
+			fields = append(fields, kv{"Proxy auto-config", status.ProxyAutoConfigUrl})
+		}
+		if status.InCluster {
+			fields = append(fields, kv{"Network", "In-cluster (the network and DNS of the pod are used)"})
+		}
+		if status.PortForwardFallback != "" {
+			fields = append(fields, kv{"Network", "Loopback port-forwards (" + status.PortForwardFallback + ")"})
+			fields = append(fields, kv{"Loopback DNS", status.LoopbackDnsAddress})
+			forwards := fmt.Sprintf("%d total\n", len(status.LoopbackForwards))
+			for _, lf := range status.LoopbackForwards {
+				forwards += fmt.Sprintf("%s.%s:%d: %s\n", lf.Service, lf.Namespace, lf.Port, lf.LocalAddress)
+			}
+			fields = append(fields, kv{"Port forwards", forwards})
+		}
 		intercepts := fmt.Sprintf("%d total\n", len(status.GetIntercepts().GetIntercepts()))
 		for _, icept := range status.GetIntercepts().GetIntercepts() {
-			intercepts += fmt.Sprintf("%s: %s\n", icept.Spec.Name, icept.Spec.Client)
+			intercepts += fmt.Sprintf("%s: %s, %s\n", icept.Spec.Name, icept.Spec.Client, describeInterceptStats(icept.Stats))
 		}
 		fields = append(fields, kv{"Intercepts", intercepts})
+	}
 
-		return nil
-	})
-	if err != nil {
-		if errors.Is(err, cliutil.ErrNoUserDaemon) {
-			fmt.Fprintln(out, "User Daemon: Not running")
-			return nil
+	klen := 0
+	for _, kv := range fields {
+		if len(kv.Key) > klen {
+			klen = len(kv.Key)
+		}
+	}
+	for _, kv := range fields {
+		vlines := strings.Split(strings.TrimSpace(kv.Value), "\n")
+		fmt.Fprintf(out, "  %-*s: %s\n", klen, kv.Key, vlines[0])
+		for _, vline := range vlines[1:] {
+			fmt.Fprintf(out, "    %s\n", vline)
+		}
+	}
+}
+
+// getNetworkConfig returns the routes, DNS configuration, and TUN device that are in effect for the
+// current session.
+func getNetworkConfig(ctx context.Context) (nc *daemon.NetworkConfig, err error) {
+	err = cliutil.WithStartedConnector(ctx, false, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
+		if nc, err = connectorClient.GetNetworkConfig(ctx, &empty.Empty{}); err != nil {
+			switch grpcStatus.Code(err) {
+			case grpcCodes.Unavailable:
+				return errcat.User.New("telepresence is not connected")
+			case grpcCodes.FailedPrecondition:
+				return errcat.User.New(grpcStatus.Convert(err).Message())
+			}
 		}
 		return err
+	})
+	if errors.Is(err, cliutil.ErrNoUserDaemon) {
+		err = errcat.User.New("telepresence is not connected")
+	}
+	return nc, err
+}
+func printNetworkConfig(out io.Writer, nc *daemon.NetworkConfig) {
+	fmt.Fprintln(out, "Network:")
+	if td := nc.TunDevice; td != nil {
+		fmt.Fprintf(out, "  TUN device : %s (index %d, mtu %d)\n", td.Name, td.Index, td.Mtu)
+		for _, addr := range td.Addresses {
+			fmt.Fprintf(out, "    - %s\n", iputil.IPNetFromRPC(addr))
+		}
+	}
+	if nc.ProcessRouting {
+		fmt.Fprintf(out, "  Routes     : (%d subnets, only for processes started with telepresence run)\n", len(nc.RoutedSubnets))
+	} else {
+		fmt.Fprintf(out, "  Routes     : (%d subnets)\n", len(nc.RoutedSubnets))
+	}
+	for _, sn := range nc.RoutedSubnets {
+		fmt.Fprintf(out, "    - %s\n", iputil.IPNetFromRPC(sn))
+	}
+	if len(nc.StaticRoutes) > 0 {
+		fmt.Fprintf(out, "  Static routes: (%d)\n", len(nc.StaticRoutes))
+		for _, sr := range nc.StaticRoutes {
+			fmt.Fprintf(out, "    - %s via %s dev %s\n", iputil.IPNetFromRPC(sr.Subnet), net.IP(sr.Gateway), sr.Interface)
+		}
+	}
+	fmt.Fprintln(out, "  DNS        :")
+	if dns := nc.Dns; dns != nil {
+		if dns.LocalIp != nil {
+			fmt.Fprintf(out, "    Local IP          : %v\n", net.IP(dns.LocalIp))
+		}
+		if dns.RemoteIp != nil {
+			fmt.Fprintf(out, "    Remote IP         : %v\n", net.IP(dns.RemoteIp))
+		}
+	}
+	fmt.Fprintf(out, "    Cluster domain    : %s\n", nc.ClusterDomain)
+	fmt.Fprintf(out, "    Search paths      : %v\n", nc.DnsSearchPaths)
+	if len(nc.UpstreamResolvers) > 0 {
+		fmt.Fprintf(out, "    Upstream resolvers: %v\n", nc.UpstreamResolvers)
+	}
+	for _, sr := range nc.SuffixResolvers {
+		fmt.Fprintf(out, "    Suffix resolvers  : %s -> %v\n", sr.Suffix, sr.Resolvers)
+	}
+}
+
+// networkConfigJSON is the JSON representation of a daemon.NetworkConfig. It uses strings for IP
+// addresses and subnets, where the protobuf JSON mapping would use base64 encoded bytes.
+type networkConfigJSON struct {
+	TunDevice      *tunDeviceJSON    `json:"tunDevice,omitempty"`
+	RoutedSubnets  []string          `json:"routedSubnets"`
+	StaticRoutes   []staticRouteJSON `json:"staticRoutes"`
+	ProcessRouting bool              `json:"processRouting,omitempty"`
+	DNS            dnsConfigJSON     `json:"dns"`
+}
+
+type tunDeviceJSON struct {
+	Name      string   `json:"name"`
+	Index     int32    `json:"index"`
+	MTU       int32    `json:"mtu"`
+	Addresses []string `json:"addresses"`
+}
+
+type staticRouteJSON struct {
+	Subnet    string `json:"subnet"`
+	Gateway   string `json:"gateway,omitempty"`
+	Interface string `json:"interface,omitempty"`
+}
+
+type dnsConfigJSON struct {
+	LocalIP           string              `json:"localIP,omitempty"`
+	RemoteIP          string              `json:"remoteIP,omitempty"`
+	ClusterDomain     string              `json:"clusterDomain"`
+	SearchPaths       []string            `json:"searchPaths"`
+	IncludeSuffixes   []string            `json:"includeSuffixes"`
+	ExcludeSuffixes   []string            `json:"excludeSuffixes"`
+	SuffixNamespaces  map[string]string   `json:"suffixNamespaces,omitempty"`
+	UpstreamResolvers []string            `json:"upstreamResolvers,omitempty"`
+	SuffixResolvers   map[string][]string `json:"suffixResolvers,omitempty"`
+	LookupTimeout     string              `json:"lookupTimeout,omitempty"`
+}
+
+func newNetworkConfigJSON(nc *daemon.NetworkConfig) *networkConfigJSON {
+	subnets := func(ipns []*manager.IPNet) []string {
+		ss := make([]string, len(ipns))
+		for i, ipn := range ipns {
+			ss[i] = iputil.IPNetFromRPC(ipn).String()
+		}
+		return ss
+	}
+	ipString := func(ip []byte) string {
+		if ip == nil {
+			return ""
+		}
+		return net.IP(ip).String()
+	}
+
+	nj := &networkConfigJSON{
+		RoutedSubnets:  subnets(nc.RoutedSubnets),
+		StaticRoutes:   make([]staticRouteJSON, len(nc.StaticRoutes)),
+		ProcessRouting: nc.ProcessRouting,
+	}
+	if td := nc.TunDevice; td != nil {
+		nj.TunDevice = &tunDeviceJSON{Name: td.Name, Index: td.Index, MTU: td.Mtu, Addresses: subnets(td.Addresses)}
+	}
+	for i, sr := range nc.StaticRoutes {
+		nj.StaticRoutes[i] = staticRouteJSON{
+			Subnet:    iputil.IPNetFromRPC(sr.Subnet).String(),
+			Gateway:   ipString(sr.Gateway),
+			Interface: sr.Interface,
+		}
+	}
+	dj := &nj.DNS
+	dj.ClusterDomain = nc.ClusterDomain
+	dj.SearchPaths = append([]string{}, nc.DnsSearchPaths...)
+	dj.UpstreamResolvers = nc.UpstreamResolvers
+	if dns := nc.Dns; dns != nil {
+		dj.LocalIP = ipString(dns.LocalIp)
+		dj.RemoteIP = ipString(dns.RemoteIp)
+		dj.IncludeSuffixes = append([]string{}, dns.IncludeSuffixes...)
+		dj.ExcludeSuffixes = append([]string{}, dns.ExcludeSuffixes...)
+		dj.SuffixNamespaces = dns.SuffixNamespaces
+		if dns.LookupTimeout != nil {
+			dj.LookupTimeout = dns.LookupTimeout.AsDuration().String()
+		}
+	}
+	if len(nc.SuffixResolvers) > 0 {
+		dj.SuffixResolvers = make(map[string][]string, len(nc.SuffixResolvers))
+		for _, sr := range nc.SuffixResolvers {
+			dj.SuffixResolvers[sr.Suffix] = sr.Resolvers
+		}
 	}
-	return nil
+	return nj
 }
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+func Test_newNetworkConfigJSON(t *testing.T) {
+	subnet := func(s string) *manager.IPNet {
+		_, ipn, err := net.ParseCIDR(s)
+		require.NoError(t, err)
+		return iputil.IPNetToRPC(ipn)
+	}
+	nc := &daemon.NetworkConfig{
+		TunDevice: &daemon.TunDevice{
+			Name:      "tel0",
+			Index:     12,
+			Mtu:       1500,
+			Addresses: []*manager.IPNet{subnet("10.96.0.0/12")},
+		},
+		RoutedSubnets: []*manager.IPNet{subnet("10.96.0.0/12"), subnet("10.244.0.0/16")},
+		StaticRoutes: []*daemon.StaticRoute{{
+			Subnet:    subnet("192.168.10.0/24"),
+			Gateway:   net.ParseIP("192.168.1.1").To4(),
+			Interface: "eth0",
+		}},
+		Dns: &daemon.DNSConfig{
+			RemoteIp:        net.ParseIP("10.96.0.10").To4(),
+			ExcludeSuffixes: []string{".com"},
+		},
+		ClusterDomain:   "cluster.local.",
+		DnsSearchPaths:  []string{"default.svc.cluster.local."},
+		SuffixResolvers: []*daemon.SuffixResolvers{{Suffix: "corp.", Resolvers: []string{"10.0.0.53"}}},
+	}
+
+	nj := newNetworkConfigJSON(nc)
+	require.NotNil(t, nj.TunDevice)
+	assert.Equal(t, []string{"10.96.0.0/12"}, nj.TunDevice.Addresses)
+	assert.Equal(t, []string{"10.96.0.0/12", "10.244.0.0/16"}, nj.RoutedSubnets)
+	assert.Equal(t, []staticRouteJSON{{Subnet: "192.168.10.0/24", Gateway: "192.168.1.1", Interface: "eth0"}}, nj.StaticRoutes)
+	assert.Equal(t, "10.96.0.10", nj.DNS.RemoteIP)
+	assert.Empty(t, nj.DNS.LocalIP)
+	assert.Equal(t, map[string][]string{"corp.": {"10.0.0.53"}}, nj.DNS.SuffixResolvers)
+
+	data, err := json.Marshal(nj)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"routedSubnets":["10.96.0.0/12","10.244.0.0/16"]`)
+	assert.NotContains(t, string(data), `"localIP"`)
+}
+
+func Test_describeAgentVersions(t *testing.T) {
+	agents := []*manager.AgentInfo{
+		{Name: "echo", Version: "v2.4.9"},
+		{Name: "hello", Version: "v2.5.0"},
+		{Name: "world", Version: "v2.5.0"},
+		{Name: "canary", Version: "v2.10.0"},
+	}
+	assert.Equal(t, "4 total\n"+
+		"v2.10.0: 1\n"+
+		"v2.5.0: 2\n"+
+		"v2.4.9: 1 (older than the traffic-manager)\n",
+		describeAgentVersions("v2.5.0", agents))
+
+	// Nothing is flagged when the traffic-manager version is unknown
+	assert.Equal(t, "1 total\nv2.4.9: 1\n", describeAgentVersions("", agents[:1]))
+	assert.Equal(t, "0 total\n", describeAgentVersions("v2.5.0", nil))
+}
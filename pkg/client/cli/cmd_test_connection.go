@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	grpcCodes "google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+// udpProbe is the payload that is sent when a UDP port is probed.
+var udpProbe = []byte("telepresence test-connection\n")
+
+type testConnectionInfo struct {
+	udp     bool
+	timeout time.Duration
+}
+
+// connectionTestResult is the result of the test-connection command, as printed with --output json.
+type connectionTestResult struct {
+	Address   string `json:"address"`
+	Protocol  string `json:"protocol"`
+	IP        string `json:"ip,omitempty"`
+	DNSTime   string `json:"dns_time,omitempty"`
+	Route     string `json:"route"`
+	Connected bool   `json:"connected"`
+	Latency   string `json:"latency,omitempty"`
+	Note      string `json:"note,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func testConnectionCommand() *cobra.Command {
+	tc := &testConnectionInfo{}
+	cmd := withJSONOutput(&cobra.Command{
+		Use:   "test-connection [flags] <host:port>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Open a connection to a cluster address through the current session",
+		Long: `Open a connection to a cluster address through the current session and report the route that it takes,
+how long the name resolution and the handshake took, and the error, if any.
+
+The route tells whether the address is routed through the TUN device of the session, kept off it by a
+never-proxy subnet, or not routed by telepresence at all, which makes it possible to tell routing problems
+from problems with the application that listens on the port. A TCP connection succeeds when the handshake
+completes. A UDP port is probed by sending a datagram and waiting for a response, and a port that doesn't
+respond isn't necessarily closed.`,
+		RunE: tc.test,
+	})
+	flags := cmd.Flags()
+	flags.BoolVarP(&tc.udp, "udp", "u", false, "Probe a UDP port instead of opening a TCP connection")
+	flags.DurationVar(&tc.timeout, "timeout", 5*time.Second, "The maximum time to wait for the connection or the response")
+	return cmd
+}
+
+func (tc *testConnectionInfo) test(cmd *cobra.Command, args []string) error {
+	host, port, err := net.SplitHostPort(args[0])
+	if err != nil {
+		return errcat.User.New(err)
+	}
+	if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+		return errcat.User.Newf("invalid port %q", port)
+	}
+	return withConnector(cmd, false, nil, func(ctx context.Context, cs *connectorState) error {
+		if cs.rootD == nil {
+			return errcat.User.New("the session has no TUN device, use the proxy of the session to reach the cluster")
+		}
+		nc, err := cs.rootD.GetNetworkConfig(ctx, &empty.Empty{})
+		if err != nil {
+			if grpcStatus.Code(err) == grpcCodes.Unavailable {
+				err = errcat.User.New("telepresence is not connected")
+			}
+			return err
+		}
+		if nc.ProcessRouting {
+			// Connect the way that a command started with "telepresence run" does
+			if err = routeThisProcess(ctx, cs); err != nil {
+				return err
+			}
+		}
+		res, err := tc.run(ctx, host, port, nc)
+		if perr := printResult(cmd, res, res.print); perr != nil {
+			return perr
+		}
+		return err
+	})
+}
+
+// run resolves the host, determines the route to its address, and connects to it.
+func (tc *testConnectionInfo) run(ctx context.Context, host, port string, nc *daemon.NetworkConfig) (*connectionTestResult, error) {
+	res := &connectionTestResult{Address: net.JoinHostPort(host, port), Protocol: "tcp"}
+	if tc.udp {
+		res.Protocol = "udp"
+	}
+	ip := iputil.Parse(host)
+	if ip == nil {
+		start := time.Now()
+		rctx, cancel := context.WithTimeout(ctx, tc.timeout)
+		addrs, err := net.DefaultResolver.LookupIPAddr(rctx, host)
+		cancel()
+		res.DNSTime = roundDuration(time.Since(start))
+		if err != nil {
+			res.Route = "unknown"
+			res.Error = err.Error()
+			return res, errcat.User.Newf("unable to resolve %s: %v (see telepresence dns-lookup %s)", host, err, host)
+		}
+		ip = addrs[0].IP
+	}
+	res.IP = ip.String()
+	res.Route = routeTo(ip, nc)
+
+	addr := net.JoinHostPort(ip.String(), port)
+	start := time.Now()
+	var err error
+	if tc.udp {
+		err = tc.probeUDP(ctx, addr, res)
+	} else {
+		var conn net.Conn
+		dialer := net.Dialer{Timeout: tc.timeout}
+		if conn, err = dialer.DialContext(ctx, "tcp", addr); err == nil {
+			_ = conn.Close()
+		}
+	}
+	if err != nil {
+		res.Error = err.Error()
+		return res, errcat.Cluster.Newf("unable to connect to %s: %v", res.Address, err)
+	}
+	res.Connected = true
+	res.Latency = roundDuration(time.Since(start))
+	return res, nil
+}
+
+// probeUDP sends a datagram to the given address and waits for a response. A missing response isn't an
+// error, because many UDP services only respond to requests in their own protocol, but a port that is known
+// to be closed is.
+func (tc *testConnectionInfo) probeUDP(ctx context.Context, addr string, res *connectionTestResult) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(tc.timeout)); err != nil {
+		return err
+	}
+	if _, err = conn.Write(udpProbe); err != nil {
+		return err
+	}
+	buf := make([]byte, 512)
+	if _, err = conn.Read(buf); err != nil {
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			res.Note = fmt.Sprintf("no response within %s, the port may still be open", tc.timeout)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// routeTo describes the route that traffic to the given IP takes, based on the longest subnet of the given
+// network configuration that contains it.
+func routeTo(ip net.IP, nc *daemon.NetworkConfig) string {
+	route := "not routed by telepresence"
+	bits := -1
+	for _, sn := range nc.RoutedSubnets {
+		n := iputil.IPNetFromRPC(sn)
+		if ones, _ := n.Mask.Size(); ones > bits && n.Contains(ip) {
+			bits = ones
+			route = fmt.Sprintf("TUN device, subnet %s", n)
+			if td := nc.TunDevice; td != nil {
+				route = fmt.Sprintf("TUN device %s, subnet %s", td.Name, n)
+			}
+		}
+	}
+	for _, sr := range nc.StaticRoutes {
+		n := iputil.IPNetFromRPC(sr.Subnet)
+		if ones, _ := n.Mask.Size(); ones > bits && n.Contains(ip) {
+			bits = ones
+			route = fmt.Sprintf("never-proxy subnet %s via %s dev %s", n, net.IP(sr.Gateway), sr.Interface)
+		}
+	}
+	return route
+}
+
+func roundDuration(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
+
+func (r *connectionTestResult) print(out io.Writer) {
+	fmt.Fprintf(out, "Address:   %s (%s)\n", r.Address, r.Protocol)
+	if r.IP != "" {
+		fmt.Fprintf(out, "IP:        %s\n", r.IP)
+	}
+	if r.DNSTime != "" {
+		fmt.Fprintf(out, "DNS time:  %s\n", r.DNSTime)
+	}
+	fmt.Fprintf(out, "Route:     %s\n", r.Route)
+	if r.Connected {
+		fmt.Fprintf(out, "Connected: yes, in %s\n", r.Latency)
+	} else {
+		fmt.Fprintln(out, "Connected: no")
+	}
+	if r.Note != "" {
+		fmt.Fprintf(out, "Note:      %s\n", r.Note)
+	}
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+func rpcSubnet(t *testing.T, cidr string) *manager.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	require.NoError(t, err)
+	return iputil.IPNetToRPC(n)
+}
+
+func TestRouteTo(t *testing.T) {
+	nc := &daemon.NetworkConfig{
+		TunDevice:     &daemon.TunDevice{Name: "tel0"},
+		RoutedSubnets: []*manager.IPNet{rpcSubnet(t, "10.96.0.0/12"), rpcSubnet(t, "10.244.0.0/16")},
+		StaticRoutes: []*daemon.StaticRoute{{
+			Subnet:    rpcSubnet(t, "10.96.10.0/24"),
+			Gateway:   net.IP{192, 168, 1, 1},
+			Interface: "eth0",
+		}},
+	}
+	assert.Equal(t, "TUN device tel0, subnet 10.96.0.0/12", routeTo(net.IP{10, 96, 0, 10}, nc))
+	assert.Equal(t, "TUN device tel0, subnet 10.244.0.0/16", routeTo(net.IP{10, 244, 1, 2}, nc))
+	assert.Equal(t, "never-proxy subnet 10.96.10.0/24 via 192.168.1.1 dev eth0", routeTo(net.IP{10, 96, 10, 5}, nc))
+	assert.Equal(t, "not routed by telepresence", routeTo(net.IP{192, 168, 1, 5}, nc))
+}
+
+func TestTestConnection_run(t *testing.T) {
+	ctx := context.Background()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	nc := &daemon.NetworkConfig{RoutedSubnets: []*manager.IPNet{rpcSubnet(t, "127.0.0.0/8")}}
+	tc := &testConnectionInfo{timeout: time.Second}
+
+	res, err := tc.run(ctx, "127.0.0.1", port, nc)
+	require.NoError(t, err)
+	assert.True(t, res.Connected)
+	assert.Equal(t, "tcp", res.Protocol)
+	assert.Equal(t, "TUN device, subnet 127.0.0.0/8", res.Route)
+	assert.Empty(t, res.DNSTime)
+	require.NoError(t, l.Close())
+
+	// A closed port is reported as an error, and the route is still known
+	res, err = tc.run(ctx, "127.0.0.1", port, nc)
+	assert.Error(t, err)
+	assert.False(t, res.Connected)
+	assert.NotEmpty(t, res.Error)
+	assert.Equal(t, "TUN device, subnet 127.0.0.0/8", res.Route)
+
+	// A UDP port that echoes the probe
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 512)
+		if n, addr, err := pc.ReadFrom(buf); err == nil {
+			_, _ = pc.WriteTo(buf[:n], addr)
+		}
+	}()
+	tc.udp = true
+	res, err = tc.run(ctx, "127.0.0.1", strconv.Itoa(pc.LocalAddr().(*net.UDPAddr).Port), nc)
+	require.NoError(t, err)
+	assert.True(t, res.Connected)
+	assert.Equal(t, "udp", res.Protocol)
+	assert.Empty(t, res.Note)
+}
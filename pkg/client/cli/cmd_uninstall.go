@@ -2,26 +2,41 @@ package cli
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
 
 	"github.com/spf13/cobra"
 
 	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cache"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/docker"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/remotefs"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/rootd"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/sysproxy"
+	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
 )
 
 type uninstallInfo struct {
-	agent      bool
-	allAgents  bool
-	everything bool
-	namespace  string
+	agent           bool
+	allAgents       bool
+	everything      bool
+	everythingLocal bool
+	dryRun          bool
+	namespace       string
 }
 
 func uninstallCommand() *cobra.Command {
 	ui := &uninstallInfo{}
 	cmd := &cobra.Command{
-		Use:  "uninstall [flags] { --agent <agents...> |--all-agents | --everything }",
+		Use:  "uninstall [flags] { --agent <agents...> |--all-agents | --everything | --everything-local }",
 		Args: ui.args,
 
 		Short: "Uninstall telepresence agents and manager",
@@ -32,17 +47,27 @@ func uninstallCommand() *cobra.Command {
 	flags.BoolVarP(&ui.agent, "agent", "d", false, "uninstall intercept agent on specific deployments")
 	flags.BoolVarP(&ui.allAgents, "all-agents", "a", false, "uninstall intercept agent on all deployments")
 	flags.BoolVarP(&ui.everything, "everything", "e", false, "uninstall agents and the traffic manager")
+	flags.BoolVarP(&ui.everythingLocal, "everything-local", "", false,
+		"quit the daemons and remove everything that telepresence has created on this workstation")
 	flags.StringVarP(&ui.namespace, "namespace", "n", "", "If present, the namespace scope for this CLI request")
+	flags.BoolVar(&ui.dryRun, "dry-run", false,
+		"list what would be removed or modified without removing or modifying anything")
 
 	return cmd
 }
 
 func (u *uninstallInfo) args(cmd *cobra.Command, args []string) error {
-	if u.agent && u.allAgents || u.agent && u.everything || u.allAgents && u.everything {
-		return errcat.User.New("--agent, --all-agents, or --everything are mutually exclusive")
+	selected := 0
+	for _, b := range []bool{u.agent, u.allAgents, u.everything, u.everythingLocal} {
+		if b {
+			selected++
+		}
+	}
+	if selected > 1 {
+		return errcat.User.New("--agent, --all-agents, --everything, or --everything-local are mutually exclusive")
 	}
-	if !(u.agent || u.allAgents || u.everything) {
-		return errcat.User.New("please specify --agent, --all-agents, or --everything")
+	if selected == 0 {
+		return errcat.User.New("please specify --agent, --all-agents, --everything, or --everything-local")
 	}
 	switch {
 	case u.agent && len(args) == 0:
@@ -55,11 +80,15 @@ func (u *uninstallInfo) args(cmd *cobra.Command, args []string) error {
 
 // uninstall
 func (u *uninstallInfo) run(cmd *cobra.Command, args []string) error {
+	if u.everythingLocal {
+		return uninstallLocal(cmd, u.dryRun)
+	}
 	doQuit := false
 	err := withConnector(cmd, true, nil, func(ctx context.Context, cs *connectorState) error {
 		ur := &connector.UninstallRequest{
 			UninstallType: 0,
 			Namespace:     u.namespace,
+			DryRun:        u.dryRun,
 		}
 		switch {
 		case u.agent:
@@ -75,12 +104,16 @@ func (u *uninstallInfo) run(cmd *cobra.Command, args []string) error {
 			return err
 		}
 		if r.ErrorText != "" {
-			ec := errcat.Unknown
-			if r.ErrorCategory != 0 {
-				ec = errcat.Category(r.ErrorCategory)
+			ec := errcat.Cluster
+			if rc := errcat.Category(r.ErrorCategory); rc != errcat.OK && rc != errcat.Unknown {
+				ec = rc
 			}
 			return ec.New(r.ErrorText)
 		}
+		if u.dryRun {
+			printUninstallChanges(cmd.OutOrStdout(), r.Changes)
+			return nil
+		}
 
 		if ur.UninstallType == connector.UninstallRequest_EVERYTHING {
 			// No need to keep daemons once everything is uninstalled
@@ -118,3 +151,168 @@ func removeClusterFromUserCache(ctx context.Context, connInfo *connector.Connect
 	}
 	return nil
 }
+
+// printUninstallChanges prints the changes that an uninstall would make.
+func printUninstallChanges(out io.Writer, changes []string) {
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "Nothing would be removed or modified")
+		return
+	}
+	fmt.Fprintln(out, "The following would be removed or modified:")
+	for _, change := range changes {
+		fmt.Fprintf(out, "  %s\n", change)
+	}
+}
+
+// uninstallLocal quits the daemons and reverts all changes that telepresence has made to the
+// workstation: the daemon container, WebDAV mounts, system proxy settings, process routing rules,
+// files and directories, and the key in the keychain. Each reverted item is printed on the command's
+// output. When dryRun is true, the daemons are left running and the items are printed without being
+// reverted.
+func uninstallLocal(cmd *cobra.Command, dryRun bool) error {
+	ctx := cmd.Context()
+	if !dryRun {
+		if err := cliutil.Disconnect(ctx, true, true); err != nil {
+			return err
+		}
+	}
+	r := &reverter{out: cmd.OutOrStdout(), dryRun: dryRun}
+
+	if docker.ContainerExists(ctx) {
+		r.revert("the daemon container "+docker.ContainerName, func() error { return docker.Remove(ctx) })
+	}
+
+	// The mounts are removed before the cache directory, because that's where they're recorded.
+	mounts, err := cache.LoadWebDAVMountsFromUserCache(ctx)
+	if err != nil {
+		return err
+	}
+	mountPoints := make([]string, 0, len(mounts))
+	for mountPoint := range mounts {
+		mountPoints = append(mountPoints, mountPoint)
+	}
+	sort.Strings(mountPoints)
+	for _, mountPoint := range mountPoints {
+		mountPoint := mountPoint
+		r.revert("the WebDAV mount at "+mountPoint, func() error { return remotefs.RemoveWebDAVMount(ctx, mountPoint) })
+	}
+
+	if set, err := sysproxy.IsSet(ctx); err != nil {
+		return err
+	} else if set {
+		r.revert("the system proxy settings of telepresence", func() error { return sysproxy.Restore(ctx) })
+	}
+
+	leftovers, err := rootd.ProcessRoutingLeftovers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, lo := range leftovers {
+		lo := lo
+		r.revert(lo.Description, func() error { return lo.Remove(ctx) })
+	}
+
+	var paths []string
+	for _, socketName := range []string{client.ConnectorSocketName, client.DaemonSocketName} {
+		if exists, err := client.SocketExists(socketName); err == nil && exists {
+			paths = append(paths, socketName)
+		}
+	}
+	if runtime.GOOS == "darwin" {
+		// The root daemon removes these on exit, but files may be left behind after a crash.
+		resolverFiles, err := filepath.Glob(filepath.Join("/etc", "resolver", "telepresence.*"))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, resolverFiles...)
+	}
+	for _, dirFunc := range []func(context.Context) (string, error){filelocation.AppUserLogDir, filelocation.AppUserCacheDir} {
+		dir, err := dirFunc(ctx)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, dir)
+	}
+	if err = r.removePaths(paths); err != nil {
+		return err
+	}
+
+	if has, err := cache.HasUserCacheKey(ctx); err != nil {
+		return err
+	} else if has {
+		r.revert("the keychain entry "+cache.UserCacheKeyName, func() error { return cache.DeleteUserCacheKey(ctx) })
+	}
+	return r.err()
+}
+
+// removeLocalPaths removes the given paths and prints each path that was removed. Paths that
+// don't exist are silently ignored. Paths that can't be removed because of insufficient
+// permissions are reported, and result in an error once all paths have been processed. When
+// dryRun is true, the paths that would be removed are printed and nothing is removed.
+func removeLocalPaths(out io.Writer, paths []string, dryRun bool) error {
+	r := &reverter{out: out, dryRun: dryRun}
+	if err := r.removePaths(paths); err != nil {
+		return err
+	}
+	return r.err()
+}
+
+// reverter reverts changes to the workstation, prints each reverted change, and counts the changes
+// that couldn't be reverted, so that one failure doesn't prevent the other changes from being
+// reverted.
+type reverter struct {
+	out    io.Writer
+	dryRun bool
+
+	// denied is the number of changes that couldn't be reverted because of insufficient permissions
+	denied int
+
+	// failed is the number of changes that couldn't be reverted for other reasons
+	failed int
+}
+
+// revert calls f to revert the change with the given description, unless this is a dry run.
+func (r *reverter) revert(what string, f func() error) {
+	if r.dryRun {
+		fmt.Fprintf(r.out, "Would remove %s\n", what)
+		return
+	}
+	if err := f(); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			fmt.Fprintf(r.out, "Unable to remove %s: permission denied\n", what)
+			r.denied++
+		} else {
+			fmt.Fprintf(r.out, "Unable to remove %s: %v\n", what, err)
+			r.failed++
+		}
+		return
+	}
+	fmt.Fprintf(r.out, "Removed %s\n", what)
+}
+
+// removePaths removes the given paths. Paths that don't exist are silently ignored.
+func (r *reverter) removePaths(paths []string) error {
+	for _, path := range paths {
+		if _, err := os.Lstat(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		path := path
+		r.revert(path, func() error { return os.RemoveAll(path) })
+	}
+	return nil
+}
+
+// err returns an error when changes couldn't be reverted.
+func (r *reverter) err() error {
+	switch {
+	case r.denied > 0:
+		return errcat.User.Newf("%d item(s) could not be removed; rerun with elevated privileges to remove them", r.denied+r.failed)
+	case r.failed > 0:
+		return errcat.Unknown.Newf("%d item(s) could not be removed", r.failed)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_removeLocalPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	cacheDir := filepath.Join(tmpDir, "cache")
+	require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, "logs"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "ingresses.json"), []byte("{}"), 0600))
+	missing := filepath.Join(tmpDir, "missing")
+
+	out := &bytes.Buffer{}
+	require.NoError(t, removeLocalPaths(out, []string{cacheDir, missing}, true))
+	assert.Equal(t, "Would remove "+cacheDir+"\n", out.String())
+	_, err := os.Stat(cacheDir)
+	require.NoError(t, err)
+
+	out.Reset()
+	require.NoError(t, removeLocalPaths(out, []string{cacheDir, missing}, false))
+	assert.Equal(t, "Removed "+cacheDir+"\n", out.String())
+	_, err = os.Stat(cacheDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_uninstallArgs(t *testing.T) {
+	ui := &uninstallInfo{everythingLocal: true}
+	assert.NoError(t, ui.args(nil, nil))
+	assert.Error(t, ui.args(nil, []string{"echo"}))
+
+	ui.everything = true
+	assert.Error(t, ui.args(nil, nil))
+}
+
+func Test_printUninstallChanges(t *testing.T) {
+	out := &bytes.Buffer{}
+	printUninstallChanges(out, nil)
+	assert.Equal(t, "Nothing would be removed or modified\n", out.String())
+
+	out.Reset()
+	printUninstallChanges(out, []string{"Restart Deployment echo.default to remove its injected traffic-agent"})
+	assert.Equal(t, "The following would be removed or modified:\n"+
+		"  Restart Deployment echo.default to remove its injected traffic-agent\n", out.String())
+}
+
+func Test_reverter(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := &reverter{out: out, dryRun: true}
+	r.revert("the thing", func() error { t.Fatal("reverted in a dry run"); return nil })
+	assert.Equal(t, "Would remove the thing\n", out.String())
+	assert.NoError(t, r.err())
+
+	out.Reset()
+	r = &reverter{out: out}
+	r.revert("the thing", func() error { return nil })
+	r.revert("the rule", func() error { return errors.New("boom") })
+	assert.Equal(t, "Removed the thing\nUnable to remove the rule: boom\n", out.String())
+	assert.EqualError(t, r.err(), "1 item(s) could not be removed")
+
+	out.Reset()
+	r.revert("the mount", func() error { return fmt.Errorf("unmount: %w", os.ErrPermission) })
+	assert.Equal(t, "Unable to remove the mount: permission denied\n", out.String())
+	assert.EqualError(t, r.err(), "2 item(s) could not be removed; rerun with elevated privileges to remove them")
+}
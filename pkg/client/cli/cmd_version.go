@@ -2,7 +2,10 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
 
 	"github.com/spf13/cobra"
 	empty "google.golang.org/protobuf/types/known/emptypb"
@@ -10,53 +13,129 @@ import (
 	"github.com/telepresenceio/telepresence/rpc/v2/common"
 	"github.com/telepresenceio/telepresence/rpc/v2/connector"
 	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
 )
 
+const (
+	versionOK           = "ok"
+	versionNotRunning   = "not running"
+	versionNotConnected = "not connected"
+	versionError        = "error"
+)
+
+type versionArgs struct {
+	agents bool
+}
+
+// componentVersion is the version of one component, or the reason why it's unknown.
+type componentVersion struct {
+	Version    string `json:"version,omitempty"`
+	APIVersion int32  `json:"apiVersion,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+type agentVersion struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   string `json:"version"`
+}
+
+// versionInfo is the document that "telepresence version --output json" prints.
+type versionInfo struct {
+	Client         componentVersion `json:"client"`
+	RootDaemon     componentVersion `json:"rootDaemon"`
+	UserDaemon     componentVersion `json:"userDaemon"`
+	TrafficManager componentVersion `json:"trafficManager"`
+	Agents         []agentVersion   `json:"agents,omitempty"`
+}
+
 func versionCommand() *cobra.Command {
-	return &cobra.Command{
+	va := &versionArgs{}
+	cmd := withJSONOutput(&cobra.Command{
 		Use:  "version",
 		Args: cobra.NoArgs,
 
-		Short:   "Show version",
-		PreRunE: forcedUpdateCheck,
-		RunE:    printVersion,
-	}
+		Short: "Show version",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if outputFormat(cmd) == outputFormatJSON {
+				// A message about an available update would make the output unparsable
+				return nil
+			}
+			return forcedUpdateCheck(cmd, args)
+		},
+		RunE: va.printVersion,
+	})
+	addOutputFlag(cmd)
+	flags := cmd.Flags()
+	flags.BoolVar(&va.agents, "agents", false, "Also show the versions of the traffic-agents in the mapped namespaces")
+	return cmd
 }
 
-// printVersion requests version info from the daemon and prints both client and daemon version.
-func printVersion(cmd *cobra.Command, _ []string) error {
-	fmt.Fprintf(cmd.OutOrStdout(), "Client: %s\n",
-		client.DisplayVersion())
-
+// printVersion requests version info from the daemons and the traffic-manager and prints them together with
+// the client version.
+func (va *versionArgs) printVersion(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	vi := versionInfo{
+		Client: componentVersion{Version: client.Version(), APIVersion: client.APIVersion, Status: versionOK},
+	}
 	var retErr error
+	version, err := daemonVersion(ctx)
+	if vi.RootDaemon, err = newComponentVersion(version, err, cliutil.ErrNoNetwork); err != nil {
+		retErr = err
+	}
+	version, err = connectorVersion(ctx)
+	if vi.UserDaemon, err = newComponentVersion(version, err, cliutil.ErrNoUserDaemon); err != nil {
+		retErr = err
+	}
+	if vi.TrafficManager, vi.Agents, err = managerVersion(ctx, va.agents); err != nil {
+		retErr = err
+	}
+
+	if err = printResult(cmd, &vi, vi.print); err != nil {
+		return err
+	}
+	return retErr
+}
+
+func (vi *versionInfo) print(out io.Writer) {
+	fmt.Fprintf(out, "Client: %s\n", client.DisplayVersion())
+	vi.RootDaemon.print(out, "Root Daemon")
+	vi.UserDaemon.print(out, "User Daemon")
+	vi.TrafficManager.print(out, "Traffic Manager")
+	for _, av := range vi.Agents {
+		fmt.Fprintf(out, "Traffic Agent %s.%s: %s\n", av.Name, av.Namespace, av.Version)
+	}
+}
 
-	version, err := daemonVersion(cmd.Context())
+func (cv *componentVersion) print(out io.Writer, name string) {
 	switch {
-	case err == nil:
-		fmt.Fprintf(cmd.OutOrStdout(), "Root Daemon: %s (api v%d)\n",
-			version.Version, version.ApiVersion)
-	case err == cliutil.ErrNoNetwork:
-		fmt.Fprintf(cmd.OutOrStdout(), "Root Daemon: not running\n")
+	case cv.Status != versionOK:
+		if cv.Error != "" {
+			fmt.Fprintf(out, "%s: %s: %s\n", name, cv.Status, cv.Error)
+		} else {
+			fmt.Fprintf(out, "%s: %s\n", name, cv.Status)
+		}
+	case cv.APIVersion != 0:
+		fmt.Fprintf(out, "%s: %s (api v%d)\n", name, cv.Version, cv.APIVersion)
 	default:
-		fmt.Fprintf(cmd.OutOrStdout(), "Root Daemon: error: %v\n", err)
-		retErr = err
+		fmt.Fprintf(out, "%s: %s\n", name, cv.Version)
 	}
+}
 
-	version, err = connectorVersion(cmd.Context())
+// newComponentVersion returns the componentVersion for a version that was retrieved with the given error. The
+// error is returned unless it's nil or notRunning.
+func newComponentVersion(version *common.VersionInfo, err, notRunning error) (componentVersion, error) {
 	switch {
 	case err == nil:
-		fmt.Fprintf(cmd.OutOrStdout(), "User Daemon: %s (api v%d)\n",
-			version.Version, version.ApiVersion)
-	case err == cliutil.ErrNoUserDaemon:
-		fmt.Fprintf(cmd.OutOrStdout(), "User Daemon: not running\n")
+		return componentVersion{Version: version.Version, APIVersion: version.ApiVersion, Status: versionOK}, nil
+	case err == notRunning:
+		return componentVersion{Status: versionNotRunning}, nil
 	default:
-		fmt.Fprintf(cmd.OutOrStdout(), "User Daemon: error: %v\n", err)
-		retErr = err
+		return componentVersion{Status: versionError, Error: err.Error()}, err
 	}
-
-	return retErr
 }
 
 func daemonVersion(ctx context.Context) (*common.VersionInfo, error) {
@@ -90,3 +169,63 @@ func connectorVersion(ctx context.Context) (*common.VersionInfo, error) {
 	}
 	return version, nil
 }
+
+// managerVersion returns the version of the traffic-manager that the connector is connected to and, when
+// withAgents is true, the versions of the traffic-agents that the connector knows about.
+func managerVersion(ctx context.Context, withAgents bool) (cv componentVersion, agents []agentVersion, err error) {
+	err = cliutil.WithStartedConnector(ctx, false, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
+		ci, err := connectorClient.Status(ctx, &empty.Empty{})
+		if err != nil {
+			return err
+		}
+		if ci.Error != connector.ConnectInfo_ALREADY_CONNECTED {
+			cv.Status = versionNotConnected
+			return nil
+		}
+		if withAgents {
+			agents = agentVersions(ci.Agents.GetAgents())
+		}
+		return cliutil.WithStartedManager(ctx, func(ctx context.Context, managerClient manager.ManagerClient) error {
+			version, err := managerClient.Version(ctx, &empty.Empty{})
+			if err != nil {
+				return err
+			}
+			cv = componentVersion{Version: version.Version, Status: versionOK}
+			return nil
+		})
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, cliutil.ErrNoUserDaemon):
+		cv.Status = versionNotConnected
+		err = nil
+	default:
+		cv = componentVersion{Status: versionError, Error: err.Error()}
+	}
+	return cv, agents, err
+}
+
+// agentVersions returns the distinct versions of the given agents, sorted by namespace and name. The agents
+// of the replicas of a workload are listed once unless they differ in version.
+func agentVersions(agents []*manager.AgentInfo) []agentVersion {
+	seen := make(map[agentVersion]struct{}, len(agents))
+	avs := make([]agentVersion, 0, len(agents))
+	for _, agent := range agents {
+		av := agentVersion{Name: agent.Name, Namespace: agent.Namespace, Version: agent.Version}
+		if _, ok := seen[av]; !ok {
+			seen[av] = struct{}{}
+			avs = append(avs, av)
+		}
+	}
+	sort.Slice(avs, func(i, j int) bool {
+		a, b := avs[i], avs[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+	return avs
+}
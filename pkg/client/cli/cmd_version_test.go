@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/common"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+)
+
+func Test_agentVersions(t *testing.T) {
+	agents := []*manager.AgentInfo{
+		{Name: "orders", Namespace: "shop", Version: "v2.5.0"},
+		{Name: "echo", Namespace: "default", Version: "v2.4.9"},
+		{Name: "orders", Namespace: "shop", Version: "v2.5.0"},
+		{Name: "orders", Namespace: "shop", Version: "v2.4.9"},
+	}
+	assert.Equal(t, []agentVersion{
+		{Name: "echo", Namespace: "default", Version: "v2.4.9"},
+		{Name: "orders", Namespace: "shop", Version: "v2.4.9"},
+		{Name: "orders", Namespace: "shop", Version: "v2.5.0"},
+	}, agentVersions(agents))
+}
+
+func Test_versionInfo(t *testing.T) {
+	rd, err := newComponentVersion(&common.VersionInfo{Version: "v2.5.0", ApiVersion: 3}, nil, cliutil.ErrNoNetwork)
+	require.NoError(t, err)
+	ud, err := newComponentVersion(nil, cliutil.ErrNoUserDaemon, cliutil.ErrNoUserDaemon)
+	require.NoError(t, err)
+	vi := versionInfo{
+		Client:         componentVersion{Version: "v2.5.0", APIVersion: 3, Status: versionOK},
+		RootDaemon:     rd,
+		UserDaemon:     ud,
+		TrafficManager: componentVersion{Status: versionError, Error: "boom"},
+		Agents:         []agentVersion{{Name: "echo", Namespace: "default", Version: "v2.5.0"}},
+	}
+
+	_, err = newComponentVersion(nil, errors.New("boom"), cliutil.ErrNoNetwork)
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	vi.print(&buf)
+	assert.Contains(t, buf.String(), "Root Daemon: v2.5.0 (api v3)\n"+
+		"User Daemon: not running\n"+
+		"Traffic Manager: error: boom\n"+
+		"Traffic Agent echo.default: v2.5.0\n")
+
+	data, err := json.Marshal(&vi)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "client": {"version": "v2.5.0", "apiVersion": 3, "status": "ok"},
+  "rootDaemon": {"version": "v2.5.0", "apiVersion": 3, "status": "ok"},
+  "userDaemon": {"status": "not running"},
+  "trafficManager": {"status": "error", "error": "boom"},
+  "agents": [{"name": "echo", "namespace": "default", "version": "v2.5.0"}]
+}`, string(data))
+}
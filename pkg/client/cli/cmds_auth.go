@@ -1,8 +1,13 @@
 package cli
 
 import (
+	"fmt"
+	"io"
+
 	"github.com/spf13/cobra"
 
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
 )
 
@@ -38,3 +43,56 @@ func LogoutCommand() *cobra.Command {
 		},
 	}
 }
+
+func APIKeyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  "apikey",
+		Args: cobra.NoArgs,
+
+		Short: "Manage the Ambassador Cloud API keys that telepresence uses",
+	}
+	cmd.AddCommand(apikeyRotateCommand())
+	return cmd
+}
+
+func apikeyRotateCommand() *cobra.Command {
+	var description string
+	cmd := &cobra.Command{
+		Use:  "rotate",
+		Args: cobra.NoArgs,
+
+		Short: "Replace the API keys that telepresence uses with new ones",
+		Long: `Replace the API keys that telepresence has created with new ones, pass the new keys on to the
+traffic-manager and the traffic-agents of active intercepts, and then revoke the replaced keys. Use this
+when a key has leaked. The key given to "telepresence login --apikey" is never rotated.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			result, err := cliutil.RotateCloudAPIKeys(cmd.Context(), description)
+			if err != nil {
+				return err
+			}
+			printRotatedKeys(cmd.OutOrStdout(), result)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&description, "description", "",
+		`Only rotate the key with this description, e.g. "telepresence:workstation"`)
+	return cmd
+}
+
+func printRotatedKeys(out io.Writer, result *connector.RotateKeysResult) {
+	keys := result.GetKeys()
+	if len(keys) == 0 {
+		fmt.Fprintln(out, "There are no API keys to rotate")
+		return
+	}
+	for _, key := range keys {
+		if key.RevokeError == "" {
+			fmt.Fprintf(out, "Rotated API key %q\n", key.Description)
+		} else {
+			fmt.Fprintf(out, "Rotated API key %q, but the replaced key wasn't revoked: %s\n", key.Description, key.RevokeError)
+		}
+	}
+	if ue := result.GetUpdateError(); ue != "" {
+		fmt.Fprintf(out, "The new keys couldn't be passed on to the traffic-manager: %s\n", ue)
+	}
+}
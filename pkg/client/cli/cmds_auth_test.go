@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+)
+
+func Test_printRotatedKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *connector.RotateKeysResult
+		want   string
+	}{
+		{
+			name:   "none",
+			result: &connector.RotateKeysResult{},
+			want:   "There are no API keys to rotate\n",
+		},
+		{
+			name: "revoked",
+			result: &connector.RotateKeysResult{Keys: []*connector.RotateKeysResult_RotatedKey{
+				{Description: "telepresence:workstation"},
+				{Description: "telepresence:traffic-manager", RevokeError: "403 Forbidden"},
+			}},
+			want: "Rotated API key \"telepresence:workstation\"\n" +
+				"Rotated API key \"telepresence:traffic-manager\", but the replaced key wasn't revoked: 403 Forbidden\n",
+		},
+		{
+			name: "update-error",
+			result: &connector.RotateKeysResult{
+				Keys:        []*connector.RotateKeysResult_RotatedKey{{Description: "telepresence:agent-http"}},
+				UpdateError: "not connected",
+			},
+			want: "Rotated API key \"telepresence:agent-http\"\n" +
+				"The new keys couldn't be passed on to the traffic-manager: not connected\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			printRotatedKeys(&buf, tt.result)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
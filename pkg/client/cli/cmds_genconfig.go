@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+)
+
+// gitOpsWorkloadKinds are the kinds of workloads that telepresence annotates when it installs a traffic-agent.
+var gitOpsWorkloadKinds = []string{"Deployment", "ReplicaSet", "StatefulSet"}
+
+// gitOpsTemplateAnnotations are the pod template annotations that telepresence adds to a workload when
+// intercept.annotationOnly is enabled, or when it restarts a workload to get its agent injected or removed.
+var gitOpsTemplateAnnotations = []string{
+	install.InjectAnnotation,
+	install.ServiceNameAnnotation,
+	install.ServicePortAnnotation,
+	install.InjectionEnabledAnnotation,
+	install.RestartedAtAnnotation,
+}
+
+func genConfigCommand() *cobra.Command {
+	info := genYAMLInfo{}
+	cmd := &cobra.Command{
+		Use:  "genconfig",
+		Args: OnlySubcommands,
+
+		Short: "Generate configuration for GitOps controllers.",
+		Long: `Generate configuration that prevents GitOps controllers from reverting the changes that telepresence
+makes to workloads when it installs a traffic-agent. The generated configuration only covers the pod template
+annotations that are used when intercept.annotationOnly is enabled in the telepresence config.yml.`,
+		RunE: RunSubcommands,
+	}
+	cmd.PersistentFlags().StringVar(&info.outputFile, "output", "-",
+		"Path to the file to place the output in. Defaults to '-' which means stdout.")
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "argocd",
+			Args:  cobra.NoArgs,
+			Short: "Generate ignoreDifferences for an Argo CD Application.",
+			Long: `Generate the ignoreDifferences and syncOptions of an Argo CD Application spec. Merge the output
+into the spec of each Application that manages workloads that will be intercepted.`,
+			RunE: func(_ *cobra.Command, _ []string) error {
+				return info.writeYAMLToOutput(argoCDConfig())
+			},
+		},
+		&cobra.Command{
+			Use:   "flux",
+			Args:  cobra.NoArgs,
+			Short: "Generate patches for a Flux Kustomization.",
+			Long: `Generate patches for a Flux Kustomization that make Flux merge its changes with the annotations that
+telepresence adds to workloads instead of overriding them. Merge the output into the spec of each Kustomization
+that manages workloads that will be intercepted.`,
+			RunE: func(_ *cobra.Command, _ []string) error {
+				return info.writeYAMLToOutput(fluxConfig())
+			},
+		},
+	)
+	return cmd
+}
+
+// jsonPointer returns the RFC 6901 JSON pointer to the pod template annotation with the given name.
+func jsonPointer(annotation string) string {
+	return "/spec/template/metadata/annotations/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(annotation)
+}
+
+// argoCDConfig returns the parts of an Argo CD Application spec that make Argo CD ignore the pod
+// template annotations that telepresence adds, both when diffing and when syncing.
+func argoCDConfig() map[string]interface{} {
+	pointers := make([]string, len(gitOpsTemplateAnnotations))
+	for i, a := range gitOpsTemplateAnnotations {
+		pointers[i] = jsonPointer(a)
+	}
+	ignores := make([]map[string]interface{}, len(gitOpsWorkloadKinds))
+	for i, kind := range gitOpsWorkloadKinds {
+		ignores[i] = map[string]interface{}{
+			"group":        "apps",
+			"kind":         kind,
+			"jsonPointers": pointers,
+		}
+	}
+	return map[string]interface{}{
+		"spec": map[string]interface{}{
+			"ignoreDifferences": ignores,
+			"syncPolicy": map[string]interface{}{
+				"syncOptions": []string{"RespectIgnoreDifferences=true"},
+			},
+		},
+	}
+}
+
+// fluxConfig returns the parts of a Flux Kustomization spec that make Flux use a merging server-side
+// apply for workloads, so that annotations added by telepresence are retained.
+func fluxConfig() map[string]interface{} {
+	patches := make([]map[string]interface{}, len(gitOpsWorkloadKinds))
+	for i, kind := range gitOpsWorkloadKinds {
+		patches[i] = map[string]interface{}{
+			"target": map[string]interface{}{
+				"group": "apps",
+				"kind":  kind,
+			},
+			"patch": fmt.Sprintf(`apiVersion: apps/v1
+kind: %s
+metadata:
+  name: not-used
+  annotations:
+    kustomize.toolkit.fluxcd.io/ssa: merge
+`, kind),
+		}
+	}
+	return map[string]interface{}{
+		"spec": map[string]interface{}{
+			"patches": patches,
+		},
+	}
+}
+
+func (i *genYAMLInfo) writeYAMLToOutput(obj interface{}) error {
+	w, err := i.getOutputWriter()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err = enc.Encode(obj); err != nil {
+		return fmt.Errorf("unable to write to output %s: %w", i.outputFile, err)
+	}
+	return enc.Close()
+}
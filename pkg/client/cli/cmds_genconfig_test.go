@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_jsonPointer(t *testing.T) {
+	assert.Equal(t,
+		"/spec/template/metadata/annotations/telepresence.getambassador.io~1inject-traffic-agent",
+		jsonPointer("telepresence.getambassador.io/inject-traffic-agent"))
+	assert.Equal(t, "/spec/template/metadata/annotations/a~0b~1c", jsonPointer("a~b/c"))
+}
+
+func Test_argoCDConfig(t *testing.T) {
+	spec := argoCDConfig()["spec"].(map[string]interface{})
+	ignores := spec["ignoreDifferences"].([]map[string]interface{})
+	assert.Len(t, ignores, len(gitOpsWorkloadKinds))
+	for _, ig := range ignores {
+		assert.Equal(t, "apps", ig["group"])
+		assert.Contains(t, ig["jsonPointers"],
+			"/spec/template/metadata/annotations/telepresence.getambassador.io~1inject-traffic-agent")
+	}
+}
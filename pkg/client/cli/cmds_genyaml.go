@@ -12,13 +12,16 @@ import (
 	"gopkg.in/yaml.v3"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/k8s"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/trafficmgr"
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
 	"github.com/telepresenceio/telepresence/v2/pkg/version"
@@ -38,10 +41,11 @@ func genYAMLCommand() *cobra.Command {
 		Short: "Generate YAML for use in kubernetes manifests.",
 		Long: `Generate traffic-agent yaml for use in kubernetes manifests.
 This allows the traffic agent to be injected by hand into existing kubernetes manifests.
-For your modified workload to be valid, you'll have to manually inject both the container and the volume; you can do this by running "genyaml container" or "genyaml volume"
+Run "genyaml workload" to get the complete workload, and the service that exposes it, with the traffic-agent added.
+Alternatively, you'll have to manually inject both the container and the volume; you can do this by running "genyaml container" or "genyaml volume"
 It is recommended that you not do this unless strictly necessary. Instead, we suggest use of the webhook injector to configure traffic agents.`,
 		RunE: func(_ *cobra.Command, _ []string) error {
-			return fmt.Errorf("please run genyaml as \"genyaml container\" or \"genyaml volume\"")
+			return fmt.Errorf("please run genyaml as \"genyaml workload\", \"genyaml container\", or \"genyaml volume\"")
 		},
 	}
 	cmd.PersistentFlags().StringVar(&info.inputFile, "input", "",
@@ -52,6 +56,7 @@ It is recommended that you not do this unless strictly necessary. Instead, we su
 	cmd.AddCommand(
 		genContainerSubCommand(&info),
 		genVolumeSubCommand(&info),
+		genWorkloadSubCommand(&info),
 	)
 	return cmd
 }
@@ -68,6 +73,16 @@ func (i *genYAMLInfo) getOutputWriter() (io.WriteCloser, error) {
 }
 
 func (i *genYAMLInfo) writeObjToOutput(obj interface{}) error {
+	doc, err := toYAML(obj, false)
+	if err != nil {
+		return err
+	}
+	return i.writeToOutput(doc)
+}
+
+// toYAML returns the YAML representation of the given object. When manifest is true, the fields that are
+// populated by the cluster, like the status, are omitted.
+func toYAML(obj interface{}, manifest bool) ([]byte, error) {
 	// So this sucks: Kubernetes structs don't have yaml serialization tags!
 	// This means that we can't just yaml.Marshal the object. Now, we could use
 	// the client-go to marshal it, but that's actually really hard given that
@@ -77,18 +92,42 @@ func (i *genYAMLInfo) writeObjToOutput(obj interface{}) error {
 	// read it back as a plain old map, and then re-serialize to yaml, we'll get a reasonable result.
 	doc, err := json.Marshal(obj)
 	if err != nil {
-		return fmt.Errorf("unable to marshal agent container: %w", err)
+		return nil, fmt.Errorf("unable to marshal %T: %w", obj, err)
 	}
 	temp := map[string]interface{}{}
 	err = json.Unmarshal(doc, &temp)
 	if err != nil {
 		// Be a bit weird if this happened, but okay.
-		return fmt.Errorf("unable to unmarshal intermediate representation: %w", err)
+		return nil, fmt.Errorf("unable to unmarshal intermediate representation: %w", err)
+	}
+	if manifest {
+		delete(temp, "status")
+		dropCreationTimestamp(temp)
 	}
 	doc, err = yaml.Marshal(&temp)
 	if err != nil {
-		return fmt.Errorf("unable to marshal intermediate representation to yaml: %w", err)
+		return nil, fmt.Errorf("unable to marshal intermediate representation to yaml: %w", err)
+	}
+	return doc, nil
+}
+
+// dropCreationTimestamp removes the null creationTimestamp that the JSON encoding of an object, and of each pod
+// template in it, contains.
+func dropCreationTimestamp(obj map[string]interface{}) {
+	for k, v := range obj {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if k == "metadata" {
+				if ts, ok := v["creationTimestamp"]; ok && ts == nil {
+					delete(v, "creationTimestamp")
+				}
+			}
+			dropCreationTimestamp(v)
+		}
 	}
+}
+
+func (i *genYAMLInfo) writeToOutput(doc []byte) error {
 	w, err := i.getOutputWriter()
 	if err != nil {
 		return err
@@ -112,6 +151,59 @@ func (i *genYAMLInfo) getInputReader() (io.ReadCloser, error) {
 	return f, nil
 }
 
+// loadWorkload reads the workload from the input.
+func (i *genYAMLInfo) loadWorkload() (k8sapi.Workload, error) {
+	f, err := i.getInputReader()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading from %s: %w", i.inputFile, err)
+	}
+
+	// An Argo Rollout is a custom resource, so it's kept in its unstructured form.
+	if js, err := utilyaml.ToJSON(b); err == nil {
+		u := &unstructured.Unstructured{}
+		if err = u.UnmarshalJSON(js); err == nil && u.GetKind() == "Rollout" {
+			return k8sapi.Rollout(u), nil
+		}
+	}
+
+	obj, kind, err := genYAMLDeserializer().Decode(b, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse yaml in %s: %w", i.inputFile, err)
+	}
+	wl, err := k8sapi.WrapWorkload(obj)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected object of kind %s; please pass in a Deployment, ReplicaSet, StatefulSet, or Rollout", kind.Kind)
+	}
+	return wl, nil
+}
+
+func genYAMLDeserializer() runtime.Decoder {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(schema.GroupVersion{Group: appsv1.GroupName, Version: "v1"}, &appsv1.StatefulSet{}, &appsv1.Deployment{}, &appsv1.ReplicaSet{})
+	scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Service{})
+	return serializer.NewCodecFactory(scheme).UniversalDeserializer()
+}
+
+// agentImageName returns the name of the traffic-agent image given by the config.
+func agentImageName(cfg *client.Config) string {
+	registry := cfg.Images.Registry
+	agentImage := cfg.Images.AgentImage
+	// Use sane defaults if the user hasn't configured the registry and/or image
+	if registry == "" {
+		registry = "datawire"
+	}
+	if agentImage == "" {
+		agentImage = "tel2:" + strings.TrimPrefix(version.Version, "v")
+	}
+	return fmt.Sprintf("%s/%s", registry, agentImage)
+}
+
 type genContainerInfo struct {
 	*genYAMLInfo
 	containerName string
@@ -161,30 +253,11 @@ Defaults to the name of the deployment.`)
 func (i *genContainerInfo) run(cmd *cobra.Command, kubeFlags map[string]string) error {
 	ctx := cmd.Context()
 
-	f, err := i.getInputReader()
+	wl, err := i.loadWorkload()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	b, err := io.ReadAll(f)
-	if err != nil {
-		return fmt.Errorf("error reading from %s: %w", i.inputFile, err)
-	}
-
-	scheme := runtime.NewScheme()
-	scheme.AddKnownTypes(schema.GroupVersion{Group: appsv1.GroupName, Version: "v1"}, &appsv1.StatefulSet{}, &appsv1.Deployment{}, &appsv1.ReplicaSet{})
-	codecFactory := serializer.NewCodecFactory(scheme)
-	deserializer := codecFactory.UniversalDeserializer()
-
-	obj, kind, err := deserializer.Decode(b, nil, nil)
-	if err != nil {
-		return fmt.Errorf("unable to parse yaml in %s: %w", i.inputFile, err)
-	}
-	wl, err := k8sapi.WrapWorkload(obj)
-	if err != nil {
-		return fmt.Errorf("unexpected object of kind %s; please pass in a Deployment, ReplicaSet, or StatefulSet", kind)
-	}
+	kind := wl.GetKind()
 	containers := wl.GetPodTemplate().Spec.Containers
 	containerIdx := -1
 	for j, c := range containers {
@@ -208,18 +281,9 @@ func (i *genContainerInfo) run(cmd *cobra.Command, kubeFlags map[string]string)
 		return fmt.Errorf("unable to get k8s config: %w", err)
 	}
 
-	registry := cfg.Images.Registry
-	agentImage := cfg.Images.AgentImage
-	// Use sane defaults if the user hasn't configured the registry and/or image
-	if registry == "" {
-		registry = "datawire"
-	}
-	if agentImage == "" {
-		agentImage = "tel2:" + strings.TrimPrefix(version.Version, "v")
-	}
 	agentContainer := install.AgentContainer(
 		i.serviceName,
-		fmt.Sprintf("%s/%s", registry, agentImage),
+		agentImageName(cfg),
 		container,
 		corev1.ContainerPort{
 			Protocol:      corev1.Protocol(i.proto),
@@ -255,3 +319,96 @@ func (i *genVolumeInfo) run(_ *cobra.Command, _ []string) error {
 	volume := install.AgentVolume()
 	return i.writeObjToOutput(&volume)
 }
+
+type genWorkloadInfo struct {
+	*genYAMLInfo
+	serviceFile      string
+	containerName    string
+	portNameOrNumber string
+}
+
+func genWorkloadSubCommand(yamlInfo *genYAMLInfo) *cobra.Command {
+	kubeFlags := pflag.NewFlagSet("Kubernetes flags", 0)
+	info := genWorkloadInfo{genYAMLInfo: yamlInfo}
+	cmd := &cobra.Command{
+		Use:   "workload",
+		Args:  cobra.NoArgs,
+		Short: "Generate YAML for the workload and its service with the traffic-agent added.",
+		Long: `Generate YAML for the workload and the service that exposes it, with the traffic-agent added.
+
+The traffic-agent container and volume are added to the pod template, and it is annotated as manually injected. The
+ports of the workload and the service are rewritten so that the service's traffic is routed to the traffic-agent, the
+same way that telepresence does it when it installs the agent. The service is included in the output when it was
+modified. Both are given as separate YAML documents.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return info.run(cmd, kubeFlagMap(kubeFlags))
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&info.serviceFile, "service", "",
+		"Path to the yaml containing the definition of the service that exposes the workload.")
+	flags.StringVar(&info.containerName, "container-name", "",
+		"The name of the container hosting the application you wish to intercept. Required when the port matches more than one container.")
+	flags.StringVar(&info.portNameOrNumber, "port", "",
+		"The name or number of the service port you wish to intercept. Required when the service has more than one port.")
+	_ = cmd.MarkFlagRequired("service")
+
+	kubeConfig := genericclioptions.NewConfigFlags(false)
+	kubeConfig.Namespace = nil // "connect", don't take --namespace
+	kubeConfig.AddFlags(kubeFlags)
+	flags.AddFlagSet(kubeFlags)
+	return cmd
+}
+
+func (i *genWorkloadInfo) loadService() (*corev1.Service, error) {
+	b, err := os.ReadFile(i.serviceFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service file %s: %w", i.serviceFile, err)
+	}
+	obj, kind, err := genYAMLDeserializer().Decode(b, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse yaml in %s: %w", i.serviceFile, err)
+	}
+	svc, ok := obj.(*corev1.Service)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object of kind %s in %s; please pass in a Service", kind.Kind, i.serviceFile)
+	}
+	return svc, nil
+}
+
+func (i *genWorkloadInfo) run(cmd *cobra.Command, kubeFlags map[string]string) error {
+	ctx := cmd.Context()
+
+	wl, err := i.loadWorkload()
+	if err != nil {
+		return err
+	}
+	svc, err := i.loadService()
+	if err != nil {
+		return err
+	}
+
+	cfg := client.GetConfig(ctx)
+	k8sConfig, err := k8s.NewConfig(ctx, kubeFlags)
+	if err != nil {
+		return fmt.Errorf("unable to get k8s config: %w", err)
+	}
+	svcModified, err := trafficmgr.AddManualAgent(ctx, wl, svc, i.portNameOrNumber, i.containerName,
+		agentImageName(cfg), k8sConfig.GetManagerNamespace(), uint16(cfg.TelepresenceAPI.Port))
+	if err != nil {
+		return err
+	}
+
+	doc, err := toYAML(wl, true)
+	if err != nil {
+		return err
+	}
+	if svcModified {
+		svcDoc, err := toYAML(svc, true)
+		if err != nil {
+			return err
+		}
+		doc = append(append(doc, "---\n"...), svcDoc...)
+	}
+	return i.writeToOutput(doc)
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const genYAMLDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: echo
+spec:
+  template:
+    metadata:
+      labels:
+        app: echo
+    spec:
+      containers:
+      - name: echo
+        image: jmalloc/echo-server
+`
+
+const genYAMLRollout = `apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: echo
+spec:
+  strategy:
+    canary: {}
+  template:
+    metadata:
+      labels:
+        app: echo
+    spec:
+      containers:
+      - name: echo
+        image: jmalloc/echo-server
+`
+
+func TestGenYAML_loadWorkload(t *testing.T) {
+	dir := t.TempDir()
+	load := func(data string) (*genYAMLInfo, error) {
+		t.Helper()
+		info := &genYAMLInfo{inputFile: filepath.Join(dir, "workload.yaml")}
+		return info, os.WriteFile(info.inputFile, []byte(data), 0600)
+	}
+
+	info, err := load(genYAMLDeployment)
+	require.NoError(t, err)
+	wl, err := info.loadWorkload()
+	require.NoError(t, err)
+	assert.Equal(t, "Deployment", wl.GetKind())
+	assert.Equal(t, "echo", wl.GetPodTemplate().Spec.Containers[0].Name)
+
+	info, err = load(genYAMLRollout)
+	require.NoError(t, err)
+	wl, err = info.loadWorkload()
+	require.NoError(t, err)
+	assert.Equal(t, "Rollout", wl.GetKind())
+
+	// Changes to the pod template of a Rollout are retained, and so are the fields that telepresence doesn't know about
+	tpl := wl.GetPodTemplate()
+	tpl.Annotations = map[string]string{"a": "b"}
+	doc, err := toYAML(wl, true)
+	require.NoError(t, err)
+	var m map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(doc, &m))
+	spec := m["spec"].(map[string]interface{})
+	assert.Contains(t, spec, "strategy")
+	assert.Equal(t, map[string]interface{}{"a": "b"}, spec["template"].(map[string]interface{})["metadata"].(map[string]interface{})["annotations"])
+
+	info, err = load("apiVersion: v1\nkind: Service\nmetadata:\n  name: echo\n")
+	require.NoError(t, err)
+	_, err = info.loadWorkload()
+	assert.Error(t, err)
+}
+
+func TestGenYAML_toYAML(t *testing.T) {
+	dir := t.TempDir()
+	info := &genYAMLInfo{inputFile: filepath.Join(dir, "workload.yaml")}
+	require.NoError(t, os.WriteFile(info.inputFile, []byte(genYAMLDeployment), 0600))
+	wl, err := info.loadWorkload()
+	require.NoError(t, err)
+
+	// The fields that are populated by the cluster are omitted from a manifest
+	doc, err := toYAML(wl, true)
+	require.NoError(t, err)
+	assert.NotContains(t, string(doc), "status")
+	assert.NotContains(t, string(doc), "creationTimestamp")
+
+	doc, err = toYAML(wl, false)
+	require.NoError(t, err)
+	assert.Contains(t, string(doc), "creationTimestamp")
+}
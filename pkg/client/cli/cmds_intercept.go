@@ -2,53 +2,79 @@ package cli
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
-	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	empty "google.golang.org/protobuf/types/known/emptypb"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/datawire/dlib/dcontext"
-	"github.com/datawire/dlib/dexec"
+	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cache"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/extensions"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/docker"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/recording"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/remotefs"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/scout"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/sftpfilter"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/log"
 	"github.com/telepresenceio/telepresence/v2/pkg/proc"
 )
 
 type interceptArgs struct {
 	name        string // Args[0] || `${Args[0]}-${--namespace}` // which depends on a combinationof --workload and --namespace
-	agentName   string // --workload || Args[0] // only valid if !localOnly
+	agentName   string // --workload || Args[0] // only valid if !localOnly and selector is empty
+	selector    string // --selector // only valid if !localOnly
 	namespace   string // --namespace
 	port        string // --port // only valid if !localOnly
 	serviceName string // --service // only valid if !localOnly
+	container   string // --container // only valid if !localOnly
 	localOnly   bool   // --local-only
+	encrypt     bool   // --encrypt // only valid if !localOnly
+	mirror      bool   // --mirror // only valid if !localOnly
+	percentage  int32  // --traffic-percentage // only valid if !localOnly
+
+	idempotencyKey string // --idempotency-key // only valid if !localOnly
+	dependents     string // --dependents // only valid if !localOnly
 
 	previewEnabled bool                 // --preview-url // only valid if !localOnly
 	previewSpec    *manager.PreviewSpec // --preview-url-* // only valid if !localOnly
 
-	envFile  string   // --env-file
-	envJSON  string   // --env-json
-	mount    string   // --mount // "true", "false", or desired mount point // only valid if !localOnly
-	mountSet bool     // whether --mount was passed
-	toPod    []string // --to-pod
+	envFile   string   // --env-file
+	envJSON   string   // --env-json
+	envFormat string   // --env-format
+	mount     string   // --mount // "true", "false", or desired mount point // only valid if !localOnly
+	mountSet  bool     // whether --mount was passed
+	readOnly  bool     // --mount-readonly // only valid if !localOnly
+	include   []string // --mount-include // only valid if !localOnly
+	exclude   []string // --mount-exclude // only valid if !localOnly
+	toPod     []string // --to-pod
+
+	record        string // --record // only valid if !localOnly
+	recordMaxBody int64  // --record-max-body // only valid if !localOnly
+	recordSecrets bool   // --record-secrets // only valid if !localOnly
+
+	detailedOutput io.Writer // --detailed-output // where the JSON details are written, nil to describe the intercept in prose
 
 	dockerRun   bool   // --docker-run
 	dockerMount string // --docker-mount // where to mount in a docker container. Defaults to mount unless mount is "true" or "false".
@@ -94,6 +120,9 @@ type interceptState struct {
 	managerClient   manager.ManagerClient
 	connInfo        *connector.ConnectInfo
 
+	// daemonContainer is the name of the container that runs the daemons, if any
+	daemonContainer string
+
 	// set later ///////////////////////////////////////////////////////////
 
 	env        map[string]string
@@ -101,20 +130,45 @@ type interceptState struct {
 	localPort  uint16 // the parsed <local port>
 
 	dockerPort uint16
+
+	dependentIntercepts []string // intercepts created on dependent workloads
 }
 
 func interceptCommand(ctx context.Context) *cobra.Command {
-	cmd := &cobra.Command{
+	cmd := withJSONOutput(&cobra.Command{
 		Use:  "intercept [flags] <intercept_base_name> [-- <command with arguments...>]",
-		Args: cobra.MinimumNArgs(1),
+		Args: cobra.ArbitraryArgs,
 
-		Short:    "Intercept a service",
-		PreRunE:  updateCheckIfDue,
-		PostRunE: raiseCloudMessage,
-	}
+		Short:             "Intercept a service",
+		PostRunE:          raiseCloudMessage,
+		ValidArgsFunction: completeInterceptableWorkloads,
+	})
 	args := interceptArgs{}
+	var specFile, detailedOutput string
 	flags := cmd.Flags()
 
+	cmd.PreRunE = func(cmd *cobra.Command, positional []string) error {
+		if err := validateDetailedOutput(detailedOutput); err != nil {
+			return err
+		}
+		switch {
+		case outputFormat(cmd) == outputFormatJSON:
+			// The global --output json has already sent everything but the result to stderr
+			args.detailedOutput = resultOutput(cmd)
+		case detailedOutput != "":
+			// Keep stdout parsable by sending everything but the details to stderr
+			args.detailedOutput = resultOutput(cmd)
+			if _, ok := cmd.OutOrStdout().(*infoWriter); !ok {
+				cmd.SetOut(cmd.ErrOrStderr())
+			}
+		}
+		return updateCheckIfDue(cmd, positional)
+	}
+
+	flags.StringVarP(&specFile, "file", "f", "", ``+
+		`Create the intercepts declared in this YAML specification file instead of the one given by the arguments `+
+		`and flags. Use "-" to read the file from stdin`)
+
 	flags.StringVarP(&args.agentName, "workload", "w", "", "Name of workload (Deployment, ReplicaSet) to intercept, if different from <name>")
 	flags.StringVarP(&args.port, "port", "p", strconv.Itoa(client.GetConfig(ctx).Intercept.DefaultPort), ``+
 		`Local port to forward to. If intercepting a service with multiple ports, `+
@@ -124,6 +178,14 @@ func interceptCommand(ctx context.Context) *cobra.Command {
 
 	flags.StringVar(&args.serviceName, "service", "", "Name of service to intercept. If not provided, we will try to auto-detect one")
 
+	flags.StringVar(&args.container, "container", "", ``+
+		`Name of the container, in a pod with multiple containers, whose environment, volume mounts, and port are `+
+		`used by the intercept. If not provided, the container is found using the service port`)
+
+	flags.StringVar(&args.selector, "selector", "", ``+
+		`Label selector, e.g. "app=foo,track=canary", that identifies the workload to intercept by the labels of `+
+		`its pods. Use instead of --workload. The selector must match the pods of exactly one workload`)
+
 	flags.BoolVarP(&args.localOnly, "local-only", "l", false, ``+
 		`Declare a local-only intercept for the purpose of getting direct outbound access to the intercept's namespace`)
 
@@ -134,20 +196,74 @@ func interceptCommand(ctx context.Context) *cobra.Command {
 	args.previewSpec = &manager.PreviewSpec{}
 	addPreviewFlags("preview-url-", flags, args.previewSpec)
 
+	flags.BoolVar(&args.encrypt, "encrypt", false, ``+
+		`Encrypt the payloads of the intercepted connections end-to-end between this client and the traffic-agent, `+
+		`so that they can't be observed by the traffic-manager`)
+
+	flags.BoolVar(&args.mirror, "mirror", false, ``+
+		`Mirror the intercepted traffic instead of diverting it. The intercepted workload still serves the traffic, `+
+		`and a copy of it is sent to the local port. The responses of the local handler are discarded`)
+
+	flags.Int32Var(&args.percentage, "traffic-percentage", 100, ``+
+		`The percentage, 1 to 100, of the intercepted connections, or of the matching HTTP requests, that are `+
+		`diverted to the local port. The rest is still served by the intercepted workload`)
+
+	flags.StringVar(&args.idempotencyKey, "idempotency-key", "", ``+
+		`A unique key that identifies this intercept request. A retried request with the same key returns the `+
+		`intercept that the first request created instead of failing or creating a duplicate, and `+
+		`'telepresence leave --idempotency-key' can remove the intercept by its key. A random key is used when `+
+		`this flag is omitted`)
+
+	flags.StringVar(&args.dependents, "dependents", dependentsSuggest, ``+
+		`What to do with the workloads that the intercepted workload declares as dependents using the `+
+		install.InterceptDependentsAnnotation+` annotation. Use "suggest" to print commands that intercept `+
+		`them using the same matchers, "create" to create those intercepts on the dependents that declare a `+
+		`local port, or "ignore"`)
+
 	flags.StringVarP(&args.envFile, "env-file", "e", "", ``+
-		`Also emit the remote environment to an env file in Docker Compose format. `+
-		`See https://docs.docker.com/compose/env-file/ for more information on the limitations of this format.`)
+		`Also emit the remote environment to an env file in Docker Compose format, or in the format given by `+
+		`--env-format. See https://docs.docker.com/compose/env-file/ for more information on the limitations of `+
+		`the Docker Compose format.`)
 
 	flags.StringVarP(&args.envJSON, "env-json", "j", "", `Also emit the remote environment to a file as a JSON blob.`)
 
+	flags.StringVar(&args.envFormat, "env-format", envFormatDotenv, ``+
+		`The format of the --env-file. Use "dotenv" for the Docker Compose format, "export" for a shell script `+
+		`that exports the variables, "json" for a JSON object, or "yaml" for the env list of a Kubernetes container`)
+
 	flags.StringVarP(&args.mount, "mount", "", "true", ``+
 		`The absolute path for the root directory where volumes will be mounted, $TELEPRESENCE_ROOT. Use "true" to `+
 		`have Telepresence pick a random mount point (default). Use "false" to disable filesystem mounting entirely.`)
 
+	flags.BoolVar(&args.readOnly, "mount-readonly", false, ``+
+		`Mount the remote volumes read-only, so that the files in the intercepted pod can't be modified from this `+
+		`workstation`)
+
+	flags.StringSliceVar(&args.include, "mount-include", nil, ``+
+		`Glob pattern for paths, relative to the root of the remote volumes, that are exposed by the mount. `+
+		`All other paths are hidden. A "**" path element matches any number of directories. May be repeated`)
+
+	flags.StringSliceVar(&args.exclude, "mount-exclude", nil, ``+
+		`Glob pattern for paths, relative to the root of the remote volumes, that are hidden by the mount, e.g. `+
+		`"**/cache". A "**" path element matches any number of directories. May be repeated`)
+
 	flags.StringSliceVar(&args.toPod, "to-pod", []string{}, ``+
 		`An additional port to forward from the intercepted pod, will be made available at localhost:PORT `+
 		`Use this to, for example, access proxy/helper sidecars in the intercepted pod.`)
 
+	flags.StringVar(&args.record, "record", "", ``+
+		`Record the HTTP requests of the intercepted connections, and the responses of the local handler, by `+
+		`appending them as lines of JSON to this file. Use 'telepresence replay' to send the recorded requests `+
+		`to the local handler again`)
+
+	flags.Int64Var(&args.recordMaxBody, "record-max-body", recording.DefaultMaxBody, ``+
+		`The maximum number of bytes of each request and response body that --record records. Longer bodies `+
+		`are truncated`)
+
+	flags.BoolVarP(&args.recordSecrets, "record-secrets", "", false, ``+
+		`Record the values of headers that carry credentials, such as Authorization and Cookie. They are `+
+		`redacted by default`)
+
 	flags.BoolVarP(&args.dockerRun, "docker-run", "", false, ``+
 		`Run a Docker container with intercepted environment, volume mount, by passing arguments after -- to 'docker run', `+
 		`e.g. '--docker-run -- -it --rm ubuntu:20.04 /bin/bash'`)
@@ -155,7 +271,14 @@ func interceptCommand(ctx context.Context) *cobra.Command {
 	flags.StringVarP(&args.dockerMount, "docker-mount", "", "", ``+
 		`The volume mount point in docker. Defaults to same as "--mount"`)
 
+	flags.StringVar(&detailedOutput, "detailed-output", "", ``+
+		`Set to "json" to print the details of the intercept, such as its id, the matched headers, the preview URL, `+
+		`and the paths of the env files and the mount point, as a JSON document on stdout. All other output is `+
+		`written to stderr`)
+
 	flags.StringVarP(&args.namespace, "namespace", "n", "", "If present, the namespace scope for this CLI request")
+	_ = cmd.RegisterFlagCompletionFunc("namespace", completeMappedNamespaces)
+	_ = cmd.RegisterFlagCompletionFunc("workload", completeWorkloadFlag)
 
 	flags.StringVar(&args.ingressHost, "ingress-host", "", "If this flag is set, the ingress dialogue will be skipped,"+
 		" and this value will be used as the ingress hostname.")
@@ -173,6 +296,18 @@ func interceptCommand(ctx context.Context) *cobra.Command {
 		if extErr != nil {
 			return extErr
 		}
+		if specFile != "" {
+			if len(positional) > 0 {
+				return errcat.User.New("--file cannot be combined with an intercept name or a command")
+			}
+			if args.detailedOutput != nil {
+				return errcat.User.New("--detailed-output cannot be combined with --file")
+			}
+			return interceptFromSpecFile(cmd, specFile)
+		}
+		if len(positional) == 0 {
+			return errcat.User.New("an intercept name or the --file flag is required")
+		}
 		// arg-parsing
 		var err error
 		args.extRequiresLogin, err = args.extState.RequiresAPIKeyOrLicense()
@@ -190,24 +325,70 @@ func interceptCommand(ctx context.Context) *cobra.Command {
 			if args.serviceName != "" {
 				return errcat.User.New("a local-only intercept cannot have a service")
 			}
+			if args.container != "" {
+				return errcat.User.New("a local-only intercept cannot have a container")
+			}
+			if args.selector != "" {
+				return errcat.User.New("a local-only intercept cannot have a selector")
+			}
 			if cmd.Flag("port").Changed {
 				return errcat.User.New("a local-only intercept cannot have a port")
 			}
-			if cmd.Flag("mount").Changed {
+			if cmd.Flag("mount").Changed || args.readOnly || len(args.include) > 0 || len(args.exclude) > 0 {
 				return errcat.User.New("a local-only intercept cannot have mounts")
 			}
+			if args.encrypt {
+				return errcat.User.New("a local-only intercept cannot be encrypted")
+			}
+			if args.mirror {
+				return errcat.User.New("a local-only intercept cannot be mirrored")
+			}
+			if cmd.Flag("traffic-percentage").Changed {
+				return errcat.User.New("a local-only intercept cannot have a traffic percentage")
+			}
+			if args.idempotencyKey != "" {
+				return errcat.User.New("a local-only intercept cannot have an idempotency key")
+			}
+			if args.record != "" {
+				return errcat.User.New("a local-only intercept cannot be recorded")
+			}
+			if cmd.Flag("dependents").Changed {
+				return errcat.User.New("a local-only intercept cannot have dependents")
+			}
 			if cmd.Flag("preview-url").Changed && args.previewEnabled {
 				return errcat.User.New("a local-only intercept cannot be previewed")
 			}
+			if args.detailedOutput != nil {
+				return errcat.User.New("a local-only intercept has no details to output")
+			}
 		case false:
 			// Actually intercepting something
-			if args.agentName == "" {
+			if args.selector != "" {
+				if args.agentName != "" {
+					return errcat.User.New("--selector cannot be combined with --workload")
+				}
+				if _, err := labels.Parse(args.selector); err != nil {
+					return errcat.User.Newf("invalid --selector %q: %v", args.selector, err)
+				}
+			} else if args.agentName == "" {
 				args.agentName = args.name
 				if args.namespace != "" {
 					args.name += "-" + args.namespace
 				}
 			}
 		}
+		if args.previewEnabled && client.GetConfig(cmd.Context()).Cloud.Disabled {
+			return errcat.User.New("preview URLs require Ambassador Cloud, which is disabled by the cloud.disabled setting")
+		}
+		if err := validateDependentsFlag(args.dependents); err != nil {
+			return err
+		}
+		if err := validateEnvFormat(args.envFormat); err != nil {
+			return err
+		}
+		if cmd.Flag("env-format").Changed && args.envFile == "" {
+			return errcat.User.New("--env-format must be used together with --env-file")
+		}
 		args.mountSet = cmd.Flag("mount").Changed
 		if args.dockerRun {
 			if err := validateDockerArgs(args.cmdline); err != nil {
@@ -222,15 +403,33 @@ func interceptCommand(ctx context.Context) *cobra.Command {
 }
 
 func leaveCommand() *cobra.Command {
-	return &cobra.Command{
-		Use:  "leave [flags] <intercept_name>",
-		Args: cobra.ExactArgs(1),
+	var idempotencyKey string
+	var all bool
+	cmd := &cobra.Command{
+		Use:               "leave [flags] <intercept_name>",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeInterceptNames,
 
 		Short: "Remove existing intercept",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return removeIntercept(cmd.Context(), strings.TrimSpace(args[0]))
+			switch {
+			case all && len(args) == 0 && idempotencyKey == "":
+				return removeAllIntercepts(cmd)
+			case all:
+				return errcat.User.New("--all cannot be combined with an intercept name or the --idempotency-key flag")
+			case len(args) == 1 && idempotencyKey == "":
+				return removeIntercept(cmd.Context(), strings.TrimSpace(args[0]))
+			case len(args) == 0 && idempotencyKey != "":
+				return removeInterceptByIdempotencyKey(cmd.Context(), idempotencyKey)
+			default:
+				return errcat.User.New("leave requires either an intercept name, the --idempotency-key flag, or the --all flag")
+			}
 		},
 	}
+	cmd.Flags().StringVar(&idempotencyKey, "idempotency-key", "",
+		"Remove the intercept that was created with this idempotency key, even if its creation was interrupted")
+	cmd.Flags().BoolVar(&all, "all", false, "Remove all intercepts of the current session")
+	return cmd
 }
 
 func intercept(cmd *cobra.Command, args interceptArgs) error {
@@ -275,6 +474,9 @@ func newInterceptState(
 		managerClient:   managerClient,
 		connInfo:        cs.ConnectInfo,
 	}
+	if dd := docker.RunningDaemon(ctx); dd != nil {
+		is.daemonContainer = dd.Container
+	}
 	is.scout.Start(log.WithDiscardingLogger(ctx))
 	return is
 }
@@ -287,12 +489,16 @@ func interceptMessage(r *connector.InterceptResult) error {
 		return nil
 	case connector.InterceptError_NO_CONNECTION:
 		msg = "Local network is not connected to the cluster"
+		errCat = errcat.Daemon
 	case connector.InterceptError_NO_TRAFFIC_MANAGER:
 		msg = "Intercept unavailable: no traffic manager"
+		errCat = errcat.Cluster
 	case connector.InterceptError_TRAFFIC_MANAGER_CONNECTING:
 		msg = "Connecting to traffic manager..."
+		errCat = errcat.Cluster
 	case connector.InterceptError_TRAFFIC_MANAGER_ERROR:
 		msg = r.ErrorText
+		errCat = errcat.Cluster
 	case connector.InterceptError_ALREADY_EXISTS:
 		msg = fmt.Sprintf("Intercept with name %q already exists", r.ErrorText)
 	case connector.InterceptError_LOCAL_TARGET_IN_USE:
@@ -300,7 +506,7 @@ func interceptMessage(r *connector.InterceptResult) error {
 		msg = fmt.Sprintf("Port %s:%d is already in use by intercept %s",
 			spec.TargetHost, spec.TargetPort, spec.Name)
 	case connector.InterceptError_NO_ACCEPTABLE_WORKLOAD:
-		msg = fmt.Sprintf("No interceptable deployment, replicaset, or statefulset matching %s found", r.ErrorText)
+		msg = fmt.Sprintf("No interceptable deployment, replicaset, statefulset, rollout, job, or cronjob matching %s found", r.ErrorText)
 	case connector.InterceptError_AMBIGUOUS_MATCH:
 		var matches []manager.AgentInfo
 		err := json.Unmarshal([]byte(r.ErrorText), &matches)
@@ -330,8 +536,8 @@ func interceptMessage(r *connector.InterceptResult) error {
 	default:
 		msg = fmt.Sprintf("Unknown error code %d", r.Error)
 	}
-	if r.ErrorCategory > 0 {
-		errCat = errcat.Category(r.ErrorCategory)
+	if ec := errcat.Category(r.ErrorCategory); ec != errcat.OK && ec != errcat.Unknown {
+		errCat = ec
 	}
 
 	if id := r.GetInterceptInfo().GetId(); id != "" {
@@ -340,30 +546,15 @@ func interceptMessage(r *connector.InterceptResult) error {
 	return errCat.Newf(msg)
 }
 
-func checkMountCapability(ctx context.Context) error {
-	// Use CombinedOutput to include stderr which has information about whether they
-	// need to upgrade to a newer version of macFUSE or not
-	var cmd *dexec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = dexec.CommandContext(ctx, "sshfs-win", "cmd", "-V")
-	} else {
-		cmd = dexec.CommandContext(ctx, "sshfs", "-V")
-	}
-	cmd.DisableLogging = true
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return errors.New("sshfs is not installed on your local machine")
-	}
-
-	// OSXFUSE changed to macFUSE and we've noticed that older versions of OSXFUSE
-	// can cause browsers to hang + kernel crashes, so we add an error to prevent
-	// our users from running into this problem.
-	// OSXFUSE isn't included in the output of sshfs -V in versions of 4.0.0 so
-	// we check for that as a proxy for if they have the right version or not.
-	if bytes.Contains(out, []byte("OSXFUSE")) {
-		return errors.New(`macFUSE 4.0.5 or higher is required on your local machine`)
+// interceptMessage returns the error described by the given result. An ambiguous match of the --selector
+// gets a hint on how to resolve it.
+func (is *interceptState) interceptMessage(r *connector.InterceptResult) error {
+	err := interceptMessage(r)
+	if err != nil && r.Error == connector.InterceptError_AMBIGUOUS_MATCH && is.args.selector != "" {
+		err = errcat.User.Newf("%v\nThe selector %q matches the pods of more than one workload. "+
+			"Use a more specific --selector, or name the workload using --workload", err, is.args.selector)
 	}
-	return nil
+	return err
 }
 
 func (is *interceptState) createRequest(ctx context.Context) (*connector.CreateInterceptRequest, error) {
@@ -373,16 +564,32 @@ func (is *interceptState) createRequest(ctx context.Context) (*connector.CreateI
 	}
 	ir := &connector.CreateInterceptRequest{Spec: spec}
 
-	if is.args.agentName == "" {
+	if is.args.agentName == "" && is.args.selector == "" {
 		// local-only
 		return ir, nil
 	}
+	ir.Encrypt = is.args.encrypt
+	spec.Mirror = is.args.mirror
+	switch p := is.args.percentage; {
+	case p < 1 || p > 100:
+		return nil, errcat.User.New("--traffic-percentage must be between 1 and 100")
+	case p < 100:
+		// 100 is left unset, so that traffic-agents that don't know about percentages can serve the intercept
+		spec.TrafficPercentage = p
+	}
+	ir.IdempotencyKey = is.args.idempotencyKey
+	if ir.IdempotencyKey == "" {
+		// Makes the connector's own retries safe
+		ir.IdempotencyKey = uuid.New().String()
+	}
 
 	if is.args.serviceName != "" {
 		spec.ServiceName = is.args.serviceName
 	}
 
 	spec.Agent = is.args.agentName
+	ir.WorkloadSelector = is.args.selector
+	ir.ContainerName = is.args.container
 	spec.TargetHost = "127.0.0.1"
 
 	// Parse port into spec based on how it's formatted
@@ -433,9 +640,19 @@ func (is *interceptState) createRequest(ctx context.Context) (*connector.CreateI
 	if is.args.dockerRun && is.dockerPort == 0 {
 		is.dockerPort = is.localPort
 	}
+	if is.args.dockerRun && is.daemonContainer != "" && is.dockerPort != is.localPort {
+		// There's no port mapping between containers that share a network
+		return nil, errcat.User.New("the local port and the container port must be equal when the daemons run in a container")
+	}
 
 	doMount := false
-	err = checkMountCapability(ctx)
+	var transport string
+	if is.daemonContainer != "" {
+		// The remote volumes would be mounted in the daemon container, where nothing can use them.
+		err = errors.New("the daemons run in a container")
+	} else {
+		transport, err = remotefs.SelectTransport(ctx)
+	}
 	if err == nil {
 		if ir.MountPoint, doMount, err = is.getMountPoint(); err != nil {
 			return nil, err
@@ -457,6 +674,47 @@ func (is *interceptState) createRequest(ctx context.Context) (*connector.CreateI
 		spec.ExtraPorts = append(spec.ExtraPorts, int32(port))
 	}
 
+	if is.args.readOnly {
+		if !doMount {
+			return nil, errcat.User.New("--mount-readonly cannot be used with --mount=false")
+		}
+		ir.MountReadOnly = true
+	}
+	if len(is.args.include) > 0 || len(is.args.exclude) > 0 {
+		if !doMount {
+			return nil, errcat.User.New("--mount-include and --mount-exclude cannot be used with --mount=false")
+		}
+		if transport == remotefs.TransportWebDAV {
+			return nil, errcat.User.New("--mount-include and --mount-exclude require sshfs")
+		}
+		if err = sftpfilter.ValidatePatterns(is.args.include); err != nil {
+			return nil, errcat.User.Newf("invalid --mount-include pattern: %w", err)
+		}
+		if err = sftpfilter.ValidatePatterns(is.args.exclude); err != nil {
+			return nil, errcat.User.Newf("invalid --mount-exclude pattern: %w", err)
+		}
+		ir.MountInclude = is.args.include
+		ir.MountExclude = is.args.exclude
+	}
+
+	if is.args.recordSecrets && is.args.record == "" {
+		return nil, errcat.User.New("--record-secrets requires --record")
+	}
+	if is.args.record != "" {
+		if is.daemonContainer != "" {
+			return nil, errcat.User.New("--record cannot be used when the daemons run in a container")
+		}
+		if is.args.recordMaxBody < 0 {
+			return nil, errcat.User.New("--record-max-body cannot be negative")
+		}
+		// The file is written by the user daemon, which has a working directory of its own
+		if ir.RecordFile, err = filepath.Abs(is.args.record); err != nil {
+			return nil, errcat.User.New(err)
+		}
+		ir.RecordMaxBody = is.args.recordMaxBody
+		ir.RecordSecrets = is.args.recordSecrets
+	}
+
 	if is.args.dockerMount != "" {
 		if !is.args.dockerRun {
 			return nil, errcat.User.New("--docker-mount must be used together with --docker-run")
@@ -531,7 +789,7 @@ func (is *interceptState) canInterceptAndLogIn(ctx context.Context, ir *connecto
 		return fmt.Errorf("connector.CanIntercept: %w", err)
 	}
 	if r.Error != connector.InterceptError_UNSPECIFIED {
-		return interceptMessage(r)
+		return is.interceptMessage(r)
 	}
 	if needLogin {
 		// We default to assuming they can connect to Ambassador Cloud
@@ -590,7 +848,7 @@ func (is *interceptState) EnsureState(ctx context.Context) (acquired bool, err e
 	}
 
 	args := &is.args
-	needLogin := !client.GetConfig(ctx).Cloud.SkipLogin && (args.previewEnabled || args.extRequiresLogin)
+	needLogin := !client.GetConfig(ctx).Cloud.NoLogin() && (args.previewEnabled || args.extRequiresLogin)
 
 	// if any of the ingress flags are present, skip the ingress dialogue and use flag values
 	if args.previewEnabled {
@@ -635,7 +893,7 @@ func (is *interceptState) EnsureState(ctx context.Context) (acquired bool, err e
 	}()
 
 	// Submit the request
-	r, err := is.connectorClient.CreateIntercept(ctx, ir)
+	r, err := createInterceptWithProgress(ctx, is.connectorClient, is.cmd.OutOrStdout(), ir)
 	if err != nil {
 		return false, fmt.Errorf("connector.CreateIntercept: %w", err)
 	}
@@ -645,12 +903,16 @@ func (is *interceptState) EnsureState(ctx context.Context) (acquired bool, err e
 			_ = is.DeactivateState(ctx)
 			return false, is.cmd.FlagError(errcat.User.New(r.InterceptInfo.Message))
 		}
-		return false, interceptMessage(r)
+		return false, is.interceptMessage(r)
 	}
 
 	if args.agentName == "" {
-		// local-only
-		return true, nil
+		if args.selector == "" {
+			// local-only
+			return true, nil
+		}
+		// The connector has resolved the selector to a workload
+		args.agentName = r.GetInterceptInfo().GetSpec().GetAgent()
 	}
 	fmt.Fprintf(is.cmd.OutOrStdout(), "Using %s %s\n", r.WorkloadKind, args.agentName)
 	var intercept *manager.InterceptInfo
@@ -699,13 +961,27 @@ func (is *interceptState) EnsureState(ctx context.Context) (acquired bool, err e
 	var volumeMountProblem error
 	doMount, err := strconv.ParseBool(args.mount)
 	if doMount || err != nil {
-		volumeMountProblem = checkMountCapability(ctx)
+		_, volumeMountProblem = remotefs.SelectTransport(ctx)
+	}
+	if args.detailedOutput != nil {
+		if err = writeJSON(args.detailedOutput, newInterceptDetails(intercept, args, volumeMountProblem)); err != nil {
+			return true, err
+		}
+	} else {
+		fmt.Fprintln(is.cmd.OutOrStdout(), DescribeIntercept(intercept, volumeMountProblem, false))
+	}
+	if depErr := is.handleDependents(ctx, ir); depErr != nil {
+		fmt.Fprintf(is.cmd.ErrOrStderr(), "Unable to resolve the dependents of %s: %v\n", args.agentName, depErr)
 	}
-	fmt.Fprintln(is.cmd.OutOrStdout(), DescribeIntercept(intercept, volumeMountProblem, false))
 	return true, nil
 }
 
 func (is *interceptState) DeactivateState(ctx context.Context) error {
+	for _, name := range is.dependentIntercepts {
+		if err := removeIntercept(ctx, name); err != nil {
+			fmt.Fprintf(is.cmd.ErrOrStderr(), "Unable to remove intercept %s: %v\n", name, err)
+		}
+	}
 	return removeIntercept(ctx, strings.TrimSpace(is.args.name))
 }
 
@@ -724,6 +1000,41 @@ func removeIntercept(ctx context.Context, name string) error {
 	})
 }
 
+func removeInterceptByIdempotencyKey(ctx context.Context, key string) error {
+	return cliutil.WithStartedConnector(ctx, true, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
+		r, err := connectorClient.RemoveIntercept(dcontext.WithoutCancel(ctx), &manager.RemoveInterceptRequest2{IdempotencyKey: key})
+		if err != nil {
+			return err
+		}
+		switch r.Error {
+		case connector.InterceptError_UNSPECIFIED:
+			return nil
+		case connector.InterceptError_NOT_FOUND:
+			return errcat.User.Newf("Intercept with idempotency key %q not found", key)
+		default:
+			return interceptMessage(r)
+		}
+	})
+}
+
+func removeAllIntercepts(cmd *cobra.Command) error {
+	return cliutil.WithStartedConnector(cmd.Context(), true, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
+		r, err := connectorClient.RemoveAllIntercepts(dcontext.WithoutCancel(ctx), &empty.Empty{})
+		if err != nil {
+			return err
+		}
+		stdout := cmd.OutOrStdout()
+		if len(r.Names) == 0 {
+			fmt.Fprintln(stdout, "No intercepts to remove")
+			return nil
+		}
+		for _, name := range r.Names {
+			fmt.Fprintf(stdout, "Removed intercept %s\n", name)
+		}
+		return nil
+	})
+}
+
 func validateDockerArgs(args []string) error {
 	for _, arg := range args {
 		if arg == "-d" || arg == "--detach" {
@@ -734,51 +1045,114 @@ func validateDockerArgs(args []string) error {
 }
 
 func (is *interceptState) runInDocker(ctx context.Context, cmd safeCobraCommand, args []string) error {
-	envFile := is.args.envFile
-	if envFile == "" {
-		file, err := os.CreateTemp("", "tel-*.env")
-		if err != nil {
-			return errcat.NoLogs.Newf("failed to create temporary environment file. %w", err)
+	dockerMount := ""
+	if is.mountPoint != "" { // do we have a mount point at all?
+		if dockerMount = is.args.dockerMount; dockerMount == "" {
+			dockerMount = is.mountPoint
 		}
-		defer os.Remove(file.Name())
+	}
 
-		if err = is.writeEnvToFileAndClose(file); err != nil {
-			return err
+	// The container sees the remote volumes at the docker mount point
+	env := is.env
+	if dockerMount != "" {
+		env = make(map[string]string, len(is.env))
+		for k, v := range is.env {
+			env[k] = v
 		}
-		envFile = file.Name()
+		env["TELEPRESENCE_ROOT"] = dockerMount
+	}
+	file, err := os.CreateTemp("", "tel-*.env")
+	if err != nil {
+		return errcat.NoLogs.Newf("failed to create temporary environment file. %w", err)
+	}
+	defer os.Remove(file.Name())
+	if err = writeEnvToFileAndClose(file, env, envFormatDotenv); err != nil {
+		return err
 	}
 
-	ourArgs := []string{
-		"run",
-		"--dns-search", "tel2-search",
-		"--env-file", envFile,
+	// Docker on Linux doesn't use the DNS resolver of the host, so the container is told to use the
+	// cluster's DNS IP, which the root daemon intercepts.
+	var dnsIP net.IP
+	if runtime.GOOS == "linux" && is.daemonContainer == "" && !hasDockerArg(args, "--dns") {
+		dnsIP = clusterDNSIP(ctx)
 	}
-	hasArg := func(s string) bool {
-		for _, arg := range args {
-			if s == arg {
-				return true
-			}
-		}
-		return false
+	return proc.Run(ctx, nil, "docker", is.dockerRunArgs(file.Name(), dockerMount, dnsIP, args)...)
+}
+
+// dockerRunArgs returns the arguments for "docker run" that connect the container with the intercept, followed
+// by the given arguments.
+func (is *interceptState) dockerRunArgs(envFile, dockerMount string, dnsIP net.IP, args []string) []string {
+	ourArgs := []string{"run"}
+	if is.daemonContainer != "" {
+		// The container joins the network of the daemon container, which has the DNS configuration of
+		// the cluster and receives the intercepted traffic on the local port.
+		ourArgs = append(ourArgs, "--network", "container:"+is.daemonContainer)
+	} else {
+		ourArgs = append(ourArgs, "--dns-search", "tel2-search")
 	}
-	if !hasArg("--name") {
+	ourArgs = append(ourArgs, "--env-file", envFile)
+	if dnsIP != nil {
+		ourArgs = append(ourArgs, "--dns", dnsIP.String())
+	}
+	if !hasDockerArg(args, "--name") {
 		ourArgs = append(ourArgs, "--name", fmt.Sprintf("intercept-%s-%d", is.args.name, is.localPort))
 	}
 
-	if is.dockerPort != 0 {
+	if is.dockerPort != 0 && is.daemonContainer == "" {
 		ourArgs = append(ourArgs, "-p", fmt.Sprintf("%d:%d", is.localPort, is.dockerPort))
 	}
 
-	dockerMount := ""
-	if is.mountPoint != "" { // do we have a mount point at all?
-		if dockerMount = is.args.dockerMount; dockerMount == "" {
-			dockerMount = is.mountPoint
+	if dockerMount != "" {
+		volume := fmt.Sprintf("%s:%s", is.mountPoint, dockerMount)
+		if is.args.readOnly {
+			volume += ":ro"
+		}
+		ourArgs = append(ourArgs, "-v", volume)
+
+		// Each remote volume is also mounted where the intercepted container has it, so that the
+		// application finds its secrets and configuration at the same paths as in the cluster.
+		for _, vol := range strings.Split(is.env["TELEPRESENCE_MOUNTS"], ":") {
+			if vol == "" || vol == dockerMount {
+				continue
+			}
+			mount := fmt.Sprintf("type=bind,source=%s,target=%s", filepath.Join(is.mountPoint, filepath.FromSlash(vol)), vol)
+			if is.args.readOnly {
+				mount += ",readonly"
+			}
+			ourArgs = append(ourArgs, "--mount", mount)
 		}
 	}
-	if dockerMount != "" {
-		ourArgs = append(ourArgs, "-v", fmt.Sprintf("%s:%s", is.mountPoint, dockerMount))
+	return append(ourArgs, args...)
+}
+
+// hasDockerArg returns true if the given docker flag is present in args, either alone or in the form
+// <flag>=<value>.
+func hasDockerArg(args []string, flag string) bool {
+	for _, arg := range args {
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			return true
+		}
 	}
-	return proc.Run(ctx, nil, "docker", append(ourArgs, args...)...)
+	return false
+}
+
+// clusterDNSIP returns the IP of the cluster's DNS service as known by the root daemon, or nil when it's
+// unknown.
+func clusterDNSIP(ctx context.Context) (ip net.IP) {
+	err := cliutil.WithStartedNetwork(ctx, func(ctx context.Context, daemonClient daemon.DaemonClient) error {
+		status, err := daemonClient.Status(ctx, &empty.Empty{})
+		if err != nil {
+			return err
+		}
+		if rip := status.GetOutboundConfig().GetDns().GetRemoteIp(); len(rip) > 0 {
+			ip = rip
+		}
+		return nil
+	})
+	if err != nil {
+		dlog.Debugf(ctx, "unable to get the cluster DNS IP: %v", err)
+	}
+	return ip
 }
 
 func (is *interceptState) writeEnvFile() error {
@@ -786,45 +1160,20 @@ func (is *interceptState) writeEnvFile() error {
 	if err != nil {
 		return errcat.NoLogs.Newf("failed to create environment file %q: %w", is.args.envFile, err)
 	}
-	return is.writeEnvToFileAndClose(file)
+	return writeEnvToFileAndClose(file, is.env, is.args.envFormat)
 }
 
-func (is *interceptState) writeEnvToFileAndClose(file *os.File) (err error) {
+func writeEnvToFileAndClose(file *os.File, env map[string]string, format string) error {
 	defer file.Close()
-	w := bufio.NewWriter(file)
-
-	keys := make([]string, len(is.env))
-	i := 0
-	for k := range is.env {
-		keys[i] = k
-		i++
-	}
-	sort.Strings(keys)
-
-	for _, k := range keys {
-		if _, err = w.WriteString(k); err != nil {
-			return err
-		}
-		if err = w.WriteByte('='); err != nil {
-			return err
-		}
-		if _, err = w.WriteString(is.env[k]); err != nil {
-			return err
-		}
-		if err = w.WriteByte('\n'); err != nil {
-			return err
-		}
-	}
-	return w.Flush()
+	return writeEnv(file, env, format)
 }
 
 func (is *interceptState) writeEnvJSON() error {
-	data, err := json.MarshalIndent(is.env, "", "  ")
+	file, err := os.Create(is.args.envJSON)
 	if err != nil {
-		// Creating JSON from a map[string]string should never fail
-		panic(err)
+		return errcat.NoLogs.Newf("failed to create environment file %q: %w", is.args.envJSON, err)
 	}
-	return os.WriteFile(is.args.envJSON, data, 0644)
+	return writeEnvToFileAndClose(file, is.env, envFormatJSON)
 }
 
 var hostRx = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9\-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9\-]*[a-zA-Z0-9])?)*$`)
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_dockerRunArgs(t *testing.T) {
+	is := &interceptState{
+		args:       interceptArgs{name: "echo"},
+		env:        map[string]string{"TELEPRESENCE_MOUNTS": "/var/run/secrets/kubernetes.io:/etc/config"},
+		mountPoint: "/tmp/telfs-1",
+		localPort:  8080,
+		dockerPort: 80,
+	}
+	assert.Equal(t, []string{
+		"run",
+		"--dns-search", "tel2-search",
+		"--env-file", "/tmp/tel.env",
+		"--dns", "10.96.0.10",
+		"--name", "intercept-echo-8080",
+		"-p", "8080:80",
+		"-v", "/tmp/telfs-1:/tel",
+		"--mount", "type=bind,source=" + filepath.Join("/tmp/telfs-1", "var", "run", "secrets", "kubernetes.io") + ",target=/var/run/secrets/kubernetes.io",
+		"--mount", "type=bind,source=" + filepath.Join("/tmp/telfs-1", "etc", "config") + ",target=/etc/config",
+		"-it", "echo:latest",
+	}, is.dockerRunArgs("/tmp/tel.env", "/tel", net.IP{10, 96, 0, 10}, []string{"-it", "echo:latest"}))
+
+	// Read-only mounts, a given name, and no DNS IP and mounts
+	is.args.readOnly = true
+	is.env = nil
+	assert.Equal(t, []string{
+		"run",
+		"--dns-search", "tel2-search",
+		"--env-file", "/tmp/tel.env",
+		"-p", "8080:80",
+		"-v", "/tmp/telfs-1:/tel:ro",
+		"--name=mine", "echo:latest",
+	}, is.dockerRunArgs("/tmp/tel.env", "/tel", nil, []string{"--name=mine", "echo:latest"}))
+
+	// The daemons run in a container, so the network of that container is used and no port is published
+	is.daemonContainer = "telepresence-daemons"
+	assert.Equal(t, []string{
+		"run",
+		"--network", "container:telepresence-daemons",
+		"--env-file", "/tmp/tel.env",
+		"-v", "/tmp/telfs-1:/tel:ro",
+		"--name=mine", "echo:latest",
+	}, is.dockerRunArgs("/tmp/tel.env", "/tel", nil, []string{"--name=mine", "echo:latest"}))
+}
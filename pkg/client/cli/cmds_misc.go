@@ -1,21 +1,32 @@
 package cli
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"runtime"
+	"strings"
 
 	"github.com/pkg/browser"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	empty "google.golang.org/protobuf/types/known/emptypb"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/telepresenceio/telepresence/rpc/v2/connector"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/docker"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/netns"
+	"github.com/telepresenceio/telepresence/v2/pkg/install/helm"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
-	"github.com/telepresenceio/telepresence/v2/pkg/proc"
 )
 
 // ClusterIdCommand is a simple command that makes it easier for users to
@@ -52,12 +63,22 @@ func ClusterIdCommand() *cobra.Command {
 	return cmd
 }
 
+const defaultProxyAddress = "127.0.0.1:1080"
+
 func connectCommand() *cobra.Command {
 	var dnsIP string
 	var mappedNamespaces []string
+	var proxyOnly bool
+	var proxyAddress string
+	var systemProxy bool
+	var processRouting bool
+	var netNamespace bool
+	var suffixNamespaces map[string]string
+	var inDocker bool
+	managerValues := &helm.Request{}
 
 	kubeFlags := pflag.NewFlagSet("Kubernetes flags", 0)
-	cmd := &cobra.Command{
+	cmd := withJSONOutput(&cobra.Command{
 		Use:   "connect [flags] [-- <command to run while connected>]",
 		Args:  cobra.ArbitraryArgs,
 		Short: "Connect to a cluster",
@@ -65,19 +86,88 @@ func connectCommand() *cobra.Command {
 			request := &connector.ConnectRequest{
 				KubeFlags:        kubeFlagMap(kubeFlags),
 				MappedNamespaces: mappedNamespaces,
+				SuffixNamespaces: suffixNamespaces,
+			}
+			for sfx, ns := range suffixNamespaces {
+				if client.NormalizeDNSSuffix(sfx) == "" || ns == "" {
+					return errcat.User.Newf("invalid --dns-suffix-namespace %q, must be in the form SUFFIX=NAMESPACE", sfx+"="+ns)
+				}
+			}
+			if err := readKubeconfigData(cmd, request); err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("manager-values") || cmd.Flags().Changed("manager-set") {
+				var err error
+				if request.ManagerValues, err = managerValuesJSON(managerValues); err != nil {
+					return err
+				}
+			}
+			if proxyOnly {
+				request.ProxyAddress = proxyAddress
+				request.SystemProxy = systemProxy
+			} else if cmd.Flags().Changed("proxy-address") {
+				return errcat.User.New("--proxy-address can only be used together with --proxy-only")
+			} else if systemProxy {
+				return errcat.User.New("--system-proxy can only be used together with --proxy-only")
+			}
+			if processRouting {
+				if proxyOnly || inDocker {
+					return errcat.User.New("--process-routing cannot be used together with --proxy-only or --docker")
+				}
+				if err := client.CheckProcessRouting(); err != nil {
+					return err
+				}
+				request.ProcessRouting = true
+			}
+			if netNamespace {
+				if !proxyOnly {
+					return errcat.User.New("--network-namespace can only be used together with --proxy-only")
+				}
+				if len(args) == 0 {
+					return errcat.User.New("--network-namespace requires a command")
+				}
+			}
+			if inDocker {
+				if proxyOnly {
+					return errcat.User.New("--docker cannot be used together with --proxy-only")
+				}
+				if len(args) > 0 {
+					return errcat.User.New("--docker cannot be used together with a command")
+				}
+				if len(request.KubeconfigData) > 0 {
+					return errcat.User.Newf("--docker cannot be used together with a kubeconfig from stdin or %s", kubeconfigDataEnv)
+				}
+				if err := startDockerDaemon(cmd, request.KubeFlags); err != nil {
+					return err
+				}
 			}
 
+			if len(args) == 0 && cmd.Flags().Changed("mapped-namespaces") {
+				// An existing session gets its mapped namespaces updated without disconnecting
+				if updated, err := updateMappedNamespaces(cmd, mappedNamespaces); updated || err != nil {
+					return err
+				}
+			}
 			if len(args) == 0 {
-				return withConnector(cmd, true, request, func(_ context.Context, _ *connectorState) error {
-					return nil
+				return withConnector(cmd, true, request, func(_ context.Context, cs *connectorState) error {
+					return printResult(cmd, newConnectInfoJSON(cs.ConnectInfo), func(io.Writer) {})
 				})
 			}
+			if outputFormat(cmd) == outputFormatJSON {
+				return errcat.User.New("--output json cannot be used together with a command")
+			}
 
-			return withConnector(cmd, false, request, func(ctx context.Context, _ *connectorState) error {
-				return proc.Run(ctx, nil, args[0], args[1:]...)
+			return withConnector(cmd, false, request, func(ctx context.Context, cs *connectorState) error {
+				if netNamespace {
+					if cs.ProxyAddress == "" {
+						return errcat.User.New("--network-namespace requires a proxy-only session, but the current session isn't")
+					}
+					return netns.Run(ctx, cs.ProxyAddress, args[0], args[1:]...)
+				}
+				return runThroughSession(ctx, cs, args)
 			})
 		},
-	}
+	})
 
 	flags := cmd.Flags()
 
@@ -93,16 +183,204 @@ func connectCommand() *cobra.Command {
 	nwFlags.StringSliceVar(&mappedNamespaces,
 		"mapped-namespaces", nil, ``+
 			`Comma separated list of namespaces considered by DNS resolver and NAT for outbound connections. `+
-			`Defaults to all namespaces`)
+			`Defaults to all namespaces. When already connected, the mapped namespaces of the session are replaced `+
+			`without disconnecting; use "all" to map all namespaces again`)
+	nwFlags.StringToStringVar(&suffixNamespaces,
+		"dns-suffix-namespace", nil, ``+
+			`Comma separated list of SUFFIX=NAMESPACE mappings that make the DNS resolver resolve names like `+
+			`<service>.SUFFIX as <service>.NAMESPACE in the cluster. Adds to the dns.suffixNamespaces in config.yml`)
+	nwFlags.BoolVar(&proxyOnly,
+		"proxy-only", false, ``+
+			`Don't start the root daemon or create a TUN device. Instead, serve a SOCKS5 and HTTP CONNECT proxy `+
+			`that tunnels connections to the cluster. Doesn't require admin privileges. A command given after "--" `+
+			`will have its proxy environment variables set to use that proxy. Only programs that use the proxy, `+
+			`or that run with --network-namespace, can reach the cluster`)
+	nwFlags.StringVar(&proxyAddress,
+		"proxy-address", defaultProxyAddress, `The address that the proxy listens to when using --proxy-only`)
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		nwFlags.BoolVar(&systemProxy,
+			"system-proxy", false, ``+
+				`Configure the system proxy with a proxy auto-config file that directs requests for the cluster's `+
+				`subnets and domains to the proxy when using --proxy-only. The previous setting is restored on quit`)
+	}
+	if runtime.GOOS == "linux" {
+		nwFlags.BoolVar(&processRouting,
+			"process-routing", false, ``+
+				`Only route the traffic of commands started with "telepresence run", and of the command given `+
+				`after "--", through the cluster. The traffic of all other processes is left alone`)
+		nwFlags.BoolVar(&netNamespace,
+			"network-namespace", false, ``+
+				`Run the command given after "--" in an unprivileged network namespace where a user-space TCP/IP `+
+				`stack sends all its connections and DNS queries through the proxy when using --proxy-only, so `+
+				`that programs that don't use a proxy can reach the cluster. Doesn't require admin privileges`)
+	}
+	nwFlags.BoolVar(&inDocker,
+		"docker", false, ``+
+			`Run the daemons in a container and leave the network of this host untouched. Containers started `+
+			`with "intercept --docker-run", or with "docker run --network container:`+docker.ContainerName+`", `+
+			`can access the cluster`)
 	flags.AddFlagSet(nwFlags)
 
+	mgrFlags := pflag.NewFlagSet("Traffic Manager flags", 0)
+	mgrFlags.StringArrayVar(&managerValues.ValuesFiles,
+		"manager-values", nil, ``+
+			`Install a missing traffic-manager using the Helm values in this YAML file (can specify multiple). `+
+			`Ignored when the traffic-manager is already installed`)
+	mgrFlags.StringArrayVar(&managerValues.Values,
+		"manager-set", nil, ``+
+			`Install a missing traffic-manager using this Helm value, e.g. --manager-set key1=val1,key2=val2 `+
+			`(can specify multiple). Ignored when the traffic-manager is already installed`)
+	flags.AddFlagSet(mgrFlags)
+
 	kubeConfig := genericclioptions.NewConfigFlags(false)
 	kubeConfig.Namespace = nil // "connect", don't take --namespace
 	kubeConfig.AddFlags(kubeFlags)
+	kubeFlags.Lookup("kubeconfig").Usage += `. Use "-" to read the kubeconfig from stdin`
 	flags.AddFlagSet(kubeFlags)
 	return cmd
 }
 
+// kubeconfigDataEnv is the environment variable that can hold a base64 encoded kubeconfig for the connect.
+const kubeconfigDataEnv = "KUBECONFIG_DATA"
+
+// readKubeconfigData reads the kubeconfig from stdin when "--kubeconfig -" is used, or from the KUBECONFIG_DATA
+// environment variable when no --kubeconfig is given, and passes it in the request so that it never has to be
+// written to disk.
+func readKubeconfigData(cmd *cobra.Command, request *connector.ConnectRequest) error {
+	var data []byte
+	switch kubeconfig := request.KubeFlags["kubeconfig"]; kubeconfig {
+	case "-":
+		var err error
+		if data, err = io.ReadAll(cmd.InOrStdin()); err != nil {
+			return errcat.User.Newf("unable to read the kubeconfig from stdin: %w", err)
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			return errcat.User.New("the kubeconfig read from stdin is empty")
+		}
+		delete(request.KubeFlags, "kubeconfig")
+	case "":
+		enc := strings.TrimSpace(os.Getenv(kubeconfigDataEnv))
+		if enc == "" {
+			return nil
+		}
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(enc); err != nil {
+			return errcat.Config.Newf("%s must contain a base64 encoded kubeconfig: %w", kubeconfigDataEnv, err)
+		}
+	default:
+		return nil
+	}
+	request.KubeconfigData = data
+	return nil
+}
+
+// connectInfoJSON is the document that "telepresence connect --output json" prints.
+type connectInfoJSON struct {
+	ClusterContext      string   `json:"clusterContext"`
+	ClusterServer       string   `json:"clusterServer"`
+	ClusterID           string   `json:"clusterId,omitempty"`
+	ManagerNamespace    string   `json:"managerNamespace,omitempty"`
+	ManagerVersion      string   `json:"managerVersion,omitempty"`
+	MappedNamespaces    []string `json:"mappedNamespaces,omitempty"`
+	ProxyAddress        string   `json:"proxyAddress,omitempty"`
+	PortForwardFallback string   `json:"portForwardFallback,omitempty"`
+	Warnings            []string `json:"warnings,omitempty"`
+}
+
+func newConnectInfoJSON(ci *connector.ConnectInfo) *connectInfoJSON {
+	cj := &connectInfoJSON{
+		ClusterContext:      ci.ClusterContext,
+		ClusterServer:       ci.ClusterServer,
+		ClusterID:           ci.ClusterId,
+		ManagerNamespace:    ci.ManagerNamespace,
+		ManagerVersion:      ci.ManagerVersion,
+		MappedNamespaces:    ci.MappedNamespaces,
+		ProxyAddress:        ci.ProxyAddress,
+		PortForwardFallback: ci.PortForwardFallback,
+	}
+	cj.Warnings = append(cj.Warnings, ci.VersionSkew...)
+	cj.Warnings = append(cj.Warnings, ci.ConfigDrift...)
+	cj.Warnings = append(cj.Warnings, ci.SubnetConflicts...)
+	cj.Warnings = append(cj.Warnings, ci.ProxyHostWarnings...)
+	return cj
+}
+
+// managerValuesJSON merges the values of the given request into a JSON object. The values are merged by the
+// CLI, because the connector might not have access to the values files.
+func managerValuesJSON(req *helm.Request) ([]byte, error) {
+	vals, err := req.UserValues()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(vals)
+}
+
+// startDockerDaemon starts the daemon container unless it's already running. The daemons can't run in a
+// container while a connector runs on this host.
+func startDockerDaemon(cmd *cobra.Command, kubeFlags map[string]string) error {
+	ctx := cmd.Context()
+	if running, err := client.SocketExists(client.ConnectorSocketName); err != nil || running {
+		if err == nil {
+			err = errcat.User.New(`the Telepresence daemons are already running on this host, use "telepresence quit" before connecting with --docker`)
+		}
+		return err
+	}
+	return client.WithStartLock(ctx, "docker", func() error {
+		_, err := docker.Start(ctx, kubeFlags, cmd.OutOrStdout())
+		return err
+	})
+}
+
+// updateMappedNamespaces replaces the mapped namespaces of the current session, if there is one, and
+// reports the result. It returns false when there's no session to update.
+func updateMappedNamespaces(cmd *cobra.Command, namespaces []string) (bool, error) {
+	updated := false
+	err := cliutil.WithStartedConnector(cmd.Context(), false, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
+		ci, err := connectorClient.Status(ctx, &empty.Empty{})
+		if err != nil || ci.Error != connector.ConnectInfo_ALREADY_CONNECTED {
+			return err
+		}
+		r, err := connectorClient.SetMappedNamespaces(ctx, &connector.SetMappedNamespacesRequest{Namespaces: namespaces})
+		if err != nil {
+			return err
+		}
+		updated = true
+		stdout := cmd.OutOrStdout()
+		if r.Changed {
+			fmt.Fprintf(stdout, "Mapped namespaces updated to %s\n", strings.Join(r.Namespaces, ", "))
+		} else {
+			fmt.Fprintf(stdout, "Mapped namespaces unchanged: %s\n", strings.Join(r.Namespaces, ", "))
+		}
+		if len(r.Unavailable) > 0 {
+			fmt.Fprintf(stdout, "Warning: namespaces %s don't exist or aren't accessible\n", strings.Join(r.Unavailable, ", "))
+		}
+		return nil
+	})
+	if errors.Is(err, cliutil.ErrNoUserDaemon) {
+		err = nil
+	}
+	return updated, err
+}
+
+// proxyEnv returns the environment variables that make most HTTP clients and SOCKS aware tools
+// use the proxy at the given address. Host names are resolved by the proxy so that cluster names
+// can be used without a cluster DNS.
+func proxyEnv(proxyAddress string) map[string]string {
+	socksURL := "socks5h://" + proxyAddress
+	httpURL := "http://" + proxyAddress
+	env := make(map[string]string, 8)
+	for _, v := range []string{"ALL_PROXY", "all_proxy"} {
+		env[v] = socksURL
+	}
+	for _, v := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+		env[v] = httpURL
+	}
+	for _, v := range []string{"NO_PROXY", "no_proxy"} {
+		env[v] = "localhost,127.0.0.1,::1"
+	}
+	return env
+}
+
 func dashboardCommand() *cobra.Command {
 	return &cobra.Command{
 		Use:  "dashboard",
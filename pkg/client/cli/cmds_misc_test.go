@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/v2/pkg/install/helm"
+)
+
+func Test_proxyEnv(t *testing.T) {
+	env := proxyEnv("127.0.0.1:1080")
+	assert.Equal(t, "socks5h://127.0.0.1:1080", env["ALL_PROXY"])
+	assert.Equal(t, "http://127.0.0.1:1080", env["HTTP_PROXY"])
+	assert.Equal(t, "http://127.0.0.1:1080", env["https_proxy"])
+	assert.Contains(t, env["NO_PROXY"], "localhost")
+}
+
+func Test_managerValuesJSON(t *testing.T) {
+	valuesFile := filepath.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFile, []byte("nodeSelector:\n  disk: ssd\nimage:\n  tag: 2.4.0\n"), 0o600))
+
+	data, err := managerValuesJSON(&helm.Request{
+		ValuesFiles: []string{valuesFile},
+		Values:      []string{"image.tag=2.5.0", "resources.limits.cpu=1"},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "nodeSelector": {"disk": "ssd"},
+  "image": {"tag": "2.5.0"},
+  "resources": {"limits": {"cpu": 1}}
+}`, string(data))
+
+	_, err = managerValuesJSON(&helm.Request{ValuesFiles: []string{filepath.Join(t.TempDir(), "missing.yaml")}})
+	assert.Error(t, err)
+}
+
+func Test_newConnectInfoJSON(t *testing.T) {
+	cj := newConnectInfoJSON(&connector.ConnectInfo{
+		ClusterContext:  "default",
+		ClusterServer:   "https://127.0.0.1:6443",
+		ClusterId:       "8e2b7d8a",
+		ManagerVersion:  "v2.5.0",
+		VersionSkew:     []string{"the traffic-manager is older than the client"},
+		SubnetConflicts: []string{"subnet 10.0.0.0/8 conflicts with en0"},
+	})
+	data, err := json.Marshal(cj)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"clusterContext": "default",
+		"clusterServer": "https://127.0.0.1:6443",
+		"clusterId": "8e2b7d8a",
+		"managerVersion": "v2.5.0",
+		"warnings": ["the traffic-manager is older than the client", "subnet 10.0.0.0/8 conflicts with en0"]
+	}`, string(data))
+}
+
+func Test_readKubeconfigData(t *testing.T) {
+	const kubeconfig = "apiVersion: v1\nkind: Config\n"
+	read := func(stdin string, kubeFlags map[string]string) (*connector.ConnectRequest, error) {
+		cmd := &cobra.Command{}
+		cmd.SetIn(strings.NewReader(stdin))
+		request := &connector.ConnectRequest{KubeFlags: kubeFlags}
+		return request, readKubeconfigData(cmd, request)
+	}
+
+	t.Run("stdin", func(t *testing.T) {
+		request, err := read(kubeconfig, map[string]string{"kubeconfig": "-", "context": "ci"})
+		require.NoError(t, err)
+		assert.Equal(t, kubeconfig, string(request.KubeconfigData))
+		assert.Equal(t, map[string]string{"context": "ci"}, request.KubeFlags)
+	})
+
+	t.Run("empty stdin", func(t *testing.T) {
+		_, err := read(" \n", map[string]string{"kubeconfig": "-"})
+		assert.Error(t, err)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv(kubeconfigDataEnv, base64.StdEncoding.EncodeToString([]byte(kubeconfig)))
+		request, err := read("", map[string]string{})
+		require.NoError(t, err)
+		assert.Equal(t, kubeconfig, string(request.KubeconfigData))
+
+		// An explicit --kubeconfig takes precedence
+		request, err = read("", map[string]string{"kubeconfig": "/home/ci/.kube/config"})
+		require.NoError(t, err)
+		assert.Nil(t, request.KubeconfigData)
+	})
+
+	t.Run("invalid env", func(t *testing.T) {
+		t.Setenv(kubeconfigDataEnv, "not base64!")
+		_, err := read("", map[string]string{})
+		assert.Error(t, err)
+	})
+}
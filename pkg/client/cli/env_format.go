@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+const (
+	// envFormatDotenv is the KEY=value format of Docker Compose env files
+	envFormatDotenv = "dotenv"
+
+	// envFormatExport is a shell script that exports each variable
+	envFormatExport = "export"
+
+	// envFormatJSON is a JSON object
+	envFormatJSON = "json"
+
+	// envFormatYAML is the env list of a Kubernetes container
+	envFormatYAML = "yaml"
+)
+
+func validateEnvFormat(value string) error {
+	switch value {
+	case envFormatDotenv, envFormatExport, envFormatJSON, envFormatYAML:
+		return nil
+	default:
+		return errcat.User.Newf("--env-format must be one of %q, %q, %q, or %q",
+			envFormatDotenv, envFormatExport, envFormatJSON, envFormatYAML)
+	}
+}
+
+// writeEnv writes the environment to w in the given format, with the variables sorted by name. An empty
+// format is the same as envFormatDotenv.
+func writeEnv(w io.Writer, env map[string]string, format string) error {
+	switch format {
+	case envFormatJSON:
+		data, err := json.MarshalIndent(env, "", "  ")
+		if err != nil {
+			// Creating JSON from a map[string]string should never fail
+			panic(err)
+		}
+		_, err = w.Write(data)
+		return err
+	case envFormatYAML:
+		keys := sortedEnvKeys(env)
+		vars := make([]core.EnvVar, len(keys))
+		for i, k := range keys {
+			vars[i] = core.EnvVar{Name: k, Value: env[k]}
+		}
+		data, err := yaml.Marshal(map[string][]core.EnvVar{"env": vars})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, k := range sortedEnvKeys(env) {
+		var err error
+		if format == envFormatExport {
+			_, err = bw.WriteString("export " + k + "=" + shellQuote(env[k]) + "\n")
+		} else {
+			_, err = bw.WriteString(k + "=" + env[k] + "\n")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// shellQuote quotes s so that a POSIX shell reads it verbatim.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func sortedEnvKeys(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
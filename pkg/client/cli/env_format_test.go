@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_writeEnv(t *testing.T) {
+	env := map[string]string{
+		"GREETING": "it's a test",
+		"DB_URL":   "postgres://db:5432/shop",
+	}
+	tests := map[string]string{
+		envFormatDotenv: "DB_URL=postgres://db:5432/shop\nGREETING=it's a test\n",
+		envFormatExport: "export DB_URL='postgres://db:5432/shop'\nexport GREETING='it'\\''s a test'\n",
+		envFormatJSON:   "{\n  \"DB_URL\": \"postgres://db:5432/shop\",\n  \"GREETING\": \"it's a test\"\n}",
+		envFormatYAML:   "env:\n- name: DB_URL\n  value: postgres://db:5432/shop\n- name: GREETING\n  value: it's a test\n",
+		"":              "DB_URL=postgres://db:5432/shop\nGREETING=it's a test\n",
+	}
+	for format, expected := range tests {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, writeEnv(&buf, env, format))
+			assert.Equal(t, expected, buf.String())
+		})
+	}
+}
+
+func Test_validateEnvFormat(t *testing.T) {
+	for _, format := range []string{envFormatDotenv, envFormatExport, envFormatJSON, envFormatYAML} {
+		assert.NoError(t, validateEnvFormat(format))
+	}
+	assert.Error(t, validateEnvFormat("toml"))
+	assert.Error(t, validateEnvFormat(""))
+}
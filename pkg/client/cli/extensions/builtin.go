@@ -14,11 +14,8 @@ import (
 func builtinExtensions(ctx context.Context) map[string]ExtensionInfo {
 	cfg := client.GetConfig(ctx)
 	registry := cfg.Images.Registry
-	cloud := cfg.Cloud
 	version := strings.TrimPrefix(client.Version(), "v")
 	image := fmt.Sprintf("%s/tel2:%s", registry, version)
-	// XXX: not using net.JoinHostPort means that setting cloud.SystemaHost to an IPv6 address won't work
-	extImage := fmt.Sprintf("grpc+https://%s:%s", cloud.SystemaHost, cloud.SystemaPort)
 	return map[string]ExtensionInfo{
 		// Real extensions won't have a "/" in the extname, by putting one builtin extension names
 		// we can avoid clashes.
@@ -26,34 +23,34 @@ func builtinExtensions(ctx context.Context) map[string]ExtensionInfo {
 			Image: image,
 			Mechanisms: map[string]MechanismInfo{
 				"tcp": {},
-			},
-		},
-		// FIXME(lukeshu): We shouldn't compile in the info about the Ambassador Smart Agent
-		// extension, but we don't yet have an installer to install the extension file; so this
-		// metadata here is fine in the mean-time.
-		"/builtin/ambassador": {
-			Image:                   extImage,
-			RequiresAPIKeyOrLicense: true,
-			Mechanisms: map[string]MechanismInfo{
 				"http": {
-					Preference: 100,
+					// Never the default, it must be requested using its flag
+					Preference: -1,
 					Flags: map[string]FlagInfo{
 						"match": {
 							Type:    "stringArray",
 							Default: json.RawMessage(`["auto"]`),
 							Usage: `` +
-								`Rather than intercepting all traffic service, only intercept traffic that matches this "HTTP2_HEADER=REGEXP" specifier. ` +
-								`Instead of a "--http-match=HTTP2_HEADER=REGEXP" pair, you may say "--http-match=auto", which will automatically select a unique matcher for your intercept. ` +
-								`Alternatively, you may say "--http-match=all", which is a no-op, but will inhibit the default "--http-match=auto" when you are logged in. ` +
+								`Rather than intercepting all traffic, only intercept HTTP requests that match this "HEADER=REGEXP" specifier. ` +
+								`The regular expression must match the whole header value. ` +
+								`Instead of a "--http-match=HEADER=REGEXP" pair, you may say "--http-match=auto", which will only intercept ` +
+								`requests that have the "x-telepresence-intercept-id" header set to the ID of your intercept. ` +
+								`Alternatively, you may say "--http-match=all", which intercepts all HTTP requests. ` +
 								`If this flag is given multiple times, then it will only intercept traffic that matches *all* of the specifiers. ` +
-								`(default "auto" if you are logged in with 'telepresence login', default "all" otherwise)`,
+								`Requests that match no intercept are served by the workload`,
 						},
-						"plaintext": {
-							Type: "bool",
+					},
+				},
+				"tls": {
+					// Never the default, it must be requested using its flag
+					Preference: -1,
+					Flags: map[string]FlagInfo{
+						"sni": {
+							Type: "string",
 							Usage: `` +
-								`Use plaintext format when communicating with the interceptor process on the local workstation. Only ` +
-								`meaningful when intercepting workloads annotated with "getambassador.io/inject-originating-tls-secret" ` +
-								`to prevent that TLS is used during intercepts`,
+								`Only intercept TLS connections that the workload terminates itself and that request this host name ` +
+								`using SNI. The connections are forwarded as is, without being decrypted, so the intercepting ` +
+								`process must terminate TLS. Other connections are served by the workload`,
 						},
 					},
 				},
@@ -15,6 +15,7 @@ import (
 	"github.com/spf13/pflag"
 	"sigs.k8s.io/yaml"
 
+	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
@@ -320,9 +321,9 @@ func (es *ExtensionsState) AgentImage(ctx context.Context) (string, error) {
 		return "", err
 	}
 	image := os.Expand(es.exts[es.mech2ext[mechname]].Image, client.GetEnv(ctx).Get)
-	if cfg.Cloud.SkipLogin {
+	if cfg.Cloud.SkipLogin || cfg.Cloud.Disabled && urlSchemeIsOneOf(image, "http", "https", "grpc+https") {
 		msg := fmt.Sprintf(
-			`images.agentImage must be set with cloud.skipLogin in
+			`images.agentImage must be set with cloud.skipLogin or cloud.disabled in
 %s for intercepts of mechanism: %s`, client.GetConfigFile(ctx), mechname)
 		err := errcat.Config.New(msg)
 		return "", err
@@ -338,10 +339,21 @@ func (es *ExtensionsState) AgentImage(ctx context.Context) (string, error) {
 				}
 				req = req.WithContext(ctx)
 
-				resp, err := http.DefaultClient.Do(req)
+				hc, err := cfg.Cloud.HTTPClient()
 				if err != nil {
 					return "", err
 				}
+				resp, err := hc.Do(req)
+				if err != nil {
+					// The workstation might lack direct access to Ambassador Cloud, so try
+					// to retrieve the image name through the traffic-manager instead.
+					body, mgrErr := cliutil.GetCloudArtifact(ctx, image)
+					if mgrErr != nil {
+						dlog.Debugf(ctx, "unable to retrieve %s through the traffic-manager: %v", image, mgrErr)
+						return "", err
+					}
+					return strings.TrimSpace(string(body)), nil
+				}
 				defer resp.Body.Close()
 				if resp.StatusCode != http.StatusOK {
 					return "", errcat.NoLogs.Newf("image URL %q returned HTTP %v", image, resp.StatusCode)
@@ -384,7 +396,9 @@ type ExtensionInfo struct {
 	//
 	// Alternatively, instead of a Docker image name, you may give an "http://", https://", or
 	// "grpc+https://" URL.  For an "http://" or "https://" URL, the URL must return an HTTP 200
-	// response where the response body will be used as the Docker image name.  For a
+	// response where the response body will be used as the Docker image name.  An Ambassador
+	// Cloud URL that can't be reached from the workstation is retrieved through the
+	// traffic-manager.  For a
 	// "grpc+https://" url, it will make a `/telepresence.systema/PreferredAgentResponse`
 	// request to the server specified in the URL.  This is done recursively.
 	//
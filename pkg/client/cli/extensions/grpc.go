@@ -2,7 +2,6 @@ package extensions
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net/url"
 
@@ -43,9 +42,13 @@ func systemaGetPreferredAgentImageName(ctx context.Context, urlStr string) (stri
 	}
 	creds := SystemACredentials(apikey)
 
+	tlsCfg, err := client.GetConfig(ctx).Cloud.TLSConfig(u.Hostname())
+	if err != nil {
+		return "", fmt.Errorf("getting Ambassador Cloud preferred agent image: %w", err)
+	}
 	conn, err := grpc.DialContext(ctx,
 		(&url.URL{Scheme: "dns", Path: "/" + u.Host}).String(), // https://github.com/grpc/grpc/blob/master/doc/naming.md
-		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{ServerName: u.Hostname()})),
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)),
 		grpc.WithPerRPCCredentials(creds))
 	if err != nil {
 		return "", fmt.Errorf("getting Ambassador Cloud preferred agent image: dial error: %w", err)
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/shellquote"
+)
+
+// Values of the --dependents flag.
+const (
+	dependentsSuggest = "suggest"
+	dependentsCreate  = "create"
+	dependentsIgnore  = "ignore"
+)
+
+func validateDependentsFlag(value string) error {
+	switch value {
+	case dependentsSuggest, dependentsCreate, dependentsIgnore:
+		return nil
+	default:
+		return errcat.User.Newf("--dependents must be one of %q, %q, or %q", dependentsSuggest, dependentsCreate, dependentsIgnore)
+	}
+}
+
+// handleDependents asks the traffic-manager for the workloads that depend on the intercepted workload, and
+// either suggests or creates intercepts on them that use the same matchers, so that a whole request chain is
+// routed to this workstation.
+func (is *interceptState) handleDependents(ctx context.Context, ir *connector.CreateInterceptRequest) error {
+	if is.args.dependents == dependentsIgnore {
+		return nil
+	}
+	affinity, err := is.managerClient.GetInterceptAffinity(ctx, &manager.GetInterceptRequest{
+		Session: is.connInfo.SessionInfo,
+		Name:    is.args.name,
+	})
+	if err != nil {
+		if grpcStatus.Code(err) == codes.Unimplemented {
+			// Older traffic-manager
+			return nil
+		}
+		return err
+	}
+	if len(affinity.Dependents) == 0 {
+		return nil
+	}
+
+	out := is.cmd.OutOrStdout()
+	fmt.Fprintf(out, "Workloads that depend on %s according to its %s annotation:\n", is.args.agentName, install.InterceptDependentsAnnotation)
+	for _, arg := range affinity.MechanismArgs {
+		if strings.HasSuffix(arg, "=auto") {
+			fmt.Fprintf(out, "   The %s argument selects a matcher that is unique to each intercept. Use an explicit\n", arg)
+			fmt.Fprintln(out, "   matcher to route the requests of a chain consistently")
+			break
+		}
+	}
+	for _, dep := range affinity.Dependents {
+		is.handleDependent(ctx, out, ir, affinity, dep)
+	}
+	return nil
+}
+
+func (is *interceptState) handleDependent(
+	ctx context.Context,
+	out io.Writer,
+	ir *connector.CreateInterceptRequest,
+	affinity *manager.InterceptAffinity,
+	dep *manager.InterceptAffinity_Dependent,
+) {
+	fmt.Fprintf(out, "   %s: ", dep.Workload)
+	switch {
+	case dep.Error != "":
+		fmt.Fprintf(out, "unable to resolve: %s\n", dep.Error)
+		return
+	case dep.InterceptName != "":
+		fmt.Fprintf(out, "intercepted by you as %q\n", dep.InterceptName)
+		return
+	case len(dep.OtherClients) > 0:
+		fmt.Fprintf(out, "intercepted by %s; matching requests may be routed there\n", strings.Join(dep.OtherClients, ", "))
+		return
+	}
+
+	if is.args.dependents == dependentsCreate && dep.LocalPort != 0 {
+		name, err := is.createDependentIntercept(ctx, ir, affinity, dep)
+		if err != nil {
+			fmt.Fprintf(out, "unable to intercept: %v\n", err)
+		} else {
+			fmt.Fprintf(out, "intercepted as %q, forwarding to 127.0.0.1:%d\n", name, dep.LocalPort)
+		}
+		return
+	}
+
+	port := "<local port>"
+	if dep.LocalPort != 0 {
+		port = strconv.Itoa(int(dep.LocalPort))
+	}
+	args := []string{"intercept", dep.Workload, "--namespace", dep.Namespace, "--port", port}
+	for _, arg := range affinity.MechanismArgs {
+		// The mechanism arguments lack the mechanism prefix of the CLI flags
+		args = append(args, "--"+affinity.Mechanism+"-"+strings.TrimPrefix(arg, "--"))
+	}
+	fmt.Fprintf(out, "intercept it using: %s\n", shellquote.ShellString("telepresence", args))
+}
+
+// createDependentIntercept creates an intercept on the given dependent that uses the same mechanism as the
+// intercept that was just created, and returns its name.
+func (is *interceptState) createDependentIntercept(
+	ctx context.Context,
+	ir *connector.CreateInterceptRequest,
+	affinity *manager.InterceptAffinity,
+	dep *manager.InterceptAffinity_Dependent,
+) (string, error) {
+	name := dep.Workload
+	if is.args.namespace != "" {
+		name += "-" + is.args.namespace
+	}
+	r, err := is.connectorClient.CreateIntercept(ctx, &connector.CreateInterceptRequest{
+		Spec: &manager.InterceptSpec{
+			Name:          name,
+			Agent:         dep.Workload,
+			Namespace:     is.args.namespace,
+			Mechanism:     affinity.Mechanism,
+			MechanismArgs: affinity.MechanismArgs,
+			TargetHost:    "127.0.0.1",
+			TargetPort:    dep.LocalPort,
+		},
+		AgentImage:     ir.AgentImage,
+		Encrypt:        ir.Encrypt,
+		IdempotencyKey: uuid.New().String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err = interceptMessage(r); err != nil {
+		return "", err
+	}
+	is.dependentIntercepts = append(is.dependentIntercepts, name)
+	return name, nil
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/restapi"
+)
+
+const detailedOutputJSON = "json"
+
+func validateDetailedOutput(format string) error {
+	switch format {
+	case "", detailedOutputJSON:
+		return nil
+	default:
+		return errcat.User.Newf("invalid --detailed-output %q, only %q is supported", format, detailedOutputJSON)
+	}
+}
+
+// interceptDetails is the document that "telepresence intercept --detailed-output json" prints once the
+// intercept has been created.
+type interceptDetails struct {
+	ID                    string            `json:"id"`
+	Name                  string            `json:"name"`
+	Workload              string            `json:"workload"`
+	WorkloadKind          string            `json:"workloadKind"`
+	Namespace             string            `json:"namespace"`
+	ServiceName           string            `json:"serviceName,omitempty"`
+	ServicePortIdentifier string            `json:"servicePortIdentifier,omitempty"`
+	LocalHost             string            `json:"localHost"`
+	LocalPort             int32             `json:"localPort"`
+	HTTPMatch             map[string]string `json:"httpMatch,omitempty"`
+	PreviewURL            string            `json:"previewUrl,omitempty"`
+	EnvFile               string            `json:"envFile,omitempty"`
+	EnvJSON               string            `json:"envJson,omitempty"`
+	MountPoint            string            `json:"mountPoint,omitempty"`
+	MountError            string            `json:"mountError,omitempty"`
+}
+
+// newInterceptDetails returns the details of the given intercept. The paths of the env files are made
+// absolute so that they can be used regardless of the working directory of the consumer.
+func newInterceptDetails(ii *manager.InterceptInfo, args *interceptArgs, volumeMountProblem error) *interceptDetails {
+	spec := ii.Spec
+	d := &interceptDetails{
+		ID:                    ii.Id,
+		Name:                  spec.Name,
+		Workload:              spec.Agent,
+		WorkloadKind:          spec.WorkloadKind,
+		Namespace:             spec.Namespace,
+		ServiceName:           spec.ServiceName,
+		ServicePortIdentifier: spec.ServicePortIdentifier,
+		LocalHost:             spec.TargetHost,
+		LocalPort:             spec.TargetPort,
+		HTTPMatch:             interceptHTTPMatch(ii),
+		PreviewURL:            previewURL(ii.PreviewDomain),
+		EnvFile:               absPath(args.envFile),
+		EnvJSON:               absPath(args.envJSON),
+		MountPoint:            spec.MountPoint,
+	}
+	if spec.MountPoint == "" && volumeMountProblem != nil {
+		d.MountError = volumeMountProblem.Error()
+	}
+	return d
+}
+
+// interceptHTTPMatch returns the headers that the HTTP requests must match to be intercepted, mapped to the
+// regular expressions that their values must match. The map is nil when all requests are intercepted.
+func interceptHTTPMatch(ii *manager.InterceptInfo) map[string]string {
+	var hm map[string]string
+	for _, arg := range ii.Spec.MechanismArgs {
+		m := strings.TrimPrefix(arg, "--match=")
+		if m == arg || m == "all" {
+			continue
+		}
+		if hm == nil {
+			hm = make(map[string]string)
+		}
+		if m == "auto" {
+			hm[restapi.HeaderInterceptID] = ii.Id
+		} else if eq := strings.IndexByte(m, '='); eq > 0 {
+			hm[m[:eq]] = m[eq+1:]
+		}
+	}
+	return hm
+}
+
+// previewURL returns the URL of the given preview domain. Right now SystemA gives back domains with the
+// leading "https://", but let's not rely on that.
+func previewURL(domain string) string {
+	if domain == "" || strings.HasPrefix(domain, "https://") || strings.HasPrefix(domain, "http://") {
+		return domain
+	}
+	return "https://" + domain
+}
+
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
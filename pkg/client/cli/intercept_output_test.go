@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/restapi"
+)
+
+func Test_newInterceptDetails(t *testing.T) {
+	ii := &manager.InterceptInfo{
+		Id: "d1b3a6a2:echo",
+		Spec: &manager.InterceptSpec{
+			Name:                  "echo",
+			Agent:                 "echo",
+			WorkloadKind:          "Deployment",
+			Namespace:             "default",
+			ServiceName:           "echo",
+			ServicePortIdentifier: "http",
+			TargetHost:            "127.0.0.1",
+			TargetPort:            8080,
+			Mechanism:             "http",
+			MechanismArgs:         []string{"--match=x-dev=alice", "--match=auto"},
+			MountPoint:            "/tmp/telfs-123",
+		},
+		PreviewDomain: "echo.preview.edgestack.me",
+	}
+	args := &interceptArgs{envFile: "echo.env"}
+	d := newInterceptDetails(ii, args, errors.New("not used"))
+
+	envFile, err := filepath.Abs("echo.env")
+	require.NoError(t, err)
+	assert.Equal(t, &interceptDetails{
+		ID:                    "d1b3a6a2:echo",
+		Name:                  "echo",
+		Workload:              "echo",
+		WorkloadKind:          "Deployment",
+		Namespace:             "default",
+		ServiceName:           "echo",
+		ServicePortIdentifier: "http",
+		LocalHost:             "127.0.0.1",
+		LocalPort:             8080,
+		HTTPMatch:             map[string]string{"x-dev": "alice", restapi.HeaderInterceptID: "d1b3a6a2:echo"},
+		PreviewURL:            "https://echo.preview.edgestack.me",
+		EnvFile:               envFile,
+		MountPoint:            "/tmp/telfs-123",
+	}, d)
+
+	// All requests are intercepted, and the mount failed
+	ii.Spec.MechanismArgs = []string{"--match=all"}
+	ii.Spec.MountPoint = ""
+	ii.PreviewDomain = ""
+	d = newInterceptDetails(ii, &interceptArgs{}, errors.New("no sshfs"))
+	assert.Nil(t, d.HTTPMatch)
+	assert.Equal(t, "no sshfs", d.MountError)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeJSON(buf, d))
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "d1b3a6a2:echo", doc["id"])
+	assert.Equal(t, float64(8080), doc["localPort"])
+	assert.NotContains(t, doc, "httpMatch")
+	assert.NotContains(t, doc, "previewUrl")
+	assert.NotContains(t, doc, "envFile")
+}
+
+func Test_validateDetailedOutput(t *testing.T) {
+	assert.NoError(t, validateDetailedOutput(""))
+	assert.NoError(t, validateDetailedOutput("json"))
+	assert.Error(t, validateDetailedOutput("yaml"))
+}
@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+
+	"github.com/datawire/dlib/dgroup"
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/extensions"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/proc"
+)
+
+// interceptSpecFile is the YAML specification file that is used with "telepresence intercept --file".
+type interceptSpecFile struct {
+	Intercepts []*interceptSpec `yaml:"intercepts"`
+}
+
+// interceptSpec declares one intercept. The fields correspond to the flags of the intercept command.
+type interceptSpec struct {
+	Name              string            `yaml:"name,omitempty"`
+	Workload          string            `yaml:"workload,omitempty"`
+	Namespace         string            `yaml:"namespace,omitempty"`
+	Service           string            `yaml:"service,omitempty"`
+	Container         string            `yaml:"container,omitempty"`
+	Port              string            `yaml:"port,omitempty"`
+	Headers           map[string]string `yaml:"headers,omitempty"`
+	EnvFile           string            `yaml:"envFile,omitempty"`
+	EnvJSON           string            `yaml:"envJSON,omitempty"`
+	EnvFormat         string            `yaml:"envFormat,omitempty"`
+	Mount             string            `yaml:"mount,omitempty"`
+	MountReadOnly     bool              `yaml:"mountReadOnly,omitempty"`
+	MountInclude      []string          `yaml:"mountInclude,omitempty"`
+	MountExclude      []string          `yaml:"mountExclude,omitempty"`
+	ToPod             []string          `yaml:"toPod,omitempty"`
+	PreviewURL        *bool             `yaml:"previewURL,omitempty"`
+	Encrypt           bool              `yaml:"encrypt,omitempty"`
+	Mirror            bool              `yaml:"mirror,omitempty"`
+	TrafficPercentage int32             `yaml:"trafficPercentage,omitempty"`
+	DockerRun         bool              `yaml:"dockerRun,omitempty"`
+	Handler           []string          `yaml:"handler,omitempty"`
+}
+
+// readInterceptSpecFile reads the given specification file, or stdin when the file is "-". Unknown keys
+// are rejected so that misspelled settings aren't silently ignored.
+func readInterceptSpecFile(stdin io.Reader, file string) (*interceptSpecFile, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, errcat.User.New(err)
+	}
+	sf, err := parseInterceptSpecFile(data)
+	if err != nil {
+		return nil, errcat.User.Newf("unable to parse intercept specification %s: %w", file, err)
+	}
+	return sf, nil
+}
+
+func parseInterceptSpecFile(data []byte) (*interceptSpecFile, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var sf interceptSpecFile
+	if err := dec.Decode(&sf); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("no intercepts declared")
+		}
+		return nil, err
+	}
+	if len(sf.Intercepts) == 0 {
+		return nil, fmt.Errorf("no intercepts declared")
+	}
+	names := make(map[string]struct{}, len(sf.Intercepts))
+	for i, spec := range sf.Intercepts {
+		if spec == nil {
+			return nil, fmt.Errorf("intercept %d is empty", i+1)
+		}
+		if spec.Workload == "" {
+			if spec.Name == "" {
+				return nil, fmt.Errorf("intercept %d has neither a name nor a workload", i+1)
+			}
+			spec.Workload = spec.Name
+		}
+		if spec.Name == "" {
+			spec.Name = spec.Workload
+			if spec.Namespace != "" {
+				spec.Name += "-" + spec.Namespace
+			}
+		}
+		if _, dup := names[spec.Name]; dup {
+			return nil, fmt.Errorf("intercept %q is declared more than once", spec.Name)
+		}
+		names[spec.Name] = struct{}{}
+		if spec.DockerRun {
+			if len(spec.Handler) == 0 {
+				return nil, fmt.Errorf("intercept %q: dockerRun requires a handler", spec.Name)
+			}
+			if err := validateDockerArgs(spec.Handler); err != nil {
+				return nil, fmt.Errorf("intercept %q: %w", spec.Name, err)
+			}
+		}
+	}
+	return &sf, nil
+}
+
+// interceptArgs returns the arguments that the intercept command would produce from flags that declare
+// the same intercept as this spec.
+func (spec *interceptSpec) interceptArgs(ctx context.Context) (interceptArgs, error) {
+	args := interceptArgs{
+		name:           spec.Name,
+		agentName:      spec.Workload,
+		namespace:      spec.Namespace,
+		serviceName:    spec.Service,
+		container:      spec.Container,
+		port:           spec.Port,
+		encrypt:        spec.Encrypt,
+		mirror:         spec.Mirror,
+		dependents:     dependentsIgnore,
+		previewEnabled: cliutil.HasLoggedIn(ctx),
+		previewSpec:    &manager.PreviewSpec{},
+		envFile:        spec.EnvFile,
+		envJSON:        spec.EnvJSON,
+		envFormat:      spec.EnvFormat,
+		mount:          spec.Mount,
+		mountSet:       spec.Mount != "",
+		readOnly:       spec.MountReadOnly,
+		include:        spec.MountInclude,
+		exclude:        spec.MountExclude,
+		toPod:          spec.ToPod,
+		dockerRun:      spec.DockerRun,
+		cmdline:        spec.Handler,
+	}
+	if args.port == "" {
+		args.port = strconv.Itoa(client.GetConfig(ctx).Intercept.DefaultPort)
+	}
+	if args.mount == "" {
+		args.mount = "true"
+	}
+	if args.percentage = spec.TrafficPercentage; args.percentage == 0 {
+		args.percentage = 100
+	}
+	if args.envFormat == "" {
+		args.envFormat = envFormatDotenv
+	} else if err := validateEnvFormat(args.envFormat); err != nil {
+		return args, errcat.User.Newf("intercept %q: %w", spec.Name, err)
+	}
+	if spec.PreviewURL != nil {
+		args.previewEnabled = *spec.PreviewURL
+	}
+
+	// The extensions decide the intercept mechanism from the flags that are set, so the headers are
+	// passed to them as the equivalent --http-match flags.
+	flags := pflag.NewFlagSet(spec.Name, pflag.ContinueOnError)
+	es, err := extensions.LoadExtensions(ctx, flags)
+	if err != nil {
+		return args, err
+	}
+	headers := make([]string, 0, len(spec.Headers))
+	for k := range spec.Headers {
+		headers = append(headers, k)
+	}
+	sort.Strings(headers)
+	for _, k := range headers {
+		if err := flags.Set("http-match", k+"="+spec.Headers[k]); err != nil {
+			return args, errcat.User.Newf("intercept %q: unable to use header %q: %w", spec.Name, k, err)
+		}
+	}
+	args.extState = es
+	if args.extRequiresLogin, err = es.RequiresAPIKeyOrLicense(); err != nil {
+		return args, err
+	}
+	return args, nil
+}
+
+// interceptFromSpecFile creates the intercepts declared in the given specification file. The intercepts
+// are retained unless one of them declares a handler, in which case all handlers are run concurrently and
+// the intercepts are removed when the handlers exit.
+func interceptFromSpecFile(cmd *cobra.Command, file string) error {
+	sf, err := readInterceptSpecFile(cmd.InOrStdin(), file)
+	if err != nil {
+		return err
+	}
+	return interceptFromSpecs(cmd, nil, sf.Intercepts)
+}
+
+// interceptFromSpecs connects using the given request and creates the intercepts declared by the given specs.
+func interceptFromSpecs(cmd *cobra.Command, request *connector.ConnectRequest, specs []*interceptSpec) error {
+	var err error
+	ctx := cmd.Context()
+	argsList := make([]interceptArgs, len(specs))
+	retain := true
+	for i, spec := range specs {
+		if argsList[i], err = spec.interceptArgs(ctx); err != nil {
+			return err
+		}
+		if len(spec.Handler) > 0 {
+			retain = false
+		}
+	}
+
+	return withConnector(cmd, retain, request, func(ctx context.Context, cs *connectorState) error {
+		return cliutil.WithManager(ctx, func(ctx context.Context, managerClient manager.ManagerClient) error {
+			states := make([]*interceptState, len(argsList))
+			for i, args := range argsList {
+				states[i] = newInterceptState(ctx, safeCobraCommandImpl{cmd}, args, cs, managerClient)
+			}
+			return withEnsuredStates(ctx, states, retain, func() error {
+				if retain {
+					return nil
+				}
+				return runInterceptHandlers(ctx, states)
+			})
+		})
+	})
+}
+
+// withEnsuredStates ensures the given states in order and calls f when all of them are ensured. The states
+// are deactivated in reverse order.
+func withEnsuredStates(ctx context.Context, states []*interceptState, retain bool, f func() error) error {
+	if len(states) == 0 {
+		return f()
+	}
+	return client.WithEnsuredState(ctx, states[0], retain, func() error {
+		return withEnsuredStates(ctx, states[1:], retain, f)
+	})
+}
+
+func runInterceptHandlers(ctx context.Context, states []*interceptState) error {
+	grp := dgroup.NewGroup(ctx, dgroup.GroupConfig{DisableLogging: true})
+	for _, is := range states {
+		is := is
+		if len(is.args.cmdline) == 0 {
+			continue
+		}
+		grp.Go(is.args.name, func(ctx context.Context) error {
+			if is.args.dockerRun {
+				return is.runInDocker(ctx, is.cmd, is.args.cmdline)
+			}
+			return proc.Run(ctx, is.env, is.args.cmdline[0], is.args.cmdline[1:]...)
+		})
+	}
+	return grp.Wait()
+}
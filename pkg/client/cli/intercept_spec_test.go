@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseInterceptSpecFile(t *testing.T) {
+	sf, err := parseInterceptSpecFile([]byte(`
+intercepts:
+- workload: orders
+  namespace: shop
+  port: 8080
+  headers:
+    x-dev: alice
+  handler: [go, run, ./cmd/orders]
+- name: payments-dev
+  workload: payments
+  mount: "false"
+  previewURL: false
+- name: echo
+  mountReadOnly: true
+  envFile: echo.env
+  envFormat: export
+`))
+	require.NoError(t, err)
+	require.Len(t, sf.Intercepts, 3)
+
+	orders := sf.Intercepts[0]
+	assert.Equal(t, "orders-shop", orders.Name)
+	assert.Equal(t, "8080", orders.Port)
+	assert.Equal(t, map[string]string{"x-dev": "alice"}, orders.Headers)
+	assert.Equal(t, []string{"go", "run", "./cmd/orders"}, orders.Handler)
+
+	payments := sf.Intercepts[1]
+	assert.Equal(t, "payments-dev", payments.Name)
+	assert.Equal(t, "payments", payments.Workload)
+	require.NotNil(t, payments.PreviewURL)
+	assert.False(t, *payments.PreviewURL)
+
+	assert.Equal(t, "echo", sf.Intercepts[2].Workload)
+	assert.True(t, sf.Intercepts[2].MountReadOnly)
+	assert.Equal(t, "export", sf.Intercepts[2].EnvFormat)
+}
+
+func Test_parseInterceptSpecFileErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":          ``,
+		"no intercepts":  `intercepts: []`,
+		"unknown key":    "intercepts:\n- workload: orders\n  prot: 8080\n",
+		"no workload":    "intercepts:\n- port: 8080\n",
+		"duplicate name": "intercepts:\n- workload: orders\n- name: orders\n",
+		"docker no args": "intercepts:\n- workload: orders\n  dockerRun: true\n",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseInterceptSpecFile([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
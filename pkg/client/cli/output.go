@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+
+	// outputFlagAnnotation marks the flags that select the output format. Commands like genyaml use a flag
+	// named "output" for the path of a file, and that flag must not be mistaken for the global flag.
+	outputFlagAnnotation = "telepresence.io/output-format"
+
+	// jsonOutputAnnotation marks the commands that can print their result as JSON.
+	jsonOutputAnnotation = "telepresence.io/json-output"
+)
+
+func outputFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("", 0)
+	flags.String("output", outputFormatText, `Set to "json" to print the result of the command as JSON on stdout. `+
+		`All other output is then written to stderr`)
+	_ = flags.SetAnnotation("output", outputFlagAnnotation, []string{"true"})
+	flags.BoolP("quiet", "q", false, "Only print the result of the command and errors")
+	return flags
+}
+
+// addOutputFlag adds an --output flag with a -o shorthand to the given command. It is the same flag as the
+// global --output flag, and exists so that commands that had a -o shorthand before that flag was introduced
+// keep it.
+func addOutputFlag(cmd *cobra.Command) {
+	f := outputFlags().Lookup("output")
+	f.Shorthand = "o"
+	cmd.Flags().AddFlag(f)
+}
+
+// withJSONOutput marks the given command as one that can print its result as JSON and returns it.
+func withJSONOutput(cmd *cobra.Command) *cobra.Command {
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[jsonOutputAnnotation] = "true"
+	return cmd
+}
+
+// outputFormat returns the output format that was selected for the given command.
+func outputFormat(cmd *cobra.Command) string {
+	if f := cmd.Flags().Lookup("output"); f != nil && f.Annotations[outputFlagAnnotation] != nil && f.Value.String() != "" {
+		return f.Value.String()
+	}
+	return outputFormatText
+}
+
+func isQuiet(cmd *cobra.Command) bool {
+	q, err := cmd.Flags().GetBool("quiet")
+	return err == nil && q
+}
+
+// infoWriter receives the informational messages that a command writes to its output when --output json
+// or --quiet is in effect. It retains the original output, where the result of the command is written.
+type infoWriter struct {
+	io.Writer
+	result io.Writer
+}
+
+// setupOutput validates the output flags of the given command and, when they ask for it, redirects the
+// informational messages of the command to stderr, or discards them, so that stdout only contains its result.
+func setupOutput(cmd *cobra.Command, _ []string) error {
+	format := outputFormat(cmd)
+	switch format {
+	case outputFormatText:
+	case outputFormatJSON:
+		if cmd.Annotations[jsonOutputAnnotation] == "" {
+			return errcat.User.Newf("%s does not support --output %s", cmd.CommandPath(), format)
+		}
+	default:
+		return errcat.User.Newf("unsupported output format %q, must be %q or %q", format, outputFormatText, outputFormatJSON)
+	}
+	quiet := isQuiet(cmd)
+	if format == outputFormatJSON || quiet {
+		if _, ok := cmd.OutOrStdout().(*infoWriter); !ok {
+			iw := &infoWriter{Writer: cmd.ErrOrStderr(), result: cmd.OutOrStdout()}
+			if quiet {
+				iw.Writer = io.Discard
+			}
+			cmd.SetOut(iw)
+		}
+	}
+	cliutil.SetInfoOutput(cmd.OutOrStdout())
+	return nil
+}
+
+// resultOutput returns the writer where the result of the given command is printed.
+func resultOutput(cmd *cobra.Command) io.Writer {
+	out := cmd.OutOrStdout()
+	if iw, ok := out.(*infoWriter); ok {
+		return iw.result
+	}
+	return out
+}
+
+// printResult prints the given result of a command as JSON when --output json is in effect, and otherwise
+// calls printText with the writer where the result should be printed.
+func printResult(cmd *cobra.Command, result interface{}, printText func(io.Writer)) error {
+	out := resultOutput(cmd)
+	if outputFormat(cmd) != outputFormatJSON {
+		printText(out)
+		return nil
+	}
+	return writeJSON(out, result)
+}
+
+func writeJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+)
+
+// outputTestCommand returns a root command with the global output flags and a "result" subcommand that
+// prints an informational message followed by its result.
+func outputTestCommand(supportsJSON bool) *cobra.Command {
+	root := &cobra.Command{
+		Use:               "telepresence",
+		PersistentPreRunE: setupOutput,
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+	}
+	root.PersistentFlags().AddFlagSet(outputFlags())
+	cmd := &cobra.Command{
+		Use: "result",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			fmt.Fprintln(cmd.OutOrStdout(), "Connected to context default")
+			return printResult(cmd, map[string]string{"name": "echo"}, func(out io.Writer) {
+				fmt.Fprintln(out, "name: echo")
+			})
+		},
+	}
+	if supportsJSON {
+		withJSONOutput(cmd)
+	}
+	root.AddCommand(cmd)
+
+	fileCmd := &cobra.Command{
+		Use: "file",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			fmt.Fprintln(cmd.OutOrStdout(), outputFormat(cmd))
+			return nil
+		},
+	}
+	fileCmd.Flags().String("output", "-", "the file to write")
+	root.AddCommand(fileCmd)
+	return root
+}
+
+func runOutputTestCommand(t *testing.T, supportsJSON bool, args ...string) (string, string, error) {
+	t.Helper()
+	defer cliutil.SetInfoOutput(os.Stdout)
+	root := outputTestCommand(supportsJSON)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	root.SetOut(stdout)
+	root.SetErr(stderr)
+	root.SetArgs(args)
+	err := root.Execute()
+	return stdout.String(), stderr.String(), err
+}
+
+func TestOutput(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		stdout, stderr, err := runOutputTestCommand(t, true, "result")
+		require.NoError(t, err)
+		assert.Equal(t, "Connected to context default\nname: echo\n", stdout)
+		assert.Empty(t, stderr)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		stdout, stderr, err := runOutputTestCommand(t, true, "result", "--output", "json")
+		require.NoError(t, err)
+		var result map[string]string
+		require.NoError(t, json.Unmarshal([]byte(stdout), &result))
+		assert.Equal(t, map[string]string{"name": "echo"}, result)
+		assert.Equal(t, "Connected to context default\n", stderr)
+	})
+
+	t.Run("json unsupported", func(t *testing.T) {
+		_, _, err := runOutputTestCommand(t, false, "result", "--output", "json")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does not support --output json")
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		_, _, err := runOutputTestCommand(t, true, "result", "--output", "yaml")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unsupported output format "yaml"`)
+	})
+
+	t.Run("quiet", func(t *testing.T) {
+		stdout, stderr, err := runOutputTestCommand(t, true, "result", "-q")
+		require.NoError(t, err)
+		assert.Equal(t, "name: echo\n", stdout)
+		assert.Empty(t, stderr)
+	})
+
+	t.Run("quiet json", func(t *testing.T) {
+		stdout, stderr, err := runOutputTestCommand(t, true, "result", "--quiet", "--output=json")
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"name": "echo"}`, stdout)
+		assert.Empty(t, stderr)
+	})
+
+	t.Run("output file flag", func(t *testing.T) {
+		stdout, _, err := runOutputTestCommand(t, false, "file", "--output", "json")
+		require.NoError(t, err)
+		assert.Equal(t, outputFormatText+"\n", stdout)
+	})
+}
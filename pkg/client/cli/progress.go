@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+	grpcCodes "google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+)
+
+// progressWriter shows the progress of a connect or an intercept on a single terminal line that is rewritten for
+// each event and cleared when the operation completes. Nothing is shown when the output isn't a terminal, so the
+// output of scripts is unaffected.
+type progressWriter struct {
+	out   io.Writer
+	shown bool
+}
+
+// newProgressWriter returns a progressWriter for the given output, or nil when the output isn't a terminal. The
+// methods of a nil progressWriter are no-ops.
+func newProgressWriter(out io.Writer) *progressWriter {
+	if f, ok := out.(*os.File); !ok || !term.IsTerminal(int(f.Fd())) {
+		return nil
+	}
+	return &progressWriter{out: out}
+}
+
+func (p *progressWriter) event(e *connector.ProgressEvent) {
+	if p == nil || e == nil {
+		return
+	}
+	msg := e.Message
+	if !e.Done {
+		msg += "..."
+	}
+	fmt.Fprintf(p.out, "\r\x1b[K%s", msg)
+	p.shown = true
+}
+
+func (p *progressWriter) clear() {
+	if p != nil && p.shown {
+		fmt.Fprint(p.out, "\r\x1b[K")
+		p.shown = false
+	}
+}
+
+// connectWithProgress makes the Connect call, showing its progress on the given output. It falls back to a plain
+// Connect when the user daemon predates ConnectWithProgress.
+func connectWithProgress(ctx context.Context, connectorClient connector.ConnectorClient, stdout io.Writer, request *connector.ConnectRequest) (*connector.ConnectInfo, error) {
+	stream, err := connectorClient.ConnectWithProgress(ctx, request)
+	if err == nil {
+		pw := newProgressWriter(stdout)
+		defer pw.clear()
+		var cp *connector.ConnectProgress
+		for {
+			if cp, err = stream.Recv(); err != nil {
+				break
+			}
+			if r := cp.GetResult(); r != nil {
+				return r, nil
+			}
+			pw.event(cp.GetProgress())
+		}
+	}
+	switch {
+	case grpcStatus.Code(err) == grpcCodes.Unimplemented:
+		return connectorClient.Connect(ctx, request)
+	case errors.Is(err, io.EOF):
+		err = errors.New("the connect ended without a result")
+	}
+	return nil, err
+}
+
+// createInterceptWithProgress makes the CreateIntercept call, showing its progress on the given output. It falls
+// back to a plain CreateIntercept when the user daemon predates CreateInterceptWithProgress.
+func createInterceptWithProgress(ctx context.Context, connectorClient connector.ConnectorClient, stdout io.Writer, ir *connector.CreateInterceptRequest) (*connector.InterceptResult, error) {
+	stream, err := connectorClient.CreateInterceptWithProgress(ctx, ir)
+	if err == nil {
+		pw := newProgressWriter(stdout)
+		defer pw.clear()
+		var ip *connector.InterceptProgress
+		for {
+			if ip, err = stream.Recv(); err != nil {
+				break
+			}
+			if r := ip.GetResult(); r != nil {
+				return r, nil
+			}
+			pw.event(ip.GetProgress())
+		}
+	}
+	switch {
+	case grpcStatus.Code(err) == grpcCodes.Unimplemented:
+		return connectorClient.CreateIntercept(ctx, ir)
+	case errors.Is(err, io.EOF):
+		err = errors.New("the intercept ended without a result")
+	}
+	return nil, err
+}
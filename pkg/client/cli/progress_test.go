@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+)
+
+// oldConnector is a user daemon that predates the streaming calls.
+type oldConnector struct {
+	connector.UnimplementedConnectorServer
+}
+
+func (oldConnector) Connect(context.Context, *connector.ConnectRequest) (*connector.ConnectInfo, error) {
+	return &connector.ConnectInfo{ClusterContext: "old"}, nil
+}
+
+func (oldConnector) CreateIntercept(context.Context, *connector.CreateInterceptRequest) (*connector.InterceptResult, error) {
+	return &connector.InterceptResult{WorkloadKind: "Deployment"}, nil
+}
+
+// newConnector is a user daemon that streams progress.
+type newConnector struct {
+	connector.UnimplementedConnectorServer
+}
+
+func (newConnector) ConnectWithProgress(_ *connector.ConnectRequest, stream connector.Connector_ConnectWithProgressServer) error {
+	err := stream.Send(&connector.ConnectProgress{Event: &connector.ConnectProgress_Progress{
+		Progress: &connector.ProgressEvent{Stage: connector.ProgressEvent_CLUSTER_CONNECT, Message: "Connecting"},
+	}})
+	if err != nil {
+		return err
+	}
+	return stream.Send(&connector.ConnectProgress{Event: &connector.ConnectProgress_Result{
+		Result: &connector.ConnectInfo{ClusterContext: "new"},
+	}})
+}
+
+func (newConnector) CreateInterceptWithProgress(_ *connector.CreateInterceptRequest, _ connector.Connector_CreateInterceptWithProgressServer) error {
+	// Ends the stream without a result
+	return nil
+}
+
+func testConnectorClient(t *testing.T, srv connector.ConnectorServer) connector.ConnectorClient {
+	lis := bufconn.Listen(64 * 1024)
+	s := grpc.NewServer()
+	connector.RegisterConnectorServer(s, srv)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return connector.NewConnectorClient(conn)
+}
+
+func TestConnectWithProgress(t *testing.T) {
+	ctx := context.Background()
+	out := &bytes.Buffer{}
+
+	ci, err := connectWithProgress(ctx, testConnectorClient(t, newConnector{}), out, &connector.ConnectRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "new", ci.ClusterContext)
+	assert.Empty(t, out.String(), "progress must not be written when the output isn't a terminal")
+
+	ci, err = connectWithProgress(ctx, testConnectorClient(t, oldConnector{}), out, &connector.ConnectRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "old", ci.ClusterContext)
+}
+
+func TestCreateInterceptWithProgress(t *testing.T) {
+	ctx := context.Background()
+	ir := &connector.CreateInterceptRequest{}
+
+	r, err := createInterceptWithProgress(ctx, testConnectorClient(t, oldConnector{}), &bytes.Buffer{}, ir)
+	require.NoError(t, err)
+	assert.Equal(t, "Deployment", r.WorkloadKind)
+
+	_, err = createInterceptWithProgress(ctx, testConnectorClient(t, newConnector{}), &bytes.Buffer{}, ir)
+	assert.EqualError(t, err, "the intercept ended without a result")
+}
+
+func TestProgressWriter(t *testing.T) {
+	assert.Nil(t, newProgressWriter(&bytes.Buffer{}))
+
+	out := &bytes.Buffer{}
+	pw := &progressWriter{out: out}
+	pw.event(&connector.ProgressEvent{Message: "Connecting"})
+	pw.event(&connector.ProgressEvent{Message: "Connected", Done: true})
+	pw.clear()
+	assert.Equal(t, "\r\x1b[KConnecting...\r\x1b[KConnected\r\x1b[K", out.String())
+}
@@ -25,6 +25,7 @@ const cacheFilename = "update-checks.json"
 type updateChecker struct {
 	NextCheck map[string]time.Time `json:"next_check"`
 	url       string
+	client    *http.Client
 }
 
 // newUpdateChecker returns a new update checker, possibly initialized from the users cache.
@@ -58,10 +59,16 @@ func forcedUpdateCheck(cmd *cobra.Command, _ []string) error {
 //   forcedCheck: if true, perform check regardless of if it's due or not
 func updateCheck(cmd *cobra.Command, forceCheck bool) error {
 	cloudCfg := client.GetConfig(cmd.Context()).Cloud
+	if cloudCfg.Disabled {
+		return nil
+	}
 	uc, err := newUpdateChecker(cmd.Context(), fmt.Sprintf("https://%s/download/tel2/%s/%s/stable.txt", cloudCfg.SystemaHost, runtime.GOOS, runtime.GOARCH))
 	if err != nil || !(forceCheck || uc.timeToCheck()) {
 		return err
 	}
+	if uc.client, err = cloudCfg.HTTPClient(); err != nil {
+		return err
+	}
 
 	ourVersion := client.Semver()
 	update, ok := uc.updateAvailable(&ourVersion, cmd.ErrOrStderr())
@@ -83,7 +90,11 @@ func (uc *updateChecker) storeNextCheck(ctx context.Context, d time.Duration) er
 }
 
 func (uc *updateChecker) updateAvailable(currentVersion *semver.Version, errOut io.Writer) (*semver.Version, bool) {
-	resp, err := http.Get(uc.url)
+	hc := uc.client
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Get(uc.url)
 	if err != nil {
 		// silently ignore connection failures
 		return nil, false
@@ -14,6 +14,7 @@ import (
 	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/k8s"
 )
 
 func kubeFlagMap(kubeFlags *pflag.FlagSet) map[string]string {
@@ -34,14 +35,14 @@ type connectorState struct {
 
 // withConnector is like cliutil.WithConnector, but also
 //
-//  - Ensures that the damon is running too
+//  - Ensures that the damon is running too, unless the session is (or will be) proxy-only or in-cluster
 //
 //  - Cleans up after itself unless retain is true (If it launches the daemon or connector, then it will shut
 //    them down when it's done.  If they were already running, it will leave them running.)
 //
 //  - Makes the connector.Connect gRPC call to set up networking
 func withConnector(cmd *cobra.Command, retain bool, request *connector.ConnectRequest, f func(context.Context, *connectorState) error) error {
-	return cliutil.WithNetwork(cmd.Context(), func(ctx context.Context, daemonClient daemon.DaemonClient) error {
+	withUserD := func(ctx context.Context, daemonClient daemon.DaemonClient) error {
 		return cliutil.WithConnector(ctx, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
 			didConnect, connInfo, err := connect(ctx, connectorClient, cmd.OutOrStdout(), request)
 			if err != nil {
@@ -57,7 +58,39 @@ func withConnector(cmd *cobra.Command, retain bool, request *connector.ConnectRe
 			}
 			return f(ctx, &connectorState{ConnectInfo: connInfo, userD: connectorClient, rootD: daemonClient})
 		})
+	}
+	ctx := cmd.Context()
+	if !needsRootDaemon(ctx, request) {
+		return withUserD(ctx, nil)
+	}
+	return cliutil.WithNetwork(ctx, withUserD)
+}
+
+// needsRootDaemon returns false if the session that the given request creates, or the session that the
+// user daemon is running, is proxy-only or in-cluster. Such sessions don't use the root daemon.
+func needsRootDaemon(ctx context.Context, request *connector.ConnectRequest) bool {
+	var kubeFlags map[string]string
+	var kubeconfigData []byte
+	if request != nil {
+		if request.ProxyAddress != "" {
+			return false
+		}
+		kubeFlags, kubeconfigData = request.KubeFlags, request.KubeconfigData
+	}
+	connected := false
+	rootless := false
+	_ = cliutil.WithStartedConnector(ctx, false, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
+		ci, err := connectorClient.Status(ctx, &empty.Empty{})
+		if err == nil && ci.Error != connector.ConnectInfo_DISCONNECTED {
+			connected = true
+			rootless = ci.ProxyAddress != "" || ci.InCluster
+		}
+		return err
 	})
+	if !connected {
+		rootless = k8s.InCluster(kubeFlags, kubeconfigData)
+	}
+	return !rootless
 }
 
 func connect(ctx context.Context, connectorClient connector.ConnectorClient, stdout io.Writer, request *connector.ConnectRequest) (bool, *connector.ConnectInfo, error) {
@@ -67,7 +100,7 @@ func connect(ctx context.Context, connectorClient connector.ConnectorClient, std
 		// implicit calls use the current Status instead of passing flags and mapped namespaces.
 		ci, err = connectorClient.Status(ctx, &empty.Empty{})
 	} else {
-		ci, err = connectorClient.Connect(ctx, request)
+		ci, err = connectWithProgress(ctx, connectorClient, stdout, request)
 	}
 	if err != nil {
 		return false, nil, err
@@ -78,6 +111,25 @@ func connect(ctx context.Context, connectorClient connector.ConnectorClient, std
 	switch ci.Error {
 	case connector.ConnectInfo_UNSPECIFIED:
 		fmt.Fprintf(stdout, "Connected to context %s (%s)\n", ci.ClusterContext, ci.ClusterServer)
+		if ci.ProxyAddress != "" {
+			fmt.Fprintf(stdout, "SOCKS5 and HTTP CONNECT proxy available at %s\n", ci.ProxyAddress)
+		}
+		if ci.PortForwardFallback != "" {
+			fmt.Fprintf(stdout, "Warning: %s. The services of the mapped namespaces are instead forwarded to loopback "+
+				"ports, see \"telepresence status\"\n", ci.PortForwardFallback)
+		}
+		for _, vs := range ci.VersionSkew {
+			fmt.Fprintf(stdout, "Warning: %s\n", vs)
+		}
+		for _, d := range ci.ConfigDrift {
+			fmt.Fprintf(stdout, "Warning: %s\n", d)
+		}
+		for _, sc := range ci.SubnetConflicts {
+			fmt.Fprintf(stdout, "Warning: %s\n", sc)
+		}
+		for _, w := range ci.ProxyHostWarnings {
+			fmt.Fprintf(stdout, "Warning: %s\n", w)
+		}
 		return true, ci, nil
 	case connector.ConnectInfo_ALREADY_CONNECTED:
 		return false, ci, nil
@@ -92,8 +144,14 @@ func connect(ctx context.Context, connectorClient connector.ConnectorClient, std
 		msg = "Cluster configuration changed, please quit telepresence and reconnect"
 	case connector.ConnectInfo_TRAFFIC_MANAGER_FAILED, connector.ConnectInfo_CLUSTER_FAILED, connector.ConnectInfo_DAEMON_FAILED:
 		msg = ci.ErrorText
-		if ci.ErrorCategory != 0 {
-			cat = errcat.Category(ci.ErrorCategory)
+		if ci.Error == connector.ConnectInfo_DAEMON_FAILED {
+			cat = errcat.Daemon
+		} else {
+			cat = errcat.Cluster
+		}
+		// A daemon that couldn't categorize the error reports it as unknown, so the failure type is more precise
+		if ec := errcat.Category(ci.ErrorCategory); ec != errcat.OK && ec != errcat.Unknown {
+			cat = ec
 		}
 	}
 	return false, nil, cat.Newf("connector.Connect: %s", msg)
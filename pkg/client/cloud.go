@@ -0,0 +1,60 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+// ErrCloudDisabled is returned by operations that require Ambassador Cloud when cloud.disabled is set.
+var ErrCloudDisabled = errcat.User.New("this operation requires Ambassador Cloud, which is disabled by the cloud.disabled setting")
+
+// NoLogin returns true when Telepresence must never attempt to log in to Ambassador Cloud.
+func (cloud *Cloud) NoLogin() bool {
+	return cloud.SkipLogin || cloud.Disabled
+}
+
+// TLSConfig returns the TLS configuration to use when talking to the given Ambassador Cloud host. The
+// certificate authorities in the cloud.caCertFile are trusted in addition to the system's.
+func (cloud *Cloud) TLSConfig(serverName string) (*tls.Config, error) {
+	if cloud.Disabled {
+		return nil, ErrCloudDisabled
+	}
+	cfg := &tls.Config{ServerName: serverName}
+	if cloud.CACertFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(cloud.CACertFile)
+	if err != nil {
+		return nil, errcat.Config.Newf("unable to read cloud.caCertFile: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errcat.Config.Newf("cloud.caCertFile %s contains no PEM encoded certificates", cloud.CACertFile)
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+// HTTPClient returns the client to use for HTTP requests to Ambassador Cloud.
+func (cloud *Cloud) HTTPClient() (*http.Client, error) {
+	if cloud.Disabled {
+		return nil, ErrCloudDisabled
+	}
+	if cloud.CACertFile == "" {
+		return http.DefaultClient, nil
+	}
+	tlsCfg, err := cloud.TLSConfig("")
+	if err != nil {
+		return nil, err
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsCfg
+	return &http.Client{Transport: tr}, nil
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloud_TLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("disabled", func(t *testing.T) {
+		cloud := Cloud{Disabled: true}
+		_, err := cloud.TLSConfig("cloud.example.com")
+		assert.ErrorIs(t, err, ErrCloudDisabled)
+		_, err = cloud.HTTPClient()
+		assert.ErrorIs(t, err, ErrCloudDisabled)
+		assert.True(t, cloud.NoLogin())
+	})
+
+	t.Run("default", func(t *testing.T) {
+		cloud := Cloud{}
+		cfg, err := cloud.TLSConfig("cloud.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "cloud.example.com", cfg.ServerName)
+		assert.Nil(t, cfg.RootCAs)
+		assert.False(t, cloud.NoLogin())
+	})
+
+	t.Run("custom CA", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "Test CA"},
+			NotBefore:             time.Now(),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+		require.NoError(t, err)
+		caFile := filepath.Join(dir, "ca.pem")
+		require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+
+		cloud := Cloud{CACertFile: caFile}
+		cfg, err := cloud.TLSConfig("cloud.example.com")
+		require.NoError(t, err)
+		require.NotNil(t, cfg.RootCAs)
+		hc, err := cloud.HTTPClient()
+		require.NoError(t, err)
+		assert.NotNil(t, hc.Transport)
+	})
+
+	t.Run("invalid CA", func(t *testing.T) {
+		caFile := filepath.Join(dir, "invalid.pem")
+		require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+		cloud := Cloud{CACertFile: caFile}
+		_, err := cloud.TLSConfig("cloud.example.com")
+		assert.Error(t, err)
+		cloud.CACertFile = filepath.Join(dir, "missing.pem")
+		_, err = cloud.TLSConfig("cloud.example.com")
+		assert.Error(t, err)
+	})
+}
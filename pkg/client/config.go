@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 	"unsafe"
@@ -16,11 +18,15 @@ import (
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+	"github.com/telepresenceio/telepresence/v2/pkg/log"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
 )
 
 const configFile = "config.yml"
@@ -34,6 +40,11 @@ type Config struct {
 	Grpc            Grpc            `json:"grpc,omitempty" yaml:"grpc,omitempty"`
 	TelepresenceAPI TelepresenceAPI `json:"telepresenceAPI,omitempty" yaml:"telepresenceAPI,omitempty"`
 	Intercept       Intercept       `json:"intercept,omitempty" yaml:"intercept,omitempty"`
+	DNS             DNS             `json:"dns,omitempty" yaml:"dns,omitempty"`
+	Routing         Routing         `json:"routing,omitempty" yaml:"routing,omitempty"`
+	Limits          Limits          `json:"limits,omitempty" yaml:"limits,omitempty"`
+	Tunnel          Tunnel          `json:"tunnel,omitempty" yaml:"tunnel,omitempty"`
+	Cluster         Cluster         `json:"cluster,omitempty" yaml:"cluster,omitempty"`
 }
 
 // Merge merges this instance with the non-zero values of the given argument. The argument values take priority.
@@ -45,6 +56,11 @@ func (c *Config) Merge(o *Config) {
 	c.Grpc.merge(&o.Grpc)
 	c.TelepresenceAPI.merge(&o.TelepresenceAPI)
 	c.Intercept.merge(&o.Intercept)
+	c.DNS.merge(&o.DNS)
+	c.Routing.merge(&o.Routing)
+	c.Limits.merge(&o.Limits)
+	c.Tunnel.merge(&o.Tunnel)
+	c.Cluster.merge(&o.Cluster)
 }
 
 // Watch uses a file system watcher that receives events when the configuration changes
@@ -125,6 +141,16 @@ func (c *Config) UnmarshalYAML(node *yaml.Node) error {
 			err = ms[i+1].Decode(&c.TelepresenceAPI)
 		case kv == "intercept":
 			err = ms[i+1].Decode(&c.Intercept)
+		case kv == "dns":
+			err = ms[i+1].Decode(&c.DNS)
+		case kv == "routing":
+			err = ms[i+1].Decode(&c.Routing)
+		case kv == "limits":
+			err = ms[i+1].Decode(&c.Limits)
+		case kv == "tunnel":
+			err = ms[i+1].Decode(&c.Tunnel)
+		case kv == "cluster":
+			err = ms[i+1].Decode(&c.Cluster)
 		case parseContext != nil:
 			dlog.Warn(parseContext, withLoc(fmt.Sprintf("unknown key %q", kv), ms[i]))
 		}
@@ -441,6 +467,10 @@ func (t *Timeouts) merge(o *Timeouts) {
 type LogLevels struct {
 	UserDaemon logrus.Level `json:"userDaemon,omitempty" yaml:"userDaemon,omitempty"`
 	RootDaemon logrus.Level `json:"rootDaemon,omitempty" yaml:"rootDaemon,omitempty"`
+
+	// LogFormat is the format of the daemon logs, and of the logs of the traffic-agents that the
+	// connector installs. Either "text" (the default) or "json".
+	LogFormat string `json:"logFormat,omitempty" yaml:"logFormat,omitempty"`
 }
 
 // UnmarshalYAML parses the logrus log-levels
@@ -457,6 +487,13 @@ func (ll *LogLevels) UnmarshalYAML(node *yaml.Node) (err error) {
 			return err
 		}
 		v := ms[i+1]
+		if kv == "logFormat" {
+			if err := log.ValidateFormat(v.Value); err != nil {
+				return errors.New(withLoc(err.Error(), v))
+			}
+			ll.LogFormat = v.Value
+			continue
+		}
 		level, err := logrus.ParseLevel(v.Value)
 		if err != nil {
 			return errors.New(withLoc("invalid log-level", v))
@@ -482,6 +519,9 @@ func (ll *LogLevels) merge(o *LogLevels) {
 	if o.RootDaemon != 0 {
 		ll.RootDaemon = o.RootDaemon
 	}
+	if o.LogFormat != "" {
+		ll.LogFormat = o.LogFormat
+	}
 }
 
 type Images struct {
@@ -489,6 +529,7 @@ type Images struct {
 	AgentImage        string `json:"agentImage,omitempty" yaml:"agentImage,omitempty"`
 	WebhookRegistry   string `json:"webhookRegistry,omitempty" yaml:"webhookRegistry,omitempty"`
 	WebhookAgentImage string `json:"webhookAgentImage,omitempty" yaml:"webhookAgentImage,omitempty"`
+	ClientImage       string `json:"clientImage,omitempty" yaml:"clientImage,omitempty"`
 }
 
 // UnmarshalYAML parses the images YAML
@@ -514,6 +555,8 @@ func (img *Images) UnmarshalYAML(node *yaml.Node) (err error) {
 			img.WebhookRegistry = v.Value
 		case "webhookAgentImage":
 			img.WebhookAgentImage = v.Value
+		case "clientImage":
+			img.ClientImage = v.Value
 		default:
 			if parseContext != nil {
 				dlog.Warn(parseContext, withLoc(fmt.Sprintf("unknown key %q", kv), ms[i]))
@@ -536,6 +579,9 @@ func (i *Images) merge(o *Images) {
 	if o.WebhookRegistry != "" {
 		i.WebhookRegistry = o.WebhookRegistry
 	}
+	if o.ClientImage != "" {
+		i.ClientImage = o.ClientImage
+	}
 }
 
 type Cloud struct {
@@ -543,6 +589,20 @@ type Cloud struct {
 	RefreshMessages time.Duration `json:"refreshMessages,omitempty" yaml:"refreshMessages,omitempty"`
 	SystemaHost     string        `json:"systemaHost,omitempty" yaml:"systemaHost,omitempty"`
 	SystemaPort     string        `json:"systemaPort,omitempty" yaml:"systemaPort,omitempty"`
+
+	// Disabled prevents all interactions with Ambassador Cloud, e.g. in air-gapped environments.
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+
+	// CACertFile is the path of a PEM file with additional certificate authorities that are trusted
+	// when talking to a self-hosted Ambassador Cloud.
+	CACertFile string `json:"caCertFile,omitempty" yaml:"caCertFile,omitempty"`
+
+	// OIDCIssuer is the URL of an OpenID Connect issuer that replaces the Ambassador Cloud auth backend
+	// during login. Its endpoints are found using OpenID Connect discovery.
+	OIDCIssuer string `json:"oidcIssuer,omitempty" yaml:"oidcIssuer,omitempty"`
+
+	// OIDCClientID is the client ID that Telepresence uses when logging in with the OIDCIssuer.
+	OIDCClientID string `json:"oidcClientID,omitempty" yaml:"oidcClientID,omitempty"`
 }
 
 // UnmarshalYAML parses the images YAML
@@ -578,6 +638,19 @@ func (cloud *Cloud) UnmarshalYAML(node *yaml.Node) (err error) {
 			cloud.SystemaHost = v.Value
 		case "systemaPort":
 			cloud.SystemaPort = v.Value
+		case "disabled":
+			val, err := strconv.ParseBool(v.Value)
+			if err != nil {
+				dlog.Warn(parseContext, withLoc(fmt.Sprintf("bool expected for key %q", kv), ms[i]))
+			} else {
+				cloud.Disabled = val
+			}
+		case "caCertFile":
+			cloud.CACertFile = v.Value
+		case "oidcIssuer":
+			cloud.OIDCIssuer = v.Value
+		case "oidcClientID":
+			cloud.OIDCClientID = v.Value
 		default:
 			if parseContext != nil {
 				dlog.Warn(parseContext, withLoc(fmt.Sprintf("unknown key %q", kv), ms[i]))
@@ -606,6 +679,18 @@ func (cloud Cloud) MarshalYAML() (interface{}, error) {
 	if cloud.SystemaPort != "" && cloud.SystemaPort != defaultCloudSystemAPort {
 		cm["systemaPort"] = cloud.SystemaPort
 	}
+	if cloud.Disabled {
+		cm["disabled"] = true
+	}
+	if cloud.CACertFile != "" {
+		cm["caCertFile"] = cloud.CACertFile
+	}
+	if cloud.OIDCIssuer != "" {
+		cm["oidcIssuer"] = cloud.OIDCIssuer
+	}
+	if cloud.OIDCClientID != "" {
+		cm["oidcClientID"] = cloud.OIDCClientID
+	}
 	return cm, nil
 }
 
@@ -622,18 +707,37 @@ func (cloud *Cloud) merge(o *Cloud) {
 	if o.SystemaPort != "" {
 		cloud.SystemaPort = o.SystemaPort
 	}
+	if o.Disabled {
+		cloud.Disabled = o.Disabled
+	}
+	if o.CACertFile != "" {
+		cloud.CACertFile = o.CACertFile
+	}
+	if o.OIDCIssuer != "" {
+		cloud.OIDCIssuer = o.OIDCIssuer
+	}
+	if o.OIDCClientID != "" {
+		cloud.OIDCClientID = o.OIDCClientID
+	}
 }
 
 type Grpc struct {
 	// MaxReceiveSize is the maximum message size in bytes the client can receive in a gRPC call or stream message.
 	// Overrides the gRPC default of 4MB.
 	MaxReceiveSize resource.Quantity `json:"maxReceiveSize,omitempty" yaml:"maxReceiveSize,omitempty"`
+
+	// TunnelCompression is the compression used on the tunnel streams between the client, the traffic-manager,
+	// and the traffic-agents. Empty means no compression.
+	TunnelCompression string `json:"tunnelCompression,omitempty" yaml:"tunnelCompression,omitempty"`
 }
 
 func (g *Grpc) merge(o *Grpc) {
 	if !o.MaxReceiveSize.IsZero() {
 		g.MaxReceiveSize = o.MaxReceiveSize
 	}
+	if o.TunnelCompression != "" {
+		g.TunnelCompression = o.TunnelCompression
+	}
 }
 
 // UnmarshalYAML parses the images YAML
@@ -658,6 +762,12 @@ func (g *Grpc) UnmarshalYAML(node *yaml.Node) (err error) {
 			} else {
 				g.MaxReceiveSize = val
 			}
+		case "tunnelCompression":
+			if err := tunnel.CheckCompression(v.Value); err != nil {
+				dlog.Warning(parseContext, withLoc(err.Error(), v))
+			} else {
+				g.TunnelCompression = v.Value
+			}
 		default:
 			if parseContext != nil {
 				dlog.Warn(parseContext, withLoc(fmt.Sprintf("unknown key %q", kv), ms[i]))
@@ -673,6 +783,9 @@ func (g Grpc) MarshalYAML() (interface{}, error) {
 	if !g.MaxReceiveSize.IsZero() {
 		cm["maxReceiveSize"] = g.MaxReceiveSize.String()
 	}
+	if g.TunnelCompression != "" {
+		cm["tunnelCompression"] = g.TunnelCompression
+	}
 	return cm, nil
 }
 
@@ -691,6 +804,20 @@ const defaultInterceptDefaultPort = 8080
 type Intercept struct {
 	AppProtocolStrategy k8sapi.AppProtocolStrategy `json:"appProtocolStrategy,omitempty" yaml:"appProtocolStrategy,omitempty"`
 	DefaultPort         int                        `json:"defaultPort,omitempty" yaml:"defaultPort,omitempty"`
+
+	// AnnotationOnly prevents the workload's containers and its service from being modified when an
+	// agent is installed. The pod template is annotated instead, and the agent is injected by the
+	// traffic-manager's mutating webhook.
+	AnnotationOnly bool `json:"annotationOnly,omitempty" yaml:"annotationOnly,omitempty"`
+
+	// IdentityHeaders maps names of HTTP headers to templates for their values. The headers are added
+	// to each intercepted request to identify the owner of the intercept.
+	IdentityHeaders map[string]string `json:"identityHeaders,omitempty" yaml:"identityHeaders,omitempty"`
+
+	// MountTransport selects how the remote volumes of an intercept are mounted. It's "sshfs", "webdav", or
+	// "auto" (the default), which uses sshfs when it's installed and the WebDAV client of the operating
+	// system otherwise.
+	MountTransport string `json:"mountTransport,omitempty" yaml:"mountTransport,omitempty"`
 }
 
 func (ic *Intercept) merge(o *Intercept) {
@@ -700,6 +827,15 @@ func (ic *Intercept) merge(o *Intercept) {
 	if o.DefaultPort != 0 {
 		ic.DefaultPort = o.DefaultPort
 	}
+	if o.AnnotationOnly {
+		ic.AnnotationOnly = true
+	}
+	if o.MountTransport != "" {
+		ic.MountTransport = o.MountTransport
+	}
+	if len(o.IdentityHeaders) > 0 {
+		ic.IdentityHeaders = o.IdentityHeaders
+	}
 }
 
 // MarshalYAML is not using pointer receiver here, because Intercept is not pointer in the Config struct
@@ -711,9 +847,504 @@ func (ic Intercept) MarshalYAML() (interface{}, error) {
 	if ic.AppProtocolStrategy != k8sapi.Http2Probe {
 		im["appProtocolStrategy"] = ic.AppProtocolStrategy.String()
 	}
+	if ic.AnnotationOnly {
+		im["annotationOnly"] = true
+	}
+	if len(ic.IdentityHeaders) > 0 {
+		im["identityHeaders"] = ic.IdentityHeaders
+	}
+	if ic.MountTransport != "" {
+		im["mountTransport"] = ic.MountTransport
+	}
 	return im, nil
 }
 
+// DNS configures the DNS resolver of the root daemon.
+type DNS struct {
+	// UpstreamResolvers are used, in order, to resolve names that aren't found in the cluster. The
+	// DNS configuration of the system is used when this list is empty.
+	UpstreamResolvers []string `json:"upstreamResolvers,omitempty" yaml:"upstreamResolvers,omitempty"`
+
+	// SuffixResolvers maps domain suffixes to resolvers that are used, in order, for all names
+	// that end with that suffix. Such names are never resolved in the cluster.
+	SuffixResolvers map[string][]string `json:"suffixResolvers,omitempty" yaml:"suffixResolvers,omitempty"`
+
+	// SuffixNamespaces maps domain suffixes to cluster namespaces, so that a name like
+	// <service>.<suffix> is resolved as <service>.<namespace> in the cluster.
+	SuffixNamespaces map[string]string `json:"suffixNamespaces,omitempty" yaml:"suffixNamespaces,omitempty"`
+
+	// LazyNamespaces makes the root daemon add a mapped namespace to the DNS configuration of the
+	// system when a name in it is first queried, instead of adding all mapped namespaces eagerly.
+	LazyNamespaces bool `json:"lazyNamespaces,omitempty" yaml:"lazyNamespaces,omitempty"`
+
+	// NamespaceIdleTimeout is the time after which a lazily added namespace that hasn't been
+	// queried is removed from the DNS configuration of the system again.
+	NamespaceIdleTimeout time.Duration `json:"namespaceIdleTimeout,omitempty" yaml:"namespaceIdleTimeout,omitempty"`
+}
+
+const defaultDNSNamespaceIdleTimeout = 10 * time.Minute
+
+func (d *DNS) merge(o *DNS) {
+	if len(o.UpstreamResolvers) > 0 {
+		d.UpstreamResolvers = o.UpstreamResolvers
+	}
+	if len(o.SuffixResolvers) > 0 {
+		if d.SuffixResolvers == nil {
+			d.SuffixResolvers = make(map[string][]string, len(o.SuffixResolvers))
+		}
+		for sfx, rs := range o.SuffixResolvers {
+			d.SuffixResolvers[sfx] = rs
+		}
+	}
+	if len(o.SuffixNamespaces) > 0 {
+		if d.SuffixNamespaces == nil {
+			d.SuffixNamespaces = make(map[string]string, len(o.SuffixNamespaces))
+		}
+		for sfx, ns := range o.SuffixNamespaces {
+			d.SuffixNamespaces[sfx] = ns
+		}
+	}
+	if o.LazyNamespaces {
+		d.LazyNamespaces = o.LazyNamespaces
+	}
+	if o.NamespaceIdleTimeout != 0 {
+		d.NamespaceIdleTimeout = o.NamespaceIdleTimeout
+	}
+}
+
+// UnmarshalYAML parses the dns YAML
+func (d *DNS) UnmarshalYAML(node *yaml.Node) (err error) {
+	if node.Kind != yaml.MappingNode {
+		return errors.New(withLoc("dns must be an object", node))
+	}
+
+	ms := node.Content
+	top := len(ms)
+	for i := 0; i < top; i += 2 {
+		kv, err := stringKey(ms[i])
+		if err != nil {
+			return err
+		}
+		v := ms[i+1]
+		switch kv {
+		case "upstreamResolvers":
+			if d.UpstreamResolvers, err = decodeResolvers(v); err != nil {
+				return err
+			}
+		case "suffixResolvers":
+			if v.Kind != yaml.MappingNode {
+				return errors.New(withLoc("suffixResolvers must be an object", v))
+			}
+			sms := v.Content
+			d.SuffixResolvers = make(map[string][]string, len(sms)/2)
+			for si := 0; si < len(sms); si += 2 {
+				sfx, err := stringKey(sms[si])
+				if err != nil {
+					return err
+				}
+				sfx = NormalizeDNSSuffix(sfx)
+				if sfx == "" {
+					return errors.New(withLoc("suffix cannot be empty", sms[si]))
+				}
+				if d.SuffixResolvers[sfx], err = decodeResolvers(sms[si+1]); err != nil {
+					return err
+				}
+			}
+		case "suffixNamespaces":
+			var sns map[string]string
+			if err := v.Decode(&sns); err != nil {
+				return errors.New(withLoc("suffixNamespaces must be an object with string values", v))
+			}
+			d.SuffixNamespaces = make(map[string]string, len(sns))
+			for sfx, ns := range sns {
+				sfx = NormalizeDNSSuffix(sfx)
+				if sfx == "" || ns == "" {
+					return errors.New(withLoc("suffix and namespace cannot be empty", v))
+				}
+				d.SuffixNamespaces[sfx] = ns
+			}
+		case "lazyNamespaces":
+			val, err := strconv.ParseBool(v.Value)
+			if err != nil {
+				dlog.Warn(parseContext, withLoc(fmt.Sprintf("bool expected for key %q", kv), ms[i]))
+			} else {
+				d.LazyNamespaces = val
+			}
+		case "namespaceIdleTimeout":
+			duration, err := time.ParseDuration(v.Value)
+			if err != nil || duration <= 0 {
+				dlog.Warn(parseContext, withLoc(fmt.Sprintf("positive duration expected for key %q", kv), ms[i]))
+			} else {
+				d.NamespaceIdleTimeout = duration
+			}
+		default:
+			if parseContext != nil {
+				dlog.Warn(parseContext, withLoc(fmt.Sprintf("unknown key %q", kv), ms[i]))
+			}
+		}
+	}
+	return nil
+}
+
+// NormalizeDNSSuffix returns the given domain suffix in lower case and without leading or
+// trailing dots.
+func NormalizeDNSSuffix(sfx string) string {
+	return strings.ToLower(strings.Trim(sfx, "."))
+}
+
+// decodeResolvers decodes a sequence of resolver addresses. Each address is an IP with an optional
+// port. The returned addresses always include the port.
+func decodeResolvers(node *yaml.Node) ([]string, error) {
+	var as []string
+	if err := node.Decode(&as); err != nil {
+		return nil, errors.New(withLoc("resolvers must be a sequence of strings", node))
+	}
+	for i, a := range as {
+		host, port, err := net.SplitHostPort(a)
+		if err != nil {
+			host = a
+			port = "53"
+		}
+		if net.ParseIP(host) == nil {
+			return nil, errors.New(withLoc(fmt.Sprintf("resolver %q is not an IP address", a), node))
+		}
+		as[i] = net.JoinHostPort(host, port)
+	}
+	return as, nil
+}
+
+// MarshalYAML is not using pointer receiver here, because DNS is not pointer in the Config struct
+func (d DNS) MarshalYAML() (interface{}, error) {
+	dm := make(map[string]interface{})
+	if len(d.UpstreamResolvers) > 0 {
+		dm["upstreamResolvers"] = d.UpstreamResolvers
+	}
+	if len(d.SuffixResolvers) > 0 {
+		dm["suffixResolvers"] = d.SuffixResolvers
+	}
+	if len(d.SuffixNamespaces) > 0 {
+		dm["suffixNamespaces"] = d.SuffixNamespaces
+	}
+	if d.LazyNamespaces {
+		dm["lazyNamespaces"] = true
+	}
+	if d.NamespaceIdleTimeout != 0 && d.NamespaceIdleTimeout != defaultDNSNamespaceIdleTimeout {
+		dm["namespaceIdleTimeout"] = d.NamespaceIdleTimeout.String()
+	}
+	return dm, nil
+}
+
+// SubnetConflictStrategy decides what the root daemon does when a cluster subnet overlaps with a
+// network that the workstation already routes, such as a LAN, a VPN, or a docker bridge.
+type SubnetConflictStrategy int
+
+var scsNames = [...]string{"warn", "exclude", "fail"}
+
+const (
+	// SubnetConflictWarn means report the conflicts and route the cluster subnets anyway (this is
+	// the default behavior).
+	SubnetConflictWarn SubnetConflictStrategy = iota
+
+	// SubnetConflictExclude means report the conflicts and exclude the conflicting local networks
+	// from the cluster subnets, so that they are never routed to the cluster.
+	SubnetConflictExclude
+
+	// SubnetConflictFail means report the conflicts and make the connect fail.
+	SubnetConflictFail
+)
+
+func (scs SubnetConflictStrategy) String() string {
+	return scsNames[scs]
+}
+
+func NewSubnetConflictStrategy(s string) (SubnetConflictStrategy, error) {
+	for i, n := range scsNames {
+		if s == n {
+			return SubnetConflictStrategy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid SubnetConflictStrategy: %q", s)
+}
+
+func (scs SubnetConflictStrategy) MarshalYAML() (interface{}, error) {
+	return scs.String(), nil
+}
+
+func (scs *SubnetConflictStrategy) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	v, err := NewSubnetConflictStrategy(s)
+	if err != nil {
+		return errors.New(withLoc(err.Error(), node))
+	}
+	*scs = v
+	return nil
+}
+
+// Routing configures how the root daemon routes the cluster subnets.
+type Routing struct {
+	// SubnetConflictStrategy decides what happens when a cluster subnet overlaps with a local network.
+	SubnetConflictStrategy SubnetConflictStrategy `json:"subnetConflictStrategy,omitempty" yaml:"subnetConflictStrategy,omitempty"`
+
+	// VirtualSubnet is the subnet that virtual IPs are allocated from.
+	VirtualSubnet *iputil.Subnet `json:"virtualSubnet,omitempty" yaml:"virtualSubnet,omitempty"`
+}
+
+const defaultRoutingVirtualSubnet = "211.55.0.0/16"
+
+func defaultVirtualSubnet() *iputil.Subnet {
+	_, sn, _ := net.ParseCIDR(defaultRoutingVirtualSubnet)
+	return (*iputil.Subnet)(sn)
+}
+
+func (r *Routing) merge(o *Routing) {
+	if o.SubnetConflictStrategy != SubnetConflictWarn {
+		r.SubnetConflictStrategy = o.SubnetConflictStrategy
+	}
+	if o.VirtualSubnet != nil {
+		r.VirtualSubnet = o.VirtualSubnet
+	}
+}
+
+// MarshalYAML is not using pointer receiver here, because Routing is not pointer in the Config struct
+func (r Routing) MarshalYAML() (interface{}, error) {
+	rm := make(map[string]interface{})
+	if r.SubnetConflictStrategy != SubnetConflictWarn {
+		rm["subnetConflictStrategy"] = r.SubnetConflictStrategy.String()
+	}
+	if r.VirtualSubnet != nil && (*net.IPNet)(r.VirtualSubnet).String() != defaultRoutingVirtualSubnet {
+		rm["virtualSubnet"] = r.VirtualSubnet
+	}
+	return rm, nil
+}
+
+// Limits bounds the resources that the root daemon uses for the connections that it routes to the cluster.
+// A zero value means no limit.
+type Limits struct {
+	// MaxConnections is the maximum number of TCP and UDP connections that the root daemon routes at the
+	// same time. New connections are held back until other connections close.
+	MaxConnections int `json:"maxConnections,omitempty" yaml:"maxConnections,omitempty"`
+
+	// MaxBufferedData is the maximum amount of memory used by packets that are queued for the connections.
+	// Packets that would exceed it are dropped, which makes the local peers slow down and resend them.
+	MaxBufferedData resource.Quantity `json:"maxBufferedData,omitempty" yaml:"maxBufferedData,omitempty"`
+}
+
+func (l *Limits) merge(o *Limits) {
+	if o.MaxConnections != 0 {
+		l.MaxConnections = o.MaxConnections
+	}
+	if !o.MaxBufferedData.IsZero() {
+		l.MaxBufferedData = o.MaxBufferedData
+	}
+}
+
+// UnmarshalYAML parses the limits YAML
+func (l *Limits) UnmarshalYAML(node *yaml.Node) (err error) {
+	if node.Kind != yaml.MappingNode {
+		return errors.New(withLoc("limits must be an object", node))
+	}
+
+	ms := node.Content
+	top := len(ms)
+	for i := 0; i < top; i += 2 {
+		kv, err := stringKey(ms[i])
+		if err != nil {
+			return err
+		}
+		v := ms[i+1]
+		switch kv {
+		case "maxConnections":
+			val, err := strconv.Atoi(v.Value)
+			if err != nil || val < 0 {
+				dlog.Warn(parseContext, withLoc(fmt.Sprintf("non-negative integer expected for key %q", kv), ms[i]))
+			} else {
+				l.MaxConnections = val
+			}
+		case "maxBufferedData":
+			val, err := resource.ParseQuantity(v.Value)
+			if err != nil || val.Sign() < 0 {
+				dlog.Warningf(parseContext, "unable to parse quantity %q: %v", v.Value, withLoc(fmt.Sprintf("non-negative quantity expected for key %q", kv), ms[i]))
+			} else {
+				l.MaxBufferedData = val
+			}
+		default:
+			if parseContext != nil {
+				dlog.Warn(parseContext, withLoc(fmt.Sprintf("unknown key %q", kv), ms[i]))
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalYAML is not using pointer receiver here, because Limits is not pointer in the Config struct
+func (l Limits) MarshalYAML() (interface{}, error) {
+	lm := make(map[string]interface{})
+	if l.MaxConnections != 0 {
+		lm["maxConnections"] = l.MaxConnections
+	}
+	if !l.MaxBufferedData.IsZero() {
+		lm["maxBufferedData"] = l.MaxBufferedData.String()
+	}
+	return lm, nil
+}
+
+// Tunnel controls how long the connections that are tunneled between the client and the cluster remain open when
+// idle. A zero value means that the default is used.
+type Tunnel struct {
+	// TCPIdleTimeout is how long a tunneled TCP connection may be idle before it's closed.
+	TCPIdleTimeout time.Duration `json:"tcpIdleTimeout,omitempty" yaml:"tcpIdleTimeout,omitempty"`
+
+	// UDPIdleTimeout is how long a tunneled UDP connection may be idle before it's closed.
+	UDPIdleTimeout time.Duration `json:"udpIdleTimeout,omitempty" yaml:"udpIdleTimeout,omitempty"`
+
+	// KeepAlive is the interval at which the client tells the other end of the tunnel that an idle connection is
+	// still alive, and at which TCP keep-alive probes are sent on the connections that the client dials.
+	KeepAlive time.Duration `json:"keepAlive,omitempty" yaml:"keepAlive,omitempty"`
+}
+
+func (tn *Tunnel) merge(o *Tunnel) {
+	if o.TCPIdleTimeout != 0 {
+		tn.TCPIdleTimeout = o.TCPIdleTimeout
+	}
+	if o.UDPIdleTimeout != 0 {
+		tn.UDPIdleTimeout = o.UDPIdleTimeout
+	}
+	if o.KeepAlive != 0 {
+		tn.KeepAlive = o.KeepAlive
+	}
+}
+
+// Timeouts returns the tunnel.Timeouts that corresponds to this configuration.
+func (tn *Tunnel) Timeouts() tunnel.Timeouts {
+	return tunnel.Timeouts{
+		TCPIdle:   tn.TCPIdleTimeout,
+		UDPIdle:   tn.UDPIdleTimeout,
+		KeepAlive: tn.KeepAlive,
+	}
+}
+
+// UnmarshalYAML parses the tunnel YAML
+func (tn *Tunnel) UnmarshalYAML(node *yaml.Node) (err error) {
+	if node.Kind != yaml.MappingNode {
+		return errors.New(withLoc("tunnel must be an object", node))
+	}
+
+	ms := node.Content
+	top := len(ms)
+	for i := 0; i < top; i += 2 {
+		kv, err := stringKey(ms[i])
+		if err != nil {
+			return err
+		}
+		var dp *time.Duration
+		switch kv {
+		case "tcpIdleTimeout":
+			dp = &tn.TCPIdleTimeout
+		case "udpIdleTimeout":
+			dp = &tn.UDPIdleTimeout
+		case "keepAlive":
+			dp = &tn.KeepAlive
+		default:
+			if parseContext != nil {
+				dlog.Warn(parseContext, withLoc(fmt.Sprintf("unknown key %q", kv), ms[i]))
+			}
+			continue
+		}
+		duration, err := time.ParseDuration(ms[i+1].Value)
+		if err != nil || duration <= 0 {
+			dlog.Warn(parseContext, withLoc(fmt.Sprintf("positive duration expected for key %q", kv), ms[i]))
+		} else {
+			*dp = duration
+		}
+	}
+	return nil
+}
+
+// MarshalYAML is not using pointer receiver here, because Tunnel is not pointer in the Config struct
+func (tn Tunnel) MarshalYAML() (interface{}, error) {
+	tm := make(map[string]interface{})
+	if tn.TCPIdleTimeout != 0 {
+		tm["tcpIdleTimeout"] = tn.TCPIdleTimeout.String()
+	}
+	if tn.UDPIdleTimeout != 0 {
+		tm["udpIdleTimeout"] = tn.UDPIdleTimeout.String()
+	}
+	if tn.KeepAlive != 0 {
+		tm["keepAlive"] = tn.KeepAlive.String()
+	}
+	return tm, nil
+}
+
+// Cluster contains settings that concern the cluster that Telepresence connects to.
+type Cluster struct {
+	// ManagerNamespace is the namespace where the traffic-manager is installed and discovered. The
+	// manager.namespace of the kubeconfig extension takes precedence.
+	ManagerNamespace string `json:"managerNamespace,omitempty" yaml:"managerNamespace,omitempty"`
+}
+
+func (cl *Cluster) merge(o *Cluster) {
+	if o.ManagerNamespace != "" {
+		cl.ManagerNamespace = o.ManagerNamespace
+	}
+}
+
+// UnmarshalYAML parses the cluster YAML
+func (cl *Cluster) UnmarshalYAML(node *yaml.Node) (err error) {
+	if node.Kind != yaml.MappingNode {
+		return errors.New(withLoc("cluster must be an object", node))
+	}
+
+	ms := node.Content
+	top := len(ms)
+	for i := 0; i < top; i += 2 {
+		kv, err := stringKey(ms[i])
+		if err != nil {
+			return err
+		}
+		v := ms[i+1]
+		switch kv {
+		case "managerNamespace":
+			if errs := validation.IsDNS1123Label(v.Value); len(errs) > 0 {
+				dlog.Warn(parseContext, withLoc(fmt.Sprintf("invalid namespace %q for key %q: %s", v.Value, kv, strings.Join(errs, ", ")), ms[i]))
+			} else {
+				cl.ManagerNamespace = v.Value
+			}
+		default:
+			if parseContext != nil {
+				dlog.Warn(parseContext, withLoc(fmt.Sprintf("unknown key %q", kv), ms[i]))
+			}
+		}
+	}
+	return nil
+}
+
+// defaultManagerNamespace is the manager namespace used when neither the config nor the environment has one
+const defaultManagerNamespace = "ambassador"
+
+// GetManagerNamespace returns the cluster.managerNamespace of the config in the given context. The
+// TELEPRESENCE_MANAGER_NAMESPACE environment variable is used when the context has no config.
+func GetManagerNamespace(ctx context.Context) string {
+	if cfg := GetConfig(ctx); cfg != nil && cfg.Cluster.ManagerNamespace != "" {
+		return cfg.Cluster.ManagerNamespace
+	}
+	if env := GetEnv(ctx); env != nil && env.ManagerNamespace != "" {
+		return env.ManagerNamespace
+	}
+	return defaultManagerNamespace
+}
+
+// MarshalYAML is not using pointer receiver here, because Cluster is not pointer in the Config struct
+func (cl Cluster) MarshalYAML() (interface{}, error) {
+	cm := make(map[string]interface{})
+	if cl.ManagerNamespace != "" {
+		cm["managerNamespace"] = cl.ManagerNamespace
+	}
+	return cm, nil
+}
+
 var parseContext context.Context
 
 type parsedFile struct{}
@@ -754,6 +1385,21 @@ func GetConfigFile(c context.Context) string {
 	return filepath.Join(dir, configFile)
 }
 
+// GetConfigFiles returns the paths of all config files that LoadConfig reads, in the order that they
+// are merged, i.e. one for each of the filelocation.AppSystemConfigDirs followed by the one returned
+// by GetConfigFile. The files may not exist.
+func GetConfigFiles(c context.Context) ([]string, error) {
+	dirs, err := filelocation.AppSystemConfigDirs(c)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(dirs)+1)
+	for _, dir := range dirs {
+		files = append(files, filepath.Join(dir, configFile))
+	}
+	return append(files, GetConfigFile(c)), nil
+}
+
 // GetDefaultConfig returns the default configuration settings
 func GetDefaultConfig(c context.Context) Config {
 	cfg := Config{
@@ -784,12 +1430,19 @@ func GetDefaultConfig(c context.Context) Config {
 		Intercept: Intercept{
 			DefaultPort: defaultInterceptDefaultPort,
 		},
+		DNS: DNS{
+			NamespaceIdleTimeout: defaultDNSNamespaceIdleTimeout,
+		},
+		Routing: Routing{
+			VirtualSubnet: defaultVirtualSubnet(),
+		},
 	}
 	if env := GetEnv(c); env != nil {
 		cfg.Images.Registry = env.Registry
 		cfg.Images.WebhookRegistry = env.Registry
 		cfg.Images.AgentImage = env.AgentImage
 		cfg.Images.WebhookAgentImage = env.AgentImage
+		cfg.Cluster.ManagerNamespace = env.ManagerNamespace
 	}
 	return cfg
 }
@@ -841,13 +1494,15 @@ func LoadConfig(c context.Context) (cfg *Config, err error) {
 		}
 	}
 	appDir, err := filelocation.AppUserConfigDir(c)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return cfg, nil
+	switch {
+	case err == nil:
+		if err = readMerge(appDir); err != nil {
+			return nil, err
 		}
+	case !os.IsNotExist(err):
 		return nil, err
 	}
-	if err = readMerge(appDir); err != nil {
+	if err = applyEnvOverrides(c, cfg); err != nil {
 		return nil, err
 	}
 
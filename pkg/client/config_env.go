@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+const configEnvPrefix = "TELEPRESENCE_"
+
+// ConfigEnvName returns the name of the environment variable that overrides the config value with the
+// given dotted key, e.g. TELEPRESENCE_TIMEOUTS_AGENTINSTALL for timeouts.agentInstall.
+func ConfigEnvName(key string) string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// applyEnvOverrides parses the value of each environment variable named by ConfigEnvName as YAML and
+// assigns it to the corresponding value of the given Config. Such variables take precedence over all
+// config files. A warning is logged for variables that start with the name of a config section but
+// don't name any of its values, because they are most likely misspelled.
+func applyEnvOverrides(c context.Context, cfg *Config) error {
+	keys := ConfigKeys()
+	known := make(map[string]struct{}, len(keys))
+	sections := make(map[string]struct{})
+	for _, key := range keys {
+		name := ConfigEnvName(key)
+		known[name] = struct{}{}
+		sections[name[:strings.LastIndexByte(name, '_')+1]] = struct{}{}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		data, err := SetConfigValue(nil, key, value)
+		if err == nil {
+			err = yaml.Unmarshal(data, cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+	}
+
+	for _, env := range os.Environ() {
+		name := env[:strings.IndexByte(env, '=')]
+		if _, ok := known[name]; ok {
+			continue
+		}
+		for section := range sections {
+			if strings.HasPrefix(name, section) {
+				dlog.Warnf(c, "environment variable %s doesn't override any config value", name)
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+)
+
+func TestLoadConfig_envOverrides(t *testing.T) {
+	user := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(user, configFile), []byte(`
+timeouts:
+  trafficManagerConnect: 40s
+  apply: 20s
+images:
+  registry: file.example.com
+`), 0600))
+
+	c := dlog.NewTestContext(t, false)
+	c = filelocation.WithAppSystemConfigDirs(c, nil)
+	c = filelocation.WithAppUserConfigDir(c, user)
+	env, err := LoadEnv(c)
+	require.NoError(t, err)
+	c = WithEnv(c, env)
+
+	t.Setenv("TELEPRESENCE_IMAGES_REGISTRY", "env.example.com")
+	t.Setenv("TELEPRESENCE_TIMEOUTS_TRAFFICMANAGERCONNECT", "1m")
+	t.Setenv("TELEPRESENCE_LOGLEVELS_ROOTDAEMON", "trace")
+	t.Setenv("TELEPRESENCE_DNS_UPSTREAMRESOLVERS", "[1.1.1.1]")
+	cfg, err := LoadConfig(c)
+	require.NoError(t, err)
+	assert.Equal(t, "env.example.com", cfg.Images.Registry)
+	assert.Equal(t, time.Minute, cfg.Timeouts.PrivateTrafficManagerConnect)
+	assert.Equal(t, 20*time.Second, cfg.Timeouts.PrivateApply)
+	assert.Equal(t, logrus.TraceLevel, cfg.LogLevels.RootDaemon)
+	assert.Equal(t, []string{"1.1.1.1:53"}, cfg.DNS.UpstreamResolvers)
+
+	t.Setenv("TELEPRESENCE_TIMEOUTS_APPLY", "soon")
+	_, err = LoadConfig(c)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TELEPRESENCE_TIMEOUTS_APPLY")
+}
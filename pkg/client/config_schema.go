@@ -0,0 +1,345 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UnknownKey is a key that was found where no such key is expected.
+type UnknownKey struct {
+	// Line is the line of the key in the parsed document
+	Line int
+
+	// Key is the dotted path of the key, e.g. "timeouts.agentInstal"
+	Key string
+
+	// Suggestion is the dotted path of the key that was probably meant, or empty if there is none.
+	Suggestion string
+}
+
+func (u *UnknownKey) String() string {
+	msg := fmt.Sprintf("unknown key %q", u.Key)
+	if u.Suggestion != "" {
+		msg += fmt.Sprintf("; did you mean %q?", u.Suggestion)
+	}
+	return msg
+}
+
+// CheckKeys compares the keys of the mappings in the given YAML node with the field tags of the given
+// type and returns each key that doesn't match a field. The tagName is the name of the struct tag
+// that holds the key, e.g. "yaml" or "json".
+func CheckKeys(node *yaml.Node, t reflect.Type, tagName string) []*UnknownKey {
+	var unknown []*UnknownKey
+	checkKeys(node, t, tagName, "", &unknown)
+	return unknown
+}
+
+func checkKeys(node *yaml.Node, t reflect.Type, tagName, path string, unknown *[]*UnknownKey) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			checkKeys(n, t, tagName, path, unknown)
+		}
+	case yaml.SequenceNode:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, n := range node.Content {
+				checkKeys(n, t.Elem(), tagName, path, unknown)
+			}
+		}
+	case yaml.MappingNode:
+		switch t.Kind() {
+		case reflect.Map:
+			for i := 1; i < len(node.Content); i += 2 {
+				checkKeys(node.Content[i], t.Elem(), tagName, path, unknown)
+			}
+		case reflect.Struct:
+			fields := taggedFields(t, tagName)
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				k := node.Content[i].Value
+				f, ok := fields[k]
+				if !ok {
+					*unknown = append(*unknown, unknownKey(node.Content[i], path, k, fields))
+					continue
+				}
+				checkKeys(node.Content[i+1], f.Type, tagName, joinKey(path, k), unknown)
+			}
+		}
+	}
+}
+
+// taggedFields returns the exported fields of the given struct type, keyed by the name of the given
+// struct tag. Embedded structs contribute their fields.
+func taggedFields(t reflect.Type, tagName string) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for k, ef := range taggedFields(f.Type, tagName) {
+				fields[k] = ef
+			}
+			continue
+		}
+		name := strings.Split(f.Tag.Get(tagName), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func unknownKey(n *yaml.Node, path, key string, fields map[string]reflect.StructField) *UnknownKey {
+	known := make([]string, 0, len(fields))
+	for k := range fields {
+		known = append(known, k)
+	}
+	u := &UnknownKey{Line: n.Line, Key: joinKey(path, key)}
+	if s := suggestKey(key, known); s != "" {
+		u.Suggestion = joinKey(path, s)
+	}
+	return u
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// suggestKey returns the known key that the given key is most likely a misspelling of, or an empty
+// string if no known key is close enough.
+func suggestKey(key string, known []string) string {
+	sort.Strings(known)
+	best := ""
+	bestDist := 3 // at most two edits
+	for _, k := range known {
+		if strings.EqualFold(k, key) {
+			return k
+		}
+		if d := editDistance(strings.ToLower(k), strings.ToLower(key)); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// ValidateConfig validates the given contents of a config.yml file. It returns a description of
+// each unknown key, and an error if the contents cannot be parsed into a Config.
+func ValidateConfig(data []byte) ([]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, u := range CheckKeys(&doc, reflect.TypeOf(Config{}), "yaml") {
+		problems = append(problems, fmt.Sprintf("line %d: %s", u.Line, u))
+	}
+	var cfg Config
+	if len(doc.Content) > 0 {
+		if err := doc.Decode(&cfg); err != nil {
+			return problems, err
+		}
+	}
+	return problems, nil
+}
+
+// ConfigKeys returns the dotted keys of all values of the Config, e.g. "timeouts.agentInstall".
+func ConfigKeys() []string {
+	var keys []string
+	for sk, sf := range taggedFields(reflect.TypeOf(Config{}), "yaml") {
+		for vk := range taggedFields(sf.Type, "yaml") {
+			keys = append(keys, sk+"."+vk)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configField returns the section and value fields that the given dotted key refers to. The value
+// field is nil when the key only names a section.
+func configField(key string) (*reflect.StructField, *reflect.StructField, error) {
+	parts := strings.Split(key, ".")
+	if len(parts) <= 2 {
+		sections := taggedFields(reflect.TypeOf(Config{}), "yaml")
+		if sf, ok := sections[parts[0]]; ok {
+			if len(parts) == 1 {
+				return &sf, nil, nil
+			}
+			if vf, ok := taggedFields(sf.Type, "yaml")[parts[1]]; ok {
+				return &sf, &vf, nil
+			}
+		}
+	}
+	u := &UnknownKey{Key: key, Suggestion: suggestKey(key, ConfigKeys())}
+	return nil, nil, errors.New(u.String())
+}
+
+// ConfigValues returns the values of the given Config as a sorted list of "key: value" lines. The
+// list is restricted to one section or one value when a key is given.
+func ConfigValues(cfg *Config, key string) ([]string, error) {
+	keys := ConfigKeys()
+	if key != "" {
+		_, vf, err := configField(key)
+		if err != nil {
+			return nil, err
+		}
+		if vf != nil {
+			keys = []string{key}
+		} else {
+			var sectionKeys []string
+			for _, k := range keys {
+				if strings.HasPrefix(k, key+".") {
+					sectionKeys = append(sectionKeys, k)
+				}
+			}
+			keys = sectionKeys
+		}
+	}
+	cv := reflect.ValueOf(cfg).Elem()
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		sf, vf, _ := configField(k)
+		lines[i] = k + ": " + formatConfigValue(cv.FieldByIndex(sf.Index).FieldByIndex(vf.Index))
+	}
+	return lines, nil
+}
+
+func formatConfigValue(v reflect.Value) string {
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return ""
+		}
+		return s.String()
+	}
+	if v.CanAddr() {
+		if s, ok := v.Addr().Interface().(fmt.Stringer); ok {
+			return s.String()
+		}
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return "{}"
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return "[]"
+		}
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Sprintf("%v", v.Interface())
+	}
+	return string(data)
+}
+
+// SetConfigValue returns the given contents of a config.yml file with the value of the given dotted
+// key replaced by the given value, which is parsed as YAML. Comments and other values in the file
+// are retained. An error is returned if the key is unknown or if the resulting contents aren't a
+// valid configuration.
+func SetConfigValue(data []byte, key, value string) ([]byte, error) {
+	_, vf, err := configField(key)
+	if err != nil {
+		return nil, err
+	}
+	if vf == nil {
+		return nil, fmt.Errorf("%q is a section, not a value", key)
+	}
+	var vn yaml.Node
+	if err = yaml.Unmarshal([]byte(value), &vn); err != nil {
+		return nil, fmt.Errorf("invalid value %q: %w", value, err)
+	}
+	if len(vn.Content) == 0 {
+		return nil, fmt.Errorf("a value must be given for %q", key)
+	}
+
+	var doc yaml.Node
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	n := doc.Content[0]
+	for _, k := range strings.Split(key, ".") {
+		n = mappingValue(n, k)
+	}
+	*n = *vn.Content[0]
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err = enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err = enc.Close(); err != nil {
+		return nil, err
+	}
+	data = buf.Bytes()
+	problems, err := ValidateConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "\n"))
+	}
+	return data, nil
+}
+
+// mappingValue returns the value of the given key in the given mapping node. The key is added if
+// it doesn't exist. A node that isn't a mapping is turned into an empty mapping.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		*n = yaml.Node{Kind: yaml.MappingNode}
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	v := &yaml.Node{Kind: yaml.MappingNode}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	return v
+}
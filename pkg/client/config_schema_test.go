@@ -0,0 +1,74 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+func TestValidateConfig(t *testing.T) {
+	problems, err := ValidateConfig([]byte(`
+timeouts:
+  agentInstal: 2m
+logLevel:
+  userDaemon: debug
+dns:
+  suffixNamespaces:
+    staging.local: staging
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`line 3: unknown key "timeouts.agentInstal"; did you mean "timeouts.agentInstall"?`,
+		`line 4: unknown key "logLevel"; did you mean "logLevels"?`,
+	}, problems)
+
+	_, err = ValidateConfig([]byte("logLevels:\n  userDaemon: chatty\n"))
+	assert.Error(t, err)
+}
+
+func TestSetConfigValue(t *testing.T) {
+	data := []byte("# my settings\ntimeouts:\n  apply: 1m\n")
+	data, err := SetConfigValue(data, "timeouts.agentInstall", "2m30s")
+	require.NoError(t, err)
+	data, err = SetConfigValue(data, "dns.upstreamResolvers", "[1.1.1.1]")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# my settings")
+
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal(data, &cfg))
+	assert.Equal(t, time.Minute, cfg.Timeouts.PrivateApply)
+	assert.Equal(t, 2*time.Minute+30*time.Second, cfg.Timeouts.PrivateAgentInstall)
+	assert.Equal(t, []string{"1.1.1.1:53"}, cfg.DNS.UpstreamResolvers)
+
+	_, err = SetConfigValue(data, "timeouts.agentInstal", "2m")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `did you mean "timeouts.agentInstall"?`)
+
+	_, err = SetConfigValue(data, "routing.subnetConflictStrategy", "ignore")
+	assert.Error(t, err)
+}
+
+func TestConfigValues(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	env, err := LoadEnv(ctx)
+	require.NoError(t, err)
+	ctx = WithEnv(ctx, env)
+	cfg := GetDefaultConfig(ctx)
+
+	lines, err := ConfigValues(&cfg, "routing")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"routing.subnetConflictStrategy: warn", "routing.virtualSubnet: 211.55.0.0/16"}, lines)
+
+	lines, err = ConfigValues(&cfg, "timeouts.helm")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"timeouts.helm: 30s"}, lines)
+
+	_, err = ConfigValues(&cfg, "dns.upstreamResolver")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `did you mean "dns.upstreamResolvers"?`)
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
 )
 
@@ -38,15 +40,42 @@ timeouts:
   proxyDial: 17.0
 logLevels:
   rootDaemon: trace
+  logFormat: json
 images:
   registry: testregistry.io
   agentImage: ambassador-telepresence-client-image:0.0.1
   webhookAgentImage: ambassador-telepresence-webhook-image:0.0.2
+  clientImage: testregistry.io/telepresence:0.0.3
 telepresenceAPI:
   port: 1234
 intercept:
   appProtocolStrategy: portName
   defaultPort: 9080
+  annotationOnly: true
+  identityHeaders:
+    X-Telepresence-Owner: "{{ .Name }}"
+  mountTransport: webdav
+dns:
+  upstreamResolvers:
+    - 1.1.1.1
+    - "[2606:4700:4700::1111]:5353"
+  suffixResolvers:
+    .corp.example.com.: [10.0.0.2]
+  suffixNamespaces:
+    Staging.Local: staging
+  lazyNamespaces: true
+  namespaceIdleTimeout: 5m
+routing:
+  subnetConflictStrategy: exclude
+  virtualSubnet: 100.80.0.0/16
+limits:
+  maxConnections: 5000
+  maxBufferedData: 256Mi
+tunnel:
+  tcpIdleTimeout: 12h
+  keepAlive: 30s
+cluster:
+  managerNamespace: telepresence
 `,
 	}
 
@@ -79,13 +108,38 @@ intercept:
 
 	assert.Equal(t, logrus.DebugLevel, cfg.LogLevels.UserDaemon) // from sys2
 	assert.Equal(t, logrus.TraceLevel, cfg.LogLevels.RootDaemon) // from user
+	assert.Equal(t, "json", cfg.LogLevels.LogFormat)             // from user
 
 	assert.Equal(t, "testregistry.io", cfg.Images.Registry)                                      // from user
 	assert.Equal(t, "ambassador-telepresence-client-image:0.0.1", cfg.Images.AgentImage)         // from user
 	assert.Equal(t, "ambassador-telepresence-webhook-image:0.0.2", cfg.Images.WebhookAgentImage) // from user
+	assert.Equal(t, "testregistry.io/telepresence:0.0.3", cfg.Images.ClientImage)                // from user
 	assert.Equal(t, 1234, cfg.TelepresenceAPI.Port)                                              // from user
 	assert.Equal(t, k8sapi.PortName, cfg.Intercept.AppProtocolStrategy)                          // from user
 	assert.Equal(t, 9080, cfg.Intercept.DefaultPort)                                             // from user
+	assert.True(t, cfg.Intercept.AnnotationOnly)                                                 // from user
+	assert.Equal(t, "webdav", cfg.Intercept.MountTransport)                                      // from user
+	assert.Equal(t, map[string]string{"X-Telepresence-Owner": "{{ .Name }}"}, cfg.Intercept.IdentityHeaders)
+	assert.Equal(t, []string{"1.1.1.1:53", "[2606:4700:4700::1111]:5353"}, cfg.DNS.UpstreamResolvers)
+	assert.Equal(t, map[string][]string{"corp.example.com": {"10.0.0.2:53"}}, cfg.DNS.SuffixResolvers)
+	assert.Equal(t, map[string]string{"staging.local": "staging"}, cfg.DNS.SuffixNamespaces)
+	assert.True(t, cfg.DNS.LazyNamespaces)
+	assert.Equal(t, 5*time.Minute, cfg.DNS.NamespaceIdleTimeout)
+	assert.Equal(t, SubnetConflictExclude, cfg.Routing.SubnetConflictStrategy)
+	assert.Equal(t, "100.80.0.0/16", (*net.IPNet)(cfg.Routing.VirtualSubnet).String())
+	assert.Equal(t, 5000, cfg.Limits.MaxConnections)
+	assert.Equal(t, int64(256<<20), cfg.Limits.MaxBufferedData.Value())
+	assert.Equal(t, 12*time.Hour, cfg.Tunnel.TCPIdleTimeout)
+	assert.Equal(t, time.Duration(0), cfg.Tunnel.UDPIdleTimeout)
+	assert.Equal(t, 30*time.Second, cfg.Tunnel.KeepAlive)
+	assert.Equal(t, "telepresence", cfg.Cluster.ManagerNamespace)
+}
+
+func TestDNS_invalidResolver(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte("dns:\n  upstreamResolvers: [dns.example.com]\n"), &cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `resolver "dns.example.com" is not an IP address`)
 }
 
 func Test_ConfigMarshalYAML(t *testing.T) {
@@ -97,11 +151,28 @@ func Test_ConfigMarshalYAML(t *testing.T) {
 	cfg.Images.AgentImage = "something:else"
 	cfg.Timeouts.PrivateTrafficManagerAPI = defaultTimeoutsTrafficManagerAPI + 20*time.Second
 	cfg.Cloud.RefreshMessages += 10 * time.Minute
+	cfg.Cloud.Disabled = true
+	cfg.Cloud.CACertFile = "/etc/ssl/certs/cloud-ca.pem"
+	cfg.Cloud.OIDCIssuer = "https://idp.example.com/realms/dev"
+	cfg.Cloud.OIDCClientID = "telepresence"
 	cfg.LogLevels.UserDaemon = logrus.TraceLevel
+	cfg.LogLevels.LogFormat = "json"
 	cfg.Grpc.MaxReceiveSize, _ = resource.ParseQuantity("20Mi")
+	cfg.Grpc.TunnelCompression = "gzip"
 	cfg.TelepresenceAPI.Port = 4567
 	cfg.Intercept.AppProtocolStrategy = k8sapi.PortName
 	cfg.Intercept.DefaultPort = 9080
+	cfg.Intercept.AnnotationOnly = true
+	cfg.Intercept.IdentityHeaders = map[string]string{"X-Telepresence-Owner": "{{ .Name }}@{{ .Hostname }}"}
+	cfg.Intercept.MountTransport = "sshfs"
+	cfg.DNS.UpstreamResolvers = []string{"8.8.8.8:53"}
+	cfg.DNS.SuffixResolvers = map[string][]string{"corp.example.com": {"10.0.0.2:53"}}
+	cfg.DNS.SuffixNamespaces = map[string]string{"staging.local": "staging"}
+	cfg.DNS.LazyNamespaces = true
+	cfg.DNS.NamespaceIdleTimeout = 3 * time.Minute
+	cfg.Routing.SubnetConflictStrategy = SubnetConflictFail
+	_, vs, _ := net.ParseCIDR("100.80.0.0/16")
+	cfg.Routing.VirtualSubnet = (*iputil.Subnet)(vs)
 	cfgBytes, err := yaml.Marshal(cfg)
 	require.NoError(t, err)
 
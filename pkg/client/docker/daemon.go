@@ -0,0 +1,400 @@
+// Package docker runs the Telepresence daemons in a container, so that the network of the host stays untouched.
+// The container gets the TUN device, the routes, and the DNS configuration that the root daemon normally applies
+// to the host, and containers that join its network gain access to the cluster.
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/datawire/dlib/dexec"
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cache"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+)
+
+const (
+	// ContainerName is the name of the container that runs the daemons
+	ContainerName = "telepresence-daemons"
+
+	// ConnectorPort is the port, in the container, where the connector's gRPC API is served
+	ConnectorPort = 8981
+
+	// DaemonPort is the port, in the container, where the root daemon's gRPC API is served
+	DaemonPort = 8982
+
+	containerDir        = "/telepresence"
+	containerKubeconfig = containerDir + "/kubeconfig"
+	containerTokenFile  = containerDir + "/token"
+	containerConfigDir  = containerDir + "/config"
+	containerLogDir     = containerDir + "/logs"
+
+	// dockerHost is the name that containers use to reach the host
+	dockerHost = "host.docker.internal"
+)
+
+// Start starts the daemon container unless it's already running, and returns its description. The kubeconfig
+// that is selected by the given kubectl flags is flattened and copied into the container, and the "kubeconfig"
+// flag is removed from the flags, because it refers to a file on the host. The kubeconfig is never written to
+// the file system of the host, and it's removed together with the container.
+// The message about the container being launched is written to infoOutput.
+func Start(ctx context.Context, kubeFlags map[string]string, infoOutput io.Writer) (*cache.DockerDaemon, error) {
+	kubeconfig, err := flatKubeconfig(kubeFlags)
+	if err != nil {
+		return nil, err
+	}
+	delete(kubeFlags, "kubeconfig")
+	if dd := RunningDaemon(ctx); dd != nil {
+		// The connector reads the kubeconfig when it connects, so a running container gets the one of this connect.
+		if err = copySecrets(ctx, kubeconfig, dd.Token); err != nil {
+			return nil, err
+		}
+		return dd, nil
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"run", "--detach", "--rm",
+		"--name", ContainerName,
+		"--cap-add", "NET_ADMIN",
+		"--device", "/dev/net/tun",
+		"--add-host", dockerHost + ":host-gateway",
+		"-p", fmt.Sprintf("127.0.0.1::%d", ConnectorPort),
+		"-p", fmt.Sprintf("127.0.0.1::%d", DaemonPort),
+		"-e", "KUBECONFIG=" + containerKubeconfig,
+		"-e", "DEV_TELEPRESENCE_CONFIG_DIR=" + containerConfigDir,
+		"-e", "DEV_TELEPRESENCE_LOG_DIR=" + containerLogDir,
+	}
+	configDir, err := filelocation.AppUserConfigDir(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(configDir); err == nil {
+		args = append(args, "-v", configDir+":"+containerConfigDir+":ro")
+	}
+
+	// The container logs to a directory of its own, so that the log files of the daemons on the host
+	// don't end up being owned by root.
+	logDir, err := filelocation.AppUserLogDir(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logDir = filepath.Join(logDir, "docker")
+	if err = os.MkdirAll(logDir, 0o700); err != nil {
+		return nil, err
+	}
+	args = append(args, "-v", logDir+":"+containerLogDir, image(ctx), "docker-daemon-foreground")
+
+	fmt.Fprintln(infoOutput, "Launching Telepresence Daemons in container "+ContainerName)
+	if _, err = docker(ctx, args...); err != nil {
+		return nil, errcat.User.Newf("failed to start the daemon container: %w", err)
+	}
+	if err = copySecrets(ctx, kubeconfig, token); err != nil {
+		_, _ = docker(ctx, "stop", ContainerName)
+		return nil, err
+	}
+	dd, err := awaitDaemon(ctx, token)
+	if err != nil {
+		_, _ = docker(ctx, "stop", ContainerName)
+		return nil, err
+	}
+	return dd, nil
+}
+
+// awaitDaemon waits until the connector in the newly started container accepts connections and then saves
+// the description of the container in the user cache.
+func awaitDaemon(ctx context.Context, token string) (*cache.DockerDaemon, error) {
+	dd := &cache.DockerDaemon{Container: ContainerName, Token: token}
+	var err error
+	if dd.ConnectorAddress, err = publishedAddress(ctx, ConnectorPort); err != nil {
+		return nil, err
+	}
+	if dd.DaemonAddress, err = publishedAddress(ctx, DaemonPort); err != nil {
+		return nil, err
+	}
+	tc, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	conn, err := dial(tc, dd.ConnectorAddress, token)
+	if err != nil {
+		return nil, fmt.Errorf("daemon container did not start: %w", err)
+	}
+	_ = conn.Close()
+	if err = cache.SaveDockerDaemonToUserCache(ctx, dd); err != nil {
+		return nil, err
+	}
+	return dd, nil
+}
+
+// Stop stops the daemon container, if one is running, and removes its description from the user cache.
+func Stop(ctx context.Context) error {
+	dd, err := cache.LoadDockerDaemonFromUserCache(ctx)
+	if err != nil || dd == nil {
+		return err
+	}
+	if isRunning(ctx, dd.Container) {
+		if _, err = docker(ctx, "stop", dd.Container); err != nil {
+			return err
+		}
+	}
+	return cache.DeleteDockerDaemonFromUserCache(ctx)
+}
+
+// ContainerExists returns true if the daemon container exists, whether it's running or not.
+func ContainerExists(ctx context.Context) bool {
+	_, err := docker(ctx, "inspect", "--format", "{{.Id}}", ContainerName)
+	return err == nil
+}
+
+// Remove stops and removes the daemon container, and removes its description from the user cache.
+func Remove(ctx context.Context) error {
+	if _, err := docker(ctx, "rm", "--force", ContainerName); err != nil {
+		return err
+	}
+	return cache.DeleteDockerDaemonFromUserCache(ctx)
+}
+
+// RunningDaemon returns the description of the daemon container, or nil if no daemon container is running.
+// The description is removed from the user cache if the container has stopped.
+func RunningDaemon(ctx context.Context) *cache.DockerDaemon {
+	dd, err := cache.LoadDockerDaemonFromUserCache(ctx)
+	if err != nil {
+		dlog.Errorf(ctx, "unable to load the daemon container: %v", err)
+		return nil
+	}
+	if dd == nil {
+		return nil
+	}
+	if isRunning(ctx, dd.Container) {
+		return dd
+	}
+	if err = cache.DeleteDockerDaemonFromUserCache(ctx); err != nil {
+		dlog.Errorf(ctx, "unable to delete the daemon container: %v", err)
+	}
+	return nil
+}
+
+// Dial establishes a gRPC connection to the given address where the daemon container publishes one of
+// its daemons, using the token of the container to authenticate.
+func Dial(ctx context.Context, address, token string) (*grpc.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return dial(ctx, address, token)
+}
+
+func dial(ctx context.Context, address, token string) (*grpc.ClientConn, error) {
+	conn, err := grpc.DialContext(ctx, address,
+		grpc.WithInsecure(),
+		grpc.WithNoProxy(),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", address)
+			if err != nil {
+				return nil, err
+			}
+			// The forwarder in the container relays nothing until it has received the token.
+			if _, err = io.WriteString(conn, token+"\n"); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		}))
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("daemon container is not responding at %s: %w", address, err)
+	}
+	return conn, err
+}
+
+func image(ctx context.Context) string {
+	images := client.GetConfig(ctx).Images
+	if images.ClientImage != "" {
+		return images.ClientImage
+	}
+	return fmt.Sprintf("%s/telepresence:%s", images.Registry, strings.TrimPrefix(client.Version(), "v"))
+}
+
+func isRunning(ctx context.Context, container string) bool {
+	out, err := docker(ctx, "inspect", "--format", "{{.State.Running}}", container)
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// publishedAddress returns the host address where the given port of the daemon container is published.
+func publishedAddress(ctx context.Context, port int) (string, error) {
+	out, err := docker(ctx, "port", ContainerName, fmt.Sprintf("%d/tcp", port))
+	if err != nil {
+		return "", err
+	}
+	return parsePortOutput(out)
+}
+
+// parsePortOutput returns the first address in the output of "docker port".
+func parsePortOutput(out string) (string, error) {
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			_, port, err := net.SplitHostPort(line)
+			if err == nil {
+				_, err = strconv.ParseUint(port, 10, 16)
+			}
+			if err != nil {
+				return "", fmt.Errorf("unable to parse the output of docker port %q: %w", line, err)
+			}
+			return line, nil
+		}
+	}
+	return "", errors.New("docker port returned no address")
+}
+
+func docker(ctx context.Context, args ...string) (string, error) {
+	return dockerWithInput(ctx, nil, args...)
+}
+
+func dockerWithInput(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	cmd := dexec.CommandContext(ctx, "docker", args...)
+	cmd.DisableLogging = true
+	cmd.Stdin = stdin
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *dexec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			err = fmt.Errorf("%s: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// newToken returns the random token that clients must send to the forwarders of a new container.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// copySecrets streams the kubeconfig and the token into the containerDir of the daemon container, so that
+// they never touch the file system of the host, and go away when the container is removed.
+func copySecrets(ctx context.Context, kubeconfig []byte, token string) error {
+	archive, err := secretsArchive(kubeconfig, token)
+	if err != nil {
+		return err
+	}
+	if _, err = dockerWithInput(ctx, bytes.NewReader(archive), "cp", "-", ContainerName+":"+containerDir); err != nil {
+		return errcat.User.Newf("failed to copy the kubeconfig into the daemon container: %w", err)
+	}
+	return nil
+}
+
+// secretsArchive returns the tar archive that copySecrets streams to "docker cp".
+func secretsArchive(kubeconfig []byte, token string) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	now := time.Now()
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{name: path.Base(containerKubeconfig), data: kubeconfig},
+		{name: path.Base(containerTokenFile), data: []byte(token)},
+	} {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.name,
+			Mode:     0o600,
+			Size:     int64(len(f.data)),
+			ModTime:  now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flatKubeconfig returns the kubeconfig context that is selected by the given kubectl flags, with all referenced
+// files inlined.
+func flatKubeconfig(kubeFlags map[string]string) ([]byte, error) {
+	configFlags := genericclioptions.NewConfigFlags(false)
+	flags := pflag.NewFlagSet("", 0)
+	configFlags.AddFlags(flags)
+	for k, v := range kubeFlags {
+		if err := flags.Set(k, v); err != nil {
+			return nil, errcat.User.Newf("error processing kubectl flag --%s=%s: %w", k, v, err)
+		}
+	}
+	config, err := configFlags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err = containerKubeconfigFor(&config, kubeFlags["context"]); err != nil {
+		return nil, err
+	}
+	return clientcmd.Write(config)
+}
+
+// containerKubeconfigFor reduces the given config to the given context, or the current context if the given
+// one is empty, inlines the files that it references, and makes API servers that listen to a loopback
+// address on the host reachable from the container.
+func containerKubeconfigFor(config *api.Config, context string) error {
+	if context != "" {
+		config.CurrentContext = context
+	}
+	if err := api.MinifyConfig(config); err != nil {
+		return errcat.Config.New(err)
+	}
+	if err := api.FlattenConfig(config); err != nil {
+		return errcat.Config.New(err)
+	}
+	for _, cluster := range config.Clusters {
+		u, err := url.Parse(cluster.Server)
+		if err != nil {
+			continue
+		}
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			continue
+		}
+		if port := u.Port(); port != "" {
+			u.Host = net.JoinHostPort(dockerHost, port)
+		} else {
+			u.Host = dockerHost
+		}
+		cluster.Server = u.String()
+		if cluster.TLSServerName == "" && !cluster.InsecureSkipTLSVerify {
+			// The certificate of the API server is issued for the loopback address
+			cluster.TLSServerName = host
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func Test_parsePortOutput(t *testing.T) {
+	addr, err := parsePortOutput("127.0.0.1:49153\n")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:49153", addr)
+
+	addr, err = parsePortOutput("\n127.0.0.1:49154\n[::1]:49154\n")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:49154", addr)
+
+	addr, err = parsePortOutput("[::1]:49155\n")
+	require.NoError(t, err)
+	assert.Equal(t, "[::1]:49155", addr)
+
+	_, err = parsePortOutput("127.0.0.1:http\n")
+	assert.Error(t, err)
+
+	_, err = parsePortOutput("")
+	assert.Error(t, err)
+
+	_, err = parsePortOutput("Error: no public port '8981/tcp' published")
+	assert.Error(t, err)
+}
+
+func Test_containerKubeconfigFor(t *testing.T) {
+	config := api.NewConfig()
+	config.CurrentContext = "remote"
+	config.Clusters["local"] = &api.Cluster{Server: "https://127.0.0.1:6443", CertificateAuthorityData: []byte("ca")}
+	config.Clusters["named"] = &api.Cluster{Server: "https://localhost", InsecureSkipTLSVerify: true}
+	config.Clusters["remote"] = &api.Cluster{Server: "https://k8s.example.com:443"}
+	config.AuthInfos["user"] = &api.AuthInfo{Token: "secret"}
+	for name := range config.Clusters {
+		config.Contexts[name] = &api.Context{Cluster: name, AuthInfo: "user"}
+	}
+
+	c := config.DeepCopy()
+	require.NoError(t, containerKubeconfigFor(c, ""))
+	assert.Len(t, c.Contexts, 1)
+	assert.Equal(t, "https://k8s.example.com:443", c.Clusters["remote"].Server)
+	assert.Empty(t, c.Clusters["remote"].TLSServerName)
+
+	c = config.DeepCopy()
+	require.NoError(t, containerKubeconfigFor(c, "local"))
+	assert.Equal(t, "local", c.CurrentContext)
+	assert.Equal(t, "https://host.docker.internal:6443", c.Clusters["local"].Server)
+	assert.Equal(t, "127.0.0.1", c.Clusters["local"].TLSServerName)
+
+	c = config.DeepCopy()
+	require.NoError(t, containerKubeconfigFor(c, "named"))
+	assert.Equal(t, "https://host.docker.internal", c.Clusters["named"].Server)
+	assert.Empty(t, c.Clusters["named"].TLSServerName)
+
+	assert.Error(t, containerKubeconfigFor(config.DeepCopy(), "nonexistent"))
+}
+
+func Test_checkToken(t *testing.T) {
+	token := []byte("0123456789abcdef")
+	assert.NoError(t, checkToken(strings.NewReader("0123456789abcdef\nPRI * HTTP/2.0"), token))
+	assert.Error(t, checkToken(strings.NewReader("0123456789abcdeX\n"), token))
+	assert.Error(t, checkToken(strings.NewReader("0123456789abcdef0"), token))
+	assert.Error(t, checkToken(strings.NewReader("0123"), token))
+	assert.Error(t, checkToken(strings.NewReader("\n"), nil))
+}
+
+func Test_secretsArchive(t *testing.T) {
+	data, err := secretsArchive([]byte("apiVersion: v1\n"), "0123456789abcdef")
+	require.NoError(t, err)
+	files := map[string]string{}
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, int64(0o600), hdr.Mode, hdr.Name)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(content)
+	}
+	assert.Equal(t, map[string]string{
+		"kubeconfig": "apiVersion: v1\n",
+		"token":      "0123456789abcdef",
+	}, files)
+}
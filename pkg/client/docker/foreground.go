@@ -0,0 +1,146 @@
+package docker
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/dlib/dexec"
+	"github.com/datawire/dlib/dgroup"
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+)
+
+// Command returns the command that the daemon container runs. It starts the root daemon and the connector,
+// and serves their gRPC APIs on TCP ports so that they can be published to the host.
+func Command() *cobra.Command {
+	return &cobra.Command{
+		Use:    "docker-daemon-foreground",
+		Short:  "Launch the Telepresence daemons in the foreground of a container (debug)",
+		Args:   cobra.NoArgs,
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runDaemons(cmd.Context())
+		},
+	}
+}
+
+// tokenTimeout is how long a forwarder waits for the token of a new connection.
+const tokenTimeout = 5 * time.Second
+
+func runDaemons(ctx context.Context) error {
+	logDir, err := filelocation.AppUserLogDir(ctx)
+	if err != nil {
+		return err
+	}
+	configDir, err := filelocation.AppUserConfigDir(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The container ends when either daemon ends, which happens when the connector is told to quit.
+	g := dgroup.NewGroup(ctx, dgroup.GroupConfig{
+		EnableSignalHandling: true,
+		ShutdownOnNonError:   true,
+	})
+	exe := client.GetExe()
+	g.Go("daemon", func(ctx context.Context) error {
+		return runProcess(ctx, exe, "daemon-foreground", logDir, configDir)
+	})
+	g.Go("connector", func(ctx context.Context) error {
+		return runProcess(ctx, exe, "connector-foreground")
+	})
+	g.Go("daemon-forward", func(ctx context.Context) error {
+		return forward(ctx, DaemonPort, client.DaemonSocketName)
+	})
+	g.Go("connector-forward", func(ctx context.Context) error {
+		return forward(ctx, ConnectorPort, client.ConnectorSocketName)
+	})
+	return g.Wait()
+}
+
+func runProcess(ctx context.Context, exe string, args ...string) error {
+	cmd := dexec.CommandContext(ctx, exe, args...)
+	cmd.DisableLogging = true
+	return cmd.Run()
+}
+
+// forward accepts connections on the given TCP port and relays them to the given unix socket. The port must
+// listen on the container's network interface for the publishing of it to work, which means that it's also
+// reachable from containers that join the container's network, so each connection must start with the token
+// that was copied into the container when it was started.
+func forward(ctx context.Context, port int, socketName string) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go relay(ctx, conn, socketName)
+	}
+}
+
+func relay(ctx context.Context, conn net.Conn, socketName string) {
+	defer conn.Close()
+	token, err := os.ReadFile(containerTokenFile)
+	if err != nil {
+		dlog.Errorf(ctx, "unable to read token: %v", err)
+		return
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(tokenTimeout))
+	if err = checkToken(conn, token); err != nil {
+		dlog.Errorf(ctx, "rejecting connection from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	sc, err := net.Dial("unix", socketName)
+	if err != nil {
+		dlog.Debugf(ctx, "unable to dial %s: %v", socketName, err)
+		return
+	}
+	defer sc.Close()
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(sc, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, sc)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// checkToken reads the newline terminated token that a connection must start with and compares it
+// to the given token.
+func checkToken(conn io.Reader, token []byte) error {
+	if len(token) == 0 {
+		return errors.New("no token has been configured")
+	}
+	got := make([]byte, len(token)+1)
+	if _, err := io.ReadFull(conn, got); err != nil {
+		return fmt.Errorf("failed to read token: %w", err)
+	}
+	if subtle.ConstantTimeCompare(got[:len(token)], token) != 1 || got[len(token)] != '\n' {
+		return errors.New("invalid token")
+	}
+	return nil
+}
@@ -14,14 +14,40 @@ type categorized struct {
 	category Category
 }
 
+// The values of the categories are passed between the CLI and the daemons, so new categories must be added
+// last.
 const (
 	OK      = Category(iota)
 	User    // User made an error
 	Config  // Errors in config.yml, extensions, or kubeconfig
 	NoLogs  // Other error generated in the CLI process, so no use pointing the user to logs
 	Unknown // Something else. Consult the logs
+	Cluster // The cluster, or the traffic-manager in it, could not be reached or reported an error
+	Daemon  // The root or user daemon could not be started or reached, or failed
+	Cloud   // Ambassador Cloud could not be reached or reported an error
 )
 
+// ExitCode returns the exit code of a process that fails with an error of this category. The exit codes are
+// documented and must not change.
+func (c Category) ExitCode() int {
+	switch c {
+	case OK:
+		return 0
+	case User:
+		return 2
+	case Config:
+		return 3
+	case Cluster:
+		return 4
+	case Daemon:
+		return 5
+	case Cloud:
+		return 6
+	default:
+		return 1
+	}
+}
+
 // New creates a new categorized error based in its argument. The argument
 // can be an error or a string. If it isn't, it will be converted to a string
 // using its '%v' formatter.
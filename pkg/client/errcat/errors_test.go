@@ -0,0 +1,32 @@
+package errcat
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategory_ExitCode(t *testing.T) {
+	assert.Equal(t, 0, OK.ExitCode())
+	assert.Equal(t, 1, Unknown.ExitCode())
+	assert.Equal(t, 1, NoLogs.ExitCode())
+
+	// Each of these categories must have an exit code of its own so that scripts can tell them apart.
+	seen := map[int]Category{1: Unknown}
+	for _, c := range []Category{User, Config, Cluster, Daemon, Cloud} {
+		code := c.ExitCode()
+		prev, dup := seen[code]
+		assert.False(t, dup, "category %d has the same exit code as category %d", c, prev)
+		seen[code] = c
+	}
+}
+
+func TestGetCategory(t *testing.T) {
+	assert.Equal(t, OK, GetCategory(nil))
+	assert.Equal(t, Unknown, GetCategory(errors.New("boom")))
+	err := Cluster.Newf("unable to reach the traffic-manager: %w", errors.New("timeout"))
+	assert.Equal(t, Cluster, GetCategory(err))
+	assert.Equal(t, Cluster, GetCategory(fmt.Errorf("connect failed: %w", err)))
+}
@@ -0,0 +1,78 @@
+// Package keychain stores small secrets in the keychain of the operating system, i.e. the macOS Keychain, the
+// Windows Credential Manager, or a Secret Service such as GNOME Keyring or KWallet on Linux.
+package keychain
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned by Get when the keychain has no secret for the given service and account.
+	ErrNotFound = errors.New("secret not found in keychain")
+
+	// ErrUnavailable is returned when the operating system has no keychain that can be used, e.g. on a
+	// headless Linux machine without a Secret Service.
+	ErrUnavailable = errors.New("no keychain is available")
+)
+
+// Keychain stores secrets that are identified by a service and an account.
+type Keychain interface {
+	// Get returns the secret, or ErrNotFound.
+	Get(ctx context.Context, service, account string) (string, error)
+
+	// Set creates or replaces the secret.
+	Set(ctx context.Context, service, account, secret string) error
+
+	// Delete removes the secret. Deleting a secret that doesn't exist is a no-op.
+	Delete(ctx context.Context, service, account string) error
+}
+
+type keychainKey struct{}
+
+// WithKeychain returns a context that makes Get return the given keychain instead of the one of the
+// operating system.
+func WithKeychain(ctx context.Context, kc Keychain) context.Context {
+	return context.WithValue(ctx, keychainKey{}, kc)
+}
+
+// Get returns the keychain of the given context, or the keychain of the operating system.
+func Get(ctx context.Context) Keychain {
+	if kc, ok := ctx.Value(keychainKey{}).(Keychain); ok {
+		return kc
+	}
+	return osKeychain{}
+}
+
+// InMemory is a Keychain that keeps its secrets in memory. It is intended for tests.
+type InMemory struct {
+	sync.Mutex
+	secrets map[[2]string]string
+}
+
+func (m *InMemory) Get(_ context.Context, service, account string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	if s, ok := m.secrets[[2]string{service, account}]; ok {
+		return s, nil
+	}
+	return "", ErrNotFound
+}
+
+func (m *InMemory) Set(_ context.Context, service, account, secret string) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.secrets == nil {
+		m.secrets = make(map[[2]string]string)
+	}
+	m.secrets[[2]string{service, account}] = secret
+	return nil
+}
+
+func (m *InMemory) Delete(_ context.Context, service, account string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.secrets, [2]string{service, account})
+	return nil
+}
@@ -0,0 +1,77 @@
+package keychain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/datawire/dlib/dexec"
+)
+
+const securityCmd = "/usr/bin/security"
+
+// errSecItemNotFound is the exit code of the security command when an item doesn't exist.
+const errSecItemNotFound = 44
+
+// osKeychain uses the login keychain of macOS through the security command.
+type osKeychain struct{}
+
+func (osKeychain) Get(ctx context.Context, service, account string) (string, error) {
+	cmd := dexec.CommandContext(ctx, securityCmd, "find-generic-password", "-s", service, "-a", account, "-w")
+	// The secret is written to stdout, so it must not be logged.
+	cmd.DisableLogging = true
+	out, err := cmd.Output()
+	if err != nil {
+		return "", securityError(err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func (osKeychain) Set(ctx context.Context, service, account, secret string) error {
+	// The secret is passed on stdin in interactive mode so that it never shows in the process list.
+	if strings.ContainsAny(secret, "\n\"") {
+		return errors.New("secret contains characters that can't be passed to the security command")
+	}
+	cmd := dexec.CommandContext(ctx, securityCmd, "-i")
+	cmd.DisableLogging = true
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -w \"%s\"\n", service, account, secret))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return securityError(err)
+	}
+	if stderr.Len() > 0 {
+		return fmt.Errorf("security add-generic-password: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (osKeychain) Delete(ctx context.Context, service, account string) error {
+	err := dexec.CommandContext(ctx, securityCmd, "delete-generic-password", "-s", service, "-a", account).Run()
+	if err != nil {
+		if err = securityError(err); !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func securityError(err error) error {
+	var ee *dexec.ExitError
+	if errors.As(err, &ee) {
+		if ee.ExitCode() == errSecItemNotFound {
+			return ErrNotFound
+		}
+		if msg := strings.TrimSpace(string(ee.Stderr)); msg != "" {
+			return fmt.Errorf("%s: %s", securityCmd, msg)
+		}
+		return err
+	}
+	if errors.Is(err, dexec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return err
+}
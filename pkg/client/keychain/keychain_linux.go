@@ -0,0 +1,173 @@
+package keychain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	secretsDest       = "org.freedesktop.secrets"
+	secretsPath       = dbus.ObjectPath("/org/freedesktop/secrets")
+	defaultCollection = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	serviceIface      = "org.freedesktop.Secret.Service"
+	collectionIface   = "org.freedesktop.Secret.Collection"
+	itemIface         = "org.freedesktop.Secret.Item"
+	promptIface       = "org.freedesktop.Secret.Prompt"
+	noPrompt          = dbus.ObjectPath("/")
+)
+
+// secret is the Secret struct of the Secret Service API.
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// osKeychain uses the Secret Service API on the session bus, which is implemented by GNOME Keyring, KWallet,
+// and KeePassXC among others.
+type osKeychain struct{}
+
+// secretService is a session with the Secret Service. Secrets are transferred unencrypted, which is safe
+// because the session bus is only accessible to the user.
+type secretService struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+func withSecretService(ctx context.Context, f func(*secretService) error) error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("%w: failed to connect to session bus: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	ss := &secretService{conn: conn}
+	var output dbus.Variant
+	if err = conn.Object(secretsDest, secretsPath).CallWithContext(ctx, serviceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &ss.session); err != nil {
+		return fmt.Errorf("%w: unable to open a Secret Service session: %v", ErrUnavailable, err)
+	}
+	defer conn.Object(secretsDest, ss.session).Call("org.freedesktop.Secret.Session.Close", 0)
+	return f(ss)
+}
+
+func attributes(service, account string) map[string]string {
+	return map[string]string{"service": service, "username": account}
+}
+
+// search returns the unlocked items with the given attributes. Locked items are unlocked first, which may
+// prompt the user.
+func (ss *secretService) search(ctx context.Context, service, account string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	if err := ss.conn.Object(secretsDest, secretsPath).CallWithContext(ctx, serviceIface+".SearchItems", 0, attributes(service, account)).Store(&unlocked, &locked); err != nil {
+		return nil, err
+	}
+	if len(locked) > 0 {
+		if err := ss.unlock(ctx, locked); err != nil {
+			return nil, err
+		}
+		unlocked = append(unlocked, locked...)
+	}
+	return unlocked, nil
+}
+
+func (ss *secretService) unlock(ctx context.Context, objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := ss.conn.Object(secretsDest, secretsPath).CallWithContext(ctx, serviceIface+".Unlock", 0, objects).Store(&unlocked, &prompt); err != nil {
+		return err
+	}
+	return ss.prompt(ctx, prompt)
+}
+
+// prompt runs the given prompt, if any, and waits for it to complete.
+func (ss *secretService) prompt(ctx context.Context, prompt dbus.ObjectPath) error {
+	if prompt == noPrompt {
+		return nil
+	}
+	if err := ss.conn.AddMatchSignalContext(ctx, dbus.WithMatchObjectPath(prompt), dbus.WithMatchInterface(promptIface)); err != nil {
+		return err
+	}
+	signals := make(chan *dbus.Signal, 10)
+	ss.conn.Signal(signals)
+	defer ss.conn.RemoveSignal(signals)
+
+	if err := ss.conn.Object(secretsDest, prompt).CallWithContext(ctx, promptIface+".Prompt", 0, "").Err; err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			_ = ss.conn.Object(secretsDest, prompt).Call(promptIface+".Dismiss", 0).Err
+			return ctx.Err()
+		case sig := <-signals:
+			if sig.Path != prompt || sig.Name != promptIface+".Completed" || len(sig.Body) == 0 {
+				continue
+			}
+			if dismissed, _ := sig.Body[0].(bool); dismissed {
+				return errors.New("the keychain prompt was dismissed")
+			}
+			return nil
+		}
+	}
+}
+
+func (osKeychain) Get(ctx context.Context, service, account string) (value string, err error) {
+	err = withSecretService(ctx, func(ss *secretService) error {
+		items, err := ss.search(ctx, service, account)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return ErrNotFound
+		}
+		var s secret
+		if err = ss.conn.Object(secretsDest, items[0]).CallWithContext(ctx, itemIface+".GetSecret", 0, ss.session).Store(&s); err != nil {
+			return err
+		}
+		value = string(s.Value)
+		return nil
+	})
+	return value, err
+}
+
+func (osKeychain) Set(ctx context.Context, service, account, value string) error {
+	return withSecretService(ctx, func(ss *secretService) error {
+		if err := ss.unlock(ctx, []dbus.ObjectPath{defaultCollection}); err != nil {
+			return err
+		}
+		props := map[string]dbus.Variant{
+			itemIface + ".Label":      dbus.MakeVariant(fmt.Sprintf("%s (%s)", service, account)),
+			itemIface + ".Attributes": dbus.MakeVariant(attributes(service, account)),
+		}
+		s := secret{Session: ss.session, Value: []byte(value), ContentType: "text/plain; charset=utf8"}
+		var item, prompt dbus.ObjectPath
+		err := ss.conn.Object(secretsDest, defaultCollection).CallWithContext(ctx, collectionIface+".CreateItem", 0, props, s, true).Store(&item, &prompt)
+		if err != nil {
+			return err
+		}
+		return ss.prompt(ctx, prompt)
+	})
+}
+
+func (osKeychain) Delete(ctx context.Context, service, account string) error {
+	return withSecretService(ctx, func(ss *secretService) error {
+		items, err := ss.search(ctx, service, account)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			var prompt dbus.ObjectPath
+			if err = ss.conn.Object(secretsDest, item).CallWithContext(ctx, itemIface+".Delete", 0).Store(&prompt); err != nil {
+				return err
+			}
+			if err = ss.prompt(ctx, prompt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
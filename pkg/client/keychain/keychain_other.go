@@ -0,0 +1,23 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package keychain
+
+import (
+	"context"
+)
+
+// osKeychain is unavailable on this platform.
+type osKeychain struct{}
+
+func (osKeychain) Get(context.Context, string, string) (string, error) {
+	return "", ErrUnavailable
+}
+
+func (osKeychain) Set(context.Context, string, string, string) error {
+	return ErrUnavailable
+}
+
+func (osKeychain) Delete(context.Context, string, string) error {
+	return ErrUnavailable
+}
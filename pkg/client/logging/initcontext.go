@@ -29,10 +29,12 @@ func InitContext(ctx context.Context, name string, strategy RotationStrategy) (c
 	logger.SetLevel(logrus.DebugLevel)
 	logger.ReportCaller = false // turned on when level >= logrus.TraceLevel
 
+	timestampFormat := log.TimestampFormat
 	if IsTerminal(int(os.Stdout.Fd())) {
-		logger.Formatter = log.NewFormatter("15:04:05.0000")
+		timestampFormat = "15:04:05.0000"
+		logger.Formatter = log.NewFormatter(timestampFormat)
 	} else {
-		logger.Formatter = log.NewFormatter("2006-01-02 15:04:05.0000")
+		logger.Formatter = log.NewFormatter(timestampFormat)
 		dir, err := filelocation.AppUserLogDir(ctx)
 		if err != nil {
 			return ctx, err
@@ -53,8 +55,9 @@ func InitContext(ctx context.Context, name string, strategy RotationStrategy) (c
 	}
 	ctx = dlog.WithLogger(ctx, dlog.WrapLogrus(logger))
 
-	// Read the config and set the configured level.
+	// Read the config and set the configured format and level.
 	logLevels := client.GetConfig(ctx).LogLevels
+	logger.Formatter = log.NewFormatterFor(logLevels.LogFormat, timestampFormat)
 	level := logrus.InfoLevel
 	if name == "daemon" {
 		level = logLevels.RootDaemon
@@ -66,6 +69,18 @@ func InitContext(ctx context.Context, name string, strategy RotationStrategy) (c
 	return ctx, nil
 }
 
+// isErrorLine returns true if the given line is an entry with level error, written in either the text or
+// the JSON log format.
+func isErrorLine(line []byte) bool {
+	if len(line) > 0 && line[0] == '{' {
+		je, err := log.ParseJSONEntry(line)
+		return err == nil && je.Level == "error"
+	}
+	// XXX: is there a better way to detect error lines?
+	parts := strings.Fields(string(line))
+	return len(parts) > 2 && parts[2] == "error"
+}
+
 func SummarizeLog(ctx context.Context, name string) (string, error) {
 	dir, err := filelocation.AppUserLogDir(ctx)
 	if err != nil {
@@ -82,9 +97,7 @@ func SummarizeLog(ctx context.Context, name string) (string, error) {
 
 	errorCount := 0
 	for scanner.Scan() {
-		// XXX: is there a better way to detect error lines?
-		parts := strings.Fields(scanner.Text())
-		if len(parts) > 2 && parts[2] == "error" {
+		if isErrorLine(scanner.Bytes()) {
 			errorCount++
 		}
 	}
@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -11,12 +12,14 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/datawire/dlib/dlog"
 	"github.com/datawire/dlib/dtime"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+	"github.com/telepresenceio/telepresence/v2/pkg/log"
 )
 
 type dtimeHook struct{}
@@ -190,3 +193,24 @@ func TestInitContext(t *testing.T) {
 		check.Equal(maxFiles, len(files))
 	})
 }
+
+func TestIsErrorLine(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(buf)
+	logger.SetFormatter(log.NewJSONFormatter())
+	logger.WithField("THREAD", "/main").Error("boom")
+	logger.Info("fine")
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	assert.True(t, isErrorLine(lines[0]))
+	assert.False(t, isErrorLine(lines[1]))
+
+	je, err := log.ParseJSONEntry(lines[0])
+	require.NoError(t, err)
+	assert.Equal(t, "main", je.Thread)
+	assert.Equal(t, "boom", je.Message)
+
+	assert.True(t, isErrorLine([]byte("2022-02-02 12:00:00.0000 error   main : boom")))
+	assert.False(t, isErrorLine([]byte("2022-02-02 12:00:00.0000 info    main : fine")))
+}
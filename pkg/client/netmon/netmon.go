@@ -0,0 +1,98 @@
+// Package netmon detects changes to the network of the workstation, such as when it wakes up from sleep, joins
+// another Wi-Fi network, or when a VPN is toggled.
+package netmon
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// DefaultInterval is the interval between two polls of the network interfaces.
+const DefaultInterval = 2 * time.Second
+
+// fingerprint and now are variables so that they can be replaced by tests.
+var (
+	fingerprint = interfacesFingerprint
+	now         = time.Now
+)
+
+// Watch polls the network interfaces with the given interval until the context is done, and calls onChange
+// when they have changed. A change is reported once the interfaces have been stable for one interval, so
+// that a burst of changes, e.g. when a Wi-Fi link goes down and comes up on another network, is reported
+// once. A wall clock that jumps forward also counts as a change, because it means that the workstation was
+// asleep. Interfaces for which ignore returns true are disregarded.
+func Watch(ctx context.Context, interval time.Duration, ignore func(name string) bool, onChange func(context.Context)) {
+	prev, err := fingerprint(ignore)
+	if err != nil {
+		dlog.Errorf(ctx, "unable to list network interfaces: %v", err)
+	}
+	lastPoll := now().Round(0)
+	pending := false
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// The monotonic clock doesn't advance while the workstation sleeps, so the wall clock is used here.
+		t := now().Round(0)
+		if t.Sub(lastPoll) > 3*interval {
+			dlog.Infof(ctx, "the network monitor was suspended for %s", t.Sub(lastPoll).Round(time.Second))
+			pending = true
+		}
+		lastPoll = t
+
+		fp, err := fingerprint(ignore)
+		if err != nil {
+			dlog.Errorf(ctx, "unable to list network interfaces: %v", err)
+			continue
+		}
+		if fp != prev {
+			dlog.Debugf(ctx, "network interfaces changed from %q to %q", prev, fp)
+			prev = fp
+			pending = true
+			continue
+		}
+		if pending {
+			pending = false
+			dlog.Info(ctx, "network change detected")
+			onChange(ctx)
+		}
+	}
+}
+
+// interfacesFingerprint returns a string that identifies the network interfaces that are up, and their
+// addresses.
+func interfacesFingerprint(ignore func(string) bool) (string, error) {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	entries := make([]string, 0, len(ifs))
+	for _, ifc := range ifs {
+		if ifc.Flags&net.FlagUp == 0 || ifc.Flags&net.FlagLoopback != 0 || ignore != nil && ignore(ifc.Name) {
+			continue
+		}
+		addrs, err := ifc.Addrs()
+		if err != nil {
+			return "", err
+		}
+		as := make([]string, len(addrs))
+		for i, addr := range addrs {
+			as[i] = addr.String()
+		}
+		sort.Strings(as)
+		entries = append(entries, ifc.Name+"="+strings.Join(as, ","))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ";"), nil
+}
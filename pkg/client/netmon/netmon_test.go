@@ -0,0 +1,100 @@
+package netmon
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// fakeNetwork replaces the fingerprint and the wall clock with values that the test controls.
+type fakeNetwork struct {
+	sync.Mutex
+	fp       string
+	clockAdd time.Duration
+}
+
+func (f *fakeNetwork) set(fp string, clockAdd time.Duration) {
+	f.Lock()
+	f.fp = fp
+	f.clockAdd += clockAdd
+	f.Unlock()
+}
+
+func (f *fakeNetwork) install(t *testing.T) {
+	fingerprint = func(func(string) bool) (string, error) {
+		f.Lock()
+		defer f.Unlock()
+		return f.fp, nil
+	}
+	now = func() time.Time {
+		f.Lock()
+		defer f.Unlock()
+		return time.Now().Add(f.clockAdd)
+	}
+	t.Cleanup(func() {
+		fingerprint = interfacesFingerprint
+		now = time.Now
+	})
+}
+
+func TestWatch(t *testing.T) {
+	const interval = 10 * time.Millisecond
+	fn := &fakeNetwork{fp: "en0=192.168.1.10/24"}
+	fn.install(t)
+
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	changes := make(chan struct{}, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Watch(ctx, interval, nil, func(context.Context) { changes <- struct{}{} })
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	expectChange := func(msg string) {
+		select {
+		case <-changes:
+		case <-time.After(time.Second):
+			require.FailNow(t, "no change reported", msg)
+		}
+	}
+	expectNoChange := func(msg string) {
+		select {
+		case <-changes:
+			assert.Fail(t, "unexpected change reported", msg)
+		case <-time.After(10 * interval):
+		}
+	}
+
+	expectNoChange("stable network")
+
+	// A change is reported once
+	fn.set("en0=10.0.0.12/24", 0)
+	expectChange("new Wi-Fi network")
+	expectNoChange("stable after Wi-Fi change")
+
+	// A clock that jumps forward means that the workstation was asleep
+	fn.set("en0=10.0.0.12/24", time.Hour)
+	expectChange("wake up from sleep")
+	expectNoChange("stable after sleep")
+}
+
+func Test_interfacesFingerprint(t *testing.T) {
+	all, err := interfacesFingerprint(nil)
+	require.NoError(t, err)
+	none, err := interfacesFingerprint(func(string) bool { return true })
+	require.NoError(t, err)
+	assert.Empty(t, none)
+	again, err := interfacesFingerprint(nil)
+	require.NoError(t, err)
+	assert.Equal(t, all, again)
+}
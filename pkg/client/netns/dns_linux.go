@@ -0,0 +1,90 @@
+package netns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/socks"
+)
+
+// dnsTTL is the time to live of the answers. It's short because the answers aren't cached by the stack.
+const dnsTTL = 5
+
+// resolver resolves a host name into an IP address. It returns an error that wraps socks.ErrHostNotFound
+// when the name doesn't exist.
+type resolver func(ctx context.Context, host string) (net.IP, error)
+
+// serveDNS answers the DNS queries that are read from the given connection until the context is cancelled.
+// Names are resolved using the given resolver, which yields one address, so a query for A or AAAA records is
+// answered with that address when its family matches and without records when it doesn't. Queries for other
+// types are answered without records.
+func serveDNS(ctx context.Context, conn net.PacketConn, resolve resolver) error {
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	for {
+		b := make([]byte, dns.MaxMsgSize)
+		n, addr, err := conn.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			q := new(dns.Msg)
+			if err := q.Unpack(b[:n]); err != nil {
+				dlog.Debugf(ctx, "unable to unpack DNS query from %s: %v", addr, err)
+				return
+			}
+			a, err := answer(ctx, q, resolve).Pack()
+			if err != nil {
+				dlog.Errorf(ctx, "unable to pack DNS answer: %v", err)
+				return
+			}
+			if _, err = conn.WriteTo(a, addr); err != nil && ctx.Err() == nil {
+				dlog.Errorf(ctx, "unable to write DNS answer to %s: %v", addr, err)
+			}
+		}()
+	}
+}
+
+// answer returns the answer to the given query.
+func answer(ctx context.Context, q *dns.Msg, resolve resolver) *dns.Msg {
+	a := new(dns.Msg)
+	a.SetReply(q)
+	a.RecursionAvailable = true
+	if len(q.Question) != 1 {
+		a.Rcode = dns.RcodeFormatError
+		return a
+	}
+	qs := q.Question[0]
+	if qs.Qclass != dns.ClassINET || qs.Qtype != dns.TypeA && qs.Qtype != dns.TypeAAAA {
+		return a
+	}
+	ip, err := resolve(ctx, strings.TrimSuffix(qs.Name, "."))
+	if err != nil {
+		if errors.Is(err, socks.ErrHostNotFound) {
+			a.Rcode = dns.RcodeNameError
+		} else {
+			dlog.Errorf(ctx, "unable to resolve %s: %v", qs.Name, err)
+			a.Rcode = dns.RcodeServerFailure
+		}
+		return a
+	}
+	hdr := dns.RR_Header{Name: qs.Name, Rrtype: qs.Qtype, Class: dns.ClassINET, Ttl: dnsTTL}
+	if ip4 := ip.To4(); ip4 != nil {
+		if qs.Qtype == dns.TypeA {
+			a.Answer = append(a.Answer, &dns.A{Hdr: hdr, A: ip4})
+		}
+	} else if qs.Qtype == dns.TypeAAAA {
+		a.Answer = append(a.Answer, &dns.AAAA{Hdr: hdr, AAAA: ip})
+	}
+	return a
+}
@@ -0,0 +1,29 @@
+// Package netns runs a command with cluster access and without a root daemon. The command runs in a network
+// namespace of an unprivileged user namespace, where the only route leads to a TUN device. The process that
+// starts the command serves the device with the user-space TCP/IP stack of the vif package, and its
+// connections go through the SOCKS5 proxy of a proxy-only session. Names are resolved by the proxy too, so all
+// traffic of the command goes through the cluster. Only supported on Linux.
+package netns
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// commandName is the name of the hidden command that configures the namespace and then runs the command in it.
+const commandName = "netns-foreground"
+
+// Command returns the hidden command that is started in the new namespaces. It configures the network of the
+// namespace, passes the TUN device to the process that started it, and then replaces itself with the command
+// given as its arguments.
+func Command() *cobra.Command {
+	return &cobra.Command{
+		Use:                commandName,
+		Short:              "Configure a network namespace and run a command in it (internal)",
+		Args:               cobra.MinimumNArgs(1),
+		Hidden:             true,
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return initAndExec(cmd.Context(), args)
+		},
+	}
+}
@@ -0,0 +1,244 @@
+package netns
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	//nolint:depguard // The command must be started with the stdio of this process and in new namespaces.
+	"os/exec"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/datawire/dlib/dexec"
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/proc"
+	"github.com/telepresenceio/telepresence/v2/pkg/socks"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif"
+)
+
+var (
+	// tunIP is the address of the TUN device in the namespace. It's in the range that RFC 2544 reserves for
+	// benchmarks, so it's unlikely to be the address of something that the command connects to.
+	tunIP = net.IPv4(198, 18, 0, 1)
+
+	// dnsIP is the address of the name server of the namespace. It's routed to the TUN device like any other
+	// address.
+	dnsIP = net.IPv4(198, 18, 0, 2)
+)
+
+// userNamespaceHint is added to the errors that indicate that unprivileged user namespaces are disabled.
+const userNamespaceHint = "unprivileged user namespaces may be disabled or restricted on this system " +
+	"(see the sysctls kernel.unprivileged_userns_clone, user.max_user_namespaces, and " +
+	"kernel.apparmor_restrict_unprivileged_userns)"
+
+// Run runs the given command in new user, network, and mount namespaces, and serves the network of the
+// namespace using the SOCKS5 proxy at the given address until the command exits. The command runs as the root
+// user of the user namespace, which is this user outside of it.
+func Run(ctx context.Context, proxyAddress, exe string, args ...string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dnsConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer dnsConn.Close()
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	local := os.NewFile(uintptr(fds[0]), "netns")
+	defer local.Close()
+	remote := os.NewFile(uintptr(fds[1]), "netns")
+
+	cmd := exec.CommandContext(ctx, self, append([]string{commandName, exe}, args...)...)
+	cmd.Env = os.Environ()
+	cmd.ExtraFiles = []*os.File{remote}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET | syscall.CLONE_NEWNS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	wait, err := proc.Start(cmd)
+	_ = remote.Close()
+	if err != nil {
+		if errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOSPC) || errors.Is(err, unix.EINVAL) {
+			return errcat.User.Newf("unable to create the namespaces of the command; %s: %v", userNamespaceHint, err)
+		}
+		return err
+	}
+
+	tun, err := receiveFile(local)
+	if err != nil {
+		// The command that configures the namespace has failed, and reported why
+		if werr := wait(); werr != nil {
+			return werr
+		}
+		return err
+	}
+	defer tun.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		resolve := func(ctx context.Context, host string) (net.IP, error) {
+			return socks.Resolve(ctx, proxyAddress, host)
+		}
+		if err := serveDNS(ctx, dnsConn, resolve); err != nil {
+			dlog.Errorf(ctx, "DNS server of the network namespace failed: %v", err)
+		}
+	}()
+	go func() {
+		s := newStack(ctx, tun, proxyAddress, dnsConn.LocalAddr().(*net.UDPAddr))
+		if err := s.run(ctx); err != nil {
+			dlog.Errorf(ctx, "network stack of the network namespace failed: %v", err)
+		}
+	}()
+	return wait()
+}
+
+// initAndExec is called in the new namespaces. It creates the TUN device that all traffic is routed to,
+// makes the name server of the namespace the only name server, passes the TUN device to the process that
+// started it, and then replaces itself with the given command.
+func initAndExec(ctx context.Context, args []string) error {
+	sock := os.NewFile(3, "netns")
+	defer sock.Close()
+
+	dev, err := vif.OpenTun(ctx)
+	if err != nil {
+		if errors.Is(err, unix.EPERM) {
+			return fmt.Errorf("unable to create a TUN device in the network namespace; %s: %w", userNamespaceHint, err)
+		}
+		return fmt.Errorf("unable to create a TUN device in the network namespace: %w", err)
+	}
+	defer dev.Close()
+	for _, ipArgs := range [][]string{
+		{"link", "set", "lo", "up"},
+		{"addr", "add", tunIP.String() + "/32", "dev", dev.Name()},
+		{"route", "add", "default", "dev", dev.Name()},
+	} {
+		cmd := dexec.CommandContext(ctx, "ip", ipArgs...)
+		cmd.DisableLogging = true
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("ip %s: %w: %s", strings.Join(ipArgs, " "), err, bytes.TrimSpace(out))
+		}
+	}
+	if err = configureDNS(); err != nil {
+		return err
+	}
+	if err = unix.Sendmsg(int(sock.Fd()), []byte{0}, unix.UnixRights(int(dev.File.Fd())), nil, 0); err != nil {
+		return fmt.Errorf("unable to pass the TUN device: %w", err)
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	// Neither the device nor the socket may be inherited by the command
+	_ = dev.Close()
+	_ = sock.Close()
+	return syscall.Exec(path, args, os.Environ())
+}
+
+// receiveFile receives the file that initAndExec passes using the given socket.
+func receiveFile(sock *os.File) (*os.File, error) {
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := unix.Recvmsg(int(sock.Fd()), make([]byte, 1), oob, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.New("the network namespace was not configured")
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) != 1 {
+		return nil, errors.New("no TUN device was passed by the network namespace")
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(fds) != 1 {
+		return nil, errors.New("no TUN device was passed by the network namespace")
+	}
+	// A non-blocking file can be closed while a read is pending, which is how the stack is stopped
+	if err = unix.SetNonblock(fds[0], true); err != nil {
+		_ = unix.Close(fds[0])
+		return nil, err
+	}
+	return os.NewFile(uintptr(fds[0]), "tun"), nil
+}
+
+// configureDNS makes the name server of the namespace the only source of DNS answers in the namespace, using
+// bind mounts that are only visible in its mount namespace.
+func configureDNS() error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("unable to make the mounts of the namespace private: %w", err)
+	}
+	if err := bindFile("/etc/resolv.conf", []byte("nameserver "+dnsIP.String()+"\n")); err != nil {
+		return err
+	}
+	// NSS modules like the one of systemd-resolved would bypass the name server, because they don't use the network
+	nss, err := os.ReadFile("/etc/nsswitch.conf")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return bindFile("/etc/nsswitch.conf", hostsFromDNS(nss))
+}
+
+// bindFile mounts a file with the given content on the given file.
+func bindFile(target string, content []byte) error {
+	f, err := os.CreateTemp("", "telepresence-netns-")
+	if err != nil {
+		return err
+	}
+	// The mount keeps the file alive
+	defer os.Remove(f.Name())
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = unix.Mount(f.Name(), target, "", unix.MS_BIND, "")
+	}
+	if err != nil {
+		return fmt.Errorf("unable to replace %s in the namespace: %w", target, err)
+	}
+	return nil
+}
+
+// hostsFromDNS returns the given nsswitch.conf with its hosts database changed so that host names are looked up
+// in /etc/hosts and then using DNS.
+func hostsFromDNS(nss []byte) []byte {
+	const hosts = "hosts: files dns"
+	lines := strings.Split(strings.TrimSuffix(string(nss), "\n"), "\n")
+	found := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "hosts:") {
+			lines[i] = hosts
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, hosts)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
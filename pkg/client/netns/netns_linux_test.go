@@ -0,0 +1,174 @@
+package netns
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/socks"
+)
+
+// echoClientEnv makes the test binary connect to the address in the variable, send a line, and verify that it's
+// echoed, instead of running the tests. The test binary is started that way in a network namespace.
+const echoClientEnv = "NETNS_TEST_ECHO_CLIENT"
+
+func TestMain(m *testing.M) {
+	switch {
+	case len(os.Args) > 1 && os.Args[1] == commandName:
+		if err := initAndExec(context.Background(), os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case os.Getenv(echoClientEnv) != "":
+		if err := echoClient(os.Getenv(echoClientEnv)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func echoClient(addr string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("hello\n")); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if line != "hello\n" {
+		return fmt.Errorf("unexpected echo %q", line)
+	}
+	return nil
+}
+
+// proxyServer starts a proxy that resolves "echo.test" to 10.1.2.3 and forwards all connections to an echo
+// server on this host.
+func proxyServer(ctx context.Context, t *testing.T) string {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = echo.Close() })
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &socks.Server{
+		Resolve: func(_ context.Context, host string) (net.IP, error) {
+			if host == "echo.test" {
+				return net.IPv4(10, 1, 2, 3), nil
+			}
+			return nil, nil
+		},
+		Forward: func(ctx context.Context, conn net.Conn, ip net.IP, port uint16) error {
+			tc, err := net.Dial("tcp", echo.Addr().String())
+			if err != nil {
+				return err
+			}
+			defer tc.Close()
+			go func() {
+				_, _ = io.Copy(tc, conn)
+				_ = tc.(*net.TCPConn).CloseWrite()
+			}()
+			_, err = io.Copy(conn, tc)
+			return err
+		},
+	}
+	go func() { _ = s.Serve(ctx, l) }()
+	return l.Addr().String()
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+	cfg := client.GetDefaultConfig(ctx)
+	ctx = client.WithConfig(ctx, &cfg)
+	if err := Run(ctx, "", "true"); err != nil {
+		t.Skipf("unable to create the namespaces and the TUN device: %v", err)
+	}
+	proxyAddress := proxyServer(ctx, t)
+
+	self, err := os.Executable()
+	require.NoError(t, err)
+	require.NoError(t, os.Setenv(echoClientEnv, "echo.test:8080"))
+	defer os.Unsetenv(echoClientEnv)
+	assert.NoError(t, Run(ctx, proxyAddress, self))
+
+	require.NoError(t, os.Setenv(echoClientEnv, "unknown.test:8080"))
+	assert.Error(t, Run(ctx, proxyAddress, self))
+}
+
+func Test_answer(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	resolve := func(_ context.Context, host string) (net.IP, error) {
+		switch host {
+		case "v4.test":
+			return net.IPv4(10, 0, 0, 1), nil
+		case "v6.test":
+			return net.ParseIP("fd00::1"), nil
+		case "broken.test":
+			return nil, errors.New("proxy unavailable")
+		default:
+			return nil, fmt.Errorf("unable to resolve %q: %w", host, socks.ErrHostNotFound)
+		}
+	}
+	query := func(name string, qtype uint16) *dns.Msg {
+		q := new(dns.Msg)
+		q.SetQuestion(name, qtype)
+		return answer(ctx, q, resolve)
+	}
+
+	a := query("v4.test.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, a.Rcode)
+	require.Len(t, a.Answer, 1)
+	assert.Equal(t, "10.0.0.1", a.Answer[0].(*dns.A).A.String())
+
+	a = query("v4.test.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeSuccess, a.Rcode)
+	assert.Empty(t, a.Answer)
+
+	a = query("v6.test.", dns.TypeAAAA)
+	require.Len(t, a.Answer, 1)
+	assert.Equal(t, "fd00::1", a.Answer[0].(*dns.AAAA).AAAA.String())
+
+	a = query("v4.test.", dns.TypeMX)
+	assert.Equal(t, dns.RcodeSuccess, a.Rcode)
+	assert.Empty(t, a.Answer)
+
+	assert.Equal(t, dns.RcodeNameError, query("unknown.test.", dns.TypeA).Rcode)
+	assert.Equal(t, dns.RcodeServerFailure, query("broken.test.", dns.TypeA).Rcode)
+}
+
+func Test_hostsFromDNS(t *testing.T) {
+	assert.Equal(t,
+		"passwd: files systemd\nhosts: files dns\nnetworks: files\n",
+		string(hostsFromDNS([]byte("passwd: files systemd\nhosts: mymachines resolve [!UNAVAIL=return] files myhostname dns\nnetworks: files\n"))))
+	assert.Equal(t, "passwd: files\nhosts: files dns\n", string(hostsFromDNS([]byte("passwd: files"))))
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package netns
+
+import (
+	"context"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+var errUnsupported = errcat.User.New("running a command in a network namespace is only supported on Linux")
+
+// Run returns an error, because network namespaces are only supported on Linux.
+func Run(context.Context, string, string, ...string) error {
+	return errUnsupported
+}
+
+func initAndExec(context.Context, []string) error {
+	return errUnsupported
+}
@@ -0,0 +1,276 @@
+package netns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
+	"github.com/telepresenceio/telepresence/v2/pkg/socks"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/buffer"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/icmp"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/ip"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/tcp"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/udp"
+)
+
+// stack is the user-space TCP/IP stack that serves the TUN device of a network namespace. TCP connections are
+// terminated by the TCP handlers of the vif package and their streams are connections through the SOCKS5 proxy
+// of the user daemon. DNS queries for the namespace's name server are answered by a local DNS server that
+// resolves names using the proxy. Other UDP datagrams are refused.
+type stack struct {
+	tun          *os.File
+	proxyAddress string
+
+	// dnsAddr is the address of the local DNS server that the queries for dnsIP are sent to
+	dnsAddr *net.UDPAddr
+
+	handlers     *tunnel.Pool
+	bufferBudget *buffer.Budget
+	rndSource    rand.Source
+
+	// closing is 0 while the stack runs and 2 when it has stopped. The TCP handlers read it.
+	closing int32
+
+	dialTimeout      time.Duration
+	roundtripLatency time.Duration
+}
+
+func newStack(ctx context.Context, tun *os.File, proxyAddress string, dnsAddr *net.UDPAddr) *stack {
+	cfg := client.GetConfig(ctx)
+	return &stack{
+		tun:              tun,
+		proxyAddress:     proxyAddress,
+		dnsAddr:          dnsAddr,
+		handlers:         tunnel.NewBoundedPool(cfg.Limits.MaxConnections),
+		bufferBudget:     buffer.NewBudget(cfg.Limits.MaxBufferedData.Value()),
+		rndSource:        rand.NewSource(time.Now().UnixNano()),
+		dialTimeout:      cfg.Timeouts.Get(client.TimeoutEndpointDial),
+		roundtripLatency: cfg.Timeouts.Get(client.TimeoutRoundtripLatency),
+	}
+}
+
+// run reads packets from the TUN device until the context is cancelled or the device is closed.
+func (s *stack) run(ctx context.Context) error {
+	defer func() {
+		atomic.StoreInt32(&s.closing, 2)
+		s.handlers.CloseAll(ctx)
+	}()
+	for {
+		data := buffer.DataPool.Get(buffer.DataPool.MTU)
+		n, err := s.tun.Read(data.Raw())
+		if err != nil {
+			buffer.DataPool.Put(data)
+			if ctx.Err() != nil || errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("read packet error: %w", err)
+		}
+		if n == 0 {
+			buffer.DataPool.Put(data)
+			continue
+		}
+		data.SetLength(n)
+		s.handlePacket(ctx, data)
+	}
+}
+
+func (s *stack) handlePacket(ctx context.Context, data *buffer.Data) {
+	defer func() {
+		if data != nil {
+			buffer.DataPool.Put(data)
+		}
+	}()
+
+	ipHdr, err := ip.ParseHeader(data.Buf())
+	if err != nil {
+		dlog.Error(ctx, "Unable to parse packet header")
+		return
+	}
+	switch ipHdr.L4Protocol() {
+	case ipproto.TCP:
+		s.tcp(ctx, tcp.PacketFromData(ipHdr, data))
+		data = nil
+	case ipproto.UDP:
+		dg := udp.DatagramFromData(ipHdr, data)
+		if !ipHdr.Destination().Equal(dnsIP) || dg.Header().DestinationPort() != 53 {
+			s.reply(ctx, icmp.DestinationUnreachablePacket(ipHdr, icmp.PortUnreachable))
+			return
+		}
+		data = nil
+		s.dns(ctx, dg)
+	case ipproto.ICMP, ipproto.ICMPV6:
+	default:
+		s.reply(ctx, icmp.DestinationUnreachablePacket(ipHdr, icmp.ProtocolUnreachable))
+	}
+}
+
+func (s *stack) reply(ctx context.Context, pkt ip.Packet) {
+	if err := s.Write(ctx, pkt); err != nil {
+		dlog.Errorf(ctx, "TUN write failed: %v", err)
+	}
+}
+
+// Write writes the given packet to the TUN device. It makes the stack an ip.Writer.
+func (s *stack) Write(ctx context.Context, pkt ip.Packet) error {
+	dlog.Tracef(ctx, "-> TUN %s", pkt)
+	_, err := s.tun.Write(pkt.Data().Buf())
+	return err
+}
+
+func (s *stack) tcp(ctx context.Context, pkt tcp.Packet) {
+	ipHdr := pkt.IPHeader()
+	tcpHdr := pkt.Header()
+	connID := tunnel.NewConnID(ipproto.TCP, ipHdr.Source(), ipHdr.Destination(), tcpHdr.SourcePort(), tcpHdr.DestinationPort())
+	dlog.Tracef(ctx, "<- TUN %s", pkt)
+	if !tcpHdr.SYN() {
+		// Only a SYN packet can create a new connection. For all other packets, the connection must already exist
+		if h := s.handlers.Get(connID); h != nil {
+			h.(tcp.PacketHandler).HandlePacket(ctx, pkt)
+		} else {
+			pkt.Release()
+		}
+		return
+	}
+
+	h, _, err := s.handlers.GetOrCreateTCP(ctx, connID, func(ctx context.Context, remove func()) (tunnel.Handler, error) {
+		return tcp.NewHandler(s.streamCreator(connID), &s.closing, s, connID, remove, s.rndSource, s.bufferBudget), nil
+	}, pkt)
+	if err != nil {
+		// Dropping the SYN makes the peer resend it later, when other connections may have closed.
+		if !errors.Is(err, tunnel.ErrPoolFull) {
+			dlog.Error(ctx, err)
+		}
+		pkt.Release()
+		return
+	}
+	h.(tcp.PacketHandler).HandlePacket(ctx, pkt)
+}
+
+func (s *stack) dns(ctx context.Context, dg udp.Datagram) {
+	ipHdr := dg.IPHeader()
+	udpHdr := dg.Header()
+	connID := tunnel.NewConnID(ipproto.UDP, ipHdr.Source(), ipHdr.Destination(), udpHdr.SourcePort(), udpHdr.DestinationPort())
+	h, _, err := s.handlers.GetOrCreate(ctx, connID, func(ctx context.Context, remove func()) (tunnel.Handler, error) {
+		return udp.NewDnsInterceptor(s, connID, remove, s.dnsAddr)
+	})
+	if err != nil {
+		if !errors.Is(err, tunnel.ErrPoolFull) {
+			dlog.Error(ctx, err)
+		}
+		dg.Release()
+		return
+	}
+	h.(udp.DatagramHandler).HandleDatagram(ctx, dg)
+}
+
+// streamCreator returns a creator of a stream that is a connection to the destination of the given ID through
+// the proxy.
+func (s *stack) streamCreator(id tunnel.ConnID) tcp.StreamCreator {
+	return func(ctx context.Context) (tunnel.Stream, error) {
+		dlog.Debugf(ctx, "Opening proxy connection for id %s", id)
+		dc, cancel := context.WithTimeout(ctx, s.dialTimeout)
+		defer cancel()
+		conn, err := socks.Dial(dc, s.proxyAddress, id.Destination(), id.DestinationPort())
+		if err != nil {
+			return nil, err
+		}
+		return newConnStream(ctx, id, conn, s.dialTimeout, s.roundtripLatency), nil
+	}
+}
+
+// connStream is a tunnel.Stream that sends and receives the payload of the messages using a TCP connection.
+// Control messages are discarded.
+type connStream struct {
+	id               tunnel.ConnID
+	conn             *net.TCPConn
+	dialTimeout      time.Duration
+	roundtripLatency time.Duration
+	closeSendOnce    sync.Once
+
+	// buf is the buffer that Receive reads into
+	buf []byte
+}
+
+// newConnStream creates a stream that uses the given connection. The connection is closed when the context
+// is cancelled, which happens when the TCP handler that uses the stream ends.
+func newConnStream(ctx context.Context, id tunnel.ConnID, conn *net.TCPConn, dialTimeout, roundtripLatency time.Duration) *connStream {
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	return &connStream{
+		id:               id,
+		conn:             conn,
+		dialTimeout:      dialTimeout,
+		roundtripLatency: roundtripLatency,
+		buf:              make([]byte, 0x8000),
+	}
+}
+
+func (s *connStream) Tag() string {
+	return "NS"
+}
+
+func (s *connStream) ID() tunnel.ConnID {
+	return s.id
+}
+
+func (s *connStream) Receive(context.Context) (tunnel.Message, error) {
+	for {
+		n, err := s.conn.Read(s.buf)
+		if n > 0 {
+			// The payload is copied, so the buffer can be reused
+			return tunnel.NewMessage(tunnel.Normal, s.buf[:n]), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *connStream) Send(_ context.Context, m tunnel.Message) error {
+	if m.Code() != tunnel.Normal {
+		return nil
+	}
+	_, err := s.conn.Write(m.Payload())
+	return err
+}
+
+// CloseSend half closes the connection. It's called both by the TCP handler and by its write loop.
+func (s *connStream) CloseSend(context.Context) error {
+	var err error
+	s.closeSendOnce.Do(func() {
+		err = s.conn.CloseWrite()
+	})
+	if errors.Is(err, net.ErrClosed) {
+		// The handler has ended and closed the connection
+		return nil
+	}
+	return err
+}
+
+func (s *connStream) PeerVersion() uint16 {
+	return tunnel.Version
+}
+
+func (s *connStream) SessionID() string {
+	return ""
+}
+
+func (s *connStream) DialTimeout() time.Duration {
+	return s.dialTimeout
+}
+
+func (s *connStream) RoundtripLatency() time.Duration {
+	return s.roundtripLatency
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	errorDomain       = "telepresence.io"
+	noTunDeviceReason = "NO_TUN_DEVICE"
+)
+
+// NoTunDeviceError returns the error that the root daemon responds with when it's unable to create the virtual
+// network device. The connector falls back to loopback port-forwards when it gets this error, and only then, so
+// it carries a detail that no other error has. An Unavailable code would be ambiguous, because gRPC uses it when
+// the root daemon can't be reached.
+func NoTunDeviceError(err error) error {
+	st := status.Newf(codes.FailedPrecondition, "unable to create the virtual network device: %v", err)
+	if dst, derr := st.WithDetails(&errdetails.ErrorInfo{Reason: noTunDeviceReason, Domain: errorDomain}); derr == nil {
+		st = dst
+	}
+	return st.Err()
+}
+
+// IsNoTunDeviceError returns true if the given error was created by NoTunDeviceError.
+func IsNoTunDeviceError(err error) bool {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.FailedPrecondition {
+		return false
+	}
+	for _, d := range st.Details() {
+		if ei, ok := d.(*errdetails.ErrorInfo); ok && ei.Reason == noTunDeviceReason && ei.Domain == errorDomain {
+			return true
+		}
+	}
+	return false
+}
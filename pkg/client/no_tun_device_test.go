@@ -0,0 +1,23 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsNoTunDeviceError(t *testing.T) {
+	err := NoTunDeviceError(errors.New("permission denied"))
+	assert.True(t, IsNoTunDeviceError(err))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "permission denied")
+
+	// A daemon that can't be reached, or that refuses to connect for other reasons, isn't mistaken for one without a device
+	assert.False(t, IsNoTunDeviceError(status.Error(codes.Unavailable, "connection refused")))
+	assert.False(t, IsNoTunDeviceError(status.Error(codes.FailedPrecondition, "unable to create the virtual network device")))
+	assert.False(t, IsNoTunDeviceError(errors.New("unable to create the virtual network device")))
+	assert.False(t, IsNoTunDeviceError(nil))
+}
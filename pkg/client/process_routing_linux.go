@@ -0,0 +1,56 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+// CheckProcessRouting returns an error that tells what's missing when the kernel lacks what process routing
+// needs, which is the unified cgroup hierarchy and the cgroup match of iptables.
+func CheckProcessRouting() error {
+	return checkProcessRouting("/")
+}
+
+func checkProcessRouting(root string) error {
+	if _, err := os.Stat(filepath.Join(root, "sys", "fs", "cgroup", "cgroup.controllers")); err != nil {
+		return errcat.User.New("process routing requires the unified cgroup hierarchy (cgroup v2). " +
+			"Boot with systemd.unified_cgroup_hierarchy=1 to enable it")
+	}
+	if !hasCgroupMatch(root) {
+		return errcat.User.New("process routing requires the xt_cgroup kernel module " +
+			"(CONFIG_NETFILTER_XT_MATCH_CGROUP), which this kernel doesn't have")
+	}
+	return nil
+}
+
+// hasCgroupMatch returns false when it's certain that the cgroup match of iptables is unavailable. It's
+// available when it's loaded, when it's built into the kernel, and when it's a module that iptables loads
+// on demand.
+func hasCgroupMatch(root string) bool {
+	if data, err := os.ReadFile(filepath.Join(root, "proc", "net", "ip_tables_matches")); err == nil {
+		for _, m := range strings.Fields(string(data)) {
+			if m == "cgroup" {
+				return true
+			}
+		}
+	}
+	release, err := os.ReadFile(filepath.Join(root, "proc", "sys", "kernel", "osrelease"))
+	if err != nil {
+		return true
+	}
+	dir := filepath.Join(root, "lib", "modules", strings.TrimSpace(string(release)))
+	if _, err = os.Stat(dir); err != nil {
+		// The modules can't be inspected, e.g. in a container
+		return true
+	}
+	for _, f := range []string{"modules.builtin", "modules.dep"} {
+		if data, err := os.ReadFile(filepath.Join(dir, f)); err == nil && bytes.Contains(data, []byte("/xt_cgroup.ko")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkProcessRouting(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		fn := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		require.NoError(t, os.WriteFile(fn, []byte(content), 0644))
+	}
+	remove := func(name string) {
+		require.NoError(t, os.Remove(filepath.Join(root, name)))
+	}
+
+	// No cgroup v2
+	err := checkProcessRouting(root)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cgroup v2")
+
+	// The modules can't be inspected
+	write("sys/fs/cgroup/cgroup.controllers", "cpu memory")
+	write("proc/sys/kernel/osrelease", "5.15.0-1-amd64\n")
+	assert.NoError(t, checkProcessRouting(root))
+
+	// The module is neither loaded, built in, nor loadable
+	write("lib/modules/5.15.0-1-amd64/modules.dep", "kernel/net/netfilter/xt_mark.ko:\n")
+	write("proc/net/ip_tables_matches", "mark\nconntrack\n")
+	err = checkProcessRouting(root)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "xt_cgroup")
+
+	// Loadable module
+	write("lib/modules/5.15.0-1-amd64/modules.dep", "kernel/net/netfilter/xt_cgroup.ko.zst:\n")
+	assert.NoError(t, checkProcessRouting(root))
+
+	// Built in
+	remove("lib/modules/5.15.0-1-amd64/modules.dep")
+	write("lib/modules/5.15.0-1-amd64/modules.builtin", "kernel/net/netfilter/xt_cgroup.ko\n")
+	assert.NoError(t, checkProcessRouting(root))
+
+	// Loaded
+	remove("lib/modules/5.15.0-1-amd64/modules.builtin")
+	write("proc/net/ip_tables_matches", "mark\ncgroup\n")
+	assert.NoError(t, checkProcessRouting(root))
+}
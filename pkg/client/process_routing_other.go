@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package client
+
+import (
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+// CheckProcessRouting returns an error, because process routing is only supported on Linux.
+func CheckProcessRouting() error {
+	return errcat.User.New("process routing is only supported on Linux")
+}
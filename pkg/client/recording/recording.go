@@ -0,0 +1,376 @@
+// Package recording records the HTTP requests that arrive on intercepted connections, and the responses that
+// the local handler sends, to a file that the replay command reads.
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// DefaultMaxBody is the default number of bytes of each body that are recorded.
+const DefaultMaxBody = 64 * 1024
+
+// maxUnparsed is the maximum number of bytes that a connection buffers for a parser that lags behind. The
+// recording of the connection ends when it's exceeded.
+const maxUnparsed = 1024 * 1024
+
+var errOverflow = errors.New("the recording lags too far behind")
+
+// Redacted replaces the values of the headers that carry credentials unless the recorder keeps secrets.
+const Redacted = "<redacted>"
+
+// secretHeaders are the headers that carry credentials, in canonical form.
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// redact returns the given header with the values of the secretHeaders replaced by Redacted.
+func redact(h http.Header) http.Header {
+	for _, k := range secretHeaders {
+		if vs, ok := h[k]; ok {
+			rvs := make([]string, len(vs))
+			for i := range rvs {
+				rvs[i] = Redacted
+			}
+			h[k] = rvs
+		}
+	}
+	return h
+}
+
+// Request is a recorded HTTP request.
+type Request struct {
+	Method        string      `json:"method"`
+	URI           string      `json:"uri"`
+	Proto         string      `json:"proto"`
+	Host          string      `json:"host,omitempty"`
+	Header        http.Header `json:"header,omitempty"`
+	Body          []byte      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"bodyTruncated,omitempty"`
+}
+
+// Response is a recorded HTTP response.
+type Response struct {
+	Status        int         `json:"status"`
+	Header        http.Header `json:"header,omitempty"`
+	Body          []byte      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"bodyTruncated,omitempty"`
+}
+
+// Exchange is a request and the response that the local handler sent. It is written to the recording file as
+// one line of JSON.
+type Exchange struct {
+	Time      time.Time `json:"time"`
+	Intercept string    `json:"intercept"`
+	Target    string    `json:"target"`
+	Request   *Request  `json:"request"`
+	Response  *Response `json:"response,omitempty"`
+}
+
+// Recorder appends the exchanges of the connections that it wraps to a file.
+type Recorder struct {
+	intercept   string
+	path        string
+	maxBody     int64
+	keepSecrets bool
+	mu          sync.Mutex
+}
+
+// NewRecorder returns a recorder that appends the exchanges of the given intercept to the file at the given path,
+// and that records at most maxBody bytes of each body. The values of headers that carry credentials, such as
+// Authorization and Cookie, are recorded as Redacted unless keepSecrets is true.
+func NewRecorder(intercept, path string, maxBody int64, keepSecrets bool) *Recorder {
+	if maxBody < 0 {
+		maxBody = 0
+	}
+	return &Recorder{intercept: intercept, path: path, maxBody: maxBody, keepSecrets: keepSecrets}
+}
+
+// Intercept returns the name of the intercept that the recorder records.
+func (r *Recorder) Intercept() string {
+	return r.intercept
+}
+
+func (r *Recorder) header(h http.Header) http.Header {
+	if r.keepSecrets {
+		return h
+	}
+	return redact(h)
+}
+
+// Path returns the path of the recording file.
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+func (r *Recorder) write(ctx context.Context, ex *Exchange) {
+	data, err := json.Marshal(ex)
+	if err != nil {
+		dlog.Errorf(ctx, "unable to record %s %s: %v", ex.Request.Method, ex.Request.URI, err)
+		return
+	}
+	data = append(data, '\n')
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err == nil {
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		dlog.Errorf(ctx, "unable to record %s %s in %s: %v", ex.Request.Method, ex.Request.URI, r.path, err)
+	}
+}
+
+// Wrap returns a connection that records the exchanges that pass through the given connection, which is a
+// connection to the local handler. The recording is passive, and ends silently when the traffic isn't HTTP/1.x
+// or when the protocol is switched, e.g. to a websocket.
+func (r *Recorder) Wrap(ctx context.Context, conn net.Conn) net.Conn {
+	rc := &recordingConn{Conn: conn, requests: newTee(), responses: newTee()}
+	pending := make(chan *pendingRequest, 16)
+	go r.readRequests(rc.requests, pending)
+	go r.readResponses(ctx, rc.responses, conn.RemoteAddr().String(), pending)
+	return rc
+}
+
+// recordingConn copies what's written to the connection, i.e. the requests, and what's read from it, i.e. the
+// responses, to the tees that the parsers read from.
+type recordingConn struct {
+	net.Conn
+	requests  *tee
+	responses *tee
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.requests.write(b[:n])
+	return n, err
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.responses.write(b[:n])
+	if err != nil {
+		c.responses.close(err)
+	}
+	return n, err
+}
+
+func (c *recordingConn) Close() error {
+	c.requests.close(io.EOF)
+	c.responses.close(io.EOF)
+	return c.Conn.Close()
+}
+
+// tee buffers the data that is copied from a connection until a parser reads it. Writing to it never blocks,
+// so a parser never delays the traffic of the connection. The buffered data is dropped, and the parser gets an
+// error, when the parser lags too far behind.
+type tee struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  bytes.Buffer
+	err  error
+}
+
+func newTee() *tee {
+	t := &tee{}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+func (t *tee) write(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	t.mu.Lock()
+	if t.err == nil {
+		if t.buf.Len()+len(p) > maxUnparsed {
+			t.err = errOverflow
+			t.buf.Reset()
+		} else {
+			t.buf.Write(p)
+		}
+		t.cond.Broadcast()
+	}
+	t.mu.Unlock()
+}
+
+// close makes the parser get the given error once it has read what's buffered.
+func (t *tee) close(err error) {
+	t.mu.Lock()
+	if t.err == nil {
+		t.err = err
+	}
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+func (t *tee) Read(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.buf.Len() == 0 && t.err == nil {
+		t.cond.Wait()
+	}
+	if t.buf.Len() > 0 {
+		return t.buf.Read(p)
+	}
+	return 0, t.err
+}
+
+// stop is called by a parser that gives up.
+func (t *tee) stop() {
+	t.mu.Lock()
+	t.err = io.EOF
+	t.buf.Reset()
+	t.mu.Unlock()
+}
+
+// pendingRequest is a request whose response hasn't been read yet. The bodyRead channel is closed when the
+// body of the request has been read, which may happen after the response was read when the handler responds
+// early, or never when the request was only partly sent.
+type pendingRequest struct {
+	method   string
+	request  *Request
+	bodyRead chan struct{}
+}
+
+func (r *Recorder) readRequests(t *tee, pending chan<- *pendingRequest) {
+	defer close(pending)
+	defer t.stop()
+	br := bufio.NewReader(t)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		p := &pendingRequest{
+			method: req.Method,
+			request: &Request{
+				Method: req.Method,
+				URI:    req.RequestURI,
+				Proto:  req.Proto,
+				Host:   req.Host,
+				Header: r.header(req.Header),
+			},
+			bodyRead: make(chan struct{}),
+		}
+		// The request is pending before its body is read, because a handler that answers "Expect: 100-continue"
+		// sends a response before the body arrives.
+		pending <- p
+		body := limitedBuffer{max: r.maxBody}
+		_, err = io.Copy(&body, req.Body)
+		p.request.Body, p.request.BodyTruncated = body.Bytes(), body.truncated
+		close(p.bodyRead)
+		if err != nil || req.Header.Get("Upgrade") != "" {
+			return
+		}
+	}
+}
+
+func (r *Recorder) readResponses(ctx context.Context, t *tee, target string, pending <-chan *pendingRequest) {
+	defer func() {
+		t.stop()
+		// Requests that are parsed after this must not block the parser of the requests
+		go func() {
+			for range pending {
+			}
+		}()
+	}()
+	br := bufio.NewReader(t)
+	for p := range pending {
+		ex := &Exchange{Intercept: r.intercept, Target: target, Request: p.request}
+		rsp, err := readFinalResponse(br, p.method)
+		if err == nil {
+			body := limitedBuffer{max: r.maxBody}
+			_, err = io.Copy(&body, rsp.Body)
+			ex.Response = &Response{
+				Status:        rsp.StatusCode,
+				Header:        r.header(rsp.Header),
+				Body:          body.Bytes(),
+				BodyTruncated: body.truncated,
+			}
+		}
+		ex.Time = time.Now()
+
+		// The handler may respond before it has read the whole request, so waiting for the body of the request
+		// here could block the response.
+		go func(p *pendingRequest) {
+			<-p.bodyRead
+			r.write(ctx, ex)
+		}(p)
+		if err != nil || rsp.StatusCode == http.StatusSwitchingProtocols {
+			return
+		}
+	}
+}
+
+// readFinalResponse reads a response to a request with the given method, skipping the informational responses,
+// such as "100 Continue", that precede it.
+func readFinalResponse(br *bufio.Reader, method string) (*http.Response, error) {
+	for {
+		rsp, err := http.ReadResponse(br, &http.Request{Method: method})
+		if err != nil {
+			return nil, err
+		}
+		if rsp.StatusCode >= 200 || rsp.StatusCode == http.StatusSwitchingProtocols {
+			return rsp, nil
+		}
+	}
+}
+
+// limitedBuffer retains the first max bytes that are written to it, and discards the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int64
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - int64(b.buf.Len()); int64(n) > room {
+		p = p[:room]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// ReadFile returns the exchanges of the recording file at the given path.
+func ReadFile(path string) ([]*Exchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var exs []*Exchange
+	dec := json.NewDecoder(f)
+	for {
+		ex := &Exchange{}
+		if err = dec.Decode(ex); err != nil {
+			if err == io.EOF {
+				return exs, nil
+			}
+			return nil, fmt.Errorf("%s: exchange %d: %w", path, len(exs)+1, err)
+		}
+		if ex.Request == nil {
+			return nil, fmt.Errorf("%s: exchange %d has no request", path, len(exs)+1)
+		}
+		exs = append(exs, ex)
+	}
+}
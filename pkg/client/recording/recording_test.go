@@ -0,0 +1,137 @@
+package recording
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+func TestRecorder(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Echo", r.Header.Get("X-Test"))
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = fmt.Fprintf(w, "got %d bytes", len(body))
+	})}
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "traffic.jsonl")
+	r := NewRecorder("echo", path, 8, false)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	rc := r.Wrap(ctx, conn)
+
+	// Two requests on the same connection, where the body of the second is truncated
+	br := bufio.NewReader(rc)
+	send := func(method, uri, body string) *http.Response {
+		req, err := http.NewRequest(method, "http://example.com"+uri, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("X-Test", uri)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.AddCookie(&http.Cookie{Name: "session", Value: "secret"})
+		require.NoError(t, req.Write(rc))
+		rsp, err := http.ReadResponse(br, req)
+		require.NoError(t, err)
+		_, _ = io.ReadAll(rsp.Body)
+		return rsp
+	}
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/echo?x=1", "hello").StatusCode)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodPut, "/missing", "a longer body").StatusCode)
+	require.NoError(t, rc.Close())
+
+	var exs []*Exchange
+	require.Eventually(t, func() bool {
+		exs, err = ReadFile(path)
+		return err == nil && len(exs) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ex := exs[0]
+	assert.Equal(t, "echo", ex.Intercept)
+	assert.Equal(t, l.Addr().String(), ex.Target)
+	assert.Equal(t, http.MethodPost, ex.Request.Method)
+	assert.Equal(t, "/echo?x=1", ex.Request.URI)
+	assert.Equal(t, "example.com", ex.Request.Host)
+	assert.Equal(t, "/echo?x=1", ex.Request.Header.Get("X-Test"))
+	assert.Equal(t, Redacted, ex.Request.Header.Get("Authorization"))
+	assert.Equal(t, Redacted, ex.Request.Header.Get("Cookie"))
+	assert.Equal(t, "hello", string(ex.Request.Body))
+	assert.False(t, ex.Request.BodyTruncated)
+	require.NotNil(t, ex.Response)
+	assert.Equal(t, http.StatusOK, ex.Response.Status)
+	assert.Equal(t, "/echo?x=1", ex.Response.Header.Get("X-Echo"))
+	assert.Equal(t, "got 5 by", string(ex.Response.Body))
+	assert.True(t, ex.Response.BodyTruncated)
+
+	ex = exs[1]
+	assert.Equal(t, "/missing", ex.Request.URI)
+	assert.Equal(t, "a longer", string(ex.Request.Body))
+	assert.True(t, ex.Request.BodyTruncated)
+	require.NotNil(t, ex.Response)
+	assert.Equal(t, http.StatusNotFound, ex.Response.Status)
+}
+
+func TestRecorder_notHTTP(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	client, server := net.Pipe()
+	path := filepath.Join(t.TempDir(), "traffic.jsonl")
+	rc := NewRecorder("raw", path, DefaultMaxBody, false).Wrap(ctx, client)
+
+	// Traffic that isn't HTTP passes through unchanged and isn't recorded
+	go func() {
+		buf := make([]byte, 64)
+		for i := 0; i < 3; i++ {
+			n, err := server.Read(buf)
+			if err != nil {
+				return
+			}
+			_, _ = server.Write(buf[:n])
+		}
+		_ = server.Close()
+	}()
+	for i := 0; i < 3; i++ {
+		msg := fmt.Sprintf("\x00\x01 binary %d", i)
+		_, err := rc.Write([]byte(msg))
+		require.NoError(t, err)
+		buf := make([]byte, 64)
+		n, err := rc.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, msg, string(buf[:n]))
+	}
+	require.NoError(t, rc.Close())
+	_, err := ReadFile(path)
+	assert.Error(t, err)
+}
+
+func Test_redact(t *testing.T) {
+	h := http.Header{
+		"Authorization": {"Bearer secret"},
+		"Set-Cookie":    {"a=1", "b=2"},
+		"X-Test":        {"yes"},
+	}
+	r := NewRecorder("echo", "", DefaultMaxBody, true)
+	assert.Equal(t, "Bearer secret", r.header(h.Clone()).Get("Authorization"))
+
+	r = NewRecorder("echo", "", DefaultMaxBody, false)
+	rh := r.header(h.Clone())
+	assert.Equal(t, []string{Redacted}, rh.Values("Authorization"))
+	assert.Equal(t, []string{Redacted, Redacted}, rh.Values("Set-Cookie"))
+	assert.Equal(t, "yes", rh.Get("X-Test"))
+	assert.NotContains(t, rh, "Cookie")
+}
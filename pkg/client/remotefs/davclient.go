@@ -0,0 +1,279 @@
+package remotefs
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// davClient is a WebDAV client that provides the operations that the built-in WebDAV file system needs. Paths
+// are slash separated and relative to the base URL, which ends with a slash.
+type davClient struct {
+	base     *url.URL
+	user     string
+	password string
+	hc       *http.Client
+}
+
+// davEntry describes a file or directory of a WebDAV share.
+type davEntry struct {
+	name    string
+	dir     bool
+	size    int64
+	modTime time.Time
+}
+
+func newDAVClient(rawURL, user, password string) (*davClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return &davClient{
+		base:     u,
+		user:     user,
+		password: password,
+		hc:       &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+func (c *davClient) url(p string) string {
+	u := *c.base
+	u.Path = path.Join(c.base.Path, p)
+	if p == "" || p == "/" {
+		u.Path = c.base.Path
+	}
+	return u.String()
+}
+
+func (c *davClient) do(ctx context.Context, method, p string, header http.Header, body io.Reader) (*http.Response, error) {
+	rq, err := http.NewRequestWithContext(ctx, method, c.url(p), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		rq.Header[k] = vs
+	}
+	rq.SetBasicAuth(c.user, c.password)
+	return c.hc.Do(rq)
+}
+
+// check closes the body of the response and returns an error unless its status is one of the given statuses.
+// The error wraps os.ErrNotExist, os.ErrPermission, or os.ErrExist when the status has that meaning.
+func check(rs *http.Response, method, p string, ok ...int) error {
+	defer rs.Body.Close()
+	for _, s := range ok {
+		if rs.StatusCode == s {
+			_, _ = io.Copy(io.Discard, rs.Body)
+			return nil
+		}
+	}
+	var cause error
+	switch rs.StatusCode {
+	case http.StatusNotFound, http.StatusConflict:
+		// A conflict means that a parent directory doesn't exist
+		cause = os.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		cause = os.ErrPermission
+	case http.StatusMethodNotAllowed, http.StatusPreconditionFailed:
+		// A MKCOL of an existing directory isn't allowed, and a MOVE that isn't allowed to overwrite fails a precondition
+		cause = os.ErrExist
+	default:
+		return fmt.Errorf("WebDAV %s %s: %s", method, p, rs.Status)
+	}
+	return fmt.Errorf("WebDAV %s %s: %s: %w", method, p, rs.Status, cause)
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/><getlastmodified/></prop></propfind>`
+
+type davMultiStatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		PropStat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				ContentLength string `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// propfind returns the entries of the given depth, "0" or "1", with the entry of the path itself first.
+func (c *davClient) propfind(ctx context.Context, p, depth string) ([]*davEntry, error) {
+	rs, err := c.do(ctx, "PROPFIND", p, http.Header{
+		"Depth":        {depth},
+		"Content-Type": {`application/xml; charset="utf-8"`},
+	}, strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	if rs.StatusCode != http.StatusMultiStatus {
+		return nil, check(rs, "PROPFIND", p)
+	}
+	defer rs.Body.Close()
+	var ms davMultiStatus
+	if err = xml.NewDecoder(rs.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("WebDAV PROPFIND %s: %w", p, err)
+	}
+
+	self := strings.TrimSuffix(path.Join(c.base.Path, p), "/")
+	var entries []*davEntry
+	for _, r := range ms.Responses {
+		hu, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, fmt.Errorf("WebDAV PROPFIND %s: invalid href %q: %w", p, r.Href, err)
+		}
+		hp := strings.TrimSuffix(hu.Path, "/")
+		e := &davEntry{name: path.Base(hp)}
+		for _, ps := range r.PropStat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			e.dir = ps.Prop.ResourceType.Collection != nil
+			if ps.Prop.ContentLength != "" {
+				e.size, _ = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+			}
+			if ps.Prop.LastModified != "" {
+				e.modTime, _ = http.ParseTime(ps.Prop.LastModified)
+			}
+		}
+		if hp == self {
+			entries = append([]*davEntry{e}, entries...)
+		} else {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("WebDAV PROPFIND %s: empty response", p)
+	}
+	return entries, nil
+}
+
+// stat returns the entry of the given path.
+func (c *davClient) stat(ctx context.Context, p string) (*davEntry, error) {
+	entries, err := c.propfind(ctx, p, "0")
+	if err != nil {
+		return nil, err
+	}
+	e := entries[0]
+	e.name = path.Base(p)
+	return e, nil
+}
+
+// list returns the entries of the given directory.
+func (c *davClient) list(ctx context.Context, p string) ([]*davEntry, error) {
+	entries, err := c.propfind(ctx, p, "1")
+	if err != nil {
+		return nil, err
+	}
+	return entries[1:], nil
+}
+
+// read returns at most size bytes of the given file, starting at the given offset.
+func (c *davClient) read(ctx context.Context, p string, offset int64, size int) ([]byte, error) {
+	rs, err := c.do(ctx, http.MethodGet, p, http.Header{
+		"Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+int64(size)-1)},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch rs.StatusCode {
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The offset is at or beyond the end of the file
+		_ = rs.Body.Close()
+		return nil, nil
+	case http.StatusOK:
+		// The server doesn't support ranges, so the start of the content is skipped
+		defer rs.Body.Close()
+		if _, err = io.CopyN(io.Discard, rs.Body, offset); err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+	case http.StatusPartialContent:
+		defer rs.Body.Close()
+	default:
+		return nil, check(rs, http.MethodGet, p)
+	}
+	data, err := io.ReadAll(io.LimitReader(rs.Body, int64(size)))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// download writes the content of the given file to w.
+func (c *davClient) download(ctx context.Context, p string, w io.Writer) error {
+	rs, err := c.do(ctx, http.MethodGet, p, nil, nil)
+	if err != nil {
+		return err
+	}
+	if rs.StatusCode != http.StatusOK {
+		return check(rs, http.MethodGet, p)
+	}
+	defer rs.Body.Close()
+	_, err = io.Copy(w, rs.Body)
+	return err
+}
+
+// upload replaces the content of the given file, or creates it, with the size bytes that are read from r.
+func (c *davClient) upload(ctx context.Context, p string, r io.Reader, size int64) error {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(p), r)
+	if err != nil {
+		return err
+	}
+	rq.ContentLength = size
+	if size == 0 {
+		rq.Body = http.NoBody
+	}
+	rq.SetBasicAuth(c.user, c.password)
+	rs, err := c.hc.Do(rq)
+	if err != nil {
+		return err
+	}
+	return check(rs, http.MethodPut, p, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+}
+
+func (c *davClient) mkdir(ctx context.Context, p string) error {
+	rs, err := c.do(ctx, "MKCOL", p, nil, nil)
+	if err != nil {
+		return err
+	}
+	return check(rs, "MKCOL", p, http.StatusCreated)
+}
+
+func (c *davClient) remove(ctx context.Context, p string) error {
+	rs, err := c.do(ctx, http.MethodDelete, p, nil, nil)
+	if err != nil {
+		return err
+	}
+	return check(rs, http.MethodDelete, p, http.StatusOK, http.StatusNoContent)
+}
+
+// move renames the given file or directory, replacing the destination if it exists.
+func (c *davClient) move(ctx context.Context, from, to string) error {
+	rs, err := c.do(ctx, "MOVE", from, http.Header{
+		"Destination": {c.url(to)},
+		"Overwrite":   {"T"},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	return check(rs, "MOVE", from, http.StatusCreated, http.StatusNoContent)
+}
@@ -0,0 +1,89 @@
+package remotefs
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+// newTestDAVClient returns a client of a WebDAV server that serves a temporary directory, and the directory.
+func newTestDAVClient(t *testing.T) (*davClient, string) {
+	dir := t.TempDir()
+	dh := &webdav.Handler{Prefix: "/share", FileSystem: webdav.Dir(dir), LockSystem: webdav.NewMemLS()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "telepresence" || p != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		dh.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	c, err := newDAVClient(srv.URL+"/share", "telepresence", "secret")
+	require.NoError(t, err)
+	return c, dir
+}
+
+func Test_davClient(t *testing.T) {
+	ctx := context.Background()
+	c, dir := newTestDAVClient(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config"), []byte("0123456789"), 0o644))
+
+	e, err := c.stat(ctx, "/")
+	require.NoError(t, err)
+	assert.True(t, e.dir)
+
+	e, err = c.stat(ctx, "/config")
+	require.NoError(t, err)
+	assert.Equal(t, "config", e.name)
+	assert.False(t, e.dir)
+	assert.Equal(t, int64(10), e.size)
+	assert.False(t, e.modTime.IsZero())
+
+	_, err = c.stat(ctx, "/missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	data, err := c.read(ctx, "/config", 3, 4)
+	require.NoError(t, err)
+	assert.Equal(t, "3456", string(data))
+	data, err = c.read(ctx, "/config", 8, 4)
+	require.NoError(t, err)
+	assert.Equal(t, "89", string(data))
+	data, err = c.read(ctx, "/config", 10, 4)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	require.NoError(t, c.mkdir(ctx, "/sub dir"))
+	assert.ErrorIs(t, c.mkdir(ctx, "/sub dir"), os.ErrExist)
+	require.NoError(t, c.upload(ctx, "/sub dir/a%b", strings.NewReader("local"), 5))
+	require.NoError(t, c.upload(ctx, "/sub dir/empty", nil, 0))
+	entries, err := c.list(ctx, "/sub dir")
+	require.NoError(t, err)
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.name
+	}
+	assert.ElementsMatch(t, []string{"a%b", "empty"}, names)
+
+	require.NoError(t, c.move(ctx, "/sub dir/a%b", "/moved"))
+	buf := bytes.Buffer{}
+	require.NoError(t, c.download(ctx, "/moved", &buf))
+	assert.Equal(t, "local", buf.String())
+
+	require.NoError(t, c.remove(ctx, "/sub dir"))
+	_, err = os.Stat(filepath.Join(dir, "sub dir"))
+	assert.True(t, os.IsNotExist(err))
+	assert.ErrorIs(t, c.remove(ctx, "/sub dir"), os.ErrNotExist)
+
+	c.password = "wrong"
+	_, err = c.stat(ctx, "/config")
+	assert.ErrorIs(t, err, os.ErrPermission)
+}
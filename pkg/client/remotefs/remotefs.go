@@ -0,0 +1,163 @@
+// Package remotefs selects the transport that is used when mounting the remote volumes of an intercept on the
+// workstation, and mounts them over WebDAV when sshfs isn't available.
+package remotefs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/datawire/dlib/dcontext"
+	"github.com/datawire/dlib/dexec"
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cache"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+)
+
+const (
+	// TransportAuto uses sshfs when it's installed, and WebDAV otherwise.
+	TransportAuto = "auto"
+
+	// TransportSSHFS mounts using sshfs, which talks SFTP to the traffic-agent.
+	TransportSSHFS = "sshfs"
+
+	// TransportWebDAV mounts using the WebDAV client of the operating system.
+	TransportWebDAV = "webdav"
+)
+
+// SelectTransport returns the transport to use for remote mounts, as configured by intercept.mountTransport,
+// or an error that explains why remote mounts are unavailable.
+func SelectTransport(ctx context.Context) (string, error) {
+	switch t := client.GetConfig(ctx).Intercept.MountTransport; t {
+	case "", TransportAuto:
+		sshfsErr := CheckSSHFS(ctx)
+		if sshfsErr == nil {
+			return TransportSSHFS, nil
+		}
+		if CheckWebDAV(ctx) == nil {
+			return TransportWebDAV, nil
+		}
+		return "", sshfsErr
+	case TransportSSHFS:
+		return t, CheckSSHFS(ctx)
+	case TransportWebDAV:
+		return t, CheckWebDAV(ctx)
+	default:
+		return "", errcat.Config.Newf("invalid intercept.mountTransport %q, must be one of %q, %q, or %q",
+			t, TransportAuto, TransportSSHFS, TransportWebDAV)
+	}
+}
+
+// CheckSSHFS returns an error if sshfs isn't installed or if it's too old to be used.
+func CheckSSHFS(ctx context.Context) error {
+	// Use CombinedOutput to include stderr which has information about whether they
+	// need to upgrade to a newer version of macFUSE or not
+	var cmd *dexec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = dexec.CommandContext(ctx, "sshfs-win", "cmd", "-V")
+	} else {
+		cmd = dexec.CommandContext(ctx, "sshfs", "-V")
+	}
+	cmd.DisableLogging = true
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.New("sshfs is not installed on your local machine")
+	}
+
+	// OSXFUSE changed to macFUSE and we've noticed that older versions of OSXFUSE
+	// can cause browsers to hang + kernel crashes, so we add an error to prevent
+	// our users from running into this problem.
+	// OSXFUSE isn't included in the output of sshfs -V in versions of 4.0.0 so
+	// we check for that as a proxy for if they have the right version or not.
+	if bytes.Contains(out, []byte("OSXFUSE")) {
+		return errors.New(`macFUSE 4.0.5 or higher is required on your local machine`)
+	}
+	return nil
+}
+
+// CheckWebDAV returns an error if the operating system has no WebDAV client that can be used for mounts.
+func CheckWebDAV(ctx context.Context) error {
+	return checkWebDAV(ctx)
+}
+
+// MountWebDAV mounts the WebDAV share at the given URL on the mount point, authenticating as install.TelAppWebDAVUser
+// with the given password, and unmounts it again when the context is done. The mount is recorded in the user cache
+// until it's unmounted, so that it can be removed by RemoveStaleWebDAVMounts if the process dies. The password is
+// never passed on a command line. Linux uses a built-in FUSE file system, and macOS and Windows use their WebDAV
+// clients, which can't mount read-only, so a read-only mount is enforced by the server.
+func MountWebDAV(ctx context.Context, url, password, mountPoint string, readOnly bool) error {
+	if err := mountWebDAV(ctx, url, install.TelAppWebDAVUser, password, mountPoint, readOnly); err != nil {
+		return err
+	}
+	dlog.Infof(ctx, "Mounted %s at %q", url, mountPoint)
+	recordWebDAVMount(ctx, mountPoint, url)
+	<-ctx.Done()
+
+	// The context is cancelled, so a new one is needed for the unmount
+	ctx, cancel := context.WithTimeout(dcontext.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	err := unmountWebDAV(ctx, mountPoint)
+	recordWebDAVMount(ctx, mountPoint, "")
+	return err
+}
+
+// RemoveStaleWebDAVMounts unmounts the WebDAV mounts that were left behind by a process that didn't get
+// the chance to unmount them. It must not be called while mounts made by this process are active.
+func RemoveStaleWebDAVMounts(ctx context.Context) {
+	mountsLock.Lock()
+	defer mountsLock.Unlock()
+	mounts, err := cache.LoadWebDAVMountsFromUserCache(ctx)
+	if err != nil {
+		dlog.Errorf(ctx, "unable to load WebDAV mounts: %v", err)
+		return
+	}
+	if len(mounts) == 0 {
+		return
+	}
+	for mountPoint, url := range mounts {
+		if err := unmountWebDAV(ctx, mountPoint); err != nil {
+			dlog.Debugf(ctx, "unable to unmount stale WebDAV mount of %s at %q: %v", url, mountPoint, err)
+		} else {
+			dlog.Infof(ctx, "Removed stale WebDAV mount of %s at %q", url, mountPoint)
+		}
+	}
+	if err = cache.DeleteWebDAVMountsFromUserCache(ctx); err != nil {
+		dlog.Errorf(ctx, "unable to delete WebDAV mounts: %v", err)
+	}
+}
+
+// RemoveWebDAVMount unmounts a WebDAV mount that was recorded by a process that is no longer running, and
+// removes it from the recorded mounts.
+func RemoveWebDAVMount(ctx context.Context, mountPoint string) error {
+	if err := unmountWebDAV(ctx, mountPoint); err != nil {
+		return err
+	}
+	recordWebDAVMount(ctx, mountPoint, "")
+	return nil
+}
+
+var mountsLock sync.Mutex
+
+// recordWebDAVMount adds the mount point and URL to the WebDAV mounts in the user cache, or removes the mount
+// point when the URL is empty.
+func recordWebDAVMount(ctx context.Context, mountPoint, url string) {
+	mountsLock.Lock()
+	defer mountsLock.Unlock()
+	mounts, err := cache.LoadWebDAVMountsFromUserCache(ctx)
+	if err == nil {
+		if url == "" {
+			delete(mounts, mountPoint)
+		} else {
+			mounts[mountPoint] = url
+		}
+		err = cache.SaveWebDAVMountsToUserCache(ctx, mounts)
+	}
+	if err != nil {
+		dlog.Errorf(ctx, "unable to record WebDAV mount at %q: %v", mountPoint, err)
+	}
+}
@@ -0,0 +1,37 @@
+package remotefs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cache"
+	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+)
+
+func Test_recordWebDAVMount(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	ctx = filelocation.WithGOOS(filelocation.WithUserHomeDir(ctx, t.TempDir()), "darwin")
+
+	recordWebDAVMount(ctx, "/tmp/telfs-1", "http://10.1.0.3:4711/")
+	recordWebDAVMount(ctx, "/tmp/telfs-2", "http://10.1.0.4:4711/telepresence-readonly/")
+	mounts, err := cache.LoadWebDAVMountsFromUserCache(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"/tmp/telfs-1": "http://10.1.0.3:4711/",
+		"/tmp/telfs-2": "http://10.1.0.4:4711/telepresence-readonly/",
+	}, mounts)
+
+	recordWebDAVMount(ctx, "/tmp/telfs-1", "")
+	mounts, err = cache.LoadWebDAVMountsFromUserCache(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"/tmp/telfs-2": "http://10.1.0.4:4711/telepresence-readonly/"}, mounts)
+
+	// The records of stale mounts are removed even when the unmount fails
+	RemoveStaleWebDAVMounts(ctx)
+	mounts, err = cache.LoadWebDAVMountsFromUserCache(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, mounts)
+}
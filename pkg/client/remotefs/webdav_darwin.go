@@ -0,0 +1,67 @@
+package remotefs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/datawire/dlib/dexec"
+)
+
+const mountWebDAVCmd = "/sbin/mount_webdav"
+
+func checkWebDAV(_ context.Context) error {
+	if _, err := os.Stat(mountWebDAVCmd); err != nil {
+		return errors.New("mount_webdav is not available on your local machine")
+	}
+	return nil
+}
+
+func mountWebDAV(ctx context.Context, url, user, password, mountPoint string, _ bool) error {
+	// The credentials are passed using the -a option, which reads them from a file descriptor, so that they
+	// never show in the process list. The file is removed before anything is written to it.
+	creds, err := credentialsFile(user, password)
+	if err != nil {
+		return err
+	}
+	defer creds.Close()
+
+	// -S suppresses the dialogs that are shown when the connection is lost, -v names the volume. The
+	// first of the ExtraFiles is file descriptor 3 of the command.
+	cmd := dexec.CommandContext(ctx, mountWebDAVCmd, "-S", "-a", "3", "-v", "telepresence", url, mountPoint)
+	cmd.ExtraFiles = []*os.File{creds}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("mount_webdav %s %s failed: %w: %s", url, mountPoint, err, out)
+	}
+	return nil
+}
+
+// credentialsFile returns an unlinked file that holds the user and the password in the format that the -a option
+// of mount_webdav reads, each being preceded by its length as a 32-bit integer in network byte order.
+func credentialsFile(user, password string) (*os.File, error) {
+	f, err := os.CreateTemp("", "telepresence-webdav-")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(f.Name())
+	var buf []byte
+	for _, s := range []string{user, password} {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(s)))
+		buf = append(append(buf, l[:]...), s...)
+	}
+	if _, err = f.Write(buf); err == nil {
+		_, err = f.Seek(0, 0)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func unmountWebDAV(ctx context.Context, mountPoint string) error {
+	return dexec.CommandContext(ctx, "umount", mountPoint).Run()
+}
@@ -0,0 +1,54 @@
+package remotefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// The WebDAV file systems of Linux, such as davfs2, require root privileges or an entry in /etc/fstab for each
+// mount point, so the shares are instead mounted using a built-in FUSE file system. Like sshfs, it only needs
+// the fusermount command to mount as a normal user.
+func checkWebDAV(_ context.Context) error {
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		return errors.New("FUSE is not available on your local machine")
+	}
+	if _, err := exec.LookPath("fusermount"); err != nil {
+		return errors.New("fusermount is not installed on your local machine")
+	}
+	return nil
+}
+
+func mountWebDAV(ctx context.Context, url, user, password, mountPoint string, readOnly bool) error {
+	client, err := newDAVClient(url, user, password)
+	if err != nil {
+		return err
+	}
+	opts := []fuse.MountOption{fuse.FSName(url), fuse.Subtype("telepresence")}
+	if readOnly {
+		opts = append(opts, fuse.ReadOnly())
+	}
+	conn, err := fuse.Mount(mountPoint, opts...)
+	if err != nil {
+		return fmt.Errorf("unable to mount %s at %q: %w", url, mountPoint, err)
+	}
+	go func() {
+		defer conn.Close()
+		if err := fs.Serve(conn, &davFS{client: client, readOnly: readOnly}); err != nil {
+			dlog.Errorf(ctx, "WebDAV file system at %q: %v", mountPoint, err)
+		}
+	}()
+	return nil
+}
+
+func unmountWebDAV(_ context.Context, mountPoint string) error {
+	// The connection is closed by the goroutine that serves it when the unmount ends the serving.
+	return fuse.Unmount(mountPoint)
+}
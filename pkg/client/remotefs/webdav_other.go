@@ -0,0 +1,23 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package remotefs
+
+import (
+	"context"
+	"errors"
+)
+
+var errWebDAVUnsupported = errors.New("WebDAV mounts are only supported on Linux, macOS, and Windows; install sshfs to mount remote volumes")
+
+func checkWebDAV(_ context.Context) error {
+	return errWebDAVUnsupported
+}
+
+func mountWebDAV(_ context.Context, _, _, _, _ string, _ bool) error {
+	return errWebDAVUnsupported
+}
+
+func unmountWebDAV(_ context.Context, _ string) error {
+	return errWebDAVUnsupported
+}
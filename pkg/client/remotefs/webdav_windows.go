@@ -0,0 +1,81 @@
+package remotefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/datawire/dlib/dexec"
+)
+
+const resourceTypeDisk = 1
+
+var (
+	mpr                        = windows.NewLazySystemDLL("mpr.dll")
+	procWNetAddConnection2W    = mpr.NewProc("WNetAddConnection2W")
+	procWNetCancelConnection2W = mpr.NewProc("WNetCancelConnection2W")
+)
+
+// netResource is the NETRESOURCEW struct of the Windows Networking API.
+type netResource struct {
+	Scope       uint32
+	Type        uint32
+	DisplayType uint32
+	Usage       uint32
+	LocalName   *uint16
+	RemoteName  *uint16
+	Comment     *uint16
+	Provider    *uint16
+}
+
+func checkWebDAV(ctx context.Context) error {
+	// The WebDAV redirector, which lets drives be mapped to WebDAV shares, is provided by the WebClient service
+	cmd := dexec.CommandContext(ctx, "sc", "query", "WebClient")
+	cmd.DisableLogging = true
+	if err := cmd.Run(); err != nil {
+		return errors.New("the WebClient service is not available on your local machine")
+	}
+	return procWNetAddConnection2W.Find()
+}
+
+// mountWebDAV maps the drive to the share using the API that "net use" uses, so that the password is passed in
+// memory instead of on a command line. The mapping isn't remembered at the next logon.
+func mountWebDAV(_ context.Context, url, user, password, mountPoint string, _ bool) error {
+	nr := netResource{Type: resourceTypeDisk}
+	var err error
+	if nr.LocalName, err = windows.UTF16PtrFromString(mountPoint); err != nil {
+		return err
+	}
+	if nr.RemoteName, err = windows.UTF16PtrFromString(url); err != nil {
+		return err
+	}
+	pw, err := windows.UTF16PtrFromString(password)
+	if err != nil {
+		return err
+	}
+	u, err := windows.UTF16PtrFromString(user)
+	if err != nil {
+		return err
+	}
+	r, _, _ := procWNetAddConnection2W.Call(uintptr(unsafe.Pointer(&nr)), uintptr(unsafe.Pointer(pw)), uintptr(unsafe.Pointer(u)), 0)
+	if r != 0 {
+		return fmt.Errorf("unable to map %s to %s: %w", mountPoint, url, windows.Errno(r))
+	}
+	return nil
+}
+
+func unmountWebDAV(_ context.Context, mountPoint string) error {
+	name, err := windows.UTF16PtrFromString(mountPoint)
+	if err != nil {
+		return err
+	}
+	// The last argument forces the removal even when files are open on the drive
+	r, _, _ := procWNetCancelConnection2W.Call(uintptr(unsafe.Pointer(name)), 0, 1)
+	if r != 0 {
+		return fmt.Errorf("unable to remove the mapping of %s: %w", mountPoint, windows.Errno(r))
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package remotefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// attrValidity is how long the kernel caches the attributes and directory entries of the file system.
+const attrValidity = time.Second
+
+// davFS is a FUSE file system that is backed by a WebDAV share. Reads are forwarded to the share as ranged
+// requests. A file that is opened for writing is copied into a temporary file, which is uploaded to the share
+// when the file is flushed, because WebDAV has no partial updates.
+type davFS struct {
+	client   *davClient
+	readOnly bool
+}
+
+func (f *davFS) Root() (fs.Node, error) {
+	return &davNode{fs: f, path: "/", entry: davEntry{dir: true}}, nil
+}
+
+// davNode is a file or a directory of the share.
+type davNode struct {
+	fs *davFS
+
+	sync.Mutex
+	path  string
+	entry davEntry
+
+	// writer is the last handle that opened the file for writing, until it's released. The size of its
+	// temporary file is the size of the file, because the share may have yet to receive its content.
+	writer *davHandle
+}
+
+// davHandle is an open file.
+type davHandle struct {
+	node *davNode
+
+	sync.Mutex
+	// buf is the temporary file that holds the content of a file that is opened for writing
+	buf   *os.File
+	dirty bool
+}
+
+// toErrno translates the errors of the davClient to the errors that FUSE reports to the caller.
+func toErrno(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, os.ErrNotExist):
+		return fuse.ENOENT
+	case errors.Is(err, os.ErrPermission):
+		return fuse.Errno(syscall.EACCES)
+	case errors.Is(err, os.ErrExist):
+		return fuse.EEXIST
+	default:
+		return fuse.EIO
+	}
+}
+
+func (n *davNode) child(name string) string {
+	return path.Join(n.path, name)
+}
+
+func (n *davNode) Attr(ctx context.Context, a *fuse.Attr) error {
+	n.Lock()
+	defer n.Unlock()
+	if n.path != "/" && n.writer == nil {
+		e, err := n.fs.client.stat(ctx, n.path)
+		if err != nil {
+			return toErrno(err)
+		}
+		n.entry = *e
+	}
+	a.Valid = attrValidity
+	a.Mtime = n.entry.modTime
+	a.Size = uint64(n.entry.size)
+	if n.writer != nil {
+		if st, err := n.writer.buf.Stat(); err == nil {
+			a.Size = uint64(st.Size())
+		}
+	}
+	perm := os.FileMode(0644)
+	if n.entry.dir {
+		perm = os.ModeDir | 0755
+	}
+	if n.fs.readOnly {
+		perm &^= 0222
+	}
+	a.Mode = perm
+	uid, gid := os.Getuid(), os.Getgid()
+	a.Uid, a.Gid = uint32(uid), uint32(gid)
+	return nil
+}
+
+func (n *davNode) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	p := n.child(name)
+	e, err := n.fs.client.stat(ctx, p)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return &davNode{fs: n.fs, path: p, entry: *e}, nil
+}
+
+func (n *davNode) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	entries, err := n.fs.client.list(ctx, n.path)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	des := make([]fuse.Dirent, len(entries))
+	for i, e := range entries {
+		des[i] = fuse.Dirent{Name: e.name, Type: fuse.DT_File}
+		if e.dir {
+			des[i].Type = fuse.DT_Dir
+		}
+	}
+	return des, nil
+}
+
+func (n *davNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if req.Dir {
+		return n, nil
+	}
+	h := &davHandle{node: n}
+	if req.Flags.IsReadOnly() {
+		return h, nil
+	}
+	if err := h.load(ctx, req.Flags&fuse.OpenTruncate != 0); err != nil {
+		return nil, err
+	}
+	// The kernel must not serve reads from a cache of the content that the share had when the file was opened
+	resp.Flags |= fuse.OpenDirectIO
+	return h, nil
+}
+
+func (n *davNode) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	p := n.child(req.Name)
+	if err := n.fs.client.upload(ctx, p, nil, 0); err != nil {
+		return nil, nil, toErrno(err)
+	}
+	cn := &davNode{fs: n.fs, path: p, entry: davEntry{name: req.Name, modTime: time.Now()}}
+	h := &davHandle{node: cn}
+	if err := h.load(ctx, true); err != nil {
+		return nil, nil, err
+	}
+	resp.Flags |= fuse.OpenDirectIO
+	return cn, h, nil
+}
+
+func (n *davNode) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	p := n.child(req.Name)
+	if err := n.fs.client.mkdir(ctx, p); err != nil {
+		return nil, toErrno(err)
+	}
+	return &davNode{fs: n.fs, path: p, entry: davEntry{name: req.Name, dir: true, modTime: time.Now()}}, nil
+}
+
+func (n *davNode) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	return toErrno(n.fs.client.remove(ctx, n.child(req.Name)))
+}
+
+func (n *davNode) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+	nd, ok := newDir.(*davNode)
+	if !ok {
+		return fuse.EIO
+	}
+	return toErrno(n.fs.client.move(ctx, n.child(req.OldName), nd.child(req.NewName)))
+}
+
+// Setattr changes the size of the file. Other attributes, such as the mode and the times, can't be changed
+// using WebDAV, so changes to them are ignored.
+func (n *davNode) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if req.Valid.Size() {
+		n.Lock()
+		w := n.writer
+		n.Unlock()
+		if w != nil {
+			if err := w.truncate(int64(req.Size)); err != nil {
+				return err
+			}
+		} else if err := n.truncate(ctx, int64(req.Size)); err != nil {
+			return err
+		}
+	}
+	return n.Attr(ctx, &resp.Attr)
+}
+
+// truncate changes the size of a file that isn't open by replacing its content.
+func (n *davNode) truncate(ctx context.Context, size int64) error {
+	h := &davHandle{node: n}
+	if err := h.load(ctx, size == 0); err != nil {
+		return err
+	}
+	defer h.release()
+	if err := h.truncate(size); err != nil {
+		return err
+	}
+	return h.flush(ctx)
+}
+
+// load creates the temporary file of the handle and, unless truncate is true, copies the content of the file
+// into it.
+func (h *davHandle) load(ctx context.Context, truncate bool) error {
+	buf, err := os.CreateTemp("", "telepresence-webdav-")
+	if err != nil {
+		return toErrno(err)
+	}
+	_ = os.Remove(buf.Name())
+	if truncate {
+		h.dirty = true
+	} else if err = h.node.fs.client.download(ctx, h.node.path, buf); err != nil {
+		_ = buf.Close()
+		return toErrno(err)
+	}
+	h.buf = buf
+	h.node.Lock()
+	h.node.writer = h
+	h.node.Unlock()
+	return nil
+}
+
+func (h *davHandle) truncate(size int64) error {
+	h.Lock()
+	defer h.Unlock()
+	if err := h.buf.Truncate(size); err != nil {
+		return toErrno(err)
+	}
+	h.dirty = true
+	return nil
+}
+
+func (h *davHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	h.Lock()
+	defer h.Unlock()
+	if h.buf == nil {
+		data, err := h.node.fs.client.read(ctx, h.node.path, req.Offset, req.Size)
+		resp.Data = data
+		return toErrno(err)
+	}
+	data := make([]byte, req.Size)
+	n, err := h.buf.ReadAt(data, req.Offset)
+	if err != nil && err != io.EOF {
+		return toErrno(err)
+	}
+	resp.Data = data[:n]
+	return nil
+}
+
+func (h *davHandle) Write(_ context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	h.Lock()
+	defer h.Unlock()
+	if h.buf == nil {
+		return fuse.Errno(syscall.EBADF)
+	}
+	n, err := h.buf.WriteAt(req.Data, req.Offset)
+	resp.Size = n
+	h.dirty = true
+	return toErrno(err)
+}
+
+func (h *davHandle) Flush(ctx context.Context, _ *fuse.FlushRequest) error {
+	return h.flush(ctx)
+}
+
+// flush uploads the content of the temporary file when it has changed.
+func (h *davHandle) flush(ctx context.Context) error {
+	h.Lock()
+	defer h.Unlock()
+	if !h.dirty {
+		return nil
+	}
+	st, err := h.buf.Stat()
+	if err != nil {
+		return toErrno(err)
+	}
+	if err = h.node.fs.client.upload(ctx, h.node.path, io.NewSectionReader(h.buf, 0, st.Size()), st.Size()); err != nil {
+		return toErrno(err)
+	}
+	h.dirty = false
+	return nil
+}
+
+func (h *davHandle) Release(_ context.Context, _ *fuse.ReleaseRequest) error {
+	h.release()
+	return nil
+}
+
+func (h *davHandle) release() {
+	h.Lock()
+	defer h.Unlock()
+	if h.buf == nil {
+		return
+	}
+	h.node.Lock()
+	if h.node.writer == h {
+		h.node.writer = nil
+	}
+	h.node.Unlock()
+	_ = h.buf.Close()
+	h.buf = nil
+}
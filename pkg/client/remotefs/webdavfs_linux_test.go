@@ -0,0 +1,93 @@
+package remotefs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_davFS calls the file system directly, the way that the FUSE server does, because mounting requires
+// privileges that the tests may not have.
+func Test_davFS(t *testing.T) {
+	ctx := context.Background()
+	c, dir := newTestDAVClient(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config"), []byte("remote"), 0o644))
+	fsys := &davFS{client: c}
+	root, err := fsys.Root()
+	require.NoError(t, err)
+	rn := root.(*davNode)
+
+	_, err = rn.Lookup(ctx, "missing")
+	assert.Equal(t, fuse.ENOENT, err)
+
+	node, err := rn.Lookup(ctx, "config")
+	require.NoError(t, err)
+	cn := node.(*davNode)
+	var a fuse.Attr
+	require.NoError(t, cn.Attr(ctx, &a))
+	assert.Equal(t, uint64(6), a.Size)
+	assert.Equal(t, os.FileMode(0644), a.Mode)
+
+	// Reads of a file that is opened read-only are forwarded to the share
+	h, err := cn.Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenReadOnly}, &fuse.OpenResponse{})
+	require.NoError(t, err)
+	rr := &fuse.ReadResponse{}
+	require.NoError(t, h.(fs.HandleReader).Read(ctx, &fuse.ReadRequest{Offset: 2, Size: 10}, rr))
+	assert.Equal(t, "mote", string(rr.Data))
+
+	// Writes are uploaded when the file is flushed
+	resp := &fuse.OpenResponse{}
+	h, err = cn.Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenReadWrite}, resp)
+	require.NoError(t, err)
+	assert.NotZero(t, resp.Flags&fuse.OpenDirectIO)
+	wr := &fuse.WriteResponse{}
+	require.NoError(t, h.(fs.HandleWriter).Write(ctx, &fuse.WriteRequest{Offset: 6, Data: []byte(" and local")}, wr))
+	assert.Equal(t, 10, wr.Size)
+	require.NoError(t, cn.Attr(ctx, &a))
+	assert.Equal(t, uint64(16), a.Size, "the size includes what has yet to be uploaded")
+	require.NoError(t, h.(fs.HandleFlusher).Flush(ctx, &fuse.FlushRequest{}))
+	require.NoError(t, h.(fs.HandleReleaser).Release(ctx, &fuse.ReleaseRequest{}))
+	data, err := os.ReadFile(filepath.Join(dir, "config"))
+	require.NoError(t, err)
+	assert.Equal(t, "remote and local", string(data))
+
+	// A file that isn't open is truncated by replacing its content
+	sr := &fuse.SetattrResponse{}
+	require.NoError(t, cn.Setattr(ctx, &fuse.SetattrRequest{Valid: fuse.SetattrSize, Size: 3}, sr))
+	assert.Equal(t, uint64(3), sr.Attr.Size)
+	data, err = os.ReadFile(filepath.Join(dir, "config"))
+	require.NoError(t, err)
+	assert.Equal(t, "rem", string(data))
+
+	// Files and directories can be created, listed, renamed, and removed
+	dn, err := rn.Mkdir(ctx, &fuse.MkdirRequest{Name: "sub"})
+	require.NoError(t, err)
+	_, h, err = dn.(*davNode).Create(ctx, &fuse.CreateRequest{Name: "new"}, &fuse.CreateResponse{})
+	require.NoError(t, err)
+	require.NoError(t, h.(fs.HandleWriter).Write(ctx, &fuse.WriteRequest{Data: []byte("created")}, &fuse.WriteResponse{}))
+	require.NoError(t, h.(fs.HandleFlusher).Flush(ctx, &fuse.FlushRequest{}))
+	require.NoError(t, h.(fs.HandleReleaser).Release(ctx, &fuse.ReleaseRequest{}))
+	des, err := dn.(*davNode).ReadDirAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []fuse.Dirent{{Name: "new", Type: fuse.DT_File}}, des)
+
+	require.NoError(t, dn.(*davNode).Rename(ctx, &fuse.RenameRequest{OldName: "new", NewName: "renamed"}, rn))
+	data, err = os.ReadFile(filepath.Join(dir, "renamed"))
+	require.NoError(t, err)
+	assert.Equal(t, "created", string(data))
+	require.NoError(t, rn.Remove(ctx, &fuse.RemoveRequest{Name: "sub", Dir: true}))
+	des, err = rn.ReadDirAll(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []fuse.Dirent{{Name: "config", Type: fuse.DT_File}, {Name: "renamed", Type: fuse.DT_File}}, des)
+
+	// A read-only mount reports files without write permissions
+	fsys.readOnly = true
+	require.NoError(t, cn.Attr(ctx, &a))
+	assert.Equal(t, os.FileMode(0444), a.Mode)
+}
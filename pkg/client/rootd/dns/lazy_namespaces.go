@@ -0,0 +1,135 @@
+package dns
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+const defaultNamespaceIdleTimeout = 10 * time.Minute
+
+// lazyNamespaces keeps track of the mapped namespaces when they are added to the DNS configuration of the
+// system lazily. A mapped namespace is activated when a name in it is first queried, and deactivated again
+// when no name in it has been queried for idleTimeout. Only active namespaces are passed on to the OS
+// specific search path processor, which keeps the resolver configuration small on clusters with hundreds
+// of namespaces.
+type lazyNamespaces struct {
+	sync.Mutex
+
+	idleTimeout time.Duration
+
+	// mapped are all namespaces that the user daemon has mapped
+	mapped map[string]struct{}
+
+	// active are the activated namespaces, and the time when a name in each was last queried
+	active map[string]time.Time
+
+	// activated receives a value when a namespace is activated
+	activated chan struct{}
+}
+
+func newLazyNamespaces(idleTimeout time.Duration) *lazyNamespaces {
+	return &lazyNamespaces{
+		idleTimeout: idleTimeout,
+		mapped:      make(map[string]struct{}),
+		active:      make(map[string]time.Time),
+		activated:   make(chan struct{}, 1),
+	}
+}
+
+// effectivePaths records the namespaces in the given paths as mapped, and returns the paths with the
+// namespaces that aren't active removed. Search paths, i.e. paths that contain a dot, are retained.
+func (ln *lazyNamespaces) effectivePaths(paths []string) []string {
+	ln.Lock()
+	defer ln.Unlock()
+	mapped := make(map[string]struct{}, len(paths))
+	effective := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if path == "" || strings.ContainsRune(path, '.') {
+			effective = append(effective, path)
+			continue
+		}
+		mapped[path] = struct{}{}
+		if _, ok := ln.active[path]; ok {
+			effective = append(effective, path)
+		}
+	}
+	for ns := range ln.active {
+		if _, ok := mapped[ns]; !ok {
+			delete(ln.active, ns)
+		}
+	}
+	ln.mapped = mapped
+	return effective
+}
+
+// touch records that a name in the given namespace was queried at the given time. It returns true if
+// the namespace is mapped and was activated by this call.
+func (ln *lazyNamespaces) touch(ns string, now time.Time) bool {
+	ln.Lock()
+	defer ln.Unlock()
+	if _, ok := ln.mapped[ns]; !ok {
+		return false
+	}
+	_, wasActive := ln.active[ns]
+	ln.active[ns] = now
+	if !wasActive {
+		select {
+		case ln.activated <- struct{}{}:
+		default:
+		}
+	}
+	return !wasActive
+}
+
+// expire deactivates the namespaces that haven't been queried since idleTimeout before the given time,
+// and returns them.
+func (ln *lazyNamespaces) expire(now time.Time) []string {
+	ln.Lock()
+	defer ln.Unlock()
+	var expired []string
+	for ns, lastUsed := range ln.active {
+		if now.Sub(lastUsed) > ln.idleTimeout {
+			delete(ln.active, ns)
+			expired = append(expired, ns)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+// SetLazyNamespaces makes the server activate mapped namespaces when a name in them is first queried,
+// and deactivate them after the given idle timeout. It must be called before the server starts.
+func (s *Server) SetLazyNamespaces(idleTimeout time.Duration) {
+	if idleTimeout <= 0 {
+		idleTimeout = defaultNamespaceIdleTimeout
+	}
+	s.lazy = newLazyNamespaces(idleTimeout)
+}
+
+// queryNamespace returns the namespace that the given query refers to, i.e. the namespace in
+// "<service>.<namespace>.svc.<cluster domain>." or the last label of "<service>.<namespace>.".
+func (s *Server) queryNamespace(query string) string {
+	name := strings.ToLower(strings.TrimSuffix(query, "."))
+	name = strings.TrimSuffix(name, "."+tel2SubDomain)
+	name = strings.TrimSuffix(name, ".svc."+strings.TrimSuffix(s.clusterDomain, "."))
+	if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+		name = name[dot+1:]
+	}
+	return name
+}
+
+// activateNamespace activates the namespace that the given query refers to, if it is a mapped
+// namespace that isn't active yet.
+func (s *Server) activateNamespace(c context.Context, query string) {
+	if s.lazy == nil {
+		return
+	}
+	if ns := s.queryNamespace(query); s.lazy.touch(ns, time.Now()) {
+		dlog.Debugf(c, "activating namespace %q", ns)
+	}
+}
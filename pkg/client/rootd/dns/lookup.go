@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/daemon"
+)
+
+// captureWriter is a dns.ResponseWriter that retains the message that is written to it.
+type captureWriter struct {
+	msg *dns.Msg
+}
+
+var localhost = &net.UDPAddr{IP: net.IP{127, 0, 0, 1}}
+
+func (w *captureWriter) LocalAddr() net.Addr  { return localhost }
+func (w *captureWriter) RemoteAddr() net.Addr { return localhost }
+func (w *captureWriter) Close() error         { return nil }
+func (w *captureWriter) TsigStatus() error    { return nil }
+func (w *captureWriter) TsigTimersOnly(bool)  {}
+func (w *captureWriter) Hijack()              {}
+
+func (w *captureWriter) WriteMsg(msg *dns.Msg) error {
+	w.msg = msg
+	return nil
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(data); err != nil {
+		return 0, err
+	}
+	w.msg = msg
+	return len(data), nil
+}
+
+// Lookup resolves the given name the same way as a query from the host's resolver would be resolved,
+// and reports the path that produced the answer, the records, and the time it took.
+func (s *Server) Lookup(ctx context.Context, name, qType string) (*rpc.DNSResponse, error) {
+	if name == "" {
+		return nil, fmt.Errorf("no name to look up")
+	}
+	if qType == "" {
+		qType = "A"
+	}
+	qt, ok := dns.StringToType[strings.ToUpper(qType)]
+	if !ok {
+		return nil, fmt.Errorf("unknown query type %q", qType)
+	}
+	r := new(dns.Msg)
+	r.SetQuestion(dns.Fqdn(name), qt)
+
+	rsp := &rpc.DNSResponse{ClusterExclusion: s.clusterExclusion(r.Question[0].Name)}
+	w := &captureWriter{}
+	start := time.Now()
+	rsp.Path = s.serveDNS(ctx, w, r)
+	rsp.Duration = durationpb.New(time.Since(start))
+	if w.msg == nil {
+		rsp.Rcode = dns.RcodeToString[dns.RcodeServerFailure]
+		return rsp, nil
+	}
+	rsp.Rcode = dns.RcodeToString[w.msg.Rcode]
+	for _, rr := range w.msg.Answer {
+		rsp.Records = append(rsp.Records, rr.String())
+	}
+	return rsp, nil
+}
@@ -0,0 +1,75 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+func TestServer_Lookup(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	s := NewServer(nil, nil)
+	s.ctx = ctx
+	s.requestCount = 1 // skip the recursion check
+	s.resolve = func(_ context.Context, name string) []net.IP {
+		if s.shouldDoClusterLookup(name) && name == "echo.ns." {
+			return []net.IP{{10, 96, 0, 10}}
+		}
+		return nil
+	}
+	s.cacheResolve = s.resolveThruCache
+
+	rsp, err := s.Lookup(ctx, "echo.ns", "")
+	require.NoError(t, err)
+	assert.Equal(t, PathCluster, rsp.Path)
+	assert.Empty(t, rsp.ClusterExclusion)
+	assert.Equal(t, dns.RcodeToString[dns.RcodeSuccess], rsp.Rcode)
+	if assert.Len(t, rsp.Records, 1) {
+		assert.Contains(t, rsp.Records[0], "10.96.0.10")
+	}
+	assert.NotNil(t, rsp.Duration)
+
+	// Names with an excluded suffix are never looked up in the cluster, and the suffix is reported
+	rsp, err = s.Lookup(ctx, "www.example.com.", "a")
+	require.NoError(t, err)
+	assert.Equal(t, PathNone, rsp.Path)
+	assert.Equal(t, "excluded suffix .com", rsp.ClusterExclusion)
+	assert.Equal(t, dns.RcodeToString[dns.RcodeNameError], rsp.Rcode)
+	assert.Empty(t, rsp.Records)
+
+	_, err = s.Lookup(ctx, "echo.ns", "BOGUS")
+	assert.Error(t, err)
+	_, err = s.Lookup(ctx, "", "A")
+	assert.Error(t, err)
+}
+
+func TestServer_SetAnswerObserver(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	s := NewServer(nil, nil)
+	s.ctx = ctx
+	s.requestCount = 1 // skip the recursion check
+	s.resolve = func(_ context.Context, name string) []net.IP {
+		return []net.IP{{10, 96, 0, 10}}
+	}
+	s.cacheResolve = s.resolveThruCache
+	var observed []string
+	s.SetAnswerObserver(func(_ context.Context, name string, ipv6 bool, ips []net.IP, ttl time.Duration) {
+		assert.False(t, ipv6)
+		assert.Equal(t, dnsTTL*time.Second, ttl)
+		for _, ip := range ips {
+			observed = append(observed, name+"="+ip.String())
+		}
+	})
+	_, err := s.Lookup(ctx, "echo.ns", "A")
+	require.NoError(t, err)
+	_, err = s.Lookup(ctx, "echo.ns", "TXT")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo.ns.=10.96.0.10"}, observed)
+}
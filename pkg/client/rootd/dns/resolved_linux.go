@@ -114,6 +114,12 @@ func (s *Server) updateLinkDomains(c context.Context, paths []string, dev *vif.D
 	for _, sfx := range s.config.IncludeSuffixes {
 		paths = append(paths, "~"+strings.TrimPrefix(sfx, "."))
 	}
+	for _, host := range s.config.IncludeHosts {
+		paths = append(paths, "~"+host)
+	}
+	for sfx := range s.config.SuffixNamespaces {
+		paths = append(paths, "~"+sfx)
+	}
 	paths = append(paths, s.clusterDomain)
 	namespaces[tel2SubDomain] = struct{}{}
 
@@ -2,7 +2,10 @@ package dns
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -27,7 +30,7 @@ type Resolver func(ctx context.Context, domain string) []net.IP
 // recursively. This is common when the cluster is running on the local host (k3s in docker for instance).
 const recursionCheck = "tel2-recursion-check.kube-system"
 
-// defaultClusterDomain used unless traffic-manager reports otherwise
+// defaultClusterDomain used unless traffic-manager reports otherwise or the configuration overrides it
 const defaultClusterDomain = "cluster.local."
 
 // Server is a DNS server which implements the github.com/miekg/dns Handler interface
@@ -37,6 +40,7 @@ type Server struct {
 	resolve      Resolver
 	requestCount int64
 	cache        sync.Map
+	fwdCache     sync.Map
 	recursive    int32 // 0 = never tested, 1 = not recursive, 2 = recursive
 	cacheResolve func(*dns.Question) []dns.RR
 
@@ -51,6 +55,12 @@ type Server struct {
 	// searchPathCh receives requests to change the search path.
 	searchPathCh chan []string
 
+	// reapplyCh receives requests to apply the current search path anew.
+	reapplyCh chan struct{}
+
+	// lazy is non-nil when mapped namespaces are activated lazily
+	lazy *lazyNamespaces
+
 	config *rpc.DNSConfig
 
 	// clusterDomain reported by the traffic-manager
@@ -58,10 +68,25 @@ type Server struct {
 
 	// Function that sends a lookup requrest to the traffic-manager
 	clusterLookup func(context.Context, string) ([][]byte, error)
+
+	// upstreamResolvers, when not empty, are used instead of the fallback
+	upstreamResolvers []string
+
+	// suffixResolvers are used for all names with a matching suffix
+	suffixResolvers map[string][]string
+
+	// answerObserver, when set, is called with the addresses and the time to live of each A or AAAA answer
+	answerObserver func(ctx context.Context, name string, ipv6 bool, ips []net.IP, ttl time.Duration)
+
+	// Cache counters
+	cacheHits         int64
+	cacheNegativeHits int64
+	cacheMisses       int64
 }
 
 type cacheEntry struct {
 	created   time.Time
+	ttl       time.Duration
 	recursion int32 // will be set to the current qType during call to cluster
 	answer    []dns.RR
 	wait      chan struct{}
@@ -70,8 +95,27 @@ type cacheEntry struct {
 // cacheTTL is the time to live for an entry in the local DNS cache.
 const cacheTTL = 60 * time.Second
 
+// negativeCacheTTL is the time to live for an entry in the local DNS cache that represents a name
+// that wasn't found in the cluster.
+const negativeCacheTTL = 5 * time.Second
+
+// maxForwardCacheTTL is the maximum time to live for a response from an upstream or suffix
+// resolver. The TTL declared in the response is used when it's shorter.
+const maxForwardCacheTTL = 5 * time.Minute
+
+func newCacheEntry() *cacheEntry {
+	return &cacheEntry{wait: make(chan struct{}), created: time.Now(), ttl: cacheTTL}
+}
+
 func (dv *cacheEntry) expired() bool {
-	return time.Since(dv.created) > cacheTTL
+	return time.Since(dv.created) > dv.ttl
+}
+
+// fwdCacheEntry is a cached response from an upstream or suffix resolver
+type fwdCacheEntry struct {
+	created time.Time
+	ttl     time.Duration
+	msg     *dns.Msg
 }
 
 // NewServer returns a new dns.Server
@@ -98,9 +142,13 @@ func NewServer(config *rpc.DNSConfig, clusterLookup func(context.Context, string
 		domains:       make(map[string]struct{}),
 		search:        []string{""},
 		searchPathCh:  make(chan []string, 5),
+		reapplyCh:     make(chan struct{}, 1),
 		clusterDomain: defaultClusterDomain,
 		clusterLookup: clusterLookup,
 	}
+	if config.ClusterDomain != "" {
+		s.clusterDomain = dns.Fqdn(config.ClusterDomain)
+	}
 	s.cacheResolve = s.resolveWithRecursionCheck
 	return s
 }
@@ -120,26 +168,63 @@ const tel2SubDomainDot = tel2SubDomain + "."
 var localhostIPs = []net.IP{{127, 0, 0, 1}, {0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}}
 
 func (s *Server) shouldDoClusterLookup(query string) bool {
+	return s.clusterExclusion(query) == ""
+}
+
+// clusterExclusion returns the reason why the given fully qualified query isn't looked up in the
+// cluster, or an empty string when it is.
+func (s *Server) clusterExclusion(query string) string {
+	// Names with a suffix that is mapped to a namespace are always looked up
+	if _, ok := s.mapSuffixNamespace(query); ok {
+		return ""
+	}
+
 	if strings.HasSuffix(query, "."+s.clusterDomain) && strings.Count(query, ".") < 4 {
-		return false
+		return "too few labels before the cluster domain " + s.clusterDomain
 	}
 
 	query = query[:len(query)-1] // skip last dot
 
-	// Always include configured includeSuffixes
+	// Always include configured includeHosts and includeSuffixes
+	for _, host := range s.config.IncludeHosts {
+		if strings.EqualFold(query, host) {
+			return ""
+		}
+	}
 	for _, sfx := range s.config.IncludeSuffixes {
 		if strings.HasSuffix(query, sfx) {
-			return true
+			return ""
 		}
 	}
 
 	// Skip configured excludeSuffixes
 	for _, sfx := range s.config.ExcludeSuffixes {
 		if strings.HasSuffix(query, sfx) {
-			return false
+			return "excluded suffix " + sfx
+		}
+	}
+	return ""
+}
+
+// mapSuffixNamespace returns the cluster name for a fully qualified query that ends with a suffix
+// that is mapped to a namespace, e.g. "echo.staging.local." becomes "echo.staging." when the
+// suffix "staging.local" is mapped to the namespace "staging". The longest matching suffix wins.
+func (s *Server) mapSuffixNamespace(query string) (string, bool) {
+	if len(s.config.SuffixNamespaces) == 0 {
+		return "", false
+	}
+	name := strings.ToLower(strings.TrimSuffix(query, "."))
+	for dot := strings.IndexByte(name, '.'); dot > 0; {
+		if ns, ok := s.config.SuffixNamespaces[name[dot+1:]]; ok {
+			return name[:dot] + "." + ns + ".", true
 		}
+		next := strings.IndexByte(name[dot+1:], '.')
+		if next < 0 {
+			break
+		}
+		dot += next + 1
 	}
-	return true
+	return "", false
 }
 
 func (s *Server) resolveInCluster(c context.Context, query string) (results []net.IP) {
@@ -157,7 +242,9 @@ func (s *Server) resolveInCluster(c context.Context, query string) (results []ne
 		return localhostIPs
 	}
 
-	if !s.shouldDoClusterLookup(query) {
+	if mapped, ok := s.mapSuffixNamespace(query); ok {
+		query = mapped
+	} else if !s.shouldDoClusterLookup(query) {
 		return nil
 	}
 
@@ -186,16 +273,52 @@ func (s *Server) GetConfig() *rpc.DNSConfig {
 		dnsConfig.LocalIp = s.config.LocalIp
 		dnsConfig.ExcludeSuffixes = s.config.ExcludeSuffixes
 		dnsConfig.IncludeSuffixes = s.config.IncludeSuffixes
+		dnsConfig.IncludeHosts = s.config.IncludeHosts
 		dnsConfig.LookupTimeout = s.config.LookupTimeout
+		dnsConfig.SuffixNamespaces = s.config.SuffixNamespaces
+		dnsConfig.ClusterDomain = s.config.ClusterDomain
 	}
 	return dnsConfig
 }
 
+// GetNetworkConfig returns the DNS part of the network configuration that is in effect.
+func (s *Server) GetNetworkConfig() *rpc.NetworkConfig {
+	nc := &rpc.NetworkConfig{
+		Dns:               s.GetConfig(),
+		ClusterDomain:     s.clusterDomain,
+		UpstreamResolvers: s.upstreamResolvers,
+	}
+	if s.config != nil {
+		nc.Dns.RemoteIp = s.config.RemoteIp
+	}
+	s.domainsLock.RLock()
+	nc.DnsSearchPaths = append(nc.DnsSearchPaths, s.search...)
+	s.domainsLock.RUnlock()
+
+	suffixes := make([]string, 0, len(s.suffixResolvers))
+	for suffix := range s.suffixResolvers {
+		suffixes = append(suffixes, suffix)
+	}
+	sort.Strings(suffixes)
+	for _, suffix := range suffixes {
+		nc.SuffixResolvers = append(nc.SuffixResolvers, &rpc.SuffixResolvers{
+			Suffix:    suffix,
+			Resolvers: s.suffixResolvers[suffix],
+		})
+	}
+	return nc
+}
+
+// SetClusterDomainAndDNS sets the cluster domain and the IP of the cluster's DNS service that were reported
+// by the traffic-manager, unless they are overridden by the configuration.
 func (s *Server) SetClusterDomainAndDNS(domain string, dnsIP net.IP) {
-	s.clusterDomain = domain
 	if s.config == nil {
 		s.config = &rpc.DNSConfig{}
 	}
+	if s.config.ClusterDomain != "" {
+		domain = dns.Fqdn(s.config.ClusterDomain)
+	}
+	s.clusterDomain = domain
 	if s.config.RemoteIp == nil {
 		s.config.RemoteIp = dnsIP
 	}
@@ -220,7 +343,7 @@ func newLocalUDPListener(c context.Context) (net.PacketConn, error) {
 
 func (s *Server) processSearchPaths(g *dgroup.Group, processor func(context.Context, []string, *vif.Device) error, dev *vif.Device) {
 	g.Go("SearchPaths", func(c context.Context) error {
-		var prevPaths []string
+		var prevPaths, requestedPaths []string
 		unchanged := func(paths []string) bool {
 			if len(paths) != len(prevPaths) {
 				return false
@@ -233,33 +356,120 @@ func (s *Server) processSearchPaths(g *dgroup.Group, processor func(context.Cont
 			return true
 		}
 
+		var activated <-chan struct{}
+		var expireTick <-chan time.Time
+		if s.lazy != nil {
+			activated = s.lazy.activated
+			ticker := time.NewTicker(s.lazy.idleTimeout / 2)
+			defer ticker.Stop()
+			expireTick = ticker.C
+		}
+
 		for {
 			select {
 			case <-c.Done():
 				return nil
-			case paths := <-s.searchPathCh:
+			case requestedPaths = <-s.searchPathCh:
 				if len(s.searchPathCh) > 0 {
 					// Only interested in the last one
 					continue
 				}
-				if !unchanged(paths) {
-					dlog.Debugf(c, "%v -> %v", prevPaths, paths)
-					prevPaths = make([]string, len(paths))
-					copy(prevPaths, paths)
-					if err := processor(c, paths, dev); err != nil {
-						return err
-					}
+			case <-activated:
+			case <-s.reapplyCh:
+				dlog.Debug(c, "applying the search paths anew")
+				prevPaths = nil
+			case now := <-expireTick:
+				expired := s.lazy.expire(now)
+				if len(expired) == 0 {
+					continue
+				}
+				dlog.Debugf(c, "deactivating idle namespaces %v", expired)
+			}
+			paths := requestedPaths
+			if s.lazy != nil {
+				paths = s.lazy.effectivePaths(paths)
+			}
+			if !unchanged(paths) {
+				dlog.Debugf(c, "%v -> %v", prevPaths, paths)
+				prevPaths = make([]string, len(paths))
+				copy(prevPaths, paths)
+				if err := processor(c, paths, dev); err != nil {
+					return err
 				}
 			}
 		}
 	})
 }
 
+// NetworkChanged flushes the cache and applies the search paths anew. It's called when the network of the
+// workstation has changed, because that may change both the answers of the local resolvers and how the
+// system's DNS is configured.
+func (s *Server) NetworkChanged() {
+	s.flushDNS()
+	select {
+	case s.reapplyCh <- struct{}{}:
+	default:
+	}
+}
+
+// ServicesChanged flushes the cached entries of names that start with one of the given service names. It's
+// called when services are added, modified, or deleted, so that a service that didn't exist when it was
+// looked up becomes resolvable without waiting for the negative cache entry to expire.
+func (s *Server) ServicesChanged(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	labels := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		labels[strings.ToLower(name)] = struct{}{}
+	}
+	s.cache.Range(func(key, _ interface{}) bool {
+		qName := strings.ToLower(key.(string))
+		if dot := strings.IndexByte(qName, '.'); dot > 0 {
+			qName = qName[:dot]
+		}
+		if _, ok := labels[qName]; ok {
+			s.cache.Delete(key)
+		}
+		return true
+	})
+}
+
 func (s *Server) flushDNS() {
 	s.cache.Range(func(key, _ interface{}) bool {
 		s.cache.Delete(key)
 		return true
 	})
+	s.fwdCache.Range(func(key, _ interface{}) bool {
+		s.fwdCache.Delete(key)
+		return true
+	})
+}
+
+// countCacheHit increments the hit counters for the given cache entry
+func (s *Server) countCacheHit(dv *cacheEntry) {
+	if len(dv.answer) == 0 {
+		atomic.AddInt64(&s.cacheNegativeHits, 1)
+	} else {
+		atomic.AddInt64(&s.cacheHits, 1)
+	}
+}
+
+// CacheStats returns the current counters of the DNS cache.
+func (s *Server) CacheStats() *rpc.DNSCacheStats {
+	entries := int64(0)
+	count := func(_, _ interface{}) bool {
+		entries++
+		return true
+	}
+	s.cache.Range(count)
+	s.fwdCache.Range(count)
+	return &rpc.DNSCacheStats{
+		Hits:         atomic.LoadInt64(&s.cacheHits),
+		NegativeHits: atomic.LoadInt64(&s.cacheNegativeHits),
+		Misses:       atomic.LoadInt64(&s.cacheMisses),
+		Entries:      entries,
+	}
 }
 
 // splitToUDPAddr splits the given address into an UDPAddr. It's
@@ -294,7 +504,7 @@ func copyRRs(rrs []dns.RR, qType uint16) []dns.RR {
 // entry is found that hasn't expired, it's returned. If not, this function will call
 // resolveQuery() to resolve and store in the case.
 func (s *Server) resolveThruCache(q *dns.Question) []dns.RR {
-	newDv := &cacheEntry{wait: make(chan struct{}), created: time.Now()}
+	newDv := newCacheEntry()
 	if v, loaded := s.cache.LoadOrStore(q.Name, newDv); loaded {
 		oldDv := v.(*cacheEntry)
 		if atomic.LoadInt32(&s.recursive) == 2 && atomic.LoadInt32(&oldDv.recursion) == int32(q.Qtype) {
@@ -303,10 +513,12 @@ func (s *Server) resolveThruCache(q *dns.Question) []dns.RR {
 		}
 		<-oldDv.wait
 		if !oldDv.expired() {
+			s.countCacheHit(oldDv)
 			return copyRRs(oldDv.answer, q.Qtype)
 		}
 		s.cache.Store(q.Name, newDv)
 	}
+	atomic.AddInt64(&s.cacheMisses, 1)
 	return s.resolveQuery(q, newDv)
 }
 
@@ -314,7 +526,7 @@ func (s *Server) resolveThruCache(q *dns.Question) []dns.RR {
 // recursionCheck query has completed, and it has been determined whether a query that is propagated
 // to the cluster will recurse back to this resolver or not.
 func (s *Server) resolveWithRecursionCheck(q *dns.Question) []dns.RR {
-	newDv := &cacheEntry{wait: make(chan struct{}), created: time.Now()}
+	newDv := newCacheEntry()
 	if v, loaded := s.cache.LoadOrStore(q.Name, newDv); loaded {
 		oldDv := v.(*cacheEntry)
 		if atomic.LoadInt32(&oldDv.recursion) == int32(q.Qtype) {
@@ -327,11 +539,13 @@ func (s *Server) resolveWithRecursionCheck(q *dns.Question) []dns.RR {
 		}
 		<-oldDv.wait
 		if !oldDv.expired() {
+			s.countCacheHit(oldDv)
 			return copyRRs(oldDv.answer, q.Qtype)
 		}
 		s.cache.Store(q.Name, newDv)
 	}
 
+	atomic.AddInt64(&s.cacheMisses, 1)
 	answer := s.resolveQuery(q, newDv)
 	if q.Name == recursionCheck+"." {
 		if atomic.LoadInt32(&s.recursive) == 2 {
@@ -345,6 +559,15 @@ func (s *Server) resolveWithRecursionCheck(q *dns.Question) []dns.RR {
 	return answer
 }
 
+// The paths that a query can take through the server.
+const (
+	PathSuffixResolver = "suffix-resolver"
+	PathCluster        = "cluster"
+	PathUpstream       = "upstream"
+	PathLocal          = "local"
+	PathNone           = "none"
+)
+
 // ServeDNS is an implementation of github.com/miekg/dns Handler.ServeDNS.
 func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 	c := s.ctx
@@ -354,8 +577,55 @@ func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 			_ = w.Close()
 		}
 	}()
+	s.serveDNS(c, w, r)
+}
 
+// SetAnswerObserver sets a function that is called with the name, the addresses, and the time to live of
+// each A or AAAA answer that the server produces, regardless of how the name was resolved. The function is
+// called before the answer is written, and must not block. It must be called before the server starts.
+func (s *Server) SetAnswerObserver(f func(ctx context.Context, name string, ipv6 bool, ips []net.IP, ttl time.Duration)) {
+	s.answerObserver = f
+}
+
+// observingWriter is a dns.ResponseWriter that passes the addresses of the messages that are written to it
+// to the answer observer of the server.
+type observingWriter struct {
+	dns.ResponseWriter
+	ctx     context.Context
+	observe func(ctx context.Context, name string, ipv6 bool, ips []net.IP, ttl time.Duration)
+}
+
+func (w *observingWriter) WriteMsg(m *dns.Msg) error {
+	if len(m.Question) > 0 && (m.Rcode == dns.RcodeSuccess || m.Rcode == dns.RcodeNameError) {
+		q := &m.Question[0]
+		if q.Qtype == dns.TypeA || q.Qtype == dns.TypeAAAA {
+			var ips []net.IP
+			for _, rr := range m.Answer {
+				switch rr := rr.(type) {
+				case *dns.A:
+					ips = append(ips, rr.A.To4())
+				case *dns.AAAA:
+					ips = append(ips, rr.AAAA)
+				}
+			}
+			w.observe(w.ctx, q.Name, q.Qtype == dns.TypeAAAA, ips, responseTTL(m))
+		}
+	}
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// serveDNS writes the response to the given request and returns the path that produced it.
+func (s *Server) serveDNS(c context.Context, w dns.ResponseWriter, r *dns.Msg) string {
+	if s.answerObserver != nil {
+		w = &observingWriter{ResponseWriter: w, ctx: c, observe: s.answerObserver}
+	}
 	q := &r.Question[0]
+	s.activateNamespace(c, q.Name)
+	if rs := s.suffixResolversFor(q.Name); rs != nil {
+		dlog.Debugf(c, "QTYPE[%v] %s -> SUFFIX RESOLVER", q.Qtype, q.Name)
+		s.forward(c, w, r, rs)
+		return PathSuffixResolver
+	}
 	if atomic.CompareAndSwapInt64(&s.requestCount, 0, 1) {
 		// Perform the first recursion check query
 		go func() {
@@ -386,23 +656,156 @@ func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 		// from intercepting all queries
 		msg.RecursionAvailable = true
 		_ = w.WriteMsg(msg)
-	} else {
-		if s.fallback != nil {
-			dlog.Debugf(c, "QTYPE[%v] %s -> FALLBACK", q.Qtype, q.Name)
-			client := dns.Client{Net: "udp"}
-			in, _, err := client.ExchangeWithConn(r, s.fallback)
-			if err != nil {
-				dlog.Error(c, err)
-				return
-			}
+		return PathCluster
+	}
+
+	switch {
+	case len(s.upstreamResolvers) > 0:
+		dlog.Debugf(c, "QTYPE[%v] %s -> UPSTREAM", q.Qtype, q.Name)
+		s.forward(c, w, r, s.upstreamResolvers)
+		return PathUpstream
+	case s.fallback != nil:
+		dlog.Debugf(c, "QTYPE[%v] %s -> FALLBACK", q.Qtype, q.Name)
+		client := dns.Client{Net: "udp"}
+		in, _, err := client.ExchangeWithConn(r, s.fallback)
+		if err != nil {
+			dlog.Error(c, err)
+		} else {
 			_ = w.WriteMsg(in)
+		}
+		return PathLocal
+	default:
+		dlog.Debugf(c, "QTYPE[%v] %s -> NOT FOUND", q.Qtype, q.Name)
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		_ = w.WriteMsg(m)
+		return PathNone
+	}
+}
+
+// suffixResolversFor returns the resolvers configured for the longest suffix that matches the
+// given fully qualified name, or nil when no suffix matches.
+func (s *Server) suffixResolversFor(name string) []string {
+	if len(s.suffixResolvers) == 0 {
+		return nil
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for {
+		if rs, ok := s.suffixResolvers[name]; ok {
+			return rs
+		}
+		dot := strings.IndexByte(name, '.')
+		if dot < 0 {
+			return nil
+		}
+		name = name[dot+1:]
+	}
+}
+
+// forward sends the given request to the given resolvers, in order, and writes the first
+// successful response. The fallback connection is used for a resolver that is the fallback
+// because it's exempt from the DNS redirect rules on Linux.
+func (s *Server) forward(c context.Context, w dns.ResponseWriter, r *dns.Msg, resolvers []string) {
+	q := &r.Question[0]
+	key := fwdCacheKey(q)
+	if v, ok := s.fwdCache.Load(key); ok {
+		fe := v.(*fwdCacheEntry)
+		if elapsed := time.Since(fe.created); elapsed < fe.ttl {
+			if fe.msg.Rcode == dns.RcodeNameError {
+				atomic.AddInt64(&s.cacheNegativeHits, 1)
+			} else {
+				atomic.AddInt64(&s.cacheHits, 1)
+			}
+			_ = w.WriteMsg(agedReply(fe.msg, r, elapsed))
+			return
+		}
+		s.fwdCache.Delete(key)
+	}
+	atomic.AddInt64(&s.cacheMisses, 1)
+
+	dnsClient := dns.Client{Net: "udp", Timeout: s.config.LookupTimeout.AsDuration()}
+	var err error
+	for _, addr := range resolvers {
+		var in *dns.Msg
+		if s.fallback != nil && s.fallback.RemoteAddr().String() == addr {
+			in, _, err = dnsClient.ExchangeWithConn(r, s.fallback)
 		} else {
-			dlog.Debugf(c, "QTYPE[%v] %s -> NOT FOUND", q.Qtype, q.Name)
-			m := new(dns.Msg)
-			m.SetRcode(r, dns.RcodeNameError)
-			_ = w.WriteMsg(m)
+			in, _, err = dnsClient.ExchangeContext(c, r, addr)
+		}
+		if err == nil {
+			if ttl := responseTTL(in); ttl > 0 {
+				s.fwdCache.Store(key, &fwdCacheEntry{created: time.Now(), ttl: ttl, msg: in.Copy()})
+			}
+			_ = w.WriteMsg(in)
+			return
 		}
+		dlog.Debugf(c, "resolver %s failed: %v", addr, err)
 	}
+	dlog.Error(c, err)
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeServerFailure)
+	_ = w.WriteMsg(m)
+}
+
+func fwdCacheKey(q *dns.Question) string {
+	return fmt.Sprintf("%s/%d/%d", strings.ToLower(q.Name), q.Qtype, q.Qclass)
+}
+
+// responseTTL returns the time that the given response can be cached. Successful responses
+// are cached using the smallest TTL of its answers, and name errors are cached using the
+// negative TTL of the SOA record in the authority section (RFC 2308). Other responses
+// aren't cached.
+func responseTTL(m *dns.Msg) time.Duration {
+	var ttl uint32
+	switch m.Rcode {
+	case dns.RcodeSuccess:
+		if len(m.Answer) == 0 {
+			return 0
+		}
+		ttl = math.MaxUint32
+		for _, rr := range m.Answer {
+			if t := rr.Header().Ttl; t < ttl {
+				ttl = t
+			}
+		}
+	case dns.RcodeNameError:
+		for _, rr := range m.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl = soa.Hdr.Ttl
+				if soa.Minttl < ttl {
+					ttl = soa.Minttl
+				}
+				break
+			}
+		}
+	}
+	d := time.Duration(ttl) * time.Second
+	if d > maxForwardCacheTTL {
+		d = maxForwardCacheTTL
+	}
+	return d
+}
+
+// agedReply returns a copy of the cached response that replies to the given request, with the
+// TTL of each record reduced by the time elapsed since the response was cached.
+func agedReply(cached, r *dns.Msg, elapsed time.Duration) *dns.Msg {
+	m := cached.Copy()
+	m.Id = r.Id
+	age := uint32(elapsed / time.Second)
+	for _, rrs := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range rrs {
+			h := rr.Header()
+			if h.Rrtype == dns.TypeOPT {
+				continue
+			}
+			if h.Ttl > age {
+				h.Ttl -= age
+			} else {
+				h.Ttl = 0
+			}
+		}
+	}
+	return m
 }
 
 // dnsTTL is the number of seconds that a found DNS record should be allowed to live in the callers cache. We
@@ -447,7 +850,8 @@ func (s *Server) resolveQuery(q *dns.Question, dv *cacheEntry) []dns.RR {
 		}
 	}
 	if len(dv.answer) == 0 {
-		s.cache.Delete(q.Name) // Don't cache unless the entry is found.
+		// Cache that the name wasn't found, but only for a short while.
+		dv.ttl = negativeCacheTTL
 	}
 
 	// Return a result for the correct query type. The result will be nil (nxdomain) if nothing was found. It might
@@ -461,6 +865,10 @@ func (s *Server) Run(c context.Context, initDone chan<- struct{}, listeners []ne
 	s.ctx = c
 	s.fallback = fallback
 	s.resolve = resolve
+	if cfg := client.GetConfig(c); cfg != nil {
+		s.upstreamResolvers = cfg.DNS.UpstreamResolvers
+		s.suffixResolvers = cfg.DNS.SuffixResolvers
+	}
 
 	g := dgroup.NewGroup(c, dgroup.GroupConfig{})
 	for _, listener := range listeners {
@@ -129,6 +129,13 @@ func (r *resolveFile) setSearchPaths(paths ...string) {
 //   man 5 resolver
 //
 // or, if not on a Mac, follow this link: https://www.manpagez.com/man/5/resolver/
+// ReceivesAllNames returns true if all names are sent to the server, and not only those in the domains
+// that it's configured with. It's always false, because macOS only sends the names in the domains that
+// have a file in /etc/resolver.
+func (s *Server) ReceivesAllNames(context.Context) bool {
+	return false
+}
+
 func (s *Server) Worker(c context.Context, dev *vif.Device, configureDNS func(net.IP, *net.UDPAddr)) error {
 	resolverDirName := filepath.Join("/etc", "resolver")
 	resolverFileName := filepath.Join(resolverDirName, "telepresence.local")
@@ -203,14 +210,20 @@ func (s *Server) updateResolverFiles(c context.Context, resolverDirName, resolve
 	}
 	namespaces[tel2SubDomain] = struct{}{}
 
-	// All namespaces and include suffixes become domains
-	domains := make(map[string]struct{}, len(namespaces)+len(s.config.IncludeSuffixes))
+	// All namespaces, include hosts and suffixes, and suffixes mapped to namespaces become domains
+	domains := make(map[string]struct{}, len(namespaces)+len(s.config.IncludeHosts)+len(s.config.IncludeSuffixes)+len(s.config.SuffixNamespaces))
 	for ns, v := range namespaces {
 		domains[ns] = v
 	}
+	for _, host := range s.config.IncludeHosts {
+		domains[host] = struct{}{}
+	}
 	for _, sfx := range s.config.IncludeSuffixes {
 		domains[strings.TrimPrefix(sfx, ".")] = struct{}{}
 	}
+	for sfx := range s.config.SuffixNamespaces {
+		domains[sfx] = struct{}{}
+	}
 
 	s.domainsLock.Lock()
 	defer s.domainsLock.Unlock()
@@ -17,6 +17,7 @@ import (
 	"github.com/datawire/dlib/dgroup"
 	"github.com/datawire/dlib/dlog"
 	"github.com/datawire/dlib/dtime"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/rootd/dbus"
 	"github.com/telepresenceio/telepresence/v2/pkg/vif"
 )
 
@@ -54,6 +55,11 @@ func (s *Server) shouldApplySearch(query string) bool {
 		return false
 	}
 
+	// Don't apply search paths to names that are mapped to a namespace
+	if _, ok := s.mapSuffixNamespace(query); ok {
+		return false
+	}
+
 	// Don't apply search paths if one is already there
 	for _, s := range s.search {
 		if strings.HasSuffix(query, s) {
@@ -267,6 +273,13 @@ func (s *Server) dnsListeners(c context.Context) ([]net.PacketConn, error) {
 	}
 }
 
+// ReceivesAllNames returns true if all names are sent to the server, and not only those in the domains
+// that it's configured with. That's the case for the overriding resolver, which Worker only falls back
+// to when systemd-resolved isn't running or when running in a docker container.
+func (s *Server) ReceivesAllNames(c context.Context) bool {
+	return runningInDocker() || !dbus.IsResolveDRunning(c)
+}
+
 func runningInDocker() bool {
 	_, err := os.Stat("/.dockerenv")
 	return err == nil
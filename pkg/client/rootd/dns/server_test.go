@@ -0,0 +1,206 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/daemon"
+)
+
+func TestServer_cache(t *testing.T) {
+	lookups := 0
+	s := NewServer(nil, nil)
+	s.ctx = dlog.NewTestContext(t, false)
+	s.resolve = func(_ context.Context, name string) []net.IP {
+		lookups++
+		if name == "found.ns." {
+			return []net.IP{{10, 0, 0, 1}}
+		}
+		return nil
+	}
+	s.cacheResolve = s.resolveThruCache
+
+	found := &dns.Question{Name: "found.ns.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	missing := &dns.Question{Name: "missing.ns.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	for i := 0; i < 3; i++ {
+		assert.Len(t, s.cacheResolve(found), 1)
+		assert.Nil(t, s.cacheResolve(missing))
+	}
+	assert.Equal(t, 2, lookups)
+
+	stats := s.CacheStats()
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, int64(2), stats.NegativeHits)
+	assert.Equal(t, int64(2), stats.Misses)
+	assert.Equal(t, int64(2), stats.Entries)
+
+	// A negative entry expires quickly
+	v, _ := s.cache.Load(missing.Name)
+	v.(*cacheEntry).created = time.Now().Add(-negativeCacheTTL - time.Second)
+	assert.Nil(t, s.cacheResolve(missing))
+	assert.Equal(t, 3, lookups)
+}
+
+func TestServer_ServicesChanged(t *testing.T) {
+	created := false
+	lookups := 0
+	s := NewServer(nil, nil)
+	s.ctx = dlog.NewTestContext(t, false)
+	s.resolve = func(_ context.Context, name string) []net.IP {
+		lookups++
+		if created && name == "new.ns." {
+			return []net.IP{{10, 0, 0, 2}}
+		}
+		return nil
+	}
+	s.cacheResolve = s.resolveThruCache
+
+	q := &dns.Question{Name: "new.ns.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	other := &dns.Question{Name: "other.ns.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	assert.Nil(t, s.cacheResolve(q))
+	assert.Nil(t, s.cacheResolve(other))
+	assert.Equal(t, 2, lookups)
+
+	// The service is created. The negative entry of its name is dropped, but not the one of other names.
+	created = true
+	s.ServicesChanged([]string{"new"})
+	assert.Len(t, s.cacheResolve(q), 1)
+	assert.Nil(t, s.cacheResolve(other))
+	assert.Equal(t, 3, lookups)
+}
+
+func Test_responseTTL(t *testing.T) {
+	a := func(ttl uint32) dns.RR {
+		return &dns.A{Hdr: dns.RR_Header{Name: "x.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl}, A: net.IP{1, 2, 3, 4}}
+	}
+	m := &dns.Msg{Answer: []dns.RR{a(300), a(30)}}
+	assert.Equal(t, 30*time.Second, responseTTL(m))
+
+	m = &dns.Msg{Answer: []dns.RR{a(86400)}}
+	assert.Equal(t, maxForwardCacheTTL, responseTTL(m))
+
+	m = &dns.Msg{}
+	m.Rcode = dns.RcodeNameError
+	assert.Equal(t, time.Duration(0), responseTTL(m))
+	m.Ns = []dns.RR{&dns.SOA{Hdr: dns.RR_Header{Name: "x.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 600}, Minttl: 60}}
+	assert.Equal(t, 60*time.Second, responseTTL(m))
+
+	m = &dns.Msg{Answer: []dns.RR{a(300)}}
+	m.Rcode = dns.RcodeServerFailure
+	assert.Equal(t, time.Duration(0), responseTTL(m))
+
+	r := &dns.Msg{}
+	r.Id = 4711
+	m = &dns.Msg{Answer: []dns.RR{a(30)}}
+	aged := agedReply(m, r, 10*time.Second)
+	assert.Equal(t, uint16(4711), aged.Id)
+	assert.Equal(t, uint32(20), aged.Answer[0].Header().Ttl)
+	assert.Equal(t, uint32(30), m.Answer[0].Header().Ttl)
+	assert.Equal(t, uint32(0), agedReply(m, r, time.Minute).Answer[0].Header().Ttl)
+}
+
+func TestServer_suffixNamespaces(t *testing.T) {
+	var looked []string
+	s := NewServer(&rpc.DNSConfig{SuffixNamespaces: map[string]string{
+		"staging.local": "staging",
+		"example.com":   "prod",
+	}}, func(_ context.Context, name string) ([][]byte, error) {
+		looked = append(looked, name)
+		return [][]byte{{10, 0, 0, 1}}, nil
+	})
+	c := dlog.NewTestContext(t, false)
+
+	assert.Len(t, s.resolveInCluster(c, "echo.Staging.Local."), 1)
+	assert.Len(t, s.resolveInCluster(c, "web.example.com."), 1, "mapped suffix must bypass the excluded .com")
+	assert.Nil(t, s.resolveInCluster(c, "web.other.com."))
+	assert.Equal(t, []string{"echo.staging", "web.prod"}, looked)
+
+	_, ok := s.mapSuffixNamespace("staging.local.")
+	assert.False(t, ok, "the suffix itself is not a name in the namespace")
+	mapped, ok := s.mapSuffixNamespace("a.b.staging.local.")
+	assert.True(t, ok)
+	assert.Equal(t, "a.b.staging.", mapped)
+}
+
+func TestServer_includeHosts(t *testing.T) {
+	var looked []string
+	s := NewServer(&rpc.DNSConfig{
+		IncludeHosts:    []string{"db.partner.example.com"},
+		IncludeSuffixes: []string{".svc.example.com"},
+	}, func(_ context.Context, name string) ([][]byte, error) {
+		looked = append(looked, name)
+		return [][]byte{{10, 0, 0, 1}}, nil
+	})
+	c := dlog.NewTestContext(t, false)
+
+	// A host only includes the name itself, whereas a suffix includes all names that end with it
+	assert.Len(t, s.resolveInCluster(c, "DB.partner.example.com."), 1)
+	assert.Nil(t, s.resolveInCluster(c, "mydb.partner.example.com."))
+	assert.Nil(t, s.resolveInCluster(c, "x.db.partner.example.com."))
+	assert.Len(t, s.resolveInCluster(c, "web.svc.example.com."), 1)
+	assert.Equal(t, []string{"db.partner.example.com", "web.svc.example.com"}, looked)
+}
+
+func TestServer_dualStack(t *testing.T) {
+	s := NewServer(nil, nil)
+	s.ctx = dlog.NewTestContext(t, false)
+	s.resolve = func(_ context.Context, name string) []net.IP {
+		return []net.IP{{10, 96, 0, 10}, net.ParseIP("fd00:10:96::a")}
+	}
+	s.cacheResolve = s.resolveThruCache
+
+	rrs := s.cacheResolve(&dns.Question{Name: "echo.ns.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	if assert.Len(t, rrs, 1) {
+		assert.Equal(t, "10.96.0.10", rrs[0].(*dns.A).A.String())
+	}
+	rrs = s.cacheResolve(&dns.Question{Name: "echo.ns.", Qtype: dns.TypeAAAA, Qclass: dns.ClassINET})
+	if assert.Len(t, rrs, 1) {
+		assert.Equal(t, "fd00:10:96::a", rrs[0].(*dns.AAAA).AAAA.String())
+	}
+}
+
+func TestServer_lazyNamespaces(t *testing.T) {
+	s := NewServer(nil, nil)
+	s.SetLazyNamespaces(time.Minute)
+	ln := s.lazy
+
+	paths := []string{"default", "kube-system", "staging", "echo.svc.cluster.local."}
+	assert.Equal(t, []string{"echo.svc.cluster.local."}, ln.effectivePaths(paths))
+
+	now := time.Now()
+	assert.Equal(t, "staging", s.queryNamespace("web.staging.svc.cluster.local."))
+	assert.Equal(t, "staging", s.queryNamespace("web.staging."))
+	assert.Equal(t, "staging", s.queryNamespace("web.Staging.tel2-search."))
+	assert.True(t, ln.touch(s.queryNamespace("web.staging."), now))
+	assert.False(t, ln.touch("staging", now), "already active")
+	assert.False(t, ln.touch("other", now), "not mapped")
+	assert.Len(t, ln.activated, 1)
+	assert.Equal(t, []string{"staging", "echo.svc.cluster.local."}, ln.effectivePaths(paths))
+
+	// Unmapping a namespace deactivates it
+	assert.Empty(t, ln.effectivePaths([]string{"default"}))
+	assert.Empty(t, ln.active)
+
+	assert.True(t, ln.touch("default", now))
+	assert.Empty(t, ln.expire(now.Add(30*time.Second)))
+	assert.Equal(t, []string{"default"}, ln.expire(now.Add(2*time.Minute)))
+	assert.Empty(t, ln.effectivePaths([]string{"default"}))
+}
+
+func TestServer_SetClusterDomainAndDNS(t *testing.T) {
+	s := NewServer(nil, nil)
+	s.SetClusterDomainAndDNS("k8s.example.", net.IP{10, 43, 0, 10})
+	assert.Equal(t, "k8s.example.", s.GetNetworkConfig().ClusterDomain)
+
+	// A configured domain overrides the one reported by the traffic-manager
+	s = NewServer(&rpc.DNSConfig{ClusterDomain: "rancher.internal"}, nil)
+	assert.Equal(t, "rancher.internal.", s.clusterDomain)
+	s.SetClusterDomainAndDNS("cluster.local.", net.IP{10, 43, 0, 10})
+	assert.Equal(t, "rancher.internal.", s.GetNetworkConfig().ClusterDomain)
+}
@@ -10,6 +10,13 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/vif"
 )
 
+// ReceivesAllNames returns true if all names are sent to the server, and not only those in the domains
+// that it's configured with. It's always false, because Windows only sends the names in the DNS domain
+// and the search list of the network adapter.
+func (s *Server) ReceivesAllNames(context.Context) bool {
+	return false
+}
+
 func (s *Server) Worker(c context.Context, dev *vif.Device, configureDNS func(net.IP, *net.UDPAddr)) error {
 	listener, err := newLocalUDPListener(c)
 	if err != nil {
@@ -0,0 +1,37 @@
+package rootd
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+type peerPIDKey struct{}
+
+// withPeerCredentials returns a context that carries the process ID of the peer of the given
+// connection, provided that it's a unix socket connection.
+func withPeerCredentials(ctx context.Context, c net.Conn) context.Context {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return ctx
+	}
+	var cred *unix.Ucred
+	if err = rc.Control(func(fd uintptr) {
+		cred, err = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil || cred == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, peerPIDKey{}, int(cred.Pid))
+}
+
+// peerPID returns the process ID of the process at the other end of the connection that
+// the given request context belongs to.
+func peerPID(ctx context.Context) (int, bool) {
+	pid, ok := ctx.Value(peerPIDKey{}).(int)
+	return pid, ok
+}
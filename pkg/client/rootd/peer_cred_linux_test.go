@@ -0,0 +1,35 @@
+package rootd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_withPeerCredentials(t *testing.T) {
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "socket"))
+	require.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		if c, err := net.Dial("unix", l.Addr().String()); err == nil {
+			defer c.Close()
+			_, _ = c.Read(make([]byte, 1))
+		}
+	}()
+	c, err := l.Accept()
+	require.NoError(t, err)
+	defer c.Close()
+
+	pid, ok := peerPID(withPeerCredentials(context.Background(), c))
+	assert.True(t, ok)
+	assert.Equal(t, os.Getpid(), pid)
+
+	_, ok = peerPID(context.Background())
+	assert.False(t, ok)
+}
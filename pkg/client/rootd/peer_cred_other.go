@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package rootd
+
+import (
+	"context"
+	"net"
+)
+
+func withPeerCredentials(ctx context.Context, _ net.Conn) context.Context {
+	return ctx
+}
+
+func peerPID(context.Context) (int, bool) {
+	return 0, false
+}
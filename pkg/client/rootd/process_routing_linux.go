@@ -0,0 +1,320 @@
+package rootd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/datawire/dlib/dexec"
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif"
+)
+
+const (
+	// processRoutingTable is the routing table that holds the routes of the TUN device when process
+	// routing is enabled.
+	processRoutingTable = 7210
+
+	// processRoutingMark is the packet mark of the traffic of the routed processes.
+	processRoutingMark = 0x7e1
+
+	// processRoutingRulePriority is the priority of the policy rule that directs marked traffic to the
+	// routing table. It must be lower than the priority of the rule for the main table, which is 32766.
+	processRoutingRulePriority = 5210
+
+	cgroupRoot     = "/sys/fs/cgroup"
+	srcValidMarkFn = "/proc/sys/net/ipv4/conf/all/src_valid_mark"
+
+	// maxStaleRules is the maximum number of copies of a rule that are removed before the rule is added.
+	maxStaleRules = 16
+)
+
+// processRoutingCommand is a command that configures process routing and the command that reverts it.
+type processRoutingCommand struct {
+	do   []string
+	undo []string
+
+	// ipv6 is true for commands that concern IPv6, which are allowed to fail because IPv6
+	// may not be available.
+	ipv6 bool
+}
+
+// processRoutingCommands returns the commands that make the traffic of the processes in the given
+// cgroup go through the given device. The packets of those processes are marked, the marked packets
+// are routed using the routing table of the device, and the mark is restored on the replies, so that
+// the reverse path filter finds the device when it checks their source.
+func processRoutingCommands(dev, cgroup string) []processRoutingCommand {
+	mark := fmt.Sprintf("%#x", processRoutingMark)
+	rule := []string{"fwmark", mark, "lookup", strconv.Itoa(processRoutingTable), "priority", strconv.Itoa(processRoutingRulePriority)}
+	var cmds []processRoutingCommand
+	for _, ipv6 := range []bool{false, true} {
+		family, iptables := "-4", "iptables"
+		if ipv6 {
+			family, iptables = "-6", "ip6tables"
+		}
+		cmds = append(cmds, processRoutingCommand{
+			do:   append([]string{"ip", family, "rule", "add"}, rule...),
+			undo: append([]string{"ip", family, "rule", "del"}, rule...),
+			ipv6: ipv6,
+		})
+		for _, chainRule := range [][]string{
+			{"OUTPUT", "-m", "cgroup", "--path", cgroup, "-j", "MARK", "--set-mark", mark},
+			{"OUTPUT", "-m", "mark", "--mark", mark, "-j", "CONNMARK", "--save-mark"},
+			{"PREROUTING", "-i", dev, "-j", "CONNMARK", "--restore-mark"},
+		} {
+			cmds = append(cmds, processRoutingCommand{
+				do:   append([]string{iptables, "-t", "mangle", "-A"}, chainRule...),
+				undo: append([]string{iptables, "-t", "mangle", "-D"}, chainRule...),
+				ipv6: ipv6,
+			})
+		}
+	}
+	return cmds
+}
+
+// processRouter routes the traffic of the processes in a cgroup, and only that traffic, through the
+// TUN device of the session.
+type processRouter struct {
+	// cgroup is the path of the cgroup, relative to the root of the cgroup hierarchy
+	cgroup string
+
+	// undo are the commands that revert the configuration, in the order that they were applied
+	undo [][]string
+
+	// srcValidMark is the original content of the src_valid_mark setting, or nil if it wasn't changed
+	srcValidMark []byte
+}
+
+// newProcessRouter makes the given device route only the traffic of the processes that are added to
+// the returned router. It must be called before any subnets are added to the device.
+func newProcessRouter(ctx context.Context, dev *vif.Device) (*processRouter, error) {
+	if err := client.CheckProcessRouting(); err != nil {
+		return nil, err
+	}
+	for _, cmd := range []string{"ip", "iptables"} {
+		if _, err := exec.LookPath(cmd); err != nil {
+			return nil, errcat.User.Newf("process routing requires the %q command, which the root daemon can't find", cmd)
+		}
+	}
+	if err := dev.SetRoutingTable(processRoutingTable); err != nil {
+		return nil, err
+	}
+	p := &processRouter{cgroup: "telepresence-" + dev.Name()}
+	if err := os.Mkdir(filepath.Join(cgroupRoot, p.cgroup), 0755); err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("unable to create cgroup %s: %w", p.cgroup, err)
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			p.stop(ctx)
+		}
+	}()
+
+	for _, cmd := range processRoutingCommands(dev.Name(), p.cgroup) {
+		// A session that ended without reverting its configuration leaves rules behind that would now be
+		// duplicated, so they are removed first.
+		for i := 0; i < maxStaleRules; i++ {
+			rm := dexec.CommandContext(ctx, cmd.undo[0], cmd.undo[1:]...)
+			rm.DisableLogging = true
+			if err := rm.Run(); err != nil {
+				break
+			}
+			dlog.Debugf(ctx, "removed a stale rule using %q", strings.Join(cmd.undo, " "))
+		}
+		if err := dexec.CommandContext(ctx, cmd.do[0], cmd.do[1:]...).Run(); err != nil {
+			if cmd.ipv6 {
+				dlog.Warnf(ctx, "IPv6 traffic will not be routed by process: %q failed: %v", strings.Join(cmd.do, " "), err)
+				continue
+			}
+			return nil, fmt.Errorf("unable to configure process routing: %q failed: %w", strings.Join(cmd.do, " "), err)
+		}
+		p.undo = append(p.undo, cmd.undo)
+	}
+
+	// Replies are only accepted by a strict reverse path filter when it takes the mark into account
+	if old, err := os.ReadFile(srcValidMarkFn); err == nil && strings.TrimSpace(string(old)) != "1" {
+		if err = os.WriteFile(srcValidMarkFn, []byte("1"), 0644); err != nil {
+			return nil, fmt.Errorf("unable to enable %s: %w", srcValidMarkFn, err)
+		}
+		p.srcValidMark = old
+	}
+	ok = true
+	return p, nil
+}
+
+// addProcess moves the process with the given ID into the cgroup, so that its traffic, and that of the
+// processes that it starts from then on, is routed through the TUN device.
+func (p *processRouter) addProcess(ctx context.Context, pid int) error {
+	dlog.Infof(ctx, "Routing the traffic of process %d", pid)
+	if err := os.WriteFile(filepath.Join(cgroupRoot, p.cgroup, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return fmt.Errorf("unable to route the traffic of process %d: %w", pid, err)
+	}
+	return nil
+}
+
+// stop reverts the configuration. Processes that remain in the cgroup are moved back to the root of
+// the cgroup hierarchy, so that the cgroup can be removed.
+func (p *processRouter) stop(ctx context.Context) {
+	for i := len(p.undo) - 1; i >= 0; i-- {
+		cmd := p.undo[i]
+		if err := dexec.CommandContext(ctx, cmd[0], cmd[1:]...).Run(); err != nil {
+			dlog.Warnf(ctx, "%q failed: %v", strings.Join(cmd, " "), err)
+		}
+	}
+	p.undo = nil
+	if p.srcValidMark != nil {
+		if err := os.WriteFile(srcValidMarkFn, p.srcValidMark, 0644); err != nil {
+			dlog.Warnf(ctx, "unable to restore %s: %v", srcValidMarkFn, err)
+		}
+		p.srcValidMark = nil
+	}
+
+	if err := removeCgroup(ctx, p.cgroup); err != nil {
+		dlog.Warn(ctx, err)
+	}
+}
+
+// removeCgroup moves the processes in the given cgroup back to the root of the cgroup hierarchy, and removes
+// the cgroup.
+func removeCgroup(ctx context.Context, cgroup string) error {
+	dir := filepath.Join(cgroupRoot, cgroup)
+	if procs, err := os.ReadFile(filepath.Join(dir, "cgroup.procs")); err == nil {
+		for _, pid := range strings.Fields(string(procs)) {
+			if err = os.WriteFile(filepath.Join(cgroupRoot, "cgroup.procs"), []byte(pid), 0644); err != nil {
+				dlog.Warnf(ctx, "unable to move process %s out of cgroup %s: %v", pid, cgroup, err)
+			}
+		}
+	}
+	if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove cgroup %s: %w", cgroup, err)
+	}
+	return nil
+}
+
+// ProcessRoutingLeftover is a part of the process routing configuration that a root daemon left behind
+// because it didn't get the chance to revert it.
+type ProcessRoutingLeftover struct {
+	// Description describes the leftover
+	Description string
+
+	// undo is the command that removes a rule
+	undo []string
+
+	// cgroup is the cgroup to remove, when undo is empty
+	cgroup string
+
+	// err is the error that prevented the rules from being listed
+	err error
+}
+
+// Remove removes the leftover. An error that is caused by insufficient privileges wraps os.ErrPermission.
+func (l *ProcessRoutingLeftover) Remove(ctx context.Context) error {
+	switch {
+	case l.err != nil:
+		return l.err
+	case len(l.undo) > 0:
+		cmd := dexec.CommandContext(ctx, l.undo[0], l.undo[1:]...)
+		cmd.DisableLogging = true
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return privilegeError(fmt.Errorf("%q failed: %w: %s", strings.Join(l.undo, " "), err, strings.TrimSpace(string(out))))
+		}
+		return nil
+	default:
+		return removeCgroup(ctx, l.cgroup)
+	}
+}
+
+// privilegeError makes the given error wrap os.ErrPermission when the process isn't running as root.
+func privilegeError(err error) error {
+	if os.Geteuid() != 0 && !errors.Is(err, os.ErrPermission) {
+		err = fmt.Errorf("%v: %w", err, os.ErrPermission)
+	}
+	return err
+}
+
+// ProcessRoutingLeftovers returns the process routing configuration that root daemons left behind: the
+// policy rules, the mangle rules, and the cgroups. Listing the mangle rules requires root, so when there
+// are other leftovers and the rules can't be listed, a leftover that can't be removed is returned in their
+// place.
+func ProcessRoutingLeftovers(ctx context.Context) ([]*ProcessRoutingLeftover, error) {
+	var ls []*ProcessRoutingLeftover
+	mark := fmt.Sprintf("%#x", processRoutingMark)
+	rule := []string{"fwmark", mark, "lookup", strconv.Itoa(processRoutingTable), "priority", strconv.Itoa(processRoutingRulePriority)}
+	for _, family := range []string{"-4", "-6"} {
+		cmd := dexec.CommandContext(ctx, "ip", family, "rule", "show")
+		cmd.DisableLogging = true
+		out, err := cmd.Output()
+		if err != nil {
+			// There's no ip command, or no IPv6
+			continue
+		}
+		n := strings.Count(string(out), fmt.Sprintf("fwmark %s lookup %d", mark, processRoutingTable))
+		for i := 0; i < n; i++ {
+			ls = append(ls, &ProcessRoutingLeftover{
+				Description: fmt.Sprintf("the IPv%s policy rule \"%s\"", family[1:], strings.Join(rule, " ")),
+				undo:        append([]string{"ip", family, "rule", "del"}, rule...),
+			})
+		}
+	}
+
+	cgroups, err := filepath.Glob(filepath.Join(cgroupRoot, "telepresence-*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range cgroups {
+		cgroup := filepath.Base(dir)
+		ls = append(ls, &ProcessRoutingLeftover{Description: "the cgroup " + cgroup, cgroup: cgroup})
+	}
+
+	var mangle []*ProcessRoutingLeftover
+	for _, iptables := range []string{"iptables", "ip6tables"} {
+		if _, err = exec.LookPath(iptables); err != nil {
+			continue
+		}
+		cmd := dexec.CommandContext(ctx, iptables, "-t", "mangle", "-S")
+		cmd.DisableLogging = true
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			if len(ls) > 0 {
+				mangle = append(mangle, &ProcessRoutingLeftover{
+					Description: fmt.Sprintf("the %s mangle rules of process routing", iptables),
+					err:         privilegeError(fmt.Errorf("unable to list the %s mangle rules: %w: %s", iptables, err, strings.TrimSpace(string(out)))),
+				})
+			}
+			continue
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if isProcessRoutingRule(line, mark) {
+				args := strings.Fields(line)
+				mangle = append(mangle, &ProcessRoutingLeftover{
+					Description: fmt.Sprintf("the %s mangle rule \"%s\"", iptables, line),
+					undo:        append([]string{iptables, "-t", "mangle", "-D"}, args[1:]...),
+				})
+			}
+		}
+	}
+
+	// The rules are removed before the cgroups, because a cgroup can't be removed while a rule refers to it
+	return append(mangle, ls...), nil
+}
+
+// isProcessRoutingRule returns true if the given line of "iptables -S" output is one of the mangle rules of
+// process routing.
+func isProcessRoutingRule(line, mark string) bool {
+	switch {
+	case strings.HasPrefix(line, "-A OUTPUT "):
+		return strings.Contains(line, " --path telepresence-") ||
+			strings.Contains(line, " --mark "+mark+" ") && strings.Contains(line, " --save-mark")
+	case strings.HasPrefix(line, "-A PREROUTING -i tel"):
+		return strings.Contains(line, " --restore-mark")
+	default:
+		return false
+	}
+}
@@ -0,0 +1,50 @@
+package rootd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_processRoutingCommands(t *testing.T) {
+	cmds := processRoutingCommands("tel0", "telepresence-tel0")
+	var do []string
+	for i, cmd := range cmds {
+		do = append(do, strings.Join(cmd.do, " "))
+		assert.Equal(t, i >= len(cmds)/2, cmd.ipv6)
+	}
+	assert.Equal(t, []string{
+		"ip -4 rule add fwmark 0x7e1 lookup 7210 priority 5210",
+		"iptables -t mangle -A OUTPUT -m cgroup --path telepresence-tel0 -j MARK --set-mark 0x7e1",
+		"iptables -t mangle -A OUTPUT -m mark --mark 0x7e1 -j CONNMARK --save-mark",
+		"iptables -t mangle -A PREROUTING -i tel0 -j CONNMARK --restore-mark",
+		"ip -6 rule add fwmark 0x7e1 lookup 7210 priority 5210",
+		"ip6tables -t mangle -A OUTPUT -m cgroup --path telepresence-tel0 -j MARK --set-mark 0x7e1",
+		"ip6tables -t mangle -A OUTPUT -m mark --mark 0x7e1 -j CONNMARK --save-mark",
+		"ip6tables -t mangle -A PREROUTING -i tel0 -j CONNMARK --restore-mark",
+	}, do)
+
+	// Each command is reverted by deleting what it added
+	for _, cmd := range cmds {
+		undo := strings.Join(cmd.undo, " ")
+		undo = strings.Replace(undo, " rule del ", " rule add ", 1)
+		undo = strings.Replace(undo, " -D ", " -A ", 1)
+		assert.Equal(t, strings.Join(cmd.do, " "), undo)
+	}
+}
+
+func Test_isProcessRoutingRule(t *testing.T) {
+	// Lines of "iptables -t mangle -S" output
+	for line, expected := range map[string]bool{
+		"-A OUTPUT -m cgroup --path telepresence-tel0 -j MARK --set-xmark 0x7e1/0xffffffff":              true,
+		"-A OUTPUT -m mark --mark 0x7e1 -j CONNMARK --save-mark --nfmask 0xffffffff --ctmask 0xffffffff": true,
+		"-A PREROUTING -i tel0 -j CONNMARK --restore-mark --nfmask 0xffffffff --ctmask 0xffffffff":       true,
+		"-A OUTPUT -m mark --mark 0x1 -j CONNMARK --save-mark --nfmask 0xffffffff --ctmask 0xffffffff":   false,
+		"-A PREROUTING -i eth0 -j CONNMARK --restore-mark --nfmask 0xffffffff --ctmask 0xffffffff":       false,
+		"-A OUTPUT -m cgroup --path system.slice/docker.service -j MARK --set-xmark 0x7e1/0xffffffff":    false,
+		"-P OUTPUT ACCEPT": false,
+	} {
+		assert.Equal(t, expected, isProcessRoutingRule(line, "0x7e1"), line)
+	}
+}
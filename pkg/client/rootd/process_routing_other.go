@@ -0,0 +1,37 @@
+//go:build !linux
+// +build !linux
+
+package rootd
+
+import (
+	"context"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif"
+)
+
+type processRouter struct{}
+
+func newProcessRouter(context.Context, *vif.Device) (*processRouter, error) {
+	return nil, errcat.User.New("process routing is only supported on Linux")
+}
+
+func (p *processRouter) addProcess(context.Context, int) error {
+	return errcat.User.New("process routing is only supported on Linux")
+}
+
+func (p *processRouter) stop(context.Context) {}
+
+// ProcessRoutingLeftover is a part of the process routing configuration that a root daemon left behind.
+type ProcessRoutingLeftover struct {
+	Description string
+}
+
+func (l *ProcessRoutingLeftover) Remove(context.Context) error {
+	return nil
+}
+
+// ProcessRoutingLeftovers returns nothing, because process routing is only supported on Linux.
+func ProcessRoutingLeftovers(context.Context) ([]*ProcessRoutingLeftover, error) {
+	return nil, nil
+}
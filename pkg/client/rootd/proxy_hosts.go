@@ -0,0 +1,290 @@
+package rootd
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+const (
+	// proxyHostsResolveInterval is how often the host names that aren't wildcards are resolved anew when
+	// the time to live of their addresses is unknown, and how long it takes before a failed lookup is retried.
+	proxyHostsResolveInterval = time.Minute
+
+	// proxyHostsMinTTL is the shortest time before a name is resolved anew, so that records with a very
+	// short time to live don't cause a constant stream of lookups.
+	proxyHostsMinTTL = 5 * time.Second
+
+	// proxyHostsMaxTTL is the longest time before a name is resolved anew.
+	proxyHostsMaxTTL = time.Hour
+)
+
+// hostLookup resolves a host name and returns its addresses, and the time to live of those addresses,
+// or zero when it's unknown.
+type hostLookup func(ctx context.Context, name string) ([]net.IP, time.Duration, error)
+
+// hostAddrs are the addresses of a host, kept per IP family because they are resolved by separate queries.
+// The addresses of a family expire at the given time, unless it's zero.
+type hostAddrs struct {
+	ipv4        []net.IP
+	ipv6        []net.IP
+	ipv4Expires time.Time
+	ipv6Expires time.Time
+}
+
+// answerExpiry returns when the addresses of a DNS answer with the given time to live expire. Clients often
+// cache an answer for longer than its time to live, so the addresses are retained for a while even when it
+// is very short.
+func answerExpiry(now time.Time, ttl time.Duration) time.Time {
+	switch {
+	case ttl < proxyHostsResolveInterval:
+		ttl = proxyHostsResolveInterval
+	case ttl > proxyHostsMaxTTL:
+		ttl = proxyHostsMaxTTL
+	}
+	return now.Add(ttl)
+}
+
+// proxyHosts keeps track of the addresses of a set of host names, where a name that starts with "*." is a
+// wildcard that matches all names in the domain that follows it. The addresses are updated when the names
+// are resolved anew, which happens when the time to live of their addresses expires, and when a matching
+// name is resolved by the DNS server of the session. The addresses of names that only match a wildcard are
+// dropped when their time to live expires, because nothing resolves such names anew.
+type proxyHosts struct {
+	sync.Mutex
+	patterns []string
+	addrs    map[string]*hostAddrs
+
+	// due is when each host name that isn't a wildcard is to be resolved anew
+	due map[string]time.Time
+}
+
+func newProxyHosts(patterns []string) *proxyHosts {
+	return &proxyHosts{
+		patterns: patterns,
+		addrs:    make(map[string]*hostAddrs),
+		due:      make(map[string]time.Time),
+	}
+}
+
+// setPatterns replaces the host names. The addresses of names that no longer match are dropped, and
+// new names are resolved on the next call to resolveDue.
+func (p *proxyHosts) setPatterns(patterns []string) {
+	p.Lock()
+	defer p.Unlock()
+	p.patterns = patterns
+	for name := range p.addrs {
+		if !p.matchesLocked(name) {
+			delete(p.addrs, name)
+		}
+	}
+	for name := range p.due {
+		if !p.matchesLocked(name) {
+			delete(p.due, name)
+		}
+	}
+}
+
+func (p *proxyHosts) list() []string {
+	p.Lock()
+	defer p.Unlock()
+	return p.patterns
+}
+
+// isHostLocked returns true if the given name is one of the host names that aren't wildcards.
+func (p *proxyHosts) isHostLocked(name string) bool {
+	for _, pattern := range p.patterns {
+		if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *proxyHosts) matchesLocked(name string) bool {
+	for _, pattern := range p.patterns {
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(name, pattern[1:]) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// setAddrs replaces the addresses of the given IP family of the given name, provided that the name
+// matches one of the host names, and reports whether that changed the addresses. It's called by the
+// DNS server with the addresses that it resolved for a name, and when they expire. The addresses of
+// a host name that isn't a wildcard never expire, because it's resolved anew by resolveDue.
+func (p *proxyHosts) setAddrs(name string, ipv6 bool, ips []net.IP, expires time.Time) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	// The order of the addresses of a round-robin answer changes between queries
+	ips = append([]net.IP(nil), ips...)
+	sort.Slice(ips, func(i, j int) bool {
+		return bytes.Compare(ips[i], ips[j]) < 0
+	})
+	p.Lock()
+	defer p.Unlock()
+	if !p.matchesLocked(name) {
+		return false
+	}
+	ha, ok := p.addrs[name]
+	if !ok {
+		ha = &hostAddrs{}
+		p.addrs[name] = ha
+	}
+	if p.isHostLocked(name) {
+		expires = time.Time{}
+	}
+	old, oldExpires := &ha.ipv4, &ha.ipv4Expires
+	if ipv6 {
+		old, oldExpires = &ha.ipv6, &ha.ipv6Expires
+	}
+	*oldExpires = expires
+	if ipsEqual(*old, ips) {
+		return false
+	}
+	*old = ips
+	if len(ha.ipv4) == 0 && len(ha.ipv6) == 0 {
+		delete(p.addrs, name)
+	}
+	return true
+}
+
+// resolveDue looks up the addresses of the host names that aren't wildcards and that are due to be resolved
+// at the given time, and reports whether that changed any addresses. A name is resolved anew when the time
+// to live of its addresses expires. The addresses of a name that can't be resolved are retained.
+func (p *proxyHosts) resolveDue(ctx context.Context, now time.Time, lookup hostLookup) bool {
+	changed := false
+	for _, name := range p.list() {
+		if strings.HasPrefix(name, "*.") {
+			continue
+		}
+		p.Lock()
+		due, ok := p.due[name]
+		p.Unlock()
+		if ok && now.Before(due) {
+			continue
+		}
+		ips, ttl, err := lookup(ctx, name)
+		if err != nil {
+			dlog.Debugf(ctx, "unable to resolve %s: %v", name, err)
+			ttl = proxyHostsResolveInterval
+		} else {
+			var ipv4, ipv6 []net.IP
+			for _, ip := range ips {
+				if ip4 := ip.To4(); ip4 != nil {
+					ipv4 = append(ipv4, ip4)
+				} else {
+					ipv6 = append(ipv6, ip)
+				}
+			}
+			if p.setAddrs(name, false, ipv4, time.Time{}) {
+				changed = true
+			}
+			if p.setAddrs(name, true, ipv6, time.Time{}) {
+				changed = true
+			}
+		}
+		switch {
+		case ttl <= 0:
+			ttl = proxyHostsResolveInterval
+		case ttl < proxyHostsMinTTL:
+			ttl = proxyHostsMinTTL
+		case ttl > proxyHostsMaxTTL:
+			ttl = proxyHostsMaxTTL
+		}
+		p.Lock()
+		if p.matchesLocked(name) {
+			p.due[name] = now.Add(ttl)
+		}
+		p.Unlock()
+	}
+	return changed
+}
+
+// expire drops the addresses that have expired at the given time, and reports whether there were any.
+func (p *proxyHosts) expire(now time.Time) bool {
+	p.Lock()
+	defer p.Unlock()
+	changed := false
+	for name, ha := range p.addrs {
+		if !ha.ipv4Expires.IsZero() && now.After(ha.ipv4Expires) {
+			ha.ipv4, ha.ipv4Expires = nil, time.Time{}
+			changed = true
+		}
+		if !ha.ipv6Expires.IsZero() && now.After(ha.ipv6Expires) {
+			ha.ipv6, ha.ipv6Expires = nil, time.Time{}
+			changed = true
+		}
+		if len(ha.ipv4) == 0 && len(ha.ipv6) == 0 {
+			delete(p.addrs, name)
+		}
+	}
+	return changed
+}
+
+// subnets returns a sorted list of unique single address subnets for all resolved addresses.
+func (p *proxyHosts) subnets() []*net.IPNet {
+	p.Lock()
+	seen := make(map[string]struct{})
+	var ns []*net.IPNet
+	add := func(ips []net.IP, bits int) {
+		for _, ip := range ips {
+			if _, ok := seen[string(ip)]; !ok {
+				seen[string(ip)] = struct{}{}
+				ns = append(ns, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+		}
+	}
+	for _, ha := range p.addrs {
+		add(ha.ipv4, 32)
+		add(ha.ipv6, 128)
+	}
+	p.Unlock()
+	sort.Slice(ns, func(i, j int) bool {
+		return bytes.Compare(ns[i].IP, ns[j].IP) < 0
+	})
+	return ns
+}
+
+// uncoveredWildcards returns the wildcards of the given patterns that match names outside the given domains.
+func uncoveredWildcards(patterns, domains []string) []string {
+	var ws []string
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "*.") {
+			continue
+		}
+		covered := false
+		for _, domain := range domains {
+			if domain = strings.Trim(strings.ToLower(domain), "."); domain != "" && strings.HasSuffix(pattern, "."+domain) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			ws = append(ws, pattern)
+		}
+	}
+	return ws
+}
+
+func ipsEqual(a, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package rootd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+func subnetStrings(p *proxyHosts) []string {
+	var ss []string
+	for _, sn := range p.subnets() {
+		ss = append(ss, sn.String())
+	}
+	return ss
+}
+
+func TestProxyHosts(t *testing.T) {
+	p := newProxyHosts([]string{"db.example.com", "*.corp.example.com"})
+
+	// Names that don't match are ignored
+	assert.False(t, p.setAddrs("www.example.com.", false, []net.IP{{192, 168, 0, 1}}, time.Time{}))
+	assert.Empty(t, p.subnets())
+
+	// Answers for names that match a wildcard are retained per IP family
+	assert.True(t, p.setAddrs("Git.Corp.Example.com.", false, []net.IP{{10, 1, 0, 2}, {10, 1, 0, 1}}, time.Time{}))
+	assert.True(t, p.setAddrs("git.corp.example.com.", true, []net.IP{net.ParseIP("fd00::1")}, time.Time{}))
+	assert.Equal(t, []string{"10.1.0.1/32", "10.1.0.2/32", "fd00::1/128"}, subnetStrings(p))
+
+	// The same addresses in another order is not a change
+	assert.False(t, p.setAddrs("git.corp.example.com.", false, []net.IP{{10, 1, 0, 1}, {10, 1, 0, 2}}, time.Time{}))
+
+	// Host names that aren't wildcards are resolved, and failures retain the old addresses
+	lookups := map[string][]net.IP{"db.example.com": {{172, 16, 0, 5}}}
+	lookup := func(_ context.Context, name string) ([]net.IP, time.Duration, error) {
+		if ips, ok := lookups[name]; ok {
+			return ips, 0, nil
+		}
+		return nil, 0, errors.New("no such host")
+	}
+	ctx := dlog.NewTestContext(t, false)
+	now := time.Now()
+	assert.True(t, p.resolveDue(ctx, now, lookup))
+	assert.Equal(t, []string{"10.1.0.1/32", "10.1.0.2/32", "172.16.0.5/32", "fd00::1/128"}, subnetStrings(p))
+	delete(lookups, "db.example.com")
+	assert.False(t, p.resolveDue(ctx, now.Add(proxyHostsResolveInterval), lookup))
+	assert.Equal(t, []string{"10.1.0.1/32", "10.1.0.2/32", "172.16.0.5/32", "fd00::1/128"}, subnetStrings(p))
+
+	// Addresses of names that no longer match are dropped
+	p.setPatterns([]string{"db.example.com"})
+	assert.Equal(t, []string{"172.16.0.5/32"}, subnetStrings(p))
+}
+
+func TestProxyHosts_resolveDue(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	p := newProxyHosts([]string{"api.example.com", "short.example.com", "unknown.example.com"})
+	ttls := map[string]time.Duration{
+		"api.example.com":     300 * time.Second,
+		"short.example.com":   time.Second,
+		"unknown.example.com": 0,
+	}
+	var resolved []string
+	lookup := func(_ context.Context, name string) ([]net.IP, time.Duration, error) {
+		resolved = append(resolved, name)
+		return []net.IP{{10, 0, 0, byte(len(resolved))}}, ttls[name], nil
+	}
+	resolvedAt := func(at time.Time) []string {
+		resolved = nil
+		p.resolveDue(ctx, at, lookup)
+		return resolved
+	}
+
+	now := time.Now()
+	assert.Equal(t, []string{"api.example.com", "short.example.com", "unknown.example.com"}, resolvedAt(now))
+
+	// Nothing is due before the shortest time to live has passed
+	assert.Empty(t, resolvedAt(now.Add(time.Second)))
+
+	// A time to live shorter than the minimum is raised to the minimum
+	assert.Equal(t, []string{"short.example.com"}, resolvedAt(now.Add(proxyHostsMinTTL)))
+
+	// An unknown time to live means that the name is resolved at the default interval
+	assert.Equal(t, []string{"short.example.com", "unknown.example.com"}, resolvedAt(now.Add(proxyHostsResolveInterval)))
+
+	// The time to live of the answer decides when the name is resolved anew
+	assert.Equal(t, []string{"api.example.com", "short.example.com", "unknown.example.com"}, resolvedAt(now.Add(300*time.Second)))
+
+	// New host names are resolved right away
+	p.setPatterns([]string{"api.example.com", "new.example.com"})
+	assert.Equal(t, []string{"new.example.com"}, resolvedAt(now.Add(301*time.Second)))
+}
+
+func TestProxyHosts_expire(t *testing.T) {
+	p := newProxyHosts([]string{"db.corp.example.com", "*.corp.example.com"})
+	now := time.Now()
+
+	// The addresses of a name that only matches a wildcard expire, those of a host name don't
+	expires := answerExpiry(now, 30*time.Second)
+	assert.True(t, p.setAddrs("git.corp.example.com.", false, []net.IP{{10, 1, 0, 1}}, expires))
+	assert.True(t, p.setAddrs("db.corp.example.com.", false, []net.IP{{10, 1, 0, 2}}, expires))
+	assert.False(t, p.expire(now.Add(30*time.Second)))
+	assert.True(t, p.expire(now.Add(proxyHostsResolveInterval+time.Second)))
+	assert.Equal(t, []string{"10.1.0.2/32"}, subnetStrings(p))
+
+	// A new answer extends the expiry of the addresses
+	assert.True(t, p.setAddrs("git.corp.example.com.", false, []net.IP{{10, 1, 0, 1}}, answerExpiry(now, 10*time.Minute)))
+	assert.False(t, p.setAddrs("git.corp.example.com.", false, []net.IP{{10, 1, 0, 1}}, answerExpiry(now, 20*time.Minute)))
+	assert.False(t, p.expire(now.Add(15*time.Minute)))
+	assert.True(t, p.expire(now.Add(20*time.Minute+time.Second)))
+
+	// The time to live is capped
+	assert.True(t, p.setAddrs("git.corp.example.com.", false, []net.IP{{10, 1, 0, 1}}, answerExpiry(now, 2*proxyHostsMaxTTL)))
+	assert.True(t, p.expire(now.Add(proxyHostsMaxTTL+time.Second)))
+	assert.Equal(t, []string{"10.1.0.2/32"}, subnetStrings(p))
+}
+
+func Test_uncoveredWildcards(t *testing.T) {
+	patterns := []string{"git.example.com", "*.corp.example.com", "*.svc.example.org", "*.example.net"}
+	assert.Equal(t, []string{"*.corp.example.com", "*.svc.example.org", "*.example.net"}, uncoveredWildcards(patterns, nil))
+	assert.Equal(t, []string{"*.example.net"}, uncoveredWildcards(patterns, []string{".corp.example.com", "example.org", "ample.net"}))
+}
@@ -2,6 +2,7 @@ package rootd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync/atomic"
@@ -184,10 +185,15 @@ func (s *session) tcp(c context.Context, pkt tcp.Packet) {
 	}
 
 	wf, _, err := s.handlers.GetOrCreateTCP(c, connID, func(c context.Context, remove func()) (tunnel.Handler, error) {
-		return tcp.NewHandler(s.streamCreator(connID), &s.closing, vifWriter{s.dev}, connID, remove, s.rndSource), nil
+		return tcp.NewHandler(s.streamCreator(connID), &s.closing, vifWriter{s.dev}, connID, remove, s.rndSource, s.bufferBudget), nil
 	}, pkt)
 	if err != nil {
-		dlog.Error(c, err)
+		if errors.Is(err, tunnel.ErrPoolFull) {
+			// Dropping the SYN makes the peer resend it later, when other connections may have closed.
+			s.poolFull(c, connID)
+		} else {
+			dlog.Error(c, err)
+		}
 		pkt.Release()
 		return
 	}
@@ -210,12 +216,27 @@ func (s *session) udp(c context.Context, dg udp.Datagram) {
 		return udp.NewHandler(stream, w, connID, remove), nil
 	})
 	if err != nil {
-		dlog.Error(c, err)
+		if errors.Is(err, tunnel.ErrPoolFull) {
+			s.poolFull(c, connID)
+		} else {
+			dlog.Error(c, err)
+		}
 		return
 	}
 	uh.(udp.DatagramHandler).HandleDatagram(c, dg)
 }
 
+// poolFull logs that a connection was held back because the maximum number of connections was reached.
+// The warning is logged on the first occasion and then for every thousandth connection.
+func (s *session) poolFull(c context.Context, id tunnel.ConnID) {
+	_, maxCount, rejected := s.handlers.Stats()
+	if rejected%1000 == 1 {
+		dlog.Warnf(c, "Connection %s held back because the maximum of %d connections is reached (%d times so far)", id, maxCount, rejected)
+	} else {
+		dlog.Tracef(c, "Connection %s held back because the maximum of %d connections is reached", id, maxCount)
+	}
+}
+
 func (s *session) streamCreator(id tunnel.ConnID) tcp.StreamCreator {
 	return func(c context.Context) (tunnel.Stream, error) {
 		dlog.Debugf(c, "Opening tunnel for id %s", id)
@@ -224,6 +245,6 @@ func (s *session) streamCreator(id tunnel.ConnID) tcp.StreamCreator {
 			return nil, err
 		}
 		tc := client.GetConfig(c).Timeouts
-		return tunnel.NewClientStream(c, ct, id, s.session.SessionId, tc.Get(client.TimeoutRoundtripLatency), tc.Get(client.TimeoutEndpointDial))
+		return tunnel.NewClientStream(c, ct, id, s.managerSession().SessionId, tc.Get(client.TimeoutRoundtripLatency), tc.Get(client.TimeoutEndpointDial))
 	}
 }
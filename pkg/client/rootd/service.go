@@ -93,6 +93,9 @@ func (d *service) Status(_ context.Context, _ *empty.Empty) (*rpc.DaemonStatus,
 	r := &rpc.DaemonStatus{}
 	if d.session != nil {
 		r.OutboundConfig = d.session.getInfo()
+		r.DnsCacheStats = d.session.dnsServer.CacheStats()
+		r.SubnetConflicts = d.session.getSubnetConflicts()
+		r.ConnectionStats = d.session.getConnectionStats()
 	}
 	return r, nil
 }
@@ -114,6 +117,58 @@ func (d *service) SetDnsSearchPath(ctx context.Context, paths *rpc.Paths) (*empt
 	return &empty.Empty{}, err
 }
 
+func (d *service) LookupDNS(ctx context.Context, req *rpc.DNSRequest) (*rpc.DNSResponse, error) {
+	dlog.Debugf(ctx, "Received gRPC LookupDNS %s %s", req.Type, req.Name)
+	var r *rpc.DNSResponse
+	err := d.withSession(ctx, func(ctx context.Context, session *session) (err error) {
+		r, err = session.dnsServer.Lookup(ctx, req.Name, req.Type)
+		return err
+	})
+	return r, err
+}
+
+func (d *service) SetProxySubnets(ctx context.Context, ps *rpc.ProxySubnets) (*rpc.DaemonStatus, error) {
+	dlog.Debug(ctx, "Received gRPC SetProxySubnets")
+	var r *rpc.DaemonStatus
+	err := d.withSession(ctx, func(ctx context.Context, session *session) error {
+		if err := session.setProxySubnets(ctx, ps.AlsoProxySubnets, ps.NeverProxySubnets, ps.AlsoProxyHosts, ps.NeverProxyHosts); err != nil {
+			return err
+		}
+		r = &rpc.DaemonStatus{
+			OutboundConfig:  session.getInfo(),
+			SubnetConflicts: session.getSubnetConflicts(),
+		}
+		return nil
+	})
+	return r, err
+}
+
+func (d *service) GetNetworkConfig(ctx context.Context, _ *empty.Empty) (*rpc.NetworkConfig, error) {
+	dlog.Debug(ctx, "Received gRPC GetNetworkConfig")
+	var nc *rpc.NetworkConfig
+	err := d.withSession(ctx, func(ctx context.Context, session *session) error {
+		nc = session.getNetworkConfig()
+		return nil
+	})
+	return nc, err
+}
+
+func (d *service) RouteProcess(ctx context.Context, _ *empty.Empty) (*empty.Empty, error) {
+	// The caller must be identified using the request context. The session context doesn't know it.
+	pid, ok := peerPID(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "process routing is only supported on Linux")
+	}
+	dlog.Debugf(ctx, "Received gRPC RouteProcess from process %d", pid)
+	err := d.withSession(ctx, func(ctx context.Context, session *session) error {
+		if session.processRouter == nil {
+			return status.Error(codes.FailedPrecondition, "the session routes the traffic of all processes")
+		}
+		return session.processRouter.addProcess(ctx, pid)
+	})
+	return &empty.Empty{}, err
+}
+
 func (d *service) Connect(ctx context.Context, info *rpc.OutboundInfo) (*rpc.DaemonStatus, error) {
 	dlog.Debug(ctx, "Received gRPC Connect")
 	select {
@@ -129,6 +184,19 @@ func (d *service) Connect(ctx context.Context, info *rpc.OutboundInfo) (*rpc.Dae
 	}
 }
 
+// Reconnect replaces the traffic-manager session of the current session with the one in the given
+// OutboundInfo. The connector calls this after it has established a new session with the traffic-manager.
+func (d *service) Reconnect(ctx context.Context, info *rpc.OutboundInfo) (*rpc.DaemonStatus, error) {
+	dlog.Debug(ctx, "Received gRPC Reconnect")
+	var ds *rpc.DaemonStatus
+	err := d.withSession(ctx, func(ctx context.Context, session *session) error {
+		session.reconnect(ctx, info)
+		ds = &rpc.DaemonStatus{OutboundConfig: session.getInfo(), SubnetConflicts: session.getSubnetConflicts()}
+		return nil
+	})
+	return ds, err
+}
+
 func (d *service) Disconnect(ctx context.Context, _ *empty.Empty) (*empty.Empty, error) {
 	dlog.Debug(ctx, "Received gRPC Disconnect")
 	d.sessionLock.Lock()
@@ -159,7 +227,7 @@ func (d *service) GetClusterSubnets(ctx context.Context, _ *empty.Empty) (*rpc.C
 		// we should expect to have everything
 		tCtx, tCancel := context.WithTimeout(ctx, 5*time.Second)
 		defer tCancel()
-		infoStream, err := session.managerClient.WatchClusterInfo(tCtx, session.session)
+		infoStream, err := session.managerClient.WatchClusterInfo(tCtx, session.managerSession())
 		if err != nil {
 			return err
 		}
@@ -171,9 +239,7 @@ func (d *service) GetClusterSubnets(ctx context.Context, _ *empty.Empty) (*rpc.C
 				}
 				return err
 			}
-			if mgrInfo.ServiceSubnet != nil {
-				svcSubnets = append(svcSubnets, mgrInfo.ServiceSubnet)
-			}
+			svcSubnets = append(svcSubnets, serviceSubnets(mgrInfo)...)
 			podSubnets = append(podSubnets, mgrInfo.PodSubnets...)
 		}
 	})
@@ -218,11 +284,11 @@ func (d *service) manageSessions(c context.Context) error {
 		reply := sessionReply{}
 		d.sessionLock.Lock()
 		if d.session != nil {
-			reply.status = &rpc.DaemonStatus{OutboundConfig: d.session.getInfo()}
+			reply.status = d.session.connectStatus(c)
 		} else {
 			d.session, reply.err = newSession(c, d.scout, oi)
 			if reply.err == nil {
-				reply.status = &rpc.DaemonStatus{OutboundConfig: d.session.getInfo()}
+				reply.status = d.session.connectStatus(c)
 			}
 		}
 		select {
@@ -265,7 +331,8 @@ func (d *service) serveGrpc(c context.Context, l net.Listener) error {
 	rpc.RegisterDaemonServer(svc, d)
 
 	sc := &dhttp.ServerConfig{
-		Handler: svc,
+		Handler:     svc,
+		ConnContext: withPeerCredentials,
 	}
 	dlog.Info(c, "gRPC server started")
 	err := sc.Serve(c, l)
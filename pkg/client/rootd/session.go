@@ -9,11 +9,14 @@ import (
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/blang/semver"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/datawire/dlib/dcontext"
@@ -26,6 +29,7 @@ import (
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/netmon"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/rootd/dns"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/scout"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
@@ -82,6 +86,9 @@ type session struct {
 	// are obtained using a connpool.ConnID.
 	handlers *tunnel.Pool
 
+	// bufferBudget limits the memory used by the packets that are queued in the TCP handlers
+	bufferBudget *buffer.Budget
+
 	// fragmentMap is when concatenating ipv4 fragments
 	fragmentMap map[uint16][]*buffer.Data
 
@@ -97,27 +104,57 @@ type session struct {
 	// dnsLocalAddr is address of the local DNS service.
 	dnsLocalAddr *net.UDPAddr
 
+	// subnetsLock guards the cluster, also-proxy, never-proxy, and currently routed subnets, which
+	// are updated both when the traffic-manager reports new cluster subnets and when the user
+	// applies new routes.
+	subnetsLock sync.Mutex
+
 	// Cluster subnets reported by the traffic-manager
 	clusterSubnets []*net.IPNet
 
 	// Subnets configured by the user
 	alsoProxySubnets []*net.IPNet
 
+	// Host names, or wildcards, whose addresses are resolved in the cluster and proxied
+	alsoProxyHosts *proxyHosts
+
 	// Subnets configured not to be proxied
+	neverProxyConfigured []*manager.IPNet
+
+	// Host names, or wildcards, whose addresses are not to be proxied
+	neverProxyHosts *proxyHosts
+
+	// proxyHostsChanged tells the proxyHostsWorker that the DNS server changed the addresses of the
+	// proxy hosts
+	proxyHostsChanged chan struct{}
+
+	// Routes for the never-proxy subnets and the addresses of the never-proxy hosts
 	neverProxySubnets []routing.Route
+
+	// processRouter is set when only the traffic of designated processes is routed through the TUN device
+	processRouter *processRouter
 	// Subnets that the router is currently configured with. Managed, and only used in
 	// the refreshSubnets() method.
 	curSubnets      []*net.IPNet
 	curStaticRoutes []routing.Route
 
+	// Allocator for the virtual IPs that are handed out during the session.
+	virtualIPs subnet.IPAllocator
+
+	// Cluster subnets that overlap with local networks. Updated each time the cluster subnets change.
+	subnetConflictsLock sync.Mutex
+	subnetConflicts     []*rpc.SubnetConflict
+
 	// closing is set during shutdown and can have the values:
 	//   0 = running
 	//   1 = closing
 	//   2 = closed
 	closing int32
 
-	// session contains the manager session
-	session *manager.SessionInfo
+	// session contains the manager session. It's replaced when the connector reconnects to the
+	// traffic-manager, so it must be obtained using managerSession().
+	sessionLock sync.Mutex
+	session     *manager.SessionInfo
 
 	// rndSource is the source for the random number generator in the TCP handlers
 	rndSource rand.Source
@@ -205,32 +242,160 @@ func newSession(c context.Context, scout *scout.Reporter, mi *daemon.OutboundInf
 
 	dev, err := vif.OpenTun(c)
 	if err != nil {
-		return nil, err
+		// The connector falls back to port-forwards when it gets this error
+		return nil, client.NoTunDeviceError(err)
 	}
 
+	limits := client.GetConfig(c).Limits
 	s := &session{
-		cancel:            func() {},
-		scout:             scout,
-		dev:               dev,
-		handlers:          tunnel.NewPool(),
-		fragmentMap:       make(map[uint16][]*buffer.Data),
-		rndSource:         rand.NewSource(time.Now().UnixNano()),
-		session:           mi.Session,
-		managerClient:     mc,
-		clientConn:        conn,
-		alsoProxySubnets:  convertAlsoProxySubnets(c, mi.AlsoProxySubnets),
-		neverProxySubnets: convertNeverProxySubnets(c, mi.NeverProxySubnets),
+		cancel:               func() {},
+		scout:                scout,
+		dev:                  dev,
+		handlers:             tunnel.NewBoundedPool(limits.MaxConnections),
+		bufferBudget:         buffer.NewBudget(limits.MaxBufferedData.Value()),
+		fragmentMap:          make(map[uint16][]*buffer.Data),
+		rndSource:            rand.NewSource(time.Now().UnixNano()),
+		session:              mi.Session,
+		managerClient:        mc,
+		clientConn:           conn,
+		alsoProxySubnets:     convertAlsoProxySubnets(c, mi.AlsoProxySubnets),
+		neverProxyConfigured: mi.NeverProxySubnets,
+		alsoProxyHosts:       newProxyHosts(mi.AlsoProxyHosts),
+		neverProxyHosts:      newProxyHosts(mi.NeverProxyHosts),
+		proxyHostsChanged:    make(chan struct{}, 1),
 	}
+	s.neverProxySubnets = s.neverProxyRoutes(c)
 	s.dnsServer = dns.NewServer(mi.Dns, s.clusterLookup)
+	s.dnsServer.SetAnswerObserver(s.onDNSAnswer)
+	if dc := client.GetConfig(c).DNS; dc.LazyNamespaces {
+		s.dnsServer.SetLazyNamespaces(dc.NamespaceIdleTimeout)
+	}
+	if err = s.checkSubnetConflicts(c); err != nil {
+		_ = dev.Close()
+		return nil, err
+	}
+	if s.virtualIPs, err = s.newVirtualIPAllocator(c); err != nil {
+		_ = dev.Close()
+		return nil, err
+	}
+	if mi.ProcessRouting {
+		if s.processRouter, err = newProcessRouter(c, dev); err != nil {
+			_ = dev.Close()
+			return nil, err
+		}
+	}
 	return s, nil
 }
 
+// getConnectionStats returns the current connection counters and limits.
+func (s *session) getConnectionStats() *rpc.ConnectionStats {
+	count, maxCount, rejected := s.handlers.Stats()
+	used, limit, dropped := s.bufferBudget.Stats()
+	return &rpc.ConnectionStats{
+		Connections:         int64(count),
+		MaxConnections:      int64(maxCount),
+		RejectedConnections: rejected,
+		BufferedBytes:       used,
+		MaxBufferedBytes:    limit,
+		DroppedPackets:      dropped,
+	}
+}
+
+// checkSubnetConflicts obtains the current cluster subnets from the traffic-manager and finds out
+// if they overlap with local networks, so that the conflicts can be reported when connecting. An
+// error is returned if there are conflicts and the subnet conflict strategy is "fail".
+func (s *session) checkSubnetConflicts(c context.Context) error {
+	tc, cancel := client.GetConfig(c).Timeouts.TimeoutContext(c, client.TimeoutTrafficManagerAPI)
+	defer cancel()
+	infoStream, err := s.managerClient.WatchClusterInfo(tc, s.managerSession())
+	if err == nil {
+		var mgrInfo *manager.ClusterInfo
+		if mgrInfo, err = infoStream.Recv(); err == nil {
+			s.setSubnetConflicts(s.detectSubnetConflicts(c, clusterSubnets(mgrInfo)))
+		}
+	}
+	if err != nil {
+		// Not fatal. The conflicts are detected again once the session receives the cluster info.
+		dlog.Errorf(c, "unable to check the cluster subnets for conflicts: %v", err)
+		return nil
+	}
+	scs := s.getSubnetConflicts()
+	if len(scs) == 0 || client.GetConfig(c).Routing.SubnetConflictStrategy != client.SubnetConflictFail {
+		return nil
+	}
+	msgs := make([]string, len(scs))
+	for i, sc := range scs {
+		msgs[i] = client.DescribeSubnetConflict(sc)
+	}
+	return status.Errorf(codes.FailedPrecondition,
+		"cluster subnets conflict with local networks:\n  %s\nchange routing.subnetConflictStrategy in the config to connect anyway",
+		strings.Join(msgs, "\n  "))
+}
+
+func (s *session) getSubnetConflicts() []*rpc.SubnetConflict {
+	s.subnetConflictsLock.Lock()
+	defer s.subnetConflictsLock.Unlock()
+	return s.subnetConflicts
+}
+
+func (s *session) setSubnetConflicts(scs []*rpc.SubnetConflict) {
+	s.subnetConflictsLock.Lock()
+	s.subnetConflicts = scs
+	s.subnetConflictsLock.Unlock()
+}
+
+// managerSession returns the traffic-manager session of this session.
+func (s *session) managerSession() *manager.SessionInfo {
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+	return s.session
+}
+
+// reconnect replaces the traffic-manager session after the connector has established a new one, e.g.
+// because the old one expired while the workstation was asleep. The connections of the old session
+// are closed since the traffic-manager has forgotten about them, and the routes are reconciled with
+// the current network.
+func (s *session) reconnect(ctx context.Context, oi *rpc.OutboundInfo) {
+	s.sessionLock.Lock()
+	old := s.session
+	s.session = oi.Session
+	s.sessionLock.Unlock()
+	if old.GetSessionId() == oi.Session.GetSessionId() {
+		return
+	}
+	dlog.Infof(ctx, "Replacing traffic-manager session %s with %s", old.GetSessionId(), oi.Session.GetSessionId())
+	cc, cancel := context.WithTimeout(ctx, time.Second)
+	s.handlers.CloseAll(cc)
+	cancel()
+	s.onNetworkChange(ctx)
+}
+
+// onNetworkChange is called when the network of the workstation has changed. The gateways of the
+// never-proxy subnets are resolved anew, the subnets and static routes of the TUN device are
+// reconciled, and the DNS configuration is applied anew.
+func (s *session) onNetworkChange(ctx context.Context) {
+	s.subnetsLock.Lock()
+	// The static routes use the gateways of the old network, so they are all replaced.
+	for _, r := range s.curStaticRoutes {
+		if err := s.dev.RemoveStaticRoute(ctx, r); err != nil {
+			dlog.Warnf(ctx, "error removing route %s: %v", r, err)
+		}
+	}
+	s.curStaticRoutes = nil
+	s.neverProxySubnets = s.neverProxyRoutes(ctx)
+	if err := s.refreshSubnets(ctx); err != nil {
+		dlog.Error(ctx, err)
+	}
+	s.subnetsLock.Unlock()
+	s.dnsServer.NetworkChanged()
+}
+
 // clusterLookup sends a LookupHost request to the traffic-manager and returns the result
 func (s *session) clusterLookup(ctx context.Context, key string) ([][]byte, error) {
 	dlog.Debugf(ctx, "LookupHost %q", key)
 	s.dnsLookups++
 	r, err := s.managerClient.LookupHost(ctx, &manager.LookupHostRequest{
-		Session: s.session,
+		Session: s.managerSession(),
 		Host:    key,
 	})
 	if err != nil || len(r.Ips) == 0 {
@@ -242,9 +407,36 @@ func (s *session) clusterLookup(ctx context.Context, key string) ([][]byte, erro
 	return r.Ips, nil
 }
 
+// clusterHostLookup resolves a host name in the cluster and returns its addresses together with their time
+// to live, which is zero when the traffic-manager doesn't know it.
+func (s *session) clusterHostLookup(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	r, err := s.managerClient.LookupHost(ctx, &manager.LookupHostRequest{
+		Session: s.managerSession(),
+		Host:    host,
+		Ttl:     true,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return []net.IP(iputil.IPsFromBytesSlice(r.Ips)), r.Ttl.AsDuration(), nil
+}
+
+// connectStatus returns the status that the root daemon replies to a connect request with.
+func (s *session) connectStatus(ctx context.Context) *rpc.DaemonStatus {
+	return &rpc.DaemonStatus{
+		OutboundConfig:    s.getInfo(),
+		SubnetConflicts:   s.getSubnetConflicts(),
+		ProxyHostWarnings: s.proxyHostWarnings(ctx),
+	}
+}
+
 func (s *session) getInfo() *rpc.OutboundInfo {
+	s.subnetsLock.Lock()
+	defer s.subnetsLock.Unlock()
 	info := rpc.OutboundInfo{
-		Session: s.session,
+		Session: s.managerSession(),
 		Dns:     s.dnsServer.GetConfig(),
 	}
 	if s.dnsLocalAddr != nil {
@@ -263,10 +455,52 @@ func (s *session) getInfo() *rpc.OutboundInfo {
 			info.NeverProxySubnets[i] = iputil.IPNetToRPC(np.RoutedNet)
 		}
 	}
+	info.NeverProxyHosts = s.neverProxyHosts.list()
+	info.AlsoProxyHosts = s.alsoProxyHosts.list()
+	info.ProcessRouting = s.processRouter != nil
 
 	return &info
 }
 
+// getNetworkConfig returns the routes, DNS configuration, and TUN device that are in effect.
+func (s *session) getNetworkConfig() *rpc.NetworkConfig {
+	nc := s.dnsServer.GetNetworkConfig()
+	if s.dev != nil {
+		td := &rpc.TunDevice{Name: s.dev.Name()}
+		if iface, err := net.InterfaceByName(td.Name); err == nil {
+			td.Index = int32(iface.Index)
+			td.Mtu = int32(iface.MTU)
+			if addrs, err := iface.Addrs(); err == nil {
+				for _, addr := range addrs {
+					if ipn, ok := addr.(*net.IPNet); ok {
+						td.Addresses = append(td.Addresses, iputil.IPNetToRPC(ipn))
+					}
+				}
+			}
+		}
+		nc.TunDevice = td
+	}
+
+	nc.ProcessRouting = s.processRouter != nil
+
+	s.subnetsLock.Lock()
+	defer s.subnetsLock.Unlock()
+	for _, sn := range s.curSubnets {
+		nc.RoutedSubnets = append(nc.RoutedSubnets, iputil.IPNetToRPC(sn))
+	}
+	for _, r := range s.curStaticRoutes {
+		sr := &rpc.StaticRoute{
+			Subnet:  iputil.IPNetToRPC(r.RoutedNet),
+			Gateway: r.Gateway,
+		}
+		if r.Interface != nil {
+			sr.Interface = r.Interface.Name
+		}
+		nc.StaticRoutes = append(nc.StaticRoutes, sr)
+	}
+	return nc
+}
+
 func (s *session) configureDNS(dnsIP net.IP, dnsLocalAddr *net.UDPAddr) {
 	s.remoteDnsIP = dnsIP
 	s.dnsLocalAddr = dnsLocalAddr
@@ -314,11 +548,138 @@ removing:
 	return nil
 }
 
+// setProxySubnets replaces the also-proxy and never-proxy subnets and hosts of the session and reconciles
+// the subnets and static routes of the TUN device with them. New hosts are resolved by the proxyHostsWorker.
+func (s *session) setProxySubnets(ctx context.Context, alsoProxy, neverProxy []*manager.IPNet, alsoProxyHosts, neverProxyHosts []string) error {
+	s.subnetsLock.Lock()
+	defer s.subnetsLock.Unlock()
+	s.alsoProxySubnets = convertAlsoProxySubnets(ctx, alsoProxy)
+	s.alsoProxyHosts.setPatterns(alsoProxyHosts)
+	s.neverProxyConfigured = neverProxy
+	s.neverProxyHosts.setPatterns(neverProxyHosts)
+	s.neverProxySubnets = s.neverProxyRoutes(ctx)
+	return s.refreshSubnets(ctx)
+}
+
+// neverProxyRoutes returns the routes for the configured never-proxy subnets and for the current addresses
+// of the never-proxy hosts.
+func (s *session) neverProxyRoutes(ctx context.Context) []routing.Route {
+	nps := s.neverProxyConfigured
+	if hs := s.neverProxyHosts.subnets(); len(hs) > 0 {
+		nps = make([]*manager.IPNet, len(s.neverProxyConfigured), len(s.neverProxyConfigured)+len(hs))
+		copy(nps, s.neverProxyConfigured)
+		for _, h := range hs {
+			nps = append(nps, iputil.IPNetToRPC(h))
+		}
+	}
+	return convertNeverProxySubnets(ctx, nps)
+}
+
+// applyProxyHosts updates the routes of the TUN device with the current addresses of the also-proxy
+// and never-proxy hosts.
+func (s *session) applyProxyHosts(ctx context.Context) {
+	s.subnetsLock.Lock()
+	s.neverProxySubnets = s.neverProxyRoutes(ctx)
+	err := s.refreshSubnets(ctx)
+	s.subnetsLock.Unlock()
+	if err != nil {
+		dlog.Errorf(ctx, "unable to update the routes of the proxy hosts: %v", err)
+	}
+}
+
+// proxyHostWarnings returns a warning for each never-proxy wildcard that can't take effect, because the
+// resolver of the platform doesn't send the names that it matches to the DNS server of the session. The
+// addresses of such names are never learned.
+func (s *session) proxyHostWarnings(ctx context.Context) []string {
+	ws := uncoveredWildcards(s.neverProxyHosts.list(), nil)
+	if len(ws) == 0 || s.dnsServer.ReceivesAllNames(ctx) {
+		return nil
+	}
+	dc := s.dnsServer.GetConfig()
+	domains := append([]string{}, dc.IncludeSuffixes...)
+	for sfx := range dc.SuffixNamespaces {
+		domains = append(domains, sfx)
+	}
+	ws = uncoveredWildcards(ws, domains)
+	msgs := make([]string, len(ws))
+	for i, w := range ws {
+		msgs[i] = fmt.Sprintf("the never-proxy wildcard %q has no effect, because the names that it matches aren't "+
+			"sent to the Telepresence DNS resolver on this platform. List the host names instead", w)
+	}
+	return msgs
+}
+
+// onDNSAnswer is called by the DNS server with the addresses of each answer. Updating the routes takes
+// external commands on some platforms, so it's left to the proxyHostsWorker rather than delaying the
+// answer.
+func (s *session) onDNSAnswer(_ context.Context, name string, ipv6 bool, ips []net.IP, ttl time.Duration) {
+	expires := answerExpiry(time.Now(), ttl)
+	apChanged := s.alsoProxyHosts.setAddrs(name, ipv6, ips, expires)
+	npChanged := s.neverProxyHosts.setAddrs(name, ipv6, ips, expires)
+	if apChanged || npChanged {
+		select {
+		case s.proxyHostsChanged <- struct{}{}:
+		default:
+			// An update is already pending
+		}
+	}
+}
+
+// proxyHostsWorker resolves the also-proxy hosts in the cluster and the never-proxy hosts locally each
+// time the time to live of their addresses expires, drops the addresses of the names that only match a
+// wildcard when they expire, and updates the routes when the addresses change.
+func (s *session) proxyHostsWorker(ctx context.Context) error {
+	localLookup := func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		return ips, 0, err
+	}
+	ticker := time.NewTicker(proxyHostsMinTTL)
+	defer ticker.Stop()
+	changed := false
+	for {
+		now := time.Now()
+		if s.alsoProxyHosts.expire(now) {
+			changed = true
+		}
+		if s.neverProxyHosts.expire(now) {
+			changed = true
+		}
+		if s.alsoProxyHosts.resolveDue(ctx, now, s.clusterHostLookup) {
+			changed = true
+		}
+		if s.neverProxyHosts.resolveDue(ctx, now, localLookup) {
+			changed = true
+		}
+		if changed {
+			s.applyProxyHosts(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			changed = false
+		case <-s.proxyHostsChanged:
+			changed = true
+		}
+	}
+}
+
+// refreshSubnets reconciles the subnets of the TUN device with the cluster and also-proxy subnets and
+// the addresses of the also-proxy hosts. Conflicts between the cluster subnets and local networks are
+// detected anew, because they depend on the never-proxy subnets. The subnetsLock must be held by the caller.
 func (s *session) refreshSubnets(ctx context.Context) error {
+	scs := s.detectSubnetConflicts(ctx, s.clusterSubnets)
+	s.setSubnetConflicts(scs)
+	clusterSubnets := excludeConflicts(s.clusterSubnets, scs)
+
 	// Create a unique slice of all desired subnets.
-	desired := make([]*net.IPNet, len(s.clusterSubnets)+len(s.alsoProxySubnets))
-	copy(desired, s.clusterSubnets)
-	copy(desired[len(s.clusterSubnets):], s.alsoProxySubnets)
+	apHosts := s.alsoProxyHosts.subnets()
+	desired := make([]*net.IPNet, 0, len(clusterSubnets)+len(s.alsoProxySubnets)+len(apHosts))
+	desired = append(desired, clusterSubnets...)
+	desired = append(desired, s.alsoProxySubnets...)
+	desired = append(desired, apHosts...)
 	desired = subnet.Unique(desired)
 
 	// Remove all no longer desired subnets from the t.curSubnets
@@ -364,7 +725,7 @@ func (s *session) watchClusterInfo(ctx context.Context, cfgComplete chan<- struc
 	backoff := 100 * time.Millisecond
 
 	for ctx.Err() == nil {
-		infoStream, err := s.managerClient.WatchClusterInfo(ctx, s.session)
+		infoStream, err := s.managerClient.WatchClusterInfo(ctx, s.managerSession())
 		if err != nil {
 			err = fmt.Errorf("error when calling WatchClusterInfo: %w", err)
 			dlog.Warn(ctx, err)
@@ -397,22 +758,94 @@ func (s *session) watchClusterInfo(ctx context.Context, cfgComplete chan<- struc
 	}
 }
 
-func (s *session) onClusterInfo(ctx context.Context, mgrInfo *manager.ClusterInfo) {
-	dlog.Debugf(ctx, "WatchClusterInfo update")
+// watchServices tells the DNS server about services that are added, modified, or deleted, so that it can
+// drop the cached answers for their names. Traffic-managers that predate WatchServices don't report services,
+// and the cached answers then expire as usual.
+func (s *session) watchServices(ctx context.Context) {
+	backoff := 100 * time.Millisecond
 
-	subnets := make([]*net.IPNet, 0, 1+len(mgrInfo.PodSubnets))
+	for ctx.Err() == nil {
+		svcStream, err := s.managerClient.WatchServices(ctx, s.managerSession())
+		if err != nil {
+			err = fmt.Errorf("error when calling WatchServices: %w", err)
+			dlog.Warn(ctx, err)
+		}
+
+		// The first snapshot of each stream contains all services. None of them are new to the cache.
+		first := true
+		for err == nil && ctx.Err() == nil {
+			snapshot, err := svcStream.Recv()
+			if err != nil {
+				if status.Code(err) == codes.Unimplemented {
+					// Returning would shut down the session.
+					dlog.Debug(ctx, "The traffic-manager doesn't report services")
+					<-ctx.Done()
+					return
+				}
+				if ctx.Err() == nil && !errors.Is(err, io.EOF) {
+					dlog.Errorf(ctx, "WatchServices recv: %v", err)
+				}
+				break
+			}
+			if first {
+				first = false
+				continue
+			}
+			names := make([]string, len(snapshot.Updates))
+			for i, update := range snapshot.Updates {
+				names[i] = update.Service.Name
+				dlog.Debugf(ctx, "Service %s.%s changed (deleted=%t)", update.Service.Name, update.Service.Namespace, update.Deleted)
+			}
+			s.dnsServer.ServicesChanged(names)
+		}
+		dtime.SleepWithContext(ctx, backoff)
+		backoff *= 2
+		if backoff > 3*time.Second {
+			backoff = 3 * time.Second
+		}
+	}
+}
+
+// serviceSubnets returns all service subnets of the given ClusterInfo. Traffic-managers that predate
+// dual-stack support only report one service subnet.
+func serviceSubnets(mgrInfo *manager.ClusterInfo) []*manager.IPNet {
+	if len(mgrInfo.ServiceSubnets) > 0 {
+		return mgrInfo.ServiceSubnets
+	}
 	if mgrInfo.ServiceSubnet != nil {
-		cidr := iputil.IPNetFromRPC(mgrInfo.ServiceSubnet)
-		dlog.Infof(ctx, "Adding service subnet %s", cidr)
-		subnets = append(subnets, cidr)
+		return []*manager.IPNet{mgrInfo.ServiceSubnet}
 	}
+	return nil
+}
 
+// clusterSubnets returns the service subnets followed by the pod subnets of the given ClusterInfo.
+func clusterSubnets(mgrInfo *manager.ClusterInfo) []*net.IPNet {
+	svcSubnets := serviceSubnets(mgrInfo)
+	subnets := make([]*net.IPNet, 0, len(svcSubnets)+len(mgrInfo.PodSubnets))
+	for _, sn := range svcSubnets {
+		subnets = append(subnets, iputil.IPNetFromRPC(sn))
+	}
 	for _, sn := range mgrInfo.PodSubnets {
-		cidr := iputil.IPNetFromRPC(sn)
-		dlog.Infof(ctx, "Adding pod subnet %s", cidr)
-		subnets = append(subnets, cidr)
+		subnets = append(subnets, iputil.IPNetFromRPC(sn))
 	}
+	return subnets
+}
+
+func (s *session) onClusterInfo(ctx context.Context, mgrInfo *manager.ClusterInfo) {
+	dlog.Debugf(ctx, "WatchClusterInfo update")
 
+	subnets := clusterSubnets(mgrInfo)
+	nSvc := len(serviceSubnets(mgrInfo))
+	for i, cidr := range subnets {
+		if i < nSvc {
+			dlog.Infof(ctx, "Adding service subnet %s", cidr)
+		} else {
+			dlog.Infof(ctx, "Adding pod subnet %s", cidr)
+		}
+	}
+
+	s.subnetsLock.Lock()
+	defer s.subnetsLock.Unlock()
 	s.clusterSubnets = subnets
 	if err := s.refreshSubnets(ctx); err != nil {
 		dlog.Error(ctx, err)
@@ -444,6 +877,15 @@ func (s *session) run(c context.Context) error {
 		return s.dnsServer.Worker(ctx, s.dev, s.configureDNS)
 	})
 	g.Go("router", s.routerWorker)
+	g.Go("proxy-hosts", s.proxyHostsWorker)
+	g.Go("watch-services", func(ctx context.Context) error {
+		s.watchServices(ctx)
+		return nil
+	})
+	g.Go("network-monitor", func(ctx context.Context) error {
+		netmon.Watch(ctx, netmon.DefaultInterval, func(name string) bool { return name == s.dev.Name() }, s.onNetworkChange)
+		return nil
+	})
 	return g.Wait()
 }
 
@@ -469,6 +911,9 @@ func (s *session) stop(c context.Context) {
 			dlog.Warnf(c, "error removing route %s: %v", np, err)
 		}
 	}
+	if s.processRouter != nil {
+		s.processRouter.stop(cc)
+	}
 	if err := s.dev.Close(); err != nil {
 		dlog.Errorf(c, "unable to close %s: %v", s.dev.Name(), err)
 	}
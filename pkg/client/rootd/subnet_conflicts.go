@@ -0,0 +1,131 @@
+package rootd
+
+import (
+	"context"
+	"net"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+	"github.com/telepresenceio/telepresence/v2/pkg/subnet"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/routing"
+)
+
+// localNetwork is a network that the workstation routes via one of its own interfaces.
+type localNetwork struct {
+	subnet *net.IPNet
+	iface  string
+}
+
+// localNetworks returns the networks that the workstation can reach without the TUN device, either
+// because an interface has an address in them or because the routing table routes them via a
+// gateway. Default routes, loopback, link-local, and multicast networks are ignored, and so is
+// everything that is routed via the TUN device with the given name.
+func localNetworks(ctx context.Context, tunName string) []localNetwork {
+	var lns []localNetwork
+	seen := make(map[string]struct{})
+	add := func(sn *net.IPNet, iface *net.Interface) {
+		if iface == nil || iface.Name == tunName || iface.Flags&net.FlagLoopback != 0 {
+			return
+		}
+		if ones, _ := sn.Mask.Size(); ones == 0 {
+			return
+		}
+		ip := sn.IP.Mask(sn.Mask)
+		if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+			return
+		}
+		sn = &net.IPNet{IP: ip, Mask: sn.Mask}
+		key := sn.String() + "%" + iface.Name
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			lns = append(lns, localNetwork{subnet: sn, iface: iface.Name})
+		}
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		dlog.Errorf(ctx, "unable to list network interfaces: %v", err)
+	}
+	for i := range ifaces {
+		iface := &ifaces[i]
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			dlog.Errorf(ctx, "unable to get addresses of interface %s: %v", iface.Name, err)
+			continue
+		}
+		for _, addr := range addrs {
+			if ipn, ok := addr.(*net.IPNet); ok {
+				add(ipn, iface)
+			}
+		}
+	}
+
+	routes, err := routing.GetRoutingTable(ctx)
+	if err != nil {
+		dlog.Errorf(ctx, "unable to get the routing table: %v", err)
+	}
+	for _, r := range routes {
+		add(r.RoutedNet, r.Interface)
+	}
+	return lns
+}
+
+// findSubnetConflicts returns a conflict for each pair of cluster subnet and local network that
+// overlap. Local networks that are covered by a never-proxy subnet are ignored, because the user
+// has already decided that they should be routed locally. When exclude is true, the conflicts are
+// flagged as excluded.
+func findSubnetConflicts(clusterSubnets []*net.IPNet, locals []localNetwork, neverProxy []routing.Route, exclude bool) []*rpc.SubnetConflict {
+	var scs []*rpc.SubnetConflict
+nextLocal:
+	for _, ln := range locals {
+		for _, np := range neverProxy {
+			if subnet.Covers(np.RoutedNet, ln.subnet) {
+				continue nextLocal
+			}
+		}
+		for _, cs := range clusterSubnets {
+			if subnet.Overlaps(cs, ln.subnet) {
+				scs = append(scs, &rpc.SubnetConflict{
+					ClusterSubnet: iputil.IPNetToRPC(cs),
+					LocalSubnet:   iputil.IPNetToRPC(ln.subnet),
+					Interface:     ln.iface,
+					Excluded:      exclude,
+				})
+			}
+		}
+	}
+	return scs
+}
+
+// excludeConflicts returns the given cluster subnets with the local networks of all excluded
+// conflicts removed from them.
+func excludeConflicts(clusterSubnets []*net.IPNet, scs []*rpc.SubnetConflict) []*net.IPNet {
+	for _, sc := range scs {
+		if !sc.Excluded {
+			continue
+		}
+		ls := iputil.IPNetFromRPC(sc.LocalSubnet)
+		var remaining []*net.IPNet
+		for _, cs := range clusterSubnets {
+			remaining = append(remaining, subnet.Exclude(cs, ls)...)
+		}
+		clusterSubnets = remaining
+	}
+	return clusterSubnets
+}
+
+// detectSubnetConflicts finds the local networks that overlap with the given cluster subnets and
+// logs a warning for each one of them.
+func (s *session) detectSubnetConflicts(ctx context.Context, clusterSubnets []*net.IPNet) []*rpc.SubnetConflict {
+	exclude := client.GetConfig(ctx).Routing.SubnetConflictStrategy == client.SubnetConflictExclude
+	scs := findSubnetConflicts(clusterSubnets, localNetworks(ctx, s.dev.Name()), s.neverProxySubnets, exclude)
+	for _, sc := range scs {
+		dlog.Warnf(ctx, "Subnet conflict: %s", client.DescribeSubnetConflict(sc))
+	}
+	return scs
+}
@@ -0,0 +1,58 @@
+package rootd
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/routing"
+)
+
+func cidr(t *testing.T, s string) *net.IPNet {
+	_, sn, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	return sn
+}
+
+func Test_findSubnetConflicts(t *testing.T) {
+	clusterSubnets := []*net.IPNet{cidr(t, "10.96.0.0/12"), cidr(t, "192.168.0.0/16")}
+	locals := []localNetwork{
+		{subnet: cidr(t, "10.0.0.0/8"), iface: "utun3"},
+		{subnet: cidr(t, "192.168.1.0/24"), iface: "en0"},
+		{subnet: cidr(t, "172.17.0.0/16"), iface: "docker0"},
+		{subnet: cidr(t, "192.168.50.0/24"), iface: "eth1"},
+	}
+	neverProxy := []routing.Route{{RoutedNet: cidr(t, "192.168.50.0/24")}}
+
+	scs := findSubnetConflicts(clusterSubnets, locals, neverProxy, false)
+	require.Len(t, scs, 2)
+	assert.Equal(t, "10.96.0.0/12", iputil.IPNetFromRPC(scs[0].ClusterSubnet).String())
+	assert.Equal(t, "10.0.0.0/8", iputil.IPNetFromRPC(scs[0].LocalSubnet).String())
+	assert.Equal(t, "utun3", scs[0].Interface)
+	assert.Equal(t, "192.168.0.0/16", iputil.IPNetFromRPC(scs[1].ClusterSubnet).String())
+	assert.Equal(t, "192.168.1.0/24", iputil.IPNetFromRPC(scs[1].LocalSubnet).String())
+	assert.Equal(t, "en0", scs[1].Interface)
+
+	// Nothing is excluded unless asked for
+	assert.Equal(t, clusterSubnets, excludeConflicts(clusterSubnets, scs))
+
+	scs = findSubnetConflicts(clusterSubnets, locals, neverProxy, true)
+	require.Len(t, scs, 2)
+	var routed []string
+	for _, sn := range excludeConflicts(clusterSubnets, scs) {
+		routed = append(routed, sn.String())
+	}
+	assert.Equal(t, []string{
+		"192.168.0.0/24",
+		"192.168.2.0/23",
+		"192.168.4.0/22",
+		"192.168.8.0/21",
+		"192.168.16.0/20",
+		"192.168.32.0/19",
+		"192.168.64.0/18",
+		"192.168.128.0/17",
+	}, routed)
+}
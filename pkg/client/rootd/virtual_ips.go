@@ -0,0 +1,41 @@
+package rootd
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/subnet"
+)
+
+// newVirtualIPAllocator returns an allocator for the configured virtual subnet. The subnet is
+// validated against the local networks and the never-proxy subnets, and addresses that collide
+// with them are never allocated. The allocator lives as long as the session, so a name that is
+// resolved again yields the same address.
+func (s *session) newVirtualIPAllocator(ctx context.Context) (subnet.IPAllocator, error) {
+	vs := (*net.IPNet)(client.GetConfig(ctx).Routing.VirtualSubnet)
+	var avoid []*net.IPNet
+	for _, ln := range localNetworks(ctx, s.dev.Name()) {
+		if subnet.Overlaps(vs, ln.subnet) {
+			dlog.Warnf(ctx, "Virtual subnet %s overlaps with local network %s on interface %s", vs, ln.subnet, ln.iface)
+			avoid = append(avoid, ln.subnet)
+		}
+	}
+	for _, np := range s.neverProxySubnets {
+		if subnet.Overlaps(vs, np.RoutedNet) {
+			dlog.Warnf(ctx, "Virtual subnet %s overlaps with never-proxy subnet %s", vs, np.RoutedNet)
+			avoid = append(avoid, np.RoutedNet)
+		}
+	}
+	a, err := subnet.NewIPAllocator(vs, avoid)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"unable to allocate virtual IPs: %v\nchange routing.virtualSubnet in the config to a subnet that isn't used locally", err)
+	}
+	dlog.Infof(ctx, "Allocating virtual IPs from subnet %s", vs)
+	return a, nil
+}
@@ -0,0 +1,389 @@
+// Package sdk provides programmatic control of Telepresence. It talks to the gRPC API of the user daemon, the
+// same API that the telepresence CLI uses, so that test frameworks and other tools can connect to a cluster,
+// list workloads, and create and remove intercepts without running the CLI.
+//
+// All calls are bound to the context that they are given. Cancelling the context cancels the call, but it never
+// cancels a session or an intercept. A session ends when Disconnect is called, and an intercept ends when Leave
+// is called.
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/common"
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/docker"
+	"github.com/telepresenceio/telepresence/v2/pkg/proc"
+)
+
+// ErrNoUserDaemon is returned by Dial when the user daemon isn't running.
+var ErrNoUserDaemon = errors.New("telepresence user daemon is not running")
+
+// Client controls Telepresence using the gRPC API of the user daemon. A Client is safe for concurrent use.
+type Client struct {
+	conn *grpc.ClientConn
+	cc   connector.ConnectorClient
+}
+
+// NewClient returns a Client that uses the given connection to the user daemon. The Client takes ownership of
+// the connection and closes it when the Client is closed.
+func NewClient(conn *grpc.ClientConn) *Client {
+	return &Client{conn: conn, cc: connector.NewConnectorClient(conn)}
+}
+
+// Dial returns a Client for the running user daemon, or ErrNoUserDaemon when it isn't running.
+func Dial(ctx context.Context) (*Client, error) {
+	var conn *grpc.ClientConn
+	var err error
+	if dd := docker.RunningDaemon(ctx); dd != nil {
+		conn, err = docker.Dial(ctx, dd.ConnectorAddress, dd.Token)
+	} else {
+		conn, err = client.DialSocket(ctx, client.ConnectorSocketName)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = ErrNoUserDaemon
+		}
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// Start starts the user daemon using the given telepresence executable, unless it's already running, and
+// returns a Client for it. The user daemon keeps running when the Client is closed. Use Quit to stop it.
+func Start(ctx context.Context, executable string) (*Client, error) {
+	err := client.WithStartLock(ctx, "connector", func() error {
+		if running, err := client.SocketExists(client.ConnectorSocketName); err != nil || running {
+			return err
+		}
+		if err := proc.StartInBackground(executable, "connector-foreground"); err != nil {
+			return fmt.Errorf("failed to launch the user daemon: %w", err)
+		}
+		return client.WaitUntilSocketAppears("connector", client.ConnectorSocketName, 10*time.Second)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Dial(ctx)
+}
+
+// Close closes the connection to the user daemon. It doesn't end the session.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Version returns the version of the user daemon.
+func (c *Client) Version(ctx context.Context) (*common.VersionInfo, error) {
+	return c.cc.Version(ctx, &empty.Empty{})
+}
+
+// Supports returns true if the user daemon reports the given capability, e.g. client.CapabilityWorkloadSelector.
+// A daemon that predates capability negotiation reports no capabilities.
+func (c *Client) Supports(ctx context.Context, capability string) (bool, error) {
+	vi, err := c.Version(ctx)
+	if err != nil {
+		return false, err
+	}
+	return client.HasCapability(vi.Capabilities, capability), nil
+}
+
+// ConnectOptions are the options of a Connect call.
+type ConnectOptions struct {
+	// KubeFlags are the Kubernetes flags, e.g. "context" or "namespace", keyed by name without dashes.
+	KubeFlags map[string]string
+
+	// MappedNamespaces limits the namespaces that the session maps. All namespaces are mapped when empty.
+	MappedNamespaces []string
+
+	// SuffixNamespaces are DNS suffix to namespace mappings, see the --dns-suffix-namespace flag of
+	// telepresence connect.
+	SuffixNamespaces map[string]string
+
+	// ProxyAddress, when set, makes the session serve a SOCKS5 and HTTP CONNECT proxy on the given address
+	// instead of using the root daemon, see the --proxy-only flag of telepresence connect. The root daemon must
+	// be running unless the ProxyAddress is set.
+	ProxyAddress string
+
+	// KubeconfigData, when set, is the content of the kubeconfig to use instead of a kubeconfig file. The
+	// KubeFlags are applied to it but cannot contain "kubeconfig".
+	KubeconfigData []byte
+
+	// Progress, when set, receives the progress events of the connect.
+	Progress func(*connector.ProgressEvent)
+}
+
+// ConnectError is the error returned by Connect when the user daemon is unable to connect.
+type ConnectError struct {
+	Code connector.ConnectInfo_ErrType
+	Text string
+}
+
+func (e *ConnectError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("connect failed: %s", e.Code)
+	}
+	return fmt.Sprintf("connect failed: %s: %s", e.Code, e.Text)
+}
+
+// Connect connects to the cluster, unless a session already exists, and returns information about the session.
+func (c *Client) Connect(ctx context.Context, opts ConnectOptions) (*connector.ConnectInfo, error) {
+	cr := &connector.ConnectRequest{
+		KubeFlags:        opts.KubeFlags,
+		MappedNamespaces: opts.MappedNamespaces,
+		SuffixNamespaces: opts.SuffixNamespaces,
+		ProxyAddress:     opts.ProxyAddress,
+		KubeconfigData:   opts.KubeconfigData,
+	}
+	var ci *connector.ConnectInfo
+	var err error
+	if opts.Progress == nil {
+		ci, err = c.cc.Connect(ctx, cr)
+	} else {
+		ci, err = c.connectWithProgress(ctx, cr, opts.Progress)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch ci.Error {
+	case connector.ConnectInfo_UNSPECIFIED, connector.ConnectInfo_ALREADY_CONNECTED:
+		return ci, nil
+	default:
+		return nil, &ConnectError{Code: ci.Error, Text: ci.ErrorText}
+	}
+}
+
+func (c *Client) connectWithProgress(ctx context.Context, cr *connector.ConnectRequest, progress func(*connector.ProgressEvent)) (*connector.ConnectInfo, error) {
+	stream, err := c.cc.ConnectWithProgress(ctx, cr)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		cp, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("the connect ended without a result")
+			}
+			return nil, err
+		}
+		if r := cp.GetResult(); r != nil {
+			return r, nil
+		}
+		progress(cp.GetProgress())
+	}
+}
+
+// Disconnect ends the session. The user daemon keeps running.
+func (c *Client) Disconnect(ctx context.Context) error {
+	_, err := c.cc.Disconnect(ctx, &empty.Empty{})
+	return err
+}
+
+// Quit ends the session and stops the user daemon.
+func (c *Client) Quit(ctx context.Context) error {
+	_, err := c.cc.Quit(ctx, &empty.Empty{})
+	return err
+}
+
+// Status returns information about the current session. The Error of the returned info is
+// connector.ConnectInfo_DISCONNECTED when there's no session.
+func (c *Client) Status(ctx context.Context) (*connector.ConnectInfo, error) {
+	return c.cc.Status(ctx, &empty.Empty{})
+}
+
+// ListOptions are the options of a List call.
+type ListOptions struct {
+	// Namespace is the namespace to list. The namespace of the session is used when empty.
+	Namespace string
+
+	// Filter determines what workloads are listed. Interceptable workloads are listed when unspecified.
+	Filter connector.ListRequest_Filter
+
+	// Kinds limits the listed workloads to the given kinds, e.g. "Deployment".
+	Kinds []string
+
+	// LabelSelector is a Kubernetes label selector that the listed workloads must match.
+	LabelSelector string
+}
+
+// List returns the workloads that match the given options.
+func (c *Client) List(ctx context.Context, opts ListOptions) ([]*connector.WorkloadInfo, error) {
+	filter := opts.Filter
+	if filter == connector.ListRequest_UNSPECIFIED {
+		filter = connector.ListRequest_INTERCEPTABLE
+	}
+	r, err := c.cc.List(ctx, &connector.ListRequest{
+		Filter:        filter,
+		Namespace:     opts.Namespace,
+		Kinds:         opts.Kinds,
+		LabelSelector: opts.LabelSelector,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Workloads, nil
+}
+
+// InterceptOptions are the options of an Intercept call.
+type InterceptOptions struct {
+	// Name is the name of the intercept.
+	Name string
+
+	// Workload is the name of the intercepted workload. It defaults to the Name unless a Selector is given.
+	Workload string
+
+	// Selector is a label selector that identifies the intercepted workload by the labels of its pods.
+	Selector string
+
+	// Namespace is the namespace of the workload. The namespace of the session is used when empty.
+	Namespace string
+
+	// Port is the local port that the intercepted traffic is sent to.
+	Port uint16
+
+	// ServicePort identifies the intercepted service port by name or number. It's required when the
+	// service has more than one port.
+	ServicePort string
+
+	// ServiceName is the name of the intercepted service. It's required when the workload is exposed by
+	// more than one service.
+	ServiceName string
+
+	// Mechanism is the intercept mechanism. It defaults to "tcp".
+	Mechanism string
+
+	// MechanismArgs are the arguments of the mechanism, e.g. the --http-header arguments of the "http" mechanism.
+	MechanismArgs []string
+
+	// MountPoint is the local directory where the remote volumes are mounted. Nothing is mounted when empty.
+	MountPoint string
+
+	// Encrypt enables end-to-end encryption of the intercepted connections.
+	Encrypt bool
+
+	// IdempotencyKey makes the call safe to retry. A random key is used when empty.
+	IdempotencyKey string
+
+	// Progress, when set, receives the progress events of the intercept.
+	Progress func(*connector.ProgressEvent)
+}
+
+// InterceptError is the error returned by Intercept and Leave when the user daemon is unable to create or
+// remove an intercept.
+type InterceptError struct {
+	Code connector.InterceptError
+	Text string
+}
+
+func (e *InterceptError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("intercept failed: %s", e.Code)
+	}
+	return fmt.Sprintf("intercept failed: %s: %s", e.Code, e.Text)
+}
+
+func interceptError(r *connector.InterceptResult) error {
+	if r.Error == connector.InterceptError_UNSPECIFIED {
+		return nil
+	}
+	return &InterceptError{Code: r.Error, Text: r.ErrorText}
+}
+
+// Intercept creates an intercept and returns the result, which contains the intercept info and the environment
+// of the intercepted container.
+func (c *Client) Intercept(ctx context.Context, opts InterceptOptions) (*connector.InterceptResult, error) {
+	if opts.Name == "" {
+		return nil, errors.New("the intercept must have a name")
+	}
+	if opts.Port == 0 {
+		return nil, errors.New("the intercept must have a local port")
+	}
+	workload := opts.Workload
+	if workload == "" && opts.Selector == "" {
+		workload = opts.Name
+	}
+	mechanism := opts.Mechanism
+	if mechanism == "" {
+		mechanism = "tcp"
+	}
+	key := opts.IdempotencyKey
+	if key == "" {
+		key = uuid.New().String()
+	}
+	ir := &connector.CreateInterceptRequest{
+		Spec: &manager.InterceptSpec{
+			Name:                  opts.Name,
+			Namespace:             opts.Namespace,
+			Agent:                 workload,
+			ServiceName:           opts.ServiceName,
+			ServicePortIdentifier: opts.ServicePort,
+			Mechanism:             mechanism,
+			MechanismArgs:         opts.MechanismArgs,
+			TargetHost:            "127.0.0.1",
+			TargetPort:            int32(opts.Port),
+		},
+		MountPoint:       opts.MountPoint,
+		Encrypt:          opts.Encrypt,
+		IdempotencyKey:   key,
+		WorkloadSelector: opts.Selector,
+	}
+	r, err := c.cc.CanIntercept(ctx, ir)
+	if err != nil {
+		return nil, err
+	}
+	if err = interceptError(r); err != nil {
+		return nil, err
+	}
+	ir.Spec.WorkloadKind = r.WorkloadKind
+	if opts.Progress == nil {
+		r, err = c.cc.CreateIntercept(ctx, ir)
+	} else {
+		r, err = c.createInterceptWithProgress(ctx, ir, opts.Progress)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = interceptError(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (c *Client) createInterceptWithProgress(ctx context.Context, ir *connector.CreateInterceptRequest, progress func(*connector.ProgressEvent)) (*connector.InterceptResult, error) {
+	stream, err := c.cc.CreateInterceptWithProgress(ctx, ir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		ip, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("the intercept ended without a result")
+			}
+			return nil, err
+		}
+		if r := ip.GetResult(); r != nil {
+			return r, nil
+		}
+		progress(ip.GetProgress())
+	}
+}
+
+// Leave removes the intercept with the given name.
+func (c *Client) Leave(ctx context.Context, name string) error {
+	r, err := c.cc.RemoveIntercept(ctx, &manager.RemoveInterceptRequest2{Name: name})
+	if err != nil {
+		return err
+	}
+	return interceptError(r)
+}
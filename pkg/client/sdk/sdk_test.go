@@ -0,0 +1,188 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/common"
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+)
+
+// fakeConnector records the requests that it receives and answers them with canned results.
+type fakeConnector struct {
+	connector.UnimplementedConnectorServer
+	connectRequest  *connector.ConnectRequest
+	listRequest     *connector.ListRequest
+	createRequest   *connector.CreateInterceptRequest
+	intercepts      map[string]*manager.InterceptInfo
+	connectError    connector.ConnectInfo_ErrType
+	disconnectCalls int
+}
+
+func (f *fakeConnector) Version(context.Context, *empty.Empty) (*common.VersionInfo, error) {
+	return &common.VersionInfo{ApiVersion: client.APIVersion, Capabilities: []string{client.CapabilityListFilters}}, nil
+}
+
+func (f *fakeConnector) Connect(_ context.Context, cr *connector.ConnectRequest) (*connector.ConnectInfo, error) {
+	f.connectRequest = cr
+	return &connector.ConnectInfo{Error: f.connectError, ErrorText: "boom", ClusterContext: "test"}, nil
+}
+
+func (f *fakeConnector) ConnectWithProgress(cr *connector.ConnectRequest, stream connector.Connector_ConnectWithProgressServer) error {
+	for _, stage := range []connector.ProgressEvent_Stage{connector.ProgressEvent_CLUSTER_CONNECT, connector.ProgressEvent_MANAGER_CONNECT} {
+		if err := stream.Send(&connector.ConnectProgress{Event: &connector.ConnectProgress_Progress{Progress: &connector.ProgressEvent{Stage: stage, Done: true}}}); err != nil {
+			return err
+		}
+	}
+	ci, _ := f.Connect(stream.Context(), cr)
+	return stream.Send(&connector.ConnectProgress{Event: &connector.ConnectProgress_Result{Result: ci}})
+}
+
+func (f *fakeConnector) Disconnect(context.Context, *empty.Empty) (*empty.Empty, error) {
+	f.disconnectCalls++
+	return &empty.Empty{}, nil
+}
+
+func (f *fakeConnector) List(_ context.Context, lr *connector.ListRequest) (*connector.WorkloadInfoSnapshot, error) {
+	f.listRequest = lr
+	return &connector.WorkloadInfoSnapshot{Workloads: []*connector.WorkloadInfo{{Name: "echo"}}}, nil
+}
+
+func (f *fakeConnector) CanIntercept(_ context.Context, ir *connector.CreateInterceptRequest) (*connector.InterceptResult, error) {
+	if _, ok := f.intercepts[ir.Spec.Name]; ok {
+		return &connector.InterceptResult{Error: connector.InterceptError_ALREADY_EXISTS, ErrorText: ir.Spec.Name}, nil
+	}
+	return &connector.InterceptResult{WorkloadKind: "Deployment"}, nil
+}
+
+func (f *fakeConnector) CreateIntercept(_ context.Context, ir *connector.CreateInterceptRequest) (*connector.InterceptResult, error) {
+	f.createRequest = ir
+	ii := &manager.InterceptInfo{Spec: ir.Spec, Id: "1:" + ir.Spec.Name}
+	f.intercepts[ir.Spec.Name] = ii
+	return &connector.InterceptResult{InterceptInfo: ii, Environment: map[string]string{"A": "B"}}, nil
+}
+
+func (f *fakeConnector) RemoveIntercept(_ context.Context, rr *manager.RemoveInterceptRequest2) (*connector.InterceptResult, error) {
+	if _, ok := f.intercepts[rr.Name]; !ok {
+		return &connector.InterceptResult{Error: connector.InterceptError_NOT_FOUND, ErrorText: rr.Name}, nil
+	}
+	delete(f.intercepts, rr.Name)
+	return &connector.InterceptResult{}, nil
+}
+
+func testClient(t *testing.T) (*Client, *fakeConnector) {
+	lis := bufconn.Listen(64 * 1024)
+	fc := &fakeConnector{intercepts: make(map[string]*manager.InterceptInfo)}
+	s := grpc.NewServer()
+	connector.RegisterConnectorServer(s, fc)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure())
+	require.NoError(t, err)
+	c := NewClient(conn)
+	t.Cleanup(func() { _ = c.Close() })
+	return c, fc
+}
+
+func TestClient_Connect(t *testing.T) {
+	ctx := context.Background()
+	c, fc := testClient(t)
+
+	ci, err := c.Connect(ctx, ConnectOptions{KubeFlags: map[string]string{"context": "test"}, MappedNamespaces: []string{"a"}})
+	require.NoError(t, err)
+	assert.Equal(t, "test", ci.ClusterContext)
+	assert.Equal(t, "test", fc.connectRequest.KubeFlags["context"])
+	assert.Equal(t, []string{"a"}, fc.connectRequest.MappedNamespaces)
+
+	fc.connectError = connector.ConnectInfo_CLUSTER_FAILED
+	_, err = c.Connect(ctx, ConnectOptions{})
+	var ce *ConnectError
+	require.True(t, errors.As(err, &ce))
+	assert.Equal(t, connector.ConnectInfo_CLUSTER_FAILED, ce.Code)
+	assert.Equal(t, "boom", ce.Text)
+
+	require.NoError(t, c.Disconnect(ctx))
+	assert.Equal(t, 1, fc.disconnectCalls)
+}
+
+func TestClient_ConnectWithProgress(t *testing.T) {
+	c, fc := testClient(t)
+	var stages []connector.ProgressEvent_Stage
+	ci, err := c.Connect(context.Background(), ConnectOptions{
+		MappedNamespaces: []string{"a"},
+		Progress:         func(e *connector.ProgressEvent) { stages = append(stages, e.Stage) },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "test", ci.ClusterContext)
+	assert.Equal(t, []string{"a"}, fc.connectRequest.MappedNamespaces)
+	assert.Equal(t, []connector.ProgressEvent_Stage{connector.ProgressEvent_CLUSTER_CONNECT, connector.ProgressEvent_MANAGER_CONNECT}, stages)
+}
+
+func TestClient_Supports(t *testing.T) {
+	ctx := context.Background()
+	c, _ := testClient(t)
+	ok, err := c.Supports(ctx, client.CapabilityListFilters)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.Supports(ctx, client.CapabilityWorkloadSelector)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestClient_List(t *testing.T) {
+	c, fc := testClient(t)
+	wls, err := c.List(context.Background(), ListOptions{Namespace: "ns", Kinds: []string{"Deployment"}})
+	require.NoError(t, err)
+	require.Len(t, wls, 1)
+	assert.Equal(t, "echo", wls[0].Name)
+	assert.Equal(t, connector.ListRequest_INTERCEPTABLE, fc.listRequest.Filter)
+	assert.Equal(t, "ns", fc.listRequest.Namespace)
+}
+
+func TestClient_InterceptAndLeave(t *testing.T) {
+	ctx := context.Background()
+	c, fc := testClient(t)
+
+	_, err := c.Intercept(ctx, InterceptOptions{Name: "echo"})
+	assert.Error(t, err, "a local port is required")
+
+	r, err := c.Intercept(ctx, InterceptOptions{Name: "echo", Port: 8080, ServicePort: "http"})
+	require.NoError(t, err)
+	assert.Equal(t, "B", r.Environment["A"])
+	spec := fc.createRequest.Spec
+	assert.Equal(t, "echo", spec.Agent)
+	assert.Equal(t, "Deployment", spec.WorkloadKind)
+	assert.Equal(t, "tcp", spec.Mechanism)
+	assert.Equal(t, int32(8080), spec.TargetPort)
+	assert.Equal(t, "http", spec.ServicePortIdentifier)
+	assert.NotEmpty(t, fc.createRequest.IdempotencyKey)
+
+	_, err = c.Intercept(ctx, InterceptOptions{Name: "echo", Port: 8080})
+	var ie *InterceptError
+	require.True(t, errors.As(err, &ie))
+	assert.Equal(t, connector.InterceptError_ALREADY_EXISTS, ie.Code)
+
+	// The workload isn't defaulted to the name when a selector is given
+	_, err = c.Intercept(ctx, InterceptOptions{Name: "web", Port: 8081, Selector: "app=web"})
+	require.NoError(t, err)
+	assert.Empty(t, fc.createRequest.Spec.Agent)
+	assert.Equal(t, "app=web", fc.createRequest.WorkloadSelector)
+
+	require.NoError(t, c.Leave(ctx, "echo"))
+	err = c.Leave(ctx, "echo")
+	require.True(t, errors.As(err, &ie))
+	assert.Equal(t, connector.InterceptError_NOT_FOUND, ie.Code)
+}
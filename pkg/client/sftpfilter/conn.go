@@ -0,0 +1,358 @@
+package sftpfilter
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// SFTP version 3 packet types, see https://datatracker.ietf.org/doc/html/draft-ietf-secsh-filexfer-02
+const (
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpLstat    = 7
+	fxpSetstat  = 9
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpReadlink = 19
+	fxpSymlink  = 20
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpName     = 104
+	fxpExtended = 200
+
+	fxNoSuchFile = 2
+
+	attrSize        = 0x00000001
+	attrUIDGID      = 0x00000002
+	attrPermissions = 0x00000004
+	attrACModTime   = 0x00000008
+	attrExtended    = 0x80000000
+
+	// maxPacketSize is far larger than what sshfs and sftp-server use. It protects against allocating
+	// huge buffers when the stream is corrupt.
+	maxPacketSize = 1 << 24
+)
+
+// NewConn returns a connection to the SFTP server at the other end of server. Requests that the client sends on
+// the returned connection for paths that aren't visible through the given filter are answered with "no such file",
+// and such paths are removed from directory listings.
+func NewConn(ctx context.Context, server io.ReadWriteCloser, f *Filter) io.ReadWriteCloser {
+	fromClient, toRelay := io.Pipe()
+	toClientReader, toClient := io.Pipe()
+	r := &relay{
+		filter:   f,
+		server:   server,
+		client:   toClient,
+		opendirs: make(map[uint32]string),
+		readdirs: make(map[uint32]string),
+		handles:  make(map[string]string),
+	}
+	go r.requests(ctx, fromClient)
+	go r.responses(ctx)
+	return &conn{Reader: toClientReader, Writer: toRelay, closers: []io.Closer{toRelay, toClientReader, server}}
+}
+
+type conn struct {
+	io.Reader
+	io.Writer
+	closers []io.Closer
+}
+
+func (c *conn) Close() error {
+	var err error
+	for _, cl := range c.closers {
+		if e := cl.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+type relay struct {
+	filter *Filter
+	server io.ReadWriteCloser
+
+	clientLock sync.Mutex
+	client     *io.PipeWriter
+
+	// The directory of each pending OPENDIR and READDIR request, keyed by request id, and of each open
+	// directory handle.
+	dirsLock sync.Mutex
+	opendirs map[uint32]string
+	readdirs map[uint32]string
+	handles  map[string]string
+}
+
+// requests relays requests from the client to the server.
+func (r *relay) requests(ctx context.Context, fromClient *io.PipeReader) {
+	defer r.server.Close()
+	for {
+		pkt, err := readPacket(fromClient)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) {
+				dlog.Errorf(ctx, "sftp filter failed to read request: %v", err)
+			}
+			_ = fromClient.CloseWithError(err)
+			return
+		}
+		if id, ok := r.deniedRequest(pkt); ok {
+			err = r.writeClient(statusPacket(id, fxNoSuchFile, "No such file"))
+		} else {
+			_, err = r.server.Write(pkt)
+		}
+		if err != nil {
+			_ = fromClient.CloseWithError(err)
+			return
+		}
+	}
+}
+
+// responses relays responses from the server to the client.
+func (r *relay) responses(ctx context.Context) {
+	for {
+		pkt, err := readPacket(r.server)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				dlog.Debugf(ctx, "sftp filter failed to read response: %v", err)
+			}
+			_ = r.client.CloseWithError(err)
+			return
+		}
+		if err = r.writeClient(r.filterResponse(pkt)); err != nil {
+			return
+		}
+	}
+}
+
+func (r *relay) writeClient(pkt []byte) error {
+	r.clientLock.Lock()
+	defer r.clientLock.Unlock()
+	_, err := r.client.Write(pkt)
+	return err
+}
+
+// deniedRequest returns the id of the given request and true if the request concerns a path that isn't visible.
+// It also keeps track of the directories that are opened, so that their listings can be filtered.
+func (r *relay) deniedRequest(pkt []byte) (uint32, bool) {
+	typ := pkt[4]
+	id, rest, ok := readUint32(pkt[5:])
+	if !ok {
+		return 0, false
+	}
+	var paths []string
+	switch typ {
+	case fxpOpen, fxpLstat, fxpSetstat, fxpOpendir, fxpRemove, fxpMkdir, fxpRmdir, fxpStat, fxpReadlink:
+		paths = readStrings(rest, 1)
+	case fxpRename, fxpSymlink:
+		paths = readStrings(rest, 2)
+	case fxpExtended:
+		if ext := readStrings(rest, 1); len(ext) == 1 {
+			rest = rest[4+len(ext[0]):]
+			switch ext[0] {
+			case "posix-rename@openssh.com", "hardlink@openssh.com":
+				paths = readStrings(rest, 2)
+			case "statvfs@openssh.com", "lsetstat@openssh.com":
+				paths = readStrings(rest, 1)
+			}
+		}
+	case fxpReaddir:
+		if h := readStrings(rest, 1); len(h) == 1 {
+			r.dirsLock.Lock()
+			if dir, ok := r.handles[h[0]]; ok {
+				r.readdirs[id] = dir
+			}
+			r.dirsLock.Unlock()
+		}
+		return id, false
+	case fxpClose:
+		if h := readStrings(rest, 1); len(h) == 1 {
+			r.dirsLock.Lock()
+			delete(r.handles, h[0])
+			r.dirsLock.Unlock()
+		}
+		return id, false
+	}
+	for _, p := range paths {
+		if !r.filter.Visible(p) {
+			return id, true
+		}
+	}
+	if typ == fxpOpendir && len(paths) == 1 {
+		r.dirsLock.Lock()
+		r.opendirs[id] = paths[0]
+		r.dirsLock.Unlock()
+	}
+	return id, false
+}
+
+// filterResponse returns the given response, or a copy of it where the entries that aren't visible are removed
+// when it's the response to a READDIR request.
+func (r *relay) filterResponse(pkt []byte) []byte {
+	typ := pkt[4]
+	id, rest, ok := readUint32(pkt[5:])
+	if !ok {
+		return pkt
+	}
+	r.dirsLock.Lock()
+	defer r.dirsLock.Unlock()
+	switch typ {
+	case fxpHandle:
+		if dir, ok := r.opendirs[id]; ok {
+			delete(r.opendirs, id)
+			if h := readStrings(rest, 1); len(h) == 1 {
+				r.handles[h[0]] = dir
+			}
+		}
+	case fxpStatus:
+		delete(r.opendirs, id)
+		delete(r.readdirs, id)
+	case fxpName:
+		if dir, ok := r.readdirs[id]; ok {
+			delete(r.readdirs, id)
+			if filtered, ok := r.filterNames(id, dir, rest); ok {
+				return filtered
+			}
+		}
+	}
+	return pkt
+}
+
+// filterNames returns a NAME packet with the entries of the given NAME packet payload that are visible.
+func (r *relay) filterNames(id uint32, dir string, payload []byte) ([]byte, bool) {
+	count, rest, ok := readUint32(payload)
+	if !ok {
+		return nil, false
+	}
+	var kept uint32
+	entries := make([]byte, 0, len(rest))
+	for i := uint32(0); i < count; i++ {
+		start := rest
+		names := readStrings(rest, 2)
+		if len(names) != 2 {
+			return nil, false
+		}
+		rest = rest[8+len(names[0])+len(names[1]):]
+		if rest, ok = skipAttrs(rest); !ok {
+			return nil, false
+		}
+		if names[0] == "." || names[0] == ".." || r.filter.Visible(path.Join(dir, names[0])) {
+			entries = append(entries, start[:len(start)-len(rest)]...)
+			kept++
+		}
+	}
+	pkt := make([]byte, 13, 13+len(entries))
+	pkt[4] = fxpName
+	binary.BigEndian.PutUint32(pkt[5:], id)
+	binary.BigEndian.PutUint32(pkt[9:], kept)
+	pkt = append(pkt, entries...)
+	binary.BigEndian.PutUint32(pkt, uint32(len(pkt)-4))
+	return pkt, true
+}
+
+// readPacket reads one packet, including its length.
+func readPacket(rd io.Reader) ([]byte, error) {
+	var lb [4]byte
+	if _, err := io.ReadFull(rd, lb[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(lb[:])
+	if n == 0 || n > maxPacketSize {
+		return nil, errors.New("invalid sftp packet length")
+	}
+	pkt := make([]byte, 4+n)
+	copy(pkt, lb[:])
+	if _, err := io.ReadFull(rd, pkt[4:]); err != nil {
+		return nil, err
+	}
+	return pkt, nil
+}
+
+func statusPacket(id, code uint32, msg string) []byte {
+	pkt := make([]byte, 0, 21+len(msg))
+	pkt = append(pkt, 0, 0, 0, 0, fxpStatus)
+	pkt = appendUint32(pkt, id)
+	pkt = appendUint32(pkt, code)
+	pkt = appendString(pkt, msg)
+	pkt = appendString(pkt, "")
+	binary.BigEndian.PutUint32(pkt, uint32(len(pkt)-4))
+	return pkt
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendUint32(b, uint32(len(s))), s...)
+}
+
+func readUint32(b []byte) (uint32, []byte, bool) {
+	if len(b) < 4 {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint32(b), b[4:], true
+}
+
+// readStrings reads n strings from b. Fewer strings are returned when b is too short.
+func readStrings(b []byte, n int) []string {
+	ss := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		l, rest, ok := readUint32(b)
+		if !ok || uint32(len(rest)) < l {
+			break
+		}
+		ss = append(ss, string(rest[:l]))
+		b = rest[l:]
+	}
+	return ss
+}
+
+// skipAttrs returns what follows the ATTRS at the start of b.
+func skipAttrs(b []byte) ([]byte, bool) {
+	flags, b, ok := readUint32(b)
+	if !ok {
+		return nil, false
+	}
+	n := 0
+	if flags&attrSize != 0 {
+		n += 8
+	}
+	if flags&attrUIDGID != 0 {
+		n += 8
+	}
+	if flags&attrPermissions != 0 {
+		n += 4
+	}
+	if flags&attrACModTime != 0 {
+		n += 8
+	}
+	if len(b) < n {
+		return nil, false
+	}
+	b = b[n:]
+	if flags&attrExtended != 0 {
+		var count uint32
+		if count, b, ok = readUint32(b); !ok {
+			return nil, false
+		}
+		for i := uint32(0); i < count; i++ {
+			kv := readStrings(b, 2)
+			if len(kv) != 2 {
+				return nil, false
+			}
+			b = b[8+len(kv[0])+len(kv[1]):]
+		}
+	}
+	return b, true
+}
@@ -0,0 +1,115 @@
+package sftpfilter
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+func packet(typ byte, id uint32, fields ...[]byte) []byte {
+	pkt := []byte{0, 0, 0, 0, typ}
+	pkt = appendUint32(pkt, id)
+	for _, f := range fields {
+		pkt = append(pkt, f...)
+	}
+	binary.BigEndian.PutUint32(pkt, uint32(len(pkt)-4))
+	return pkt
+}
+
+func str(s string) []byte {
+	return appendString(nil, s)
+}
+
+func u32(v uint32) []byte {
+	return appendUint32(nil, v)
+}
+
+// nameEntry returns a NAME entry with a permissions attribute.
+func nameEntry(name string) []byte {
+	e := append(str(name), str("-rw-r--r-- "+name)...)
+	return append(e, append(u32(attrPermissions), u32(0o644)...)...)
+}
+
+// fakeServer answers OPENDIR with a handle, READDIR with a listing, and everything else with an OK status.
+func fakeServer(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	for {
+		pkt, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+		id := binary.BigEndian.Uint32(pkt[5:])
+		var rsp []byte
+		switch pkt[4] {
+		case fxpOpendir:
+			rsp = packet(fxpHandle, id, str("h1"))
+		case fxpReaddir:
+			var entries []byte
+			for _, n := range []string{".", "..", "config", "cache", "data.log"} {
+				entries = append(entries, nameEntry(n)...)
+			}
+			rsp = packet(fxpName, id, u32(5), entries)
+		default:
+			rsp = packet(fxpStatus, id, u32(0), str("OK"), str(""))
+		}
+		if _, err = conn.Write(rsp); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+}
+
+func TestNewConn(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	f, err := NewFilter("/tel_app_mounts", nil, []string{"cache", "*.log"})
+	require.NoError(t, err)
+	server, serverEnd := net.Pipe()
+	go fakeServer(t, serverEnd)
+	client := NewConn(ctx, server, f)
+	defer client.Close()
+
+	roundTrip := func(req []byte) []byte {
+		_, err := client.Write(req)
+		require.NoError(t, err)
+		rsp, err := readPacket(client)
+		require.NoError(t, err)
+		return rsp
+	}
+
+	// A hidden path doesn't exist
+	rsp := roundTrip(packet(fxpStat, 1, str("/tel_app_mounts/cache/x")))
+	assert.Equal(t, byte(fxpStatus), rsp[4])
+	assert.Equal(t, uint32(1), binary.BigEndian.Uint32(rsp[5:]))
+	assert.Equal(t, uint32(fxNoSuchFile), binary.BigEndian.Uint32(rsp[9:]))
+
+	// A visible path is passed on to the server
+	rsp = roundTrip(packet(fxpStat, 2, str("/tel_app_mounts/config")))
+	assert.Equal(t, byte(fxpStatus), rsp[4])
+	assert.Equal(t, uint32(0), binary.BigEndian.Uint32(rsp[9:]))
+
+	// Hidden entries are removed from directory listings
+	rsp = roundTrip(packet(fxpOpendir, 3, str("/tel_app_mounts")))
+	require.Equal(t, byte(fxpHandle), rsp[4])
+	rsp = roundTrip(packet(fxpReaddir, 4, str("h1")))
+	require.Equal(t, byte(fxpName), rsp[4])
+	assert.Equal(t, uint32(4), binary.BigEndian.Uint32(rsp[5:]))
+	count, rest, _ := readUint32(rsp[9:])
+	var names []string
+	for i := uint32(0); i < count; i++ {
+		ns := readStrings(rest, 2)
+		require.Len(t, ns, 2)
+		names = append(names, ns[0])
+		rest, _ = skipAttrs(rest[8+len(ns[0])+len(ns[1]):])
+	}
+	assert.Equal(t, []string{".", "..", "config"}, names)
+	assert.Empty(t, rest)
+}
@@ -0,0 +1,127 @@
+// Package sftpfilter restricts the paths that an SFTP server exposes to its client. It's used to hide parts of
+// the remote volumes of an intercept from the sshfs mount.
+package sftpfilter
+
+import (
+	"path"
+	"strings"
+)
+
+// Filter decides which paths below a root directory are visible.
+//
+// Patterns are matched against the path relative to the root, one path element at a time, using the syntax of
+// path.Match. The element "**" matches zero or more path elements. A pattern that matches a directory also
+// matches everything below it, so "var/cache" excludes all files in that directory and "**/node_modules" excludes
+// every node_modules directory.
+type Filter struct {
+	root    string
+	include [][]string
+	exclude [][]string
+}
+
+// NewFilter returns a filter for the given root directory. When include patterns are given, only the paths that
+// match one of them, and the directories leading up to them, are visible. A path that matches an exclude pattern
+// is never visible. NewFilter returns nil when there are no patterns, and path.ErrBadPattern when a pattern is
+// malformed.
+func NewFilter(root string, include, exclude []string) (*Filter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	f := &Filter{root: path.Clean(root)}
+	var err error
+	if f.include, err = splitPatterns(include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = splitPatterns(exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ValidatePatterns returns path.ErrBadPattern if any of the given patterns is malformed.
+func ValidatePatterns(patterns []string) error {
+	_, err := splitPatterns(patterns)
+	return err
+}
+
+func splitPatterns(patterns []string) ([][]string, error) {
+	split := make([][]string, 0, len(patterns))
+	for _, p := range patterns {
+		elems := splitPath(p)
+		if len(elems) == 0 {
+			return nil, path.ErrBadPattern
+		}
+		for _, e := range elems {
+			if _, err := path.Match(e, ""); err != nil {
+				return nil, err
+			}
+		}
+		split = append(split, elems)
+	}
+	return split, nil
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// Visible returns true if the given absolute path is visible. Paths outside the root are always visible.
+func (f *Filter) Visible(p string) bool {
+	if f == nil {
+		return true
+	}
+	p = path.Clean(p)
+	var rel string
+	switch {
+	case p == f.root:
+		return true
+	case f.root == "/":
+		rel = p
+	case strings.HasPrefix(p, f.root+"/"):
+		rel = p[len(f.root):]
+	default:
+		return true
+	}
+	elems := splitPath(rel)
+	for _, pattern := range f.exclude {
+		if matched, _ := match(pattern, elems); matched {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if matched, ancestor := match(pattern, elems); matched || ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns matched = true when the leading elements of the path match the pattern, and ancestor = true when
+// the path could be a directory that leads up to a path that matches it.
+func match(pattern, elems []string) (matched, ancestor bool) {
+	if len(pattern) == 0 {
+		return true, false
+	}
+	if len(elems) == 0 {
+		return false, true
+	}
+	if pattern[0] == "**" {
+		// Match zero elements, or consume one element and try again
+		if matched, ancestor = match(pattern[1:], elems); matched {
+			return true, false
+		}
+		m, a := match(pattern, elems[1:])
+		return m, ancestor || a
+	}
+	if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+		return false, false
+	}
+	return match(pattern[1:], elems[1:])
+}
@@ -0,0 +1,63 @@
+package sftpfilter
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_Visible(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		visible []string
+		hidden  []string
+	}{
+		{
+			name:    "exclude",
+			exclude: []string{"var/cache", "**/node_modules", "*.log"},
+			visible: []string{"/", "/root", "/root/var", "/root/var/run/secrets", "/root/app/src/x.log", "/other/var/cache"},
+			hidden:  []string{"/root/var/cache", "/root/var/cache/x", "/root/node_modules", "/root/app/node_modules/y", "/root/x.log"},
+		},
+		{
+			name:    "include",
+			include: []string{"var/run/secrets", "etc/*/config"},
+			visible: []string{"/root", "/root/var", "/root/var/run", "/root/var/run/secrets/token", "/root/etc/app", "/root/etc/app/config/a"},
+			hidden:  []string{"/root/tmp", "/root/var/cache", "/root/var/run/other", "/root/etc/app/data"},
+		},
+		{
+			name:    "include and exclude",
+			include: []string{"**/config"},
+			exclude: []string{"**/config/secret"},
+			visible: []string{"/root/a", "/root/a/b", "/root/a/b/config", "/root/config/public"},
+			hidden:  []string{"/root/a/b/config/secret", "/root/config/secret/key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter("/root", tt.include, tt.exclude)
+			require.NoError(t, err)
+			for _, p := range tt.visible {
+				assert.True(t, f.Visible(p), p)
+			}
+			for _, p := range tt.hidden {
+				assert.False(t, f.Visible(p), p)
+			}
+		})
+	}
+}
+
+func TestNewFilter(t *testing.T) {
+	f, err := NewFilter("/root", nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, f)
+	assert.True(t, f.Visible("/root/anything"))
+
+	_, err = NewFilter("/root", []string{"[a"}, nil)
+	assert.ErrorIs(t, err, path.ErrBadPattern)
+	_, err = NewFilter("/root", nil, []string{"/"})
+	assert.ErrorIs(t, err, path.ErrBadPattern)
+}
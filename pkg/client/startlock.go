@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+)
+
+// WithStartLock calls the given function while holding an inter-process lock that is exclusive to
+// the daemon with the given name. The CLI holds this lock while it checks if the daemon is running
+// and starts it when it isn't, so that commands that run concurrently in different terminals never
+// start more than one instance of the daemon.
+func WithStartLock(ctx context.Context, daemonName string, f func() error) error {
+	dir, err := filelocation.AppUserCacheDir(ctx)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	lf, err := os.OpenFile(filepath.Join(dir, daemonName+".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lf.Close()
+
+	for {
+		locked, err := tryLockFile(lf)
+		if err != nil {
+			return fmt.Errorf("unable to lock %s: %w", lf.Name(), err)
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout while waiting for another command to start the %s: %w", daemonName, ctx.Err())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	defer func() {
+		_ = unlockFile(lf)
+	}()
+	return f()
+}
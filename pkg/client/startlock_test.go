@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+)
+
+func TestWithStartLock(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	dir := t.TempDir()
+	ctx = filelocation.WithUserHomeDir(ctx, dir)
+
+	// Simulate many commands that concurrently ensure that a daemon is running. Each one starts
+	// the daemon (creates the pid file) unless it's already running.
+	pidFile := filepath.Join(dir, "daemon.pid")
+	var starts, inside, maxInside int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, WithStartLock(ctx, "daemon", func() error {
+				n := atomic.AddInt32(&inside, 1)
+				defer atomic.AddInt32(&inside, -1)
+				for {
+					m := atomic.LoadInt32(&maxInside)
+					if n <= m || atomic.CompareAndSwapInt32(&maxInside, m, n) {
+						break
+					}
+				}
+				if _, err := os.Stat(pidFile); err == nil {
+					return nil
+				}
+				time.Sleep(5 * time.Millisecond) // startup takes a while
+				atomic.AddInt32(&starts, 1)
+				return os.WriteFile(pidFile, []byte("1"), 0600)
+			}))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), starts, "daemon must be started exactly once")
+	assert.Equal(t, int32(1), maxInside, "lock must be exclusive")
+}
+
+func TestWithStartLock_timeout(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	ctx = filelocation.WithUserHomeDir(ctx, t.TempDir())
+
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_ = WithStartLock(ctx, "connector", func() error {
+			close(locked)
+			<-release
+			return nil
+		})
+	}()
+	<-locked
+	defer close(release)
+
+	tc, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	err := WithStartLock(tc, "connector", func() error {
+		t.Error("function must not be called while another holds the lock")
+		return nil
+	})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
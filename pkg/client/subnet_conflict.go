@@ -0,0 +1,33 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+// DescribeSubnetConflict returns an actionable description of the given subnet conflict.
+func DescribeSubnetConflict(sc *daemon.SubnetConflict) string {
+	cs := iputil.IPNetFromRPC(sc.ClusterSubnet)
+	ls := iputil.IPNetFromRPC(sc.LocalSubnet)
+	csOnes, _ := cs.Mask.Size()
+	lsOnes, _ := ls.Mask.Size()
+
+	// The overlap is the smaller of the two networks, because one always covers the other.
+	overlap := cs
+	if lsOnes > csOnes {
+		overlap = ls
+	}
+	msg := fmt.Sprintf("cluster subnet %s overlaps with local network %s on %s; ", cs, ls, sc.Interface)
+	switch {
+	case sc.Excluded:
+		msg += fmt.Sprintf("%s is excluded from the routed cluster subnets", overlap)
+	case lsOnes >= csOnes:
+		msg += fmt.Sprintf("cluster IPs in %s are unreachable because the local route takes precedence", overlap)
+	default:
+		msg += fmt.Sprintf("hosts in %s on %s are unreachable while connected, unless %s is added to the never-proxy subnets",
+			overlap, sc.Interface, overlap)
+	}
+	return msg
+}
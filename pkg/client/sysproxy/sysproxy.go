@@ -0,0 +1,50 @@
+// Package sysproxy makes the system proxy of the workstation use a proxy auto-config file, and restores the
+// settings that it had before. Those settings are recorded in the user cache before they're changed, so that
+// they can be restored by another process, e.g. "telepresence uninstall --everything-local", when the process
+// that changed them dies without restoring them.
+package sysproxy
+
+import (
+	"context"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cache"
+)
+
+// Set makes the system proxy use the proxy auto-config file at the given URL. Settings that were left behind
+// by a process that didn't restore them are restored first.
+func Set(ctx context.Context, pacURL string) error {
+	if err := Restore(ctx); err != nil {
+		return err
+	}
+	prev, err := current(ctx)
+	if err != nil {
+		return err
+	}
+	if err = cache.SaveSystemProxyToUserCache(ctx, &cache.SystemProxy{AutoProxies: prev}); err != nil {
+		return err
+	}
+	if err = set(ctx, pacURL, prev); err != nil {
+		_ = Restore(ctx)
+		return err
+	}
+	return nil
+}
+
+// Restore restores the settings that the system proxy had before Set changed them. It's a no-op when no
+// settings have been recorded.
+func Restore(ctx context.Context) error {
+	sp, err := cache.LoadSystemProxyFromUserCache(ctx)
+	if err != nil || sp == nil {
+		return err
+	}
+	if err = restore(ctx, sp.AutoProxies); err != nil {
+		return err
+	}
+	return cache.DeleteSystemProxyFromUserCache(ctx)
+}
+
+// IsSet returns true when the system proxy has settings that Set changed and that have yet to be restored.
+func IsSet(ctx context.Context) (bool, error) {
+	sp, err := cache.LoadSystemProxyFromUserCache(ctx)
+	return sp != nil, err
+}
@@ -0,0 +1,75 @@
+package sysproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/datawire/dlib/dexec"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cache"
+)
+
+const networkSetupCmd = "/usr/sbin/networksetup"
+
+// current returns the auto proxy settings of all enabled network services.
+func current(ctx context.Context) ([]cache.AutoProxy, error) {
+	out, err := dexec.CommandContext(ctx, networkSetupCmd, "-listallnetworkservices").Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list network services: %w", err)
+	}
+	var aps []cache.AutoProxy
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Scan() // The first line explains that an asterisk denotes a disabled service
+	for sc.Scan() {
+		service := sc.Text()
+		if service == "" || strings.HasPrefix(service, "*") {
+			continue
+		}
+		ap := cache.AutoProxy{Service: service}
+		if out, err = dexec.CommandContext(ctx, networkSetupCmd, "-getautoproxyurl", service).Output(); err == nil {
+			for _, line := range strings.Split(string(out), "\n") {
+				if v := strings.TrimPrefix(line, "URL: "); v != line {
+					ap.URL = v
+				} else if v = strings.TrimPrefix(line, "Enabled: "); v != line {
+					ap.Enabled = v == "Yes"
+				}
+			}
+		}
+		if ap.URL == "" || ap.URL == "(null)" {
+			ap.URL = ""
+			ap.Enabled = false
+		}
+		aps = append(aps, ap)
+	}
+	return aps, nil
+}
+
+// set makes the given network services use the proxy auto-config file at the given URL.
+func set(ctx context.Context, pacURL string, aps []cache.AutoProxy) error {
+	for _, ap := range aps {
+		if out, err := dexec.CommandContext(ctx, networkSetupCmd, "-setautoproxyurl", ap.Service, pacURL).CombinedOutput(); err != nil {
+			return fmt.Errorf("unable to set the auto proxy of network service %q: %w: %s", ap.Service, err, out)
+		}
+	}
+	return nil
+}
+
+// restore restores the given auto proxy settings. All settings are restored even when some of them fail, and
+// the first error is returned.
+func restore(ctx context.Context, aps []cache.AutoProxy) error {
+	var firstErr error
+	for _, ap := range aps {
+		var cmd *dexec.Cmd
+		if ap.Enabled {
+			cmd = dexec.CommandContext(ctx, networkSetupCmd, "-setautoproxyurl", ap.Service, ap.URL)
+		} else {
+			cmd = dexec.CommandContext(ctx, networkSetupCmd, "-setautoproxystate", ap.Service, "off")
+		}
+		if out, err := cmd.CombinedOutput(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("unable to restore the auto proxy of network service %q: %w: %s", ap.Service, err, out)
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,23 @@
+//go:build !darwin && !windows
+// +build !darwin,!windows
+
+package sysproxy
+
+import (
+	"context"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cache"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+func current(_ context.Context) ([]cache.AutoProxy, error) {
+	return nil, errcat.User.New("the system proxy is only supported on macOS and Windows")
+}
+
+func set(_ context.Context, _ string, _ []cache.AutoProxy) error {
+	return errcat.User.New("the system proxy is only supported on macOS and Windows")
+}
+
+func restore(_ context.Context, _ []cache.AutoProxy) error {
+	return nil
+}
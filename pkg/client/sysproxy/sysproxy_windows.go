@@ -0,0 +1,76 @@
+package sysproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cache"
+)
+
+const (
+	internetSettingsKey = `Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+	autoConfigURL       = "AutoConfigURL"
+
+	internetOptionRefresh         = 37
+	internetOptionSettingsChanged = 39
+)
+
+var procInternetSetOption = windows.NewLazySystemDLL("wininet.dll").NewProc("InternetSetOptionW")
+
+// current returns the proxy auto-config URL of the current user's Internet settings. The returned setting is
+// disabled when there is no such URL.
+func current(_ context.Context) ([]cache.AutoProxy, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the Internet settings: %w", err)
+	}
+	defer k.Close()
+	url, _, err := k.GetStringValue(autoConfigURL)
+	return []cache.AutoProxy{{URL: url, Enabled: err == nil}}, nil
+}
+
+// set makes the current user's Internet settings use the proxy auto-config file at the given URL.
+func set(_ context.Context, pacURL string, _ []cache.AutoProxy) error {
+	k, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("unable to open the Internet settings: %w", err)
+	}
+	defer k.Close()
+	if err = k.SetStringValue(autoConfigURL, pacURL); err != nil {
+		return fmt.Errorf("unable to set the proxy auto-config URL: %w", err)
+	}
+	notifyInternetSettingsChanged()
+	return nil
+}
+
+// restore restores the proxy auto-config URL of the current user's Internet settings.
+func restore(_ context.Context, aps []cache.AutoProxy) error {
+	if len(aps) == 0 {
+		return nil
+	}
+	k, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("unable to open the Internet settings: %w", err)
+	}
+	defer k.Close()
+	if aps[0].Enabled {
+		err = k.SetStringValue(autoConfigURL, aps[0].URL)
+	} else if err = k.DeleteValue(autoConfigURL); errors.Is(err, registry.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to restore the proxy auto-config URL: %w", err)
+	}
+	notifyInternetSettingsChanged()
+	return nil
+}
+
+// notifyInternetSettingsChanged makes running applications reload the Internet settings.
+func notifyInternetSettingsChanged() {
+	_, _, _ = procInternetSetOption.Call(0, internetOptionSettingsChanged, 0, 0)
+	_, _, _ = procInternetSetOption.Call(0, internetOptionRefresh, 0, 0)
+}
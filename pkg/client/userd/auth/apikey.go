@@ -8,23 +8,25 @@ import (
 	"io"
 	"mime"
 	"net/http"
+	"net/url"
 
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 )
 
-func getAPIKey(ctx context.Context, creds map[string]string, desc string) (string, error) {
+// getAPIKey creates a new API key with the given description and returns the key and its ID.
+func getAPIKey(ctx context.Context, creds map[string]string, desc string) (string, string, error) {
 	// Build the request.
 	reqBody, err := json.Marshal(map[string]interface{}{
 		"description": desc,
 	})
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	req, err := http.NewRequestWithContext(ctx,
 		http.MethodPost, fmt.Sprintf("https://%s/sso/api/apikeys", client.GetEnv(ctx).LoginDomain),
 		bytes.NewReader(reqBody))
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	for k, v := range creds {
@@ -32,9 +34,13 @@ func getAPIKey(ctx context.Context, creds map[string]string, desc string) (strin
 	}
 
 	// Send the request.
-	resp, err := http.DefaultClient.Do(req)
+	hc, err := client.GetConfig(ctx).Cloud.HTTPClient()
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", "", err
 	}
 	defer resp.Body.Close()
 
@@ -43,10 +49,10 @@ func getAPIKey(ctx context.Context, creds map[string]string, desc string) (strin
 	// Sanity-check the content type before reading the body.
 	mimetype, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
 	if err != nil {
-		return "", fmt.Errorf("http %v: %w", resp.StatusCode, err)
+		return "", "", fmt.Errorf("http %v: %w", resp.StatusCode, err)
 	}
 	if mimetype != "application/json" {
-		return "", fmt.Errorf("http %v: response body is not json: %q", resp.StatusCode, mimetype)
+		return "", "", fmt.Errorf("http %v: response body is not json: %q", resp.StatusCode, mimetype)
 	}
 
 	// Read the JSON body.  We do this _before_ checking the resp.StatusCode so that we can get
@@ -55,7 +61,7 @@ func getAPIKey(ctx context.Context, creds map[string]string, desc string) (strin
 	if err != nil {
 		// No need to wrap this error with the status code, the magical resp.Body reader
 		// includes it for us.
-		return "", err
+		return "", "", err
 	}
 	type keyInfo struct {
 		// #/definitions/ApiKey
@@ -71,11 +77,36 @@ func getAPIKey(ctx context.Context, creds map[string]string, desc string) (strin
 	}
 	var body keyInfo
 	if err := json.Unmarshal(bodyBytes, &body); err != nil {
-		return "", fmt.Errorf("http %v: %w", resp.StatusCode, err)
+		return "", "", fmt.Errorf("http %v: %w", resp.StatusCode, err)
 	}
 	if body.Message != nil {
-		return "", fmt.Errorf("http %v: error content: %q", resp.StatusCode, *body.Message)
+		return "", "", fmt.Errorf("http %v: error content: %q", resp.StatusCode, *body.Message)
 	}
 
-	return body.Key, nil
+	return body.Key, body.ID, nil
+}
+
+// deleteAPIKey revokes the API key with the given ID.
+func deleteAPIKey(ctx context.Context, creds map[string]string, id string) error {
+	req, err := http.NewRequestWithContext(ctx,
+		http.MethodDelete, fmt.Sprintf("https://%s/sso/api/apikeys/%s", client.GetEnv(ctx).LoginDomain, url.PathEscape(id)), nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range creds {
+		req.Header.Set(k, v)
+	}
+	hc, err := client.GetConfig(ctx).Cloud.HTTPClient()
+	if err != nil {
+		return err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("http %v: unable to revoke API key %s", resp.StatusCode, id)
+	}
+	return nil
 }
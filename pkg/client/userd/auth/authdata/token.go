@@ -15,14 +15,14 @@ const (
 // SaveTokenToUserCache saves the provided token to user cache and returns an error if something
 // goes wrong while marshalling or persisting.
 func SaveTokenToUserCache(ctx context.Context, token *oauth2.Token) error {
-	return cache.SaveToUserCache(ctx, token, tokenFile)
+	return cache.SaveSecretToUserCache(ctx, token, tokenFile)
 }
 
 // LoadTokenFromUserCache gets the token instance from cache or returns an error if something goes
 // wrong while loading or unmarshalling.
 func LoadTokenFromUserCache(ctx context.Context) (*oauth2.Token, error) {
 	var token oauth2.Token
-	err := cache.LoadFromUserCache(ctx, &token, tokenFile)
+	err := cache.LoadSecretFromUserCache(ctx, &token, tokenFile)
 	if err != nil {
 		return nil, err
 	}
@@ -14,14 +14,14 @@ type UserInfo = connector.UserInfo
 // SaveUserInfoToUserCache saves the provided user info to user cache and returns an error if
 // something goes wrong while marshalling or persisting.
 func SaveUserInfoToUserCache(ctx context.Context, userInfo *UserInfo) error {
-	return cache.SaveToUserCache(ctx, userInfo, userInfoFile)
+	return cache.SaveSecretToUserCache(ctx, userInfo, userInfoFile)
 }
 
 // LoadUserInfoFromUserCache gets the user info from cache or returns an error if something goes
 // wrong while loading or unmarshalling.
 func LoadUserInfoFromUserCache(ctx context.Context) (*UserInfo, error) {
 	var userInfo UserInfo
-	err := cache.LoadFromUserCache(ctx, &userInfo, userInfoFile)
+	err := cache.LoadSecretFromUserCache(ctx, &userInfo, userInfoFile)
 	if err != nil {
 		return nil, err
 	}
@@ -30,7 +30,11 @@ func getLicenseJWT(ctx context.Context, accessToken, licenseID string) (string,
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
 	// Send the request.
-	resp, err := http.DefaultClient.Do(req)
+	hc, err := client.GetConfig(ctx).Cloud.HTTPClient()
+	if err != nil {
+		return "", env.LoginDomain, err
+	}
+	resp, err := hc.Do(req)
 	if err != nil {
 		return "", env.LoginDomain, err
 	}
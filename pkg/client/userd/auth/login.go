@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -24,13 +25,15 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/a8rcloud"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cache"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/scout"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/auth/authdata"
 )
 
 const (
-	callbackPath = "/callback"
-	apikeysFile  = "apikeys.json"
+	callbackPath  = "/callback"
+	apikeysFile   = "apikeys.json"
+	apikeyIDsFile = "apikey-ids.json"
 )
 
 var ErrNotLoggedIn = errors.New("not logged in")
@@ -54,6 +57,8 @@ type loginExecutor struct {
 
 	oauth2ConfigMu sync.RWMutex // locked unless a .Worker is running
 	oauth2Config   oauth2.Config
+	oidc           *oidcProvider // set when cloud.oidcIssuer replaces the Ambassador Cloud auth backend
+	oidcErr        error         // the error from the discovery of the cloud.oidcIssuer, if any
 
 	loginMu               sync.Mutex
 	callbacks             chan oauth2Callback
@@ -61,6 +66,7 @@ type loginExecutor struct {
 	loginToken            chan oauth2.Token // used to pass token from login command to refresh goroutine
 	userInfo              *authdata.UserInfo
 	apikeys               map[string]map[string]string // map[env.LoginDomain]map[apikeyDescription]apikey
+	apikeyIDs             map[string]map[string]string // map[env.LoginDomain]map[apikeyDescription]apikeyID
 	refreshTimer          *time.Timer
 	refreshTimerIsStopped bool
 	refreshTimerReset     chan time.Duration
@@ -73,6 +79,8 @@ type LoginExecutor interface {
 	LoginAPIKey(ctx context.Context, key string) (bool, error)
 	Logout(ctx context.Context) error
 	GetAPIKey(ctx context.Context, description string) (string, error)
+	RotateAPIKeys(ctx context.Context, description string) ([]*RotatedAPIKey, error)
+	RevokeAPIKeys(ctx context.Context, keys []*RotatedAPIKey)
 	GetCloudAPIKey(ctx context.Context, desc string, autoLogin bool) (string, error)
 	GetLicense(ctx context.Context, id string) (string, string, error)
 	GetUserInfo(ctx context.Context, refresh bool) (*authdata.UserInfo, error)
@@ -186,15 +194,33 @@ func (l *loginExecutor) Worker(ctx context.Context) error {
 	} else if execMechanism == "docker" {
 		loginClientID = "docker-desktop"
 	}
+	if hctx, err := withCloudHTTPClient(ctx); err == nil {
+		ctx = hctx
+	}
 	env := client.GetEnv(ctx)
+	endpoint := oauth2.Endpoint{
+		AuthURL:  env.LoginAuthURL,
+		TokenURL: env.LoginTokenURL,
+	}
+	if cloud := client.GetConfig(ctx).Cloud; cloud.OIDCIssuer != "" {
+		if cloud.OIDCClientID != "" {
+			loginClientID = cloud.OIDCClientID
+		}
+		if l.oidc, l.oidcErr = discoverOIDC(ctx, cloud.OIDCIssuer); l.oidcErr != nil {
+			dlog.Errorf(ctx, "login worker is unable to use cloud.oidcIssuer: %v", l.oidcErr)
+			endpoint = oauth2.Endpoint{}
+		} else {
+			endpoint = oauth2.Endpoint{
+				AuthURL:  l.oidc.AuthorizationEndpoint,
+				TokenURL: l.oidc.TokenEndpoint,
+			}
+		}
+	}
 	l.oauth2Config = oauth2.Config{
 		ClientID:    loginClientID,
 		RedirectURL: fmt.Sprintf("http://localhost:%d%s", listener.Addr().(*net.TCPAddr).Port, callbackPath),
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  env.LoginAuthURL,
-			TokenURL: env.LoginTokenURL,
-		},
-		Scopes: []string{"openid", "profile", "email"},
+		Endpoint:    endpoint,
+		Scopes:      []string{"openid", "profile", "email"},
 	}
 
 	l.tokenSource, err = func() (oauth2.TokenSource, error) {
@@ -216,7 +242,7 @@ func (l *loginExecutor) Worker(ctx context.Context) error {
 		return err
 	}
 
-	if err := cache.LoadFromUserCache(ctx, &l.apikeys, apikeysFile); err != nil && !os.IsNotExist(err) {
+	if err := cache.LoadSecretFromUserCache(ctx, &l.apikeys, apikeysFile); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	if l.apikeys == nil {
@@ -225,6 +251,12 @@ func (l *loginExecutor) Worker(ctx context.Context) error {
 	if l.apikeys[env.LoginDomain] == nil {
 		l.apikeys[env.LoginDomain] = make(map[string]string)
 	}
+	if err := cache.LoadSecretFromUserCache(ctx, &l.apikeyIDs, apikeyIDsFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if l.apikeyIDs == nil {
+		l.apikeyIDs = make(map[string]map[string]string)
+	}
 
 	l.oauth2ConfigMu.Unlock()
 	defer l.oauth2ConfigMu.Lock()
@@ -269,6 +301,16 @@ func (l *loginExecutor) Worker(ctx context.Context) error {
 	return grp.Wait()
 }
 
+// withCloudHTTPClient returns a context that makes the oauth2 package use the HTTP client configured for
+// Ambassador Cloud.
+func withCloudHTTPClient(ctx context.Context) (context.Context, error) {
+	hc, err := client.GetConfig(ctx).Cloud.HTTPClient()
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, hc), nil
+}
+
 func (l *loginExecutor) reportLoginResult(ctx context.Context, err error, method string) {
 	switch {
 	case err != nil && err != ctx.Err():
@@ -303,6 +345,15 @@ func (l *loginExecutor) Login(ctx context.Context) (err error) {
 	l.loginMu.Lock()
 	defer l.loginMu.Unlock()
 
+	if l.oidcErr != nil {
+		return l.oidcErr
+	}
+
+	// The token exchange must use the same HTTP client as all other requests to Ambassador Cloud
+	if ctx, err = withCloudHTTPClient(ctx); err != nil {
+		return err
+	}
+
 	// Whatever the result is, report it to the terminal and report it to Metriton.
 	var token *oauth2.Token
 	defer l.reportLoginResult(ctx, err, "browser")
@@ -392,9 +443,15 @@ func (l *loginExecutor) LoginAPIKey(ctx context.Context, apikey string) (newLogi
 		a8rcloud.KeyDescRoot: apikey,
 	}
 	l.apikeys[env.LoginDomain][a8rcloud.KeyDescRoot] = apikey
-	if err := cache.SaveToUserCache(ctx, l.apikeys, apikeysFile); err != nil {
+	if err := cache.SaveSecretToUserCache(ctx, l.apikeys, apikeysFile); err != nil {
 		return false, err
 	}
+	if l.apikeyIDs != nil {
+		delete(l.apikeyIDs, env.LoginDomain)
+		if err := cache.SaveSecretToUserCache(ctx, l.apikeyIDs, apikeyIDsFile); err != nil {
+			return false, err
+		}
+	}
 
 	return true, nil
 }
@@ -416,7 +473,9 @@ func (l *loginExecutor) Logout(ctx context.Context) (err error) {
 	_ = authdata.DeleteUserInfoFromUserCache(ctx)
 
 	l.apikeys[env.LoginDomain] = make(map[string]string)
-	if saveErr := cache.SaveToUserCache(ctx, l.apikeys, apikeysFile); saveErr != nil {
+	delete(l.apikeyIDs, env.LoginDomain)
+	_ = cache.SaveSecretToUserCache(ctx, l.apikeyIDs, apikeyIDsFile)
+	if saveErr := cache.SaveSecretToUserCache(ctx, l.apikeys, apikeysFile); saveErr != nil {
 		if err == nil {
 			err = saveErr
 		} else {
@@ -458,6 +517,9 @@ func (l *loginExecutor) getToken(ctx context.Context) (string, error) {
 	l.loginMu.Lock()
 	defer l.loginMu.Unlock()
 
+	if client.GetConfig(ctx).Cloud.Disabled {
+		return "", client.ErrCloudDisabled
+	}
 	if l.tokenSource == nil {
 		return "", fmt.Errorf("getToken: %w", ErrNotLoggedIn)
 	} else if tokenInfo, err := l.tokenSource.Token(); err != nil {
@@ -520,29 +582,124 @@ func (l *loginExecutor) GetAPIKey(ctx context.Context, description string) (stri
 	if err != nil {
 		return "", fmt.Errorf("GetAPIKey: %w", err)
 	}
-	key, err := getAPIKey(ctx, creds, description)
+	key, id, err := getAPIKey(ctx, creds, description)
 	if err != nil {
 		return "", err
 	}
-
-	l.apikeys[env.LoginDomain][description] = key
-	if err := cache.SaveToUserCache(ctx, l.apikeys, apikeysFile); err != nil {
+	if err := l.lockedSaveAPIKey(ctx, description, key, id); err != nil {
 		return "", err
 	}
 	return key, nil
 }
 
+// RotatedAPIKey is an API key that RotateAPIKeys has replaced.
+type RotatedAPIKey struct {
+	Description string
+
+	// RevokeErr is set by RevokeAPIKeys when the replaced key couldn't be revoked.
+	RevokeErr error
+
+	oldID string
+}
+
+// RotateAPIKeys replaces the cached API key with the given description, or all cached API keys when the
+// description is empty, with new keys. The replaced keys remain valid until they are revoked using
+// RevokeAPIKeys, so that everything that uses them can be updated first. The key that the user logged
+// in with is never rotated.
+func (l *loginExecutor) RotateAPIKeys(ctx context.Context, description string) ([]*RotatedAPIKey, error) {
+	l.loginMu.Lock()
+	defer l.loginMu.Unlock()
+
+	env := client.GetEnv(ctx)
+	var descs []string
+	for desc := range l.apikeys[env.LoginDomain] {
+		if desc != a8rcloud.KeyDescRoot && (description == "" || desc == description) {
+			descs = append(descs, desc)
+		}
+	}
+	if len(descs) == 0 {
+		if description != "" {
+			return nil, errcat.User.Newf("there is no API key with description %q", description)
+		}
+		return nil, nil
+	}
+	sort.Strings(descs)
+
+	creds, err := l.lockedGetCreds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("RotateAPIKeys: %w", err)
+	}
+	rotated := make([]*RotatedAPIKey, 0, len(descs))
+	for _, desc := range descs {
+		key, id, err := getAPIKey(ctx, creds, desc)
+		if err != nil {
+			return rotated, err
+		}
+		rotated = append(rotated, &RotatedAPIKey{Description: desc, oldID: l.apikeyIDs[env.LoginDomain][desc]})
+		if err := l.lockedSaveAPIKey(ctx, desc, key, id); err != nil {
+			return rotated, err
+		}
+	}
+	return rotated, nil
+}
+
+// RevokeAPIKeys revokes the keys that RotateAPIKeys has replaced and sets the RevokeErr of those that
+// couldn't be revoked.
+func (l *loginExecutor) RevokeAPIKeys(ctx context.Context, keys []*RotatedAPIKey) {
+	l.loginMu.Lock()
+	defer l.loginMu.Unlock()
+
+	creds, err := l.lockedGetCreds(ctx)
+	for _, key := range keys {
+		switch {
+		case err != nil:
+			key.RevokeErr = err
+		case key.oldID == "":
+			key.RevokeErr = errors.New("the ID of the replaced key is unknown, so it must be revoked in Ambassador Cloud")
+		default:
+			key.RevokeErr = deleteAPIKey(ctx, creds, key.oldID)
+		}
+	}
+}
+
+// Must hold l.loginMu to call this.
+func (l *loginExecutor) lockedSaveAPIKey(ctx context.Context, description, key, id string) error {
+	env := client.GetEnv(ctx)
+	l.apikeys[env.LoginDomain][description] = key
+	if err := cache.SaveSecretToUserCache(ctx, l.apikeys, apikeysFile); err != nil {
+		return err
+	}
+	ids := l.apikeyIDs[env.LoginDomain]
+	if ids == nil {
+		ids = make(map[string]string)
+		l.apikeyIDs[env.LoginDomain] = ids
+	}
+	ids[description] = id
+	return cache.SaveSecretToUserCache(ctx, l.apikeyIDs, apikeyIDsFile)
+}
+
 // Must hold l.loginMu to call this.
 func (l *loginExecutor) lockedRetrieveUserInfo(ctx context.Context, creds map[string]string) error {
-	var userInfo authdata.UserInfo
-	req, err := http.NewRequest("GET", client.GetEnv(ctx).UserInfoURL, nil)
+	// Only a token issued by the cloud.oidcIssuer is accepted by its userinfo endpoint. API keys are
+	// always verified by Ambassador Cloud.
+	userInfoURL := client.GetEnv(ctx).UserInfoURL
+	_, isToken := creds["Authorization"]
+	useOIDC := isToken && l.oidc != nil
+	if useOIDC {
+		userInfoURL = l.oidc.UserInfoEndpoint
+	}
+	req, err := http.NewRequest("GET", userInfoURL, nil)
 	if err != nil {
 		return err
 	}
 	for k, v := range creds {
 		req.Header.Set(k, v)
 	}
-	resp, err := http.DefaultClient.Do(req)
+	hc, err := client.GetConfig(ctx).Cloud.HTTPClient()
+	if err != nil {
+		return err
+	}
+	resp, err := hc.Do(req)
 	if err != nil {
 		return err
 	}
@@ -557,12 +714,21 @@ func (l *loginExecutor) lockedRetrieveUserInfo(ctx context.Context, creds map[st
 	if err != nil {
 		return err
 	}
-	err = json.Unmarshal(content, &userInfo)
-	if err != nil {
-		return err
+	var userInfo *authdata.UserInfo
+	if useOIDC {
+		var oidcInfo oidcUserInfo
+		if err = json.Unmarshal(content, &oidcInfo); err != nil {
+			return err
+		}
+		userInfo = oidcInfo.toUserInfo()
+	} else {
+		userInfo = &authdata.UserInfo{}
+		if err = json.Unmarshal(content, userInfo); err != nil {
+			return err
+		}
 	}
-	l.userInfo = &userInfo
-	return l.SaveUserInfoFunc(ctx, &userInfo)
+	l.userInfo = userInfo
+	return l.SaveUserInfoFunc(ctx, userInfo)
 }
 
 func (l *loginExecutor) httpHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
@@ -578,13 +744,16 @@ func (l *loginExecutor) httpHandler(ctx context.Context, w http.ResponseWriter,
 	var sb strings.Builder
 	sb.WriteString("<!DOCTYPE html><html><head><title>Authentication Successful</title></head><body>")
 	if errorName == "" && code != "" {
-		completionURL := client.GetEnv(ctx).LoginCompletionURL
-		// Attribute login to the correct client
-		if mech, _ := client.GetInstallMechanism(); mech == "docker" {
-			completionURL += "?client=docker-desktop"
+		// A custom OIDC issuer has no completion page, so the page below is shown instead.
+		if l.oidc == nil {
+			completionURL := client.GetEnv(ctx).LoginCompletionURL
+			// Attribute login to the correct client
+			if mech, _ := client.GetInstallMechanism(); mech == "docker" {
+				completionURL += "?client=docker-desktop"
+			}
+			w.Header().Set("Location", completionURL)
+			w.WriteHeader(http.StatusTemporaryRedirect)
 		}
-		w.Header().Set("Location", completionURL)
-		w.WriteHeader(http.StatusTemporaryRedirect)
 		sb.WriteString("<h1>Authentication Successful</h1>")
 		sb.WriteString("<p>You can now close this tab and resume on the CLI.</p>")
 	} else {
@@ -21,6 +21,7 @@ import (
 	"github.com/datawire/dlib/dhttp"
 	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/keychain"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/scout"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/auth"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/auth/authdata"
@@ -190,7 +191,8 @@ func TestLoginFlow(t *testing.T) {
 		mockOpenURLWrapper := &MockOpenURLWrapper{}
 		openUrlChan := make(chan string)
 		mockOauth2Server := newMockOauth2Server(t)
-		ctx := dlog.NewTestContext(t, false)
+		// Never touch the keychain of the machine that runs the tests
+		ctx := keychain.WithKeychain(dlog.NewTestContext(t, false), &keychain.InMemory{})
 
 		stdout := dlog.StdLogger(ctx, dlog.LogLevelInfo).Writer()
 		ctx = client.WithEnv(ctx,
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/auth/authdata"
+)
+
+// oidcProvider contains the parts of an OpenID Connect discovery document that the login flow uses.
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// oidcUserInfo contains the standard claims returned from an OpenID Connect userinfo endpoint.
+type oidcUserInfo struct {
+	Subject           string `json:"sub"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+	Picture           string `json:"picture"`
+}
+
+func (u *oidcUserInfo) toUserInfo() *authdata.UserInfo {
+	name := u.Name
+	if name == "" {
+		name = u.PreferredUsername
+	}
+	if name == "" {
+		name = u.Email
+	}
+	return &authdata.UserInfo{
+		Id:        u.Subject,
+		Name:      name,
+		AvatarUrl: u.Picture,
+	}
+}
+
+// discoverOIDC retrieves the discovery document of the given OpenID Connect issuer.
+func discoverOIDC(ctx context.Context, issuer string) (*oidcProvider, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, errcat.Config.Newf("invalid cloud.oidcIssuer %q: %v", issuer, err)
+	}
+	hc, err := client.GetConfig(ctx).Cloud.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover OpenID Connect issuer %s: %w", issuer, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v from OpenID Connect discovery of %s", resp.StatusCode, issuer)
+	}
+	var p oidcProvider
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return nil, fmt.Errorf("unable to parse OpenID Connect discovery document of %s: %w", issuer, err)
+	}
+	if strings.TrimSuffix(p.Issuer, "/") != issuer {
+		return nil, errcat.Config.Newf("OpenID Connect discovery document of %s declares issuer %q", issuer, p.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.UserInfoEndpoint == "" {
+		return nil, errcat.Config.Newf("OpenID Connect issuer %s lacks an authorization, token, or userinfo endpoint", issuer)
+	}
+	return &p, nil
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/auth/authdata"
+)
+
+func Test_discoverOIDC(t *testing.T) {
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/good/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer + "/good",
+			"authorization_endpoint": issuer + "/good/auth",
+			"token_endpoint":         issuer + "/good/token",
+			"userinfo_endpoint":      issuer + "/good/userinfo",
+		})
+	})
+	mux.HandleFunc("/mismatch/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer + "/other",
+			"authorization_endpoint": issuer + "/other/auth",
+			"token_endpoint":         issuer + "/other/token",
+			"userinfo_endpoint":      issuer + "/other/userinfo",
+		})
+	})
+	mux.HandleFunc("/partial/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer + "/partial",
+			"authorization_endpoint": issuer + "/partial/auth",
+		})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	issuer = srv.URL
+
+	cfg := client.GetDefaultConfig(context.Background())
+	ctx := client.WithConfig(dlog.NewTestContext(t, false), &cfg)
+
+	p, err := discoverOIDC(ctx, issuer+"/good/")
+	require.NoError(t, err)
+	assert.Equal(t, &oidcProvider{
+		Issuer:                issuer + "/good",
+		AuthorizationEndpoint: issuer + "/good/auth",
+		TokenEndpoint:         issuer + "/good/token",
+		UserInfoEndpoint:      issuer + "/good/userinfo",
+	}, p)
+
+	_, err = discoverOIDC(ctx, issuer+"/mismatch")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "declares issuer")
+
+	_, err = discoverOIDC(ctx, issuer+"/partial")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "lacks an authorization, token, or userinfo endpoint")
+
+	_, err = discoverOIDC(ctx, issuer+"/missing")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected status 404")
+}
+
+func Test_oidcUserInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		info oidcUserInfo
+		want *authdata.UserInfo
+	}{
+		{
+			name: "name",
+			info: oidcUserInfo{Subject: "1234", Name: "Jane Doe", PreferredUsername: "jane", Email: "jane@example.com", Picture: "https://example.com/jane.png"},
+			want: &authdata.UserInfo{Id: "1234", Name: "Jane Doe", AvatarUrl: "https://example.com/jane.png"},
+		},
+		{
+			name: "preferred-username",
+			info: oidcUserInfo{Subject: "1234", PreferredUsername: "jane", Email: "jane@example.com"},
+			want: &authdata.UserInfo{Id: "1234", Name: "jane"},
+		},
+		{
+			name: "email",
+			info: oidcUserInfo{Subject: "1234", Email: "jane@example.com"},
+			want: &authdata.UserInfo{Id: "1234", Name: "jane@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.info.toUserInfo())
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/rpc/v2/common"
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli"
@@ -67,13 +68,32 @@ func (s *service) withSession(c context.Context, callName string, f func(context
 
 func (s *service) Version(_ context.Context, _ *empty.Empty) (*common.VersionInfo, error) {
 	return &common.VersionInfo{
-		ApiVersion: client.APIVersion,
-		Version:    client.Version(),
+		ApiVersion:   client.APIVersion,
+		Version:      client.Version(),
+		Capabilities: client.Capabilities(),
 	}, nil
 }
 
-func (s *service) Connect(ctx context.Context, cr *rpc.ConnectRequest) (result *rpc.ConnectInfo, err error) {
-	s.logCall(ctx, "Connect", func(c context.Context) {
+func (s *service) Connect(ctx context.Context, cr *rpc.ConnectRequest) (*rpc.ConnectInfo, error) {
+	return s.connect(ctx, "Connect", cr, nil)
+}
+
+func (s *service) ConnectWithProgress(cr *rpc.ConnectRequest, stream rpc.Connector_ConnectWithProgressServer) error {
+	ps := &progressSender{send: func(e *rpc.ProgressEvent) error {
+		return stream.Send(&rpc.ConnectProgress{Event: &rpc.ConnectProgress_Progress{Progress: e}})
+	}}
+	result, err := s.connect(stream.Context(), "ConnectWithProgress", cr, ps.report)
+	ps.close()
+	if err != nil {
+		return err
+	}
+	return stream.Send(&rpc.ConnectProgress{Event: &rpc.ConnectProgress_Result{Result: result}})
+}
+
+func (s *service) connect(ctx context.Context, callName string, cr *rpc.ConnectRequest, progress trafficmgr.ProgressFunc) (result *rpc.ConnectInfo, err error) {
+	s.logCall(ctx, callName, func(c context.Context) {
+		s.connectLock.Lock()
+		defer s.connectLock.Unlock()
 		s.sessionLock.RLock()
 		if s.session != nil {
 			result = s.session.UpdateStatus(s.sessionContext, cr)
@@ -86,7 +106,7 @@ func (s *service) Connect(ctx context.Context, cr *rpc.ConnectRequest) (result *
 		case <-ctx.Done():
 			err = status.Error(codes.Unavailable, ctx.Err().Error())
 			return
-		case s.connectRequest <- cr:
+		case s.connectRequest <- sessionRequest{ConnectRequest: cr, progress: progress}:
 		}
 		select {
 		case <-ctx.Done():
@@ -99,8 +119,8 @@ func (s *service) Connect(ctx context.Context, cr *rpc.ConnectRequest) (result *
 
 func (s *service) Disconnect(c context.Context, _ *empty.Empty) (*empty.Empty, error) {
 	s.logCall(c, "Disconnect", func(c context.Context) {
-		s.sessionLock.RLock()
-		defer s.sessionLock.RUnlock()
+		s.sessionLock.Lock()
+		defer s.sessionLock.Unlock()
 		if s.session != nil {
 			s.session = nil
 			s.sessionCancel()
@@ -140,6 +160,14 @@ func (s *service) CanIntercept(c context.Context, ir *rpc.CreateInterceptRequest
 	return
 }
 
+func (s *service) SetMappedNamespaces(c context.Context, mr *rpc.SetMappedNamespacesRequest) (result *rpc.SetMappedNamespacesResult, err error) {
+	err = s.withSession(c, "SetMappedNamespaces", func(c context.Context, session trafficmgr.Session) error {
+		result = session.UpdateMappedNamespaces(c, mr.Namespaces)
+		return nil
+	})
+	return
+}
+
 func (s *service) CreateIntercept(c context.Context, ir *rpc.CreateInterceptRequest) (result *rpc.InterceptResult, err error) {
 	err = s.withSession(c, "CreateIntercept", func(c context.Context, session trafficmgr.Session) error {
 		result, err = session.AddIntercept(c, ir)
@@ -148,13 +176,39 @@ func (s *service) CreateIntercept(c context.Context, ir *rpc.CreateInterceptRequ
 	return
 }
 
+func (s *service) CreateInterceptWithProgress(ir *rpc.CreateInterceptRequest, stream rpc.Connector_CreateInterceptWithProgressServer) error {
+	ps := &progressSender{send: func(e *rpc.ProgressEvent) error {
+		return stream.Send(&rpc.InterceptProgress{Event: &rpc.InterceptProgress_Progress{Progress: e}})
+	}}
+	var result *rpc.InterceptResult
+	err := s.withSession(stream.Context(), "CreateInterceptWithProgress", func(c context.Context, session trafficmgr.Session) error {
+		var err error
+		result, err = session.AddIntercept(trafficmgr.WithProgress(c, ps.report), ir)
+		return err
+	})
+	ps.close()
+	if err != nil {
+		return err
+	}
+	return stream.Send(&rpc.InterceptProgress{Event: &rpc.InterceptProgress_Result{Result: result}})
+}
+
 func (s *service) RemoveIntercept(c context.Context, rr *manager.RemoveInterceptRequest2) (result *rpc.InterceptResult, err error) {
 	err = s.withSession(c, "RemoveIntercept", func(c context.Context, session trafficmgr.Session) error {
 		result = &rpc.InterceptResult{}
-		if err := session.RemoveIntercept(c, rr.Name); err != nil {
+		var err error
+		if rr.Name == "" && rr.IdempotencyKey != "" {
+			err = session.RemoveInterceptByIdempotencyKey(c, rr.IdempotencyKey)
+		} else {
+			err = session.RemoveIntercept(c, rr.Name)
+		}
+		if err != nil {
 			if grpcStatus.Code(err) == grpcCodes.NotFound {
 				result.Error = rpc.InterceptError_NOT_FOUND
 				result.ErrorText = rr.Name
+				if rr.Name == "" {
+					result.ErrorText = rr.IdempotencyKey
+				}
 				result.ErrorCategory = int32(errcat.User)
 			} else {
 				result.Error = rpc.InterceptError_TRAFFIC_MANAGER_ERROR
@@ -167,9 +221,19 @@ func (s *service) RemoveIntercept(c context.Context, rr *manager.RemoveIntercept
 	return
 }
 
+func (s *service) RemoveAllIntercepts(c context.Context, _ *empty.Empty) (result *rpc.RemoveAllInterceptsResult, err error) {
+	err = s.withSession(c, "RemoveAllIntercepts", func(c context.Context, session trafficmgr.Session) error {
+		var names []string
+		names, err = session.RemoveAllIntercepts(c)
+		result = &rpc.RemoveAllInterceptsResult{Names: names}
+		return err
+	})
+	return
+}
+
 func (s *service) List(c context.Context, lr *rpc.ListRequest) (result *rpc.WorkloadInfoSnapshot, err error) {
 	err = s.withSession(c, "List", func(c context.Context, session trafficmgr.Session) error {
-		result, err = session.WorkloadInfoSnapshot(c, []string{lr.Namespace}, lr.Filter, true)
+		result, err = session.WorkloadInfoSnapshot(c, []string{lr.Namespace}, lr, true)
 		return err
 	})
 	return
@@ -261,6 +325,48 @@ func (s *service) GetCloudAPIKey(ctx context.Context, req *rpc.KeyRequest) (resu
 	return
 }
 
+func (s *service) RotateCloudAPIKeys(ctx context.Context, req *rpc.RotateKeysRequest) (result *rpc.RotateKeysResult, err error) {
+	s.logCall(ctx, "RotateCloudAPIKeys", func(c context.Context) {
+		var rotated []*auth.RotatedAPIKey
+		if rotated, err = s.loginExecutor.RotateAPIKeys(c, req.GetDescription()); err != nil {
+			if errors.Is(err, auth.ErrNotLoggedIn) {
+				err = grpcStatus.Error(grpcCodes.NotFound, err.Error())
+			}
+			if len(rotated) == 0 {
+				return
+			}
+			// Some keys were replaced. They must be passed on and revoked regardless.
+			dlog.Errorf(c, "unable to rotate all API keys: %v", err)
+		}
+		result = &rpc.RotateKeysResult{}
+
+		// The replaced keys must remain valid until the traffic-manager uses the new ones
+		s.sessionLock.RLock()
+		if s.session != nil {
+			if updErr := s.session.UpdateAPIKeys(s.sessionContext); updErr != nil {
+				result.UpdateError = updErr.Error()
+			}
+		}
+		s.sessionLock.RUnlock()
+
+		if result.UpdateError == "" {
+			s.loginExecutor.RevokeAPIKeys(c, rotated)
+		} else {
+			for _, rk := range rotated {
+				rk.RevokeErr = errors.New("not revoked because the traffic-manager still uses it")
+			}
+		}
+		for _, rk := range rotated {
+			key := &rpc.RotateKeysResult_RotatedKey{Description: rk.Description}
+			if rk.RevokeErr != nil {
+				key.RevokeError = rk.RevokeErr.Error()
+			}
+			result.Keys = append(result.Keys, key)
+		}
+	})
+	return result, err
+}
+
 func (s *service) GetCloudLicense(ctx context.Context, req *rpc.LicenseRequest) (result *rpc.LicenseData, err error) {
 	s.logCall(ctx, "GetCloudLicense", func(c context.Context) {
 		var license, hostDomain string
@@ -278,6 +384,22 @@ func (s *service) GetCloudLicense(ctx context.Context, req *rpc.LicenseRequest)
 	return
 }
 
+func (s *service) ApplyRoutes(c context.Context, _ *empty.Empty) (result *rpc.RoutesInfo, err error) {
+	err = s.withSession(c, "ApplyRoutes", func(c context.Context, session trafficmgr.Session) error {
+		result, err = session.ApplyRoutes(c)
+		return err
+	})
+	return
+}
+
+func (s *service) GetNetworkConfig(c context.Context, _ *empty.Empty) (result *daemon.NetworkConfig, err error) {
+	err = s.withSession(c, "GetNetworkConfig", func(c context.Context, session trafficmgr.Session) error {
+		result, err = session.GetNetworkConfig(c)
+		return err
+	})
+	return
+}
+
 func (s *service) GetIngressInfos(c context.Context, _ *empty.Empty) (result *rpc.IngressInfos, err error) {
 	err = s.withSession(c, "GetIngressInfos", func(c context.Context, session trafficmgr.Session) error {
 		var iis []*manager.IngressInfo
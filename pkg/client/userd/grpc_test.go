@@ -0,0 +1,216 @@
+package userd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/connector/v2alpha"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/scout"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/trafficmgr"
+)
+
+// stubSession is a session that runs until its context is cancelled.
+type stubSession struct {
+	trafficmgr.Session
+}
+
+func (s *stubSession) Run(c context.Context) error {
+	<-c.Done()
+	return nil
+}
+
+func (s *stubSession) WithK8sInterface(c context.Context) context.Context {
+	return c
+}
+
+func (s *stubSession) UpdateStatus(c context.Context, _ *rpc.ConnectRequest) *rpc.ConnectInfo {
+	return s.Status(c)
+}
+
+func (s *stubSession) Status(context.Context) *rpc.ConnectInfo {
+	return &rpc.ConnectInfo{Error: rpc.ConnectInfo_ALREADY_CONNECTED}
+}
+
+func TestService_concurrentConnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+
+	var created int32
+	s := &service{
+		connectRequest:  make(chan sessionRequest),
+		connectResponse: make(chan *rpc.ConnectInfo),
+		newSession: func(context.Context, *scout.Reporter, *rpc.ConnectRequest, trafficmgr.Service, []trafficmgr.SessionService) (trafficmgr.Session, *rpc.ConnectInfo) {
+			atomic.AddInt32(&created, 1)
+			time.Sleep(50 * time.Millisecond) // connecting takes a while
+			return &stubSession{}, &rpc.ConnectInfo{Error: rpc.ConnectInfo_UNSPECIFIED}
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.manageSessions(ctx, nil)
+	}()
+
+	// Run connects and status calls from many clients concurrently. Exactly one of the connects
+	// must create the session, and all others must find it.
+	const clients = 20
+	results := make([]*rpc.ConnectInfo, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			tc, tCancel := context.WithTimeout(ctx, 5*time.Second)
+			defer tCancel()
+			var err error
+			results[i], err = s.Connect(tc, &rpc.ConnectRequest{})
+			assert.NoError(t, err)
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, err := s.Status(ctx, &empty.Empty{})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), created)
+	counts := make(map[rpc.ConnectInfo_ErrType]int)
+	for _, r := range results {
+		require.NotNil(t, r)
+		counts[r.Error]++
+	}
+	assert.Equal(t, map[rpc.ConnectInfo_ErrType]int{
+		rpc.ConnectInfo_UNSPECIFIED:       1,
+		rpc.ConnectInfo_ALREADY_CONNECTED: clients - 1,
+	}, counts)
+
+	// Disconnect while others ask for the status.
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Status(ctx, &empty.Empty{})
+			assert.NoError(t, err)
+		}()
+	}
+	_, err := s.Disconnect(ctx, &empty.Empty{})
+	require.NoError(t, err)
+	wg.Wait()
+	st, err := s.Status(ctx, &empty.Empty{})
+	require.NoError(t, err)
+	assert.Equal(t, rpc.ConnectInfo_DISCONNECTED, st.Error)
+
+	cancel()
+	<-done
+}
+
+type connectProgressStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []*rpc.ConnectProgress
+}
+
+func (s *connectProgressStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *connectProgressStream) Send(cp *rpc.ConnectProgress) error {
+	s.sent = append(s.sent, cp)
+	return nil
+}
+
+func TestService_ConnectWithProgress(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+
+	s := &service{
+		connectRequest:  make(chan sessionRequest),
+		connectResponse: make(chan *rpc.ConnectInfo),
+		newSession: func(context.Context, *scout.Reporter, *rpc.ConnectRequest, trafficmgr.Service, []trafficmgr.SessionService) (trafficmgr.Session, *rpc.ConnectInfo) {
+			return &stubSession{}, &rpc.ConnectInfo{Error: rpc.ConnectInfo_UNSPECIFIED, ClusterContext: "test"}
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.manageSessions(ctx, nil)
+	}()
+
+	stream := &connectProgressStream{ctx: ctx}
+	require.NoError(t, s.ConnectWithProgress(&rpc.ConnectRequest{}, stream))
+	require.Len(t, stream.sent, 1)
+	assert.Equal(t, "test", stream.sent[0].GetResult().GetClusterContext())
+
+	// A session that already exists is reported without progress.
+	stream = &connectProgressStream{ctx: ctx}
+	require.NoError(t, s.ConnectWithProgress(&rpc.ConnectRequest{}, stream))
+	require.Len(t, stream.sent, 1)
+	assert.Equal(t, rpc.ConnectInfo_ALREADY_CONNECTED, stream.sent[0].GetResult().GetError())
+
+	cancel()
+	<-done
+}
+
+func TestProgressSender(t *testing.T) {
+	var sent []string
+	fail := false
+	ps := &progressSender{send: func(e *rpc.ProgressEvent) error {
+		if fail {
+			return errors.New("client is gone")
+		}
+		sent = append(sent, e.Message)
+		return nil
+	}}
+	ps.report(&rpc.ProgressEvent{Message: "a"})
+	fail = true
+	ps.report(&rpc.ProgressEvent{Message: "b"})
+	fail = false
+	ps.report(&rpc.ProgressEvent{Message: "c"})
+	assert.Equal(t, []string{"a"}, sent, "nothing is sent after a failed send")
+
+	sent = nil
+	ps = &progressSender{send: func(e *rpc.ProgressEvent) error {
+		sent = append(sent, e.Message)
+		return nil
+	}}
+	ps.report(&rpc.ProgressEvent{Message: "a"})
+	ps.close()
+	ps.report(&rpc.ProgressEvent{Message: "b"})
+	assert.Equal(t, []string{"a"}, sent, "nothing is sent after close")
+}
+
+func TestServiceV2Alpha(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	s := &service{}
+	srv := grpc.NewServer()
+	rpc.RegisterConnectorServer(srv, s)
+	v2alpha.RegisterConnectorServer(srv, &serviceV2Alpha{s: s})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Stop()
+
+	conn, err := grpc.DialContext(ctx, l.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	vi, err := v2alpha.NewConnectorClient(conn).Version(ctx, &empty.Empty{})
+	require.NoError(t, err)
+	expected, err := rpc.NewConnectorClient(conn).Version(ctx, &empty.Empty{})
+	require.NoError(t, err)
+	assert.Equal(t, expected.Version, vi.Version)
+	assert.Equal(t, expected.ApiVersion, vi.ApiVersion)
+}
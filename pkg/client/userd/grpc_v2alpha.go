@@ -0,0 +1,55 @@
+package userd
+
+import (
+	"context"
+
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/common"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/connector/v2alpha"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+// serviceV2Alpha implements the versioned v2alpha.ConnectorServer by delegating to the service. Changes to the
+// behavior of the service must not break the contract of the versioned service.
+type serviceV2Alpha struct {
+	v2alpha.UnsafeConnectorServer
+	s *service
+}
+
+func (v *serviceV2Alpha) Version(ctx context.Context, e *empty.Empty) (*common.VersionInfo, error) {
+	return v.s.Version(ctx, e)
+}
+
+func (v *serviceV2Alpha) Connect(ctx context.Context, cr *rpc.ConnectRequest) (*rpc.ConnectInfo, error) {
+	return v.s.Connect(ctx, cr)
+}
+
+func (v *serviceV2Alpha) Disconnect(ctx context.Context, e *empty.Empty) (*empty.Empty, error) {
+	return v.s.Disconnect(ctx, e)
+}
+
+func (v *serviceV2Alpha) Status(ctx context.Context, e *empty.Empty) (*rpc.ConnectInfo, error) {
+	return v.s.Status(ctx, e)
+}
+
+func (v *serviceV2Alpha) CreateIntercept(ctx context.Context, ir *rpc.CreateInterceptRequest) (*rpc.InterceptResult, error) {
+	return v.s.CreateIntercept(ctx, ir)
+}
+
+func (v *serviceV2Alpha) RemoveIntercept(ctx context.Context, rr *manager.RemoveInterceptRequest2) (*rpc.InterceptResult, error) {
+	return v.s.RemoveIntercept(ctx, rr)
+}
+
+func (v *serviceV2Alpha) List(ctx context.Context, lr *rpc.ListRequest) (*rpc.WorkloadInfoSnapshot, error) {
+	return v.s.List(ctx, lr)
+}
+
+func (v *serviceV2Alpha) WatchWorkloads(wr *rpc.WatchWorkloadsRequest, server v2alpha.Connector_WatchWorkloadsServer) error {
+	return v.s.WatchWorkloads(wr, server)
+}
+
+func (v *serviceV2Alpha) Quit(ctx context.Context, e *empty.Empty) (*empty.Empty, error) {
+	return v.s.Quit(ctx, e)
+}
@@ -0,0 +1,69 @@
+package k8s
+
+import (
+	"io"
+	"net/http"
+
+	"k8s.io/client-go/rest"
+)
+
+// withCredentialRefresh returns a config for clients that retry a request once when it fails with
+// 401 Unauthorized and the credentials come from an exec plugin such as aws-iam-authenticator or kubelogin.
+//
+// The exec authenticator of client-go re-invokes the plugin when a request is rejected, but the rejected
+// request still fails. Tokens from such plugins are often short-lived, so without a retry, a long-running
+// connector session would see sporadic failures each time a token expires. The given config is returned
+// as is when no exec plugin is used.
+func withCredentialRefresh(config *rest.Config) (*rest.Config, error) {
+	if config.ExecProvider == nil {
+		return config, nil
+	}
+	rt, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// The transport takes care of TLS, authentication, and impersonation, so they must not be applied again.
+	rc := rest.CopyConfig(config)
+	rc.Transport = &credentialRefresher{RoundTripper: rt}
+	rc.TLSClientConfig = rest.TLSClientConfig{}
+	rc.ExecProvider = nil
+	rc.AuthProvider = nil
+	rc.BearerToken = ""
+	rc.BearerTokenFile = ""
+	rc.Username = ""
+	rc.Password = ""
+	rc.Impersonate = rest.ImpersonationConfig{}
+	rc.WrapTransport = nil
+	rc.Dial = nil
+	rc.Proxy = nil
+	return rc, nil
+}
+
+// credentialRefresher retries requests that are rejected with 401 Unauthorized once. It must wrap the
+// exec authenticator so that the retry gets the credentials that the authenticator refreshed.
+type credentialRefresher struct {
+	http.RoundTripper
+}
+
+func (r *credentialRefresher) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The authenticator sets the Authorization header of the request that it's given, so the retry must be
+	// cloned before the first attempt.
+	retry := req.Clone(req.Context())
+	res, err := r.RoundTripper.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			// The body has been consumed and can't be sent again.
+			return res, nil
+		}
+		if retry.Body, err = req.GetBody(); err != nil {
+			return res, nil
+		}
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	return r.RoundTripper.RoundTrip(retry)
+}
@@ -0,0 +1,90 @@
+package k8s
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// credentialPlugin is an exec credential plugin that returns a new token each time it's invoked.
+const credentialPlugin = `#!/bin/sh
+n=$(cat "$0.count" 2>/dev/null || echo 0)
+n=$((n+1))
+echo $n > "$0.count"
+echo '{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","status":{"token":"token-'$n'"}}'
+`
+
+func Test_withCredentialRefresh(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential plugin is a shell script")
+	}
+	plugin := filepath.Join(t.TempDir(), "plugin")
+	require.NoError(t, os.WriteFile(plugin, []byte(credentialPlugin), 0700))
+
+	// The server only accepts the token from the second invocation of the plugin, i.e. the first token has
+	// expired by the time it's used.
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		bodies = append(bodies, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/version":
+			_, _ = io.WriteString(w, `{"major":"1","minor":"21","gitVersion":"v1.21.0"}`)
+		default:
+			_, _ = w.Write(body)
+		}
+	}))
+	defer srv.Close()
+
+	config := &rest.Config{
+		Host: srv.URL,
+		ExecProvider: &clientcmdapi.ExecConfig{
+			Command:    plugin,
+			APIVersion: "client.authentication.k8s.io/v1beta1",
+		},
+	}
+	rc, err := withCredentialRefresh(config)
+	require.NoError(t, err)
+	cs, err := kubernetes.NewForConfig(rc)
+	require.NoError(t, err)
+
+	v, err := cs.Discovery().ServerVersion()
+	require.NoError(t, err)
+	assert.Equal(t, "v1.21.0", v.GitVersion)
+
+	// The body of a retried request must be sent again.
+	ns, err := cs.CoreV1().Namespaces().Create(context.Background(), &core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "ns"}}, meta.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "ns", ns.Name)
+	require.Len(t, bodies, 2)
+	assert.NotEmpty(t, bodies[1])
+
+	count, err := os.ReadFile(plugin + ".count")
+	require.NoError(t, err)
+	assert.Equal(t, "2\n", string(count), "the plugin should be invoked once for each token")
+}
+
+func Test_withCredentialRefresh_noExecProvider(t *testing.T) {
+	config := &rest.Config{Host: "https://example.com", BearerToken: "token"}
+	rc, err := withCredentialRefresh(config)
+	require.NoError(t, err)
+	assert.Same(t, config, rc)
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"os"
+
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// InClusterContext is the name of the context of a Config that uses the in-cluster config.
+const InClusterContext = "in-cluster"
+
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// inClusterPossible is the check that client-go uses to decide if the in-cluster config of a pod's service
+// account can be used. It's a variable so that tests can replace it.
+var inClusterPossible = func() bool {
+	fi, err := os.Stat(serviceAccountTokenFile)
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != "" &&
+		os.Getenv("KUBERNETES_SERVICE_PORT") != "" &&
+		err == nil && !fi.IsDir()
+}
+
+// InCluster returns true when the given kubectl flags and kubeconfig data don't lead to a kubeconfig with a
+// context, and the in-cluster config of a pod's service account will be used instead. This is the case when
+// the CLI runs in a pod without a kubeconfig, e.g. in a CI job that runs in the cluster.
+func InCluster(flagMap map[string]string, kubeconfigData []byte) bool {
+	if len(kubeconfigData) > 0 || !inClusterPossible() {
+		return false
+	}
+	cf := genericclioptions.NewConfigFlags(false)
+	flags := pflag.NewFlagSet("", 0)
+	cf.AddFlags(flags)
+	for k, v := range flagMap {
+		if err := flags.Set(k, v); err != nil {
+			return false
+		}
+	}
+	config, err := cf.ToRawKubeConfigLoader().RawConfig()
+	return err == nil && len(config.Contexts) == 0
+}
+
+// inClusterContext returns a context and a cluster that describe the in-cluster config that the given
+// RESTClientGetter provides. The context originates from the service account's token file.
+func inClusterContext(configFlags genericclioptions.RESTClientGetter) (*api.Context, *api.Cluster, error) {
+	loader := configFlags.ToRawKubeConfigLoader()
+	restConfig, err := loader.ClientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	namespace, _, err := loader.Namespace()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := &api.Context{LocationOfOrigin: serviceAccountTokenFile, Cluster: InClusterContext, Namespace: namespace}
+	cluster := &api.Cluster{Server: restConfig.Host}
+	return ctx, cluster, nil
+}
+
+func isInClusterContext(ctx *api.Context) bool {
+	return ctx.LocationOfOrigin == serviceAccountTokenFile
+}
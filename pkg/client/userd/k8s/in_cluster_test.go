@@ -0,0 +1,46 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInCluster(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfig := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(fmt.Sprintf(kubeconfigTemplate, "https://127.0.0.1:6443", "192.168.0.0/16")), 0600))
+	missing := filepath.Join(dir, "missing")
+
+	possible := true
+	saved := inClusterPossible
+	inClusterPossible = func() bool { return possible }
+	defer func() { inClusterPossible = saved }()
+
+	t.Run("no kubeconfig", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", missing)
+		assert.True(t, InCluster(nil, nil))
+	})
+	t.Run("kubeconfig in env", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", kubeconfig)
+		assert.False(t, InCluster(nil, nil))
+	})
+	t.Run("kubeconfig flag", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", missing)
+		assert.False(t, InCluster(map[string]string{"kubeconfig": kubeconfig}, nil))
+	})
+	t.Run("kubeconfig data", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", missing)
+		assert.False(t, InCluster(nil, []byte(fmt.Sprintf(kubeconfigTemplate, "https://127.0.0.1:6443", "192.168.0.0/16"))))
+	})
+	t.Run("not in a pod", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", missing)
+		possible = false
+		defer func() { possible = true }()
+		assert.False(t, InCluster(nil, nil))
+	})
+}
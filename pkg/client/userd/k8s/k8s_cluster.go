@@ -132,6 +132,9 @@ func NewCluster(c context.Context, kubeFlags *Config, namespaces []string) (*Clu
 	if err != nil {
 		return nil, err
 	}
+	if rs, err = withCredentialRefresh(rs); err != nil {
+		return nil, err
+	}
 	cs, err := kubernetes.NewForConfig(rs)
 	if err != nil {
 		return nil, err
@@ -1,14 +1,18 @@
 package k8s
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"reflect"
 
 	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd/api"
 
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
@@ -37,6 +41,10 @@ type dnsConfig struct {
 
 	// The maximum time to wait for a cluster side host lookup.
 	LookupTimeout metav1.Duration `json:"lookup-timeout,omitempty"`
+
+	// ClusterDomain is the domain of the cluster, e.g. "cluster.local". It overrides the domain
+	// that the traffic-manager detects.
+	ClusterDomain string `json:"cluster-domain,omitempty"`
 }
 
 // The managerConfig is part of the kubeconfigExtension struct. It configures discovery of the traffic manager
@@ -47,46 +55,63 @@ type managerConfig struct {
 
 // kubeconfigExtension is an extension read from the selected kubeconfig Cluster.
 type kubeconfigExtension struct {
-	DNS        *dnsConfig       `json:"dns,omitempty"`
-	AlsoProxy  []*iputil.Subnet `json:"also-proxy,omitempty"`
-	NeverProxy []*iputil.Subnet `json:"never-proxy,omitempty"`
-	Manager    *managerConfig   `json:"manager,omitempty"`
+	DNS        *dnsConfig     `json:"dns,omitempty"`
+	AlsoProxy  []*ProxyEntry  `json:"also-proxy,omitempty"`
+	NeverProxy []*ProxyEntry  `json:"never-proxy,omitempty"`
+	Manager    *managerConfig `json:"manager,omitempty"`
 }
 
 type Config struct {
 	kubeconfigExtension
-	Namespace   string // default cluster namespace.
-	Context     string
-	Server      string
-	flagMap     map[string]string
-	ConfigFlags *genericclioptions.ConfigFlags
-	config      *rest.Config
+	Namespace      string // default cluster namespace.
+	Context        string
+	Server         string
+	InCluster      bool // true when the in-cluster config of a pod's service account is used.
+	flagMap        map[string]string
+	kubeconfigData []byte
+	ConfigFlags    genericclioptions.RESTClientGetter
+	config         *rest.Config
 }
 
 const configExtension = "telepresence.io"
 
-func NewConfig(c context.Context, flagMap map[string]string) (*Config, error) {
-	// Namespace option will be passed only when explicitly needed. The k8Cluster is namespace agnostic with
-	// respect to this option.
-	delete(flagMap, "namespace")
-
-	configFlags := genericclioptions.NewConfigFlags(false)
-	flags := pflag.NewFlagSet("", 0)
-	configFlags.AddFlags(flags)
-	for k, v := range flagMap {
-		if err := flags.Set(k, v); err != nil {
-			return nil, errcat.User.Newf("error processing kubectl flag --%s=%s: %w", k, v, err)
+// loadCluster loads the kubeconfig using the given kubectl flags and returns the name of the selected
+// context, the context, and its cluster. The kubeconfig is parsed from kubeconfigData, unless it's empty.
+// The in-cluster config is used when there's no kubeconfig and the process runs in a pod.
+func loadCluster(flagMap map[string]string, kubeconfigData []byte) (genericclioptions.RESTClientGetter, string, *api.Context, *api.Cluster, error) {
+	var configFlags genericclioptions.RESTClientGetter
+	if len(kubeconfigData) > 0 {
+		getter, err := newKubeconfigDataGetter(kubeconfigData, flagMap)
+		if err != nil {
+			return nil, "", nil, nil, err
+		}
+		configFlags = getter
+	} else {
+		cf := genericclioptions.NewConfigFlags(false)
+		flags := pflag.NewFlagSet("", 0)
+		cf.AddFlags(flags)
+		for k, v := range flagMap {
+			if err := flags.Set(k, v); err != nil {
+				return nil, "", nil, nil, errcat.User.Newf("error processing kubectl flag --%s=%s: %w", k, v, err)
+			}
 		}
+		configFlags = cf
 	}
 
-	configLoader := configFlags.ToRawKubeConfigLoader()
-	config, err := configLoader.RawConfig()
+	config, err := configFlags.ToRawKubeConfigLoader().RawConfig()
 	if err != nil {
-		return nil, err
+		return nil, "", nil, nil, err
 	}
 
 	if len(config.Contexts) == 0 {
-		return nil, errcat.Config.New("kubeconfig has no context definition")
+		if len(kubeconfigData) == 0 && inClusterPossible() {
+			ctx, cluster, err := inClusterContext(configFlags)
+			if err != nil {
+				return nil, "", nil, nil, errcat.Config.Newf("unable to use the in-cluster config: %w", err)
+			}
+			return configFlags, InClusterContext, ctx, cluster, nil
+		}
+		return nil, "", nil, nil, errcat.Config.New("kubeconfig has no context definition")
 	}
 
 	ctxName := flagMap["context"]
@@ -96,15 +121,33 @@ func NewConfig(c context.Context, flagMap map[string]string) (*Config, error) {
 
 	ctx, ok := config.Contexts[ctxName]
 	if !ok {
-		return nil, errcat.Config.Newf("context %q does not exist in the kubeconfig", ctxName)
+		return nil, "", nil, nil, errcat.Config.Newf("context %q does not exist in the kubeconfig", ctxName)
 	}
 
 	cluster, ok := config.Clusters[ctx.Cluster]
 	if !ok {
-		return nil, errcat.Config.Newf("the cluster %q declared in context %q does exists in the kubeconfig", ctx.Cluster, ctxName)
+		return nil, "", nil, nil, errcat.Config.Newf("the cluster %q declared in context %q does exists in the kubeconfig", ctx.Cluster, ctxName)
 	}
+	return configFlags, ctxName, ctx, cluster, nil
+}
 
-	restConfig, err := configLoader.ClientConfig()
+func NewConfig(c context.Context, flagMap map[string]string) (*Config, error) {
+	return NewConfigFromData(c, flagMap, nil)
+}
+
+// NewConfigFromData is like NewConfig, but parses the kubeconfig from the given data instead of reading it
+// from a file, unless the data is empty.
+func NewConfigFromData(c context.Context, flagMap map[string]string, kubeconfigData []byte) (*Config, error) {
+	// Namespace option will be passed only when explicitly needed. The k8Cluster is namespace agnostic with
+	// respect to this option.
+	delete(flagMap, "namespace")
+
+	configFlags, ctxName, ctx, cluster, err := loadCluster(flagMap, kubeconfigData)
+	if err != nil {
+		return nil, err
+	}
+
+	restConfig, err := configFlags.ToRawKubeConfigLoader().ClientConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -115,12 +158,14 @@ func NewConfig(c context.Context, flagMap map[string]string) (*Config, error) {
 	}
 
 	k := &Config{
-		Context:     ctxName,
-		Server:      cluster.Server,
-		Namespace:   namespace,
-		flagMap:     flagMap,
-		ConfigFlags: configFlags,
-		config:      restConfig,
+		Context:        ctxName,
+		Server:         cluster.Server,
+		InCluster:      isInClusterContext(ctx),
+		Namespace:      namespace,
+		flagMap:        flagMap,
+		kubeconfigData: kubeconfigData,
+		ConfigFlags:    configFlags,
+		config:         restConfig,
 	}
 
 	if ext, ok := cluster.Extensions[configExtension].(*runtime.Unknown); ok {
@@ -134,19 +179,64 @@ func NewConfig(c context.Context, flagMap map[string]string) (*Config, error) {
 	}
 
 	if k.kubeconfigExtension.Manager.Namespace == "" {
-		k.kubeconfigExtension.Manager.Namespace = client.GetEnv(c).ManagerNamespace
+		k.kubeconfigExtension.Manager.Namespace = client.GetManagerNamespace(c)
 	}
 
 	return k, nil
 }
 
+// ValidateExtension validates the telepresence.io extension of the cluster that the kubeconfig,
+// loaded using the given kubectl flags, selects. It returns the name of the context, a description
+// of each unknown key in the extension, and an error if the extension cannot be parsed.
+func ValidateExtension(flagMap map[string]string) (string, []string, error) {
+	_, ctxName, _, cluster, err := loadCluster(flagMap, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	ext, ok := cluster.Extensions[configExtension].(*runtime.Unknown)
+	if !ok {
+		return ctxName, nil, nil
+	}
+	var node yaml.Node
+	if err = yaml.Unmarshal(ext.Raw, &node); err != nil {
+		return ctxName, nil, err
+	}
+	var problems []string
+	for _, u := range client.CheckKeys(&node, reflect.TypeOf(kubeconfigExtension{}), "json") {
+		problems = append(problems, u.String())
+	}
+	var ke kubeconfigExtension
+	if err = json.Unmarshal(ext.Raw, &ke); err != nil {
+		return ctxName, problems, errcat.Config.Newf("unable to parse extension %s in kubeconfig: %w", configExtension, err)
+	}
+	return ctxName, problems, nil
+}
+
 // ContextServiceAndFlagsEqual determines if this instance is equal to the given instance with respect to context,
 // server, and flag arguments.
 func (kf *Config) ContextServiceAndFlagsEqual(okf *Config) bool {
 	return kf != nil && okf != nil &&
 		kf.Context == okf.Context &&
 		kf.Server == okf.Server &&
-		mapEqual(kf.flagMap, okf.flagMap)
+		mapEqual(kf.flagMap, okf.flagMap) &&
+		bytes.Equal(kf.kubeconfigData, okf.kubeconfigData)
+}
+
+// ReloadProxySubnets reads the kubeconfig again, using the same flags as when this instance was
+// created, and replaces the also-proxy and never-proxy subnets with the ones declared in its
+// telepresence.io extension. An error is returned if the kubeconfig now refers to another context
+// or cluster.
+func (kf *Config) ReloadProxySubnets(c context.Context) error {
+	okf, err := NewConfigFromData(c, kf.flagMap, kf.kubeconfigData)
+	if err != nil {
+		return err
+	}
+	if !kf.ContextServiceAndFlagsEqual(okf) {
+		return errcat.User.Newf("the kubeconfig now refers to context %q at %s; quit and connect again to switch cluster", okf.Context, okf.Server)
+	}
+	kf.AlsoProxy = okf.AlsoProxy
+	kf.NeverProxy = okf.NeverProxy
+	return nil
 }
 
 func (kf *Config) GetManagerNamespace() string {
@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+)
+
+const kubeconfigTemplate = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+    extensions:
+    - name: telepresence.io
+      extension:
+        also-proxy:
+        - %s
+        never-proxy:
+        - 10.0.1.0/24
+        - "*.corp.example.com"
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: abc
+`
+
+func TestConfig_ReloadProxySubnets(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	env, err := client.LoadEnv(ctx)
+	require.NoError(t, err)
+	ctx = client.WithEnv(ctx, env)
+
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	writeKubeconfig := func(server, alsoProxy string) {
+		data := []byte(fmt.Sprintf(kubeconfigTemplate, server, alsoProxy))
+		require.NoError(t, os.WriteFile(kubeconfig, data, 0600))
+	}
+
+	writeKubeconfig("https://127.0.0.1:6443", "192.168.0.0/16")
+	kf, err := NewConfig(ctx, map[string]string{"kubeconfig": kubeconfig})
+	require.NoError(t, err)
+	require.Len(t, kf.AlsoProxy, 1)
+	assert.Equal(t, "192.168.0.0/16", kf.AlsoProxy[0].String())
+
+	writeKubeconfig("https://127.0.0.1:6443", "172.20.0.0/16")
+	require.NoError(t, kf.ReloadProxySubnets(ctx))
+	require.Len(t, kf.AlsoProxy, 1)
+	assert.Equal(t, "172.20.0.0/16", kf.AlsoProxy[0].String())
+	require.Len(t, kf.NeverProxy, 2)
+	assert.Equal(t, "10.0.1.0/24", kf.NeverProxy[0].String())
+	assert.Equal(t, "*.corp.example.com", kf.NeverProxy[1].Host)
+
+	writeKubeconfig("https://127.0.0.1:6443", "git.partner.example.com")
+	require.NoError(t, kf.ReloadProxySubnets(ctx))
+	require.Len(t, kf.AlsoProxy, 1)
+	assert.Equal(t, "git.partner.example.com", kf.AlsoProxy[0].Host)
+
+	writeKubeconfig("https://127.0.0.1:6443", "172.20.0.0/16")
+	require.NoError(t, kf.ReloadProxySubnets(ctx))
+
+	// Routes are never applied to a session that was established with another cluster
+	writeKubeconfig("https://127.0.0.2:6443", "10.20.0.0/16")
+	assert.Error(t, kf.ReloadProxySubnets(ctx))
+	assert.Equal(t, "172.20.0.0/16", kf.AlsoProxy[0].String())
+}
+
+func TestNewConfigFromData(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	env, err := client.LoadEnv(ctx)
+	require.NoError(t, err)
+	ctx = client.WithEnv(ctx, env)
+
+	// Make sure that nothing is read from a kubeconfig file.
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+	data := []byte(fmt.Sprintf(kubeconfigTemplate, "https://127.0.0.1:6443", "192.168.0.0/16"))
+
+	kf, err := NewConfigFromData(ctx, map[string]string{"request-timeout": "5s"}, data)
+	require.NoError(t, err)
+	assert.Equal(t, "test", kf.Context)
+	assert.Equal(t, "https://127.0.0.1:6443", kf.Server)
+	require.Len(t, kf.AlsoProxy, 1)
+	assert.Equal(t, "192.168.0.0/16", kf.AlsoProxy[0].String())
+
+	rc, err := kf.ConfigFlags.ToRESTConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "abc", rc.BearerToken)
+	assert.Equal(t, 5*time.Second, rc.Timeout)
+
+	// The same data gives an equal config, other data doesn't.
+	okf, err := NewConfigFromData(ctx, map[string]string{"request-timeout": "5s"}, data)
+	require.NoError(t, err)
+	assert.True(t, kf.ContextServiceAndFlagsEqual(okf))
+	okf, err = NewConfigFromData(ctx, map[string]string{"request-timeout": "5s"}, append(data, '\n'))
+	require.NoError(t, err)
+	assert.False(t, kf.ContextServiceAndFlagsEqual(okf))
+
+	_, err = NewConfigFromData(ctx, map[string]string{"context": "other"}, data)
+	assert.Error(t, err)
+	_, err = NewConfigFromData(ctx, map[string]string{"kubeconfig": "/tmp/config"}, data)
+	assert.Error(t, err)
+	_, err = NewConfigFromData(ctx, nil, []byte("not: [a kubeconfig"))
+	assert.Error(t, err)
+}
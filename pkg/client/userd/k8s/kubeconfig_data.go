@@ -0,0 +1,75 @@
+package k8s
+
+import (
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+// kubeconfigDataGetter is a RESTClientGetter for a kubeconfig that is passed as data instead of as a path, e.g.
+// when it's read from stdin. The data is never written to disk.
+type kubeconfigDataGetter struct {
+	clientConfig clientcmd.ClientConfig
+}
+
+var _ genericclioptions.RESTClientGetter = (*kubeconfigDataGetter)(nil)
+
+// newKubeconfigDataGetter returns a RESTClientGetter for the given kubeconfig data. The kubectl flags in the
+// flagMap are applied the same way that genericclioptions.ConfigFlags applies them to a kubeconfig file.
+func newKubeconfigDataGetter(data []byte, flagMap map[string]string) (*kubeconfigDataGetter, error) {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, errcat.Config.Newf("unable to parse kubeconfig data: %w", err)
+	}
+	overrides := &clientcmd.ConfigOverrides{ClusterDefaults: clientcmd.ClusterDefaults}
+	flags := pflag.NewFlagSet("", 0)
+	clientcmd.BindOverrideFlags(overrides, flags, clientcmd.RecommendedConfigOverrideFlags(""))
+	for k, v := range flagMap {
+		switch k {
+		case "kubeconfig":
+			return nil, errcat.User.New("the --kubeconfig flag cannot be used together with kubeconfig data")
+		case "cache-dir":
+			// Discovery is cached in memory
+			continue
+		}
+		if err := flags.Set(k, v); err != nil {
+			return nil, errcat.User.Newf("error processing kubectl flag --%s=%s: %w", k, v, err)
+		}
+	}
+	return &kubeconfigDataGetter{clientConfig: clientcmd.NewNonInteractiveClientConfig(*config, overrides.CurrentContext, overrides, nil)}, nil
+}
+
+func (g *kubeconfigDataGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return g.clientConfig
+}
+
+func (g *kubeconfigDataGetter) ToRESTConfig() (*rest.Config, error) {
+	return g.clientConfig.ClientConfig()
+}
+
+func (g *kubeconfigDataGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	config, err := g.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return memory.NewMemCacheClient(dc), nil
+}
+
+func (g *kubeconfigDataGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	dc, err := g.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	return restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(dc), dc), nil
+}
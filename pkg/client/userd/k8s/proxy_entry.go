@@ -0,0 +1,99 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+// ProxyEntry is an entry in the also-proxy or never-proxy list of the kubeconfig extension. It's either a subnet in
+// CIDR notation or a host name. A host name that starts with "*." is a wildcard that matches all names
+// in the domain that follows it.
+type ProxyEntry struct {
+	Subnet *net.IPNet
+	Host   string
+}
+
+// ParseProxyEntry parses the given subnet, IP address, or host name. An IP address is a subnet that
+// contains only that address.
+func ParseProxyEntry(s string) (*ProxyEntry, error) {
+	if strings.ContainsRune(s, '/') {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		return &ProxyEntry{Subnet: ipNet}, nil
+	}
+	if ip := iputil.Parse(s); ip != nil {
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &ProxyEntry{Subnet: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}}, nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(s, "."))
+	name := strings.TrimPrefix(host, "*.")
+	if _, ok := dns.IsDomainName(name); !ok || name == "" || strings.ContainsAny(name, "*/:") {
+		return nil, fmt.Errorf("%q is neither a subnet in CIDR notation nor a host name", s)
+	}
+	return &ProxyEntry{Host: host}, nil
+}
+
+func (e *ProxyEntry) String() string {
+	if e.Subnet != nil {
+		return e.Subnet.String()
+	}
+	return e.Host
+}
+
+func (e *ProxyEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.String())
+}
+
+func (e *ProxyEntry) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	pe, err := ParseProxyEntry(str)
+	if err != nil {
+		return err
+	}
+	*e = *pe
+	return nil
+}
+
+func (e ProxyEntry) MarshalYAML() (interface{}, error) {
+	return e.String(), nil
+}
+
+func (e *ProxyEntry) UnmarshalYAML(node *yaml.Node) error {
+	var str string
+	if err := node.Decode(&str); err != nil {
+		return err
+	}
+	pe, err := ParseProxyEntry(str)
+	if err != nil {
+		return err
+	}
+	*e = *pe
+	return nil
+}
+
+// SplitProxyEntries returns the subnets and the host names of the given entries.
+func SplitProxyEntries(entries []*ProxyEntry) (subnets []*net.IPNet, hosts []string) {
+	for _, e := range entries {
+		if e.Subnet != nil {
+			subnets = append(subnets, e.Subnet)
+		} else {
+			hosts = append(hosts, e.Host)
+		}
+	}
+	return subnets, hosts
+}
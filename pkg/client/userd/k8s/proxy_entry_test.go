@@ -0,0 +1,54 @@
+package k8s
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProxyEntry(t *testing.T) {
+	tests := []struct {
+		in     string
+		subnet string
+		host   string
+	}{
+		{in: "10.0.0.0/8", subnet: "10.0.0.0/8"},
+		{in: "192.168.1.7", subnet: "192.168.1.7/32"},
+		{in: "fd00::1", subnet: "fd00::1/128"},
+		{in: "Git.Corp.Example.com.", host: "git.corp.example.com"},
+		{in: "*.corp.example.com", host: "*.corp.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			pe, err := ParseProxyEntry(tt.in)
+			require.NoError(t, err)
+			if tt.subnet != "" {
+				require.NotNil(t, pe.Subnet)
+				assert.Equal(t, tt.subnet, pe.Subnet.String())
+			} else {
+				assert.Nil(t, pe.Subnet)
+				assert.Equal(t, tt.host, pe.Host)
+			}
+		})
+	}
+
+	for _, bad := range []string{"", "*", "10.0.0.0/33", "a.*.example.com", "*.*.example.com", "host:80"} {
+		_, err := ParseProxyEntry(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestSplitProxyEntries(t *testing.T) {
+	var entries []*ProxyEntry
+	require.NoError(t, json.Unmarshal([]byte(`["10.0.1.0/24", "db.example.com", "*.corp.example.com"]`), &entries))
+	subnets, hosts := SplitProxyEntries(entries)
+	require.Len(t, subnets, 1)
+	assert.Equal(t, "10.0.1.0/24", subnets[0].String())
+	assert.Equal(t, []string{"db.example.com", "*.corp.example.com"}, hosts)
+
+	data, err := json.Marshal(entries)
+	require.NoError(t, err)
+	assert.JSONEq(t, `["10.0.1.0/24", "db.example.com", "*.corp.example.com"]`, string(data))
+}
@@ -84,7 +84,7 @@ func (w *Watcher) HasSynced() bool {
 	w.Lock()
 	defer w.Unlock()
 	if w.controller != nil {
-		w.controller.HasSynced()
+		return w.controller.HasSynced()
 	}
 	return true
 }
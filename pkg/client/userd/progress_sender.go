@@ -0,0 +1,33 @@
+package userd
+
+import (
+	"sync"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+)
+
+// progressSender sends progress events on the stream of a call until the call is about to return. The
+// events may be reported from different goroutines, so the sends are serialized, because a stream
+// must not be used concurrently.
+type progressSender struct {
+	sync.Mutex
+	send   func(*rpc.ProgressEvent) error
+	closed bool
+}
+
+func (p *progressSender) report(e *rpc.ProgressEvent) {
+	p.Lock()
+	defer p.Unlock()
+	if !p.closed && p.send(e) != nil {
+		// The client is gone. There's no point in trying again.
+		p.closed = true
+	}
+}
+
+// close makes the sender discard all further events. It must be called before the result of the
+// call is sent.
+func (p *progressSender) close() {
+	p.Lock()
+	p.closed = true
+	p.Unlock()
+}
@@ -15,11 +15,13 @@ import (
 	"github.com/datawire/dlib/dhttp"
 	"github.com/datawire/dlib/dlog"
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/connector/v2alpha"
 	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/logging"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/remotefs"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/scout"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/auth"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/internal/broadcastqueue"
@@ -77,14 +79,28 @@ type service struct {
 	sessionContext context.Context
 	sessionLock    sync.RWMutex
 
+	// connectLock serializes Connect calls, so that concurrent connects from different terminals
+	// or IDE plugins end up sharing one session instead of racing to create one each.
+	connectLock sync.Mutex
+
+	// newSession creates the session. It's trafficmgr.NewSession unless replaced by tests.
+	newSession func(context.Context, *scout.Reporter, *rpc.ConnectRequest, trafficmgr.Service, []trafficmgr.SessionService) (trafficmgr.Session, *rpc.ConnectInfo)
+
 	// These are used to communicate between the various goroutines.
-	connectRequest  chan *rpc.ConnectRequest // server-grpc.connect() -> connectWorker
-	connectResponse chan *rpc.ConnectInfo    // connectWorker -> server-grpc.connect()
+	connectRequest  chan sessionRequest   // server-grpc.connect() -> connectWorker
+	connectResponse chan *rpc.ConnectInfo // connectWorker -> server-grpc.connect()
 
 	// This is used for the service to know which CLI commands it supports
 	getCommands CommandFactory
 }
 
+// sessionRequest is a request to create a session, and the function that receives the progress of
+// the connect, if any.
+type sessionRequest struct {
+	*rpc.ConnectRequest
+	progress trafficmgr.ProgressFunc
+}
+
 func (s *service) SetManagerClient(managerClient manager.ManagerClient, callOptions ...grpc.CallOption) {
 	s.managerProxy.SetClient(managerClient, callOptions...)
 }
@@ -138,7 +154,7 @@ func (s *service) manageSessions(c context.Context, sessionServices []trafficmgr
 	c, s.quit = context.WithCancel(c)
 	for {
 		// Wait for a connection request
-		var oi *rpc.ConnectRequest
+		var oi sessionRequest
 		select {
 		case <-c.Done():
 			return nil
@@ -149,7 +165,11 @@ func (s *service) manageSessions(c context.Context, sessionServices []trafficmgr
 		// if everything is ok)
 		s.sessionLock.Lock() // Locked until Run
 		var rsp *rpc.ConnectInfo
-		s.session, rsp = trafficmgr.NewSession(c, s.scout, oi, s, sessionServices)
+		sc := c
+		if oi.progress != nil {
+			sc = trafficmgr.WithProgress(c, oi.progress)
+		}
+		s.session, rsp = s.newSession(sc, s.scout, oi.ConnectRequest, s, sessionServices)
 		select {
 		case <-c.Done():
 			s.sessionLock.Unlock()
@@ -169,8 +189,11 @@ func (s *service) manageSessions(c context.Context, sessionServices []trafficmgr
 			c, s.sessionCancel = context.WithCancel(c)
 			c = s.session.WithK8sInterface(c)
 			s.sessionContext = c
+
+			// Disconnect clears s.session, so it must not be accessed once the lock is released.
+			session := s.session
 			s.sessionLock.Unlock()
-			if err := s.session.Run(c); err != nil {
+			if err := session.Run(c); err != nil {
 				dlog.Error(c, err)
 			}
 		}(c)
@@ -185,14 +208,12 @@ func run(c context.Context, getCommands CommandFactory, daemonServices []DaemonS
 	}
 	c = client.WithConfig(c, cfg)
 	c = dgroup.WithGoroutineName(c, "/"+ProcessName)
-	c, err = logging.InitContext(c, ProcessName, logging.NewRotateOnce())
-	if err != nil {
-		return err
-	}
 
 	// Listen on domain unix domain socket or windows named pipe. The listener must be opened
 	// before other tasks because the CLI client will only wait for a short period of time for
-	// the socket/pipe to appear before it gives up.
+	// the socket/pipe to appear before it gives up. It's also opened before the logging is
+	// initialized, so that a connector that is started while another one is running exits
+	// without rotating the log of the running one.
 	grpcListener, err := client.ListenSocket(c, ProcessName, client.ConnectorSocketName)
 	if err != nil {
 		return err
@@ -200,6 +221,11 @@ func run(c context.Context, getCommands CommandFactory, daemonServices []DaemonS
 	defer func() {
 		_ = client.RemoveSocket(grpcListener)
 	}()
+
+	c, err = logging.InitContext(c, ProcessName, logging.NewRotateOnce())
+	if err != nil {
+		return err
+	}
 	dlog.Debug(c, "Listener opened")
 
 	dlog.Info(c, "---")
@@ -215,8 +241,9 @@ func run(c context.Context, getCommands CommandFactory, daemonServices []DaemonS
 
 	s := &service{
 		scout:             sr,
-		connectRequest:    make(chan *rpc.ConnectRequest),
+		connectRequest:    make(chan sessionRequest),
 		connectResponse:   make(chan *rpc.ConnectInfo),
+		newSession:        trafficmgr.NewSession,
 		managerProxy:      trafficmgr.NewManagerProxy(),
 		loginExecutor:     auth.NewStandardLoginExecutor(cliio, sr),
 		userNotifications: func(ctx context.Context) <-chan string { return cliio.Subscribe(ctx) },
@@ -253,6 +280,7 @@ func run(c context.Context, getCommands CommandFactory, daemonServices []DaemonS
 		}
 		s.svc = grpc.NewServer(opts...)
 		rpc.RegisterConnectorServer(s.svc, s)
+		v2alpha.RegisterConnectorServer(s.svc, &serviceV2Alpha{s: s})
 		manager.RegisterManagerServer(s.svc, s.managerProxy)
 		for _, ds := range daemonServices {
 			dlog.Infof(c, "Starting additional daemon service %s", ds.Name())
@@ -274,6 +302,10 @@ func run(c context.Context, getCommands CommandFactory, daemonServices []DaemonS
 		return err
 	})
 
+	// WebDAV mounts are owned by the connector, so the ones that remain were left behind by a connector
+	// that didn't shut down cleanly.
+	remotefs.RemoveStaleWebDAVMounts(c)
+
 	g.Go("config-reload", s.configReload)
 	g.Go("session", func(c context.Context) error {
 		return s.manageSessions(c, sessionServices)
@@ -94,11 +94,12 @@ func (tm *TrafficManager) agentInfoWatcher(ctx context.Context) error {
 }
 
 func (tm *TrafficManager) addAgent(
-	c context.Context, workload k8sapi.Workload, svcName, svcPortIdentifier, agentImageName string, telepresenceAPIPort uint16,
+	c context.Context, workload k8sapi.Workload, svcName, svcPortIdentifier, containerName, agentImageName string, telepresenceAPIPort uint16,
 ) *rpc.InterceptResult {
 	agentName := workload.GetName()
 	namespace := workload.GetNamespace()
-	svcUID, kind, err := tm.EnsureAgent(c, workload, svcName, svcPortIdentifier, agentImageName, telepresenceAPIPort)
+	reportProgress(c, rpc.ProgressEvent_AGENT_INSTALL, false, "Ensuring that %s %s.%s has a traffic-agent", workload.GetKind(), agentName, namespace)
+	svcUID, kind, err := tm.EnsureAgent(c, workload, svcName, svcPortIdentifier, containerName, agentImageName, telepresenceAPIPort)
 	if err != nil {
 		if err == agentNotFound {
 			return &rpc.InterceptResult{
@@ -114,6 +115,7 @@ func (tm *TrafficManager) addAgent(
 	}
 
 	dlog.Infof(c, "Waiting for agent for %s %s.%s", kind, agentName, namespace)
+	reportProgress(c, rpc.ProgressEvent_AGENT_INSTALL, false, "Waiting for the traffic-agent of %s %s.%s", kind, agentName, namespace)
 	agent, err := tm.waitForAgent(c, agentName, namespace)
 	if err != nil {
 		dlog.Error(c, err)
@@ -123,6 +125,7 @@ func (tm *TrafficManager) addAgent(
 		}
 	}
 	dlog.Infof(c, "Agent found or created for %s %s.%s", kind, agentName, namespace)
+	reportProgress(c, rpc.ProgressEvent_AGENT_INSTALL, true, "The traffic-agent of %s %s.%s is ready", kind, agentName, namespace)
 	return &rpc.InterceptResult{
 		Error:        rpc.InterceptError_UNSPECIFIED,
 		Environment:  agent.Environment,
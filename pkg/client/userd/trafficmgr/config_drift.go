@@ -0,0 +1,73 @@
+package trafficmgr
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+const reinstallHint = `run "telepresence helm upgrade" so that the traffic-manager is upgraded using your config`
+
+// getConfigDrift asks the traffic-manager for its requirements and returns a description of each
+// place where the client configuration differs from them.
+func (tm *TrafficManager) getConfigDrift(c context.Context) []string {
+	c, cancel := client.GetConfig(c).Timeouts.TimeoutContext(c, client.TimeoutTrafficManagerAPI)
+	defer cancel()
+	req, err := tm.managerClient.GetClientRequirements(c, &empty.Empty{})
+	if err != nil {
+		if status.Code(err) != codes.Unimplemented {
+			dlog.Errorf(c, "failed to obtain client requirements from traffic manager: %v", err)
+		}
+		return nil
+	}
+	drift := configDrift(client.GetConfig(c), client.GetDefaultConfig(c), req)
+	for _, d := range drift {
+		dlog.Warnf(c, "Config drift: %s", d)
+	}
+	return drift
+}
+
+// configDrift compares the settings in cfg that differ from the defaults in dflt with the given
+// requirements, and returns an actionable description of each mismatch. Settings that have no
+// counterpart in the traffic-manager, such as timeouts, are not compared.
+func configDrift(cfg *client.Config, dflt client.Config, req *manager.ClientRequirements) []string {
+	var drift []string
+	add := func(format string, args ...interface{}) {
+		drift = append(drift, fmt.Sprintf(format, args...)+"; "+reinstallHint+", or change the config to match")
+	}
+
+	img := &cfg.Images
+	if r := img.WebhookRegistry; r != "" && r != dflt.Images.WebhookRegistry && r != req.AgentRegistry {
+		add("the traffic-manager requires agent images from registry %q, your config overrides images.webhookRegistry to %q",
+			req.AgentRegistry, r)
+	}
+	if ai := img.WebhookAgentImage; ai != "" && ai != dflt.Images.WebhookAgentImage && ai != req.AgentImage {
+		add("the traffic-manager requires agent image %q, your config overrides images.webhookAgentImage to %q",
+			req.AgentImage, ai)
+	}
+	if p := int32(cfg.TelepresenceAPI.Port); p != 0 && p != req.ApiPort {
+		if req.ApiPort == 0 {
+			add("the traffic-manager has the Telepresence API disabled, your config sets telepresenceAPI.port to %d", p)
+		} else {
+			add("the traffic-manager requires Telepresence API port %d, your config overrides telepresenceAPI.port to %d",
+				req.ApiPort, p)
+		}
+	}
+	if aps := cfg.Intercept.AppProtocolStrategy; aps != k8sapi.Http2Probe && aps.String() != req.AppProtocolStrategy {
+		add("the traffic-manager uses app protocol strategy %q, your config overrides intercept.appProtocolStrategy to %q",
+			req.AppProtocolStrategy, aps)
+	}
+	if mrs := cfg.Grpc.MaxReceiveSize; !mrs.IsZero() && req.MaxReceiveSize != 0 && mrs.Value() != req.MaxReceiveSize {
+		add("the traffic-manager accepts gRPC messages of at most %d bytes, your config overrides grpc.maxReceiveSize to %s",
+			req.MaxReceiveSize, mrs.String())
+	}
+	return drift
+}
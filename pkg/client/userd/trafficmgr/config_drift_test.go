@@ -0,0 +1,61 @@
+package trafficmgr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+func TestConfigDrift(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	env, err := client.LoadEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = client.WithEnv(ctx, env)
+	dflt := client.GetDefaultConfig(ctx)
+	req := &manager.ClientRequirements{
+		AgentRegistry:       dflt.Images.WebhookRegistry,
+		AgentImage:          "tel2:2.5.0",
+		ApiPort:             9980,
+		AppProtocolStrategy: k8sapi.Http2Probe.String(),
+		MaxReceiveSize:      4 * 1024 * 1024,
+	}
+
+	cfg := dflt
+	assert.Empty(t, configDrift(&cfg, dflt, req), "default config must not drift")
+
+	cfg.Images.WebhookAgentImage = "tel2:2.5.0"
+	cfg.TelepresenceAPI.Port = 9980
+	cfg.Grpc.MaxReceiveSize = resource.MustParse("4Mi")
+	assert.Empty(t, configDrift(&cfg, dflt, req), "matching overrides must not drift")
+
+	cfg.Images.WebhookRegistry = "example.com/custom"
+	cfg.Images.WebhookAgentImage = "tel2:2.4.0"
+	cfg.TelepresenceAPI.Port = 8080
+	cfg.Intercept.AppProtocolStrategy = k8sapi.PortName
+	cfg.Grpc.MaxReceiveSize = resource.MustParse("10Mi")
+	drift := configDrift(&cfg, dflt, req)
+	if assert.Len(t, drift, 5) {
+		assert.Contains(t, drift[0], `requires agent images from registry "`+dflt.Images.WebhookRegistry+`"`)
+		assert.Contains(t, drift[0], `images.webhookRegistry to "example.com/custom"`)
+		assert.Contains(t, drift[1], `images.webhookAgentImage to "tel2:2.4.0"`)
+		assert.Contains(t, drift[2], `telepresenceAPI.port to 8080`)
+		assert.Contains(t, drift[3], `intercept.appProtocolStrategy to "portName"`)
+		assert.Contains(t, drift[4], `grpc.maxReceiveSize to 10Mi`)
+	}
+
+	req.ApiPort = 0
+	cfg = dflt
+	cfg.TelepresenceAPI.Port = 8080
+	drift = configDrift(&cfg, dflt, req)
+	if assert.Len(t, drift, 1) {
+		assert.Contains(t, drift[0], "has the Telepresence API disabled")
+	}
+}
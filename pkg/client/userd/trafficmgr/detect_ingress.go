@@ -6,7 +6,6 @@ import (
 	core "k8s.io/api/core/v1"
 
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
-	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
 )
 
 func (tm *TrafficManager) IngressInfos(c context.Context) ([]*manager.IngressInfo, error) {
@@ -76,19 +75,19 @@ func (tm *TrafficManager) detectIngressBehavior(c context.Context) ([]*manager.I
 	return iis, nil
 }
 
-// findAllSvcByType finds services with the given service type in all namespaces of the cluster returns
-// a slice containing a copy of those services.
+// findAllSvcByType finds services with the given service type in all namespaces of the cluster and returns
+// a slice containing those services. Services in mapped namespaces are served from the watcher cache, so
+// the returned services must not be modified.
 func (tm *TrafficManager) findAllSvcByType(c context.Context, svcType core.ServiceType) ([]*core.Service, error) {
 	// NOTE: This is expensive in terms of bandwidth on a large cluster. We currently only use this
 	// to retrieve ingress info and that task could be moved to the traffic-manager instead.
 	var typedSvcs []*core.Service
 	findTyped := func(ns string) error {
-		ss, err := k8sapi.Services(c, ns)
+		ss, err := tm.wlWatcher.getServices(c, ns)
 		if err != nil {
 			return err
 		}
-		for _, s := range ss {
-			si, _ := k8sapi.ServiceImpl(s)
+		for _, si := range ss {
 			if si.Spec.Type == svcType {
 				typedSvcs = append(typedSvcs, si)
 			}
@@ -2,16 +2,38 @@ package trafficmgr
 
 import (
 	"context"
+	"time"
 
+	"github.com/datawire/dlib/dlog"
+	"github.com/datawire/dlib/dtime"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
 )
 
 func (tm *TrafficManager) dialRequestWatcher(ctx context.Context) error {
-	// Deal with dial requests from the manager
-	dialerStream, err := tm.managerClient.WatchDial(ctx, tm.sessionInfo)
-	if err != nil {
-		return err
+	// Deal with dial requests from the manager. The stream ends when the session does, so it's
+	// opened anew using the current session.
+	backoff := 100 * time.Millisecond
+	for ctx.Err() == nil {
+		session := tm.session()
+		dialerStream, err := tm.managerClient.WatchDial(ctx, session)
+		if err != nil {
+			if ctx.Err() == nil {
+				dlog.Errorf(ctx, "manager.WatchDial dial: %v", err)
+			}
+		} else {
+			backoff = 100 * time.Millisecond
+			dialCtx := tunnel.WithTimeouts(ctx, client.GetConfig(ctx).Tunnel.Timeouts())
+			dialCtx = tunnel.WithConnWrapper(dialCtx, tm.recordConn)
+			tunnel.DialWaitLoop(dialCtx, tm.managerClient, dialerStream, session.SessionId, func(interceptID string, agentPublicKey []byte) []byte {
+				return tm.interceptKey(ctx, interceptID, agentPublicKey)
+			})
+		}
+		dtime.SleepWithContext(ctx, backoff)
+		backoff *= 2
+		if backoff > 3*time.Second {
+			backoff = 3 * time.Second
+		}
 	}
-	tunnel.DialWaitLoop(ctx, tm.managerClient, dialerStream, tm.sessionInfo.SessionId)
 	return nil
 }
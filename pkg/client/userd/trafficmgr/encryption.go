@@ -0,0 +1,326 @@
+package trafficmgr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/dnet"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+// keyExchangeInterval is how often the keys of the intercepts are exchanged with traffic-agents that have
+// yet to receive them.
+const keyExchangeInterval = 5 * time.Second
+
+// keyExchangeTimeout limits the time of an exchange with one traffic-agent.
+const keyExchangeTimeout = 10 * time.Second
+
+// interceptKeys holds the private keys of the intercepts that use end-to-end encryption, and the keys
+// that are derived from them and the public keys of the traffic-agents that the intercepted connections
+// arrive from. Each agent of an intercepted workload has its own key pair.
+//
+// The public keys are exchanged directly with the traffic-agents, through port-forwards that the Kubernetes
+// API server establishes. The traffic-manager relays the public keys too, but only a key that was
+// exchanged is used, so a traffic-manager that substitutes the keys can't decrypt the payloads.
+type interceptKeys struct {
+	sync.Mutex
+
+	// private keys, keyed by their public key. A retried creation of an intercept generates a new
+	// key pair, so keying them by intercept name could replace the key of an existing intercept.
+	private map[string][]byte
+
+	// pending are the public keys of intercepts that are being created
+	pending map[string]struct{}
+
+	// derived keys, keyed by intercept ID and then by agent public key
+	derived map[string]map[string][]byte
+
+	// agents are the public keys that the traffic-agents responded with in the exchanges, keyed by the
+	// public key of the intercept
+	agents map[string]map[string]struct{}
+
+	// exchanged are the traffic-agents that the public key of an intercept has been exchanged with, keyed
+	// by the public key of the intercept. An agent is identified by the UID of its pod and its restart count,
+	// because a restarted agent has a new key pair.
+	exchanged map[string]map[string]struct{}
+
+	// dial dials a port of a pod using a port-forward. It's created when first needed.
+	dial func(context.Context, string) (net.Conn, error)
+}
+
+// forget forgets everything about the given public key. The lock must be held.
+func (ik *interceptKeys) forget(public string) {
+	delete(ik.private, public)
+	delete(ik.agents, public)
+	delete(ik.exchanged, public)
+}
+
+// newInterceptKey creates the key pair of an intercept that is about to be created and returns its
+// public key. The key pair is retained until releaseInterceptKey is called.
+func (tm *TrafficManager) newInterceptKey() ([]byte, error) {
+	private, public, err := tunnel.GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	ik := &tm.interceptKeys
+	ik.Lock()
+	if ik.private == nil {
+		ik.private = make(map[string][]byte)
+		ik.pending = make(map[string]struct{})
+	}
+	ik.private[string(public)] = private
+	ik.pending[string(public)] = struct{}{}
+	ik.Unlock()
+	return public, nil
+}
+
+// releaseInterceptKey ends the creation of the intercept with the given public key. The key pair is
+// forgotten unless keep is true, in which case it is retained until the intercept is removed.
+func (tm *TrafficManager) releaseInterceptKey(public []byte, keep bool) {
+	ik := &tm.interceptKeys
+	ik.Lock()
+	delete(ik.pending, string(public))
+	if !keep {
+		ik.forget(string(public))
+	}
+	ik.Unlock()
+}
+
+// pruneInterceptKeys forgets the keys of intercepts that are neither in the given snapshot nor being
+// created.
+func (tm *TrafficManager) pruneInterceptKeys(intercepts []*manager.InterceptInfo) {
+	publics := make(map[string]struct{}, len(intercepts))
+	ids := make(map[string]struct{}, len(intercepts))
+	for _, ii := range intercepts {
+		publics[string(ii.Spec.ClientPublicKey)] = struct{}{}
+		ids[ii.Id] = struct{}{}
+	}
+	ik := &tm.interceptKeys
+	ik.Lock()
+	defer ik.Unlock()
+	for public := range ik.private {
+		if _, ok := publics[public]; !ok {
+			if _, pending := ik.pending[public]; !pending {
+				ik.forget(public)
+			}
+		}
+	}
+	for id := range ik.derived {
+		if _, ok := ids[id]; !ok {
+			delete(ik.derived, id)
+		}
+	}
+}
+
+// interceptKey returns the key that encrypts the payload of connections that arrive from the traffic-agent
+// with the given public key for the intercept with the given ID, or nil if no such key can be derived.
+func (tm *TrafficManager) interceptKey(ctx context.Context, interceptID string, agentPublicKey []byte) []byte {
+	var name string
+	var public []byte
+	tm.currentInterceptsLock.Lock()
+	for _, ii := range tm.currentIntercepts {
+		if ii.Id == interceptID {
+			name = ii.Spec.Name
+			public = ii.Spec.ClientPublicKey
+			break
+		}
+	}
+	tm.currentInterceptsLock.Unlock()
+	if len(public) == 0 {
+		return nil
+	}
+
+	ik := &tm.interceptKeys
+	ik.Lock()
+	defer ik.Unlock()
+	if key, ok := ik.derived[interceptID][string(agentPublicKey)]; ok {
+		return key
+	}
+	private, ok := ik.private[string(public)]
+	if !ok {
+		return nil
+	}
+	if _, ok = ik.agents[string(public)][string(agentPublicKey)]; !ok {
+		dlog.Errorf(ctx, "the key of a traffic-agent of intercept %q has not been exchanged with the traffic-agent", name)
+		return nil
+	}
+	key, err := tunnel.InterceptKey(private, agentPublicKey, interceptID)
+	if err != nil {
+		dlog.Errorf(ctx, "unable to derive the key of intercept %q: %v", name, err)
+		return nil
+	}
+	if ik.derived == nil {
+		ik.derived = make(map[string]map[string][]byte)
+	}
+	keys, ok := ik.derived[interceptID]
+	if !ok {
+		keys = make(map[string][]byte)
+		ik.derived[interceptID] = keys
+	}
+	keys[string(agentPublicKey)] = key
+	return key
+}
+
+// hasAgentKey returns true if the given agent public key has been exchanged for the intercept with the given
+// public key.
+func (tm *TrafficManager) hasAgentKey(public, agentPublicKey []byte) bool {
+	ik := &tm.interceptKeys
+	ik.Lock()
+	_, ok := ik.agents[string(public)][string(agentPublicKey)]
+	ik.Unlock()
+	return ok
+}
+
+// exchangeInterceptKey exchanges the given public key of an intercept with the running traffic-agents of the
+// given name in the given namespace, except those that it has been exchanged with already. It returns the
+// number of traffic-agents that the key has been exchanged with, and the last error that prevented an
+// exchange.
+func (tm *TrafficManager) exchangeInterceptKey(ctx context.Context, namespace, agentName string, public []byte) (int, error) {
+	ki := k8sapi.GetK8sInterface(ctx)
+	pods, err := ki.CoreV1().Pods(namespace).List(ctx, meta.ListOptions{FieldSelector: "status.phase=Running"})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	var lastErr error
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		agentID, ok := agentIdentity(pod, agentName)
+		if !ok {
+			continue
+		}
+		ik := &tm.interceptKeys
+		ik.Lock()
+		_, done := ik.exchanged[string(public)][agentID]
+		ik.Unlock()
+		if done {
+			n++
+			continue
+		}
+		agentPublic, err := tm.exchangeKeys(ctx, pod, public)
+		if err != nil {
+			lastErr = fmt.Errorf("unable to exchange the encryption key with the traffic-agent of pod %s.%s: %w", pod.Name, pod.Namespace, err)
+			continue
+		}
+		ik.Lock()
+		if _, ok := ik.private[string(public)]; ok {
+			if ik.agents == nil {
+				ik.agents = make(map[string]map[string]struct{})
+				ik.exchanged = make(map[string]map[string]struct{})
+			}
+			if ik.agents[string(public)] == nil {
+				ik.agents[string(public)] = make(map[string]struct{})
+				ik.exchanged[string(public)] = make(map[string]struct{})
+			}
+			ik.agents[string(public)][string(agentPublic)] = struct{}{}
+			ik.exchanged[string(public)][agentID] = struct{}{}
+		}
+		ik.Unlock()
+		n++
+	}
+	return n, lastErr
+}
+
+// agentIdentity returns the identity of the traffic-agent with the given name in the given pod, or false if the
+// pod has no such agent, or if the agent isn't running.
+func agentIdentity(pod *core.Pod, agentName string) (string, bool) {
+	if pod.DeletionTimestamp != nil {
+		return "", false
+	}
+	found := false
+	for i := range pod.Spec.Containers {
+		if cn := &pod.Spec.Containers[i]; cn.Name == install.AgentContainerName {
+			for _, env := range cn.Env {
+				if env.Name == install.EnvPrefix+"NAME" && env.Value == agentName {
+					found = true
+				}
+			}
+		}
+	}
+	if !found {
+		return "", false
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == install.AgentContainerName && cs.State.Running != nil {
+			return string(pod.UID) + "/" + strconv.Itoa(int(cs.RestartCount)), true
+		}
+	}
+	return "", false
+}
+
+// exchangeKeys sends the given public key to the traffic-agent of the given pod through a port-forward, and
+// returns the public key that the agent responds with.
+func (tm *TrafficManager) exchangeKeys(ctx context.Context, pod *core.Pod, public []byte) ([]byte, error) {
+	ik := &tm.interceptKeys
+	ik.Lock()
+	dial := ik.dial
+	if dial == nil {
+		restConfig, err := tm.ConfigFlags.ToRESTConfig()
+		if err != nil {
+			ik.Unlock()
+			return nil, err
+		}
+		if dial, err = dnet.NewK8sPortForwardDialer(ctx, restConfig, k8sapi.GetK8sInterface(ctx)); err != nil {
+			ik.Unlock()
+			return nil, err
+		}
+		ik.dial = dial
+	}
+	ik.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, keyExchangeTimeout)
+	defer cancel()
+	conn, err := dial(ctx, net.JoinHostPort(pod.Name+"."+pod.Namespace, strconv.Itoa(install.AgentKeyExchangePort)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(keyExchangeTimeout))
+	return tunnel.ExchangePublicKeys(conn, public)
+}
+
+// exchangeInterceptKeys periodically exchanges the keys of the ACTIVE intercepts with end-to-end encryption
+// with the traffic-agents that have yet to receive them, e.g. the agents of pods that were started after the
+// intercept was created. Until then, such an agent can't activate the intercept.
+func (tm *TrafficManager) exchangeInterceptKeys(ctx context.Context) error {
+	ticker := time.NewTicker(keyExchangeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		var specs []*manager.InterceptSpec
+		tm.currentInterceptsLock.Lock()
+		for _, ii := range tm.currentIntercepts {
+			if ii.Disposition == manager.InterceptDispositionType_ACTIVE && len(ii.Spec.ClientPublicKey) > 0 {
+				specs = append(specs, ii.Spec)
+			}
+		}
+		tm.currentInterceptsLock.Unlock()
+		for _, spec := range specs {
+			ik := &tm.interceptKeys
+			ik.Lock()
+			_, ok := ik.private[string(spec.ClientPublicKey)]
+			ik.Unlock()
+			if !ok {
+				continue
+			}
+			if _, err := tm.exchangeInterceptKey(ctx, spec.Namespace, spec.Agent, spec.ClientPublicKey); err != nil {
+				dlog.Debugf(ctx, "intercept %s: %v", spec.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package trafficmgr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+func TestTrafficManager_interceptKeys(t *testing.T) {
+	ctx := context.Background()
+	tm := &TrafficManager{}
+	_, agentPub, err := tunnel.GenerateKeyPair()
+	require.NoError(t, err)
+
+	first, err := tm.newInterceptKey()
+	require.NoError(t, err)
+	ii := &manager.InterceptInfo{
+		Id:   "session:echo",
+		Spec: &manager.InterceptSpec{Name: "echo", ClientPublicKey: first},
+	}
+
+	// A pending key survives a snapshot that doesn't contain its intercept yet
+	tm.pruneInterceptKeys(nil)
+	tm.releaseInterceptKey(first, true)
+	tm.setCurrentIntercepts(ctx, []*manager.InterceptInfo{ii})
+
+	// A key of an agent that hasn't been exchanged with the agent isn't used
+	assert.Nil(t, tm.interceptKey(ctx, ii.Id, agentPub))
+	tm.interceptKeys.agents = map[string]map[string]struct{}{string(first): {string(agentPub): {}}}
+	key := tm.interceptKey(ctx, ii.Id, agentPub)
+	require.NotNil(t, key)
+
+	// A failed retry of the same intercept doesn't affect the key of the existing one
+	second, err := tm.newInterceptKey()
+	require.NoError(t, err)
+	tm.releaseInterceptKey(second, false)
+	tm.pruneInterceptKeys([]*manager.InterceptInfo{ii})
+	tm.interceptKeys.derived = nil
+	assert.Equal(t, key, tm.interceptKey(ctx, ii.Id, agentPub))
+
+	// The key is forgotten when the intercept is removed
+	tm.pruneInterceptKeys(nil)
+	assert.Empty(t, tm.interceptKeys.private)
+	assert.Empty(t, tm.interceptKeys.derived)
+	assert.Empty(t, tm.interceptKeys.agents)
+}
+
+func Test_agentIdentity(t *testing.T) {
+	pod := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{UID: "1234"},
+		Spec: core.PodSpec{Containers: []core.Container{
+			{Name: "echo"},
+			{Name: install.AgentContainerName, Env: []core.EnvVar{{Name: install.EnvPrefix + "NAME", Value: "echo"}}},
+		}},
+		Status: core.PodStatus{ContainerStatuses: []core.ContainerStatus{
+			{Name: "echo", State: core.ContainerState{Running: &core.ContainerStateRunning{}}},
+			{Name: install.AgentContainerName, RestartCount: 2},
+		}},
+	}
+
+	// An agent that isn't running has no identity
+	_, ok := agentIdentity(pod, "echo")
+	assert.False(t, ok)
+
+	pod.Status.ContainerStatuses[1].State.Running = &core.ContainerStateRunning{}
+	id, ok := agentIdentity(pod, "echo")
+	assert.True(t, ok)
+	assert.Equal(t, "1234/2", id)
+
+	// and neither has an agent of another workload
+	_, ok = agentIdentity(pod, "orders")
+	assert.False(t, ok)
+}
+
+func TestTrafficManager_mountPassword(t *testing.T) {
+	tm := &TrafficManager{mountSecret: []byte("secret")}
+	assert.Equal(t, tm.mountPassword("echo"), tm.mountPassword("echo"), "a recreated intercept must get the same password")
+	assert.NotEqual(t, tm.mountPassword("echo"), tm.mountPassword("orders"))
+
+	other := &TrafficManager{mountSecret: []byte("other")}
+	assert.NotEqual(t, tm.mountPassword("echo"), other.mountPassword("echo"))
+}
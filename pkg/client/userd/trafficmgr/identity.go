@@ -0,0 +1,84 @@
+package trafficmgr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"text/template"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/auth"
+)
+
+// identityData is the data that the templates of the intercept.identityHeaders are executed with.
+type identityData struct {
+	// Id, Name, AccountId, and AccountName are from the Ambassador Cloud login, and are empty
+	// when the user isn't logged in.
+	Id          string
+	Name        string
+	AccountId   string
+	AccountName string
+
+	// User and Hostname identify the workstation, e.g. "alice" and "alice-laptop".
+	User     string
+	Hostname string
+
+	// Intercept and Namespace identify the intercept
+	Intercept string
+	Namespace string
+}
+
+// identityHeaders returns the headers declared by intercept.identityHeaders, with values obtained by
+// executing their templates for the given intercept. Headers with an empty value are omitted.
+func (tm *TrafficManager) identityHeaders(c context.Context, spec *manager.InterceptSpec) (map[string]string, error) {
+	templates := client.GetConfig(c).Intercept.IdentityHeaders
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	data := identityData{Intercept: spec.Name, Namespace: spec.Namespace}
+	if i := strings.LastIndexByte(tm.userAndHost, '@'); i >= 0 {
+		data.User, data.Hostname = tm.userAndHost[:i], tm.userAndHost[i+1:]
+	}
+	if tm.getCloudUserInfo != nil {
+		ui, err := tm.getCloudUserInfo(c, false, false)
+		switch {
+		case err == nil:
+			data.Id, data.Name, data.AccountId, data.AccountName = ui.Id, ui.Name, ui.AccountId, ui.AccountName
+		case !errors.Is(err, auth.ErrNotLoggedIn):
+			dlog.Errorf(c, "error getting user info for intercept identity headers: %v", err)
+		}
+	}
+	return renderIdentityHeaders(templates, &data)
+}
+
+func renderIdentityHeaders(templates map[string]string, data *identityData) (map[string]string, error) {
+	headers := make(map[string]string, len(templates))
+	for name, text := range templates {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, errcat.Config.Newf("intercept.identityHeaders: invalid header name %q", name)
+		}
+		tpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, errcat.Config.Newf("intercept.identityHeaders: %v", err)
+		}
+		var buf bytes.Buffer
+		if err = tpl.Execute(&buf, data); err != nil {
+			return nil, errcat.Config.Newf("intercept.identityHeaders: %v", err)
+		}
+		value := strings.TrimSpace(buf.String())
+		if value == "" {
+			continue
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return nil, errcat.Config.Newf("intercept.identityHeaders: invalid value %q for header %q", value, name)
+		}
+		headers[name] = value
+	}
+	return headers, nil
+}
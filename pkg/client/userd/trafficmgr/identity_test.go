@@ -0,0 +1,27 @@
+package trafficmgr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_renderIdentityHeaders(t *testing.T) {
+	data := &identityData{User: "alice", Hostname: "alice-laptop", Intercept: "echo", Namespace: "default"}
+	headers, err := renderIdentityHeaders(map[string]string{
+		"X-Telepresence-Owner":     "{{ .User }}@{{ .Hostname }}",
+		"X-Telepresence-Intercept": "{{ .Intercept }}.{{ .Namespace }}",
+		"X-Telepresence-Account":   "{{ .AccountName }}",
+	}, data)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"X-Telepresence-Owner":     "alice@alice-laptop",
+		"X-Telepresence-Intercept": "echo.default",
+	}, headers)
+
+	_, err = renderIdentityHeaders(map[string]string{"X-Owner": "{{ .Email }}"}, data)
+	assert.Error(t, err)
+	_, err = renderIdentityHeaders(map[string]string{"X Owner": "{{ .User }}"}, data)
+	assert.Error(t, err)
+}
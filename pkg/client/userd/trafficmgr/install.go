@@ -3,6 +3,7 @@ package trafficmgr
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -15,13 +16,16 @@ import (
 	core "k8s.io/api/core/v1"
 	errors2 "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/datawire/dlib/dlog"
 	"github.com/datawire/dlib/dtime"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/k8s"
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/install/helm"
@@ -30,18 +34,41 @@ import (
 
 type installer struct {
 	*k8s.Cluster
+
+	// userAndHost identifies the user in the Kubernetes Events that are recorded on modified workloads.
+	userAndHost string
 }
 
 type Installer interface {
-	EnsureAgent(c context.Context, obj k8sapi.Workload, svcName, portNameOrNumber, agentImageName string, telepresenceAPIPort uint16) (string, string, error)
-	EnsureManager(c context.Context) error
+	EnsureAgent(c context.Context, obj k8sapi.Workload, svcName, portNameOrNumber, containerName, agentImageName string, telepresenceAPIPort uint16) (string, string, error)
+	EnsureManager(c context.Context, managerValues []byte) error
 	RemoveManagerAndAgents(c context.Context, agentsOnly bool, agents []*manager.AgentInfo) error
+	DescribeRemoveManagerAndAgents(c context.Context, agentsOnly bool, agents []*manager.AgentInfo) ([]string, error)
 }
 
 func NewTrafficManagerInstaller(kc *k8s.Cluster) (Installer, error) {
 	return &installer{Cluster: kc}, nil
 }
 
+func newTrafficManagerInstaller(kc *k8s.Cluster, userAndHost string) *installer {
+	return &installer{Cluster: kc, userAndHost: userAndHost}
+}
+
+// eventComponent is the source component of the Kubernetes Events that the client records.
+const eventComponent = "telepresence"
+
+// recordEvent records a Kubernetes Event on a workload that is modified in a way that restarts its pods, so
+// that "kubectl describe" shows why the pods restarted and at whose request. Users aren't always allowed to
+// create Events, so failures are only logged.
+func (ki *installer) recordEvent(c context.Context, obj k8sapi.Object, reason, message string) {
+	if ki.userAndHost != "" {
+		message += ", requested by " + ki.userAndHost
+	}
+	if err := k8sapi.RecordWorkloadEvent(c, obj, eventComponent, core.EventTypeNormal, reason, message); err != nil {
+		dlog.Debugf(c, "unable to record %s event on %s %s.%s: %v", reason, obj.GetKind(), obj.GetName(), obj.GetNamespace(), err)
+	}
+}
+
 const annTelepresenceActions = install.DomainPrefix + "actions"
 
 func managerImageName(ctx context.Context) string {
@@ -76,6 +103,13 @@ func (ki *installer) RemoveManagerAndAgents(c context.Context, agentsOnly bool,
 				return
 			}
 
+			if _, ok := agent.GetPodTemplate().Annotations[install.InjectionEnabledAnnotation]; ok {
+				if err = ki.disableWebhookInjection(c, agent); err != nil {
+					addError(err)
+				}
+				return
+			}
+
 			// Assume that the agent was added using the mutating webhook when no actions
 			// annotation can be found in the workload.
 			ann := agent.GetAnnotations()
@@ -91,6 +125,7 @@ func (ki *installer) RemoveManagerAndAgents(c context.Context, agentsOnly bool,
 				addError(err)
 				return
 			}
+			ki.recordEvent(c, agent, "AgentUninstalled", fmt.Sprintf("Removed the %s, restarting pods", install.AgentContainerName))
 			if err = ki.waitForApply(c, ai.Name, ai.Namespace, agent); err != nil {
 				addError(err)
 			}
@@ -108,11 +143,15 @@ func (ki *installer) RemoveManagerAndAgents(c context.Context, agentsOnly bool,
 
 		// roll all agents installed by webhook
 		webhookWaitGroup := sync.WaitGroup{}
-		webhookWaitGroup.Add(len(webhookAgentChannel))
 		for agent := range webhookAgentChannel {
+			if agent.GetKind() == "Job" {
+				// The agent goes away when the job completes
+				continue
+			}
+			webhookWaitGroup.Add(1)
 			go func(obj k8sapi.Object) {
 				defer webhookWaitGroup.Done()
-				err := ki.rolloutRestart(c, obj)
+				err := ki.rolloutRestart(c, obj, "remove the injected "+install.AgentContainerName)
 				if err != nil {
 					addError(err)
 				}
@@ -137,14 +176,159 @@ func (ki *installer) RemoveManagerAndAgents(c context.Context, agentsOnly bool,
 	return nil
 }
 
-// recreates "kubectl rollout restart <obj>" for obj
-func (ki *installer) rolloutRestart(c context.Context, obj k8sapi.Object) error {
+// DescribeRemoveManagerAndAgents returns a description of each modification or removal that RemoveManagerAndAgents
+// would perform when called with the same arguments, without touching the cluster.
+func (ki *installer) DescribeRemoveManagerAndAgents(c context.Context, agentsOnly bool, agents []*manager.AgentInfo) ([]string, error) {
+	var changes []string
+	for _, ai := range agents {
+		agent, err := k8sapi.GetWorkload(c, ai.Name, ai.Namespace, "")
+		if err != nil {
+			if errors2.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if _, ok := agent.GetPodTemplate().Annotations[install.InjectionEnabledAnnotation]; ok {
+			changes = append(changes, fmt.Sprintf("In %s %s, remove the %s injection annotations from the pod template",
+				agent.GetKind(), nameAndNamespace(agent), install.AgentContainerName))
+			continue
+		}
+		var actions workloadActions
+		ok, err := getAnnotation(agent, &actions)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// The agent was added using the mutating webhook
+			if !agentsOnly {
+				changes = append(changes, fmt.Sprintf("Restart %s %s to remove its injected %s",
+					agent.GetKind(), nameAndNamespace(agent), install.AgentContainerName))
+			}
+			continue
+		}
+		if explanation := explainUndoString(&actions, agent); explanation != "" {
+			changes = append(changes, explanation)
+		}
+		svc, err := k8sapi.GetService(c, actions.ReferencedService, agent.GetNamespace())
+		if err != nil {
+			if errors2.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		var svcActs svcActions
+		if ok, err = getAnnotation(svc, &svcActs); err != nil {
+			return nil, err
+		}
+		if ok {
+			if explanation := explainUndoString(&svcActs, svc); explanation != "" {
+				changes = append(changes, explanation)
+			}
+		}
+	}
+
+	if !agentsOnly {
+		resources, err := helm.TrafficManagerResources(c, ki.ConfigFlags, ki.GetManagerNamespace())
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resources {
+			changes = append(changes, "Remove "+resource)
+		}
+	}
+	return changes, nil
+}
+
+// recreates "kubectl rollout restart <obj>" for obj. The reason is recorded in a Kubernetes Event.
+//
+// Pods of a Job can't be restarted because they run to completion, and the pod template of a Job is
+// immutable. The pods of a CronJob are left alone too, because a change of its job template takes effect
+// when the next Job is created.
+func (ki *installer) rolloutRestart(c context.Context, obj k8sapi.Object, reason string) error {
+	switch obj.GetKind() {
+	case "Job":
+		return errcat.User.Newf("the pods of Job %s can't be restarted to %s; delete and recreate the job instead", nameAndNamespace(obj), reason)
+	case "CronJob":
+		dlog.Infof(c, "The next job of CronJob %s will be created with the changes needed to %s", nameAndNamespace(obj), reason)
+		return nil
+	}
 	restartAnnotation := fmt.Sprintf(
-		`{"spec": {"template": {"metadata": {"annotations": {"%srestartedAt": "%s"}}}}}`,
-		install.DomainPrefix,
+		`{"spec": {"template": {"metadata": {"annotations": {"%s": "%s"}}}}}`,
+		install.RestartedAtAnnotation,
 		time.Now().Format(time.RFC3339),
 	)
-	return obj.Patch(c, types.StrategicMergePatchType, []byte(restartAnnotation))
+	if err := obj.Patch(c, types.StrategicMergePatchType, []byte(restartAnnotation)); err != nil {
+		return err
+	}
+	ki.recordEvent(c, obj, "PodsRestarted", "Restarted pods to "+reason)
+	return nil
+}
+
+// enableWebhookInjection annotates the pod template of the given workload so that the traffic-agent
+// is injected by the mutating webhook when the pods are recreated. Unlike addAgentToWorkload, this
+// leaves the containers of the workload and the ports of its service untouched, so GitOps controllers
+// can be told to ignore the change.
+func (ki *installer) enableWebhookInjection(c context.Context, obj k8sapi.Workload, svcName, portNameOrNumber, containerName string) (*core.Service, error) {
+	name := obj.GetName()
+	namespace := obj.GetNamespace()
+	svc, err := install.FindMatchingService(c, portNameOrNumber, svcName, namespace, obj.GetPodTemplate().Labels)
+	if err != nil {
+		return nil, err
+	}
+	ann := map[string]string{
+		install.InjectAnnotation:           "enabled",
+		install.ServiceNameAnnotation:      svc.Name,
+		install.InjectionEnabledAnnotation: "true",
+	}
+	if portNameOrNumber != "" {
+		ann[install.ServicePortAnnotation] = portNameOrNumber
+	}
+	if containerName != "" {
+		ann[install.ContainerNameAnnotation] = containerName
+	}
+	dlog.Infof(c, "Enabling injection of %s into %s %s.%s", install.AgentContainerName, obj.GetKind(), name, namespace)
+	if err = patchTemplateAnnotations(c, obj, ann); err != nil {
+		return nil, err
+	}
+	ki.recordEvent(c, obj, "AgentInjectionEnabled", fmt.Sprintf("Enabled injection of the %s, restarting pods", install.AgentContainerName))
+	if err = ki.waitForApply(c, name, namespace, obj); err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+// disableWebhookInjection removes the annotations added by enableWebhookInjection.
+func (ki *installer) disableWebhookInjection(c context.Context, obj k8sapi.Workload) error {
+	ann := map[string]interface{}{
+		install.InjectAnnotation:           nil,
+		install.ServiceNameAnnotation:      nil,
+		install.ServicePortAnnotation:      nil,
+		install.ContainerNameAnnotation:    nil,
+		install.InjectionEnabledAnnotation: nil,
+	}
+	if err := patchTemplateAnnotations(c, obj, ann); err != nil {
+		return err
+	}
+	return ki.waitForApply(c, obj.GetName(), obj.GetNamespace(), obj)
+}
+
+// patchTemplateAnnotations merges the given annotations into the annotations of the pod template of
+// the given workload. A nil value removes the annotation.
+func patchTemplateAnnotations(c context.Context, obj k8sapi.Workload, annotations interface{}) error {
+	var patchMap interface{} = map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	}
+	path := k8sapi.PodTemplatePath(obj.GetKind())
+	for i := len(path) - 1; i >= 0; i-- {
+		patchMap = map[string]interface{}{path[i]: patchMap}
+	}
+	patch, err := json.Marshal(patchMap)
+	if err != nil {
+		return err
+	}
+	return obj.Patch(c, types.StrategicMergePatchType, patch)
 }
 
 // Finds the Referenced Service in an objects' annotations
@@ -231,7 +415,7 @@ func (ki *installer) getSvcForInjectedPod(
 	if err != nil {
 		if webhookInjected {
 			dlog.Warnf(c, "Error finding pod for %s, rolling and proceeding anyway: %v", name, err)
-			err = ki.rolloutRestart(c, obj)
+			err = ki.rolloutRestart(c, obj, "inject the "+install.AgentContainerName)
 			if err != nil {
 				return nil, err
 			}
@@ -252,7 +436,7 @@ func (ki *installer) getSvcForInjectedPod(
 	}
 	if roll {
 		if webhookInjected {
-			err = ki.rolloutRestart(c, obj)
+			err = ki.rolloutRestart(c, obj, "inject the "+install.AgentContainerName)
 			if err != nil {
 				return nil, err
 			}
@@ -279,8 +463,11 @@ func useAutoInstall(podTpl *core.PodTemplateSpec) (bool, error) {
 // is installed alongside the proper workload. In doing that, it also ensures that
 // the workload is referenced by a service. Lastly, it returns the service UID
 // associated with the workload since this is where that correlation is made.
+//
+// The containerName, when not empty, names the container whose environment, volume mounts, and port the agent
+// uses in a pod with multiple containers.
 func (ki *installer) EnsureAgent(c context.Context, obj k8sapi.Workload,
-	svcName, portNameOrNumber, agentImageName string, telepresenceAPIPort uint16) (string, string, error) {
+	svcName, portNameOrNumber, containerName, agentImageName string, telepresenceAPIPort uint16) (string, string, error) {
 	podTemplate := obj.GetPodTemplate()
 	kind := obj.GetKind()
 	name := obj.GetName()
@@ -310,7 +497,29 @@ func (ki *installer) EnsureAgent(c context.Context, obj k8sapi.Workload,
 		}
 	}
 
-	if err := checkSvcSame(c, obj, svcName, portNameOrNumber); err != nil {
+	if agentContainer == nil && kind == "Job" {
+		// The pod template of a Job is immutable, so its agent must be injected by the mutating webhook.
+		return "", "", errcat.User.Newf("the pod template of Job %s.%s can't be modified; add the annotation %s: enabled to it and recreate the job",
+			name, namespace, install.InjectAnnotation)
+	}
+
+	// The agent of a CronJob is always injected by the mutating webhook, because the pods of its jobs must be
+	// configured so that the traffic-agent exits when the job's containers are done.
+	if agentContainer == nil && (client.GetConfig(c).Intercept.AnnotationOnly || kind == "CronJob") {
+		svc, err := ki.enableWebhookInjection(c, obj, svcName, portNameOrNumber, containerName)
+		if err != nil {
+			return "", "", err
+		}
+		return string(svc.GetUID()), kind, nil
+	}
+
+	err = checkSvcSame(c, obj, svcName, portNameOrNumber)
+	if err == nil && agentContainer != nil && containerName != "" {
+		if cn := install.AgentAppContainerName(agentContainer); cn != containerName {
+			err = k8sapi.ObjErrorf(obj, "container changed from %q to %q", cn, containerName)
+		}
+	}
+	if err != nil {
 		msg := fmt.Sprintf(
 			`%s already being used for intercept with a different service
 configuration. To intercept this with your new configuration, please use
@@ -321,6 +530,7 @@ already exist for this service`, kind, name)
 
 	update := true
 	updateSvc := false
+	var eventReason, eventMessage string
 	switch {
 	case agentContainer == nil:
 		dlog.Infof(c, "no agent found for %s %s.%s", kind, name, namespace)
@@ -331,10 +541,11 @@ already exist for this service`, kind, name)
 		if err != nil {
 			return "", "", err
 		}
-		obj, svc, updateSvc, err = addAgentToWorkload(c, portNameOrNumber, agentImageName, ki.GetManagerNamespace(), telepresenceAPIPort, obj, matchingSvc)
+		obj, svc, updateSvc, err = addAgentToWorkload(c, portNameOrNumber, containerName, agentImageName, ki.GetManagerNamespace(), telepresenceAPIPort, obj, matchingSvc)
 		if err != nil {
 			return "", "", err
 		}
+		eventReason, eventMessage = "AgentInstalled", fmt.Sprintf("Added the %s, restarting pods", install.AgentContainerName)
 	case agentContainer.Image != agentImageName:
 		var actions workloadActions
 		ok, err := getAnnotation(obj, &actions)
@@ -354,6 +565,7 @@ already exist for this service`, kind, name)
 		aaa.AddTrafficAgent.ImageName = agentImageName
 		agentContainer.Image = agentImageName
 		explainDo(c, aaa, obj)
+		eventReason, eventMessage = "AgentUpgraded", fmt.Sprintf("Changed the image of the %s to %s, restarting pods", install.AgentContainerName, agentImageName)
 	default:
 		dlog.Debugf(c, "%s %s.%s already has an installed and up-to-date agent", kind, name, namespace)
 		update = false
@@ -363,6 +575,7 @@ already exist for this service`, kind, name)
 		if err = obj.Update(c); err != nil {
 			return "", "", err
 		}
+		ki.recordEvent(c, obj, eventReason, eventMessage)
 		if updateSvc {
 			if err := svc.Update(c); err != nil {
 				return "", "", err
@@ -554,6 +767,7 @@ func undoServiceMods(c context.Context, svc k8sapi.Object) error {
 func addAgentToWorkload(
 	c context.Context,
 	portNameOrNumber string,
+	containerName string,
 	agentImageName string,
 	trafficManagerNamespace string,
 	telepresenceAPIPort uint16,
@@ -565,7 +779,10 @@ func addAgentToWorkload(
 	error,
 ) {
 	podTemplate := object.GetPodTemplate()
-	cns := podTemplate.Spec.Containers
+	cns, err := install.SelectContainers(podTemplate.Spec.Containers, containerName)
+	if err != nil {
+		return nil, nil, false, k8sapi.ObjErrorf(object, err.Error())
+	}
 	servicePort, container, containerPortIndex, err := install.FindMatchingPort(cns, portNameOrNumber, matchingService)
 	if err != nil {
 		return nil, nil, false, k8sapi.ObjErrorf(object, err.Error())
@@ -627,14 +844,29 @@ func addAgentToWorkload(
 		containerPort.Name = fmt.Sprintf("tx-%d", containerPort.Number)
 	}
 
+	// The ports that the traffic-agent listens to must not collide with ports that are used by other containers
+	// in the pod, or the agent will end up in a CrashLoopBackOff.
+	agentPortNumber := int32(install.DefaultAgentPort)
+	apiPortNumber := int32(telepresenceAPIPort)
+	if remapped := install.ResolvePortConflicts(&podTemplate.Spec, []int32{int32(containerPort.Number)}, &agentPortNumber, &apiPortNumber); len(remapped) > 0 {
+		dlog.Infof(c, "%s %s already uses some of the %s ports, remapped using %s",
+			object.GetKind(), nameAndNamespace(object), install.AgentContainerName, install.PortMappingString(remapped))
+	}
+	var recordedAgentPort uint16
+	if agentPortNumber != install.DefaultAgentPort {
+		recordedAgentPort = uint16(agentPortNumber)
+	}
+	telepresenceAPIPort = uint16(apiPortNumber)
+
 	var initContainerAction *addInitContainerAction
 	setGID := false
 	if matchingService.Spec.ClusterIP == "None" {
 		setGID = true
 		initContainerAction = &addInitContainerAction{
-			AppPortProto:  containerPort.Protocol,
-			AppPortNumber: containerPort.Number,
-			ImageName:     agentImageName,
+			AppPortProto:    containerPort.Protocol,
+			AppPortNumber:   containerPort.Number,
+			ImageName:       agentImageName,
+			AgentPortNumber: recordedAgentPort,
 		}
 	}
 
@@ -657,11 +889,13 @@ func addAgentToWorkload(
 			containerName:           container.Name,
 			trafficManagerNamespace: trafficManagerNamespace,
 			setGID:                  setGID,
+			logFormat:               client.GetConfig(c).LogLevels.LogFormat,
 			ContainerPortName:       containerPort.Name,
 			ContainerPortProto:      containerPort.Protocol,
 			ContainerPortAppProto:   k8sapi.GetAppProto(c, client.GetConfig(c).Intercept.AppProtocolStrategy, servicePort),
 			ContainerPortNumber:     containerPort.Number,
 			APIPortNumber:           telepresenceAPIPort,
+			AgentPortNumber:         recordedAgentPort,
 			ImageName:               agentImageName,
 		},
 		AddTPEnvironmentAction: addTPEnvAction,
@@ -743,6 +977,80 @@ func addAgentToWorkload(
 	return object, svc, updateService, nil
 }
 
-func (ki *installer) EnsureManager(c context.Context) error {
-	return helm.EnsureTrafficManager(c, ki.ConfigFlags, ki.GetManagerNamespace())
+// AddManualAgent makes the same modifications to the given workload and service as an automatic install of the
+// traffic-agent does, but marks the pod template as manually injected instead of recording the modifications, so
+// that the result can be kept in a manifest. The workload and the service are modified in place. The returned
+// bool is true when the service was modified.
+func AddManualAgent(
+	c context.Context,
+	object k8sapi.Workload,
+	svc *core.Service,
+	portNameOrNumber,
+	containerName,
+	agentImageName,
+	trafficManagerNamespace string,
+	telepresenceAPIPort uint16,
+) (bool, error) {
+	podTemplate := object.GetPodTemplate()
+	for i := range podTemplate.Spec.Containers {
+		if podTemplate.Spec.Containers[i].Name == install.AgentContainerName {
+			return false, k8sapi.ObjErrorf(object, "already has a %s", install.AgentContainerName)
+		}
+	}
+	if len(svc.Spec.Selector) == 0 || !labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(podTemplate.Labels)) {
+		return false, k8sapi.ObjErrorf(object, "pod template labels don't match the selector of service %s", svc.Name)
+	}
+	_, _, updateSvc, err := addAgentToWorkload(c, portNameOrNumber, containerName, agentImageName, trafficManagerNamespace, telepresenceAPIPort, object, svc)
+	if err != nil {
+		return false, err
+	}
+	mObj := object.(meta.ObjectMetaAccessor).GetObjectMeta()
+	annotations := mObj.GetAnnotations()
+	delete(annotations, annTelepresenceActions)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	mObj.SetAnnotations(annotations)
+	if updateSvc {
+		delete(svc.Annotations, annTelepresenceActions)
+		if len(svc.Annotations) == 0 {
+			svc.Annotations = nil
+		}
+	}
+	if podTemplate.Annotations == nil {
+		podTemplate.Annotations = make(map[string]string)
+	}
+	podTemplate.Annotations[install.ManualInjectAnnotation] = "true"
+	return updateSvc, nil
+}
+
+// EnsureManager returns an error that tells the user how to install the traffic-manager when there's
+// no traffic-manager in the manager namespace. A missing traffic-manager is installed only when the
+// user explicitly provided Helm values in JSON form. It is never upgraded implicitly. That's done using
+// "telepresence helm upgrade".
+func (ki *installer) EnsureManager(c context.Context, managerValues []byte) error {
+	namespace := ki.GetManagerNamespace()
+	_, err := k8sapi.GetK8sInterface(c).CoreV1().Services(namespace).Get(c, install.ManagerAppName, meta.GetOptions{})
+	switch {
+	case err == nil:
+		if managerValues != nil {
+			dlog.Infof(c, "Traffic Manager already installed in namespace %s, ignoring the given Helm values", namespace)
+		}
+		return nil
+	case errors2.IsNotFound(err):
+		if managerValues != nil {
+			reportProgress(c, rpc.ProgressEvent_MANAGER_INSTALL, false, "Installing the traffic-manager in namespace %s", namespace)
+			if err = helm.InstallTrafficManager(c, ki.ConfigFlags, namespace, &helm.Request{ValuesJSON: managerValues}); err != nil {
+				return err
+			}
+			reportProgress(c, rpc.ProgressEvent_MANAGER_INSTALL, true, "Installed the traffic-manager in namespace %s", namespace)
+			return nil
+		}
+		return errcat.User.Newf(`no traffic-manager found in namespace %s, use "telepresence helm install" to install one`, namespace)
+	default:
+		// This could be caused by missing permissions. A missing traffic-manager will be detected by a
+		// subsequent error anyway.
+		dlog.Errorf(c, "Unable to look for the traffic-manager service: %v. Assuming it's there and continuing...", err)
+		return nil
+	}
 }
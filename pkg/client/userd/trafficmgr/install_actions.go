@@ -18,6 +18,7 @@ import (
 	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+	"github.com/telepresenceio/telepresence/v2/pkg/log"
 )
 
 // Public interface-y pieces ///////////////////////////////////////////////////
@@ -75,14 +76,20 @@ func explainDo(c context.Context, a completeAction, obj k8sapi.Object) {
 }
 
 func explainUndo(c context.Context, a completeAction, obj k8sapi.Object) {
+	if explanation := explainUndoString(a, obj); explanation != "" {
+		dlog.Info(c, explanation+".")
+	}
+}
+
+// explainUndoString returns an explanation of what undoing the given action does to the given object, or an
+// empty string when there's nothing to explain.
+func explainUndoString(a completeAction, obj k8sapi.Object) string {
 	var buf strings.Builder
 	a.ExplainUndo(obj, &buf)
-	if buf.Len() > 0 {
-		dlog.Info(c, fmt.Sprintf("In %s %s, %s.",
-			obj.GetKind(),
-			nameAndNamespace(obj),
-			buf.String()))
+	if buf.Len() == 0 {
+		return ""
 	}
+	return fmt.Sprintf("In %s %s, %s", obj.GetKind(), nameAndNamespace(obj), buf.String())
 }
 
 // multiAction /////////////////////////////////////////////////////////////////
@@ -347,6 +354,10 @@ type addTrafficAgentAction struct {
 	ContainerPortNumber   uint16        `json:"app_port"`
 	APIPortNumber         uint16        `json:"api_port,omitempty"`
 
+	// The port that the agent listens to. Zero means install.DefaultAgentPort. A different port is
+	// used when the default port is already used in the pod.
+	AgentPortNumber uint16 `json:"agent_port,omitempty"`
+
 	// The image name of the agent to add
 	ImageName string `json:"image_name"`
 
@@ -358,6 +369,9 @@ type addTrafficAgentAction struct {
 
 	// Whether the container's GID should be set explicitly.
 	setGID bool
+
+	// The log format of the agent. Empty means the default format.
+	logFormat string
 }
 
 var _ partialAction = (*addTrafficAgentAction)(nil)
@@ -386,22 +400,25 @@ func (ata *addTrafficAgentAction) Do(obj k8sapi.Object) error {
 	_ = ata.dropAgentAnnotationVolume(obj, tplSpec)
 
 	tplSpec.Spec.Volumes = append(tplSpec.Spec.Volumes, install.AgentVolume())
-	tplSpec.Spec.Containers = append(tplSpec.Spec.Containers,
-		install.AgentContainer(
-			obj.(meta.ObjectMetaAccessor).GetObjectMeta().GetName(),
-			ata.ImageName,
-			appContainer,
-			core.ContainerPort{
-				Name:          ata.ContainerPortName,
-				Protocol:      ata.ContainerPortProto,
-				ContainerPort: 9900,
-			},
-			int(ata.ContainerPortNumber),
-			ata.ContainerPortAppProto,
-			int(ata.APIPortNumber),
-			ata.trafficManagerNamespace,
-			ata.setGID,
-		))
+	agentContainer := install.AgentContainer(
+		obj.(meta.ObjectMetaAccessor).GetObjectMeta().GetName(),
+		ata.ImageName,
+		appContainer,
+		core.ContainerPort{
+			Name:          ata.ContainerPortName,
+			Protocol:      ata.ContainerPortProto,
+			ContainerPort: agentPort(ata.AgentPortNumber),
+		},
+		int(ata.ContainerPortNumber),
+		ata.ContainerPortAppProto,
+		int(ata.APIPortNumber),
+		ata.trafficManagerNamespace,
+		ata.setGID,
+	)
+	if ata.logFormat == log.FormatJSON {
+		agentContainer.Env = append(agentContainer.Env, install.AgentLogFormatEnv(ata.logFormat))
+	}
+	tplSpec.Spec.Containers = append(tplSpec.Spec.Containers, agentContainer)
 	return nil
 }
 
@@ -469,6 +486,14 @@ func (ata *addTrafficAgentAction) Undo(ver semver.Version, obj k8sapi.Object) er
 	return nil
 }
 
+// agentPort returns the given port, or install.DefaultAgentPort when the port is zero.
+func agentPort(port uint16) int32 {
+	if port == 0 {
+		return install.DefaultAgentPort
+	}
+	return int32(port)
+}
+
 // addInitContainerAction ///////////////////////////////////////////////////////
 
 // addInitContainerAction is a partialAction that adds a traffic-agent to the set of containers in a
@@ -480,6 +505,9 @@ type addInitContainerAction struct {
 
 	// The image name of the initContainer to add -- usually the same as the traffic agent image that will be used
 	ImageName string `json:"image_name"`
+
+	// The port that the agent listens to. Zero means install.DefaultAgentPort.
+	AgentPortNumber uint16 `json:"agent_port,omitempty"`
 }
 
 var _ partialAction = (*addInitContainerAction)(nil)
@@ -492,7 +520,7 @@ func (ica *addInitContainerAction) Do(obj k8sapi.Object) error {
 	tplSpec.Spec.InitContainers = append(tplSpec.Spec.InitContainers, install.InitContainer(
 		ica.ImageName,
 		core.ContainerPort{
-			ContainerPort: 9900,
+			ContainerPort: agentPort(ica.AgentPortNumber),
 			Protocol:      ica.AppPortProto,
 		},
 		int(ica.AppPortNumber),
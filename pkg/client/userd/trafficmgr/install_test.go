@@ -12,14 +12,19 @@ import (
 	"text/template"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	apps "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
 	"sigs.k8s.io/yaml"
 
 	"github.com/datawire/dlib/dlog"
 	"github.com/datawire/dtest"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
 	"github.com/telepresenceio/telepresence/v2/pkg/version"
 )
@@ -123,6 +128,7 @@ func TestAddAgentToWorkload(t *testing.T) {
 				}
 				actualWrk, actualSvc, _, actualErr := addAgentToWorkload(ctx,
 					tc.InputPortName,
+					"",
 					managerImageName(ctx), // ignore extensions
 					env.ManagerNamespace,
 					apiPort,
@@ -279,3 +285,99 @@ func loadFile(filename, inputVersion string) (workload k8sapi.Workload, service
 
 	return workload, dat.Service, dat.InterceptPort, nil
 }
+
+func TestRolloutRestartRecordsEvent(t *testing.T) {
+	dep := &apps.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "echo", Namespace: "default", UID: "echo-uid"}}
+	ki := fake.NewSimpleClientset(dep)
+	ctx := k8sapi.WithK8sInterface(dlog.NewTestContext(t, false), ki)
+
+	inst := &installer{userAndHost: "alice@laptop"}
+	require.NoError(t, inst.rolloutRestart(ctx, k8sapi.Deployment(dep), "inject the traffic-agent"))
+
+	evs, err := ki.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, evs.Items, 1)
+	ev := evs.Items[0]
+	assert.Equal(t, "PodsRestarted", ev.Reason)
+	assert.Equal(t, "Restarted pods to inject the traffic-agent, requested by alice@laptop", ev.Message)
+	assert.Equal(t, eventComponent, ev.Source.Component)
+}
+
+func TestJobWorkloads(t *testing.T) {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate", Namespace: "default"}}
+	cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "default"}}
+	ki := fake.NewSimpleClientset(job, cronJob)
+	ctx := k8sapi.WithK8sInterface(dlog.NewTestContext(t, false), ki)
+	inst := &installer{userAndHost: "alice@laptop"}
+
+	// The pods of a Job can't be restarted, and the pods of a CronJob are left alone
+	assert.Error(t, inst.rolloutRestart(ctx, k8sapi.Job(job), "inject the traffic-agent"))
+	require.NoError(t, inst.rolloutRestart(ctx, k8sapi.CronJob(cronJob), "inject the traffic-agent"))
+
+	// The annotations of a CronJob are added to the pod template of its job template
+	wl := k8sapi.CronJob(cronJob)
+	require.NoError(t, patchTemplateAnnotations(ctx, wl, map[string]string{install.InjectAnnotation: "enabled"}))
+	assert.Equal(t, "enabled", wl.GetPodTemplate().Annotations[install.InjectAnnotation])
+}
+
+func TestAddManualAgent(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	cfg := client.GetDefaultConfig(ctx)
+	ctx = client.WithConfig(ctx, &cfg)
+
+	labels := map[string]string{"app": "echo"}
+	dep := &apps.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "echo", Namespace: "default"},
+		Spec: apps.DeploymentSpec{
+			Template: core.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: core.PodSpec{Containers: []core.Container{{
+					Name:  "echo",
+					Image: "jmalloc/echo-server",
+					Ports: []core.ContainerPort{{ContainerPort: 8080}},
+				}}},
+			},
+		},
+	}
+	svc := &core.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "echo", Namespace: "default"},
+		Spec: core.ServiceSpec{
+			Selector: labels,
+			Ports:    []core.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}},
+		},
+	}
+
+	// The service must select the pods of the workload
+	other := &core.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"},
+		Spec:       core.ServiceSpec{Selector: map[string]string{"app": "other"}, Ports: svc.Spec.Ports},
+	}
+	_, err := AddManualAgent(ctx, k8sapi.Deployment(dep.DeepCopy()), other, "", "", "docker.io/datawire/tel2:2.5.0", "ambassador", 0)
+	assert.Error(t, err)
+
+	wl := k8sapi.Deployment(dep)
+	svcModified, err := AddManualAgent(ctx, wl, svc, "", "", "docker.io/datawire/tel2:2.5.0", "ambassador", 0)
+	require.NoError(t, err)
+	assert.True(t, svcModified)
+
+	// The pod template is annotated as manually injected, and the actions aren't recorded
+	tpl := wl.GetPodTemplate()
+	assert.Equal(t, "true", tpl.Annotations[install.ManualInjectAnnotation])
+	assert.Empty(t, dep.Annotations)
+	assert.Empty(t, svc.Annotations)
+
+	require.Len(t, tpl.Spec.Containers, 2)
+	agent := tpl.Spec.Containers[1]
+	assert.Equal(t, install.AgentContainerName, agent.Name)
+	require.Len(t, tpl.Spec.Volumes, 1)
+	assert.Equal(t, install.AgentAnnotationVolumeName, tpl.Spec.Volumes[0].Name)
+
+	// The service refers to the agent's port by name
+	require.Len(t, agent.Ports, 1)
+	assert.Equal(t, intstr.FromString(agent.Ports[0].Name), svc.Spec.Ports[0].TargetPort)
+
+	// The agent can't be added twice
+	_, err = AddManualAgent(ctx, wl, svc, "", "", "docker.io/datawire/tel2:2.5.0", "ambassador", 0)
+	assert.Error(t, err)
+}
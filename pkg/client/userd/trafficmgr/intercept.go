@@ -2,6 +2,10 @@ package trafficmgr
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +13,7 @@ import (
 	"net/http"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,7 +25,9 @@ import (
 	"google.golang.org/protobuf/proto"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 
+	"github.com/datawire/dlib/dcontext"
 	"github.com/datawire/dlib/dexec"
 	"github.com/datawire/dlib/dgroup"
 	"github.com/datawire/dlib/dlog"
@@ -30,6 +37,9 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/a8rcloud"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/recording"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/remotefs"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/sftpfilter"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/auth"
 	"github.com/telepresenceio/telepresence/v2/pkg/dpipe"
 	"github.com/telepresenceio/telepresence/v2/pkg/forwarder"
@@ -46,7 +56,14 @@ type forwardKey struct {
 
 type mountForward struct {
 	forwardKey
-	SftpPort int32
+	SftpPort   int32
+	WebdavPort int32
+}
+
+// mountOptions are the options of a remote mount that are given when the intercept is created.
+type mountOptions struct {
+	readOnly bool
+	filter   *sftpfilter.Filter
 }
 
 type portForward struct {
@@ -87,7 +104,7 @@ func (lpf livePortForwards) start(ctx context.Context, tm *TrafficManager, ii *m
 		if _, isLive := lpf.live[fk]; !isLive {
 			pfCtx, pfCancel := context.WithCancel(ctx)
 			livePortForward := &livePortForward{cancel: pfCancel}
-			tm.startForwards(pfCtx, &livePortForward.wg, fk, ii.SftpPort, ii.Spec.ExtraPorts)
+			tm.startForwards(pfCtx, &livePortForward.wg, mountForward{fk, ii.SftpPort, ii.WebdavPort}, ii.Spec.ExtraPorts)
 			dlog.Debugf(ctx, "Started forward for %+v", fk)
 			lpf.live[fk] = livePortForward
 		}
@@ -123,9 +140,14 @@ func (tm *TrafficManager) reconcileMountPoints(ctx context.Context, existingInte
 
 	for _, key := range mountsToDelete {
 		if _, loaded := tm.mountPoints.LoadAndDelete(key); loaded {
+			tm.mountOptions.Delete(key)
 			// Execute the removal in a separate go-routine so that we don't hang the daemon in case
 			// the removal hangs on a "resource busy".
 			go func(mountPoint string) {
+				if runtime.GOOS == "windows" {
+					// The mount point is a drive letter, which disappears with the mount
+					return
+				}
 				if runtime.GOOS == "darwin" {
 					//  macFUSE will sometimes not unmount in a timely manner so we do this to avoid "resource busy" and
 					//  "Device not configured" errors.
@@ -178,6 +200,7 @@ func (tm *TrafficManager) workerPortForwardIntercepts(ctx context.Context) error
 				intercepts = snapshot.Intercepts
 			}
 			tm.setCurrentIntercepts(ctx, intercepts)
+			tm.pruneInterceptKeys(intercepts)
 
 			// allNames contains the names of all intercepts, irrespective of their status
 			allNames := make(map[string]struct{})
@@ -187,14 +210,10 @@ func (tm *TrafficManager) workerPortForwardIntercepts(ctx context.Context) error
 			for _, intercept := range intercepts {
 				allNames[intercept.Spec.Name] = struct{}{}
 
-				var iceptError error
-				switch intercept.Disposition {
-				case manager.InterceptDispositionType_ACTIVE:
-				case manager.InterceptDispositionType_WAITING:
+				if intercept.Disposition == manager.InterceptDispositionType_WAITING {
 					continue
-				default:
-					iceptError = fmt.Errorf("intercept in error state %v: %v", intercept.Disposition, intercept.Message)
 				}
+				iceptError := interceptStateError(intercept)
 
 				// Notify waiters for active intercepts
 				if chUt, loaded := tm.activeInterceptsWaiters.LoadAndDelete(intercept.Spec.Name); loaded {
@@ -231,6 +250,42 @@ func (tm *TrafficManager) workerPortForwardIntercepts(ctx context.Context) error
 	return nil
 }
 
+// interceptStateError returns the error, if any, of an intercept that is no longer WAITING.
+func interceptStateError(ii *manager.InterceptInfo) error {
+	switch ii.Disposition {
+	case manager.InterceptDispositionType_ACTIVE:
+		if len(ii.Spec.ClientPublicKey) > 0 && len(ii.AgentPublicKey) == 0 {
+			// The agent or the traffic-manager is too old to know about end-to-end encryption
+			return errcat.User.New("the traffic-agent does not support end-to-end encryption")
+		}
+		if ii.Spec.Mirror && !ii.Mirrored {
+			// The agent or the traffic-manager is too old to know about mirroring
+			return errcat.User.New("the traffic-agent does not support mirroring")
+		}
+		if ii.Spec.TrafficPercentage != 0 && ii.TrafficPercentage != ii.Spec.TrafficPercentage {
+			// The agent or the traffic-manager is too old to know about traffic percentages
+			return errcat.User.New("the traffic-agent does not support traffic percentages")
+		}
+		return nil
+	default:
+		return fmt.Errorf("intercept in error state %v: %v", ii.Disposition, ii.Message)
+	}
+}
+
+// interceptByIdempotencyKey returns the intercept in the current snapshot that was created with the given
+// idempotency key, or nil if no such intercept exists.
+func (tm *TrafficManager) interceptByIdempotencyKey(key string) *manager.InterceptInfo {
+	if key == "" {
+		return nil
+	}
+	for _, ii := range tm.getCurrentIntercepts() {
+		if ii.IdempotencyKey == key {
+			return ii
+		}
+	}
+	return nil
+}
+
 // getCurrentIntercepts returns a copy of the current intercept snapshot amended with
 // the local filesystem mount point.
 func (tm *TrafficManager) getCurrentIntercepts() []*manager.InterceptInfo {
@@ -263,6 +318,46 @@ func (tm *TrafficManager) setCurrentIntercepts(ctx context.Context, intercepts [
 	tm.currentInterceptsLock.Unlock()
 }
 
+// resolveWorkloadSelector sets the agent and workload kind of the spec of the given request from the one workload
+// whose pod template labels match the workload selector of the request. A result describing the error is returned
+// when the selector is invalid or when it doesn't match exactly one workload.
+func (tm *TrafficManager) resolveWorkloadSelector(c context.Context, ir *rpc.CreateInterceptRequest) *rpc.InterceptResult {
+	spec := ir.Spec
+	selector, err := labels.Parse(ir.WorkloadSelector)
+	if err != nil {
+		return interceptError(rpc.InterceptError_TRAFFIC_MANAGER_ERROR,
+			errcat.User.Newf("invalid selector %q: %v", ir.WorkloadSelector, err))
+	}
+	wls, err := tm.wlWatcher.findWorkloadsForSelector(c, spec.Namespace, selector)
+	if err != nil {
+		return interceptError(rpc.InterceptError_TRAFFIC_MANAGER_ERROR, err)
+	}
+	switch len(wls) {
+	case 0:
+		return interceptError(rpc.InterceptError_NO_ACCEPTABLE_WORKLOAD,
+			errcat.User.Newf("selector %q in namespace %s", ir.WorkloadSelector, spec.Namespace))
+	case 1:
+		spec.Agent = wls[0].GetName()
+		spec.WorkloadKind = wls[0].GetKind()
+		dlog.Debugf(c, "selector %q matches %s %s.%s", ir.WorkloadSelector, spec.WorkloadKind, spec.Agent, spec.Namespace)
+		return nil
+	default:
+		matches := make([]*manager.AgentInfo, len(wls))
+		for i, wl := range wls {
+			matches[i] = &manager.AgentInfo{Name: wl.GetName(), Namespace: wl.GetNamespace()}
+		}
+		data, err := json.Marshal(matches)
+		if err != nil {
+			return interceptError(rpc.InterceptError_TRAFFIC_MANAGER_ERROR, err)
+		}
+		return &rpc.InterceptResult{
+			Error:         rpc.InterceptError_AMBIGUOUS_MATCH,
+			ErrorText:     string(data),
+			ErrorCategory: int32(errcat.User),
+		}
+	}
+}
+
 func interceptError(tp rpc.InterceptError, err error) *rpc.InterceptResult {
 	return &rpc.InterceptResult{
 		Error:         tp,
@@ -281,7 +376,11 @@ func (tm *TrafficManager) CanIntercept(c context.Context, ir *rpc.CreateIntercep
 	spec.Namespace = tm.ActualNamespace(spec.Namespace)
 	if spec.Namespace == "" {
 		// namespace is not currently mapped
-		return interceptError(rpc.InterceptError_NO_ACCEPTABLE_WORKLOAD, errcat.User.Newf(ir.Spec.Agent)), nil
+		target := spec.Agent
+		if target == "" && ir.WorkloadSelector != "" {
+			target = fmt.Sprintf("selector %q", ir.WorkloadSelector)
+		}
+		return interceptError(rpc.InterceptError_NO_ACCEPTABLE_WORKLOAD, errcat.User.New(target)), nil
 	}
 
 	if _, inUse := tm.localIntercepts[spec.Name]; inUse {
@@ -290,6 +389,10 @@ func (tm *TrafficManager) CanIntercept(c context.Context, ir *rpc.CreateIntercep
 
 	for _, iCept := range tm.getCurrentIntercepts() {
 		if iCept.Spec.Name == spec.Name {
+			if ir.IdempotencyKey != "" && iCept.IdempotencyKey == ir.IdempotencyKey {
+				// A retry of the request that created this intercept
+				continue
+			}
 			return interceptError(rpc.InterceptError_ALREADY_EXISTS, errcat.User.Newf(spec.Name)), nil
 		}
 		if iCept.Spec.TargetPort == spec.TargetPort && iCept.Spec.TargetHost == spec.TargetHost {
@@ -302,10 +405,15 @@ func (tm *TrafficManager) CanIntercept(c context.Context, ir *rpc.CreateIntercep
 		}
 	}
 	if spec.Agent == "" {
-		return nil, nil
+		if ir.WorkloadSelector == "" {
+			return nil, nil
+		}
+		if result := tm.resolveWorkloadSelector(c, ir); result != nil {
+			return result, nil
+		}
 	}
 
-	obj, err := k8sapi.GetWorkload(c, spec.Agent, spec.Namespace, spec.WorkloadKind)
+	obj, err := tm.wlWatcher.getWorkload(c, spec.Agent, spec.Namespace, spec.WorkloadKind)
 	if err != nil {
 		if errors2.IsNotFound(err) {
 			return interceptError(rpc.InterceptError_NO_ACCEPTABLE_WORKLOAD, errcat.User.Newf(spec.Name)), nil
@@ -373,6 +481,7 @@ func (tm *TrafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 	if wl == nil {
 		return tm.AddLocalOnlyIntercept(c, spec)
 	}
+	orig := proto.Clone(ir).(*rpc.CreateInterceptRequest)
 
 	spec.Client = tm.userAndHost
 	if spec.Mechanism == "" {
@@ -394,7 +503,7 @@ func (tm *TrafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 
 	// It's OK to just call addAgent every time; if the agent is already installed then it's a
 	// no-op.
-	result = tm.addAgent(c, wl, spec.ServiceName, spec.ServicePortIdentifier, ir.AgentImage, apiPort)
+	result = tm.addAgent(c, wl, spec.ServiceName, spec.ServicePortIdentifier, ir.ContainerName, ir.AgentImage, apiPort)
 	if result.Error != rpc.InterceptError_UNSPECIFIED {
 		return result, nil
 	}
@@ -404,10 +513,19 @@ func (tm *TrafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 
 	deleteMount := false
 	if ir.MountPoint != "" {
+		filter, err := sftpfilter.NewFilter(install.TelAppMountPoint, ir.MountInclude, ir.MountExclude)
+		if err != nil {
+			return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, errcat.User.Newf("invalid mount filter: %w", err)), nil
+		}
+
 		// Ensure that the mount-point is free to use
 		if prev, loaded := tm.mountPoints.LoadOrStore(ir.MountPoint, spec.Name); loaded {
 			return interceptError(rpc.InterceptError_MOUNT_POINT_BUSY, errcat.User.Newf(prev.(string))), nil
 		}
+		tm.mountOptions.Store(ir.MountPoint, &mountOptions{readOnly: ir.MountReadOnly, filter: filter})
+		hash := sha256.Sum256([]byte(tm.mountPassword(spec.Name)))
+		spec.MountPasswordHash = hash[:]
+		spec.MountReadOnly = ir.MountReadOnly
 
 		// Assume that the mount-point should to be removed from the busy map. Only a happy path
 		// to successful intercept that actually has remote mounts will set this to false.
@@ -415,6 +533,7 @@ func (tm *TrafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 		defer func() {
 			if deleteMount {
 				tm.mountPoints.Delete(ir.MountPoint)
+				tm.mountOptions.Delete(ir.MountPoint)
 			}
 		}()
 	}
@@ -429,6 +548,10 @@ func (tm *TrafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 	tos := &client.GetConfig(c).Timeouts
 	spec.RoundtripLatency = int64(tos.Get(client.TimeoutRoundtripLatency)) * 2 // Account for extra hop
 	spec.DialTimeout = int64(tos.Get(client.TimeoutEndpointDial))
+	spec.TunnelCompression = client.GetConfig(c).Grpc.TunnelCompression
+	if spec.IdentityHeaders, err = tm.identityHeaders(c, spec); err != nil {
+		return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, err), nil
+	}
 	c, cancel := tos.TimeoutContext(c, client.TimeoutIntercept)
 	defer cancel()
 
@@ -438,10 +561,42 @@ func (tm *TrafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 	tm.activeInterceptsWaiters.Store(spec.Name, waitCh)
 	defer tm.activeInterceptsWaiters.Delete(spec.Name)
 
-	ii, err := tm.managerClient.CreateIntercept(c, &manager.CreateInterceptRequest{
-		Session:       tm.session(),
-		InterceptSpec: spec,
-		ApiKey:        apiKey,
+	// A retry of a request that already created the intercept must reuse its key pair, or the
+	// intercept would be unable to decrypt what the traffic-agent sends.
+	keepKey := false
+	if retried := tm.interceptByIdempotencyKey(ir.IdempotencyKey); retried != nil {
+		spec.ClientPublicKey = retried.Spec.ClientPublicKey
+	} else if ir.Encrypt {
+		if spec.ClientPublicKey, err = tm.newInterceptKey(); err != nil {
+			return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, err), nil
+		}
+
+		// The key must be forgotten unless the intercept succeeds. It is then retained until the intercept
+		// is removed.
+		public := spec.ClientPublicKey
+		defer func() {
+			tm.releaseInterceptKey(public, keepKey)
+		}()
+	}
+
+	if len(spec.ClientPublicKey) > 0 {
+		// The key is exchanged directly with the traffic-agents, so that the traffic-manager can't substitute it
+		if n, err := tm.exchangeInterceptKey(c, spec.Namespace, spec.Agent, spec.ClientPublicKey); n == 0 {
+			if err == nil {
+				err = errors.New("no running traffic-agent found")
+			}
+			return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH,
+				errcat.User.Newf("unable to exchange the encryption key with the traffic-agents of %s: %w", spec.Agent, err)), nil
+		} else if err != nil {
+			dlog.Warn(c, err)
+		}
+	}
+
+	ii, err := tm.createIntercept(c, &manager.CreateInterceptRequest{
+		Session:        tm.session(),
+		InterceptSpec:  spec,
+		ApiKey:         apiKey,
+		IdempotencyKey: ir.IdempotencyKey,
 	})
 	if err != nil {
 		dlog.Debugf(c, "manager responded to CreateIntercept with error %v", err)
@@ -450,37 +605,103 @@ func (tm *TrafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 	}
 	dlog.Debugf(c, "created intercept %s", ii.Spec.Name)
 
-	select {
-	case <-c.Done():
-		return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, c.Err()), nil
-	case wr := <-waitCh:
-		ii = wr.intercept
-		if wr.err != nil {
-			return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, wr.err), nil
+	// The recording starts with the first connection, which may arrive before the intercept is reported active
+	// but not before the traffic-agent has seen the intercept that was just created.
+	if ir.RecordFile != "" {
+		id := ii.Id
+		tm.recorders.Store(id, recording.NewRecorder(spec.Name, ir.RecordFile, ir.RecordMaxBody, ir.RecordSecrets))
+		defer func() {
+			if !keepKey {
+				tm.recorders.Delete(id)
+			}
+		}()
+	}
+	reportProgress(c, rpc.ProgressEvent_INTERCEPT_ACTIVE, false, "Waiting for the traffic-agent to activate intercept %s", spec.Name)
+
+	var wr interceptResult
+	if ii.Disposition != manager.InterceptDispositionType_WAITING {
+		// The intercept was reviewed already, most likely because this is a retry. The snapshot that
+		// reported that might have been delivered before the waiter was stored.
+		wr = interceptResult{intercept: ii, err: interceptStateError(ii)}
+	} else {
+		select {
+		case <-c.Done():
+			// Don't leave a half-created intercept behind. The request context is done, so the removal
+			// must use a context of its own.
+			rc, rcCancel := context.WithTimeout(dcontext.WithoutCancel(c), 5*time.Second)
+			if err = tm.RemoveIntercept(rc, spec.Name); err != nil && grpcStatus.Code(err) != grpcCodes.NotFound {
+				dlog.Errorf(c, "failed to remove intercept %s: %v", spec.Name, err)
+			}
+			rcCancel()
+			return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, client.CheckTimeout(c, c.Err())), nil
+		case wr = <-waitCh:
 		}
-		result.InterceptInfo = wr.intercept
-		if ir.MountPoint != "" && ii.SftpPort > 0 {
-			result.Environment["TELEPRESENCE_ROOT"] = ir.MountPoint
-			deleteMount = false // Mount-point is busy until intercept ends
-			ii.Spec.MountPoint = ir.MountPoint
+	}
+	ii = wr.intercept
+	if wr.err == nil && len(ii.Spec.ClientPublicKey) > 0 && !tm.hasAgentKey(ii.Spec.ClientPublicKey, ii.AgentPublicKey) {
+		wr.err = errcat.User.New("the encryption key of the traffic-agent was not exchanged with the traffic-agent")
+	}
+	if wr.err != nil {
+		if ii.Disposition == manager.InterceptDispositionType_ACTIVE {
+			// Don't leave an intercept active when it doesn't provide what was asked for
+			if err = tm.RemoveIntercept(c, spec.Name); err != nil {
+				dlog.Errorf(c, "failed to remove intercept %s: %v", spec.Name, err)
+			}
 		}
-		return result, nil
+		return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, wr.err), nil
+	}
+	result.InterceptInfo = ii
+	keepKey = true
+	reportProgress(c, rpc.ProgressEvent_INTERCEPT_ACTIVE, true, "Intercept %s is active", spec.Name)
+	if ir.MountPoint != "" && (ii.SftpPort > 0 || ii.WebdavPort > 0) {
+		result.Environment["TELEPRESENCE_ROOT"] = ir.MountPoint
+		deleteMount = false // Mount-point is busy until intercept ends
+		ii.Spec.MountPoint = ir.MountPoint
+		reportProgress(c, rpc.ProgressEvent_VOLUME_MOUNT, false, "Mounting the remote volumes at %s", ir.MountPoint)
+	}
+	reportProgress(c, rpc.ProgressEvent_PORT_READY, true, "Intercepted traffic is routed to %s",
+		net.JoinHostPort(spec.TargetHost, strconv.Itoa(int(spec.TargetPort))))
+	tm.storeInterceptRequest(orig)
+	return result, nil
+}
+
+// createIntercept asks the traffic-manager to create an intercept. A request with an idempotency key is
+// retried when the traffic-manager is unavailable, because the key guarantees that a request that did reach
+// the traffic-manager before the connection was lost doesn't create a duplicate.
+func (tm *TrafficManager) createIntercept(c context.Context, rq *manager.CreateInterceptRequest) (*manager.InterceptInfo, error) {
+	backoff := 250 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		ii, err := tm.managerClient.CreateIntercept(c, rq)
+		if err == nil || rq.IdempotencyKey == "" || attempt == 3 || grpcStatus.Code(err) != grpcCodes.Unavailable {
+			return ii, err
+		}
+		dlog.Debugf(c, "retrying CreateIntercept of %s: %v", rq.InterceptSpec.Name, err)
+		dtime.SleepWithContext(c, backoff)
+		if c.Err() != nil {
+			return nil, err
+		}
+		backoff *= 2
 	}
 }
 
 // shouldForward returns true if the intercept info given should result in mounts or ports being forwarded
 func (tm *TrafficManager) shouldForward(ii *manager.InterceptInfo) bool {
-	return ii.SftpPort > 0 || len(ii.Spec.ExtraPorts) > 0
+	return ii.SftpPort > 0 || ii.WebdavPort > 0 || len(ii.Spec.ExtraPorts) > 0
 }
 
 // startForwards starts port forwards and mounts for the given forwardKey.
 // It assumes that the user has called shouldForward and is sure that something will be started.
-func (tm *TrafficManager) startForwards(ctx context.Context, wg *sync.WaitGroup, fk forwardKey, sftpPort int32, extraPorts []int32) {
-	if sftpPort > 0 {
-		// There's nothing to mount if the SftpPort is zero
-		mntCtx := dgroup.WithGoroutineName(ctx, fmt.Sprintf("/%s:%d", fk.PodIP, sftpPort))
+func (tm *TrafficManager) startForwards(ctx context.Context, wg *sync.WaitGroup, mf mountForward, extraPorts []int32) {
+	fk := mf.forwardKey
+	if mf.SftpPort > 0 || mf.WebdavPort > 0 {
+		// There's nothing to mount if both the SftpPort and the WebdavPort are zero
+		port := mf.SftpPort
+		if port == 0 {
+			port = mf.WebdavPort
+		}
+		mntCtx := dgroup.WithGoroutineName(ctx, fmt.Sprintf("/%s:%d", fk.PodIP, port))
 		wg.Add(1)
-		go tm.workerMountForwardIntercept(mntCtx, mountForward{fk, sftpPort}, wg)
+		go tm.workerMountForwardIntercept(mntCtx, mf, wg)
 	}
 	for _, port := range extraPorts {
 		pfCtx := dgroup.WithGoroutineName(ctx, fmt.Sprintf("/%s:%d", fk.PodIP, port))
@@ -543,8 +764,25 @@ func (tm *TrafficManager) workerMountForwardIntercept(ctx context.Context, mf mo
 		mountMutex.Unlock()
 	}()
 
+	var mo *mountOptions
+	if v, ok := tm.mountOptions.Load(mountPoint); ok {
+		mo = v.(*mountOptions)
+	} else {
+		mo = &mountOptions{}
+	}
+
+	transport, err := remotefs.SelectTransport(ctx)
+	if err != nil {
+		dlog.Errorf(ctx, "Unable to mount file system for intercept %q: %v", mf.Name, err)
+		return
+	}
+	if transport == remotefs.TransportWebDAV || mf.SftpPort == 0 {
+		tm.mountWebDAV(ctx, mf, mountPoint, mo)
+		return
+	}
+
 	// Retry mount in case it gets disconnected
-	err := client.Retry(ctx, "sshfs", func(ctx context.Context) error {
+	err = client.Retry(ctx, "sshfs", func(ctx context.Context) error {
 		dl := &net.Dialer{Timeout: 3 * time.Second}
 		conn, err := dl.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", mf.PodIP, mf.SftpPort))
 		if err != nil {
@@ -568,13 +806,20 @@ func (tm *TrafficManager) workerMountForwardIntercept(ctx context.Context, mf mo
 			"localhost:" + install.TelAppMountPoint, // what to mount
 			mountPoint,                              // where to mount it
 		}
+		var peer io.ReadWriteCloser = conn
+		if mo.readOnly {
+			sshfsArgs = append([]string{"-o", "ro"}, sshfsArgs...)
+		}
+		if mo.filter != nil {
+			peer = sftpfilter.NewConn(ctx, conn, mo.filter)
+		}
 		exe := "sshfs"
 		if runtime.GOOS == "windows" {
 			// Use sshfs-win to launch the sshfs
 			sshfsArgs = append([]string{"cmd", "-ouid=-1", "-ogid=-1"}, sshfsArgs...)
 			exe = "sshfs-win"
 		}
-		err = dpipe.DPipe(ctx, conn, exe, sshfsArgs...)
+		err = dpipe.DPipe(ctx, peer, exe, sshfsArgs...)
 		time.Sleep(time.Second)
 		return err
 	}, 3*time.Second, 6*time.Second)
@@ -584,12 +829,48 @@ func (tm *TrafficManager) workerMountForwardIntercept(ctx context.Context, mf mo
 	}
 }
 
+// mountWebDAV mounts the remote volumes using the WebDAV server of the traffic-agent. The server enforces the
+// read-only mode of the intercept, because not all WebDAV clients have a read-only option.
+func (tm *TrafficManager) mountWebDAV(ctx context.Context, mf mountForward, mountPoint string, mo *mountOptions) {
+	switch {
+	case mf.WebdavPort == 0:
+		dlog.Errorf(ctx, "Unable to mount file system for intercept %q: the traffic-agent has no WebDAV server", mf.Name)
+		return
+	case mo.filter != nil:
+		dlog.Errorf(ctx, "Unable to mount file system for intercept %q: mount filters require sshfs", mf.Name)
+		return
+	}
+	url := fmt.Sprintf("http://%s/", net.JoinHostPort(mf.PodIP, strconv.Itoa(int(mf.WebdavPort))))
+	if mo.readOnly {
+		url += strings.TrimPrefix(install.TelAppWebDAVReadOnlyPrefix, "/") + "/"
+	}
+	if err := remotefs.MountWebDAV(ctx, url, tm.mountPassword(mf.Name), mountPoint, mo.readOnly); err != nil && ctx.Err() == nil {
+		dlog.Error(ctx, err)
+	}
+}
+
+// mountPassword returns the password that the WebDAV mount of the given intercept authenticates with. Only the
+// hash of the password is sent to the traffic-agent, in the InterceptSpec. The password is derived from a secret
+// of this session, so that a retried or recreated intercept gets the same password.
+func (tm *TrafficManager) mountPassword(interceptName string) string {
+	mac := hmac.New(sha256.New, tm.mountSecret)
+	_, _ = mac.Write([]byte(interceptName))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 // RemoveIntercept removes one intercept by name
 func (tm *TrafficManager) RemoveIntercept(c context.Context, name string) error {
 	if ns, ok := tm.localIntercepts[name]; ok {
 		return tm.RemoveLocalOnlyIntercept(c, name, ns)
 	}
 	dlog.Debugf(c, "telling manager to remove intercept %s", name)
+	tm.interceptRequests.Delete(name)
+	tm.recorders.Range(func(id, v interface{}) bool {
+		if v.(*recording.Recorder).Intercept() == name {
+			tm.recorders.Delete(id)
+		}
+		return true
+	})
 	_, err := tm.managerClient.RemoveIntercept(c, &manager.RemoveInterceptRequest2{
 		Session: tm.session(),
 		Name:    name,
@@ -597,6 +878,47 @@ func (tm *TrafficManager) RemoveIntercept(c context.Context, name string) error
 	return err
 }
 
+// RemoveInterceptByIdempotencyKey removes the intercept that was created with the given idempotency key.
+// The traffic-manager resolves the key, so this works even when the creation of the intercept was interrupted
+// before its name was reported back.
+func (tm *TrafficManager) RemoveInterceptByIdempotencyKey(c context.Context, key string) error {
+	dlog.Debugf(c, "telling manager to remove intercept with idempotency key %s", key)
+	_, err := tm.managerClient.RemoveIntercept(c, &manager.RemoveInterceptRequest2{
+		Session:        tm.session(),
+		IdempotencyKey: key,
+	})
+	return err
+}
+
+// RemoveAllIntercepts removes all intercepts of this session, including the local-only ones, and returns
+// the names of the intercepts that were removed.
+func (tm *TrafficManager) RemoveAllIntercepts(c context.Context) ([]string, error) {
+	tm.insLock.Lock()
+	names := make([]string, 0, len(tm.localIntercepts))
+	for name := range tm.localIntercepts {
+		names = append(names, name)
+	}
+	tm.insLock.Unlock()
+	for _, cept := range tm.getCurrentIntercepts() {
+		names = append(names, cept.Spec.Name)
+	}
+
+	removed := make([]string, 0, len(names))
+	for _, name := range names {
+		if err := tm.RemoveIntercept(c, name); err != nil {
+			if grpcStatus.Code(err) == grpcCodes.NotFound {
+				// Removed by someone else in the meantime
+				continue
+			}
+			sort.Strings(removed)
+			return removed, err
+		}
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
+
 // clearIntercepts removes all intercepts
 func (tm *TrafficManager) clearIntercepts(c context.Context) error {
 	for _, cept := range tm.getCurrentIntercepts() {
@@ -0,0 +1,252 @@
+package trafficmgr
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	core "k8s.io/api/core/v1"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/socks"
+)
+
+// loopbackForwards are the loopback listeners that forward TCP connections to the ports of the services in the
+// mapped namespaces. They are used when the root daemon is unable to create the virtual network device. A DNS
+// server resolves the names of the services to the loopback address, and SRV records tell the local ports.
+type loopbackForwards struct {
+	sync.Mutex
+	forwards      map[loopbackKey]*loopbackForward
+	clusterDomain string
+	dnsAddress    string
+}
+
+type loopbackKey struct {
+	service   string
+	namespace string
+	port      int32
+}
+
+type loopbackForward struct {
+	portName  string
+	clusterIP string
+	listener  net.Listener
+}
+
+func newLoopbackForwards() *loopbackForwards {
+	return &loopbackForwards{
+		forwards:      make(map[loopbackKey]*loopbackForward),
+		clusterDomain: "cluster.local",
+	}
+}
+
+// serveLoopbackForwards keeps the loopback forwards in sync with the services of the mapped namespaces and serves
+// DNS for the names of those services until the context is cancelled.
+func (tm *TrafficManager) serveLoopbackForwards(c context.Context) error {
+	lf := tm.loopbackForwards
+	if _, clusterDomain, err := tm.getProxiedSubnets(c); err == nil {
+		lf.Lock()
+		lf.clusterDomain = client.NormalizeDNSSuffix(clusterDomain)
+		lf.Unlock()
+	} else {
+		dlog.Warnf(c, "unable to get the cluster domain, using %q: %v", lf.clusterDomain, err)
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	lf.Lock()
+	lf.dnsAddress = pc.LocalAddr().String()
+	lf.Unlock()
+	ds := &dns.Server{PacketConn: pc, Handler: lf}
+	go func() {
+		<-c.Done()
+		_ = ds.Shutdown()
+	}()
+	go func() {
+		if err := ds.ActivateAndServe(); err != nil && c.Err() == nil {
+			dlog.Errorf(c, "loopback DNS server failed: %v", err)
+		}
+	}()
+	dlog.Infof(c, "Serving DNS for the loopback port-forwards on %s", lf.dnsAddress)
+
+	update := func() {
+		var svcs []*core.Service
+		tm.wlWatcher.eachService(c, tm.GetCurrentNamespaces(true), func(svc *core.Service) {
+			svcs = append(svcs, svc)
+		})
+		lf.update(c, svcs, tm.proxyForward)
+	}
+	changed := tm.wlWatcher.subscribe(c)
+	update()
+	for {
+		select {
+		case <-c.Done():
+			lf.update(c, nil, nil)
+			return nil
+		case <-changed:
+			update()
+		}
+	}
+}
+
+// update makes the loopback forwards reflect the TCP ports of the given services. Forwards that no longer have a
+// service port are closed and new listeners are created for the new service ports.
+func (lf *loopbackForwards) update(c context.Context, svcs []*core.Service, forward socks.Forwarder) {
+	desired := make(map[loopbackKey]*loopbackForward)
+	for _, svc := range svcs {
+		ip := svc.Spec.ClusterIP
+		if ip == "" || ip == core.ClusterIPNone {
+			continue
+		}
+		for _, sp := range svc.Spec.Ports {
+			if sp.Protocol == "" || sp.Protocol == core.ProtocolTCP {
+				desired[loopbackKey{service: svc.Name, namespace: svc.Namespace, port: sp.Port}] = &loopbackForward{
+					portName:  sp.Name,
+					clusterIP: ip,
+				}
+			}
+		}
+	}
+
+	lf.Lock()
+	defer lf.Unlock()
+	for k, f := range lf.forwards {
+		if d, ok := desired[k]; !ok || d.clusterIP != f.clusterIP {
+			dlog.Debugf(c, "Closing loopback forward %s to %s.%s:%d", f.listener.Addr(), k.service, k.namespace, k.port)
+			_ = f.listener.Close()
+			delete(lf.forwards, k)
+		} else {
+			f.portName = d.portName
+		}
+	}
+	for k, d := range desired {
+		if _, ok := lf.forwards[k]; ok {
+			continue
+		}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			dlog.Errorf(c, "unable to create loopback forward to %s.%s:%d: %v", k.service, k.namespace, k.port, err)
+			continue
+		}
+		d.listener = l
+		lf.forwards[k] = d
+		dlog.Debugf(c, "Forwarding %s to %s.%s:%d", l.Addr(), k.service, k.namespace, k.port)
+		go serveLoopbackForward(c, l, net.ParseIP(d.clusterIP), uint16(k.port), forward)
+	}
+}
+
+func serveLoopbackForward(c context.Context, l net.Listener, ip net.IP, port uint16, forward socks.Forwarder) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			if err := forward(c, conn, ip, port); err != nil {
+				dlog.Errorf(c, "loopback forward to %s:%d failed: %v", ip, port, err)
+			}
+		}()
+	}
+}
+
+// snapshot returns the current loopback forwards, sorted by namespace, service, and port, and the address of
+// the DNS server.
+func (lf *loopbackForwards) snapshot() ([]*rpc.LoopbackForward, string) {
+	lf.Lock()
+	defer lf.Unlock()
+	fws := make([]*rpc.LoopbackForward, 0, len(lf.forwards))
+	for k, f := range lf.forwards {
+		fws = append(fws, &rpc.LoopbackForward{
+			Service:      k.service,
+			Namespace:    k.namespace,
+			Port:         k.port,
+			LocalAddress: f.listener.Addr().String(),
+		})
+	}
+	sort.Slice(fws, func(i, j int) bool {
+		a, b := fws[i], fws[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		return a.Port < b.Port
+	})
+	return fws, lf.dnsAddress
+}
+
+// ServeDNS answers A queries for <service>.<namespace>[.svc[.<cluster domain>]] with the loopback address, and SRV
+// queries for _<port name>._tcp.<service>.<namespace>[.svc[.<cluster domain>]] with the local port of the forward.
+func (lf *loopbackForwards) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	msg := new(dns.Msg)
+	msg.SetReply(r)
+	msg.Authoritative = true
+	if len(r.Question) == 1 {
+		lf.answer(msg, &r.Question[0])
+	} else {
+		msg.Rcode = dns.RcodeFormatError
+	}
+	_ = w.WriteMsg(msg)
+}
+
+func (lf *loopbackForwards) answer(msg *dns.Msg, q *dns.Question) {
+	portName, service, namespace, ok := lf.parseName(q.Name)
+	if !ok {
+		msg.Rcode = dns.RcodeNameError
+		return
+	}
+	lf.Lock()
+	defer lf.Unlock()
+	found := false
+	for k, f := range lf.forwards {
+		if k.service != service || k.namespace != namespace {
+			continue
+		}
+		found = true
+		switch {
+		case portName == "" && q.Qtype == dns.TypeA:
+			if len(msg.Answer) == 0 {
+				msg.Answer = append(msg.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 5},
+					A:   net.IPv4(127, 0, 0, 1),
+				})
+			}
+		case portName != "" && q.Qtype == dns.TypeSRV && portName == f.portName:
+			msg.Answer = append(msg.Answer, &dns.SRV{
+				Hdr:    dns.RR_Header{Name: q.Name, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 5},
+				Port:   uint16(f.listener.Addr().(*net.TCPAddr).Port),
+				Target: dns.Fqdn(service + "." + namespace + ".svc." + lf.clusterDomain),
+			})
+		}
+	}
+	if !found {
+		msg.Rcode = dns.RcodeNameError
+	}
+}
+
+// parseName returns the port name, service, and namespace of the given DNS name. The port name is empty unless
+// the name is a SRV name for TCP.
+func (lf *loopbackForwards) parseName(name string) (portName, service, namespace string, ok bool) {
+	name = client.NormalizeDNSSuffix(name)
+	lf.Lock()
+	name = strings.TrimSuffix(name, "."+lf.clusterDomain)
+	lf.Unlock()
+	name = strings.TrimSuffix(name, ".svc")
+	parts := strings.Split(name, ".")
+	switch {
+	case len(parts) == 2:
+		return "", parts[0], parts[1], true
+	case len(parts) == 4 && parts[1] == "_tcp" && len(parts[0]) > 1 && parts[0][0] == '_':
+		return parts[0][1:], parts[2], parts[3], true
+	}
+	return "", "", "", false
+}
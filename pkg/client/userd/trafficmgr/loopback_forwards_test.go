@@ -0,0 +1,99 @@
+package trafficmgr
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+func TestLoopbackForwards(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+
+	type dest struct {
+		ip   string
+		port uint16
+	}
+	dests := make(chan dest, 1)
+	forward := func(_ context.Context, conn net.Conn, ip net.IP, port uint16) error {
+		dests <- dest{ip: ip.String(), port: port}
+		_, err := io.WriteString(conn, "hello")
+		return err
+	}
+	svc := func(name, clusterIP string, ports ...core.ServicePort) *core.Service {
+		return &core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       core.ServiceSpec{ClusterIP: clusterIP, Ports: ports},
+		}
+	}
+	web := svc("web", "10.43.0.10", core.ServicePort{Name: "http", Port: 80}, core.ServicePort{Name: "dns", Port: 53, Protocol: core.ProtocolUDP})
+	headless := svc("db", core.ClusterIPNone, core.ServicePort{Port: 5432})
+
+	lf := newLoopbackForwards()
+	lf.update(ctx, []*core.Service{web, headless}, forward)
+	defer lf.update(ctx, nil, nil)
+	fws, _ := lf.snapshot()
+	require.Len(t, fws, 1)
+	assert.Equal(t, "web", fws[0].Service)
+	assert.Equal(t, int32(80), fws[0].Port)
+
+	conn, err := net.Dial("tcp", fws[0].LocalAddress)
+	require.NoError(t, err)
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	_ = conn.Close()
+	assert.Equal(t, "hello", string(data))
+	assert.Equal(t, dest{ip: "10.43.0.10", port: 80}, <-dests)
+
+	// A new cluster IP replaces the forward
+	web.Spec.ClusterIP = "10.43.0.11"
+	lf.update(ctx, []*core.Service{web}, forward)
+	fws2, _ := lf.snapshot()
+	require.Len(t, fws2, 1)
+	assert.NotEqual(t, fws[0].LocalAddress, fws2[0].LocalAddress)
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		q := new(dns.Msg)
+		q.SetQuestion(name, qtype)
+		r := new(dns.Msg)
+		lf.ServeDNS(&dnsRecorder{msg: &r}, q)
+		return r
+	}
+	for _, name := range []string{"web.default.", "web.default.svc.", "web.default.svc.cluster.local."} {
+		r := query(name, dns.TypeA)
+		require.Len(t, r.Answer, 1, name)
+		assert.Equal(t, "127.0.0.1", r.Answer[0].(*dns.A).A.String())
+	}
+	r := query("_http._tcp.web.default.svc.cluster.local.", dns.TypeSRV)
+	require.Len(t, r.Answer, 1)
+	_, port, _ := net.SplitHostPort(fws2[0].LocalAddress)
+	assert.Equal(t, port, dns.Field(r.Answer[0], 3))
+	assert.Equal(t, "web.default.svc.cluster.local.", r.Answer[0].(*dns.SRV).Target)
+
+	assert.Equal(t, dns.RcodeNameError, query("db.default.", dns.TypeA).Rcode)
+	assert.Equal(t, dns.RcodeNameError, query("web.", dns.TypeA).Rcode)
+	r = query("web.default.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+	assert.Empty(t, r.Answer)
+}
+
+// dnsRecorder is a dns.ResponseWriter that records the written message.
+type dnsRecorder struct {
+	dns.ResponseWriter
+	msg **dns.Msg
+}
+
+func (r *dnsRecorder) WriteMsg(m *dns.Msg) error {
+	*r.msg = m
+	return nil
+}
@@ -0,0 +1,215 @@
+package trafficmgr
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/dnet"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+// mtlsRenewBefore is how long before its expiry that the client certificate is renewed.
+const mtlsRenewBefore = 5 * time.Minute
+
+// managerTransport returns the port of the traffic-manager service that the client should connect to,
+// and the transport credentials to use. Mutual TLS is used when the service declares a port named
+// install.ManagerPortMTLSName. The client then creates a key pair and has the traffic-manager sign a
+// certificate for it using a port-forward to its install.ManagerPortMTLSBootstrap, so the permission to
+// port-forward to the traffic-manager pod is what grants access. The CA private key never leaves the
+// traffic-manager.
+func managerTransport(c context.Context, restConfig *rest.Config, namespace, userAndHost string) (int32, grpc.DialOption, error) {
+	ki := k8sapi.GetK8sInterface(c)
+	svc, err := ki.CoreV1().Services(namespace).Get(c, install.ManagerAppName, meta.GetOptions{})
+	if err != nil {
+		return 0, nil, err
+	}
+	var mtlsPort int32
+	for _, p := range svc.Spec.Ports {
+		if p.Name == install.ManagerPortMTLSName {
+			mtlsPort = p.Port
+			break
+		}
+	}
+	if mtlsPort == 0 {
+		return install.ManagerPortHTTP, grpc.WithInsecure(), nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	cc := &clientCertificate{
+		restConfig: restConfig,
+		svc:        svc,
+		commonName: userAndHost,
+		key:        key,
+	}
+	caCert, err := cc.renew(c)
+	if err != nil {
+		return 0, nil, errcat.User.Newf("the traffic-manager requires mutual TLS, but no client certificate could be obtained: %w", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	dlog.Debugf(c, "using mutual TLS on traffic-manager port %s", install.ManagerPortMTLSName)
+	tlsConfig := &tls.Config{
+		RootCAs:    pool,
+		ServerName: install.ManagerAppName + "." + namespace,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cc.get(c)
+		},
+		MinVersion: tls.VersionTLS12,
+	}
+	return mtlsPort, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)), nil
+}
+
+// clientCertificate is the client certificate that the traffic-manager has signed. It is renewed
+// when it is about to expire.
+type clientCertificate struct {
+	sync.Mutex
+	restConfig *rest.Config
+	svc        *core.Service
+	commonName string
+	key        crypto.Signer
+	cert       *tls.Certificate
+}
+
+func (cc *clientCertificate) get(c context.Context) (*tls.Certificate, error) {
+	cc.Lock()
+	cert := cc.cert
+	cc.Unlock()
+	if time.Until(cert.Leaf.NotAfter) > mtlsRenewBefore {
+		return cert, nil
+	}
+	if _, err := cc.renew(c); err != nil {
+		return nil, err
+	}
+	cc.Lock()
+	defer cc.Unlock()
+	return cc.cert, nil
+}
+
+// renew sends a certificate request to the bootstrap port of a traffic-manager pod and stores the
+// certificate of the response. The CA certificate of the response is returned.
+func (cc *clientCertificate) renew(c context.Context) (*x509.Certificate, error) {
+	csrDer, err := x509.CreateCertificateRequest(cryptorand.Reader,
+		&x509.CertificateRequest{Subject: pkix.Name{CommonName: cc.commonName}}, cc.key)
+	if err != nil {
+		return nil, err
+	}
+	ki := k8sapi.GetK8sInterface(c)
+	svc := cc.svc
+	pods, err := ki.CoreV1().Pods(svc.Namespace).List(c, meta.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var podName string
+	for i := range pods.Items {
+		if pod := &pods.Items[i]; pod.Status.Phase == core.PodRunning && pod.DeletionTimestamp == nil {
+			podName = pod.Name
+			break
+		}
+	}
+	if podName == "" {
+		return nil, fmt.Errorf("no running %s pod found in namespace %s", svc.Name, svc.Namespace)
+	}
+	pfDialer, err := dnet.NewK8sPortForwardDialer(c, cc.restConfig, ki)
+	if err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort("pods/"+podName+"."+svc.Namespace, fmt.Sprint(install.ManagerPortMTLSBootstrap))
+	hc := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return pfDialer(ctx, addr)
+			},
+			DisableKeepAlives: true,
+		},
+		Timeout: time.Minute,
+	}
+	rq, err := http.NewRequestWithContext(c, http.MethodPost, "http://"+svc.Name+install.MTLSBootstrapPath,
+		bytes.NewReader(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDer})))
+	if err != nil {
+		return nil, err
+	}
+	rq.Header.Set("Content-Type", "application/pkcs10")
+	rs, err := hc.Do(rq)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rs.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", rs.Status, bytes.TrimSpace(body))
+	}
+	cert, caCert, err := parseCertificateResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	cert.PrivateKey = cc.key
+	cc.Lock()
+	cc.cert = cert
+	cc.Unlock()
+	return caCert, nil
+}
+
+// parseCertificateResponse parses the PEM encoded client certificate and CA certificate that the
+// bootstrap port of the traffic-manager responds with, and verifies that the former is signed by the latter.
+func parseCertificateResponse(data []byte) (*tls.Certificate, *x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) != 2 {
+		return nil, nil, errors.New("expected a client certificate and a CA certificate")
+	}
+	leaf, caCert := certs[0], certs[1]
+	if err := leaf.CheckSignatureFrom(caCert); err != nil {
+		return nil, nil, fmt.Errorf("client certificate is not signed by the CA: %w", err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		Leaf:        leaf,
+	}, caCert, nil
+}
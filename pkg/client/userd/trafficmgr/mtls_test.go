@@ -0,0 +1,64 @@
+package trafficmgr
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseCertificateResponse(t *testing.T) {
+	newCert := func(cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+		require.NoError(t, err)
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  isCA,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(cryptorand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return cert, key
+	}
+	toPem := func(certs ...*x509.Certificate) []byte {
+		var data []byte
+		for _, c := range certs {
+			data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+		}
+		return data
+	}
+
+	ca, caKey := newCert("ca", true, nil, nil)
+	otherCA, _ := newCert("other-ca", true, nil, nil)
+	leaf, _ := newCert("jane@host", false, ca, caKey)
+
+	cert, caCert, err := parseCertificateResponse(toPem(leaf, ca))
+	require.NoError(t, err)
+	assert.Equal(t, leaf, cert.Leaf)
+	assert.Equal(t, [][]byte{leaf.Raw}, cert.Certificate)
+	assert.Equal(t, ca, caCert)
+
+	_, _, err = parseCertificateResponse(toPem(leaf, otherCA))
+	assert.Error(t, err)
+	_, _, err = parseCertificateResponse(toPem(leaf))
+	assert.Error(t, err)
+	_, _, err = parseCertificateResponse([]byte("bad request"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,114 @@
+package trafficmgr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+// proxyAutoConfig returns a proxy auto-config (PAC) file that directs requests for the cluster to the
+// proxy of this session and lets all other requests go directly to their destination.
+func (tm *TrafficManager) proxyAutoConfig(c context.Context) (string, error) {
+	subnets, clusterDomain, err := tm.getProxiedSubnets(c)
+	if err != nil {
+		return "", err
+	}
+	suffixes := []string{client.NormalizeDNSSuffix(clusterDomain), "svc"}
+	suffixes = append(suffixes, tm.GetCurrentNamespaces(true)...)
+	for sfx := range tm.getSuffixNamespaces(c) {
+		suffixes = append(suffixes, sfx)
+	}
+	return generatePAC(tm.pacProxyAddress, subnets, suffixes), nil
+}
+
+// getProxiedSubnets returns the pod and service subnets and the domain of the cluster. The values are
+// obtained from the traffic-manager on first use.
+func (tm *TrafficManager) getProxiedSubnets(c context.Context) ([]*net.IPNet, string, error) {
+	tm.pacLock.Lock()
+	defer tm.pacLock.Unlock()
+	if tm.pacClusterDomain != "" {
+		return tm.pacSubnets, tm.pacClusterDomain, nil
+	}
+	c, cancel := context.WithCancel(c)
+	defer cancel()
+	stream, err := tm.managerClient.WatchClusterInfo(c, tm.session())
+	if err != nil {
+		return nil, "", err
+	}
+	ci, err := stream.Recv()
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to get cluster info from the traffic-manager: %w", err)
+	}
+	var subnets []*net.IPNet
+	for _, sn := range ci.PodSubnets {
+		subnets = append(subnets, iputil.IPNetFromRPC(sn))
+	}
+	if len(ci.ServiceSubnets) > 0 {
+		for _, sn := range ci.ServiceSubnets {
+			subnets = append(subnets, iputil.IPNetFromRPC(sn))
+		}
+	} else if ci.ServiceSubnet != nil {
+		subnets = append(subnets, iputil.IPNetFromRPC(ci.ServiceSubnet))
+	}
+	clusterDomain := ci.ClusterDomain
+	if tm.DNS != nil && tm.DNS.ClusterDomain != "" {
+		clusterDomain = tm.DNS.ClusterDomain
+	}
+	if clusterDomain == "" {
+		clusterDomain = "cluster.local."
+	}
+	tm.pacSubnets, tm.pacClusterDomain = subnets, clusterDomain
+	return subnets, clusterDomain, nil
+}
+
+// generatePAC generates a proxy auto-config file that returns the given proxy for hosts that end with one of
+// the given DNS suffixes and for IPv4 addresses in one of the given subnets. The PAC API can't compare IPv6
+// addresses, so IPv6 subnets are ignored.
+func generatePAC(proxyAddress string, subnets []*net.IPNet, suffixes []string) string {
+	sfxSet := make(map[string]struct{}, len(suffixes))
+	for _, sfx := range suffixes {
+		if sfx = client.NormalizeDNSSuffix(sfx); sfx != "" {
+			sfxSet[sfx] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(sfxSet))
+	for sfx := range sfxSet {
+		sorted = append(sorted, sfx)
+	}
+	sort.Strings(sorted)
+
+	sb := strings.Builder{}
+	sb.WriteString("function FindProxyForURL(url, host) {\n")
+	fmt.Fprintf(&sb, "  var proxy = %q;\n", "PROXY "+proxyAddress+"; SOCKS5 "+proxyAddress)
+	sb.WriteString("  host = host.toLowerCase();\n")
+	for _, sfx := range sorted {
+		fmt.Fprintf(&sb, "  if (host == %q || dnsDomainIs(host, %q)) return proxy;\n", sfx, "."+sfx)
+	}
+	sb.WriteString("  if (/^[0-9]+\\.[0-9]+\\.[0-9]+\\.[0-9]+$/.test(host)) {\n")
+	for _, sn := range subnets {
+		ip4 := sn.IP.To4()
+		if ip4 == nil || len(sn.Mask) != net.IPv4len {
+			continue
+		}
+		fmt.Fprintf(&sb, "    if (isInNet(host, %q, %q)) return proxy;\n", ip4, net.IP(sn.Mask))
+	}
+	sb.WriteString("  }\n")
+	sb.WriteString("  return \"DIRECT\";\n")
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// localProxyAddress returns the address that local clients use to reach a proxy that listens to the given
+// address. An unspecified listen address is replaced by the loopback address.
+func localProxyAddress(addr net.Addr) string {
+	host, port, _ := net.SplitHostPort(addr.String())
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
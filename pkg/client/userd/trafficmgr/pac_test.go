@@ -0,0 +1,33 @@
+package trafficmgr
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratePAC(t *testing.T) {
+	_, podNet, _ := net.ParseCIDR("10.42.0.0/16")
+	_, svcNet, _ := net.ParseCIDR("10.43.0.0/16")
+	_, v6Net, _ := net.ParseCIDR("fd00::/108")
+	pac := generatePAC("127.0.0.1:1080", []*net.IPNet{podNet, svcNet, v6Net}, []string{"cluster.local.", "svc", "Default", "svc", ""})
+	assert.Equal(t, `function FindProxyForURL(url, host) {
+  var proxy = "PROXY 127.0.0.1:1080; SOCKS5 127.0.0.1:1080";
+  host = host.toLowerCase();
+  if (host == "cluster.local" || dnsDomainIs(host, ".cluster.local")) return proxy;
+  if (host == "default" || dnsDomainIs(host, ".default")) return proxy;
+  if (host == "svc" || dnsDomainIs(host, ".svc")) return proxy;
+  if (/^[0-9]+\.[0-9]+\.[0-9]+\.[0-9]+$/.test(host)) {
+    if (isInNet(host, "10.42.0.0", "255.255.0.0")) return proxy;
+    if (isInNet(host, "10.43.0.0", "255.255.0.0")) return proxy;
+  }
+  return "DIRECT";
+}
+`, pac)
+}
+
+func TestLocalProxyAddress(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:1080", localProxyAddress(&net.TCPAddr{IP: net.IPv4zero, Port: 1080}))
+	assert.Equal(t, "192.168.1.2:1080", localProxyAddress(&net.TCPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 1080}))
+}
@@ -0,0 +1,27 @@
+package trafficmgr
+
+import (
+	"context"
+	"fmt"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+)
+
+// ProgressFunc receives the progress events of a connect or an intercept.
+type ProgressFunc func(*rpc.ProgressEvent)
+
+type progressKey struct{}
+
+// WithProgress returns a context that makes the session report the progress of the operation that is
+// performed using the context to the given function.
+func WithProgress(ctx context.Context, f ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, f)
+}
+
+// reportProgress reports a step of the operation that is performed using the given context. It's a no-op
+// unless the context was created using WithProgress.
+func reportProgress(ctx context.Context, stage rpc.ProgressEvent_Stage, done bool, format string, args ...interface{}) {
+	if f, ok := ctx.Value(progressKey{}).(ProgressFunc); ok {
+		f(&rpc.ProgressEvent{Stage: stage, Message: fmt.Sprintf(format, args...), Done: done})
+	}
+}
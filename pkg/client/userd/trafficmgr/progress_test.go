@@ -0,0 +1,26 @@
+package trafficmgr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+)
+
+func TestReportProgress(t *testing.T) {
+	ctx := context.Background()
+
+	// No-op without a progress function
+	reportProgress(ctx, rpc.ProgressEvent_CLUSTER_CONNECT, false, "Connecting")
+
+	var events []*rpc.ProgressEvent
+	ctx = WithProgress(ctx, func(e *rpc.ProgressEvent) { events = append(events, e) })
+	reportProgress(ctx, rpc.ProgressEvent_CLUSTER_CONNECT, false, "Connecting to %s", "test")
+	reportProgress(ctx, rpc.ProgressEvent_CLUSTER_CONNECT, true, "Connected")
+	assert.Equal(t, []*rpc.ProgressEvent{
+		{Stage: rpc.ProgressEvent_CLUSTER_CONNECT, Message: "Connecting to test"},
+		{Stage: rpc.ProgressEvent_CLUSTER_CONNECT, Message: "Connected", Done: true},
+	}, events)
+}
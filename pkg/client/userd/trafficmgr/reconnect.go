@@ -0,0 +1,98 @@
+package trafficmgr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/a8rcloud"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+)
+
+// reconnect replaces a session that the traffic-manager no longer knows about with a new one. The root
+// daemon is told to use the new session, and the intercepts of the old session are recreated. The
+// watchers pick up the new session when they retry their streams.
+func (tm *TrafficManager) reconnect(c context.Context) error {
+	// The intercepts of the last snapshot of the old session are the ones to recreate.
+	reqs := tm.interceptRequestsToRecreate()
+
+	apiKey, _ := tm.getCloudAPIKey(c, a8rcloud.KeyDescTrafficManager, false)
+	si, err := tm.managerClient.ArriveAsClient(c, &manager.ClientInfo{
+		Name:      tm.userAndHost,
+		InstallId: tm.installID,
+		Product:   "telepresence",
+		Version:   client.Version(),
+		ApiKey:    apiKey,
+	})
+	if err != nil {
+		return fmt.Errorf("manager.ArriveAsClient: %w", err)
+	}
+	tm.sessionLock.Lock()
+	tm.sessionInfo = si
+	tm.sessionLock.Unlock()
+	dlog.Infof(c, "Reconnected to the traffic-manager with session %s", si.SessionId)
+
+	if tm.rootDaemon != nil {
+		rootStatus, err := tm.rootDaemon.Reconnect(c, tm.getOutboundInfo(c))
+		if err != nil {
+			dlog.Errorf(c, "failed to reconnect the root daemon: %v", err)
+		} else {
+			tm.setSubnetConflicts(rootStatus.SubnetConflicts)
+		}
+	}
+
+	for _, ir := range reqs {
+		name := ir.Spec.Name
+		if ir.MountPoint != "" {
+			// The mount point belongs to the intercept of the old session, which is the one being recreated
+			if prev, ok := tm.mountPoints.Load(ir.MountPoint); ok && prev.(string) == name {
+				tm.mountPoints.Delete(ir.MountPoint)
+				tm.mountOptions.Delete(ir.MountPoint)
+			}
+		}
+		// The idempotency key of the old intercept would make the new request look like a retry of it
+		ir.IdempotencyKey = uuid.New().String()
+		result, err := tm.AddIntercept(c, ir)
+		switch {
+		case err != nil:
+			dlog.Errorf(c, "failed to recreate intercept %s: %v", name, err)
+		case result.Error != rpc.InterceptError_UNSPECIFIED:
+			dlog.Errorf(c, "failed to recreate intercept %s: %s %s", name, result.Error, result.ErrorText)
+		default:
+			dlog.Infof(c, "Recreated intercept %s", name)
+		}
+	}
+	return nil
+}
+
+// interceptRequestsToRecreate returns copies of the requests that created the intercepts in the current
+// snapshot, sorted by intercept name. Requests of intercepts that are no longer in the snapshot are forgotten.
+func (tm *TrafficManager) interceptRequestsToRecreate() []*rpc.CreateInterceptRequest {
+	current := make(map[string]struct{})
+	for _, ii := range tm.getCurrentIntercepts() {
+		current[ii.Spec.Name] = struct{}{}
+	}
+	var reqs []*rpc.CreateInterceptRequest
+	tm.interceptRequests.Range(func(key, value interface{}) bool {
+		if _, ok := current[key.(string)]; ok {
+			reqs = append(reqs, proto.Clone(value.(*rpc.CreateInterceptRequest)).(*rpc.CreateInterceptRequest))
+		} else {
+			tm.interceptRequests.Delete(key)
+		}
+		return true
+	})
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Spec.Name < reqs[j].Spec.Name })
+	return reqs
+}
+
+// storeInterceptRequest retains a copy of the given request so that the intercept can be recreated by
+// reconnect. The copy must be made before the request is amended by AddIntercept.
+func (tm *TrafficManager) storeInterceptRequest(ir *rpc.CreateInterceptRequest) {
+	tm.interceptRequests.Store(ir.Spec.Name, ir)
+}
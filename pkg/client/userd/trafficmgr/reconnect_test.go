@@ -0,0 +1,42 @@
+package trafficmgr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+func TestTrafficManager_interceptRequestsToRecreate(t *testing.T) {
+	tm := &TrafficManager{}
+	for _, name := range []string{"orders", "echo", "gone"} {
+		tm.storeInterceptRequest(&rpc.CreateInterceptRequest{
+			Spec:       &manager.InterceptSpec{Name: name},
+			MountPoint: "/tmp/" + name,
+		})
+	}
+	tm.setCurrentIntercepts(context.Background(), []*manager.InterceptInfo{
+		{Spec: &manager.InterceptSpec{Name: "orders"}},
+		{Spec: &manager.InterceptSpec{Name: "echo"}},
+		{Spec: &manager.InterceptSpec{Name: "local-only"}},
+	})
+
+	reqs := tm.interceptRequestsToRecreate()
+	require.Len(t, reqs, 2)
+	assert.Equal(t, "echo", reqs[0].Spec.Name)
+	assert.Equal(t, "orders", reqs[1].Spec.Name)
+
+	// The requests are copies, so that recreating an intercept doesn't change what's retained
+	reqs[0].MountPoint = ""
+	again := tm.interceptRequestsToRecreate()
+	require.Len(t, again, 2)
+	assert.Equal(t, "/tmp/echo", again[0].MountPoint)
+
+	// Requests of intercepts that are no longer in the snapshot are forgotten
+	_, ok := tm.interceptRequests.Load("gone")
+	assert.False(t, ok)
+}
@@ -0,0 +1,27 @@
+package trafficmgr
+
+import (
+	"context"
+	"net"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/recording"
+	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+// recordConn is the tunnel.ConnWrapper of the dialers that connect intercepted connections with their local
+// handlers. It returns a connection that records the traffic when the connection belongs to an intercept that
+// records its traffic.
+func (tm *TrafficManager) recordConn(ctx context.Context, id tunnel.ConnID, interceptID string, conn net.Conn) net.Conn {
+	if interceptID == "" || id.Protocol() != ipproto.TCP {
+		return conn
+	}
+	v, ok := tm.recorders.Load(interceptID)
+	if !ok {
+		return conn
+	}
+	r := v.(*recording.Recorder)
+	dlog.Debugf(ctx, "   CONN %s, recording the traffic of intercept %s in %s", id, r.Intercept(), r.Path())
+	return r.Wrap(ctx, conn)
+}
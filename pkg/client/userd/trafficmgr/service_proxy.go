@@ -14,6 +14,8 @@ import (
 
 	"github.com/datawire/dlib/dlog"
 	managerrpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
 )
 
 // mgrProxy implements rpc.ManagerServer, but just proxies all requests through a rpc.ManagerClient.
@@ -62,6 +64,14 @@ func (p *mgrProxy) GetIntercept(ctx context.Context, arg *managerrpc.GetIntercep
 	return client.GetIntercept(ctx, arg, callOptions...)
 }
 
+func (p *mgrProxy) GetInterceptAffinity(ctx context.Context, arg *managerrpc.GetInterceptRequest) (*managerrpc.InterceptAffinity, error) {
+	client, callOptions, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+	return client.GetInterceptAffinity(ctx, arg, callOptions...)
+}
+
 func (p *mgrProxy) Version(ctx context.Context, arg *empty.Empty) (*managerrpc.VersionInfo2, error) {
 	client, callOptions, err := p.get()
 	if err != nil {
@@ -85,6 +95,37 @@ func (p *mgrProxy) GetTelepresenceAPI(ctx context.Context, arg *empty.Empty) (*m
 	return client.GetTelepresenceAPI(ctx, arg, callOptions...)
 }
 
+func (p *mgrProxy) GetClientRequirements(ctx context.Context, arg *empty.Empty) (*managerrpc.ClientRequirements, error) {
+	client, callOptions, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+	return client.GetClientRequirements(ctx, arg, callOptions...)
+}
+
+func (p *mgrProxy) GetCloudArtifact(arg *managerrpc.CloudArtifactRequest, srv managerrpc.Manager_GetCloudArtifactServer) error {
+	client, callOptions, err := p.get()
+	if err != nil {
+		return err
+	}
+	cli, err := client.GetCloudArtifact(srv.Context(), arg, callOptions...)
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := cli.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err = srv.Send(chunk); err != nil {
+			return err
+		}
+	}
+}
+
 func (p *mgrProxy) CanConnectAmbassadorCloud(ctx context.Context, arg *empty.Empty) (*managerrpc.AmbassadorCloudConnection, error) {
 	client, callOptions, err := p.get()
 	if err != nil {
@@ -269,12 +310,14 @@ func sendLoop(ctx context.Context, who string, out tmSender, in <-chan *managerr
 }
 
 func (p *mgrProxy) Tunnel(fhClient managerrpc.Manager_TunnelServer) error {
-	client, callOptions, err := p.get()
+	mgr, callOptions, err := p.get()
 	if err != nil {
 		return err
 	}
 	ctx := fhClient.Context()
-	fhManager, err := client.Tunnel(ctx, callOptions...)
+	compression := tunnel.CompressionCallOptions(client.GetConfig(ctx).Grpc.TunnelCompression)
+	callOptions = append(callOptions[:len(callOptions):len(callOptions)], compression...)
+	fhManager, err := mgr.Tunnel(ctx, callOptions...)
 	if err != nil {
 		return err
 	}
@@ -357,6 +400,29 @@ func (p *mgrProxy) WatchClusterInfo(arg *managerrpc.SessionInfo, srv managerrpc.
 	}
 }
 
+func (p *mgrProxy) WatchServices(arg *managerrpc.SessionInfo, srv managerrpc.Manager_WatchServicesServer) error {
+	client, callOptions, err := p.get()
+	if err != nil {
+		return err
+	}
+	cli, err := client.WatchServices(srv.Context(), arg, callOptions...)
+	if err != nil {
+		return err
+	}
+	for {
+		snapshot, err := cli.Recv()
+		if err != nil {
+			if err == io.EOF || srv.Context().Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err = srv.Send(snapshot); err != nil {
+			return err
+		}
+	}
+}
+
 func (p *mgrProxy) SetLogLevel(ctx context.Context, request *managerrpc.LogLevelRequest) (*empty.Empty, error) {
 	client, callOptions, err := p.get()
 	if err != nil {
@@ -373,6 +439,29 @@ func (p *mgrProxy) GetLogs(ctx context.Context, request *managerrpc.GetLogsReque
 	return client.GetLogs(ctx, request, callOptions...)
 }
 
+func (p *mgrProxy) StreamLogs(request *managerrpc.StreamLogsRequest, srv managerrpc.Manager_StreamLogsServer) error {
+	client, callOptions, err := p.get()
+	if err != nil {
+		return err
+	}
+	cli, err := client.StreamLogs(srv.Context(), request, callOptions...)
+	if err != nil {
+		return err
+	}
+	for {
+		line, err := cli.Recv()
+		if err != nil {
+			if err == io.EOF || srv.Context().Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err = srv.Send(line); err != nil {
+			return err
+		}
+	}
+}
+
 func (p *mgrProxy) WatchLogLevel(_ *empty.Empty, _ managerrpc.Manager_WatchLogLevelServer) error {
 	return errors.New("must call manager.WatchLogLevel from an agent (intercepted Pod), not from a client (workstation)")
 }
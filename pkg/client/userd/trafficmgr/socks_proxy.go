@@ -0,0 +1,97 @@
+package trafficmgr
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/datawire/dlib/dcontext"
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/sysproxy"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+	"github.com/telepresenceio/telepresence/v2/pkg/socks"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+// serveProxy serves a SOCKS5 and HTTP CONNECT proxy on the proxyAddress. Connections made to that
+// proxy are resolved by the traffic-manager and tunneled to the cluster without involving the root
+// daemon.
+func (tm *TrafficManager) serveProxy(c context.Context) error {
+	l, err := net.Listen("tcp", tm.proxyAddress)
+	if err != nil {
+		return fmt.Errorf("unable to listen on proxy address %s: %w", tm.proxyAddress, err)
+	}
+	dlog.Infof(c, "Serving SOCKS5 and HTTP CONNECT proxy on %s", l.Addr())
+	s := &socks.Server{
+		Resolve: tm.proxyResolve,
+		Forward: tm.proxyForward,
+	}
+	if tm.systemProxy {
+		tm.pacLock.Lock()
+		tm.pacProxyAddress = localProxyAddress(l.Addr())
+		tm.pacLock.Unlock()
+		s.PAC = tm.proxyAutoConfig
+		if err = sysproxy.Set(c, tm.proxyAutoConfigURL()); err != nil {
+			_ = l.Close()
+			return err
+		}
+		dlog.Infof(c, "System proxy uses the proxy auto-config at %s", tm.proxyAutoConfigURL())
+		defer func() {
+			if err := sysproxy.Restore(dcontext.WithoutCancel(c)); err != nil {
+				dlog.Errorf(c, "unable to restore the system proxy: %v", err)
+			}
+		}()
+	}
+	return s.Serve(c, l)
+}
+
+// proxyAutoConfigURL returns the URL of the proxy auto-config file that the system proxy uses, or an empty
+// string when the system proxy isn't configured.
+func (tm *TrafficManager) proxyAutoConfigURL() string {
+	if !tm.systemProxy {
+		return ""
+	}
+	tm.pacLock.Lock()
+	defer tm.pacLock.Unlock()
+	if tm.pacProxyAddress == "" {
+		return ""
+	}
+	return "http://" + tm.pacProxyAddress + socks.PACPath
+}
+
+func (tm *TrafficManager) proxyResolve(c context.Context, host string) (net.IP, error) {
+	r, err := tm.managerClient.LookupHost(c, &manager.LookupHostRequest{
+		Session: tm.session(),
+		Host:    host,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Ips) == 0 {
+		return nil, nil
+	}
+	return net.IP(r.Ips[0]), nil
+}
+
+func (tm *TrafficManager) proxyForward(c context.Context, conn net.Conn, ip net.IP, port uint16) error {
+	srcIP, srcPort, err := iputil.SplitToIPPort(conn.RemoteAddr())
+	if err != nil {
+		return err
+	}
+	id := tunnel.NewConnID(tunnel.IPProto(conn.RemoteAddr().Network()), srcIP, ip, srcPort, port)
+	ms, err := tm.managerClient.Tunnel(c, tunnel.CompressionCallOptions(client.GetConfig(c).Grpc.TunnelCompression)...)
+	if err != nil {
+		return fmt.Errorf("call to manager.Tunnel() failed. Id %s: %w", id, err)
+	}
+	tc := client.GetConfig(c).Timeouts
+	s, err := tunnel.NewClientStream(c, ms, id, tm.session().SessionId, tc.Get(client.TimeoutRoundtripLatency), tc.Get(client.TimeoutEndpointDial))
+	if err != nil {
+		return err
+	}
+	d := tunnel.NewConnEndpoint(s, conn)
+	d.Start(tunnel.WithTimeouts(c, client.GetConfig(c).Tunnel.Timeouts()))
+	<-d.Done()
+	return nil
+}
@@ -2,12 +2,14 @@ package trafficmgr
 
 import (
 	"context"
+	cryptorand "crypto/rand"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
 	"os/user"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,6 +20,7 @@ import (
 	"google.golang.org/protobuf/types/known/durationpb"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/datawire/dlib/dcontext"
 	"github.com/datawire/dlib/dgroup"
@@ -29,12 +32,12 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/a8rcloud"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/netmon"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/scout"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/auth"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/k8s"
 	"github.com/telepresenceio/telepresence/v2/pkg/dnet"
 	"github.com/telepresenceio/telepresence/v2/pkg/header"
-	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
 	"github.com/telepresenceio/telepresence/v2/pkg/restapi"
@@ -52,16 +55,22 @@ type Session interface {
 	restapi.AgentState
 	AddIntercept(context.Context, *rpc.CreateInterceptRequest) (*rpc.InterceptResult, error)
 	CanIntercept(context.Context, *rpc.CreateInterceptRequest) (*rpc.InterceptResult, k8sapi.Workload)
+	ApplyRoutes(context.Context) (*rpc.RoutesInfo, error)
+	GetNetworkConfig(context.Context) (*daemon.NetworkConfig, error)
 	Status(context.Context) *rpc.ConnectInfo
 	IngressInfos(c context.Context) ([]*manager.IngressInfo, error)
 	RemoveIntercept(context.Context, string) error
+	RemoveInterceptByIdempotencyKey(context.Context, string) error
+	RemoveAllIntercepts(context.Context) ([]string, error)
+	UpdateMappedNamespaces(context.Context, []string) *rpc.SetMappedNamespacesResult
 	Run(context.Context) error
 	Uninstall(context.Context, *rpc.UninstallRequest) (*rpc.UninstallResult, error)
 	UpdateStatus(context.Context, *rpc.ConnectRequest) *rpc.ConnectInfo
 	WatchWorkloads(context.Context, *rpc.WatchWorkloadsRequest, rpc.Connector_WatchWorkloadsServer) error
 	WithK8sInterface(context.Context) context.Context
-	WorkloadInfoSnapshot(context.Context, []string, rpc.ListRequest_Filter, bool) (*rpc.WorkloadInfoSnapshot, error)
+	WorkloadInfoSnapshot(context.Context, []string, *rpc.ListRequest, bool) (*rpc.WorkloadInfoSnapshot, error)
 	ManagerClient() manager.ManagerClient
+	UpdateAPIKeys(context.Context) error
 }
 
 type Service interface {
@@ -82,21 +91,81 @@ type TrafficManager struct {
 	installID   string // telepresence's install ID
 	userAndHost string // "laptop-username@laptop-hostname"
 
-	getCloudAPIKey func(context.Context, string, bool) (string, error)
+	getCloudAPIKey   func(context.Context, string, bool) (string, error)
+	getCloudUserInfo func(context.Context, bool, bool) (*connector.UserInfo, error)
 
 	ingressInfo []*manager.IngressInfo
 
 	// manager client
 	managerClient manager.ManagerClient
 
-	// search paths are propagated to the rootDaemon
+	// search paths are propagated to the rootDaemon. It's nil when the session
+	// runs in proxy-only or in-cluster mode.
 	rootDaemon daemon.DaemonClient
 
-	sessionInfo *manager.SessionInfo // sessionInfo returned by the traffic-manager
+	// proxyAddress is the address of the SOCKS5/HTTP proxy when the session runs
+	// in proxy-only mode.
+	proxyAddress string
+
+	// systemProxy is true when the system proxy is configured to use a proxy auto-config file that
+	// directs requests for the cluster to the proxy at proxyAddress.
+	systemProxy bool
+
+	// processRouting is true when the root daemon only routes the traffic of processes started with
+	// "telepresence run" through the TUN device.
+	processRouting bool
+
+	// pacProxyAddress is the address that the proxy auto-config file directs requests to. The pacSubnets and
+	// pacClusterDomain are obtained from the traffic-manager when the file is first requested. Guarded by pacLock.
+	pacLock          sync.Mutex
+	pacProxyAddress  string
+	pacSubnets       []*net.IPNet
+	pacClusterDomain string
+
+	// portForwardFallback is the reason why the root daemon couldn't create the virtual network device. When
+	// set, the session runs without the root daemon and the loopbackForwards give access to the cluster's services.
+	portForwardFallback string
+	loopbackForwards    *loopbackForwards
+
+	// suffixNamespaces are the DNS suffix to namespace mappings given when connecting
+	suffixNamespaces map[string]string
+
+	// configDrift describes where the client configuration differs from what the
+	// traffic-manager runs with
+	configDrift []string
+
+	// versionSkew describes where the client and traffic-manager versions differ more than recommended
+	versionSkew []string
+
+	// proxyHostWarnings describes the never-proxy host names that the root daemon can't honor
+	proxyHostWarnings []string
+
+	// managerVersion is the version that the traffic-manager reported when the session was created
+	managerVersion string
+
+	// subnetConflicts describes the cluster subnets that the root daemon found to overlap with
+	// local networks when it connected or when routes were last applied. Guarded by routesLock.
+	routesLock      sync.Mutex
+	subnetConflicts []string
+
+	// sessionInfo returned by the traffic-manager. It's replaced when the session is reestablished, so it
+	// must be obtained using session().
+	sessionLock sync.Mutex
+	sessionInfo *manager.SessionInfo
+
+	// interceptRequests contains the *rpc.CreateInterceptRequest of each intercept, keyed by intercept name,
+	// so that the intercepts can be recreated when the session is reestablished.
+	interceptRequests sync.Map
 
 	// Map of desired mount points for intercepts
 	mountPoints sync.Map
 
+	// Map of *mountOptions, keyed by mount point
+	mountOptions sync.Map
+
+	// mountSecret is the secret that the WebDAV mount passwords of the intercepts are derived from
+	mountSecret []byte
+
 	// Map of mutexes, so that we don't create and delete
 	// mount points concurrently
 	mountMutexes sync.Map
@@ -129,6 +198,13 @@ type TrafficManager struct {
 	// agentWaiters contains chan *manager.AgentInfo keyed by agent <name>.<namespace>
 	agentWaiters sync.Map
 
+	// interceptKeys are the keys of the intercepts that use end-to-end encryption
+	interceptKeys interceptKeys
+
+	// recorders contains the *recording.Recorder of the intercepts that record their traffic, keyed by
+	// intercept ID
+	recorders sync.Map
+
 	sessionServices []SessionService
 	sr              *scout.Reporter
 }
@@ -142,18 +218,23 @@ type interceptResult struct {
 func NewSession(c context.Context, sr *scout.Reporter, cr *rpc.ConnectRequest, svc Service, extraServices []SessionService) (Session, *connector.ConnectInfo) {
 	sr.Report(c, "connect")
 
-	rootDaemon, err := svc.RootDaemonClient(c)
-	if err != nil {
-		return nil, connectError(rpc.ConnectInfo_DAEMON_FAILED, err)
-	}
-
 	dlog.Info(c, "Connecting to k8s cluster...")
+	reportProgress(c, rpc.ProgressEvent_CLUSTER_CONNECT, false, "Connecting to the Kubernetes cluster")
 	cluster, err := connectCluster(c, cr)
 	if err != nil {
 		dlog.Errorf(c, "unable to track k8s cluster: %+v", err)
 		return nil, connectError(rpc.ConnectInfo_CLUSTER_FAILED, err)
 	}
 	dlog.Infof(c, "Connected to context %s (%s)", cluster.Context, cluster.Server)
+	reportProgress(c, rpc.ProgressEvent_CLUSTER_CONNECT, true, "Connected to context %s (%s)", cluster.Context, cluster.Server)
+
+	// A pod in the cluster already has access to the cluster's network and DNS, so the root daemon isn't needed.
+	var rootDaemon daemon.DaemonClient
+	if cr.ProxyAddress == "" && !cluster.InCluster {
+		if rootDaemon, err = svc.RootDaemonClient(c); err != nil {
+			return nil, connectError(rpc.ConnectInfo_DAEMON_FAILED, err)
+		}
+	}
 
 	// Phone home with the information about the size of the cluster
 	c = cluster.WithK8sInterface(c)
@@ -166,7 +247,8 @@ func NewSession(c context.Context, sr *scout.Reporter, cr *rpc.ConnectRequest, s
 	connectStart := time.Now()
 
 	dlog.Info(c, "Connecting to traffic manager...")
-	tmgr, err := connectMgr(c, cluster, sr.InstallID(), svc, rootDaemon)
+	reportProgress(c, rpc.ProgressEvent_MANAGER_CONNECT, false, "Connecting to the traffic-manager")
+	tmgr, err := connectMgr(c, cluster, sr.InstallID(), svc, rootDaemon, cr.ManagerValues)
 
 	if err != nil {
 		dlog.Errorf(c, "Unable to connect to TrafficManager: %s", err)
@@ -175,58 +257,108 @@ func NewSession(c context.Context, sr *scout.Reporter, cr *rpc.ConnectRequest, s
 
 	tmgr.sessionServices = extraServices
 	tmgr.sr = sr
+	tmgr.proxyAddress = cr.ProxyAddress
+	tmgr.systemProxy = cr.SystemProxy
+	tmgr.processRouting = cr.ProcessRouting
+	tmgr.suffixNamespaces = cr.SuffixNamespaces
+	tmgr.configDrift = tmgr.getConfigDrift(c)
+	if tmgr.versionSkew, err = tmgr.getVersionSkew(c); err != nil {
+		dlog.Errorf(c, "Incompatible traffic-manager: %v", err)
+		_, _ = tmgr.managerClient.Depart(c, tmgr.session())
+		return nil, connectError(rpc.ConnectInfo_TRAFFIC_MANAGER_FAILED, err)
+	}
+	reportProgress(c, rpc.ProgressEvent_MANAGER_CONNECT, true, "Connected to the traffic-manager")
 
 	// Must call SetManagerClient before calling daemon.Connect which tells the
 	// daemon to use the proxy.
 	svc.SetManagerClient(tmgr.managerClient)
 
-	// Tell daemon what it needs to know in order to establish outbound traffic to the cluster
-	oi := tmgr.getOutboundInfo(c)
+	if rootDaemon != nil {
+		reportProgress(c, rpc.ProgressEvent_NETWORK, false, "Configuring the network and DNS")
+		rootStatus, err := connectRootDaemon(c, rootDaemon, tmgr.getOutboundInfo(c))
+		switch {
+		case err == nil:
+			tmgr.setSubnetConflicts(rootStatus.SubnetConflicts)
+			tmgr.proxyHostWarnings = rootStatus.ProxyHostWarnings
+			reportProgress(c, rpc.ProgressEvent_NETWORK, true, "Configured the network and DNS")
+		case client.IsNoTunDeviceError(err):
+			// The virtual network device couldn't be created. Use loopback port-forwards instead.
+			dlog.Warnf(c, "Falling back to loopback port-forwards: %s", status.Convert(err).Message())
+			tmgr.rootDaemon = nil
+			tmgr.portForwardFallback = status.Convert(err).Message()
+			tmgr.loopbackForwards = newLoopbackForwards()
+			reportProgress(c, rpc.ProgressEvent_NETWORK, true, "Using loopback port-forwards instead of a virtual network")
+		default:
+			return nil, connectError(rpc.ConnectInfo_DAEMON_FAILED, err)
+		}
+	} else if cluster.InCluster {
+		dlog.Infof(c, "Running in-cluster without the root daemon")
+	} else {
+		dlog.Infof(c, "Running in proxy-only mode without the root daemon")
+	}
+	tmgr.SetNamespaceListener(tmgr.updateDaemonNamespaces)
 
+	// Collect data on how long connection time took
+	dlog.Debug(c, "Finished connecting to traffic manager")
+	sr.Report(c, "finished_connecting_traffic_manager", scout.Entry{
+		Key: "connect_duration", Value: time.Since(connectStart).Seconds()})
+
+	ret := &rpc.ConnectInfo{
+		Error:               rpc.ConnectInfo_UNSPECIFIED,
+		ClusterContext:      cluster.Config.Context,
+		ClusterServer:       cluster.Config.Server,
+		ClusterId:           cluster.GetClusterId(c),
+		SessionInfo:         tmgr.session(),
+		Agents:              &manager.AgentInfoSnapshot{Agents: tmgr.getCurrentAgents()},
+		Intercepts:          &manager.InterceptInfoSnapshot{Intercepts: tmgr.getCurrentIntercepts()},
+		ProxyAddress:        tmgr.proxyAddress,
+		ProxyAutoConfigUrl:  tmgr.proxyAutoConfigURL(),
+		PortForwardFallback: tmgr.portForwardFallback,
+		ConfigDrift:         tmgr.configDrift,
+		VersionSkew:         tmgr.versionSkew,
+		SubnetConflicts:     tmgr.getSubnetConflicts(),
+		ProxyHostWarnings:   tmgr.proxyHostWarnings,
+		ManagerVersion:      tmgr.managerVersion,
+		ManagerNamespace:    cluster.GetManagerNamespace(),
+		InCluster:           cluster.InCluster,
+	}
+	return tmgr, ret
+}
+
+// connectRootDaemon tells the root daemon what it needs to know in order to establish outbound
+// traffic to the cluster, and returns the root daemon's status.
+func connectRootDaemon(c context.Context, rootDaemon daemon.DaemonClient, oi *daemon.OutboundInfo) (*daemon.DaemonStatus, error) {
 	dlog.Debug(c, "Connecting to root daemon")
-	var rootStatus *daemon.DaemonStatus
 	for attempt := 1; ; attempt++ {
-		if rootStatus, err = rootDaemon.Connect(c, oi); err != nil {
+		rootStatus, err := rootDaemon.Connect(c, oi)
+		if err != nil {
 			dlog.Errorf(c, "failed to connect to root daemon: %v", err)
-			return nil, connectError(rpc.ConnectInfo_DAEMON_FAILED, err)
+			if status.Code(err) == codes.FailedPrecondition && !client.IsNoTunDeviceError(err) {
+				// The root daemon refuses to connect because of how the workstation is configured
+				err = errcat.Config.New(status.Convert(err).Message())
+			}
+			return nil, err
 		}
 		oc := rootStatus.OutboundConfig
 		if oc == nil || oc.Session == nil {
 			// This is an internal error. Something is wrong with the root daemon.
-			return nil, connectError(rpc.ConnectInfo_DAEMON_FAILED, errors.New("root daemon's OutboundConfig has no Session"))
+			return nil, errors.New("root daemon's OutboundConfig has no Session")
 		}
 		if oc.Session.SessionId == oi.Session.SessionId {
-			break
+			dlog.Debug(c, "Connected to root daemon")
+			return rootStatus, nil
 		}
 
 		// Root daemon was running an old session. This indicates that this daemon somehow
 		// crashed without disconnecting. So let's do that now, and then reconnect...
 		if attempt == 2 {
 			// ...or not, since we've already done it.
-			return nil, connectError(rpc.ConnectInfo_DAEMON_FAILED, errors.New("unable to reconnect"))
+			return nil, errors.New("unable to reconnect")
 		}
 		if _, err = rootDaemon.Disconnect(c, &empty.Empty{}); err != nil {
-			return nil, connectError(rpc.ConnectInfo_DAEMON_FAILED, fmt.Errorf("failed to disconnect from the root daemon: %w", err))
+			return nil, fmt.Errorf("failed to disconnect from the root daemon: %w", err)
 		}
 	}
-	dlog.Debug(c, "Connected to root daemon")
-	tmgr.SetNamespaceListener(tmgr.updateDaemonNamespaces)
-
-	// Collect data on how long connection time took
-	dlog.Debug(c, "Finished connecting to traffic manager")
-	sr.Report(c, "finished_connecting_traffic_manager", scout.Entry{
-		Key: "connect_duration", Value: time.Since(connectStart).Seconds()})
-
-	ret := &rpc.ConnectInfo{
-		Error:          rpc.ConnectInfo_UNSPECIFIED,
-		ClusterContext: cluster.Config.Context,
-		ClusterServer:  cluster.Config.Server,
-		ClusterId:      cluster.GetClusterId(c),
-		SessionInfo:    tmgr.session(),
-		Agents:         &manager.AgentInfoSnapshot{Agents: tmgr.getCurrentAgents()},
-		Intercepts:     &manager.InterceptInfoSnapshot{Intercepts: tmgr.getCurrentIntercepts()},
-	}
-	return tmgr, ret
 }
 
 func (tm *TrafficManager) ManagerClient() manager.ManagerClient {
@@ -235,7 +367,7 @@ func (tm *TrafficManager) ManagerClient() manager.ManagerClient {
 
 // connectCluster returns a configured cluster instance
 func connectCluster(c context.Context, cr *rpc.ConnectRequest) (*k8s.Cluster, error) {
-	config, err := k8s.NewConfig(c, cr.KubeFlags)
+	config, err := k8s.NewConfigFromData(c, cr.KubeFlags, cr.KubeconfigData)
 	if err != nil {
 		return nil, err
 	}
@@ -255,7 +387,14 @@ func connectCluster(c context.Context, cr *rpc.ConnectRequest) (*k8s.Cluster, er
 }
 
 // connectMgr returns a session for the given cluster that is connected to the traffic-manager.
-func connectMgr(c context.Context, cluster *k8s.Cluster, installID string, svc Service, rootDaemon daemon.DaemonClient) (*TrafficManager, error) {
+func connectMgr(
+	c context.Context,
+	cluster *k8s.Cluster,
+	installID string,
+	svc Service,
+	rootDaemon daemon.DaemonClient,
+	managerValues []byte,
+) (*TrafficManager, error) {
 	clientConfig := client.GetConfig(c)
 	tos := &clientConfig.Timeouts
 
@@ -277,40 +416,52 @@ func connectMgr(c context.Context, cluster *k8s.Cluster, installID string, svc S
 	}
 
 	// Ensure that we have a traffic-manager to talk to.
-	ti, err := NewTrafficManagerInstaller(cluster)
-	if err != nil {
-		return nil, errors.Wrap(err, "new installer")
-	}
+	userAndHost := fmt.Sprintf("%s@%s", userinfo.Username, host)
+	ti := newTrafficManagerInstaller(cluster, userAndHost)
 
 	dlog.Debug(c, "ensure that traffic-manager exists")
-	if err = ti.EnsureManager(c); err != nil {
+	if err = ti.EnsureManager(c, managerValues); err != nil {
 		dlog.Errorf(c, "failed to ensure traffic-manager, %v", err)
-		return nil, fmt.Errorf("failed to ensure traffic manager: %w", err)
+		return nil, err
 	}
 
-	dlog.Debug(c, "traffic-manager started, creating port-forward")
 	restConfig, err := cluster.ConfigFlags.ToRESTConfig()
 	if err != nil {
 		return nil, errors.Wrap(err, "ToRESTConfig")
 	}
-	grpcDialer, err := dnet.NewK8sPortForwardDialer(c, restConfig, k8sapi.GetK8sInterface(c))
+	managerPort, transport, err := managerTransport(c, restConfig, cluster.GetManagerNamespace(), userAndHost)
 	if err != nil {
 		return nil, err
 	}
-	grpcAddr := net.JoinHostPort(
-		"svc/traffic-manager."+cluster.GetManagerNamespace(),
-		fmt.Sprint(install.ManagerPortHTTP))
+	opts := []grpc.DialOption{
+		transport,
+		grpc.WithNoProxy(),
+		grpc.WithBlock(),
+		grpc.WithReturnConnectionError()}
+
+	var grpcAddr string
+	if cluster.InCluster {
+		// The traffic-manager service can be dialed directly from within the cluster.
+		dlog.Debug(c, "traffic-manager found, dialing its service")
+		grpcAddr = net.JoinHostPort(
+			"traffic-manager."+cluster.GetManagerNamespace(),
+			fmt.Sprint(managerPort))
+	} else {
+		dlog.Debug(c, "traffic-manager found, creating port-forward")
+		grpcDialer, err := dnet.NewK8sPortForwardDialer(c, restConfig, k8sapi.GetK8sInterface(c))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithContextDialer(grpcDialer))
+		grpcAddr = net.JoinHostPort(
+			"svc/traffic-manager."+cluster.GetManagerNamespace(),
+			fmt.Sprint(managerPort))
+	}
 
 	// First check. Establish connection
 	tc, tCancel := tos.TimeoutContext(c, client.TimeoutTrafficManagerAPI)
 	defer tCancel()
 
-	opts := []grpc.DialOption{grpc.WithContextDialer(grpcDialer),
-		grpc.WithInsecure(),
-		grpc.WithNoProxy(),
-		grpc.WithBlock(),
-		grpc.WithReturnConnectionError()}
-
 	var conn *grpc.ClientConn
 	if conn, err = grpc.DialContext(tc, grpcAddr, opts...); err != nil {
 		return nil, client.CheckTimeout(tc, fmt.Errorf("dial manager: %w", err))
@@ -321,7 +472,6 @@ func connectMgr(c context.Context, cluster *k8s.Cluster, installID string, svc S
 		}
 	}()
 
-	userAndHost := fmt.Sprintf("%s@%s", userinfo.Username, host)
 	mClient := manager.NewManagerClient(conn)
 
 	dlog.Debugf(c, "traffic-manager port-forward established, making client known to the traffic-manager as %q", userAndHost)
@@ -331,21 +481,29 @@ func connectMgr(c context.Context, cluster *k8s.Cluster, installID string, svc S
 		Product:   "telepresence",
 		Version:   client.Version(),
 		ApiKey:    apiKey,
+
+		TunnelCompression: client.GetConfig(c).Grpc.TunnelCompression,
 	})
 	if err != nil {
 		return nil, client.CheckTimeout(tc, fmt.Errorf("manager.ArriveAsClient: %w", err))
 	}
+	mountSecret := make([]byte, 32)
+	if _, err = cryptorand.Read(mountSecret); err != nil {
+		return nil, err
+	}
 
 	return &TrafficManager{
-		installer:       ti.(*installer),
-		installID:       installID,
-		userAndHost:     userAndHost,
-		getCloudAPIKey:  svc.LoginExecutor().GetCloudAPIKey,
-		managerClient:   mClient,
-		sessionInfo:     si,
-		rootDaemon:      rootDaemon,
-		localIntercepts: map[string]string{},
-		wlWatcher:       newWASWatcher(),
+		installer:        ti,
+		installID:        installID,
+		userAndHost:      userAndHost,
+		getCloudAPIKey:   svc.LoginExecutor().GetCloudAPIKey,
+		getCloudUserInfo: svc.LoginExecutor().GetCloudUserInfo,
+		managerClient:    mClient,
+		sessionInfo:      si,
+		rootDaemon:       rootDaemon,
+		localIntercepts:  map[string]string{},
+		wlWatcher:        newWASWatcher(),
+		mountSecret:      mountSecret,
 	}, nil
 }
 
@@ -385,6 +543,9 @@ func (tm *TrafficManager) updateDaemonNamespaces(c context.Context) {
 
 	// Pass current mapped namespaces as plain names (no ending dot). The DNS-resolver will
 	// create special mapping for those, allowing names like myservice.mynamespace to be resolved
+	if tm.rootDaemon == nil {
+		return
+	}
 	paths := tm.GetCurrentNamespaces(false)
 	dlog.Debugf(c, "posting search paths %v and namespaces %v", paths, namespaces)
 	if _, err := tm.rootDaemon.SetDnsSearchPath(c, &daemon.Paths{Paths: paths, Namespaces: namespaces}); err != nil {
@@ -406,6 +567,13 @@ func (tm *TrafficManager) Run(c context.Context) error {
 	g.Go("intercept-port-forward", tm.workerPortForwardIntercepts)
 	g.Go("agent-watcher", tm.agentInfoWatcher)
 	g.Go("dial-request-watcher", tm.dialRequestWatcher)
+	g.Go("intercept-key-exchange", tm.exchangeInterceptKeys)
+	if tm.proxyAddress != "" {
+		g.Go("proxy", tm.serveProxy)
+	}
+	if tm.loopbackForwards != nil {
+		g.Go("loopback-forwards", tm.serveLoopbackForwards)
+	}
 	for _, svc := range tm.sessionServices {
 		g.Go(svc.Name(), func(c context.Context) error {
 			return svc.Run(c, tm.sr, tm)
@@ -414,17 +582,52 @@ func (tm *TrafficManager) Run(c context.Context) error {
 	return g.Wait()
 }
 
+// workloadMatcher returns a function that accepts workloads of the given kinds that match the given label selector.
+// Workloads of all kinds are accepted when kinds is empty, and the kinds are matched case-insensitively.
+func workloadMatcher(kinds []string, labelSelector string) (func(k8sapi.Workload) bool, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, errcat.User.Newf("invalid label selector %q: %v", labelSelector, err)
+	}
+	for _, kind := range kinds {
+		switch strings.ToLower(kind) {
+		case "deployment", "replicaset", "statefulset", "rollout":
+		default:
+			return nil, errcat.User.Newf("unsupported workload kind %q, must be one of Deployment, ReplicaSet, StatefulSet, or Rollout", kind)
+		}
+	}
+	return func(wl k8sapi.Workload) bool {
+		if len(kinds) > 0 {
+			found := false
+			for _, kind := range kinds {
+				if strings.EqualFold(kind, wl.GetKind()) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return selector.Matches(labels.Set(wl.GetLabels()))
+	}, nil
+}
+
 func (tm *TrafficManager) session() *manager.SessionInfo {
+	tm.sessionLock.Lock()
+	defer tm.sessionLock.Unlock()
 	return tm.sessionInfo
 }
 
-// getInfosForWorkloads returns a list of workloads found in the given namespace that fulfils the given filter criteria.
+// getInfosForWorkloads returns a list of workloads found in the given namespace that fulfils the given filter criteria
+// and are accepted by the match function.
 func (tm *TrafficManager) getInfosForWorkloads(
 	ctx context.Context,
 	namespaces []string,
 	iMap map[string]*manager.InterceptInfo,
 	aMap map[string]*manager.AgentInfo,
 	filter rpc.ListRequest_Filter,
+	match func(k8sapi.Workload) bool,
 ) ([]*rpc.WorkloadInfo, error) {
 	wis := make([]*rpc.WorkloadInfo, 0)
 	var err error
@@ -434,6 +637,9 @@ func (tm *TrafficManager) getInfosForWorkloads(
 			return
 		}
 		for _, workload := range wls {
+			if !match(workload) {
+				continue
+			}
 			name := workload.GetName()
 			dlog.Debugf(ctx, "Getting info for %s %s.%s, matching service %s.%s", workload.GetKind(), name, workload.GetNamespace(), svc.Name, svc.Namespace)
 			wlInfo := &rpc.WorkloadInfo{
@@ -464,7 +670,7 @@ func (tm *TrafficManager) WatchWorkloads(c context.Context, wr *rpc.WatchWorkloa
 		case <-c.Done():
 			return nil
 		case <-snapshotAvailable:
-			snapshot, err := tm.WorkloadInfoSnapshot(c, wr.Namespaces, rpc.ListRequest_INTERCEPTABLE, false)
+			snapshot, err := tm.WorkloadInfoSnapshot(c, wr.Namespaces, &rpc.ListRequest{Filter: rpc.ListRequest_INTERCEPTABLE}, false)
 			if err != nil {
 				return status.Errorf(codes.Unavailable, "failed to create WorkloadInfoSnapshot: %v", err)
 			}
@@ -476,12 +682,18 @@ func (tm *TrafficManager) WatchWorkloads(c context.Context, wr *rpc.WatchWorkloa
 	}
 }
 
+// WorkloadInfoSnapshot returns the workloads in the given namespaces that match the filter, kinds, and label
+// selector of the given ListRequest. The namespace of the ListRequest is ignored.
 func (tm *TrafficManager) WorkloadInfoSnapshot(
 	ctx context.Context,
 	namespaces []string,
-	filter rpc.ListRequest_Filter,
+	lr *rpc.ListRequest,
 	includeLocalIntercepts bool,
 ) (*rpc.WorkloadInfoSnapshot, error) {
+	match, err := workloadMatcher(lr.Kinds, lr.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
 	tm.WaitForNSSync(ctx)
 	tm.wlWatcher.waitForSync(ctx)
 
@@ -514,7 +726,7 @@ nextIs:
 			aMap[k] = v
 		}
 	}
-	workloadInfos, err := tm.getInfosForWorkloads(ctx, nss, iMap, aMap, filter)
+	workloadInfos, err := tm.getInfosForWorkloads(ctx, nss, iMap, aMap, lr.Filter, match)
 	if err != nil {
 		return nil, err
 	}
@@ -537,9 +749,51 @@ nextIs:
 	return &rpc.WorkloadInfoSnapshot{Workloads: workloadInfos}, nil
 }
 
+// UpdateAPIKeys passes the current API keys on to the traffic-manager, which uses the key of the session
+// and the keys of its intercepts when it talks to Ambassador Cloud on behalf of this client.
+func (tm *TrafficManager) UpdateAPIKeys(c context.Context) error {
+	apiKey, err := tm.getCloudAPIKey(c, a8rcloud.KeyDescTrafficManager, false)
+	if err != nil {
+		return err
+	}
+	if _, err = tm.managerClient.Remain(c, &manager.RemainRequest{Session: tm.session(), ApiKey: apiKey}); err != nil {
+		return err
+	}
+	for _, ii := range tm.getCurrentIntercepts() {
+		if ii.ApiKey == "" {
+			// Created without a key, so there's nothing to update
+			continue
+		}
+		if apiKey, err = tm.getCloudAPIKey(c, a8rcloud.KeyDescAgent(ii.Spec), false); err != nil {
+			return err
+		}
+		if apiKey == ii.ApiKey {
+			continue
+		}
+		_, err = tm.managerClient.UpdateIntercept(c, &manager.UpdateInterceptRequest{
+			Session: tm.session(),
+			Name:    ii.Spec.Name,
+			ApiKey:  apiKey,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to update the API key of intercept %s: %w", ii.Spec.Name, err)
+		}
+	}
+	return nil
+}
+
 func (tm *TrafficManager) remain(c context.Context) error {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
+
+	// A network change is likely to break the session, so it's checked right away instead of at the next tick.
+	networkChanged := make(chan struct{}, 1)
+	go netmon.Watch(c, netmon.DefaultInterval, nil, func(context.Context) {
+		select {
+		case networkChanged <- struct{}{}:
+		default:
+		}
+	})
 	for {
 		select {
 		case <-c.Done():
@@ -547,16 +801,26 @@ func (tm *TrafficManager) remain(c context.Context) error {
 			_, _ = tm.managerClient.Depart(dcontext.WithoutCancel(c), tm.session())
 			return nil
 		case <-ticker.C:
-			_, err := tm.managerClient.Remain(c, &manager.RemainRequest{
-				Session: tm.session(),
-				ApiKey: func() string {
-					// Discard any errors; including an apikey with this request
-					// is optional.  We might not even be logged in.
-					tok, _ := tm.getCloudAPIKey(c, a8rcloud.KeyDescTrafficManager, false)
-					return tok
-				}(),
-			})
-			if err != nil && c.Err() == nil {
+		case <-networkChanged:
+		}
+		_, err := tm.managerClient.Remain(c, &manager.RemainRequest{
+			Session: tm.session(),
+			ApiKey: func() string {
+				// Discard any errors; including an apikey with this request
+				// is optional.  We might not even be logged in.
+				tok, _ := tm.getCloudAPIKey(c, a8rcloud.KeyDescTrafficManager, false)
+				return tok
+			}(),
+		})
+		if err != nil && c.Err() == nil {
+			if status.Code(err) == codes.NotFound {
+				// The traffic-manager has forgotten this session, typically because the workstation was
+				// asleep or offline for longer than the session TTL.
+				dlog.Warnf(c, "the traffic-manager no longer knows this session; reconnecting: %v", err)
+				if err = tm.reconnect(c); err != nil && c.Err() == nil {
+					dlog.Errorf(c, "unable to reconnect to the traffic-manager: %v", err)
+				}
+			} else {
 				dlog.Error(c, err)
 			}
 		}
@@ -564,7 +828,7 @@ func (tm *TrafficManager) remain(c context.Context) error {
 }
 
 func (tm *TrafficManager) UpdateStatus(c context.Context, cr *rpc.ConnectRequest) *rpc.ConnectInfo {
-	config, err := k8s.NewConfig(c, cr.KubeFlags)
+	config, err := k8s.NewConfigFromData(c, cr.KubeFlags, cr.KubeconfigData)
 	if err != nil {
 		return connectError(rpc.ConnectInfo_CLUSTER_FAILED, err)
 	}
@@ -577,28 +841,126 @@ func (tm *TrafficManager) UpdateStatus(c context.Context, cr *rpc.ConnectRequest
 		}
 	}
 
-	if tm.SetMappedNamespaces(c, cr.MappedNamespaces) {
+	// A connect request that doesn't declare any mapped namespaces leaves the current ones as they are
+	if len(cr.MappedNamespaces) > 0 {
+		tm.UpdateMappedNamespaces(c, cr.MappedNamespaces)
+	}
+	return tm.Status(c)
+}
+
+// UpdateMappedNamespaces replaces the namespaces that this session maps. The intercepts are unaffected.
+func (tm *TrafficManager) UpdateMappedNamespaces(c context.Context, namespaces []string) *rpc.SetMappedNamespacesResult {
+	requested := make([]string, len(namespaces))
+	copy(requested, namespaces)
+	result := &rpc.SetMappedNamespacesResult{Changed: tm.SetMappedNamespaces(c, namespaces)}
+	if result.Changed {
 		tm.insLock.Lock()
 		tm.ingressInfo = nil
 		tm.insLock.Unlock()
 	}
-	return tm.Status(c)
+	result.Namespaces = tm.GetCurrentNamespaces(true)
+	mapped := make(map[string]struct{}, len(result.Namespaces))
+	for _, ns := range result.Namespaces {
+		mapped[ns] = struct{}{}
+	}
+	for _, ns := range requested {
+		if _, ok := mapped[ns]; !ok && ns != "all" {
+			result.Unavailable = append(result.Unavailable, ns)
+		}
+	}
+	sort.Strings(result.Unavailable)
+	return result
 }
 
 func (tm *TrafficManager) Status(c context.Context) *rpc.ConnectInfo {
 	cfg := tm.Config
 	ret := &rpc.ConnectInfo{
-		Error:          rpc.ConnectInfo_ALREADY_CONNECTED,
-		ClusterContext: cfg.Context,
-		ClusterServer:  cfg.Server,
-		ClusterId:      tm.GetClusterId(c),
-		SessionInfo:    tm.session(),
-		Agents:         &manager.AgentInfoSnapshot{Agents: tm.getCurrentAgents()},
-		Intercepts:     &manager.InterceptInfoSnapshot{Intercepts: tm.getCurrentIntercepts()},
+		Error:               rpc.ConnectInfo_ALREADY_CONNECTED,
+		ClusterContext:      cfg.Context,
+		ClusterServer:       cfg.Server,
+		ClusterId:           tm.GetClusterId(c),
+		SessionInfo:         tm.session(),
+		Agents:              &manager.AgentInfoSnapshot{Agents: tm.getCurrentAgents()},
+		Intercepts:          &manager.InterceptInfoSnapshot{Intercepts: tm.getCurrentIntercepts()},
+		ProxyAddress:        tm.proxyAddress,
+		ProxyAutoConfigUrl:  tm.proxyAutoConfigURL(),
+		PortForwardFallback: tm.portForwardFallback,
+		ConfigDrift:         tm.configDrift,
+		VersionSkew:         tm.versionSkew,
+		SubnetConflicts:     tm.getSubnetConflicts(),
+		ProxyHostWarnings:   tm.proxyHostWarnings,
+		MappedNamespaces:    tm.GetCurrentNamespaces(true),
+		ManagerVersion:      tm.managerVersion,
+		ManagerNamespace:    tm.GetManagerNamespace(),
+		InCluster:           cfg.InCluster,
+	}
+	if tm.loopbackForwards != nil {
+		ret.LoopbackForwards, ret.LoopbackDnsAddress = tm.loopbackForwards.snapshot()
 	}
 	return ret
 }
 
+func (tm *TrafficManager) getSubnetConflicts() []string {
+	tm.routesLock.Lock()
+	defer tm.routesLock.Unlock()
+	return tm.subnetConflicts
+}
+
+func (tm *TrafficManager) setSubnetConflicts(scs []*daemon.SubnetConflict) {
+	descs := make([]string, len(scs))
+	for i, sc := range scs {
+		descs[i] = client.DescribeSubnetConflict(sc)
+	}
+	tm.routesLock.Lock()
+	tm.subnetConflicts = descs
+	tm.routesLock.Unlock()
+}
+
+// ApplyRoutes re-reads the also-proxy and never-proxy subnets from the kubeconfig and tells the root
+// daemon to route accordingly, so that changes take effect without a reconnect.
+func (tm *TrafficManager) ApplyRoutes(c context.Context) (*rpc.RoutesInfo, error) {
+	if tm.rootDaemon == nil {
+		return nil, status.Error(codes.FailedPrecondition, "routes cannot be applied in proxy-only or in-cluster mode")
+	}
+	tm.routesLock.Lock()
+	err := tm.ReloadProxySubnets(c)
+	var oi *daemon.OutboundInfo
+	if err == nil {
+		oi = tm.getOutboundInfo(c)
+	}
+	tm.routesLock.Unlock()
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	rootStatus, err := tm.rootDaemon.SetProxySubnets(c, &daemon.ProxySubnets{
+		AlsoProxySubnets:  oi.AlsoProxySubnets,
+		NeverProxySubnets: oi.NeverProxySubnets,
+		NeverProxyHosts:   oi.NeverProxyHosts,
+		AlsoProxyHosts:    oi.AlsoProxyHosts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	tm.setSubnetConflicts(rootStatus.SubnetConflicts)
+	obc := rootStatus.OutboundConfig
+	return &rpc.RoutesInfo{
+		AlsoProxySubnets:  obc.AlsoProxySubnets,
+		NeverProxySubnets: obc.NeverProxySubnets,
+		NeverProxyHosts:   obc.NeverProxyHosts,
+		AlsoProxyHosts:    obc.AlsoProxyHosts,
+		SubnetConflicts:   tm.getSubnetConflicts(),
+	}, nil
+}
+
+// GetNetworkConfig returns the routes, DNS configuration, and TUN device that the root daemon has
+// put in effect for this session.
+func (tm *TrafficManager) GetNetworkConfig(c context.Context) (*daemon.NetworkConfig, error) {
+	if tm.rootDaemon == nil {
+		return nil, status.Error(codes.FailedPrecondition, "there is no network configuration in proxy-only or in-cluster mode")
+	}
+	return tm.rootDaemon.GetNetworkConfig(c, &empty.Empty{})
+}
+
 // Given a slice of AgentInfo, this returns another slice of agents with one
 // agent per namespace, name pair.
 func getRepresentativeAgents(_ context.Context, agents []*manager.AgentInfo) []*manager.AgentInfo {
@@ -627,7 +989,22 @@ func (tm *TrafficManager) Uninstall(c context.Context, ur *rpc.UninstallRequest)
 	// workload n times for n replicas, which could cause race conditions
 	agents = getRepresentativeAgents(c, agents)
 
-	_ = tm.clearIntercepts(c)
+	remove := func(agentsOnly bool) {
+		var err error
+		if ur.DryRun {
+			result.Changes, err = tm.DescribeRemoveManagerAndAgents(c, agentsOnly, agents)
+		} else {
+			err = tm.RemoveManagerAndAgents(c, agentsOnly, agents)
+		}
+		if err != nil {
+			result.ErrorText = err.Error()
+			result.ErrorCategory = int32(errcat.GetCategory(err))
+		}
+	}
+
+	if !ur.DryRun {
+		_ = tm.clearIntercepts(c)
+	}
 	switch ur.UninstallType {
 	case rpc.UninstallRequest_UNSPECIFIED:
 		return nil, status.Error(codes.InvalidArgument, "invalid uninstall request")
@@ -654,22 +1031,32 @@ func (tm *TrafficManager) Uninstall(c context.Context, ur *rpc.UninstallRequest)
 		fallthrough
 	case rpc.UninstallRequest_ALL_AGENTS:
 		if len(agents) > 0 {
-			if err := tm.RemoveManagerAndAgents(c, true, agents); err != nil {
-				result.ErrorText = err.Error()
-				result.ErrorCategory = int32(errcat.GetCategory(err))
-			}
+			remove(true)
 		}
 	default:
 		// Cancel all communication with the manager
-		if err := tm.RemoveManagerAndAgents(c, false, agents); err != nil {
-			result.ErrorText = err.Error()
-			result.ErrorCategory = int32(errcat.GetCategory(err))
-		}
+		remove(false)
 	}
 	return result, nil
 }
 
-// getClusterCIDRs finds the service CIDR and the pod CIDRs of all nodes in the cluster
+// getSuffixNamespaces returns the DNS suffix to namespace mappings from the config, overridden by
+// the ones given when connecting.
+func (tm *TrafficManager) getSuffixNamespaces(ctx context.Context) map[string]string {
+	cfgSns := client.GetConfig(ctx).DNS.SuffixNamespaces
+	if len(cfgSns) == 0 && len(tm.suffixNamespaces) == 0 {
+		return nil
+	}
+	sns := make(map[string]string, len(cfgSns)+len(tm.suffixNamespaces))
+	for sfx, ns := range cfgSns {
+		sns[sfx] = ns
+	}
+	for sfx, ns := range tm.suffixNamespaces {
+		sns[client.NormalizeDNSSuffix(sfx)] = ns
+	}
+	return sns
+}
+
 func (tm *TrafficManager) getOutboundInfo(ctx context.Context) *daemon.OutboundInfo {
 	// We'll figure out the IP address of the API server(s) so that we can tell the daemon never to proxy them.
 	// This is because in some setups the API server will be in the same CIDR range as the pods, and the
@@ -703,12 +1090,15 @@ func (tm *TrafficManager) getOutboundInfo(ctx context.Context) *daemon.OutboundI
 			neverProxy = append(neverProxy, iputil.IPNetToRPC(ipnet))
 		}
 	}
-	for _, np := range tm.NeverProxy {
-		neverProxy = append(neverProxy, iputil.IPNetToRPC((*net.IPNet)(np)))
+	npSubnets, npHosts := k8s.SplitProxyEntries(tm.NeverProxy)
+	for _, np := range npSubnets {
+		neverProxy = append(neverProxy, iputil.IPNetToRPC(np))
 	}
 	info := &daemon.OutboundInfo{
-		Session:           tm.sessionInfo,
+		Session:           tm.session(),
 		NeverProxySubnets: neverProxy,
+		NeverProxyHosts:   npHosts,
+		ProcessRouting:    tm.processRouting,
 	}
 
 	if tm.DNS != nil {
@@ -716,6 +1106,7 @@ func (tm *TrafficManager) getOutboundInfo(ctx context.Context) *daemon.OutboundI
 			ExcludeSuffixes: tm.DNS.ExcludeSuffixes,
 			IncludeSuffixes: tm.DNS.IncludeSuffixes,
 			LookupTimeout:   durationpb.New(tm.DNS.LookupTimeout.Duration),
+			ClusterDomain:   tm.DNS.ClusterDomain,
 		}
 		if len(tm.DNS.LocalIP) > 0 {
 			info.Dns.LocalIp = tm.DNS.LocalIP.IP()
@@ -725,11 +1116,37 @@ func (tm *TrafficManager) getOutboundInfo(ctx context.Context) *daemon.OutboundI
 		}
 	}
 
-	if len(tm.AlsoProxy) > 0 {
-		info.AlsoProxySubnets = make([]*manager.IPNet, len(tm.AlsoProxy))
-		for i, ap := range tm.AlsoProxy {
-			info.AlsoProxySubnets[i] = iputil.IPNetToRPC((*net.IPNet)(ap))
+	if sns := tm.getSuffixNamespaces(ctx); len(sns) > 0 {
+		if info.Dns == nil {
+			info.Dns = &daemon.DNSConfig{}
+		}
+		info.Dns.SuffixNamespaces = sns
+	}
+
+	apSubnets, apHosts := k8s.SplitProxyEntries(tm.AlsoProxy)
+	if len(apSubnets) > 0 {
+		info.AlsoProxySubnets = make([]*manager.IPNet, len(apSubnets))
+		for i, ap := range apSubnets {
+			info.AlsoProxySubnets[i] = iputil.IPNetToRPC(ap)
+		}
+	}
+	if len(apHosts) > 0 {
+		// The also-proxy hosts must be resolved in the cluster, so that the addresses that the
+		// DNS resolver answers with are the ones that are routed to the cluster.
+		info.AlsoProxyHosts = apHosts
+		if info.Dns == nil {
+			info.Dns = &daemon.DNSConfig{}
+		}
+		sfxs := make([]string, len(info.Dns.IncludeSuffixes), len(info.Dns.IncludeSuffixes)+len(apHosts))
+		copy(sfxs, info.Dns.IncludeSuffixes)
+		for _, host := range apHosts {
+			if strings.HasPrefix(host, "*.") {
+				sfxs = append(sfxs, host[1:])
+			} else {
+				info.Dns.IncludeHosts = append(info.Dns.IncludeHosts, host)
+			}
 		}
+		info.Dns.IncludeSuffixes = sfxs
 	}
 	return info
 }
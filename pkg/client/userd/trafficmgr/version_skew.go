@@ -0,0 +1,82 @@
+package trafficmgr
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blang/semver"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+// maxMinorSkew is the number of minor versions that the client and the traffic-manager may differ by before a
+// warning is issued.
+const maxMinorSkew = 1
+
+// minManagerVersion is the oldest traffic-manager that this client can talk to. Older ones lack the gRPC API
+// that the client depends on, which results in obscure errors.
+var minManagerVersion = semver.MustParse("2.0.0")
+
+// getVersionSkew asks the traffic-manager for its version, retains it for the session status, and returns a
+// warning for each supported but unrecommended difference from the client version. An error is returned when the
+// versions are known to be incompatible.
+func (tm *TrafficManager) getVersionSkew(c context.Context) ([]string, error) {
+	tc, cancel := client.GetConfig(c).Timeouts.TimeoutContext(c, client.TimeoutTrafficManagerAPI)
+	defer cancel()
+	vi, err := tm.managerClient.Version(tc, &empty.Empty{})
+	if err != nil {
+		dlog.Errorf(c, "failed to obtain version from traffic manager: %v", err)
+		return nil, nil
+	}
+	tm.managerVersion = vi.Version
+	mv, err := semver.ParseTolerant(vi.Version)
+	if err != nil {
+		dlog.Errorf(c, "unable to parse traffic-manager version %q: %v", vi.Version, err)
+		return nil, nil
+	}
+	mechanism, _ := client.GetInstallMechanism()
+	skew, err := versionSkew(client.Semver(), mv, mechanism)
+	for _, s := range skew {
+		dlog.Warnf(c, "Version skew: %s", s)
+	}
+	return skew, err
+}
+
+// versionSkew compares the client version with the traffic-manager version and returns a warning for each
+// unrecommended difference, or an error when the combination is known to be incompatible. Each message ends
+// with the command that resolves it. Development builds of the client are never compared.
+func versionSkew(cv, mv semver.Version, installMechanism string) ([]string, error) {
+	if cv.Major == 0 {
+		return nil, nil
+	}
+	const upgradeManager = `run "telepresence helm upgrade" and reconnect`
+	upgradeClient := upgradeClientHint(mv, installMechanism)
+
+	switch {
+	case mv.Major > cv.Major:
+		return nil, errcat.User.Newf("client version %s is incompatible with traffic-manager version %s; %s", cv, mv, upgradeClient)
+	case cv.Major != mv.Major || mv.LT(minManagerVersion):
+		return nil, errcat.User.Newf("client version %s is incompatible with traffic-manager version %s; %s", cv, mv, upgradeManager)
+	}
+
+	var skew []string
+	switch {
+	case mv.Minor > cv.Minor:
+		skew = append(skew, fmt.Sprintf("traffic-manager version %s is newer than client version %s and might use features that the client lacks; %s",
+			mv, cv, upgradeClient))
+	case cv.Minor-mv.Minor > maxMinorSkew:
+		skew = append(skew, fmt.Sprintf("traffic-manager version %s is more than %d minor version behind client version %s; %s",
+			mv, maxMinorSkew, cv, upgradeManager))
+	}
+	return skew, nil
+}
+
+func upgradeClientHint(mv semver.Version, installMechanism string) string {
+	if installMechanism == "brew" {
+		return `run "brew upgrade datawire/blackbird/telepresence"`
+	}
+	return fmt.Sprintf("install telepresence %s from https://www.telepresence.io/docs/latest/install/", mv)
+}
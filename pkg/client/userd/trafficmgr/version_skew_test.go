@@ -0,0 +1,54 @@
+package trafficmgr
+
+import (
+	"testing"
+
+	"github.com/blang/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+func TestVersionSkew(t *testing.T) {
+	v := semver.MustParse
+	tests := []struct {
+		name     string
+		client   string
+		manager  string
+		skew     string
+		errorMsg string
+	}{
+		{name: "equal", client: "2.5.0", manager: "2.5.0"},
+		{name: "patch differs", client: "2.5.3", manager: "2.5.0"},
+		{name: "one minor behind", client: "2.5.0", manager: "2.4.9"},
+		{name: "devel client", client: "0.0.0-devel", manager: "2.5.0"},
+		{name: "two minor behind", client: "2.5.0", manager: "2.3.1", skew: "telepresence helm upgrade"},
+		{name: "manager newer", client: "2.4.0", manager: "2.5.0", skew: "install telepresence 2.5.0"},
+		{name: "manager too old", client: "2.5.0", manager: "1.9.0", errorMsg: "telepresence helm upgrade"},
+		{name: "manager next major", client: "2.5.0", manager: "3.0.0", errorMsg: "install telepresence 3.0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skew, err := versionSkew(v(tt.client), v(tt.manager), "website")
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Equal(t, errcat.User, errcat.GetCategory(err))
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			if tt.skew == "" {
+				assert.Empty(t, skew)
+			} else {
+				require.Len(t, skew, 1)
+				assert.Contains(t, skew[0], tt.skew)
+			}
+		})
+	}
+
+	skew, err := versionSkew(v("2.4.0"), v("2.5.0"), "brew")
+	require.NoError(t, err)
+	require.Len(t, skew, 1)
+	assert.Contains(t, skew[0], "brew upgrade")
+}
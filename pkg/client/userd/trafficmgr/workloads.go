@@ -9,9 +9,11 @@ import (
 
 	apps "k8s.io/api/apps/v1"
 	core "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/tools/cache"
 
@@ -199,6 +201,89 @@ func (w *workloadsAndServicesWatcher) eachService(c context.Context, namespaces
 	}
 }
 
+// syncedNamespaceWatcher returns the watcher for the given namespace, provided that the namespace is watched
+// and that the watcher's caches have synced.
+func (w *workloadsAndServicesWatcher) syncedNamespaceWatcher(namespace string) *namespacedWASWatcher {
+	w.Lock()
+	nw := w.nsWatchers[namespace]
+	w.Unlock()
+	if nw == nil || !nw.hasSynced() {
+		return nil
+	}
+	return nw
+}
+
+// getWorkload returns the workload with the given name, namespace, and kind. An empty kind matches any
+// kind. The workload is served from the cache when the namespace is mapped and its watchers have synced,
+// otherwise the cluster is queried.
+func (w *workloadsAndServicesWatcher) getWorkload(c context.Context, name, namespace, workloadKind string) (k8sapi.Workload, error) {
+	nw := w.syncedNamespaceWatcher(namespace)
+	if nw == nil {
+		return k8sapi.GetWorkload(c, name, namespace, workloadKind)
+	}
+	key := meta.ObjectMeta{Name: name, Namespace: namespace}
+	get := func(i int, obj runtime.Object) (k8sapi.Workload, error) {
+		o, found, err := nw.wlWatchers[i].Get(c, obj)
+		if err != nil || !found {
+			return nil, err
+		}
+		return k8sapi.WrapWorkload(o.(runtime.Object))
+	}
+	var wl k8sapi.Workload
+	var err error
+	switch workloadKind {
+	case "Deployment":
+		wl, err = get(deployments, &apps.Deployment{ObjectMeta: key})
+	case "ReplicaSet":
+		wl, err = get(replicasets, &apps.ReplicaSet{ObjectMeta: key})
+	case "StatefulSet":
+		wl, err = get(statefulsets, &apps.StatefulSet{ObjectMeta: key})
+	case "Rollout":
+		// Argo Rollouts aren't watched
+		return k8sapi.GetRollout(c, name, namespace)
+	case "Job", "CronJob":
+		// Jobs and CronJobs aren't watched
+		return k8sapi.GetWorkload(c, name, namespace, workloadKind)
+	case "":
+		for _, wk := range []string{"Deployment", "ReplicaSet", "StatefulSet", "Rollout", "Job", "CronJob"} {
+			if wl, err = w.getWorkload(c, name, namespace, wk); err == nil || !errors2.IsNotFound(err) {
+				return wl, err
+			}
+		}
+		return nil, errors2.NewNotFound(core.Resource("workload"), name+"."+namespace)
+	default:
+		return nil, fmt.Errorf("unsupported workload kind: %q", workloadKind)
+	}
+	if err == nil && wl == nil {
+		err = errors2.NewNotFound(apps.Resource(workloadKind), name)
+	}
+	return wl, err
+}
+
+// getServices returns the services of the given namespace. The services are served from the cache when the
+// namespace is mapped and its watchers have synced, otherwise the cluster is queried.
+func (w *workloadsAndServicesWatcher) getServices(c context.Context, namespace string) ([]*core.Service, error) {
+	nw := w.syncedNamespaceWatcher(namespace)
+	if nw == nil {
+		ss, err := k8sapi.Services(c, namespace)
+		if err != nil {
+			return nil, err
+		}
+		svcs := make([]*core.Service, 0, len(ss))
+		for _, s := range ss {
+			si, _ := k8sapi.ServiceImpl(s)
+			svcs = append(svcs, si)
+		}
+		return svcs, nil
+	}
+	objs := nw.svcWatcher.List(c)
+	svcs := make([]*core.Service, len(objs))
+	for i, o := range objs {
+		svcs[i] = o.(*core.Service)
+	}
+	return svcs, nil
+}
+
 func (w *workloadsAndServicesWatcher) waitForSync(c context.Context) {
 	hss := make([]cache.InformerSynced, len(w.nsWatchers))
 	w.Lock()
@@ -280,6 +365,39 @@ func (w *workloadsAndServicesWatcher) findMatchingWorkloads(c context.Context, s
 	return nw.findMatchingWorkloads(c, svc)
 }
 
+// findWorkloadsForSelector returns the workloads in the given namespace whose pod template labels match the given
+// selector. A ReplicaSet that is controlled by a Deployment or an Argo Rollout is replaced by its owner.
+func (w *workloadsAndServicesWatcher) findWorkloadsForSelector(c context.Context, namespace string, selector labels.Selector) ([]k8sapi.Workload, error) {
+	w.Lock()
+	nw := w.nsWatchers[namespace]
+	w.Unlock()
+	if nw == nil {
+		return nil, fmt.Errorf("no watcher found for namespace %q", namespace)
+	}
+	var wls []k8sapi.Workload
+	unique := make(map[types.UID]struct{})
+	for _, wlw := range nw.wlWatchers {
+		for _, o := range wlw.List(c) {
+			wl, err := k8sapi.WrapWorkload(o.(runtime.Object))
+			if err != nil {
+				return nil, err
+			}
+			if !selector.Matches(labels.Set(wl.GetPodTemplate().Labels)) {
+				continue
+			}
+			if wl, err = nw.maybeReplaceWithOwner(c, wl); err != nil {
+				return nil, err
+			}
+			if _, ok := unique[wl.GetUID()]; !ok {
+				unique[wl.GetUID()] = struct{}{}
+				wls = append(wls, wl)
+			}
+		}
+	}
+	sort.Slice(wls, func(i, j int) bool { return wls[i].GetName() < wls[j].GetName() })
+	return wls, nil
+}
+
 func (nw *namespacedWASWatcher) findMatchingWorkloads(c context.Context, svc *core.Service) ([]k8sapi.Workload, error) {
 	ps := svc.Spec.Ports
 	targetPortNames := make([]string, len(ps))
@@ -350,11 +468,25 @@ func (nw *namespacedWASWatcher) findMatchingWorkloads(c context.Context, svc *co
 func (nw *namespacedWASWatcher) maybeReplaceWithOwner(c context.Context, wl k8sapi.Workload) (k8sapi.Workload, error) {
 	var err error
 	for _, or := range wl.GetOwnerReferences() {
-		if or.Controller != nil && *or.Controller && or.Kind == "Deployment" {
+		if or.Controller == nil || !*or.Controller {
+			continue
+		}
+		if or.Kind == "Deployment" {
 			// Chances are that the owner's labels doesn't match, but we really want the owner anyway.
 			wl, err = nw.replaceWithOwner(c, wl, or.Kind, or.Name)
 			break
 		}
+		if k8sapi.IsRolloutOwner(or.APIVersion, or.Kind) {
+			// Argo Rollouts aren't watched, so the Rollout is retrieved from the cluster
+			var owl k8sapi.Workload
+			if owl, err = k8sapi.GetRollout(c, or.Name, wl.GetNamespace()); err != nil {
+				return nil, fmt.Errorf("get %s owner %s for %s %s.%s: %v",
+					or.Kind, or.Name, wl.GetKind(), wl.GetName(), wl.GetNamespace(), err)
+			}
+			dlog.Debugf(c, "replacing %s %s.%s, with owner %s %s", wl.GetKind(), wl.GetName(), wl.GetNamespace(), or.Kind, or.Name)
+			wl = owl
+			break
+		}
 	}
 	return wl, err
 }
@@ -0,0 +1,187 @@
+package trafficmgr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	restfake "k8s.io/client-go/rest/fake"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/userd/k8s"
+	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
+)
+
+func TestWorkloadsAndServicesWatcher_unwatchedNamespace(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	ctx = k8sapi.WithK8sInterface(ctx, fake.NewSimpleClientset(
+		&apps.StatefulSet{ObjectMeta: meta.ObjectMeta{Name: "db", Namespace: "other"}},
+		&core.Service{ObjectMeta: meta.ObjectMeta{Name: "db", Namespace: "other"}},
+	))
+	w := newWASWatcher()
+
+	// The namespace isn't watched, so the lookups must go to the cluster
+	wl, err := w.getWorkload(ctx, "db", "other", "")
+	require.NoError(t, err)
+	assert.Equal(t, "StatefulSet", wl.GetKind())
+
+	wl, err = w.getWorkload(ctx, "db", "other", "StatefulSet")
+	require.NoError(t, err)
+	assert.Equal(t, "db", wl.GetName())
+
+	_, err = w.getWorkload(ctx, "db", "other", "Deployment")
+	assert.True(t, errors2.IsNotFound(err))
+
+	_, err = w.getWorkload(ctx, "web", "other", "")
+	assert.True(t, errors2.IsNotFound(err))
+
+	_, err = w.getWorkload(ctx, "db", "other", "DaemonSet")
+	assert.Error(t, err)
+
+	svcs, err := w.getServices(ctx, "other")
+	require.NoError(t, err)
+	require.Len(t, svcs, 1)
+	assert.Equal(t, "db", svcs[0].Name)
+}
+
+func TestWorkloadMatcher(t *testing.T) {
+	web := k8sapi.Deployment(&apps.Deployment{ObjectMeta: meta.ObjectMeta{
+		Name: "web", Namespace: "default", Labels: map[string]string{"app": "web", "tier": "frontend"},
+	}})
+	db := k8sapi.StatefulSet(&apps.StatefulSet{ObjectMeta: meta.ObjectMeta{
+		Name: "db", Namespace: "default", Labels: map[string]string{"app": "db", "tier": "backend"},
+	}})
+	tests := []struct {
+		name     string
+		kinds    []string
+		selector string
+		want     []string
+	}{
+		{name: "no filter", want: []string{"web", "db"}},
+		{name: "kind", kinds: []string{"statefulset"}, want: []string{"db"}},
+		{name: "kinds", kinds: []string{"Deployment", "StatefulSet"}, want: []string{"web", "db"}},
+		{name: "selector", selector: "tier=frontend", want: []string{"web"}},
+		{name: "selector set", selector: "app in (web,db),tier!=frontend", want: []string{"db"}},
+		{name: "kind and selector", kinds: []string{"Deployment"}, selector: "tier=backend"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := workloadMatcher(tt.kinds, tt.selector)
+			require.NoError(t, err)
+			var got []string
+			for _, wl := range []k8sapi.Workload{web, db} {
+				if match(wl) {
+					got = append(got, wl.GetName())
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := workloadMatcher([]string{"DaemonSet"}, "")
+	assert.Error(t, err)
+	_, err = workloadMatcher(nil, "app in web")
+	assert.Error(t, err)
+}
+
+// fakeListGetter returns a REST client that responds to list requests with the given list and to watch requests
+// with a stream that stays open until the test ends.
+func fakeListGetter(t *testing.T, list runtime.Object) *restfake.RESTClient {
+	data, err := json.Marshal(list)
+	require.NoError(t, err)
+	return &restfake.RESTClient{
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client: restfake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			body := io.NopCloser(bytes.NewReader(data))
+			if strings.Contains(req.URL.RawQuery, "watch=true") {
+				pr, pw := io.Pipe()
+				t.Cleanup(func() { _ = pw.Close() })
+				body = pr
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       body,
+			}, nil
+		}),
+	}
+}
+
+func TestWorkloadsAndServicesWatcher_findWorkloadsForSelector(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+
+	yes := true
+	podTemplate := func(lbs map[string]string) core.PodTemplateSpec {
+		return core.PodTemplateSpec{ObjectMeta: meta.ObjectMeta{Labels: lbs}}
+	}
+	stable := map[string]string{"app": "web", "track": "stable"}
+	canary := map[string]string{"app": "web", "track": "canary"}
+	listMeta := func(kind string) meta.TypeMeta {
+		return meta.TypeMeta{APIVersion: "apps/v1", Kind: kind}
+	}
+	dps := &apps.DeploymentList{TypeMeta: listMeta("DeploymentList"), Items: []apps.Deployment{
+		{ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "default", UID: "d1"}, Spec: apps.DeploymentSpec{Template: podTemplate(stable)}},
+	}}
+	rss := &apps.ReplicaSetList{TypeMeta: listMeta("ReplicaSetList"), Items: []apps.ReplicaSet{
+		{
+			ObjectMeta: meta.ObjectMeta{
+				Name: "web-5d8f9c7b6", Namespace: "default", UID: "r1",
+				OwnerReferences: []meta.OwnerReference{{Kind: "Deployment", Name: "web", Controller: &yes}},
+			},
+			Spec: apps.ReplicaSetSpec{Template: podTemplate(stable)},
+		},
+		{ObjectMeta: meta.ObjectMeta{Name: "web-canary", Namespace: "default", UID: "r2"}, Spec: apps.ReplicaSetSpec{Template: podTemplate(canary)}},
+	}}
+	sss := &apps.StatefulSetList{TypeMeta: listMeta("StatefulSetList"), Items: []apps.StatefulSet{
+		{ObjectMeta: meta.ObjectMeta{Name: "db", Namespace: "default", UID: "s1"}, Spec: apps.StatefulSetSpec{Template: podTemplate(map[string]string{"app": "db"})}},
+	}}
+
+	w := newWASWatcher()
+	cond := &sync.Cond{L: &sync.Mutex{}}
+	w.nsWatchers["default"] = &namespacedWASWatcher{
+		wlWatchers: [3]*k8s.Watcher{
+			k8s.NewWatcher("deployments", "default", fakeListGetter(t, dps), &apps.Deployment{}, cond, workloadEquals),
+			k8s.NewWatcher("replicasets", "default", fakeListGetter(t, rss), &apps.ReplicaSet{}, cond, workloadEquals),
+			k8s.NewWatcher("statefulsets", "default", fakeListGetter(t, sss), &apps.StatefulSet{}, cond, workloadEquals),
+		},
+	}
+
+	find := func(selector string) []string {
+		t.Helper()
+		sel, err := labels.Parse(selector)
+		require.NoError(t, err)
+		wls, err := w.findWorkloadsForSelector(ctx, "default", sel)
+		require.NoError(t, err)
+		names := make([]string, len(wls))
+		for i, wl := range wls {
+			names[i] = wl.GetKind() + " " + wl.GetName()
+		}
+		return names
+	}
+
+	// The ReplicaSet of the Deployment is replaced by the Deployment
+	assert.Equal(t, []string{"Deployment web"}, find("app=web,track=stable"))
+	assert.Equal(t, []string{"ReplicaSet web-canary"}, find("track=canary"))
+	assert.Equal(t, []string{"Deployment web", "ReplicaSet web-canary"}, find("app=web"))
+	assert.Empty(t, find("app=none"))
+
+	_, err := w.findWorkloadsForSelector(ctx, "other", labels.Everything())
+	assert.Error(t, err)
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/httpstream"
@@ -191,6 +192,13 @@ func (pf *k8sPortForwardDialer) spdyStream(pod *core.Pod) (httpstream.Connection
 	dlog.Debugf(pf.logCtx, "k8sPortForwardDialer.spdyDial(ctx, Pod./%s.%s)", pod.Name, pod.Namespace)
 
 	spdyStream, _, err := spdyDialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil && apierrors.IsUnauthorized(err) {
+		// The credentials have expired. When they come from an exec plugin, the plugin has been re-invoked
+		// by the rejected request, so a second attempt will use fresh credentials.
+		dlog.Debugf(pf.logCtx, "k8sPortForwardDialer.spdyDial(ctx, Pod./%s.%s) was unauthorized, retrying", pod.Name, pod.Namespace)
+		spdyDialer = spdy.NewDialer(pf.spdyUpgrader, &http.Client{Transport: pf.spdyTransport}, http.MethodPost, reqURL)
+		spdyStream, _, err = spdyDialer.Dial(portforward.PortForwardProtocolV1Name)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -1,17 +1,23 @@
 package forwarder
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/blang/semver"
 
 	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/httprewrite"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
 )
@@ -33,8 +39,42 @@ type Forwarder struct {
 
 	intercept  *manager.InterceptInfo
 	mgrVersion semver.Version
+
+	// sniIntercepts are intercepts of TLS connections, keyed by the SNI host that they intercept
+	sniIntercepts map[string]*sniIntercept
+
+	// httpIntercepts are intercepts of the HTTP requests that match their matchers, in the order that they are
+	// matched
+	httpIntercepts []*HTTPIntercept
+
+	// interceptKeys are the keys of the intercepts that use end-to-end encryption, keyed by intercept ID
+	interceptKeys map[string]*InterceptKey
+
+	rewriteRules httprewrite.Rules
+
+	// stats are the traffic counters of the intercepts, keyed by intercept ID
+	stats map[string]*interceptStats
+}
+
+// sniIntercept is an intercept of TLS connections together with the lifetime of the connections that it
+// intercepts, so that they can be dropped without affecting other connections when the intercept is removed.
+type sniIntercept struct {
+	*manager.InterceptInfo
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
+const (
+	// sniFirstByteTimeout is the maximum time to wait for the first byte of a connection when there are SNI
+	// intercepts. It's short, because the client of a protocol where the server speaks first doesn't send
+	// anything until the server has spoken.
+	sniFirstByteTimeout = 500 * time.Millisecond
+
+	// sniReadTimeout is the maximum time to wait for the rest of the ClientHello of a connection that
+	// starts like a TLS connection.
+	sniReadTimeout = 5 * time.Second
+)
+
 func NewForwarder(listen *net.TCPAddr, targetHost string, targetPort int32) *Forwarder {
 	return &Forwarder{
 		listenAddr: listen,
@@ -51,6 +91,27 @@ func (f *Forwarder) SetManager(sessionInfo *manager.SessionInfo, manager manager
 	f.mgrVersion = version
 }
 
+// SetRewriteRules sets the HTTP rewrite rules that are applied to intercepted connections.
+func (f *Forwarder) SetRewriteRules(rules httprewrite.Rules) {
+	f.mu.Lock()
+	f.rewriteRules = rules
+	f.mu.Unlock()
+}
+
+// InterceptKey is the key that encrypts the payloads of an intercept with end-to-end encryption, and
+// the public key of this traffic-agent that the client derives the same key from.
+type InterceptKey struct {
+	Public []byte
+	Shared []byte
+}
+
+// SetInterceptKeys sets the keys of the intercepts with end-to-end encryption, keyed by intercept ID.
+func (f *Forwarder) SetInterceptKeys(keys map[string]*InterceptKey) {
+	f.mu.Lock()
+	f.interceptKeys = keys
+	f.mu.Unlock()
+}
+
 func (f *Forwarder) Serve(ctx context.Context) error {
 	listener, err := f.Listen(ctx)
 	if err != nil {
@@ -122,11 +183,84 @@ func (f *Forwarder) Target() (string, int32) {
 
 func (f *Forwarder) Intercepting() bool {
 	f.mu.Lock()
-	intercepting := f.intercept != nil
+	intercepting := f.intercept != nil || len(f.sniIntercepts) > 0 || len(f.httpIntercepts) > 0
 	f.mu.Unlock()
 	return intercepting
 }
 
+// InterceptingRequest returns true if a request with the given header would be intercepted. A request that is
+// mirrored isn't intercepted, because the app serves it.
+func (f *Forwarder) InterceptingRequest(h http.Header) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.intercept != nil {
+		return !f.intercept.Spec.Mirror
+	}
+	for _, hi := range f.httpIntercepts {
+		if hi.Matchers.Matches(h) {
+			return !hi.Spec.Mirror
+		}
+	}
+	return false
+}
+
+// SetHTTPIntercepts sets the intercepts of HTTP requests. A request is forwarded to the first intercept that
+// it matches. Connections are dropped when the set of intercepts changes.
+func (f *Forwarder) SetHTTPIntercepts(intercepts []*HTTPIntercept) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	changed := len(intercepts) != len(f.httpIntercepts)
+	if !changed {
+		for i, hi := range intercepts {
+			if f.httpIntercepts[i].Id != hi.Id {
+				changed = true
+				break
+			}
+		}
+	}
+	if !changed {
+		return
+	}
+	for _, hi := range intercepts {
+		dlog.Debugf(f.lCtx, "%s forwarded to intercept '%s' (%s:%d)", hi.Matchers, hi.Spec.Name, hi.Spec.Client, hi.Spec.TargetPort)
+	}
+
+	// Drop existing connections
+	f.tCancel()
+
+	// Set up new lifetime
+	f.tCtx, f.tCancel = context.WithCancel(f.lCtx)
+	f.httpIntercepts = intercepts
+}
+
+// SetSNIIntercepts sets the intercepts of TLS connections, keyed by the SNI host that they
+// intercept. The connections of an intercept are dropped when the intercept is removed or replaced.
+// Other connections are unaffected.
+func (f *Forwarder) SetSNIIntercepts(intercepts map[string]*manager.InterceptInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sis := make(map[string]*sniIntercept, len(intercepts))
+	for host, ii := range intercepts {
+		if old, ok := f.sniIntercepts[host]; ok && old.Id == ii.Id {
+			sis[host] = &sniIntercept{InterceptInfo: ii, ctx: old.ctx, cancel: old.cancel}
+			continue
+		}
+		dlog.Debugf(f.lCtx, "TLS connections for %q forwarded to intercept '%s' (%s:%d)", host, ii.Spec.Name, ii.Spec.Client, ii.Spec.TargetPort)
+		si := &sniIntercept{InterceptInfo: ii}
+		si.ctx, si.cancel = context.WithCancel(f.lCtx)
+		sis[host] = si
+	}
+	for host, old := range f.sniIntercepts {
+		if si, ok := sis[host]; !ok || si.Id != old.Id {
+			// Drop the connections of the intercept
+			old.cancel()
+		}
+	}
+	f.sniIntercepts = sis
+}
+
 func (f *Forwarder) SetIntercepting(intercept *manager.InterceptInfo) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -165,9 +299,56 @@ func (f *Forwarder) forwardConn(clientConn *net.TCPConn) error {
 	targetHost := f.targetHost
 	targetPort := f.targetPort
 	intercept := f.intercept
+	rewriteRules := f.rewriteRules
+	sniIntercepts := f.sniIntercepts
+	httpIntercepts := f.httpIntercepts
 	f.mu.Unlock()
+
+	// hello is the beginning of the TLS ClientHello that must be replayed to the target
+	var hello []byte
+
+	if intercept != nil && !f.selected(intercept) {
+		intercept = nil
+	}
+
+	// mirror is the intercept, if any, that gets a copy of the connection that the app serves
+	var mirror *manager.InterceptInfo
+	if intercept != nil && intercept.Spec.Mirror {
+		mirror = intercept
+		intercept = nil
+	}
+	// mirrorCtx is the lifetime of the mirror
+	mirrorCtx := ctx
+	if intercept == nil && mirror == nil && len(sniIntercepts) > 0 {
+		var host string
+		hello, host = peekClientHello(clientConn)
+		if si, ok := sniIntercepts[host]; ok && f.selected(si.InterceptInfo) {
+			if !si.Spec.Mirror {
+				return f.interceptConn(si.ctx, &helloConn{Conn: clientConn, hello: hello}, si.InterceptInfo)
+			}
+			mirror = si.InterceptInfo
+			mirrorCtx = si.ctx
+		}
+	}
 	if intercept != nil {
-		return f.interceptConn(ctx, clientConn, intercept)
+		var conn net.Conn = clientConn
+		if hs := intercept.Spec.IdentityHeaders; len(hs) > 0 {
+			// Applied last, so that the rewrite rules can neither remove nor replace the identity headers
+			rewriteRules = append(rewriteRules[:len(rewriteRules):len(rewriteRules)], &httprewrite.Rule{
+				Request: &httprewrite.Headers{Set: hs},
+			})
+		}
+		if len(rewriteRules) > 0 {
+			conn = rewriteRules.Wrap(ctx, conn)
+		}
+		return f.interceptConn(ctx, conn, intercept)
+	}
+	if mirror == nil && len(httpIntercepts) > 0 {
+		var conn net.Conn = clientConn
+		if len(hello) > 0 {
+			conn = &helloConn{Conn: clientConn, hello: hello}
+		}
+		return f.routeHTTP(ctx, conn, httpIntercepts, net.JoinHostPort(targetHost, strconv.Itoa(int(targetPort))), rewriteRules)
 	}
 
 	targetAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", targetHost, targetPort))
@@ -188,11 +369,24 @@ func (f *Forwarder) forwardConn(clientConn *net.TCPConn) error {
 		return fmt.Errorf("error on dial: %w", err)
 	}
 	defer targetConn.Close()
+	if len(hello) > 0 {
+		if _, err = targetConn.Write(hello); err != nil {
+			return fmt.Errorf("error replaying ClientHello: %w", err)
+		}
+	}
+
+	var src io.Reader = clientConn
+	if mirror != nil {
+		m := f.mirrorConn(mirrorCtx, clientConn, mirror, rewriteRules)
+		defer m.close()
+		_, _ = m.Write(hello)
+		src = io.TeeReader(clientConn, m)
+	}
 
 	done := make(chan struct{})
 
 	go func() {
-		if _, err := io.Copy(targetConn, clientConn); err != nil {
+		if _, err := io.Copy(targetConn, src); err != nil {
 			dlog.Debugf(ctx, "Error clientConn->targetConn: %+v", err)
 		}
 		_ = targetConn.CloseWrite()
@@ -218,6 +412,25 @@ func (f *Forwarder) forwardConn(clientConn *net.TCPConn) error {
 	return nil
 }
 
+// peekClientHello reads the ClientHello of the given connection and returns the bytes that were read
+// together with the server name of the ClientHello. It gives up as soon as the first byte shows that the
+// connection isn't a TLS connection, and when no byte arrives within the sniFirstByteTimeout.
+func peekClientHello(conn *net.TCPConn) ([]byte, string) {
+	defer func() {
+		_ = conn.SetReadDeadline(time.Time{})
+	}()
+	first := make([]byte, 1)
+	_ = conn.SetReadDeadline(time.Now().Add(sniFirstByteTimeout))
+	if n, _ := conn.Read(first); n == 0 {
+		return nil, ""
+	}
+	if first[0] != tlsRecordTypeHandshake {
+		return first, ""
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(sniReadTimeout))
+	return readClientHello(io.MultiReader(bytes.NewReader(first), conn))
+}
+
 func (f *Forwarder) interceptConn(ctx context.Context, conn net.Conn, iCept *manager.InterceptInfo) error {
 	dlog.Infof(ctx, "Accept got connection from %s", conn.RemoteAddr())
 
@@ -230,7 +443,19 @@ func (f *Forwarder) interceptConn(ctx context.Context, conn net.Conn, iCept *man
 	destIp := iputil.Parse(spec.TargetHost)
 	id := tunnel.NewConnID(tunnel.IPProto(conn.RemoteAddr().Network()), srcIp, destIp, srcPort, uint16(spec.TargetPort))
 
-	ms, err := f.manager.Tunnel(ctx)
+	var key *InterceptKey
+	if len(spec.ClientPublicKey) > 0 {
+		f.mu.Lock()
+		key = f.interceptKeys[iCept.Id]
+		f.mu.Unlock()
+		if key == nil {
+			// Never fall back to an unencrypted tunnel
+			conn.Close()
+			return fmt.Errorf("no encryption key has been negotiated for intercept %s. Id %s", iCept.Id, id)
+		}
+	}
+
+	ms, err := f.manager.Tunnel(ctx, tunnel.CompressionCallOptions(spec.TunnelCompression)...)
 	if err != nil {
 		return fmt.Errorf("call to manager.Tunnel() failed. Id %s: %v", id, err)
 	}
@@ -239,11 +464,120 @@ func (f *Forwarder) interceptConn(ctx context.Context, conn net.Conn, iCept *man
 	if err != nil {
 		return err
 	}
-	if err = s.Send(ctx, tunnel.SessionMessage(iCept.ClientSession.SessionId)); err != nil {
+	// The intercept ID is always sent, so that the client knows what intercept the connection belongs to
+	var public []byte
+	if key != nil {
+		public = key.Public
+	}
+	if err = s.Send(ctx, tunnel.InterceptSessionMessage(iCept.ClientSession.SessionId, iCept.Id, public)); err != nil {
 		return fmt.Errorf("unable to send client session id. Id %s: %v", id, err)
 	}
-	d := tunnel.NewConnEndpoint(s, conn)
+	if key != nil {
+		if s, err = tunnel.NewEncryptedStream(s, key.Shared, true); err != nil {
+			return err
+		}
+	}
+	st := f.interceptStats(iCept.Id)
+	atomic.AddInt64(&st.connections, 1)
+	atomic.AddInt64(&st.active, 1)
+	defer atomic.AddInt64(&st.active, -1)
+	d := tunnel.NewConnEndpoint(s, &countingConn{Conn: conn, stats: st})
 	d.Start(ctx)
 	<-d.Done()
 	return nil
 }
+
+// selected returns true if the next connection or HTTP request of the given intercept is to be routed to it, as
+// opposed to the app, given the traffic percentage of the intercept. Every connection or request that takes the
+// percentage of the ones counted so far past a whole number is selected, so that the selected ones are evenly spread.
+func (f *Forwarder) selected(ii *manager.InterceptInfo) bool {
+	p := int64(ii.Spec.TrafficPercentage)
+	if p <= 0 || p >= 100 {
+		return true
+	}
+	n := atomic.AddInt64(&f.interceptStats(ii.Id).offered, 1)
+	return n*p/100 > (n-1)*p/100
+}
+
+// interceptStats returns the traffic counters of the intercept with the given ID.
+func (f *Forwarder) interceptStats(id string) *interceptStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stats == nil {
+		f.stats = make(map[string]*interceptStats)
+	}
+	st, ok := f.stats[id]
+	if !ok {
+		st = &interceptStats{}
+		f.stats[id] = st
+	}
+	return st
+}
+
+// InterceptStats returns the traffic counters of the intercepts that connections have been forwarded to, sorted
+// by intercept ID. Counters of intercepts that aren't among the given IDs are discarded.
+func (f *Forwarder) InterceptStats(ids map[string]struct{}) []*manager.InterceptStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result := make([]*manager.InterceptStats, 0, len(f.stats))
+	for id, st := range f.stats {
+		if _, ok := ids[id]; !ok {
+			delete(f.stats, id)
+			continue
+		}
+		result = append(result, &manager.InterceptStats{
+			InterceptId:       id,
+			Connections:       atomic.LoadInt64(&st.connections),
+			ActiveConnections: atomic.LoadInt64(&st.active),
+			BytesIn:           atomic.LoadInt64(&st.bytesIn),
+			BytesOut:          atomic.LoadInt64(&st.bytesOut),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].InterceptId < result[j].InterceptId })
+	return result
+}
+
+// interceptStats are the traffic counters of an intercept. They are updated atomically.
+type interceptStats struct {
+	connections int64
+	active      int64
+	bytesIn     int64
+	bytesOut    int64
+
+	// offered is the number of connections or requests that the traffic percentage of the intercept was applied to
+	offered int64
+}
+
+// countingConn counts the bytes that are read from, and written to, an intercepted connection.
+type countingConn struct {
+	net.Conn
+	stats *interceptStats
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.stats.bytesIn, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.stats.bytesOut, int64(n))
+	return n, err
+}
+
+// helloConn is a connection whose ClientHello has been read in order to find the SNI. The
+// ClientHello is replayed by the first reads.
+type helloConn struct {
+	net.Conn
+	hello []byte
+}
+
+func (c *helloConn) Read(b []byte) (int, error) {
+	if len(c.hello) > 0 {
+		n := copy(b, c.hello)
+		c.hello = c.hello[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
@@ -0,0 +1,114 @@
+package forwarder
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+func TestForwarder_selected(t *testing.T) {
+	f := NewForwarder(nil, "", 0)
+	count := func(id string, percentage int32, offered int) (selected []int) {
+		ii := &manager.InterceptInfo{Id: id, Spec: &manager.InterceptSpec{TrafficPercentage: percentage}}
+		for i := 0; i < offered; i++ {
+			if f.selected(ii) {
+				selected = append(selected, i)
+			}
+		}
+		return selected
+	}
+
+	// Zero, the default, and 100 select everything
+	assert.Len(t, count("intercept-01", 0, 20), 20)
+	assert.Len(t, count("intercept-02", 100, 20), 20)
+
+	// The selected ones are evenly spread
+	assert.Equal(t, []int{9, 19, 29, 39, 49, 59, 69, 79, 89, 99}, count("intercept-03", 10, 100))
+	assert.Len(t, count("intercept-04", 33, 300), 99)
+}
+
+func tcpPair(t *testing.T) (client net.Conn, server *net.TCPConn) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IP{127, 0, 0, 1}})
+	require.NoError(t, err)
+	defer l.Close()
+	client, err = net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	server, err = l.AcceptTCP()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return client, server
+}
+
+func Test_peekClientHello(t *testing.T) {
+	t.Run("TLS", func(t *testing.T) {
+		client, server := tcpPair(t)
+		hello := clientHello(t, "echo.example.com")
+		_, err := client.Write(hello)
+		require.NoError(t, err)
+		data, host := peekClientHello(server)
+		assert.Equal(t, "echo.example.com", host)
+		assert.Equal(t, hello, data)
+	})
+
+	t.Run("plaintext", func(t *testing.T) {
+		// Only the first byte is read, so a client that sends less than a TLS record header isn't stalled
+		client, server := tcpPair(t)
+		_, err := client.Write([]byte("GE"))
+		require.NoError(t, err)
+		start := time.Now()
+		data, host := peekClientHello(server)
+		assert.Less(t, time.Since(start), sniFirstByteTimeout)
+		assert.Empty(t, host)
+		assert.Equal(t, "G", string(data))
+	})
+
+	t.Run("server speaks first", func(t *testing.T) {
+		_, server := tcpPair(t)
+		start := time.Now()
+		data, host := peekClientHello(server)
+		assert.Less(t, time.Since(start), sniReadTimeout)
+		assert.Empty(t, host)
+		assert.Empty(t, data)
+
+		// The connection is still usable
+		_, err := server.Write([]byte("220 ready\r\n"))
+		assert.NoError(t, err)
+	})
+}
+
+func TestForwarder_SetSNIIntercepts(t *testing.T) {
+	f := NewForwarder(&net.TCPAddr{IP: net.IP{127, 0, 0, 1}}, "127.0.0.1", 8080)
+	l, err := f.Listen(dlog.NewTestContext(t, false))
+	require.NoError(t, err)
+	defer l.Close()
+	cept := func(id string) *manager.InterceptInfo {
+		return &manager.InterceptInfo{Id: id, Spec: &manager.InterceptSpec{Name: id}}
+	}
+
+	f.SetSNIIntercepts(map[string]*manager.InterceptInfo{"a.example.com": cept("a"), "b.example.com": cept("b")})
+	tCtx := f.tCtx
+	aCtx := f.sniIntercepts["a.example.com"].ctx
+	bCtx := f.sniIntercepts["b.example.com"].ctx
+
+	// Only the connections of the intercept that is replaced are dropped
+	f.SetSNIIntercepts(map[string]*manager.InterceptInfo{"a.example.com": cept("a"), "b.example.com": cept("c")})
+	assert.NoError(t, aCtx.Err())
+	assert.Error(t, bCtx.Err())
+	assert.NoError(t, tCtx.Err())
+	assert.NoError(t, f.sniIntercepts["b.example.com"].ctx.Err())
+
+	// Only the connections of the intercepts that are removed are dropped
+	f.SetSNIIntercepts(nil)
+	assert.Error(t, aCtx.Err())
+	assert.NoError(t, tCtx.Err())
+	assert.False(t, f.Intercepting())
+}
@@ -0,0 +1,271 @@
+package forwarder
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/httprewrite"
+	"github.com/telepresenceio/telepresence/v2/pkg/restapi"
+)
+
+// HTTPMatcher matches the values of a request header.
+type HTTPMatcher struct {
+	Header string
+	Value  *regexp.Regexp
+	expr   string
+}
+
+// HTTPMatchers are the header matchers of an intercept of HTTP requests, sorted by header. A request
+// matches when all matchers match. No matchers match all requests.
+type HTTPMatchers []*HTTPMatcher
+
+// ParseHTTPMatchers returns the matchers of the given intercept of HTTP requests, given by its "--match"
+// mechanism arguments. An argument is either a "HEADER=REGEXP" pair, "auto", which matches requests
+// that have the x-telepresence-intercept-id header set to the ID of the intercept, or "all", which
+// matches all requests. The regular expression must match the whole header value.
+func ParseHTTPMatchers(ii *manager.InterceptInfo) (HTTPMatchers, error) {
+	var ms HTTPMatchers
+	for _, arg := range ii.Spec.MechanismArgs {
+		if !strings.HasPrefix(arg, "--match=") {
+			continue
+		}
+		var hdr, expr string
+		switch m := strings.TrimPrefix(arg, "--match="); m {
+		case "all":
+			continue
+		case "auto":
+			hdr = restapi.HeaderInterceptID
+			expr = regexp.QuoteMeta(ii.Id)
+		default:
+			eq := strings.IndexByte(m, '=')
+			if eq <= 0 {
+				return nil, fmt.Errorf("invalid match %q, expected HEADER=REGEXP", m)
+			}
+			hdr, expr = m[:eq], m[eq+1:]
+		}
+		rx, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression in match %q: %w", hdr+"="+expr, err)
+		}
+		ms = append(ms, &HTTPMatcher{Header: http.CanonicalHeaderKey(hdr), Value: rx, expr: expr})
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].Header == ms[j].Header {
+			return ms[i].expr < ms[j].expr
+		}
+		return ms[i].Header < ms[j].Header
+	})
+	return ms, nil
+}
+
+// Matches returns true if the given header matches all matchers.
+func (ms HTTPMatchers) Matches(h http.Header) bool {
+	for _, m := range ms {
+		found := false
+		for _, v := range h.Values(m.Header) {
+			if m.Value.MatchString(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a description of the requests that the matchers match. Matchers that match the same
+// requests have the same description.
+func (ms HTTPMatchers) String() string {
+	if len(ms) == 0 {
+		return "all HTTP requests"
+	}
+	descs := make([]string, len(ms))
+	for i, m := range ms {
+		descs[i] = fmt.Sprintf("header(%q) ~= regexp(%q)", m.Header, m.expr)
+	}
+	return "HTTP requests that match all of: " + strings.Join(descs, " and ")
+}
+
+// HTTPIntercept is an intercept of the HTTP requests that match its matchers.
+type HTTPIntercept struct {
+	*manager.InterceptInfo
+	Matchers HTTPMatchers
+}
+
+// upstream is a connection that requests are forwarded to, together with the reader of its responses.
+type upstream struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// addrConn is a connection with the addresses of the connection that it was created for.
+type addrConn struct {
+	net.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *addrConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// interceptRules returns the rewrite rules for a request that is routed to the given intercept. The identity
+// headers of the intercept are applied last, so that the rewrite rules can neither remove nor replace them. The
+// given rules are never modified, because they are shared by all requests of the connection.
+func interceptRules(rules httprewrite.Rules, ii *manager.InterceptInfo) httprewrite.Rules {
+	hs := ii.Spec.IdentityHeaders
+	if len(hs) == 0 {
+		return rules
+	}
+	return append(rules[:len(rules):len(rules)], &httprewrite.Rule{Request: &httprewrite.Headers{Set: hs}})
+}
+
+// routeHTTP forwards each HTTP request that arrives on the given connection to the first of the given intercepts
+// that it matches, or to the target address when it matches none of them. A connection to the app or an intercept
+// is established when a request is first routed to it, and is then reused for the following requests that are
+// routed the same way. A connection that is upgraded to another protocol is passed through unaltered after the
+// upgrade. A request that matches a mirroring intercept is forwarded to the target address, and a copy of it is
+// sent to the intercept. A request that matches an intercept with a traffic percentage is forwarded to the target
+// address when it exceeds that percentage.
+func (f *Forwarder) routeHTTP(ctx context.Context, conn net.Conn, intercepts []*HTTPIntercept, targetAddr string, rules httprewrite.Rules) error {
+	upstreams := make(map[string]*upstream)
+	mirrors := make(map[string]*httpMirror)
+	defer func() {
+		conn.Close()
+		for _, u := range upstreams {
+			u.conn.Close()
+		}
+		for _, m := range mirrors {
+			m.close()
+		}
+	}()
+
+	cr := bufio.NewReader(conn)
+	for {
+		req, err := http.ReadRequest(cr)
+		if err != nil {
+			return ignoreClosed(err)
+		}
+		var ii *HTTPIntercept
+		for _, hi := range intercepts {
+			if hi.Matchers.Matches(req.Header) {
+				ii = hi
+				break
+			}
+		}
+		if ii != nil && !f.selected(ii.InterceptInfo) {
+			// The app serves the requests that exceed the traffic percentage of the intercept
+			ii = nil
+		}
+
+		if ii != nil && ii.Spec.Mirror {
+			f.sendMirror(ctx, conn, req, ii, mirrors, rules)
+			ii = nil
+		}
+
+		key := ""
+		var matched httprewrite.Rules
+		if ii != nil {
+			key = ii.Id
+			matched = interceptRules(rules, ii.InterceptInfo).Matching(req)
+			matched.RewriteRequest(req)
+		}
+		u, ok := upstreams[key]
+		if !ok {
+			if ii == nil {
+				c, err := net.Dial("tcp", targetAddr)
+				if err != nil {
+					return fmt.Errorf("error on dial: %w", err)
+				}
+				u = &upstream{conn: c, reader: bufio.NewReader(c)}
+			} else {
+				inner, outer := net.Pipe()
+				go func(ii *manager.InterceptInfo) {
+					ac := &addrConn{Conn: outer, local: conn.LocalAddr(), remote: conn.RemoteAddr()}
+					if err := f.interceptConn(ctx, ac, ii); err != nil {
+						dlog.Error(ctx, err)
+					}
+				}(ii.InterceptInfo)
+				u = &upstream{conn: inner, reader: bufio.NewReader(inner)}
+			}
+			upstreams[key] = u
+		}
+
+		if err = req.Write(u.conn); err != nil {
+			return ignoreClosed(err)
+		}
+		rsp, err := http.ReadResponse(u.reader, req)
+		if err != nil {
+			return ignoreClosed(err)
+		}
+		matched.RewriteResponse(rsp)
+		err = rsp.Write(conn)
+		_ = rsp.Body.Close()
+		if err != nil {
+			return ignoreClosed(err)
+		}
+		if rsp.StatusCode == http.StatusSwitchingProtocols {
+			go func() {
+				_, _ = io.Copy(u.conn, cr)
+				_ = u.conn.Close()
+			}()
+			_, err = io.Copy(conn, u.reader)
+			return ignoreClosed(err)
+		}
+		if req.Close || rsp.Close {
+			return nil
+		}
+	}
+}
+
+// sendMirror sends a copy of the given request to the given mirroring intercept, using the mirror of the intercept
+// in the given map, or a new one that is added to the map. The body of the request is copied as it's forwarded to
+// the app, and the copy is sent once the body is complete. Requests that upgrade the connection to another protocol,
+// and requests with bodies that are too large, aren't mirrored.
+func (f *Forwarder) sendMirror(
+	ctx context.Context,
+	conn net.Conn,
+	req *http.Request,
+	ii *HTTPIntercept,
+	mirrors map[string]*httpMirror,
+	rules httprewrite.Rules,
+) {
+	if req.Header.Get("Upgrade") != "" || req.ContentLength > maxMirrorBody {
+		return
+	}
+	m, ok := mirrors[ii.Id]
+	if !ok {
+		m = f.mirrorHTTP(ctx, conn, ii.InterceptInfo, rules)
+		mirrors[ii.Id] = m
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		m.send(ctx, req, nil)
+		return
+	}
+	req.Body = &mirrorBody{ReadCloser: req.Body, done: func(body []byte) {
+		m.send(ctx, req, body)
+	}}
+}
+
+func ignoreClosed(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
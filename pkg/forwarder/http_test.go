@@ -0,0 +1,106 @@
+package forwarder
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/httprewrite"
+)
+
+func httpCept(id string, args ...string) *manager.InterceptInfo {
+	return &manager.InterceptInfo{Id: id, Spec: &manager.InterceptSpec{Mechanism: "http", MechanismArgs: args}}
+}
+
+func TestParseHTTPMatchers(t *testing.T) {
+	ms, err := ParseHTTPMatchers(httpCept("s1:echo", "--match=auto", "--match=x-dev=jane|joe", "--plaintext=false"))
+	require.NoError(t, err)
+	assert.Equal(t, `HTTP requests that match all of: header("X-Dev") ~= regexp("jane|joe") and `+
+		`header("X-Telepresence-Intercept-Id") ~= regexp("s1:echo")`, ms.String())
+
+	h := http.Header{}
+	assert.False(t, ms.Matches(h))
+	h.Set("X-Telepresence-Intercept-Id", "s1:echo")
+	h.Set("X-Dev", "joe")
+	assert.True(t, ms.Matches(h))
+	h.Set("X-Dev", "joey")
+	assert.False(t, ms.Matches(h), "the whole value must match")
+	h.Add("X-Dev", "jane")
+	assert.True(t, ms.Matches(h), "any of the values may match")
+
+	ms, err = ParseHTTPMatchers(httpCept("s1:echo", "--match=all"))
+	require.NoError(t, err)
+	assert.Equal(t, "all HTTP requests", ms.String())
+	assert.True(t, ms.Matches(http.Header{}))
+
+	_, err = ParseHTTPMatchers(httpCept("s1:echo", "--match=x-dev"))
+	assert.Error(t, err)
+	_, err = ParseHTTPMatchers(httpCept("s1:echo", "--match=x-dev=[a"))
+	assert.Error(t, err)
+}
+
+func TestForwarder_routeHTTP(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "app %s", r.URL.Path)
+	}))
+	defer app.Close()
+
+	ms, err := ParseHTTPMatchers(httpCept("s1:echo", "--match=auto"))
+	require.NoError(t, err)
+	intercepts := []*HTTPIntercept{{InterceptInfo: httpCept("s1:echo", "--match=auto"), Matchers: ms}}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	f := &Forwarder{}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- f.routeHTTP(context.Background(), server, intercepts, app.Listener.Addr().String(), nil)
+	}()
+
+	// Requests that match no intercept are served by the app, using the same connection
+	cr := bufio.NewReader(client)
+	for _, path := range []string{"/a", "/b"} {
+		req, err := http.NewRequest(http.MethodGet, "http://echo"+path, nil)
+		require.NoError(t, err)
+		require.NoError(t, req.Write(client))
+		rsp, err := http.ReadResponse(cr, req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(rsp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "app "+path, string(body))
+		_ = rsp.Body.Close()
+	}
+	client.Close()
+	assert.NoError(t, <-errs)
+}
+
+func Test_interceptRules(t *testing.T) {
+	rules := httprewrite.Rules{{Request: &httprewrite.Headers{Remove: []string{"X-Secret"}}}}
+	plain := httpCept("s1:echo")
+	assert.Equal(t, rules, interceptRules(rules, plain))
+
+	alice := httpCept("s1:alice")
+	alice.Spec.IdentityHeaders = map[string]string{"X-User": "alice"}
+	bob := httpCept("s1:bob")
+	bob.Spec.IdentityHeaders = map[string]string{"X-User": "bob"}
+
+	// Every request of a keep-alive connection gets the identity rule of its own intercept only
+	for i := 0; i < 3; i++ {
+		for _, ii := range []*manager.InterceptInfo{alice, bob} {
+			rs := interceptRules(rules, ii)
+			require.Len(t, rs, 2)
+			assert.Equal(t, ii.Spec.IdentityHeaders, rs[1].Request.Set)
+		}
+	}
+	assert.Len(t, rules, 1)
+	assert.Equal(t, rules, interceptRules(rules, plain))
+}
@@ -0,0 +1,185 @@
+package forwarder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/httprewrite"
+)
+
+const (
+	// mirrorQueueSize is the number of reads of a connection, or the number of requests, that may wait to be
+	// sent to a mirroring intercept. A mirror never delays the traffic that the app serves, so traffic that
+	// arrives when the queue is full isn't mirrored.
+	mirrorQueueSize = 64
+
+	// maxMirrorBody is the largest request body that is copied to a mirroring intercept of HTTP requests.
+	// Requests with larger bodies aren't mirrored.
+	maxMirrorBody = 1024 * 1024
+)
+
+// dialMirror returns a connection that reaches the given mirroring intercept. The connection has the addresses
+// of the given connection, which it mirrors, and the identity headers and the given rewrite rules are applied to
+// the requests that are written to it, just like to the requests of an intercept that isn't mirrored.
+func (f *Forwarder) dialMirror(ctx context.Context, conn net.Conn, ii *manager.InterceptInfo, rules httprewrite.Rules) net.Conn {
+	inner, outer := net.Pipe()
+	go func() {
+		var c net.Conn = &addrConn{Conn: outer, local: conn.LocalAddr(), remote: conn.RemoteAddr()}
+		if hs := ii.Spec.IdentityHeaders; len(hs) > 0 {
+			rules = append(rules[:len(rules):len(rules)], &httprewrite.Rule{Request: &httprewrite.Headers{Set: hs}})
+		}
+		if len(rules) > 0 {
+			c = rules.Wrap(ctx, c)
+		}
+		if err := f.interceptConn(ctx, c, ii); err != nil {
+			dlog.Error(ctx, err)
+		}
+		_ = outer.Close()
+	}()
+	return inner
+}
+
+// connMirror copies what's read from a connection to a mirroring intercept. Writes never block. A copy with a
+// gap is useless, so the mirror is abandoned when the intercept can't keep up.
+type connMirror struct {
+	sync.Mutex
+	ch     chan []byte
+	closed bool
+}
+
+func (f *Forwarder) mirrorConn(ctx context.Context, conn net.Conn, ii *manager.InterceptInfo, rules httprewrite.Rules) *connMirror {
+	m := &connMirror{ch: make(chan []byte, mirrorQueueSize)}
+	mc := f.dialMirror(ctx, conn, ii, rules)
+	go func() {
+		_, _ = io.Copy(io.Discard, mc)
+	}()
+	go func() {
+		defer mc.Close()
+		for b := range m.ch {
+			if _, err := mc.Write(b); err != nil {
+				m.close()
+			}
+		}
+	}()
+	return m
+}
+
+// Write queues a copy of the given data. It always succeeds, so that it can be used with an io.TeeReader.
+func (m *connMirror) Write(b []byte) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+	if !m.closed && len(b) > 0 {
+		select {
+		case m.ch <- append([]byte(nil), b...):
+		default:
+			m.closed = true
+			close(m.ch)
+		}
+	}
+	return len(b), nil
+}
+
+func (m *connMirror) close() {
+	m.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.ch)
+	}
+	m.Unlock()
+}
+
+// httpMirror sends copies of HTTP requests to a mirroring intercept, one at a time, and discards the responses.
+type httpMirror struct {
+	sync.Mutex
+	ch     chan *http.Request
+	closed bool
+}
+
+func (f *Forwarder) mirrorHTTP(ctx context.Context, conn net.Conn, ii *manager.InterceptInfo, rules httprewrite.Rules) *httpMirror {
+	m := &httpMirror{ch: make(chan *http.Request, mirrorQueueSize)}
+	mc := f.dialMirror(ctx, conn, ii, rules)
+	go func() {
+		defer mc.Close()
+		br := bufio.NewReader(mc)
+		for req := range m.ch {
+			err := req.Write(mc)
+			if err == nil {
+				var rsp *http.Response
+				if rsp, err = http.ReadResponse(br, req); err == nil {
+					_, err = io.Copy(io.Discard, rsp.Body)
+					_ = rsp.Body.Close()
+				}
+			}
+			if err != nil {
+				dlog.Debugf(ctx, "unable to mirror %s %s to intercept %s: %v", req.Method, req.URL, ii.Spec.Name, err)
+				m.close()
+			}
+		}
+	}()
+	return m
+}
+
+// send queues a copy of the given request, whose body must have been read already and is given separately.
+// The copy is dropped when the queue is full.
+func (m *httpMirror) send(ctx context.Context, req *http.Request, body []byte) {
+	cp := req.Clone(ctx)
+	cp.Body = io.NopCloser(bytes.NewReader(body))
+	cp.ContentLength = int64(len(body))
+	cp.TransferEncoding = nil
+
+	// The body is complete, so there's nothing to continue
+	cp.Header.Del("Expect")
+	m.Lock()
+	defer m.Unlock()
+	if m.closed {
+		return
+	}
+	select {
+	case m.ch <- cp:
+	default:
+		dlog.Debugf(ctx, "dropping the mirror of %s %s, the intercept is lagging behind", req.Method, req.URL)
+	}
+}
+
+func (m *httpMirror) close() {
+	m.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.ch)
+	}
+	m.Unlock()
+}
+
+// mirrorBody is the body of a request that is mirrored. It keeps a copy of what the app reads, and calls done
+// with the copy once the app has read the body in full. The copy is abandoned when the body turns out to be larger
+// than maxMirrorBody, so the app is never delayed, and a body that the app doesn't read in full isn't mirrored.
+type mirrorBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	done func([]byte)
+}
+
+func (b *mirrorBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.done != nil {
+		if b.buf.Len()+n > maxMirrorBody {
+			b.done = nil
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+			if err == io.EOF {
+				done := b.done
+				b.done = nil
+				done(b.buf.Bytes())
+			}
+		}
+	}
+	return n, err
+}
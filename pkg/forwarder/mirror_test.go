@@ -0,0 +1,77 @@
+package forwarder
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnMirror_Write(t *testing.T) {
+	m := &connMirror{ch: make(chan []byte, 2)}
+
+	// Writes are copied and never fail
+	buf := []byte("one")
+	n, err := m.Write(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	buf[0] = 'x'
+	_, _ = m.Write([]byte("two"))
+	assert.Equal(t, "one", string(<-m.ch))
+
+	// A write that doesn't fit in the queue abandons the mirror, because a copy with a gap is useless
+	_, _ = m.Write([]byte("three"))
+	n, err = m.Write([]byte("four"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	var got []string
+	for b := range m.ch {
+		got = append(got, string(b))
+	}
+	assert.Equal(t, []string{"two", "three"}, got)
+	m.close()
+}
+
+func TestMirrorBody(t *testing.T) {
+	var mirrored []byte
+	done := func(body []byte) {
+		mirrored = append([]byte(nil), body...)
+	}
+
+	// The body is passed on as it's read, and the copy is complete once the body has been read in full
+	pr, pw := io.Pipe()
+	b := &mirrorBody{ReadCloser: pr, done: done}
+	go func() {
+		_, _ = pw.Write([]byte("hel"))
+		_, _ = pw.Write([]byte("lo"))
+		_ = pw.Close()
+	}()
+	buf := make([]byte, 3)
+	n, err := io.ReadFull(b, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hel", string(buf[:n]))
+	assert.Nil(t, mirrored, "nothing is mirrored before the body is complete")
+	rest, err := io.ReadAll(b)
+	require.NoError(t, err)
+	assert.Equal(t, "lo", string(rest))
+	assert.Equal(t, "hello", string(mirrored))
+
+	// A body that is too large isn't mirrored, but is still read in full
+	mirrored = nil
+	large := bytes.Repeat([]byte{'a'}, maxMirrorBody+10)
+	b = &mirrorBody{ReadCloser: io.NopCloser(bytes.NewReader(large)), done: done}
+	rest, err = io.ReadAll(b)
+	require.NoError(t, err)
+	assert.Equal(t, large, rest)
+	assert.Nil(t, mirrored)
+
+	// A body that isn't read in full isn't mirrored
+	b = &mirrorBody{ReadCloser: io.NopCloser(strings.NewReader("hello")), done: done}
+	_, err = b.Read(make([]byte, 2))
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+	assert.Nil(t, mirrored)
+}
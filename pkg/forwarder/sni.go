@@ -0,0 +1,106 @@
+package forwarder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+const (
+	tlsRecordHeaderLen        = 5
+	tlsRecordTypeHandshake    = 22
+	tlsHandshakeClientHello   = 1
+	tlsExtensionServerName    = 0
+	tlsServerNameTypeHostName = 0
+)
+
+// readClientHello reads the first TLS record from the given reader and returns the bytes that were
+// read together with the server name (SNI) of the ClientHello that the record contains. The server
+// name is empty when the data isn't a TLS ClientHello or when the client didn't send an SNI. The
+// returned bytes must be replayed to whatever receives the connection.
+func readClientHello(r io.Reader) ([]byte, string) {
+	var buf bytes.Buffer
+	tr := io.TeeReader(r, &buf)
+	hdr := make([]byte, tlsRecordHeaderLen)
+	if _, err := io.ReadFull(tr, hdr); err != nil || hdr[0] != tlsRecordTypeHandshake {
+		return buf.Bytes(), ""
+	}
+	rec := make([]byte, binary.BigEndian.Uint16(hdr[3:]))
+	if _, err := io.ReadFull(tr, rec); err != nil {
+		return buf.Bytes(), ""
+	}
+	return buf.Bytes(), clientHelloServerName(rec)
+}
+
+// helloReader reads the length prefixed fields of a ClientHello. Reads past the end of the data
+// yield empty fields and make ok return false.
+type helloReader struct {
+	data []byte
+	bad  bool
+}
+
+func (h *helloReader) skip(n int) []byte {
+	if h.bad || n > len(h.data) {
+		h.bad = true
+		return nil
+	}
+	b := h.data[:n]
+	h.data = h.data[n:]
+	return b
+}
+
+func (h *helloReader) u8() int {
+	if b := h.skip(1); b != nil {
+		return int(b[0])
+	}
+	return 0
+}
+
+func (h *helloReader) u16() int {
+	if b := h.skip(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (h *helloReader) ok() bool {
+	return !h.bad
+}
+
+// clientHelloServerName returns the host name of the server_name extension of the ClientHello
+// handshake message in the given record, or an empty string if there is none.
+func clientHelloServerName(rec []byte) string {
+	h := &helloReader{data: rec}
+	if h.u8() != tlsHandshakeClientHello {
+		return ""
+	}
+	h.skip(3)       // handshake length
+	h.skip(2)       // client version
+	h.skip(32)      // random
+	h.skip(h.u8())  // session id
+	h.skip(h.u16()) // cipher suites
+	h.skip(h.u8())  // compression methods
+	exts := &helloReader{data: h.skip(h.u16())}
+	if !h.ok() {
+		return ""
+	}
+	for exts.ok() && len(exts.data) > 0 {
+		extType := exts.u16()
+		ext := exts.skip(exts.u16())
+		if extType != tlsExtensionServerName || !exts.ok() {
+			continue
+		}
+		sn := &helloReader{data: ext}
+		names := &helloReader{data: sn.skip(sn.u16())}
+		for names.ok() && len(names.data) > 0 {
+			nameType := names.u8()
+			name := names.skip(names.u16())
+			if nameType == tlsServerNameTypeHostName && names.ok() {
+				return strings.ToLower(strings.TrimSuffix(string(name), "."))
+			}
+		}
+		return ""
+	}
+	return ""
+}
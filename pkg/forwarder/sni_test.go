@@ -0,0 +1,46 @@
+package forwarder
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func clientHello(t *testing.T, serverName string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		tc := tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		_ = tc.Handshake()
+		client.Close()
+	}()
+	hello, _ := readClientHello(server)
+	return hello
+}
+
+func Test_readClientHello(t *testing.T) {
+	hello := clientHello(t, "Echo.Example.com")
+	data, host := readClientHello(bytes.NewReader(hello))
+	assert.Equal(t, "echo.example.com", host)
+	assert.Equal(t, hello, data, "all bytes that were read must be returned")
+
+	// No SNI is sent when the client has no server name
+	_, host = readClientHello(bytes.NewReader(clientHello(t, "")))
+	assert.Equal(t, "", host)
+
+	plain := []byte("GET / HTTP/1.1\r\nHost: echo\r\n\r\n")
+	data, host = readClientHello(bytes.NewReader(plain))
+	assert.Equal(t, "", host)
+	assert.Equal(t, plain[:tlsRecordHeaderLen], data)
+
+	// Truncated records yield no host and no panic
+	for i := tlsRecordHeaderLen; i < len(hello); i += 7 {
+		_, host = readClientHello(bytes.NewReader(hello[:i]))
+		assert.Equal(t, "", host)
+	}
+	_, host = readClientHello(bytes.NewReader(append(hello[:tlsRecordHeaderLen:tlsRecordHeaderLen], make([]byte, len(hello)-tlsRecordHeaderLen)...)))
+	assert.Equal(t, "", host)
+}
@@ -0,0 +1,187 @@
+package httprewrite
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+type wrappedConn struct {
+	net.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *wrappedConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *wrappedConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Wrap returns a connection that, when read, produces the requests that arrive on the given
+// connection after the matching request rules have been applied. Responses written to the returned
+// connection are written to the given connection after the matching response rules have been
+// applied. A connection that is upgraded to another protocol is passed through unaltered after the
+// upgrade, and a connection that doesn't carry HTTP/1.x, e.g. one that carries HTTP/2 or gRPC, is
+// passed through unaltered altogether.
+func (rs Rules) Wrap(ctx context.Context, conn net.Conn) net.Conn {
+	inner, outer := net.Pipe()
+	go func() {
+		defer conn.Close()
+		defer inner.Close()
+		if err := rs.serve(conn, inner); err != nil {
+			dlog.Errorf(ctx, "HTTP rewrite of connection from %s failed: %v", conn.RemoteAddr(), err)
+		}
+	}()
+	return &wrappedConn{Conn: outer, local: conn.LocalAddr(), remote: conn.RemoteAddr()}
+}
+
+func (rs Rules) serve(conn, inner net.Conn) error {
+	cr := bufio.NewReader(conn)
+	ir := bufio.NewReader(inner)
+
+	// The side that speaks first is awaited concurrently, because the server speaks first in some
+	// protocols. Each reader is only used by one goroutine at a time, so the other side's reader is
+	// used only once its peek has returned.
+	clientFirst := make(chan struct{})
+	go func() {
+		_, _ = cr.Peek(1)
+		close(clientFirst)
+	}()
+	appFirst := make(chan struct{})
+	go func() {
+		_, _ = ir.Peek(1)
+		close(appFirst)
+	}()
+	select {
+	case <-clientFirst:
+		if !isHTTP1(cr) {
+			return passThrough(conn, cr, clientFirst, inner, ir, appFirst)
+		}
+	case <-appFirst:
+		// An HTTP server never speaks first
+		return passThrough(conn, cr, clientFirst, inner, ir, appFirst)
+	}
+
+	for first := true; ; first = false {
+		req, err := http.ReadRequest(cr)
+		if err != nil {
+			return ignoreClosed(err)
+		}
+		matched := rs.Matching(req)
+		matched.RewriteRequest(req)
+		if err = req.Write(inner); err != nil {
+			return ignoreClosed(err)
+		}
+		if first {
+			<-appFirst
+		}
+		rsp, err := http.ReadResponse(ir, req)
+		if err != nil {
+			return ignoreClosed(err)
+		}
+		matched.RewriteResponse(rsp)
+		err = rsp.Write(conn)
+		_ = rsp.Body.Close()
+		if err != nil {
+			return ignoreClosed(err)
+		}
+		if rsp.StatusCode == http.StatusSwitchingProtocols {
+			go func() {
+				_, _ = io.Copy(inner, cr)
+				_ = inner.Close()
+			}()
+			_, err = io.Copy(conn, ir)
+			return ignoreClosed(err)
+		}
+		if req.Close || rsp.Close {
+			return nil
+		}
+	}
+}
+
+// passThrough copies the traffic between the client and the app unaltered. Each reader is used once
+// its ready channel is closed.
+func passThrough(conn net.Conn, cr *bufio.Reader, clientReady <-chan struct{}, inner net.Conn, ir *bufio.Reader, appReady <-chan struct{}) error {
+	go func() {
+		<-clientReady
+		_, _ = io.Copy(inner, cr)
+		_ = inner.Close()
+	}()
+	<-appReady
+	_, err := io.Copy(conn, ir)
+	return ignoreClosed(err)
+}
+
+// isHTTP1 returns true if the given reader starts with an HTTP/1.x request line. It reads no more than
+// what's needed to tell, so a client that waits for the server after sending a few bytes that can't
+// start a request line isn't stalled. The HTTP/2 connection preface resembles a request line, but its
+// version is "HTTP/2.0".
+func isHTTP1(br *bufio.Reader) bool {
+	for {
+		n := br.Buffered()
+		b, _ := br.Peek(n)
+		if isHTTP, decided := checkRequestLine(b); decided {
+			return isHTTP
+		}
+		if n == br.Size() {
+			return false
+		}
+		if _, err := br.Peek(n + 1); err != nil {
+			return false
+		}
+	}
+}
+
+// maxMethodLength is the length of the longest method that is recognized.
+const maxMethodLength = 32
+
+// checkRequestLine checks if the given bytes start with an HTTP/1.x request line. The decided result
+// is false when more bytes are needed to tell.
+func checkRequestLine(b []byte) (isHTTP, decided bool) {
+	sp := bytes.IndexByte(b, ' ')
+	method := b
+	if sp >= 0 {
+		method = b[:sp]
+	}
+	for _, c := range method {
+		if !httpguts.IsTokenRune(rune(c)) {
+			return false, true
+		}
+	}
+	if sp < 0 {
+		return false, len(b) > maxMethodLength
+	}
+	if sp == 0 || sp > maxMethodLength {
+		return false, true
+	}
+	eol := bytes.IndexByte(b, '\n')
+	if eol < 0 {
+		for _, c := range b[sp:] {
+			if c < ' ' && c != '\r' || c == 0x7f {
+				return false, true
+			}
+		}
+		return false, false
+	}
+	parts := strings.Split(strings.TrimSuffix(string(b[:eol]), "\r"), " ")
+	return len(parts) == 3 && parts[1] != "" && strings.HasPrefix(parts[2], "HTTP/1."), true
+}
+
+func ignoreClosed(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+// Package httprewrite contains declarative rewrite rules that the traffic-agent applies to the
+// HTTP requests and responses of intercepted connections. The rules are declared per workload
+// using the install.HTTPRewriteAnnotation and are validated by the traffic-manager before the
+// traffic-agent is injected.
+package httprewrite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+	"sigs.k8s.io/yaml"
+)
+
+// Headers describes how to rewrite the headers of a request or a response. Headers listed in
+// Remove are removed before the headers in Set are added or replaced.
+type Headers struct {
+	Remove []string          `json:"remove,omitempty"`
+	Set    map[string]string `json:"set,omitempty"`
+}
+
+// Rule is a rewrite rule. A rule applies to requests whose path starts with PathPrefix, or to all
+// requests when PathPrefix is empty.
+type Rule struct {
+	PathPrefix string   `json:"pathPrefix,omitempty"`
+	Request    *Headers `json:"request,omitempty"`
+	Response   *Headers `json:"response,omitempty"`
+}
+
+// Rules is an ordered list of rules. All matching rules are applied in order.
+type Rules []*Rule
+
+// Parse parses the given YAML or JSON list of rules and validates the result.
+func Parse(data string) (Rules, error) {
+	var rs Rules
+	if err := yaml.UnmarshalStrict([]byte(data), &rs); err != nil {
+		return nil, fmt.Errorf("unable to parse HTTP rewrite rules: %w", err)
+	}
+	if err := rs.Validate(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Validate checks that the rules are well-formed.
+func (rs Rules) Validate() error {
+	for i, r := range rs {
+		if r == nil {
+			return fmt.Errorf("HTTP rewrite rule %d is empty", i)
+		}
+		if r.PathPrefix != "" && !strings.HasPrefix(r.PathPrefix, "/") {
+			return fmt.Errorf("HTTP rewrite rule %d: pathPrefix %q must start with a slash", i, r.PathPrefix)
+		}
+		if r.Request == nil && r.Response == nil {
+			return fmt.Errorf("HTTP rewrite rule %d has neither request nor response", i)
+		}
+		if err := r.Request.validate(); err != nil {
+			return fmt.Errorf("HTTP rewrite rule %d, request: %w", i, err)
+		}
+		if err := r.Response.validate(); err != nil {
+			return fmt.Errorf("HTTP rewrite rule %d, response: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (h *Headers) validate() error {
+	if h == nil {
+		return nil
+	}
+	if len(h.Remove) == 0 && len(h.Set) == 0 {
+		return errors.New("neither remove nor set is declared")
+	}
+	for _, n := range h.Remove {
+		if !httpguts.ValidHeaderFieldName(n) {
+			return fmt.Errorf("invalid header name %q", n)
+		}
+	}
+	for n, v := range h.Set {
+		if !httpguts.ValidHeaderFieldName(n) {
+			return fmt.Errorf("invalid header name %q", n)
+		}
+		if !httpguts.ValidHeaderFieldValue(v) {
+			return fmt.Errorf("invalid value for header %q", n)
+		}
+	}
+	return nil
+}
+
+// String returns the compact JSON representation of the rules.
+func (rs Rules) String() string {
+	data, _ := json.Marshal(rs)
+	return string(data)
+}
+
+func (h *Headers) apply(hdr http.Header) {
+	if h == nil {
+		return
+	}
+	for _, n := range h.Remove {
+		hdr.Del(n)
+	}
+	for n, v := range h.Set {
+		hdr.Set(n, v)
+	}
+}
+
+// Matching returns the rules that apply to the given request.
+func (rs Rules) Matching(req *http.Request) Rules {
+	var m Rules
+	for _, r := range rs {
+		if strings.HasPrefix(req.URL.Path, r.PathPrefix) {
+			m = append(m, r)
+		}
+	}
+	return m
+}
+
+// RewriteRequest applies the request part of the rules to the given request.
+func (rs Rules) RewriteRequest(req *http.Request) {
+	for _, r := range rs {
+		r.Request.apply(req.Header)
+	}
+}
+
+// RewriteResponse applies the response part of the rules to the given response.
+func (rs Rules) RewriteResponse(rsp *http.Response) {
+	for _, r := range rs {
+		r.Response.apply(rsp.Header)
+	}
+}
@@ -0,0 +1,203 @@
+package httprewrite
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			data: `
+- pathPrefix: /api
+  request:
+    remove: [Cookie]
+    set:
+      Authorization: Bearer dev-token
+- response:
+    remove: [Set-Cookie]
+`,
+		},
+		{
+			name:    "unknown field",
+			data:    `[{"request": {"remove": ["Cookie"]}, "bogus": true}]`,
+			wantErr: "unable to parse",
+		},
+		{
+			name:    "bad path",
+			data:    `[{"pathPrefix": "api", "request": {"remove": ["Cookie"]}}]`,
+			wantErr: "must start with a slash",
+		},
+		{
+			name:    "no action",
+			data:    `[{"pathPrefix": "/api"}]`,
+			wantErr: "neither request nor response",
+		},
+		{
+			name:    "empty headers",
+			data:    `[{"request": {}}]`,
+			wantErr: "neither remove nor set",
+		},
+		{
+			name:    "bad header name",
+			data:    `[{"request": {"remove": ["Bad Header"]}}]`,
+			wantErr: `invalid header name "Bad Header"`,
+		},
+		{
+			name:    "bad header value",
+			data:    `[{"response": {"set": {"X-Test": "a\nb"}}}]`,
+			wantErr: `invalid value for header "X-Test"`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := Parse(tt.data)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			rs2, err := Parse(rs.String())
+			require.NoError(t, err)
+			assert.Equal(t, rs, rs2)
+		})
+	}
+}
+
+func TestRules_Wrap(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	rs, err := Parse(`
+- pathPrefix: /api
+  request:
+    remove: [Cookie]
+    set: {Authorization: Bearer dev-token}
+  response:
+    remove: [Set-Cookie]
+`)
+	require.NoError(t, err)
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	wc := rs.Wrap(ctx, conn)
+	assert.Equal(t, conn.RemoteAddr(), wc.RemoteAddr())
+
+	// The app side of the wrapped connection
+	go func() {
+		defer wc.Close()
+		br := bufio.NewReader(wc)
+		for {
+			req, err := http.ReadRequest(br)
+			if err != nil {
+				return
+			}
+			body := fmt.Sprintf("%s;%s;%s", req.URL.Path, req.Header.Get("Authorization"), req.Header.Get("Cookie"))
+			_, _ = fmt.Fprintf(wc, "HTTP/1.1 200 OK\r\nSet-Cookie: x=y\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+		}
+	}()
+
+	br := bufio.NewReader(client)
+	roundTrip := func(path string) (*http.Response, string) {
+		_, err := fmt.Fprintf(client, "GET %s HTTP/1.1\r\nHost: app\r\nCookie: a=b\r\n\r\n", path)
+		require.NoError(t, err)
+		rsp, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(rsp.Body)
+		require.NoError(t, err)
+		return rsp, string(body)
+	}
+
+	rsp, body := roundTrip("/api/x")
+	assert.Equal(t, "/api/x;Bearer dev-token;", body)
+	assert.Empty(t, rsp.Header.Get("Set-Cookie"))
+
+	rsp, body = roundTrip("/other")
+	assert.Equal(t, "/other;;a=b", body)
+	assert.Equal(t, "x=y", rsp.Header.Get("Set-Cookie"))
+}
+
+func Test_checkRequestLine(t *testing.T) {
+	tests := []struct {
+		data    string
+		isHTTP  bool
+		decided bool
+	}{
+		{"GET /api HTTP/1.1\r\nHost: x\r\n", true, true},
+		{"POST / HTTP/1.0\n", true, true},
+		{"GE", false, false},
+		{"GET /api", false, false},
+		{"PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", false, true},
+		{"\x16\x03\x01\x02\x00", false, true},
+		{"GET /a\x00b", false, true},
+		{"GET  HTTP/1.1\r\n", false, true},
+		{" GET / HTTP/1.1\r\n", false, true},
+	}
+	for _, tt := range tests {
+		isHTTP, decided := checkRequestLine([]byte(tt.data))
+		assert.Equal(t, tt.isHTTP, isHTTP, "%q", tt.data)
+		assert.Equal(t, tt.decided, decided, "%q", tt.data)
+	}
+}
+
+func TestRules_WrapPassThrough(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	rs, err := Parse(`
+- request:
+    set: {Authorization: Bearer dev-token}
+`)
+	require.NoError(t, err)
+
+	roundTrip := func(t *testing.T, appFirst bool, sent, reply string) {
+		client, conn := net.Pipe()
+		defer client.Close()
+		wc := rs.Wrap(ctx, conn)
+		defer wc.Close()
+
+		go func() {
+			if appFirst {
+				_, _ = io.WriteString(wc, "220 ready\r\n")
+			}
+			buf := make([]byte, len(sent))
+			if _, err := io.ReadFull(wc, buf); err == nil && string(buf) == sent {
+				_, _ = io.WriteString(wc, reply)
+			}
+		}()
+		if appFirst {
+			buf := make([]byte, len("220 ready\r\n"))
+			_, err := io.ReadFull(client, buf)
+			require.NoError(t, err)
+			assert.Equal(t, "220 ready\r\n", string(buf))
+		}
+		_, err := io.WriteString(client, sent)
+		require.NoError(t, err)
+		buf := make([]byte, len(reply))
+		_, err = io.ReadFull(client, buf)
+		require.NoError(t, err)
+		assert.Equal(t, reply, string(buf))
+	}
+
+	t.Run("HTTP/2", func(t *testing.T) {
+		roundTrip(t, false, "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", "\x00\x00\x00\x04\x00\x00\x00\x00\x00")
+	})
+	t.Run("binary", func(t *testing.T) {
+		roundTrip(t, false, "\x16\x03\x01\x02\x00", "\x16\x03\x03")
+	})
+	t.Run("server speaks first", func(t *testing.T) {
+		roundTrip(t, true, "EHLO example.com\r\n", "250 ok\r\n")
+	})
+}
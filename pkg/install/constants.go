@@ -1,17 +1,38 @@
 package install
 
 const (
-	AgentContainerName        = "traffic-agent"
-	AgentAnnotationVolumeName = "traffic-annotations"
-	AgentInjectorName         = "agent-injector"
-	DomainPrefix              = "telepresence.getambassador.io/"
-	InjectAnnotation          = DomainPrefix + "inject-" + AgentContainerName
-	ServicePortAnnotation     = DomainPrefix + "inject-service-port"
-	ServiceNameAnnotation     = DomainPrefix + "inject-service-name"
-	ManualInjectAnnotation    = DomainPrefix + "manually-injected"
-	ManagerAppName            = "traffic-manager"
-	ManagerPortHTTP           = 8081
-	MutatorWebhookPortHTTPS   = 8443
-	MutatorWebhookTLSName     = "mutator-webhook-tls"
-	TelAppMountPoint          = "/tel_app_mounts"
+	AgentContainerName            = "traffic-agent"
+	AgentAnnotationVolumeName     = "traffic-annotations"
+	AgentInjectorName             = "agent-injector"
+	AgentKeyExchangePort          = 9899
+	DomainPrefix                  = "telepresence.getambassador.io/"
+	InjectAnnotation              = DomainPrefix + "inject-" + AgentContainerName
+	ServicePortAnnotation         = DomainPrefix + "inject-service-port"
+	ServiceNameAnnotation         = DomainPrefix + "inject-service-name"
+	ContainerNameAnnotation       = DomainPrefix + "inject-container-name"
+	ManualInjectAnnotation        = DomainPrefix + "manually-injected"
+	HTTPRewriteAnnotation         = DomainPrefix + "http-rewrite"
+	AgentPortsAnnotation          = DomainPrefix + "agent-ports"
+	InjectionEnabledAnnotation    = DomainPrefix + "injection-enabled"
+	RestartedAtAnnotation         = DomainPrefix + "restartedAt"
+	AgentCPURequestAnnotation     = DomainPrefix + "agent-cpu-request"
+	AgentCPULimitAnnotation       = DomainPrefix + "agent-cpu-limit"
+	AgentMemRequestAnnotation     = DomainPrefix + "agent-memory-request"
+	AgentMemLimitAnnotation       = DomainPrefix + "agent-memory-limit"
+	InterceptDependentsAnnotation = DomainPrefix + "intercept-dependents"
+	RedirectModeAnnotation        = DomainPrefix + "inject-redirect-mode"
+	ManagerAppName                = "traffic-manager"
+	ManagerPortHTTP               = 8081
+	ManagerPortMTLS               = 8082
+	ManagerPortMTLSName           = "grpc-mtls"
+	ManagerPortMTLSBootstrap      = 8083
+	MTLSBootstrapPath             = "/client-certificate"
+	ManagerMTLSSecretName         = "traffic-manager-mtls"
+	MTLSCACertFile                = "ca.pem"
+	MTLSCAKeyFile                 = "ca-key.pem"
+	MutatorWebhookPortHTTPS       = 8443
+	MutatorWebhookTLSName         = "mutator-webhook-tls"
+	TelAppMountPoint              = "/tel_app_mounts"
+	TelAppWebDAVReadOnlyPrefix    = "/telepresence-readonly"
+	TelAppWebDAVUser              = "telepresence"
 )
@@ -3,6 +3,7 @@ package install
 import (
 	"strconv"
 	"strings"
+	"time"
 
 	core "k8s.io/api/core/v1"
 )
@@ -50,6 +51,39 @@ func AgentContainer(
 	}
 }
 
+// AgentLogFormatEnv returns the environment variable that tells the traffic-agent to use the given
+// log format.
+func AgentLogFormatEnv(format string) core.EnvVar {
+	return core.EnvVar{
+		Name:  EnvPrefix + "LOG_FORMAT",
+		Value: format,
+	}
+}
+
+// AgentExitWithAppEnv returns the environment variable that tells the traffic-agent to exit when the
+// processes of the other containers in its pod have terminated. The pod must share its process namespace.
+func AgentExitWithAppEnv() core.EnvVar {
+	return core.EnvVar{
+		Name:  EnvPrefix + "EXIT_WITH_APP",
+		Value: "true",
+	}
+}
+
+// AgentTunnelEnv returns the environment variables that configure the idle timeouts and the keep-alive interval of
+// the connections that the traffic-agent tunnels. Zero values are omitted so that the agent uses its defaults.
+func AgentTunnelEnv(tcpIdleTimeout, udpIdleTimeout, keepAlive time.Duration) []core.EnvVar {
+	var env []core.EnvVar
+	add := func(name string, d time.Duration) {
+		if d > 0 {
+			env = append(env, core.EnvVar{Name: EnvPrefix + name, Value: d.String()})
+		}
+	}
+	add("TUNNEL_TCP_IDLE_TIMEOUT", tcpIdleTimeout)
+	add("TUNNEL_UDP_IDLE_TIMEOUT", udpIdleTimeout)
+	add("TUNNEL_KEEPALIVE", keepAlive)
+	return env
+}
+
 // InitContainer will return a configured init container for an agent.
 func InitContainer(imageName string, port core.ContainerPort, appPort int) core.Container {
 	env := []core.EnvVar{
@@ -191,6 +225,17 @@ func appEnvironment(appContainer *core.Container, apiPort int) []core.EnvVar {
 	return envCopy
 }
 
+// AgentAppContainerName returns the name of the app container that the given traffic-agent container was
+// configured from, or an empty string if that can't be determined.
+func AgentAppContainerName(agentContainer *core.Container) string {
+	for _, ev := range agentContainer.Env {
+		if ev.Name == "TELEPRESENCE_CONTAINER" {
+			return ev.Value
+		}
+	}
+	return ""
+}
+
 const maxPortNameLen = 15
 
 // HiddenPortName prefixes the given name with "tm-" and truncates it to 15 characters. If
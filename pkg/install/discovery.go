@@ -116,6 +116,26 @@ func FindMatchingService(c context.Context, portNameOrNumber, svcName, namespace
 	return nil, fmt.Errorf("found %s services with a selector matching labels %v%s in namespace %s%s", count, labels, portRef, namespace, suffix)
 }
 
+// SelectContainers returns the containers to consider when looking for the container to intercept. That's all
+// the given containers when the containerName is empty, and otherwise a slice that holds the container with the
+// given name. The returned slice shares the elements of the given slice.
+func SelectContainers(cns []core.Container, containerName string) ([]core.Container, error) {
+	if containerName == "" {
+		return cns, nil
+	}
+	names := make([]string, 0, len(cns))
+	for i := range cns {
+		name := cns[i].Name
+		if name == containerName {
+			return cns[i : i+1], nil
+		}
+		if name != AgentContainerName {
+			names = append(names, name)
+		}
+	}
+	return nil, fmt.Errorf("found no container named %q, the containers are: %s", containerName, strings.Join(names, ", "))
+}
+
 // FindMatchingPort finds the matching container associated with portNameOrNumber
 // in the given service.
 func FindMatchingPort(cns []core.Container, portNameOrNumber string, svc *core.Service) (
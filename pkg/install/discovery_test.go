@@ -0,0 +1,55 @@
+package install
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestSelectContainers(t *testing.T) {
+	cns := []core.Container{{Name: "proxy"}, {Name: "app"}, {Name: AgentContainerName}}
+
+	sel, err := SelectContainers(cns, "")
+	require.NoError(t, err)
+	assert.Len(t, sel, 3)
+
+	sel, err = SelectContainers(cns, "app")
+	require.NoError(t, err)
+	require.Len(t, sel, 1)
+	assert.Same(t, &cns[1], &sel[0], "the selected container must be an element of the given slice")
+
+	_, err = SelectContainers(cns, "worker")
+	require.Error(t, err)
+	assert.Equal(t, `found no container named "worker", the containers are: proxy, app`, err.Error())
+}
+
+func TestFindMatchingPort_selectedContainer(t *testing.T) {
+	svc := &core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "echo"},
+		Spec: core.ServiceSpec{Ports: []core.ServicePort{{
+			Port:       80,
+			TargetPort: intstr.FromInt(8080),
+		}}},
+	}
+	cns := []core.Container{
+		{Name: "proxy", Ports: []core.ContainerPort{{ContainerPort: 8080}}},
+		{Name: "app"},
+	}
+
+	// The port is declared by the proxy, so it's selected by default
+	_, cn, idx, err := FindMatchingPort(cns, "", svc)
+	require.NoError(t, err)
+	assert.Equal(t, "proxy", cn.Name)
+	assert.Equal(t, 0, idx)
+
+	sel, err := SelectContainers(cns, "app")
+	require.NoError(t, err)
+	_, cn, idx, err = FindMatchingPort(sel, "", svc)
+	require.NoError(t, err)
+	assert.Same(t, &cns[1], cn)
+	assert.Equal(t, -1, idx)
+}
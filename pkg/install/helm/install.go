@@ -2,16 +2,23 @@ package helm
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/release"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 
 	"github.com/datawire/dlib/dlog"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/k8sapi"
 )
 
@@ -19,7 +26,7 @@ const helmDriver = "secrets"
 const releaseName = "traffic-manager"
 const releaseOwner = "telepresence-cli"
 
-func getHelmConfig(ctx context.Context, configFlags *genericclioptions.ConfigFlags, namespace string) (*action.Configuration, error) {
+func getHelmConfig(ctx context.Context, configFlags genericclioptions.RESTClientGetter, namespace string) (*action.Configuration, error) {
 	helmConfig := &action.Configuration{}
 	err := helmConfig.Init(configFlags, namespace, helmDriver, func(format string, args ...interface{}) {
 		ctx := dlog.WithField(ctx, "source", "helm")
@@ -46,6 +53,16 @@ func getValues(ctx context.Context) map[string]interface{} {
 		"systemaPort": cloudConfig.SystemaPort,
 		"createdBy":   releaseOwner,
 	}
+	if cloudConfig.Disabled {
+		values["systemaDisabled"] = true
+	}
+	if cloudConfig.CACertFile != "" {
+		if pem, err := os.ReadFile(cloudConfig.CACertFile); err != nil {
+			dlog.Errorf(ctx, "unable to read cloud.caCertFile: %v", err)
+		} else {
+			values["systemaCACert"] = string(pem)
+		}
+	}
 	if !clientConfig.Grpc.MaxReceiveSize.IsZero() {
 		values["grpc"] = map[string]interface{}{
 			"maxReceiveSize": clientConfig.Grpc.MaxReceiveSize.String(),
@@ -103,7 +120,7 @@ func timedRun(ctx context.Context, run func(time.Duration) error) error {
 	}
 }
 
-func installNew(ctx context.Context, chrt *chart.Chart, helmConfig *action.Configuration, namespace string) error {
+func installNew(ctx context.Context, chrt *chart.Chart, helmConfig *action.Configuration, namespace string, values map[string]interface{}) error {
 	dlog.Infof(ctx, "No existing Traffic Manager found in namespace %s, installing %s...", namespace, client.Version())
 	install := action.NewInstall(helmConfig)
 	install.ReleaseName = releaseName
@@ -112,19 +129,20 @@ func installNew(ctx context.Context, chrt *chart.Chart, helmConfig *action.Confi
 	install.CreateNamespace = true
 	return timedRun(ctx, func(timeout time.Duration) error {
 		install.Timeout = timeout
-		_, err := install.Run(chrt, getValues(ctx))
+		_, err := install.Run(chrt, values)
 		return err
 	})
 }
 
-func upgradeExisting(ctx context.Context, existingVer string, chrt *chart.Chart, helmConfig *action.Configuration, namespace string) error {
+func upgradeExisting(ctx context.Context, existingVer string, chrt *chart.Chart, helmConfig *action.Configuration, namespace string, req *Request, values map[string]interface{}) error {
 	dlog.Infof(ctx, "Existing Traffic Manager %s found in namespace %s, upgrading to %s...", existingVer, namespace, client.Version())
 	upgrade := action.NewUpgrade(helmConfig)
 	upgrade.Atomic = true
 	upgrade.Namespace = namespace
+	upgrade.ReuseValues = req.ReuseValues
 	return timedRun(ctx, func(timeout time.Duration) error {
 		upgrade.Timeout = timeout
-		_, err := upgrade.Run(releaseName, chrt, getValues(ctx))
+		_, err := upgrade.Run(releaseName, chrt, values)
 		return err
 	})
 }
@@ -139,65 +157,143 @@ func uninstallExisting(ctx context.Context, helmConfig *action.Configuration, na
 	})
 }
 
-// EnsureTrafficManager ensures the traffic manager is installed
-func EnsureTrafficManager(ctx context.Context, configFlags *genericclioptions.ConfigFlags, namespace string) error {
-	helmConfig, err := getHelmConfig(ctx, configFlags, namespace)
+// Request contains the values that are given to the traffic-manager chart in addition to the values that
+// are derived from the client configuration.
+type Request struct {
+	// ValuesFiles are YAML files with values, like the --values flag of helm
+	ValuesFiles []string
+
+	// Values are key=value pairs, like the --set flag of helm
+	Values []string
+
+	// ValuesJSON is a JSON object with values, such as the one produced by UserValues. The ValuesFiles and
+	// Values take precedence over it.
+	ValuesJSON []byte
+
+	// ReuseValues makes an upgrade merge the given values with the values of the existing release
+	ReuseValues bool
+}
+
+// UserValues returns the values that the request specifies.
+func (r *Request) UserValues() (map[string]interface{}, error) {
+	opts := values.Options{ValueFiles: r.ValuesFiles, Values: r.Values}
+	vals, err := opts.MergeValues(getter.Providers{})
 	if err != nil {
-		return fmt.Errorf("failed to initialize helm config: %w", err)
+		return nil, errcat.User.New(err)
 	}
-	existing, err := getHelmRelease(ctx, helmConfig)
+	if len(r.ValuesJSON) > 0 {
+		var jsonVals map[string]interface{}
+		if err = json.Unmarshal(r.ValuesJSON, &jsonVals); err != nil {
+			return nil, errcat.User.Newf("invalid values JSON: %w", err)
+		}
+		vals = chartutil.CoalesceTables(vals, jsonVals)
+	}
+	return vals, nil
+}
+
+// values returns the values that the request specifies, merged with the values that are derived from the client
+// configuration. The values of the request take precedence.
+func (r *Request) values(ctx context.Context) (map[string]interface{}, error) {
+	vals, err := r.UserValues()
 	if err != nil {
-		// If we weren't able to get the helm release at all, there's no hope for installing it
-		// This could have happened because the user doesn't have the requisite permissions, or because there was some
-		// kind of issue communicating with kubernetes. Let's hope it's the former and let's hope the traffic manager
-		// is already set up. If it's the latter case (or the traffic manager isn't there), we'll be alerted by
-		// a subsequent error anyway.
-		dlog.Errorf(ctx, "Unable to look for existing helm release: %v. Assuming it's there and continuing...", err)
-		return nil
+		return nil, err
 	}
+	return chartutil.CoalesceTables(vals, getValues(ctx)), nil
+}
 
-	chrt, err := loadChart()
+// existingRelease returns the traffic-manager release in the given namespace, or nil if there is none. A release
+// that was left behind by a failed install or uninstall is removed when it's owned by the cli.
+func existingRelease(ctx context.Context, helmConfig *action.Configuration, namespace string) (*release.Release, error) {
+	existing, err := getHelmRelease(ctx, helmConfig)
 	if err != nil {
-		return fmt.Errorf("unable to load built-in helm chart: %w", err)
+		return nil, fmt.Errorf("unable to look for existing helm release: %w", err)
 	}
 	// Under various conditions, helm can leave the release history hanging around after the release is gone.
 	// In those cases, an uninstall should clean everything up and leave us ready to install again
 	if existing != nil && shouldManageRelease(ctx, existing) && releaseNeedsCleanup(ctx, existing) {
-		err := uninstallExisting(ctx, helmConfig, namespace)
-		if err != nil {
-			return fmt.Errorf("failed to clean up leftover release history: %w", err)
+		if err = uninstallExisting(ctx, helmConfig, namespace); err != nil {
+			return nil, fmt.Errorf("failed to clean up leftover release history: %w", err)
 		}
 		existing = nil
 	}
+	return existing, nil
+}
+
+// InstallTrafficManager installs the traffic-manager chart that is embedded in the client in the given namespace.
+// Resources created by a legacy, non-helm, install are adopted by the new release. An error is returned when a
+// traffic-manager release already exists.
+func InstallTrafficManager(ctx context.Context, configFlags genericclioptions.RESTClientGetter, namespace string, req *Request) error {
+	helmConfig, err := getHelmConfig(ctx, configFlags, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to initialize helm config: %w", err)
+	}
+	existing, err := existingRelease(ctx, helmConfig, namespace)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return errcat.User.Newf(
+			`traffic-manager %s is already installed in namespace %s, use "telepresence helm upgrade" to change it`,
+			releaseVer(existing), namespace)
+	}
+	vals, err := req.values(ctx)
+	if err != nil {
+		return err
+	}
+	chrt, err := loadChart()
+	if err != nil {
+		return fmt.Errorf("unable to load built-in helm chart: %w", err)
+	}
+	if err = importLegacy(ctx, namespace); err != nil {
+		return fmt.Errorf("unable to import existing k8s resources: %w", err)
+	}
+	return installNew(ctx, chrt, helmConfig, namespace, vals)
+}
+
+// UpgradeTrafficManager upgrades the traffic-manager release in the given namespace to the chart that is embedded
+// in the client. An error is returned when no traffic-manager release exists.
+func UpgradeTrafficManager(ctx context.Context, configFlags genericclioptions.RESTClientGetter, namespace string, req *Request) error {
+	helmConfig, err := getHelmConfig(ctx, configFlags, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to initialize helm config: %w", err)
+	}
+	existing, err := existingRelease(ctx, helmConfig, namespace)
+	if err != nil {
+		return err
+	}
 	if existing == nil {
-		err := importLegacy(ctx, namespace)
-		if err != nil {
-			// Similarly to the error check for getHelmRelease, this could happen because of missing permissions,
-			// or a different k8s error. We don't want to block on permissions failures, so let's log and hope.
-			dlog.Errorf(ctx, "Unable to import existing k8s resources: %v. Assuming traffic-manager is setup and continuing...", err)
-			return nil
-		}
+		return errcat.User.Newf(`no traffic-manager found in namespace %s, use "telepresence helm install" to install one`, namespace)
+	}
+	vals, err := req.values(ctx)
+	if err != nil {
+		return err
+	}
+	chrt, err := loadChart()
+	if err != nil {
+		return fmt.Errorf("unable to load built-in helm chart: %w", err)
+	}
+	return upgradeExisting(ctx, releaseVer(existing), chrt, helmConfig, namespace, req, vals)
+}
 
-		err = installNew(ctx, chrt, helmConfig, namespace)
-		if err != nil {
-			return err
-		}
-		return nil
+// UninstallTrafficManager uninstalls the traffic-manager release in the given namespace, regardless of who
+// installed it. An error is returned when no traffic-manager release exists.
+func UninstallTrafficManager(ctx context.Context, configFlags genericclioptions.RESTClientGetter, namespace string) error {
+	helmConfig, err := getHelmConfig(ctx, configFlags, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to initialize helm config: %w", err)
 	}
-	ver := releaseVer(existing)
-	if shouldManageRelease(ctx, existing) && shouldUpgradeRelease(ctx, existing) {
-		err = upgradeExisting(ctx, ver, chrt, helmConfig, namespace)
-		if err != nil {
-			return err
-		}
-		return nil
+	existing, err := getHelmRelease(ctx, helmConfig)
+	if err != nil {
+		return fmt.Errorf("unable to look for existing helm release: %w", err)
 	}
-	dlog.Infof(ctx, "Existing Traffic Manager %s not owned by cli or does not need upgrade, will not modify", ver)
-	return nil
+	if existing == nil {
+		return errcat.User.Newf("no traffic-manager found in namespace %s", namespace)
+	}
+	return uninstallExisting(ctx, helmConfig, namespace)
 }
 
 // DeleteTrafficManager deletes the traffic manager
-func DeleteTrafficManager(ctx context.Context, configFlags *genericclioptions.ConfigFlags, namespace string) error {
+func DeleteTrafficManager(ctx context.Context, configFlags genericclioptions.RESTClientGetter, namespace string) error {
 	helmConfig, err := getHelmConfig(ctx, configFlags, namespace)
 	if err != nil {
 		return fmt.Errorf("failed to initialize helm config: %w", err)
@@ -213,3 +309,20 @@ func DeleteTrafficManager(ctx context.Context, configFlags *genericclioptions.Co
 	}
 	return uninstallExisting(ctx, helmConfig, namespace)
 }
+
+// TrafficManagerResources returns a description of each resource that DeleteTrafficManager would remove. The
+// result is empty when no traffic-manager that is owned by the cli is installed in the given namespace.
+func TrafficManagerResources(ctx context.Context, configFlags genericclioptions.RESTClientGetter, namespace string) ([]string, error) {
+	helmConfig, err := getHelmConfig(ctx, configFlags, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize helm config: %w", err)
+	}
+	existing, err := getHelmRelease(ctx, helmConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look for existing helm release: %w", err)
+	}
+	if existing == nil || !shouldManageRelease(ctx, existing) {
+		return nil, nil
+	}
+	return releaseResources(existing)
+}
@@ -0,0 +1,58 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+)
+
+func TestRequestValues(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	env, err := client.LoadEnv(ctx)
+	require.NoError(t, err)
+	ctx = client.WithEnv(ctx, env)
+	cfg := client.GetDefaultConfig(ctx)
+	ctx = client.WithConfig(ctx, &cfg)
+
+	valuesFile := filepath.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFile, []byte("image:\n  registry: example.com/tel\nlogLevel: debug\n"), 0o600))
+
+	req := &Request{
+		ValuesFiles: []string{valuesFile},
+		Values:      []string{"logLevel=trace", "agentInjector.enabled=false"},
+	}
+	vals, err := req.values(ctx)
+	require.NoError(t, err)
+
+	// Values from the request override those derived from the config, which fill in the rest
+	image := vals["image"].(map[string]interface{})
+	assert.Equal(t, "example.com/tel", image["registry"])
+	assert.NotEmpty(t, image["tag"])
+	assert.Equal(t, "trace", vals["logLevel"])
+	assert.Equal(t, false, vals["agentInjector"].(map[string]interface{})["enabled"])
+	assert.Equal(t, releaseOwner, vals["createdBy"])
+
+	req = &Request{Values: []string{"no-equals-sign"}}
+	_, err = req.values(ctx)
+	assert.Error(t, err)
+}
+
+func TestRequestValuesJSON(t *testing.T) {
+	req := &Request{
+		ValuesJSON: []byte(`{"image":{"tag":"2.4.0","registry":"example.com"}}`),
+		Values:     []string{"image.tag=2.5.0"},
+	}
+	vals, err := req.UserValues()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"tag": "2.5.0", "registry": "example.com"}, vals["image"])
+
+	req = &Request{ValuesJSON: []byte(`not json`)}
+	_, err = req.UserValues()
+	assert.Error(t, err)
+}
@@ -139,7 +139,7 @@ func amendObject(obj *meta.ObjectMeta, kind, namespace string) error {
 		annotations = map[string]string{}
 	}
 	// Prevent us from taking over an existing release
-	// This is really done out of an abundance of caution, as EnsureTrafficManager should validate that there is no existing
+	// This is really done out of an abundance of caution, as InstallTrafficManager should validate that there is no existing
 	// release before calling importLegacy
 	if release, ok := annotations["meta.helm.sh/release-name"]; ok && release != releaseName {
 		return fmt.Errorf("refusing to replace existing release annotation %s in %s %s.%s", release, kind, obj.GetName(), obj.GetNamespace())
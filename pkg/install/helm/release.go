@@ -2,14 +2,16 @@ package helm
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"strings"
 
-	"github.com/blang/semver"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
 
 	"github.com/datawire/dlib/dlog"
-	"github.com/telepresenceio/telepresence/v2/pkg/client"
 )
 
 // getHelmRelease gets the traffic-manager helm release; if it is not found, it will return nil
@@ -47,23 +49,34 @@ func releaseNeedsCleanup(ctx context.Context, rel *release.Release) bool {
 	return rel.Info.Status != release.StatusDeployed
 }
 
-func shouldUpgradeRelease(ctx context.Context, rel *release.Release) bool {
-	ver := releaseVer(rel)
-	chartVersion, err := semver.Parse(ver)
-	if err != nil {
-		dlog.Errorf(ctx, "Could not parse version %s for chart: %v", ver, err)
-		return false
-	}
-	cliVersion := client.Semver()
-	if chartVersion.GT(cliVersion) {
-		dlog.Warnf(ctx, "You are using Telepresence %s, but Traffic Manager %s is installed on the cluster.", cliVersion, ver)
-		return false
-	}
-	// At this point we could also do chartVersion != cliVersion, since chartVersion <= cliVersion
-	// But this makes it really clear that we're only doing the upgrade if chartVersion < cliVersion
-	return chartVersion.LT(cliVersion)
-}
-
 func releaseVer(rel *release.Release) string {
 	return strings.TrimPrefix(rel.Chart.Metadata.Version, "v")
 }
+
+// releaseResources returns a sorted list of "<kind> <name>[.<namespace>]" descriptions of the resources in the
+// manifest of the given release.
+func releaseResources(rel *release.Release) ([]string, error) {
+	var resources []string
+	for _, manifest := range releaseutil.SplitManifests(rel.Manifest) {
+		var head struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(manifest), &head); err != nil {
+			return nil, fmt.Errorf("unable to parse manifest of release %s: %w", rel.Name, err)
+		}
+		if head.Kind == "" {
+			continue
+		}
+		resource := head.Kind + " " + head.Metadata.Name
+		if head.Metadata.Namespace != "" {
+			resource += "." + head.Metadata.Namespace
+		}
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return resources, nil
+}
@@ -0,0 +1,37 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestReleaseResources(t *testing.T) {
+	rel := &release.Release{
+		Name: releaseName,
+		Manifest: `---
+# Source: telepresence/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: traffic-manager
+  namespace: ambassador
+---
+# Source: telepresence/templates/agentInjectorWebhook.yaml
+apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: agent-injector-webhook-ambassador
+---
+# Source: telepresence/templates/empty.yaml
+`,
+	}
+	resources, err := releaseResources(rel)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"MutatingWebhookConfiguration agent-injector-webhook-ambassador",
+		"Service traffic-manager.ambassador",
+	}, resources)
+}
@@ -0,0 +1,141 @@
+package install
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// MTLSCA is the certificate authority that the traffic-manager and its clients use to authenticate
+// each other on the ManagerPortMTLS. Its certificate and key are stored in the ManagerMTLSSecretName
+// secret, which only the traffic-manager reads. Clients obtain their certificates by sending a
+// certificate request to the ManagerPortMTLSBootstrap.
+type MTLSCA struct {
+	Cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// ParseMTLSCA parses the PEM encoded certificate and private key of a certificate authority. The key
+// may be a PKCS #1, PKCS #8, or SEC 1 encoded RSA or ECDSA key.
+func ParseMTLSCA(certPem, keyPem []byte) (*MTLSCA, error) {
+	block, _ := pem.Decode(certPem)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM encoded CA certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("certificate %q is not a CA certificate", cert.Subject.CommonName)
+	}
+	if block, _ = pem.Decode(keyPem); block == nil {
+		return nil, errors.New("no PEM encoded CA private key found")
+	}
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA private key type %T", key)
+	}
+	return &MTLSCA{Cert: cert, key: signer}, nil
+}
+
+// CertPool returns a pool that contains the certificate of this CA.
+func (ca *MTLSCA) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	return pool
+}
+
+// IssueCertificate creates a new key pair and returns a certificate for it that is signed by this CA. The
+// certificate is valid for the given duration, or until the CA certificate expires, whichever comes first.
+func (ca *MTLSCA) IssueCertificate(commonName string, dnsNames []string, usage x509.ExtKeyUsage, validFor time.Duration) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate private key: %w", err)
+	}
+	der, err := ca.sign(commonName, dnsNames, usage, validFor, &key.PublicKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// SignClientCertificateRequest verifies the PEM encoded PKCS #10 certificate request and returns a PEM
+// encoded client certificate for its public key. Only the common name of the request is used. The
+// certificate is valid for the given duration, or until the CA certificate expires, whichever comes first.
+func (ca *MTLSCA) SignClientCertificateRequest(csrPem []byte, validFor time.Duration) ([]byte, error) {
+	block, _ := pem.Decode(csrPem)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("no PEM encoded certificate request found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate request: %w", err)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+	der, err := ca.sign(csr.Subject.CommonName, nil, x509.ExtKeyUsageClientAuth, validFor, csr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+func (ca *MTLSCA) sign(commonName string, dnsNames []string, usage x509.ExtKeyUsage, validFor time.Duration, pub interface{}) ([]byte, error) {
+	serial, err := cryptorand.Int(cryptorand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	now := time.Now()
+	notAfter := now.Add(validFor)
+	if notAfter.After(ca.Cert.NotAfter) {
+		notAfter = ca.Cert.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{"getambassador.io"},
+		},
+		DNSNames:    dnsNames,
+		NotBefore:   now.Add(-5 * time.Minute), // allow for some clock skew
+		NotAfter:    notAfter,
+		ExtKeyUsage: []x509.ExtKeyUsage{usage},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, tmpl, ca.Cert, pub, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign the certificate for %q: %w", commonName, err)
+	}
+	return der, nil
+}
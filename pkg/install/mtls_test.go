@@ -0,0 +1,145 @@
+package install
+
+import (
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCA creates a CA in the same format as the genCA function of the Helm chart.
+func newTestCA(t *testing.T) (certPem, keyPem []byte) {
+	key, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "traffic-manager-mtls-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(48 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	certPem, err = ToPEM("ca.pem", "CERTIFICATE", der)
+	require.NoError(t, err)
+	keyPem, err = ToPEM("ca-key.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	require.NoError(t, err)
+	return certPem, keyPem
+}
+
+func TestParseMTLSCA(t *testing.T) {
+	certPem, keyPem := newTestCA(t)
+	_, err := ParseMTLSCA(certPem, keyPem)
+	require.NoError(t, err)
+
+	_, err = ParseMTLSCA(keyPem, keyPem)
+	assert.Error(t, err)
+	_, err = ParseMTLSCA(certPem, certPem)
+	assert.Error(t, err)
+	_, err = ParseMTLSCA(certPem, nil)
+	assert.Error(t, err)
+}
+
+func TestMTLSCA_IssueCertificate(t *testing.T) {
+	certPem, keyPem := newTestCA(t)
+	ca, err := ParseMTLSCA(certPem, keyPem)
+	require.NoError(t, err)
+
+	serverCert, err := ca.IssueCertificate("traffic-manager.ambassador", []string{"traffic-manager.ambassador"}, x509.ExtKeyUsageServerAuth, time.Hour)
+	require.NoError(t, err)
+
+	// The validity is capped by the validity of the CA
+	longCert, err := ca.IssueCertificate("jane@host", nil, x509.ExtKeyUsageClientAuth, 365*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, ca.Cert.NotAfter, longCert.Leaf.NotAfter)
+
+	handshake := func(clientCerts []tls.Certificate) error {
+		l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    ca.CertPool(),
+		})
+		require.NoError(t, err)
+		defer l.Close()
+		go func() {
+			if conn, err := l.Accept(); err == nil {
+				_, _ = io.WriteString(conn, "hello")
+				conn.Close()
+			}
+		}()
+		conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{
+			RootCAs:      ca.CertPool(),
+			ServerName:   "traffic-manager.ambassador",
+			Certificates: clientCerts,
+		})
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// With TLS 1.3, the server verifies the client certificate after the client has completed
+		// the handshake, so the rejection shows up when reading.
+		_, err = io.ReadAll(conn)
+		return err
+	}
+
+	clientCert, err := ca.IssueCertificate("jane@host", nil, x509.ExtKeyUsageClientAuth, time.Hour)
+	require.NoError(t, err)
+	assert.NoError(t, handshake([]tls.Certificate{clientCert}))
+	assert.Error(t, handshake(nil))
+
+	otherCertPem, otherKeyPem := newTestCA(t)
+	otherCA, err := ParseMTLSCA(otherCertPem, otherKeyPem)
+	require.NoError(t, err)
+	otherCert, err := otherCA.IssueCertificate("jane@host", nil, x509.ExtKeyUsageClientAuth, time.Hour)
+	require.NoError(t, err)
+	assert.Error(t, handshake([]tls.Certificate{otherCert}))
+}
+
+func TestMTLSCA_SignClientCertificateRequest(t *testing.T) {
+	certPem, keyPem := newTestCA(t)
+	ca, err := ParseMTLSCA(certPem, keyPem)
+	require.NoError(t, err)
+
+	key, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	require.NoError(t, err)
+	csrDer, err := x509.CreateCertificateRequest(cryptorand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "jane@host"},
+		DNSNames: []string{"traffic-manager.ambassador"},
+	}, key)
+	require.NoError(t, err)
+	csrPem, err := ToPEM("csr.pem", "CERTIFICATE REQUEST", csrDer)
+	require.NoError(t, err)
+
+	certPem, err = ca.SignClientCertificateRequest(csrPem, time.Hour)
+	require.NoError(t, err)
+	block, _ := pem.Decode(certPem)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	assert.NoError(t, cert.CheckSignatureFrom(ca.Cert))
+	assert.Equal(t, "jane@host", cert.Subject.CommonName)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, cert.ExtKeyUsage)
+	assert.Empty(t, cert.DNSNames, "names requested in the CSR must not be signed")
+	assert.Equal(t, &key.PublicKey, cert.PublicKey)
+
+	_, err = ca.SignClientCertificateRequest(certPem, time.Hour)
+	assert.Error(t, err)
+
+	// A request that isn't signed by the key that it contains is rejected
+	csrDer[len(csrDer)-1] ^= 0xff
+	badPem, err := ToPEM("csr.pem", "CERTIFICATE REQUEST", csrDer)
+	require.NoError(t, err)
+	_, err = ca.SignClientCertificateRequest(badPem, time.Hour)
+	assert.Error(t, err)
+}
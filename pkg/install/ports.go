@@ -0,0 +1,78 @@
+package install
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+)
+
+// DefaultAgentPort is the port that the traffic-agent listens to unless that port is used by another
+// container in the pod.
+const DefaultAgentPort = 9900
+
+// ResolvePortConflicts ensures that none of the given ports collide with a port or host port declared by a
+// container in the given pod spec, with a reserved port, or with each other. A port that collides is replaced
+// with the closest higher port that is free. Ports that are zero are ignored.
+//
+// The returned map contains an entry from the original port to its replacement for each port that was replaced,
+// and is empty when no collisions were found.
+func ResolvePortConflicts(spec *core.PodSpec, reserved []int32, ports ...*int32) map[int32]int32 {
+	used := make(map[int32]struct{})
+	for i := range spec.Containers {
+		cn := &spec.Containers[i]
+		if cn.Name == AgentContainerName {
+			continue
+		}
+		for _, p := range cn.Ports {
+			used[p.ContainerPort] = struct{}{}
+			if p.HostPort != 0 {
+				used[p.HostPort] = struct{}{}
+			}
+		}
+	}
+	for _, p := range reserved {
+		used[p] = struct{}{}
+	}
+
+	remapped := make(map[int32]int32)
+	for _, pp := range ports {
+		p := *pp
+		if p == 0 {
+			continue
+		}
+		for {
+			if _, ok := used[p]; !ok {
+				break
+			}
+			p++
+		}
+		used[p] = struct{}{}
+		if p != *pp {
+			remapped[*pp] = p
+			*pp = p
+		}
+	}
+	return remapped
+}
+
+// PortMappingString returns the given port mapping, as returned from ResolvePortConflicts, in the
+// form "9900=9901,9980=9981", sorted on the original port.
+func PortMappingString(m map[int32]int32) string {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+	sb := strings.Builder{}
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.Itoa(k))
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Itoa(int(m[int32(k)])))
+	}
+	return sb.String()
+}
@@ -0,0 +1,43 @@
+package install
+
+import "fmt"
+
+// RedirectMode specifies how traffic for the intercepted port is redirected to an injected traffic-agent.
+type RedirectMode int
+
+var redirectModeNames = [...]string{"ports", "iptables"}
+
+const (
+	// RedirectPorts means that a named target port is moved from the app container to the agent
+	// container, and that an init container with iptables redirection is used only for numeric target
+	// ports (this is the default behavior).
+	RedirectPorts RedirectMode = iota
+
+	// RedirectIPTables means that an init container sets up iptables redirection to the agent for all
+	// target ports, so that the port definitions of the app container are never modified.
+	RedirectIPTables
+)
+
+func (rm RedirectMode) String() string {
+	return redirectModeNames[rm]
+}
+
+func NewRedirectMode(s string) (RedirectMode, error) {
+	for i, n := range redirectModeNames {
+		if s == n {
+			return RedirectMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid RedirectMode: %q", s)
+}
+
+func (rm *RedirectMode) EnvDecode(val string) (err error) {
+	var m RedirectMode
+	if val == "" {
+		m = RedirectPorts
+	} else if m, err = NewRedirectMode(val); err != nil {
+		return err
+	}
+	*rm = m
+	return nil
+}
@@ -0,0 +1,54 @@
+package install
+
+import (
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// AgentResources returns the resource requirements of the traffic-agent containers. The given defaults are
+// overridden by the AgentCPURequestAnnotation, AgentCPULimitAnnotation, AgentMemRequestAnnotation, and
+// AgentMemLimitAnnotation annotations, when present.
+func AgentResources(defaults core.ResourceRequirements, annotations map[string]string) (core.ResourceRequirements, error) {
+	rr := core.ResourceRequirements{
+		Limits:   copyResourceList(defaults.Limits),
+		Requests: copyResourceList(defaults.Requests),
+	}
+	overrides := []struct {
+		annotation string
+		name       core.ResourceName
+		list       *core.ResourceList
+	}{
+		{AgentCPURequestAnnotation, core.ResourceCPU, &rr.Requests},
+		{AgentCPULimitAnnotation, core.ResourceCPU, &rr.Limits},
+		{AgentMemRequestAnnotation, core.ResourceMemory, &rr.Requests},
+		{AgentMemLimitAnnotation, core.ResourceMemory, &rr.Limits},
+	}
+	for _, o := range overrides {
+		v, ok := annotations[o.annotation]
+		if !ok {
+			continue
+		}
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return rr, fmt.Errorf("invalid value %q of annotation %s: %w", v, o.annotation, err)
+		}
+		if *o.list == nil {
+			*o.list = make(core.ResourceList)
+		}
+		(*o.list)[o.name] = q
+	}
+	return rr, nil
+}
+
+func copyResourceList(rl core.ResourceList) core.ResourceList {
+	if rl == nil {
+		return nil
+	}
+	cp := make(core.ResourceList, len(rl))
+	for k, v := range rl {
+		cp[k] = v.DeepCopy()
+	}
+	return cp
+}
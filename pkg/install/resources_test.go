@@ -0,0 +1,42 @@
+package install
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestAgentResources(t *testing.T) {
+	defaults := core.ResourceRequirements{
+		Limits: core.ResourceList{
+			core.ResourceCPU:    resource.MustParse("100m"),
+			core.ResourceMemory: resource.MustParse("128Mi"),
+		},
+	}
+
+	rr, err := AgentResources(defaults, nil)
+	require.NoError(t, err)
+	assert.Equal(t, defaults, rr)
+
+	rr, err = AgentResources(defaults, map[string]string{
+		AgentCPULimitAnnotation:   "200m",
+		AgentMemRequestAnnotation: "64Mi",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, core.ResourceRequirements{
+		Limits: core.ResourceList{
+			core.ResourceCPU:    resource.MustParse("200m"),
+			core.ResourceMemory: resource.MustParse("128Mi"),
+		},
+		Requests: core.ResourceList{
+			core.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}, rr)
+	assert.Equal(t, resource.MustParse("100m"), defaults.Limits[core.ResourceCPU], "defaults must not be modified")
+
+	_, err = AgentResources(defaults, map[string]string{AgentMemLimitAnnotation: "lots"})
+	assert.Error(t, err)
+}
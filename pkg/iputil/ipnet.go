@@ -2,8 +2,11 @@ package iputil
 
 import (
 	"encoding/json"
+	"fmt"
 	"net"
 
+	"gopkg.in/yaml.v3"
+
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 )
 
@@ -24,6 +27,10 @@ func IPNetFromRPC(r *manager.IPNet) *net.IPNet {
 
 type Subnet net.IPNet
 
+func (s *Subnet) String() string {
+	return (*net.IPNet)(s).String()
+}
+
 func (s *Subnet) MarshalJSON() ([]byte, error) {
 	return json.Marshal((*net.IPNet)(s).String())
 }
@@ -40,3 +47,20 @@ func (s *Subnet) UnmarshalJSON(data []byte) error {
 	*s = *(*Subnet)(ipNet)
 	return nil
 }
+
+func (s Subnet) MarshalYAML() (interface{}, error) {
+	return (*net.IPNet)(&s).String(), nil
+}
+
+func (s *Subnet) UnmarshalYAML(node *yaml.Node) error {
+	var str string
+	if err := node.Decode(&str); err != nil {
+		return err
+	}
+	_, ipNet, err := net.ParseCIDR(str)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*s = *(*Subnet)(ipNet)
+	return nil
+}
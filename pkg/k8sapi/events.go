@@ -0,0 +1,47 @@
+package k8sapi
+
+import (
+	"context"
+	"os"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RecordWorkloadEvent records a Kubernetes Event of the given type and reason on the given workload, so that
+// it is shown by "kubectl describe" and seen by tools that watch Events. The component is the source of the
+// Event, e.g. "traffic-manager".
+func RecordWorkloadEvent(c context.Context, wl Object, component, eventType, reason, message string) error {
+	apiVersion := apps.SchemeGroupVersion.String()
+	if _, ok := RolloutImpl(wl); ok {
+		apiVersion = RolloutGroupVersion.String()
+	}
+	now := meta.Now()
+	host, _ := os.Hostname()
+	ev := &core.Event{
+		ObjectMeta: meta.ObjectMeta{
+			GenerateName: wl.GetName() + ".",
+			Namespace:    wl.GetNamespace(),
+		},
+		InvolvedObject: core.ObjectReference{
+			APIVersion:      apiVersion,
+			Kind:            wl.GetKind(),
+			Name:            wl.GetName(),
+			Namespace:       wl.GetNamespace(),
+			UID:             wl.GetUID(),
+			ResourceVersion: wl.GetResourceVersion(),
+		},
+		Reason:              reason,
+		Message:             message,
+		Type:                eventType,
+		Source:              core.EventSource{Component: component},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: "telepresence.io/" + component,
+		ReportingInstance:   host,
+	}
+	_, err := GetK8sInterface(c).CoreV1().Events(ev.Namespace).Create(c, ev, meta.CreateOptions{})
+	return err
+}
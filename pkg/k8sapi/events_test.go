@@ -0,0 +1,47 @@
+package k8sapi
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecordWorkloadEvent(t *testing.T) {
+	u := &unstructured.Unstructured{}
+	require.NoError(t, json.Unmarshal([]byte(rolloutJSON), &u.Object))
+
+	tests := []struct {
+		name       string
+		wl         Workload
+		apiVersion string
+	}{
+		{"deployment", Deployment(&apps.Deployment{ObjectMeta: meta.ObjectMeta{Name: "echo", Namespace: "default", UID: "echo-uid"}}), "apps/v1"},
+		{"rollout", Rollout(u), "argoproj.io/v1alpha1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ki := fake.NewSimpleClientset()
+			ctx := WithK8sInterface(context.Background(), ki)
+			require.NoError(t, RecordWorkloadEvent(ctx, tt.wl, "telepresence", core.EventTypeNormal, "PodsRestarted", "restarted"))
+
+			evs, err := ki.CoreV1().Events("default").List(ctx, meta.ListOptions{})
+			require.NoError(t, err)
+			require.Len(t, evs.Items, 1)
+			ev := evs.Items[0]
+			assert.Equal(t, tt.apiVersion, ev.InvolvedObject.APIVersion)
+			assert.Equal(t, tt.wl.GetKind(), ev.InvolvedObject.Kind)
+			assert.Equal(t, "echo", ev.InvolvedObject.Name)
+			assert.Equal(t, "PodsRestarted", ev.Reason)
+			assert.Equal(t, "telepresence", ev.Source.Component)
+			assert.Equal(t, "telepresence.io/telepresence", ev.ReportingController)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package k8sapi
+
+import (
+	"context"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	typedBatch "k8s.io/client-go/kubernetes/typed/batch/v1"
+)
+
+func GetJob(c context.Context, name, namespace string) (Workload, error) {
+	d, err := jobs(c, namespace).Get(c, name, meta.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &job{d}, nil
+}
+
+// Jobs returns all jobs found in the given Namespace
+func Jobs(c context.Context, namespace string, labelSelector labels.Set) ([]Workload, error) {
+	ls, err := jobs(c, namespace).List(c, listOptions(labelSelector))
+	if err != nil {
+		return nil, err
+	}
+	is := ls.Items
+	os := make([]Workload, len(is))
+	for i := range is {
+		os[i] = Job(&is[i])
+	}
+	return os, nil
+}
+
+func Job(d *batch.Job) Workload {
+	return &job{d}
+}
+
+// JobImpl casts the given Object as an *batch.Job and returns
+// it together with a status flag indicating whether the cast was possible
+func JobImpl(o Object) (*batch.Job, bool) {
+	if s, ok := o.(*job); ok {
+		return s.Job, true
+	}
+	return nil, false
+}
+
+// GetCronJob returns the CronJob with the given name and namespace. The batch/v1 API is used, so a
+// NotFound error is returned when the cluster is older than Kubernetes 1.21.
+func GetCronJob(c context.Context, name, namespace string) (Workload, error) {
+	d, err := cronJobs(c, namespace).Get(c, name, meta.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &cronJob{d}, nil
+}
+
+// CronJobs returns all cron jobs found in the given Namespace
+func CronJobs(c context.Context, namespace string, labelSelector labels.Set) ([]Workload, error) {
+	ls, err := cronJobs(c, namespace).List(c, listOptions(labelSelector))
+	if err != nil {
+		return nil, err
+	}
+	is := ls.Items
+	os := make([]Workload, len(is))
+	for i := range is {
+		os[i] = CronJob(&is[i])
+	}
+	return os, nil
+}
+
+func CronJob(d *batch.CronJob) Workload {
+	return &cronJob{d}
+}
+
+// CronJobImpl casts the given Object as an *batch.CronJob and returns
+// it together with a status flag indicating whether the cast was possible
+func CronJobImpl(o Object) (*batch.CronJob, bool) {
+	if s, ok := o.(*cronJob); ok {
+		return s.CronJob, true
+	}
+	return nil, false
+}
+
+// IsJobKind returns true if pods of the given workload kind run to completion, i.e. if they are
+// created by a Job.
+func IsJobKind(kind string) bool {
+	return kind == "Job" || kind == "CronJob"
+}
+
+// IsJobPod returns true if a pod with the given owner references is controlled by a Job.
+func IsJobPod(owners []meta.OwnerReference) bool {
+	for _, owner := range owners {
+		if owner.Controller != nil && *owner.Controller && owner.Kind == "Job" {
+			return true
+		}
+	}
+	return false
+}
+
+// PodTemplatePath returns the path of the pod template in the spec of the given workload kind. The
+// template of a CronJob is nested in its job template.
+func PodTemplatePath(kind string) []string {
+	if kind == "CronJob" {
+		return []string{"spec", "jobTemplate", "spec", "template"}
+	}
+	return []string{"spec", "template"}
+}
+
+type job struct {
+	*batch.Job
+}
+
+func jobs(c context.Context, namespace string) typedBatch.JobInterface {
+	return GetK8sInterface(c).BatchV1().Jobs(namespace)
+}
+
+func (o *job) ki(c context.Context) typedBatch.JobInterface {
+	return jobs(c, o.Namespace)
+}
+
+func (o *job) GetKind() string {
+	return "Job"
+}
+
+func (o *job) Delete(c context.Context) error {
+	return o.ki(c).Delete(c, o.Name, meta.DeleteOptions{})
+}
+
+func (o *job) GetPodTemplate() *core.PodTemplateSpec {
+	return &o.Spec.Template
+}
+
+func (o *job) Patch(c context.Context, pt types.PatchType, data []byte, subresources ...string) error {
+	d, err := o.ki(c).Patch(c, o.Name, pt, data, meta.PatchOptions{}, subresources...)
+	if err == nil {
+		o.Job = d
+	}
+	return err
+}
+
+func (o *job) Refresh(c context.Context) error {
+	d, err := o.ki(c).Get(c, o.Name, meta.GetOptions{})
+	if err == nil {
+		o.Job = d
+	}
+	return err
+}
+
+func (o *job) Replicas() int {
+	return int(o.Status.Active)
+}
+
+func (o *job) Update(c context.Context) error {
+	d, err := o.ki(c).Update(c, o.Job, meta.UpdateOptions{})
+	if err == nil {
+		o.Job = d
+	}
+	return err
+}
+
+// Updated always returns true because the pod template of a Job is immutable, so there's never
+// a change to roll out.
+func (o *job) Updated(_ int64) bool {
+	return true
+}
+
+type cronJob struct {
+	*batch.CronJob
+}
+
+func cronJobs(c context.Context, namespace string) typedBatch.CronJobInterface {
+	return GetK8sInterface(c).BatchV1().CronJobs(namespace)
+}
+
+func (o *cronJob) ki(c context.Context) typedBatch.CronJobInterface {
+	return cronJobs(c, o.Namespace)
+}
+
+func (o *cronJob) GetKind() string {
+	return "CronJob"
+}
+
+func (o *cronJob) Delete(c context.Context) error {
+	return o.ki(c).Delete(c, o.Name, meta.DeleteOptions{})
+}
+
+func (o *cronJob) GetPodTemplate() *core.PodTemplateSpec {
+	return &o.Spec.JobTemplate.Spec.Template
+}
+
+func (o *cronJob) Patch(c context.Context, pt types.PatchType, data []byte, subresources ...string) error {
+	d, err := o.ki(c).Patch(c, o.Name, pt, data, meta.PatchOptions{}, subresources...)
+	if err == nil {
+		o.CronJob = d
+	}
+	return err
+}
+
+func (o *cronJob) Refresh(c context.Context) error {
+	d, err := o.ki(c).Get(c, o.Name, meta.GetOptions{})
+	if err == nil {
+		o.CronJob = d
+	}
+	return err
+}
+
+func (o *cronJob) Replicas() int {
+	return len(o.Status.Active)
+}
+
+func (o *cronJob) Update(c context.Context) error {
+	d, err := o.ki(c).Update(c, o.CronJob, meta.UpdateOptions{})
+	if err == nil {
+		o.CronJob = d
+	}
+	return err
+}
+
+// Updated returns true as soon as the given generation has been stored. A change of the job template
+// only affects the jobs that are created after the change, so there are no pods to wait for.
+func (o *cronJob) Updated(origGeneration int64) bool {
+	return o.ObjectMeta.Generation >= origGeneration
+}
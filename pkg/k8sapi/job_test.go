@@ -0,0 +1,58 @@
+package k8sapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetWorkload_jobs(t *testing.T) {
+	podTemplate := core.PodTemplateSpec{ObjectMeta: meta.ObjectMeta{Labels: map[string]string{"app": "report"}}}
+	ctx := WithK8sInterface(context.Background(), fake.NewSimpleClientset(
+		&batch.Job{
+			ObjectMeta: meta.ObjectMeta{Name: "migrate", Namespace: "default"},
+			Spec:       batch.JobSpec{Template: podTemplate},
+			Status:     batch.JobStatus{Active: 1},
+		},
+		&batch.CronJob{
+			ObjectMeta: meta.ObjectMeta{Name: "report", Namespace: "default", Generation: 2},
+			Spec: batch.CronJobSpec{JobTemplate: batch.JobTemplateSpec{
+				Spec: batch.JobSpec{Template: podTemplate},
+			}},
+		},
+	))
+
+	wl, err := GetWorkload(ctx, "migrate", "default", "")
+	require.NoError(t, err)
+	assert.Equal(t, "Job", wl.GetKind())
+	assert.Equal(t, 1, wl.Replicas())
+	assert.True(t, wl.Updated(5), "a job has nothing to roll out")
+
+	wl, err = GetWorkload(ctx, "report", "default", "")
+	require.NoError(t, err)
+	assert.Equal(t, "CronJob", wl.GetKind())
+	assert.Equal(t, "report", wl.GetPodTemplate().Labels["app"])
+	assert.Equal(t, 0, wl.Replicas())
+	assert.True(t, wl.Updated(2))
+	assert.False(t, wl.Updated(3))
+
+	cj, ok := CronJobImpl(wl)
+	require.True(t, ok)
+	wl, err = WrapWorkload(cj)
+	require.NoError(t, err)
+	assert.Equal(t, "CronJob", wl.GetKind())
+}
+
+func TestIsJobPod(t *testing.T) {
+	yes := true
+	assert.True(t, IsJobPod([]meta.OwnerReference{{Kind: "Job", Name: "migrate", Controller: &yes}}))
+	assert.False(t, IsJobPod([]meta.OwnerReference{{Kind: "Job", Name: "migrate"}}))
+	assert.False(t, IsJobPod([]meta.OwnerReference{{Kind: "ReplicaSet", Name: "echo-697464c6c5", Controller: &yes}}))
+	assert.False(t, IsJobPod(nil))
+}
@@ -0,0 +1,210 @@
+package k8sapi
+
+import (
+	"context"
+	"strconv"
+
+	core "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+// RolloutGroupVersion is the group and version of the Argo Rollouts API.
+var RolloutGroupVersion = schema.GroupVersion{Group: "argoproj.io", Version: "v1alpha1"}
+
+// GetRollout returns the Argo Rollout with the given name and namespace. A NotFound error is returned
+// when the Rollout doesn't exist or when Argo Rollouts isn't installed in the cluster.
+func GetRollout(c context.Context, name, namespace string) (Workload, error) {
+	r := &rollout{Unstructured: &unstructured.Unstructured{}}
+	r.SetName(name)
+	r.SetNamespace(namespace)
+	if err := r.Refresh(c); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Rollout wraps the given Argo Rollout as a Workload. The Rollout is kept in its unstructured form so that
+// an update retains the fields that telepresence doesn't know about, such as the rollout strategy.
+func Rollout(u *unstructured.Unstructured) Workload {
+	return &rollout{Unstructured: u}
+}
+
+// RolloutImpl casts the given Object as an *unstructured.Unstructured Argo Rollout and returns
+// it together with a status flag indicating whether the cast was possible.
+func RolloutImpl(o Object) (*unstructured.Unstructured, bool) {
+	if r, ok := o.(*rollout); ok {
+		return r.Unstructured, true
+	}
+	return nil, false
+}
+
+// IsRolloutOwner returns true if the given owner reference refers to an Argo Rollout.
+func IsRolloutOwner(apiVersion, kind string) bool {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	return err == nil && kind == "Rollout" && gv.Group == RolloutGroupVersion.Group
+}
+
+type rollout struct {
+	*unstructured.Unstructured
+
+	// template is the decoded spec.template of the Rollout. It is written back to the
+	// unstructured object before the Rollout is updated.
+	template *core.PodTemplateSpec
+}
+
+// rolloutsClient returns a REST client that can reach the Argo Rollouts API, or nil if no such client
+// is available, which is the case with fake clientsets.
+func rolloutsClient(c context.Context) rest.Interface {
+	return GetK8sInterface(c).Discovery().RESTClient()
+}
+
+func (o *rollout) request(c context.Context, verb string) (*rest.Request, error) {
+	rc := rolloutsClient(c)
+	if rc == nil {
+		return nil, errors2.NewNotFound(RolloutGroupVersion.WithResource("rollouts").GroupResource(), o.GetName())
+	}
+	return rc.Verb(verb).
+		AbsPath("/apis", RolloutGroupVersion.Group, RolloutGroupVersion.Version).
+		Namespace(o.GetNamespace()).
+		Resource("rollouts"), nil
+}
+
+func (o *rollout) do(c context.Context, req *rest.Request) error {
+	data, err := req.Do(c).Raw()
+	if err != nil {
+		return err
+	}
+	u := &unstructured.Unstructured{}
+	if err = u.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	o.Unstructured = u
+	o.template = nil
+	return nil
+}
+
+func (o *rollout) GetKind() string {
+	return "Rollout"
+}
+
+func (o *rollout) DeepCopyObject() runtime.Object {
+	return &rollout{Unstructured: o.Unstructured.DeepCopy()}
+}
+
+func (o *rollout) Delete(c context.Context) error {
+	req, err := o.request(c, "DELETE")
+	if err != nil {
+		return err
+	}
+	return req.Name(o.GetName()).Do(c).Error()
+}
+
+// GetPodTemplate returns the pod template of the Rollout. Changes to the returned template are
+// sent to the cluster when the Rollout is updated.
+func (o *rollout) GetPodTemplate() *core.PodTemplateSpec {
+	if o.template == nil {
+		o.template = &core.PodTemplateSpec{}
+		if tm, ok, _ := unstructured.NestedMap(o.Object, "spec", "template"); ok {
+			_ = runtime.DefaultUnstructuredConverter.FromUnstructured(tm, o.template)
+		}
+	}
+	return o.template
+}
+
+// Patch patches the Rollout. Custom resources don't support strategic merge patches, so such patches are sent
+// as JSON merge patches. The two are equivalent for patches that contain no lists, which is true for the patches
+// that telepresence uses to annotate pod templates.
+func (o *rollout) Patch(c context.Context, pt types.PatchType, data []byte, subresources ...string) error {
+	if pt == types.StrategicMergePatchType {
+		pt = types.MergePatchType
+	}
+	req, err := o.request(c, "PATCH")
+	if err != nil {
+		return err
+	}
+	return o.do(c, req.Name(o.GetName()).SubResource(subresources...).SetHeader("Content-Type", string(pt)).Body(data))
+}
+
+func (o *rollout) Refresh(c context.Context) error {
+	req, err := o.request(c, "GET")
+	if err != nil {
+		return err
+	}
+	return o.do(c, req.Name(o.GetName()))
+}
+
+func (o *rollout) Replicas() int {
+	replicas, _, _ := unstructured.NestedInt64(o.Object, "status", "replicas")
+	return int(replicas)
+}
+
+// MarshalJSON writes the pod template back to the unstructured Rollout and returns its JSON encoding.
+func (o *rollout) MarshalJSON() ([]byte, error) {
+	if o.template != nil {
+		tm, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o.template)
+		if err != nil {
+			return nil, err
+		}
+		if err = unstructured.SetNestedMap(o.Object, tm, "spec", "template"); err != nil {
+			return nil, err
+		}
+	}
+	return o.Unstructured.MarshalJSON()
+}
+
+func (o *rollout) Update(c context.Context) error {
+	data, err := o.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	req, err := o.request(c, "PUT")
+	if err != nil {
+		return err
+	}
+	return o.do(c, req.Name(o.GetName()).SetHeader("Content-Type", "application/json").Body(data))
+}
+
+func (o *rollout) Updated(origGeneration int64) bool {
+	generation := o.GetGeneration()
+	status := func(field string) int64 {
+		v, _, _ := unstructured.NestedInt64(o.Object, "status", field)
+		return v
+	}
+	specReplicas, found, _ := unstructured.NestedInt64(o.Object, "spec", "replicas")
+	if !found {
+		specReplicas = 1
+	}
+	replicas := status("replicas")
+	updatedReplicas := status("updatedReplicas")
+	applied := generation >= origGeneration &&
+		rolloutObservedGeneration(o.Object) == generation &&
+		updatedReplicas >= specReplicas &&
+		updatedReplicas == replicas &&
+		status("availableReplicas") == replicas
+	return applied
+}
+
+// rolloutObservedGeneration returns the status.observedGeneration of a Rollout. Argo Rollouts reports it as a
+// string, but an integer is accepted too.
+func rolloutObservedGeneration(obj map[string]interface{}) int64 {
+	v, found, _ := unstructured.NestedFieldNoCopy(obj, "status", "observedGeneration")
+	if !found {
+		return -1
+	}
+	switch v := v.(type) {
+	case string:
+		if g, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return g
+		}
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return -1
+}
@@ -0,0 +1,130 @@
+package k8sapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	restfake "k8s.io/client-go/rest/fake"
+)
+
+const rolloutJSON = `{
+  "apiVersion": "argoproj.io/v1alpha1",
+  "kind": "Rollout",
+  "metadata": {"name": "echo", "namespace": "default", "generation": 2},
+  "spec": {
+    "replicas": 2,
+    "strategy": {"canary": {"steps": [{"setWeight": 20}]}},
+    "template": {
+      "metadata": {"labels": {"app": "echo"}},
+      "spec": {"containers": [{"name": "echo", "image": "echo:1"}]}
+    }
+  },
+  "status": {"observedGeneration": "2", "replicas": 2, "updatedReplicas": 2, "availableReplicas": 2}
+}`
+
+// rolloutClientset is a fake clientset with a discovery client that reaches the given REST client.
+type rolloutClientset struct {
+	*fake.Clientset
+	dc discovery.DiscoveryInterface
+}
+
+func (c *rolloutClientset) Discovery() discovery.DiscoveryInterface {
+	return c.dc
+}
+
+type rolloutRequest struct {
+	method      string
+	path        string
+	contentType string
+	body        []byte
+}
+
+func rolloutContext(requests *[]rolloutRequest) context.Context {
+	rc := &restfake.RESTClient{
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client: restfake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			rr := rolloutRequest{method: req.Method, path: req.URL.Path, contentType: req.Header.Get("Content-Type")}
+			if req.Body != nil {
+				rr.body, _ = io.ReadAll(req.Body)
+			}
+			*requests = append(*requests, rr)
+			body := []byte(rolloutJSON)
+			if req.Method == http.MethodPut {
+				body = rr.body
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(bytes.NewReader(body)),
+			}, nil
+		}),
+	}
+	var ki kubernetes.Interface = &rolloutClientset{Clientset: fake.NewSimpleClientset(), dc: discovery.NewDiscoveryClient(rc)}
+	return WithK8sInterface(context.Background(), ki)
+}
+
+func TestRollout(t *testing.T) {
+	var requests []rolloutRequest
+	ctx := rolloutContext(&requests)
+
+	wl, err := GetWorkload(ctx, "echo", "default", "Rollout")
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/apis/argoproj.io/v1alpha1/namespaces/default/rollouts/echo", requests[0].path)
+	assert.Equal(t, "Rollout", wl.GetKind())
+	assert.Equal(t, 2, wl.Replicas())
+	assert.True(t, wl.Updated(2))
+	assert.False(t, wl.Updated(3))
+
+	tpl := wl.GetPodTemplate()
+	require.Len(t, tpl.Spec.Containers, 1)
+	assert.Equal(t, "echo:1", tpl.Spec.Containers[0].Image)
+
+	// The update must send the modified template and retain the fields that telepresence doesn't know about
+	tpl.Spec.Containers[0].Image = "echo:2"
+	require.NoError(t, wl.Update(ctx))
+	require.Len(t, requests, 2)
+	put := requests[1]
+	assert.Equal(t, http.MethodPut, put.method)
+	var sent map[string]interface{}
+	require.NoError(t, json.Unmarshal(put.body, &sent))
+	spec := sent["spec"].(map[string]interface{})
+	assert.Contains(t, spec, "strategy")
+	assert.Equal(t, "echo:2", wl.GetPodTemplate().Spec.Containers[0].Image)
+
+	// Custom resources don't support strategic merge patches
+	require.NoError(t, wl.Patch(ctx, types.StrategicMergePatchType, []byte(`{"spec":{"template":{"metadata":{"annotations":{"a":"b"}}}}}`)))
+	require.Len(t, requests, 3)
+	assert.Equal(t, http.MethodPatch, requests[2].method)
+	assert.Equal(t, string(types.MergePatchType), requests[2].contentType)
+
+	_, ok := RolloutImpl(wl)
+	assert.True(t, ok)
+}
+
+func TestRollout_noRESTClient(t *testing.T) {
+	ctx := WithK8sInterface(context.Background(), fake.NewSimpleClientset())
+	_, err := GetRollout(ctx, "echo", "default")
+	assert.True(t, errors2.IsNotFound(err))
+
+	_, err = GetWorkload(ctx, "echo", "default", "")
+	assert.True(t, errors2.IsNotFound(err))
+}
+
+func TestIsRolloutOwner(t *testing.T) {
+	assert.True(t, IsRolloutOwner("argoproj.io/v1alpha1", "Rollout"))
+	assert.False(t, IsRolloutOwner("apps/v1", "Deployment"))
+	assert.False(t, IsRolloutOwner("example.com/v1", "Rollout"))
+}
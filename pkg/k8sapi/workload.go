@@ -5,9 +5,11 @@ import (
 	"fmt"
 
 	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
 	core "k8s.io/api/core/v1"
 	errors2 "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -27,6 +29,9 @@ type Workload interface {
 //   1. Deployments
 //   2. ReplicaSets
 //   3. StatefulSets
+//   4. Argo Rollouts
+//   5. Jobs
+//   6. CronJobs
 //
 // The first match is returned.
 func GetWorkload(c context.Context, name, namespace, workloadKind string) (obj Workload, err error) {
@@ -37,8 +42,14 @@ func GetWorkload(c context.Context, name, namespace, workloadKind string) (obj W
 		obj, err = GetReplicaSet(c, name, namespace)
 	case "StatefulSet":
 		obj, err = GetStatefulSet(c, name, namespace)
+	case "Rollout":
+		obj, err = GetRollout(c, name, namespace)
+	case "Job":
+		obj, err = GetJob(c, name, namespace)
+	case "CronJob":
+		obj, err = GetCronJob(c, name, namespace)
 	case "":
-		for _, wk := range []string{"Deployment", "ReplicaSet", "StatefulSet"} {
+		for _, wk := range []string{"Deployment", "ReplicaSet", "StatefulSet", "Rollout", "Job", "CronJob"} {
 			if obj, err = GetWorkload(c, name, namespace, wk); err == nil {
 				return obj, nil
 			}
@@ -61,9 +72,16 @@ func WrapWorkload(workload runtime.Object) (Workload, error) {
 		return ReplicaSet(workload), nil
 	case *apps.StatefulSet:
 		return StatefulSet(workload), nil
-	default:
-		return nil, fmt.Errorf("unsupported workload type %T", workload)
+	case *batch.Job:
+		return Job(workload), nil
+	case *batch.CronJob:
+		return CronJob(workload), nil
+	case *unstructured.Unstructured:
+		if workload.GetKind() == "Rollout" {
+			return Rollout(workload), nil
+		}
 	}
+	return nil, fmt.Errorf("unsupported workload type %T", workload)
 }
 
 func GetDeployment(c context.Context, name, namespace string) (Workload, error) {
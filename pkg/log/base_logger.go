@@ -8,9 +8,12 @@ import (
 	"github.com/datawire/dlib/dlog"
 )
 
-func MakeBaseLogger(ctx context.Context, logLevel string) context.Context {
+// TimestampFormat is the format of the timestamp that starts each line written by the base logger.
+const TimestampFormat = "2006-01-02 15:04:05.0000"
+
+func MakeBaseLogger(ctx context.Context, logLevel, logFormat string) context.Context {
 	logrusLogger := logrus.New()
-	logrusFormatter := NewFormatter("2006-01-02 15:04:05.0000")
+	logrusFormatter := NewFormatterFor(logFormat, TimestampFormat)
 	logrusLogger.SetFormatter(logrusFormatter)
 
 	SetLogrusLevel(logrusLogger, logLevel)
@@ -0,0 +1,99 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FormatText is the default log format, with one human readable line per entry.
+	FormatText = "text"
+
+	// FormatJSON is a log format with one JSON object per line. See JSONEntry.
+	FormatJSON = "json"
+)
+
+// ValidateFormat returns an error unless the given log format is empty, FormatText, or FormatJSON.
+func ValidateFormat(format string) error {
+	switch format {
+	case "", FormatText, FormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid log format %q, must be %q or %q", format, FormatText, FormatJSON)
+	}
+}
+
+// NewFormatterFor returns a JSONFormatter when the given format is FormatJSON, and a Formatter that
+// uses the given timestamp format otherwise.
+func NewFormatterFor(format, timestampFormat string) logrus.Formatter {
+	if format == FormatJSON {
+		return NewJSONFormatter()
+	}
+	return NewFormatter(timestampFormat)
+}
+
+// JSONEntry is the JSON representation of a log entry written by the JSONFormatter.
+type JSONEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Thread  string            `json:"thread,omitempty"`
+	Message string            `json:"msg"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Caller  string            `json:"caller,omitempty"`
+}
+
+// ParseJSONEntry parses a line written by the JSONFormatter.
+func ParseJSONEntry(line []byte) (*JSONEntry, error) {
+	var je JSONEntry
+	if err := json.Unmarshal(line, &je); err != nil {
+		return nil, err
+	}
+	return &je, nil
+}
+
+// JSONFormatter formats log messages as JSON objects, one per line, so that they can be ingested by
+// log aggregators without parsing the text format.
+type JSONFormatter struct{}
+
+func NewJSONFormatter() *JSONFormatter {
+	return &JSONFormatter{}
+}
+
+// Format implements logrus.Formatter
+func (f *JSONFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	je := JSONEntry{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+	}
+	for k, v := range entry.Data {
+		if k == "THREAD" {
+			je.Thread, _ = v.(string)
+			je.Thread = strings.TrimPrefix(je.Thread, "/")
+			continue
+		}
+		if je.Fields == nil {
+			je.Fields = make(map[string]string, len(entry.Data))
+		}
+		je.Fields[k] = fmt.Sprintf("%+v", v)
+	}
+	if entry.HasCaller() && strings.HasPrefix(entry.Caller.File, thisModule+"/") {
+		je.Caller = fmt.Sprintf("%s:%d", strings.TrimPrefix(entry.Caller.File, thisModule+"/"), entry.Caller.Line)
+	}
+
+	data, err := json.Marshal(&je)
+	if err != nil {
+		return nil, err
+	}
+	b := entry.Buffer
+	if b == nil {
+		return append(data, '\n'), nil
+	}
+	b.Write(data)
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
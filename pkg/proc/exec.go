@@ -18,43 +18,54 @@ import (
 // and os.Interrupt on Windows).
 func Run(ctx context.Context, env map[string]string, exe string, args ...string) error {
 	cmd := exec.CommandContext(ctx, exe, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
 	cmd.Env = os.Environ()
 	for k, v := range env {
 		cmd.Env = append(cmd.Env, k+"="+v)
 	}
-
-	var err error
-	if err = cmd.Start(); err != nil {
-		return fmt.Errorf("%s: %w", shellquote.ShellString(exe, args), err)
-	}
-
-	// Ensure that signals are propagated to the child process
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, signalsToForward...)
-	defer func() {
-		signal.Stop(sigCh)
-		close(sigCh)
-	}()
-	go func() {
-		sig := <-sigCh
-		if sig == nil {
-			return
-		}
-		_ = cmd.Process.Signal(sig)
-	}()
-	s, err := cmd.Process.Wait()
+	wait, err := Start(cmd)
 	if err != nil {
-		return fmt.Errorf("%s: %w", shellquote.ShellString(exe, args), err)
+		return err
 	}
+	return wait()
+}
 
-	exitCode := s.ExitCode()
-	if exitCode != 0 {
-		return fmt.Errorf("%s %s: exited with %d", exe, strings.Join(args, " "), exitCode)
+// Start starts the given command with the standard input and outputs of this process, and returns a function
+// that waits for the command to terminate and returns the result. Signals are dispatched to the command while
+// the function waits.
+func Start(cmd *exec.Cmd) (func() error, error) {
+	exe, args := cmd.Args[0], cmd.Args[1:]
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %w", shellquote.ShellString(exe, args), err)
 	}
-	return nil
+	return func() error {
+		// Ensure that signals are propagated to the child process
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, signalsToForward...)
+		defer func() {
+			signal.Stop(sigCh)
+			close(sigCh)
+		}()
+		go func() {
+			sig := <-sigCh
+			if sig == nil {
+				return
+			}
+			_ = cmd.Process.Signal(sig)
+		}()
+		s, err := cmd.Process.Wait()
+		if err != nil {
+			return fmt.Errorf("%s: %w", shellquote.ShellString(exe, args), err)
+		}
+
+		exitCode := s.ExitCode()
+		if exitCode != 0 {
+			return fmt.Errorf("%s %s: exited with %d", exe, strings.Join(args, " "), exitCode)
+		}
+		return nil
+	}, nil
 }
 
 func StartInBackground(args ...string) error {
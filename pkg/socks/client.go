@@ -0,0 +1,149 @@
+package socks
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ErrHostNotFound is returned by Resolve when the proxy is unable to resolve the host name.
+var ErrHostNotFound = errors.New("host not found")
+
+// Dial connects to the given IP and port through the SOCKS5 proxy at the given address. Unlike
+// the connections of golang.org/x/net/proxy, the returned connection can be half closed.
+func Dial(ctx context.Context, proxyAddress string, ip net.IP, port uint16) (*net.TCPConn, error) {
+	conn, atyp, err := request(ctx, proxyAddress, cmdConnect, ip.String(), port)
+	if err != nil {
+		return nil, err
+	}
+	// The bound address of the reply is of no interest
+	if _, err = readReplyAddr(conn, atyp); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// Resolve resolves the given host name using the RESOLVE extension of the SOCKS5 proxy at the
+// given address.
+func Resolve(ctx context.Context, proxyAddress, host string) (net.IP, error) {
+	conn, atyp, err := request(ctx, proxyAddress, cmdResolve, host, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ip, err := readReplyAddr(conn, atyp)
+	if err == nil && ip == nil {
+		err = fmt.Errorf("unable to resolve %q: %w", host, ErrHostNotFound)
+	}
+	return ip, err
+}
+
+// request sends a request with the given command, host, and port, to the SOCKS5 proxy at the given
+// address, and reads the reply up to the type of its address, which is returned. The deadline of the
+// returned connection is the deadline of the context, if it has one.
+func request(ctx context.Context, proxyAddress string, cmd byte, host string, port uint16) (*net.TCPConn, byte, error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", proxyAddress)
+	if err != nil {
+		return nil, 0, err
+	}
+	conn := c.(*net.TCPConn)
+	atyp, err := handshake(ctx, conn, cmd, host, port)
+	if err != nil {
+		_ = conn.Close()
+		if errors.Is(err, ErrHostNotFound) {
+			return nil, 0, fmt.Errorf("unable to resolve %q: %w", host, err)
+		}
+		return nil, 0, fmt.Errorf("SOCKS5 request to %s failed: %w", proxyAddress, err)
+	}
+	return conn, atyp, nil
+}
+
+func handshake(ctx context.Context, conn net.Conn, cmd byte, host string, port uint16) (byte, error) {
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	if _, err := conn.Write([]byte{socksVersion, 1, authNone}); err != nil {
+		return 0, err
+	}
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		return 0, err
+	}
+	if greeting[0] != socksVersion || greeting[1] != authNone {
+		return 0, errors.New("the proxy requires authentication")
+	}
+
+	req := []byte{socksVersion, cmd, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return 0, fmt.Errorf("host name %q is too long", host)
+		}
+		req = append(req, atypDomain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, atypIPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, atypIPv6)
+		req = append(req, ip...)
+	}
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], port)
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+
+	// Reply: VER REP RSV ATYP
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return 0, err
+	}
+	switch reply[1] {
+	case repSucceeded:
+		return reply[3], nil
+	case repHostUnreachable:
+		if cmd == cmdResolve {
+			return 0, ErrHostNotFound
+		}
+		return 0, errors.New("host unreachable")
+	default:
+		return 0, fmt.Errorf("the proxy replied with error code %d", reply[1])
+	}
+}
+
+// readReplyAddr reads the address and port that end a reply, and returns the address. A domain name
+// isn't resolved and results in a nil IP.
+func readReplyAddr(conn net.Conn, atyp byte) (net.IP, error) {
+	var addr []byte
+	switch atyp {
+	case atypIPv4:
+		addr = make([]byte, 4)
+	case atypIPv6:
+		addr = make([]byte, 16)
+	case atypDomain:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return nil, err
+		}
+		addr = make([]byte, l[0])
+	default:
+		return nil, fmt.Errorf("the proxy replied with an unknown address type %d", atyp)
+	}
+	if _, err := io.ReadFull(conn, addr); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, 2)); err != nil {
+		return nil, err
+	}
+	if atyp == atypDomain {
+		return nil, nil
+	}
+	return addr, nil
+}
@@ -0,0 +1,308 @@
+package socks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+const (
+	socksVersion = 5
+
+	authNone         = 0x00
+	authUnacceptable = 0xff
+
+	cmdConnect = 0x01
+
+	// cmdResolve is the RESOLVE extension of Tor. The server resolves the host name of the request
+	// and replies with the address as the bound address.
+	cmdResolve = 0xf0
+
+	atypIPv4   = 0x01
+	atypDomain = 0x03
+	atypIPv6   = 0x04
+
+	repSucceeded           = 0x00
+	repGeneralFailure      = 0x01
+	repHostUnreachable     = 0x04
+	repCommandNotSupported = 0x07
+	repAddrNotSupported    = 0x08
+)
+
+// Resolver resolves a host name into an IP address.
+type Resolver func(ctx context.Context, host string) (net.IP, error)
+
+// Forwarder forwards everything that is read from and written to the given connection to the
+// given IP and port. It must not return until the connection has ended.
+type Forwarder func(ctx context.Context, conn net.Conn, ip net.IP, port uint16) error
+
+// PACPath is the path of the proxy auto-config file that a Server with a PAC function serves.
+const PACPath = "/proxy.pac"
+
+// Server is a proxy that accepts both SOCKS5 and HTTP proxy requests on the same listener. The
+// protocol is determined by the first byte sent by the client. SOCKS5 is limited to the CONNECT
+// command, and to the RESOLVE extension of Tor, without authentication. HTTP supports the CONNECT
+// method and plain requests using an absolute URI.
+type Server struct {
+	Resolve Resolver
+	Forward Forwarder
+
+	// PAC, when set, returns the proxy auto-config file that the server returns for a plain GET
+	// request for the PACPath, i.e. when the server is used as a web server instead of as a proxy.
+	PAC func(ctx context.Context) (string, error)
+}
+
+// Serve accepts connections on the given listener until the context is cancelled.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := s.handle(ctx, conn); err != nil {
+				dlog.Errorf(ctx, "proxy connection from %s failed: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// bufferedConn is a net.Conn that reads from a bufio.Reader so that bytes buffered during the
+// handshake aren't lost.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (s *Server) handle(ctx context.Context, conn net.Conn) error {
+	bc := &bufferedConn{Conn: conn, r: bufio.NewReader(conn)}
+	first, err := bc.r.Peek(1)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+	if first[0] == socksVersion {
+		return s.handleSOCKS(ctx, bc)
+	}
+	return s.handleHTTP(ctx, bc)
+}
+
+func (s *Server) handleSOCKS(ctx context.Context, conn *bufferedConn) error {
+	// Greeting: VER NMETHODS METHODS...
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn.r, hdr); err != nil {
+		return err
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn.r, methods); err != nil {
+		return err
+	}
+	method := byte(authUnacceptable)
+	for _, m := range methods {
+		if m == authNone {
+			method = authNone
+			break
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return err
+	}
+	if method == authUnacceptable {
+		return errors.New("client doesn't support unauthenticated SOCKS5")
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn.r, req); err != nil {
+		return err
+	}
+	if req[1] != cmdConnect && req[1] != cmdResolve {
+		_ = socksReply(conn, repCommandNotSupported)
+		return fmt.Errorf("unsupported SOCKS5 command %d", req[1])
+	}
+	var host string
+	switch req[3] {
+	case atypIPv4, atypIPv6:
+		ip := make(net.IP, 4)
+		if req[3] == atypIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(conn.r, ip); err != nil {
+			return err
+		}
+		host = ip.String()
+	case atypDomain:
+		l, err := conn.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		name := make([]byte, l)
+		if _, err := io.ReadFull(conn.r, name); err != nil {
+			return err
+		}
+		host = string(name)
+	default:
+		_ = socksReply(conn, repAddrNotSupported)
+		return fmt.Errorf("unsupported SOCKS5 address type %d", req[3])
+	}
+	pb := make([]byte, 2)
+	if _, err := io.ReadFull(conn.r, pb); err != nil {
+		return err
+	}
+	port := binary.BigEndian.Uint16(pb)
+
+	ip, err := s.resolve(ctx, host)
+	if err != nil {
+		_ = socksReply(conn, repHostUnreachable)
+		return err
+	}
+	if req[1] == cmdResolve {
+		return socksResolveReply(conn, ip)
+	}
+	if err = socksReply(conn, repSucceeded); err != nil {
+		return err
+	}
+	return s.Forward(ctx, conn, ip, port)
+}
+
+// socksReply sends a reply with the given code. The bound address is always reported as 0.0.0.0:0
+// since the actual connection is made at the other end of the tunnel.
+func socksReply(conn net.Conn, rep byte) error {
+	_, err := conn.Write([]byte{socksVersion, rep, 0, atypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// socksResolveReply sends a successful reply to a RESOLVE request with the resolved IP as the
+// bound address.
+func socksResolveReply(conn net.Conn, ip net.IP) error {
+	reply := []byte{socksVersion, repSucceeded, 0, atypIPv4}
+	if ip4 := ip.To4(); ip4 != nil {
+		reply = append(reply, ip4...)
+	} else {
+		reply[3] = atypIPv6
+		reply = append(reply, ip.To16()...)
+	}
+	_, err := conn.Write(append(reply, 0, 0))
+	return err
+}
+
+func (s *Server) handleHTTP(ctx context.Context, conn *bufferedConn) error {
+	req, err := http.ReadRequest(conn.r)
+	if err != nil {
+		return err
+	}
+	if req.Method != http.MethodConnect {
+		return s.handleHTTPForward(ctx, conn, req)
+	}
+	host, portStr, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+		return fmt.Errorf("invalid port %q: %w", portStr, err)
+	}
+	ip, err := s.resolve(ctx, host)
+	if err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\nConnection: close\r\n\r\n")
+		return err
+	}
+	if _, err = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return err
+	}
+	return s.Forward(ctx, conn, ip, uint16(port))
+}
+
+// handleHTTPForward forwards a plain HTTP proxy request. The request is rewritten to origin form
+// and sent to the target as the first data on the forwarded connection. The connection is closed
+// after the response since subsequent requests might be intended for other hosts.
+func (s *Server) handleHTTPForward(ctx context.Context, conn *bufferedConn, req *http.Request) error {
+	if s.PAC != nil && req.Method == http.MethodGet && !req.URL.IsAbs() && req.URL.Path == PACPath {
+		return s.servePAC(ctx, conn)
+	}
+	if !req.URL.IsAbs() || req.URL.Scheme != "http" {
+		_, _ = io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+		return fmt.Errorf("proxy request for %q has no absolute http URI", req.RequestURI)
+	}
+	host := req.URL.Hostname()
+	port := uint64(80)
+	if ps := req.URL.Port(); ps != "" {
+		var err error
+		if port, err = strconv.ParseUint(ps, 10, 16); err != nil {
+			_, _ = io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+			return fmt.Errorf("invalid port %q: %w", ps, err)
+		}
+	}
+	ip, err := s.resolve(ctx, host)
+	if err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\nConnection: close\r\n\r\n")
+		return err
+	}
+	for h := range req.Header {
+		if strings.HasPrefix(h, "Proxy-") {
+			req.Header.Del(h)
+		}
+	}
+	req.Close = true
+	buf := bytes.Buffer{}
+	if err = req.Write(&buf); err != nil {
+		return err
+	}
+	fc := &bufferedConn{Conn: conn, r: bufio.NewReader(io.MultiReader(&buf, conn.r))}
+	return s.Forward(ctx, fc, ip, uint16(port))
+}
+
+// servePAC responds with the proxy auto-config file and closes the connection.
+func (s *Server) servePAC(ctx context.Context, conn net.Conn) error {
+	pac, err := s.PAC(ctx)
+	if err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 503 Service Unavailable\r\nConnection: close\r\n\r\n")
+		return fmt.Errorf("unable to create proxy auto-config: %w", err)
+	}
+	_, err = fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: application/x-ns-proxy-autoconfig\r\n"+
+		"Content-Length: %d\r\n"+
+		"Cache-Control: no-cache\r\n"+
+		"Connection: close\r\n\r\n%s", len(pac), pac)
+	return err
+}
+
+func (s *Server) resolve(ctx context.Context, host string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+	ip, err := s.Resolve(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve %q: %w", host, err)
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("unable to resolve %q", host)
+	}
+	return ip, nil
+}
@@ -0,0 +1,175 @@
+package socks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/proxy"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// testServer starts a proxy that resolves "echo.test" to 127.0.0.1 and forwards all
+// connections to 127.0.0.1 using a plain TCP dial.
+func testServer(t *testing.T) (string, string) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	t.Cleanup(cancel)
+
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	t.Cleanup(func() { _ = echo.Close() })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &Server{
+		Resolve: func(_ context.Context, host string) (net.IP, error) {
+			if host == "echo.test" {
+				return net.IPv4(127, 0, 0, 1), nil
+			}
+			return nil, fmt.Errorf("no such host %s", host)
+		},
+		Forward: func(ctx context.Context, conn net.Conn, ip net.IP, port uint16) error {
+			tc, err := net.DialTCP("tcp", nil, &net.TCPAddr{IP: ip, Port: int(port)})
+			if err != nil {
+				return err
+			}
+			defer tc.Close()
+			go func() {
+				_, _ = io.Copy(tc, conn)
+				_ = tc.CloseWrite()
+			}()
+			_, err = io.Copy(conn, tc)
+			return err
+		},
+	}
+	go func() { _ = s.Serve(ctx, l) }()
+	_, echoPort, _ := net.SplitHostPort(echo.Addr().String())
+	return l.Addr().String(), echoPort
+}
+
+func assertEcho(t *testing.T, conn net.Conn) {
+	_, err := conn.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", line)
+}
+
+func TestServer_SOCKS5(t *testing.T) {
+	proxyAddr, echoPort := testServer(t)
+	dialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, proxy.Direct)
+	require.NoError(t, err)
+
+	conn, err := dialer.Dial("tcp", net.JoinHostPort("echo.test", echoPort))
+	require.NoError(t, err)
+	defer conn.Close()
+	assertEcho(t, conn)
+
+	_, err = dialer.Dial("tcp", net.JoinHostPort("unknown.test", echoPort))
+	assert.Error(t, err)
+}
+
+func TestDial(t *testing.T) {
+	proxyAddr, echoPort := testServer(t)
+	ctx := dlog.NewTestContext(t, false)
+	port, err := strconv.ParseUint(echoPort, 10, 16)
+	require.NoError(t, err)
+
+	conn, err := Dial(ctx, proxyAddr, net.IPv4(127, 0, 0, 1), uint16(port))
+	require.NoError(t, err)
+	defer conn.Close()
+	assertEcho(t, conn)
+
+	// The echo server ends the connection when this end is half closed
+	require.NoError(t, conn.CloseWrite())
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestResolve(t *testing.T) {
+	proxyAddr, _ := testServer(t)
+	ctx := dlog.NewTestContext(t, false)
+
+	ip, err := Resolve(ctx, proxyAddr, "echo.test")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ip.String())
+
+	_, err = Resolve(ctx, proxyAddr, "unknown.test")
+	assert.ErrorIs(t, err, ErrHostNotFound)
+}
+
+func TestServer_HTTPConnect(t *testing.T) {
+	proxyAddr, echoPort := testServer(t)
+	conn, err := net.Dial("tcp", proxyAddr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	target := net.JoinHostPort("echo.test", echoPort)
+	_, err = fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	require.NoError(t, err)
+	br := bufio.NewReader(conn)
+	rsp, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	_, err = conn.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", line)
+}
+
+func TestServer_HTTPForward(t *testing.T) {
+	proxyAddr, echoPort := testServer(t)
+	conn, err := net.Dial("tcp", proxyAddr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The echo server returns the forwarded request, which must be in origin form.
+	_, err = fmt.Fprintf(conn, "GET http://echo.test:%s/path HTTP/1.1\r\nHost: echo.test:%s\r\nProxy-Connection: keep-alive\r\n\r\n", echoPort, echoPort)
+	require.NoError(t, err)
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	require.NoError(t, err)
+	assert.Equal(t, "/path", req.RequestURI)
+	assert.Empty(t, req.Header.Get("Proxy-Connection"))
+	assert.True(t, req.Close)
+}
+
+func TestServer_PAC(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	const pac = `function FindProxyForURL(url, host) { return "DIRECT"; }`
+	s := &Server{PAC: func(context.Context) (string, error) { return pac, nil }}
+	go func() { _ = s.Serve(ctx, l) }()
+
+	rsp, err := http.Get("http://" + l.Addr().String() + PACPath)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+	assert.Equal(t, "application/x-ns-proxy-autoconfig", rsp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, pac, string(body))
+}
@@ -0,0 +1,157 @@
+package subnet
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+// IPAllocator hands out virtual IP addresses for names. Allocations are stable, so that allocating
+// an address for the same name twice yields the same address until the name is released.
+type IPAllocator interface {
+	// Allocate returns the address allocated for the given name, allocating a new one if necessary.
+	Allocate(name string) (net.IP, error)
+
+	// Lookup returns the name that the given address was allocated for.
+	Lookup(ip net.IP) (string, bool)
+
+	// Release makes the address allocated for the given name available for other names.
+	Release(name string)
+
+	// Subnet returns the subnet that addresses are allocated from.
+	Subnet() *net.IPNet
+}
+
+type ipAllocator struct {
+	sync.Mutex
+	subnet *net.IPNet
+	avoid  []*net.IPNet
+	byName map[string]iputil.IPKey
+	byIP   map[iputil.IPKey]string
+	next   net.IP
+}
+
+// NewIPAllocator returns an IPAllocator that allocates addresses from the given subnet. Addresses
+// that belong to any of the avoid subnets are never allocated. An error is returned when the avoid
+// subnets leave no addresses to allocate.
+func NewIPAllocator(sn *net.IPNet, avoid []*net.IPNet) (IPAllocator, error) {
+	ip := sn.IP.Mask(sn.Mask)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	sn = &net.IPNet{IP: ip, Mask: sn.Mask}
+	var overlapping []*net.IPNet
+	for _, a := range avoid {
+		if Covers(a, sn) {
+			return nil, fmt.Errorf("subnet %s is covered by %s", sn, a)
+		}
+		if Overlaps(a, sn) {
+			overlapping = append(overlapping, a)
+		}
+	}
+	if ones, bits := sn.Mask.Size(); bits-ones < 2 {
+		return nil, fmt.Errorf("subnet %s is too small to allocate addresses from", sn)
+	}
+	return &ipAllocator{
+		subnet: sn,
+		avoid:  overlapping,
+		byName: make(map[string]iputil.IPKey),
+		byIP:   make(map[iputil.IPKey]string),
+		next:   nextIP(sn.IP),
+	}, nil
+}
+
+func (a *ipAllocator) Allocate(name string) (net.IP, error) {
+	a.Lock()
+	defer a.Unlock()
+	if k, ok := a.byName[name]; ok {
+		return k.IP(), nil
+	}
+	start := a.next
+	ip := start
+	for {
+		if a.allocatable(ip) {
+			k := iputil.IPKey(ip)
+			a.byName[name] = k
+			a.byIP[k] = name
+			a.next = a.wrap(nextIP(ip))
+			return k.IP(), nil
+		}
+		ip = a.wrap(nextIP(ip))
+		if ip.Equal(start) {
+			return nil, fmt.Errorf("all addresses in subnet %s are allocated", a.subnet)
+		}
+	}
+}
+
+func (a *ipAllocator) Lookup(ip net.IP) (string, bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	a.Lock()
+	name, ok := a.byIP[iputil.IPKey(ip)]
+	a.Unlock()
+	return name, ok
+}
+
+func (a *ipAllocator) Release(name string) {
+	a.Lock()
+	if k, ok := a.byName[name]; ok {
+		delete(a.byName, name)
+		delete(a.byIP, k)
+	}
+	a.Unlock()
+}
+
+func (a *ipAllocator) Subnet() *net.IPNet {
+	return a.subnet
+}
+
+// allocatable returns true if the given address is neither allocated, the network or broadcast
+// address of the subnet, nor part of an avoided subnet.
+func (a *ipAllocator) allocatable(ip net.IP) bool {
+	if _, ok := a.byIP[iputil.IPKey(ip)]; ok {
+		return false
+	}
+	if ip.Equal(a.subnet.IP) || ip.Equal(lastIP(a.subnet)) {
+		return false
+	}
+	for _, av := range a.avoid {
+		if av.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// wrap returns the first address of the subnet when the given address is outside of it.
+func (a *ipAllocator) wrap(ip net.IP) net.IP {
+	if a.subnet.Contains(ip) {
+		return ip
+	}
+	return a.subnet.IP
+}
+
+// nextIP returns the address that follows the given address.
+func nextIP(ip net.IP) net.IP {
+	n := make(net.IP, len(ip))
+	copy(n, ip)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]++
+		if n[i] != 0 {
+			break
+		}
+	}
+	return n
+}
+
+// lastIP returns the last address of the given subnet.
+func lastIP(sn *net.IPNet) net.IP {
+	ip := make(net.IP, len(sn.IP))
+	for i := range ip {
+		ip[i] = sn.IP[i] | ^sn.Mask[i]
+	}
+	return ip
+}
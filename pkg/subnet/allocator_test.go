@@ -0,0 +1,59 @@
+package subnet
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPAllocator(t *testing.T) {
+	_, sn, _ := net.ParseCIDR("10.20.30.0/29")
+	_, local, _ := net.ParseCIDR("10.20.30.2/31")
+	a, err := NewIPAllocator(sn, []*net.IPNet{local})
+	require.NoError(t, err)
+
+	// The network address and the avoided 10.20.30.2 and 10.20.30.3 are skipped
+	ip, err := a.Allocate("alpha")
+	require.NoError(t, err)
+	assert.Equal(t, "10.20.30.1", ip.String())
+	ip, err = a.Allocate("beta")
+	require.NoError(t, err)
+	assert.Equal(t, "10.20.30.4", ip.String())
+
+	// Allocations are stable
+	ip, err = a.Allocate("alpha")
+	require.NoError(t, err)
+	assert.Equal(t, "10.20.30.1", ip.String())
+	name, ok := a.Lookup(net.ParseIP("10.20.30.4"))
+	assert.True(t, ok)
+	assert.Equal(t, "beta", name)
+
+	// The broadcast address is never allocated
+	_, err = a.Allocate("gamma")
+	require.NoError(t, err)
+	_, err = a.Allocate("delta")
+	require.NoError(t, err)
+	_, err = a.Allocate("epsilon")
+	assert.Error(t, err)
+
+	// Released addresses are reused
+	a.Release("beta")
+	_, ok = a.Lookup(net.ParseIP("10.20.30.4"))
+	assert.False(t, ok)
+	ip, err = a.Allocate("epsilon")
+	require.NoError(t, err)
+	assert.Equal(t, "10.20.30.4", ip.String())
+}
+
+func TestNewIPAllocator_invalid(t *testing.T) {
+	_, sn, _ := net.ParseCIDR("192.168.1.0/24")
+	_, lan, _ := net.ParseCIDR("192.168.0.0/16")
+	_, err := NewIPAllocator(sn, []*net.IPNet{lan})
+	assert.Error(t, err)
+
+	_, sn, _ = net.ParseCIDR("192.168.1.0/31")
+	_, err = NewIPAllocator(sn, nil)
+	assert.Error(t, err)
+}
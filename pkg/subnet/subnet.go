@@ -173,3 +173,28 @@ func Covers(a, b *net.IPNet) bool {
 	}
 	return a.Contains(m)
 }
+
+// Overlaps answers the question if network range a and network range b have at least one IP in common
+func Overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// Exclude returns the smallest set of subnets that together cover all of network range sn except
+// the IPs that are also in network range ex. The result is empty when ex covers sn, and contains
+// only sn when they don't overlap.
+func Exclude(sn, ex *net.IPNet) []*net.IPNet {
+	switch {
+	case Covers(ex, sn):
+		return nil
+	case !Overlaps(sn, ex):
+		return []*net.IPNet{sn}
+	}
+
+	// ex is a subnet of sn, so split sn in two halves and exclude ex from each of them.
+	ones, bits := sn.Mask.Size()
+	lo := &net.IPNet{IP: sn.IP.Mask(sn.Mask), Mask: net.CIDRMask(ones+1, bits)}
+	hi := &net.IPNet{IP: make(net.IP, len(lo.IP)), Mask: lo.Mask}
+	copy(hi.IP, lo.IP)
+	hi.IP[ones/8] |= 0x80 >> (ones % 8)
+	return append(Exclude(lo, ex), Exclude(hi, ex)...)
+}
@@ -187,3 +187,39 @@ func TestUnique(t *testing.T) {
 		})
 	}
 }
+
+func TestExclude(t *testing.T) {
+	cidrs := func(ss ...string) []*net.IPNet {
+		ns := make([]*net.IPNet, len(ss))
+		for i, s := range ss {
+			_, ns[i], _ = net.ParseCIDR(s)
+		}
+		return ns
+	}
+	tests := []struct {
+		name string
+		sn   string
+		ex   string
+		want []*net.IPNet
+	}{
+		{"disjoint", "10.96.0.0/12", "192.168.0.0/16", cidrs("10.96.0.0/12")},
+		{"covered", "10.96.0.0/12", "10.0.0.0/8", nil},
+		{"equal", "10.96.0.0/12", "10.96.0.0/12", nil},
+		{"lower half", "10.0.0.0/16", "10.0.0.0/17", cidrs("10.0.128.0/17")},
+		{"upper half", "10.0.0.0/16", "10.0.128.0/17", cidrs("10.0.0.0/17")},
+		{"inner", "10.0.0.0/22", "10.0.1.0/24", cidrs("10.0.0.0/24", "10.0.2.0/23")},
+		{"host", "192.168.0.0/30", "192.168.0.2/32", cidrs("192.168.0.0/31", "192.168.0.3/32")},
+		{"ipv6", "fd00::/126", "fd00::/127", cidrs("fd00::2/127")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sn := cidrs(tt.sn)[0]
+			ex := cidrs(tt.ex)[0]
+			got := Exclude(sn, ex)
+			require.Len(t, got, len(tt.want))
+			for i, w := range tt.want {
+				assert.True(t, Equal(w, got[i]), "want %s, got %s", w, got[i])
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package tunnel
+
+import (
+	"sync"
+)
+
+const (
+	// pooledBufferSize is the size of the buffer of a pooled message, including the message code.
+	pooledBufferSize = 0x40000
+
+	// maxReadSize is the maximum number of bytes that a dialer reads from its connection into one message. It
+	// leaves room for the nonce and the authentication tag that an encrypted stream adds, so that the encrypted
+	// message too can use a pooled buffer.
+	maxReadSize = pooledBufferSize - 64
+)
+
+var messagePool = sync.Pool{
+	New: func() interface{} {
+		return &pooledMessage{buf: make(msg, pooledBufferSize)}
+	},
+}
+
+// A pooledMessage is a Message that is backed by a buffer that is returned to a pool once the message has
+// been sent, so that the data path between a connection and a stream doesn't allocate a new buffer for
+// each message.
+type pooledMessage struct {
+	msg     // the message, which is a slice of buf
+	buf msg // the full buffer
+}
+
+// newPooledMessage returns a message with the given code and a payload of the given length from the pool.
+// The payloadLength must not exceed the capacity of a pooled buffer.
+func newPooledMessage(code MessageCode, payloadLength int) *pooledMessage {
+	m := messagePool.Get().(*pooledMessage)
+	m.msg = m.buf[:1+payloadLength]
+	m.msg[0] = byte(code)
+	return m
+}
+
+// fitsPooledMessage returns true if a payload of the given length fits a pooled message.
+func fitsPooledMessage(payloadLength int) bool {
+	return 1+payloadLength <= pooledBufferSize
+}
+
+// truncate shortens the payload of the message to the given length.
+func (m *pooledMessage) truncate(payloadLength int) {
+	m.msg = m.msg[:1+payloadLength]
+}
+
+// release returns the message to the pool. The message must not be used after it has been released.
+func (m *pooledMessage) release() {
+	m.msg = nil
+	messagePool.Put(m)
+}
+
+// ReleaseMessage returns the buffer of the given message to its pool if it has one. It must be called
+// once the message has been sent, and the message must not be used after that. gRPC has serialized a
+// message by the time its Send returns, so the buffer is then free to reuse.
+func ReleaseMessage(m Message) {
+	if pm, ok := m.(*pooledMessage); ok {
+		pm.release()
+	}
+}
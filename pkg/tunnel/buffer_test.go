@@ -0,0 +1,49 @@
+package tunnel
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPooledMessage(t *testing.T) {
+	m := newPooledMessage(Normal, maxReadSize)
+	assert.Equal(t, Normal, m.Code())
+	assert.Len(t, m.Payload(), maxReadSize)
+
+	copy(m.Payload(), "hello")
+	m.truncate(5)
+	assert.Equal(t, "hello", string(m.Payload()))
+	assert.Equal(t, append([]byte{byte(Normal)}, "hello"...), m.TunnelMessage().Payload)
+	ReleaseMessage(m)
+
+	assert.True(t, fitsPooledMessage(maxReadSize+64-1))
+	assert.False(t, fitsPooledMessage(pooledBufferSize))
+
+	// Releasing a message that isn't pooled is a no-op
+	ReleaseMessage(NewMessage(Normal, []byte("hello")))
+}
+
+func Test_collectPayloads(t *testing.T) {
+	incoming := make(chan Message, 10)
+	incoming <- NewMessage(Normal, []byte("b"))
+	incoming <- NewMessage(Normal, []byte("c"))
+	incoming <- NewMessage(KeepAlive, nil)
+	incoming <- NewMessage(Normal, []byte("d"))
+
+	bufs, ctrl := collectPayloads(NewMessage(Normal, []byte("a")), incoming)
+	assert.Equal(t, net.Buffers{[]byte("a"), []byte("b"), []byte("c")}, bufs)
+	assert.Equal(t, KeepAlive, ctrl.Code())
+
+	// Collecting stops when no more messages are waiting
+	bufs, ctrl = collectPayloads(NewMessage(Normal, []byte("a")), incoming)
+	assert.Equal(t, net.Buffers{[]byte("a"), []byte("d")}, bufs)
+	assert.Nil(t, ctrl)
+
+	// A closed channel ends the collection
+	close(incoming)
+	bufs, ctrl = collectPayloads(NewMessage(Normal, []byte("a")), incoming)
+	assert.Equal(t, net.Buffers{[]byte("a")}, bufs)
+	assert.Nil(t, ctrl)
+}
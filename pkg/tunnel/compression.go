@@ -0,0 +1,34 @@
+package tunnel
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip" // registers the gzip compressor with both the client and the server side
+)
+
+// CompressionGzip is the name of the gzip compression of tunnel streams. It's the only supported compression. zstd
+// is deferred until the tree is built with Go 1.22, which its pure Go implementation requires. The cgo ones can't be
+// cross-compiled.
+const CompressionGzip = gzip.Name
+
+// CheckCompression returns an error unless the given name is empty, meaning no compression, or the name of
+// a supported compression.
+func CheckCompression(name string) error {
+	switch name {
+	case "", CompressionGzip:
+		return nil
+	default:
+		return fmt.Errorf("unsupported tunnel compression %q, the only supported compression is %q", name, CompressionGzip)
+	}
+}
+
+// CompressionCallOptions returns the options to use in a call to the manager's Tunnel function so that the
+// messages of the stream are compressed using the given compression. A gRPC server always responds using
+// the compression of the call, so compression is decided solely by the caller.
+func CompressionCallOptions(name string) []grpc.CallOption {
+	if name == "" {
+		return nil
+	}
+	return []grpc.CallOption{grpc.UseCompressor(name)}
+}
@@ -0,0 +1,18 @@
+package tunnel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCompression(t *testing.T) {
+	assert.NoError(t, CheckCompression(""))
+	assert.NoError(t, CheckCompression(CompressionGzip))
+	assert.Error(t, CheckCompression("zstd"))
+}
+
+func TestCompressionCallOptions(t *testing.T) {
+	assert.Empty(t, CompressionCallOptions(""))
+	assert.Len(t, CompressionCallOptions(CompressionGzip), 1)
+}
@@ -1,6 +1,10 @@
 package tunnel
 
-import "context"
+import (
+	"context"
+	"net"
+	"time"
+)
 
 type poolKey struct{}
 
@@ -16,3 +20,71 @@ func GetPool(ctx context.Context) *Pool {
 	}
 	return pool
 }
+
+// Timeouts controls how long the connections of the dialer endpoints remain alive without traffic. A zero value
+// means that the default is used.
+type Timeouts struct {
+	// TCPIdle is how long a TCP connection may be idle before it's closed. Defaults to two hours.
+	TCPIdle time.Duration
+
+	// UDPIdle is how long a UDP connection may be idle before it's closed. Defaults to one minute.
+	UDPIdle time.Duration
+
+	// KeepAlive is the interval at which KeepAlive messages are sent to the peer of the tunnel, and TCP
+	// keep-alive probes are sent on the connections that a dialer establishes. The peer resets its idle timer
+	// when it receives a KeepAlive, so a connection is kept open for as long as both ends are alive. No
+	// KeepAlive messages are sent by default, and the probes then use the default of the Go net package.
+	KeepAlive time.Duration
+}
+
+type timeoutsKey struct{}
+
+// WithTimeouts returns a context with the given Timeouts, used by the dialer endpoints started with it.
+func WithTimeouts(ctx context.Context, timeouts Timeouts) context.Context {
+	return context.WithValue(ctx, timeoutsKey{}, timeouts)
+}
+
+// GetTimeouts returns the Timeouts of the given context, with defaults for the values that aren't set.
+func GetTimeouts(ctx context.Context) Timeouts {
+	timeouts, _ := ctx.Value(timeoutsKey{}).(Timeouts)
+	if timeouts.TCPIdle <= 0 {
+		timeouts.TCPIdle = tcpConnTTL
+	}
+	if timeouts.UDPIdle <= 0 {
+		timeouts.UDPIdle = udpConnTTL
+	}
+	if timeouts.KeepAlive < 0 {
+		timeouts.KeepAlive = 0
+	}
+	return timeouts
+}
+
+// ConnWrapper returns the connection that a dialer endpoint uses in place of the given connection, which it
+// established for the stream with the given ID. The interceptID is the ID of the intercept that the stream
+// belongs to, or empty when it doesn't belong to an intercept.
+type ConnWrapper func(ctx context.Context, id ConnID, interceptID string, conn net.Conn) net.Conn
+
+type connWrapperKey struct{}
+
+// WithConnWrapper returns a context with the given ConnWrapper, used by the dialer endpoints started with it.
+func WithConnWrapper(ctx context.Context, wrapper ConnWrapper) context.Context {
+	return context.WithValue(ctx, connWrapperKey{}, wrapper)
+}
+
+func getConnWrapper(ctx context.Context) ConnWrapper {
+	w, _ := ctx.Value(connWrapperKey{}).(ConnWrapper)
+	return w
+}
+
+type interceptIDKey struct{}
+
+// withInterceptID returns a context that tells the dialer endpoints started with it what intercept their
+// streams belong to.
+func withInterceptID(ctx context.Context, interceptID string) context.Context {
+	return context.WithValue(ctx, interceptIDKey{}, interceptID)
+}
+
+func getInterceptID(ctx context.Context) string {
+	id, _ := ctx.Value(interceptIDKey{}).(string)
+	return id
+}
@@ -15,8 +15,8 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
 )
 
-// The idleDuration controls how long a dialer for a specific proto+from-to address combination remains alive without
-// reading or writing any messages. The dialer is normally closed by one of the peers.
+// The default TTLs control how long a dialer for a specific proto+from-to address combination remains alive without
+// reading or writing any messages. The dialer is normally closed by one of the peers. See Timeouts.
 const tcpConnTTL = 2 * time.Hour // Default tcp_keepalive_time on Linux
 const udpConnTTL = 1 * time.Minute
 const partlyClosedDuration = 5 * time.Second
@@ -35,6 +35,7 @@ type dialer struct {
 	idleTimer *time.Timer
 	idleLock  sync.Mutex
 	ttl       int64
+	keepAlive time.Duration
 	connected int32
 	done      chan struct{}
 }
@@ -42,17 +43,14 @@ type dialer struct {
 // NewDialer creates a new handler that dispatches messages in both directions between the given gRPC stream
 // and the given connection.
 //
-// The handler remains active until it's been idle for idleDuration, at which time it will automatically close
-// and call the release function it got from the tunnel.Pool to ensure that it gets properly released.
+// The handler remains active until it's been idle for the idle timeout of the Timeouts in the context that it's
+// started with, at which time it will automatically close and call the release function it got from the tunnel.Pool
+// to ensure that it gets properly released.
 func NewDialer(stream Stream) Endpoint {
 	return NewConnEndpoint(stream, nil)
 }
 
 func NewConnEndpoint(stream Stream, conn net.Conn) Endpoint {
-	ttl := tcpConnTTL
-	if stream.ID().Protocol() == ipproto.UDP {
-		ttl = udpConnTTL
-	}
 	state := notConnected
 	if conn != nil {
 		state = connecting
@@ -61,7 +59,6 @@ func NewConnEndpoint(stream Stream, conn net.Conn) Endpoint {
 		stream:    stream,
 		conn:      conn,
 		connected: state,
-		ttl:       int64(ttl),
 		done:      make(chan struct{}),
 	}
 }
@@ -71,13 +68,21 @@ func (h *dialer) Start(ctx context.Context) {
 		defer close(h.done)
 
 		id := h.stream.ID()
+		timeouts := GetTimeouts(ctx)
+		ttl := timeouts.TCPIdle
+		if id.Protocol() == ipproto.UDP {
+			ttl = timeouts.UDPIdle
+		}
+		atomic.StoreInt64(&h.ttl, int64(ttl))
+		h.keepAlive = timeouts.KeepAlive
+
 		switch h.connected {
 		case notConnected:
 			// Set up the idle timer to close and release this handler when it's been idle for a while.
 			h.connected = connecting
 
 			dlog.Debugf(ctx, "   CONN %s, dialing", id)
-			d := net.Dialer{Timeout: h.stream.DialTimeout()}
+			d := net.Dialer{Timeout: h.stream.DialTimeout(), KeepAlive: h.keepAlive}
 			conn, err := d.DialContext(ctx, id.ProtocolString(), id.DestinationAddr().String())
 			if err != nil {
 				dlog.Errorf(ctx, "!! CONN %s, failed to establish connection: %v", id, err)
@@ -93,6 +98,9 @@ func (h *dialer) Start(ctx context.Context) {
 				return
 			}
 			dlog.Debugf(ctx, "   CONN %s, dial answered", id)
+			if wrap := getConnWrapper(ctx); wrap != nil {
+				conn = wrap(ctx, id, getInterceptID(ctx), conn)
+			}
 			h.conn = conn
 
 		case connecting:
@@ -165,8 +173,12 @@ func (h *dialer) connToStreamLoop(ctx context.Context, wg *sync.WaitGroup) {
 	endLevel := dlog.LogLevelError
 	id := h.stream.ID()
 
+	// The capacity of the outgoing channel limits the number of messages, and hence the amount of memory,
+	// that is in flight. Reading from the connection stops when the stream can't keep up.
 	outgoing := make(chan Message, 5)
+	stopKeepAlive := h.startKeepAlive(ctx, outgoing)
 	defer func() {
+		stopKeepAlive()
 		if !h.resetIdle() {
 			// Hard close of peer. We don't want any more data
 			select {
@@ -181,11 +193,13 @@ func (h *dialer) connToStreamLoop(ctx context.Context, wg *sync.WaitGroup) {
 
 	WriteLoop(ctx, h.stream, outgoing)
 
-	buf := make([]byte, 0x100000)
 	dlog.Debugf(ctx, "   CONN %s conn-to-stream loop started", id)
 	for atomic.LoadInt32(&h.connected) == connected {
-		n, err := h.conn.Read(buf)
+		// Read straight into the payload of a pooled message. The WriteLoop releases it once it's been sent.
+		m := newPooledMessage(Normal, maxReadSize)
+		n, err := h.conn.Read(m.Payload())
 		if err != nil {
+			m.release()
 			switch {
 			case errors.Is(err, io.EOF):
 				endReason = "EOF was encountered"
@@ -203,16 +217,55 @@ func (h *dialer) connToStreamLoop(ctx context.Context, wg *sync.WaitGroup) {
 		dlog.Tracef(ctx, "<- CONN %s, len %d", id, n)
 		switch {
 		case !h.resetIdle():
+			m.release()
 			endReason = "it was idle for too long"
 			return
 		case n > 0:
+			m.truncate(n)
 			select {
 			case <-ctx.Done():
+				m.release()
 				endReason = ctx.Err().Error()
 				return
-			case outgoing <- NewMessage(Normal, buf[:n]):
+			case outgoing <- m:
+			}
+		default:
+			m.release()
+		}
+	}
+}
+
+// startKeepAlive starts sending KeepAlive messages to the given outgoing channel at the keepAlive interval, so
+// that the peer doesn't close a connection that is idle but alive. The returned function stops the sending, and
+// must be called before the channel is closed.
+func (h *dialer) startKeepAlive(ctx context.Context, outgoing chan<- Message) func() {
+	if h.keepAlive <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(h.keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				select {
+				case outgoing <- NewMessage(KeepAlive, nil):
+				default:
+					// The stream is busy, so the peer knows that we're alive anyway
+				}
 			}
 		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
 	}
 }
 
@@ -254,20 +307,48 @@ func (h *dialer) streamToConnLoop(ctx context.Context, wg *sync.WaitGroup) {
 				h.handleControl(ctx, dg)
 				continue
 			}
-			payload := dg.Payload()
-			pn := len(payload)
-			for n := 0; n < pn; {
-				wn, err := h.conn.Write(payload[n:])
-				if err != nil {
-					h.startDisconnect(ctx)
-					endReason = fmt.Sprintf("a write error occurred: %v", err)
-					return
-				}
-				dlog.Tracef(ctx, "-> CONN %s, len %d", id, wn)
-				n += wn
+
+			// Write the payloads of all messages that are already waiting using one vectored write
+			bufs, ctrl := collectPayloads(dg, incoming)
+			wn, err := bufs.WriteTo(h.conn)
+			if err != nil {
+				h.startDisconnect(ctx)
+				endReason = fmt.Sprintf("a write error occurred: %v", err)
+				return
 			}
+			dlog.Tracef(ctx, "-> CONN %s, len %d", id, wn)
+			if ctrl != nil {
+				h.handleControl(ctx, ctrl)
+			}
+		}
+	}
+}
+
+// maxWriteBatch is the maximum number of messages that collectPayloads collects for one vectored write.
+const maxWriteBatch = 16
+
+// collectPayloads returns the payload of the given Normal message together with the payloads of the Normal
+// messages that are immediately available from the incoming channel. Collecting stops at the first control
+// message, which is then returned so that it can be handled after the payloads have been written.
+func collectPayloads(first Message, incoming <-chan Message) (net.Buffers, Message) {
+	bufs := net.Buffers{first.Payload()}
+	for len(bufs) < maxWriteBatch {
+		select {
+		case m := <-incoming:
+			switch {
+			case m == nil:
+				// The channel is closed. The caller will discover that on its next receive
+				return bufs, nil
+			case m.Code() != Normal:
+				return bufs, m
+			default:
+				bufs = append(bufs, m.Payload())
+			}
+		default:
+			return bufs, nil
 		}
 	}
+	return bufs, nil
 }
 
 func (h *dialer) resetIdle() bool {
@@ -283,7 +364,17 @@ func (h *dialer) resetIdle() bool {
 // DialWaitLoop reads from the given dialStream. A new goroutine that creates a Tunnel to the manager and then
 // attaches a dialer Endpoint to that tunnel is spawned for each request that arrives. The method blocks until
 // the dialStream is closed.
-func DialWaitLoop(ctx context.Context, manager rpc.ManagerClient, dialStream rpc.Manager_WatchDialClient, sessionID string) {
+//
+// The interceptKey function returns the key of an intercept with end-to-end encryption, derived from the given
+// public key of the traffic-agent. It is used when a request has an agent public key, and may be nil when no such
+// requests are expected.
+func DialWaitLoop(
+	ctx context.Context,
+	manager rpc.ManagerClient,
+	dialStream rpc.Manager_WatchDialClient,
+	sessionID string,
+	interceptKey func(interceptID string, agentPublicKey []byte) []byte,
+) {
 	for ctx.Err() == nil {
 		dr, err := dialStream.Recv()
 		if err != nil {
@@ -292,13 +383,13 @@ func DialWaitLoop(ctx context.Context, manager rpc.ManagerClient, dialStream rpc
 			}
 			return
 		}
-		go dialRespond(ctx, manager, dr, sessionID)
+		go dialRespond(ctx, manager, dr, sessionID, interceptKey)
 	}
 }
 
-func dialRespond(ctx context.Context, manager rpc.ManagerClient, dr *rpc.DialRequest, sessionID string) {
+func dialRespond(ctx context.Context, manager rpc.ManagerClient, dr *rpc.DialRequest, sessionID string, interceptKey func(string, []byte) []byte) {
 	id := ConnID(dr.ConnId)
-	mt, err := manager.Tunnel(ctx)
+	mt, err := manager.Tunnel(ctx, CompressionCallOptions(dr.Compression)...)
 	if err != nil {
 		dlog.Errorf(ctx, "!! CONN %s, call to manager Tunnel failed: %v", id, err)
 		return
@@ -308,6 +399,27 @@ func dialRespond(ctx context.Context, manager rpc.ManagerClient, dr *rpc.DialReq
 		dlog.Error(ctx, err)
 		return
 	}
+	if len(dr.AgentPublicKey) > 0 {
+		var key []byte
+		if interceptKey != nil {
+			key = interceptKey(dr.InterceptId, dr.AgentPublicKey)
+		}
+		if key == nil {
+			dlog.Errorf(ctx, "!! CONN %s, no encryption key found for intercept %s", id, dr.InterceptId)
+			if err = s.Send(ctx, NewMessage(DialReject, nil)); err != nil {
+				dlog.Errorf(ctx, "!! CONN %s, failed to send DialReject: %v", id, err)
+			}
+			_ = s.CloseSend(ctx)
+			return
+		}
+		if s, err = NewEncryptedStream(s, key, false); err != nil {
+			dlog.Error(ctx, err)
+			return
+		}
+	}
+	if dr.InterceptId != "" {
+		ctx = withInterceptID(ctx, dr.InterceptId)
+	}
 	d := NewDialer(s)
 	d.Start(ctx)
 	<-d.Done()
@@ -0,0 +1,51 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+func TestGetTimeouts(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, Timeouts{TCPIdle: tcpConnTTL, UDPIdle: udpConnTTL}, GetTimeouts(ctx))
+
+	ctx = WithTimeouts(ctx, Timeouts{TCPIdle: 10 * time.Hour, KeepAlive: -1})
+	assert.Equal(t, Timeouts{TCPIdle: 10 * time.Hour, UDPIdle: udpConnTTL}, GetTimeouts(ctx))
+}
+
+func TestDialer_keepAlive(t *testing.T) {
+	ctx, cancel := testContext(t, 30*time.Second)
+	defer cancel()
+
+	id := NewConnID(ipproto.TCP, iputil.Parse("127.0.0.1"), iputil.Parse("192.168.0.1"), 1001, 8080)
+	tunnel := newBidi(10, ctx.Done())
+	conn, appConn := net.Pipe()
+	defer appConn.Close()
+
+	go func() {
+		client, err := NewClientStream(ctx, tunnel.clientSide(), id, uuid.New().String(), 0, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		NewConnEndpoint(client, conn).Start(WithTimeouts(ctx, Timeouts{KeepAlive: 10 * time.Millisecond}))
+	}()
+	server, err := NewServerStream(ctx, tunnel.serverSide())
+	require.NoError(t, err)
+
+	// The connection is idle, so the dialer sends nothing but KeepAlive messages
+	for i := 0; i < 3; i++ {
+		m, err := server.Receive(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, KeepAlive, m.Code())
+	}
+}
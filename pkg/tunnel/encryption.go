@@ -0,0 +1,160 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeySize is the size of the private and public keys used when negotiating the key of an intercept
+// with end-to-end encryption.
+const KeySize = curve25519.ScalarSize
+
+// GenerateKeyPair returns a new X25519 private key and its public key.
+func GenerateKeyPair() (private, public []byte, err error) {
+	private = make([]byte, KeySize)
+	if _, err = io.ReadFull(rand.Reader, private); err != nil {
+		return nil, nil, err
+	}
+	if public, err = curve25519.X25519(private, curve25519.Basepoint); err != nil {
+		return nil, nil, err
+	}
+	return private, public, nil
+}
+
+// InterceptKey derives the key that encrypts the payloads of the intercept with the given ID from
+// a private key and the public key of the peer. The client and the traffic-agent derive the same key
+// from their own private key and the public key of the other side.
+func InterceptKey(private, peerPublic []byte, interceptID string) ([]byte, error) {
+	secret, err := curve25519.X25519(private, peerPublic)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte("telepresence intercept "+interceptID)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ExchangePublicKeys sends the given public key on the given connection and returns the public key that the
+// peer responds with. The traffic-agents accept such exchanges on install.AgentKeyExchangePort.
+func ExchangePublicKeys(conn net.Conn, public []byte) ([]byte, error) {
+	if _, err := conn.Write(public); err != nil {
+		return nil, err
+	}
+	peerPublic := make([]byte, KeySize)
+	if _, err := io.ReadFull(conn, peerPublic); err != nil {
+		return nil, err
+	}
+	return peerPublic, nil
+}
+
+var errDecrypt = errors.New("unable to decrypt message")
+
+type encryptedStream struct {
+	Stream
+	aead cipher.AEAD
+
+	// sendDir and recvDir identify the direction of the messages that are sent and received. They are part of
+	// the additional data of each message, so that a message can't be reflected back to its sender.
+	sendDir byte
+	recvDir byte
+
+	// sendLock serializes the sending of Normal messages, so that they're sent in the order of their
+	// sequence numbers.
+	sendLock sync.Mutex
+	sendSeq  uint64
+	recvSeq  uint64
+}
+
+// NewEncryptedStream returns a Stream that encrypts the payload of the Normal messages that are
+// sent on the given stream, and decrypts the ones that are received, using AES-256-GCM with the
+// given key. Control messages are passed on unchanged. The initiator is true for the side that
+// created the stream, and false for the side that accepted it.
+//
+// The ID of the stream, the direction of the message, and the message's sequence number within that
+// direction, are bound to each message as additional data, so a message that is replayed, reordered,
+// dropped, or moved to another stream or direction fails to decrypt.
+func NewEncryptedStream(s Stream, key []byte, initiator bool) (Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	es := &encryptedStream{Stream: s, aead: aead, sendDir: 'a', recvDir: 'i'}
+	if initiator {
+		es.sendDir, es.recvDir = es.recvDir, es.sendDir
+	}
+	return es, nil
+}
+
+// additionalData returns the additional data of the message with the given direction and sequence number.
+func (s *encryptedStream) additionalData(dir byte, seq uint64) []byte {
+	id := s.ID()
+	ad := make([]byte, len(id)+9)
+	n := copy(ad, id)
+	ad[n] = dir
+	binary.BigEndian.PutUint64(ad[n+1:], seq)
+	return ad
+}
+
+func (s *encryptedStream) Send(ctx context.Context, m Message) error {
+	if m.Code() != Normal {
+		return s.Stream.Send(ctx, m)
+	}
+	pl := m.Payload()
+	ns := s.aead.NonceSize()
+	var em Message
+	if el := ns + len(pl) + s.aead.Overhead(); fitsPooledMessage(el) {
+		pm := newPooledMessage(Normal, el)
+		defer pm.release()
+		em = pm
+	} else {
+		em = makeMessage(Normal, el)
+	}
+	nonce := em.Payload()[:ns]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+	s.aead.Seal(nonce[ns:ns], nonce, pl, s.additionalData(s.sendDir, s.sendSeq))
+	s.sendSeq++
+	return s.Stream.Send(ctx, em)
+}
+
+func (s *encryptedStream) Receive(ctx context.Context) (Message, error) {
+	m, err := s.Stream.Receive(ctx)
+	if err != nil || m.Code() != Normal {
+		return m, err
+	}
+	pl := m.Payload()
+	ns := s.aead.NonceSize()
+	if len(pl) < ns {
+		return nil, fmt.Errorf("%w: message too short", errDecrypt)
+	}
+	// Decrypt in place, and then reuse the last byte of the nonce as the code of the plaintext message.
+	pt, err := s.aead.Open(pl[ns:ns], pl[:ns], pl[ns:], s.additionalData(s.recvDir, s.recvSeq))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDecrypt, err)
+	}
+	s.recvSeq++
+	dm := msg(pl[ns-1 : ns+len(pt)])
+	dm[0] = byte(Normal)
+	return dm, nil
+}
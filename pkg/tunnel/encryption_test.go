@@ -0,0 +1,214 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+func TestInterceptKey(t *testing.T) {
+	clientPriv, clientPub, err := GenerateKeyPair()
+	require.NoError(t, err)
+	agentPriv, agentPub, err := GenerateKeyPair()
+	require.NoError(t, err)
+
+	clientKey, err := InterceptKey(clientPriv, agentPub, "intercept-1")
+	require.NoError(t, err)
+	agentKey, err := InterceptKey(agentPriv, clientPub, "intercept-1")
+	require.NoError(t, err)
+	assert.Equal(t, clientKey, agentKey)
+	assert.Len(t, clientKey, 32)
+
+	otherKey, err := InterceptKey(clientPriv, agentPub, "intercept-2")
+	require.NoError(t, err)
+	assert.NotEqual(t, clientKey, otherKey)
+}
+
+func TestInterceptSessionMessage(t *testing.T) {
+	_, pub, err := GenerateKeyPair()
+	require.NoError(t, err)
+	m := InterceptSessionMessage("session-1", "intercept-1", pub)
+	assert.Equal(t, InterceptSession, m.Code())
+	sessionID, interceptID, publicKey, err := GetInterceptSession(m)
+	require.NoError(t, err)
+	assert.Equal(t, "session-1", sessionID)
+	assert.Equal(t, "intercept-1", interceptID)
+	assert.Equal(t, pub, publicKey)
+
+	_, _, _, err = GetInterceptSession(NewMessage(InterceptSession, []byte{0x20, 'x'}))
+	assert.Error(t, err)
+	_, _, _, err = GetInterceptSession(InterceptSessionMessage("session-1", "intercept-1", pub[:KeySize-1]))
+	assert.Error(t, err)
+
+	// An intercept without encryption has no public key
+	sessionID, interceptID, publicKey, err = GetInterceptSession(InterceptSessionMessage("session-1", "intercept-1", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "session-1", sessionID)
+	assert.Equal(t, "intercept-1", interceptID)
+	assert.Empty(t, publicKey)
+}
+
+func TestEncryptedStream_Xfer(t *testing.T) {
+	ctx, cancel := testContext(t, 30*time.Second)
+	defer cancel()
+
+	id := NewConnID(ipproto.TCP, iputil.Parse("127.0.0.1"), iputil.Parse("192.168.0.1"), 1001, 8080)
+	si := uuid.New().String()
+	b := make([]byte, 0x1000)
+	for i := range b {
+		b[i] = byte(i & 0xff)
+	}
+	large := NewMessage(Normal, b)
+	key := bytes.Repeat([]byte{0x42}, 32)
+	errs := make(chan error, 10)
+
+	t.Run("encrypted both ends", func(t *testing.T) {
+		tunnel := newBidi(10, ctx.Done())
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			client, err := NewClientStream(ctx, tunnel.clientSide(), id, si, 0, 0)
+			if err == nil {
+				client, err = NewEncryptedStream(client, key, true)
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			produce(ctx, client, large, errs)
+		}()
+		go func() {
+			defer wg.Done()
+			server, err := NewServerStream(ctx, tunnel.serverSide())
+			if err == nil {
+				server, err = NewEncryptedStream(server, key, false)
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			consume(ctx, server, b, errs)
+		}()
+		wg.Wait()
+		errs = requireNoErrs(t, errs)
+	})
+
+	t.Run("ciphertext in transit", func(t *testing.T) {
+		tunnel := newBidi(10, ctx.Done())
+		go func() {
+			client, err := NewClientStream(ctx, tunnel.clientSide(), id, si, 0, 0)
+			if err == nil {
+				client, err = NewEncryptedStream(client, key, true)
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err = client.Send(ctx, large); err != nil {
+				errs <- err
+			}
+		}()
+		server, err := NewServerStream(ctx, tunnel.serverSide())
+		require.NoError(t, err)
+		m, err := server.Receive(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, Normal, m.Code())
+		assert.NotContains(t, string(m.Payload()), string(b[:64]))
+
+		wrongKey, err := NewEncryptedStream(&messageStream{Stream: server, m: m}, bytes.Repeat([]byte{0x43}, 32), false)
+		require.NoError(t, err)
+		_, err = wrongKey.Receive(ctx)
+		assert.ErrorIs(t, err, errDecrypt)
+		errs = requireNoErrs(t, errs)
+	})
+}
+
+// messageStream is a Stream that returns a given message when it is received.
+type messageStream struct {
+	Stream
+	m Message
+}
+
+func (s *messageStream) Receive(_ context.Context) (Message, error) {
+	return s.m, nil
+}
+
+// queueStream is a Stream that keeps copies of the messages that are sent to it, and that returns the
+// messages in its queue when receiving.
+type queueStream struct {
+	Stream
+	id    ConnID
+	sent  []Message
+	queue []Message
+}
+
+func (s *queueStream) ID() ConnID {
+	return s.id
+}
+
+func (s *queueStream) Send(_ context.Context, m Message) error {
+	s.sent = append(s.sent, NewMessage(m.Code(), append([]byte(nil), m.Payload()...)))
+	return nil
+}
+
+func (s *queueStream) Receive(_ context.Context) (Message, error) {
+	m := s.queue[0]
+	s.queue = s.queue[1:]
+	return NewMessage(m.Code(), append([]byte(nil), m.Payload()...)), nil
+}
+
+func TestEncryptedStream_Sequence(t *testing.T) {
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{0x42}, 32)
+	id := NewConnID(ipproto.TCP, iputil.Parse("127.0.0.1"), iputil.Parse("192.168.0.1"), 1001, 8080)
+	otherID := NewConnID(ipproto.TCP, iputil.Parse("127.0.0.1"), iputil.Parse("192.168.0.1"), 1002, 8080)
+
+	qs := &queueStream{id: id}
+	sender, err := NewEncryptedStream(qs, key, true)
+	require.NoError(t, err)
+	require.NoError(t, sender.Send(ctx, NewMessage(Normal, []byte("one"))))
+	require.NoError(t, sender.Send(ctx, NewMessage(Normal, []byte("two"))))
+	one, two := qs.sent[0], qs.sent[1]
+
+	receive := func(id ConnID, initiator bool, ms ...Message) (got []string, err error) {
+		r, err := NewEncryptedStream(&queueStream{id: id, queue: ms}, key, initiator)
+		require.NoError(t, err)
+		for range ms {
+			var m Message
+			if m, err = r.Receive(ctx); err != nil {
+				return got, err
+			}
+			got = append(got, string(m.Payload()))
+		}
+		return got, nil
+	}
+
+	got, err := receive(id, false, one, two)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "two"}, got)
+
+	// Reordered, replayed, and dropped messages are rejected
+	_, err = receive(id, false, two, one)
+	assert.ErrorIs(t, err, errDecrypt)
+	got, err = receive(id, false, one, one)
+	assert.ErrorIs(t, err, errDecrypt)
+	assert.Equal(t, []string{"one"}, got)
+	_, err = receive(id, false, two)
+	assert.ErrorIs(t, err, errDecrypt)
+
+	// So are messages that are moved to another stream, or reflected back to the sender
+	_, err = receive(otherID, false, one)
+	assert.ErrorIs(t, err, errDecrypt)
+	_, err = receive(id, true, one)
+	assert.ErrorIs(t, err, errDecrypt)
+}
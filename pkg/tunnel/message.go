@@ -22,6 +22,7 @@ const (
 	Disconnect
 	KeepAlive
 	Session
+	InterceptSession
 )
 
 func (c MessageCode) String() string {
@@ -42,6 +43,8 @@ func (c MessageCode) String() string {
 		return "KEEP_ALIVE"
 	case Session:
 		return "SESSION"
+	case InterceptSession:
+		return "INTERCEPT_SESSION"
 	default:
 		return fmt.Sprintf("** unknown control code: %d **", c)
 	}
@@ -124,6 +127,50 @@ func GetSession(m Message) string {
 	return string(m.Payload())
 }
 
+// InterceptSessionMessage is sent by a traffic-agent instead of a SessionMessage when the stream
+// belongs to an intercept. It carries the ID of the intercept and, when the intercept uses end-to-end
+// encryption, the public key of the agent that the client must use when deriving the key of the stream.
+// The publicKey is empty when the intercept isn't encrypted.
+func InterceptSessionMessage(sessionID, interceptID string, publicKey []byte) Message {
+	b := bytes.Buffer{}
+	b.WriteByte(byte(InterceptSession))
+
+	buf := make([]byte, 8)
+	for _, s := range []string{sessionID, interceptID} {
+		n := binary.PutUvarint(buf, uint64(len(s)))
+		b.Write(buf[:n])
+		b.WriteString(s)
+	}
+	b.Write(publicKey)
+	return msg(b.Bytes())
+}
+
+var errMalformedInterceptSession = errors.New("malformed InterceptSession message")
+
+// GetInterceptSession returns the session ID, intercept ID, and public key of a message created by
+// InterceptSessionMessage. The public key is empty when the intercept isn't encrypted.
+func GetInterceptSession(m Message) (sessionID, interceptID string, publicKey []byte, err error) {
+	pl := m.Payload()
+	var ss [2]string
+	for i := range ss {
+		v, n := binary.Uvarint(pl)
+		if n <= 0 || v > uint64(len(pl)-n) {
+			return "", "", nil, errMalformedInterceptSession
+		}
+		pl = pl[n:]
+		ss[i] = string(pl[:v])
+		pl = pl[v:]
+	}
+	switch len(pl) {
+	case 0:
+		return ss[0], ss[1], nil, nil
+	case KeySize:
+		return ss[0], ss[1], pl, nil
+	default:
+		return "", "", nil, errMalformedInterceptSession
+	}
+}
+
 func makeMessage(code MessageCode, payloadLength int) msg {
 	m := make(msg, 1+payloadLength)
 	m[0] = byte(code)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/datawire/dlib/dlog"
@@ -24,10 +25,19 @@ type RecursionBlocker interface {
 // The error returned when recursion is encountered
 var errRecursion = errors.New("connection recursion")
 
+// ErrPoolFull is returned when a handler cannot be created because the pool has reached its maximum size.
+var ErrPoolFull = errors.New("maximum number of connections reached")
+
 type Pool struct {
 	handlers map[ConnID]Handler
 	blockers map[ip.AddrKey]RecursionBlocker
 
+	// maxHandlers is the maximum number of handlers in the pool, or zero when unlimited
+	maxHandlers int
+
+	// rejected counts the attempts to create a handler that failed with ErrPoolFull
+	rejected int64
+
 	lock sync.RWMutex
 }
 
@@ -39,7 +49,36 @@ type Handler interface {
 }
 
 func NewPool() *Pool {
-	return &Pool{handlers: make(map[ConnID]Handler), blockers: make(map[ip.AddrKey]RecursionBlocker)}
+	return NewBoundedPool(0)
+}
+
+// NewBoundedPool returns a pool that holds at most maxHandlers handlers. Attempts to create more handlers
+// fail with ErrPoolFull until other handlers are released. A maxHandlers of zero means no limit.
+func NewBoundedPool(maxHandlers int) *Pool {
+	return &Pool{
+		handlers:    make(map[ConnID]Handler),
+		blockers:    make(map[ip.AddrKey]RecursionBlocker),
+		maxHandlers: maxHandlers,
+	}
+}
+
+// Stats returns the number of handlers in the pool, the maximum number of handlers, and the number of
+// attempts to create a handler that were rejected because the pool was full.
+func (p *Pool) Stats() (count, maxHandlers int, rejected int64) {
+	p.lock.RLock()
+	count = len(p.handlers)
+	p.lock.RUnlock()
+	return count, p.maxHandlers, atomic.LoadInt64(&p.rejected)
+}
+
+// full returns true if the pool has reached its maximum size and counts the rejection. It must be called
+// with the lock held.
+func (p *Pool) full() bool {
+	if p.maxHandlers > 0 && len(p.handlers) >= p.maxHandlers {
+		atomic.AddInt64(&p.rejected, 1)
+		return true
+	}
+	return false
 }
 
 func (p *Pool) release(ctx context.Context, id ConnID) {
@@ -86,11 +125,15 @@ func (p *Pool) Get(id ConnID) Handler {
 func (p *Pool) GetOrCreate(ctx context.Context, id ConnID, createHandler HandlerCreator) (Handler, bool, error) {
 	p.lock.RLock()
 	handler, ok := p.handlers[id]
+	full := !ok && p.full()
 	p.lock.RUnlock()
 
 	if ok {
 		return handler, true, nil
 	}
+	if full {
+		return nil, false, ErrPoolFull
+	}
 
 	handlerCtx, cancel := context.WithCancel(ctx)
 	release := func() {
@@ -110,6 +153,11 @@ func (p *Pool) GetOrCreate(ctx context.Context, id ConnID, createHandler Handler
 	p.lock.Lock()
 	var old Handler
 	if old, ok = p.handlers[id]; !ok {
+		if p.full() {
+			p.lock.Unlock()
+			cancel()
+			return nil, false, ErrPoolFull
+		}
 		p.handlers[id] = handler
 	}
 	count := len(p.handlers)
@@ -132,14 +180,19 @@ func (p *Pool) GetOrCreateTCP(ctx context.Context, id ConnID, createHandler Hand
 	var blocker RecursionBlocker
 	p.lock.RLock()
 	handler, ok := p.handlers[id]
+	full := false
 	if !ok {
 		blocker = p.blockers[ip.MakeAddrKey(id.Destination(), id.DestinationPort())]
+		full = p.full()
 	}
 	p.lock.RUnlock()
 
 	if ok {
 		return handler, true, nil
 	}
+	if full {
+		return nil, false, ErrPoolFull
+	}
 
 	if blocker != nil {
 		<-blocker.InitDone()
@@ -170,6 +223,11 @@ func (p *Pool) GetOrCreateTCP(ctx context.Context, id ConnID, createHandler Hand
 	p.lock.Lock()
 	var old Handler
 	if old, ok = p.handlers[id]; !ok {
+		if p.full() {
+			p.lock.Unlock()
+			cancel()
+			return nil, false, ErrPoolFull
+		}
 		p.handlers[id] = handler
 		var isBlocker bool
 		if blocker, isBlocker = handler.(RecursionBlocker); isBlocker {
@@ -0,0 +1,59 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
+)
+
+type nopHandler struct {
+	release func()
+}
+
+func (h *nopHandler) Close(context.Context) {
+	h.release()
+}
+
+func (h *nopHandler) Start(context.Context) {}
+
+func TestBoundedPool(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	pool := NewBoundedPool(2)
+	create := func(ctx context.Context, release func()) (Handler, error) {
+		return &nopHandler{release: release}, nil
+	}
+	connID := func(port uint16) ConnID {
+		return NewConnID(ipproto.UDP, net.IP{127, 0, 0, 1}, net.IP{10, 0, 0, 1}, port, 53)
+	}
+
+	h1, found, err := pool.GetOrCreate(ctx, connID(1001), create)
+	require.NoError(t, err)
+	assert.False(t, found)
+	_, _, err = pool.GetOrCreate(ctx, connID(1002), create)
+	require.NoError(t, err)
+
+	// Existing handlers are still found when the pool is full
+	h, found, err := pool.GetOrCreate(ctx, connID(1001), create)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, h1, h)
+
+	_, _, err = pool.GetOrCreate(ctx, connID(1003), create)
+	assert.ErrorIs(t, err, ErrPoolFull)
+	count, maxHandlers, rejected := pool.Stats()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 2, maxHandlers)
+	assert.Equal(t, int64(1), rejected)
+
+	// Releasing a handler makes room for a new one
+	h1.Close(ctx)
+	_, found, err = pool.GetOrCreate(ctx, connID(1003), create)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
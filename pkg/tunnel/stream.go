@@ -94,8 +94,8 @@ func ReadLoop(ctx context.Context, s Stream) (<-chan Message, <-chan error) {
 	return msgCh, errCh
 }
 
-// WriteLoop reads messages from the channel and writes them to the Stream. It will call CloseSend() on the
-// stream when the channel is closed.
+// WriteLoop reads messages from the channel and writes them to the Stream. Each message is released using
+// ReleaseMessage once it has been sent. It will call CloseSend() on the stream when the channel is closed.
 func WriteLoop(ctx context.Context, s Stream, msgCh <-chan Message) {
 	dlog.Debugf(ctx, "   %s %s, WriteLoop starting", s.Tag(), s.ID())
 	go func() {
@@ -113,7 +113,9 @@ func WriteLoop(ctx context.Context, s Stream, msgCh <-chan Message) {
 				if m == nil {
 					return
 				}
-				if err := s.Send(ctx, m); err != nil {
+				err := s.Send(ctx, m)
+				ReleaseMessage(m)
+				if err != nil {
 					if !errors.Is(err, net.ErrClosed) {
 						dlog.Errorf(ctx, "!! %s %s, Send failed: %v", s.Tag(), s.ID(), err)
 					}
@@ -54,6 +54,8 @@ func (t *uni) recv() (*manager.TunnelMessage, error) {
 }
 
 func (t *uni) send(msg *manager.TunnelMessage) error {
+	// Like gRPC, serialize the message before Send returns. The buffer of the message may be reused after that.
+	msg = &manager.TunnelMessage{Payload: append([]byte(nil), msg.Payload...)}
 	select {
 	case <-t.done:
 		return context.Canceled
@@ -0,0 +1,48 @@
+package buffer
+
+import "sync/atomic"
+
+// Budget limits the total number of bytes held by packets that are queued for processing. A nil Budget,
+// or one with a zero limit, is unlimited, but still counts the bytes in use.
+type Budget struct {
+	limit   int64
+	used    int64
+	dropped int64
+}
+
+// NewBudget returns a Budget that limits the total number of queued bytes to the given limit.
+func NewBudget(limit int64) *Budget {
+	return &Budget{limit: limit}
+}
+
+// Acquire reserves n bytes and returns true, or counts a dropped packet and returns false if the
+// reservation would exceed the limit. Each successful Acquire must be followed by a Release of the
+// same size.
+func (b *Budget) Acquire(n int) bool {
+	if b == nil {
+		return true
+	}
+	used := atomic.AddInt64(&b.used, int64(n))
+	if b.limit > 0 && used > b.limit {
+		atomic.AddInt64(&b.used, -int64(n))
+		atomic.AddInt64(&b.dropped, 1)
+		return false
+	}
+	return true
+}
+
+// Release releases n bytes that were reserved using Acquire.
+func (b *Budget) Release(n int) {
+	if b != nil {
+		atomic.AddInt64(&b.used, -int64(n))
+	}
+}
+
+// Stats returns the number of bytes in use, the limit, and the number of packets that were dropped
+// because the limit was reached.
+func (b *Budget) Stats() (used, limit, dropped int64) {
+	if b == nil {
+		return 0, 0, 0
+	}
+	return atomic.LoadInt64(&b.used), b.limit, atomic.LoadInt64(&b.dropped)
+}
@@ -0,0 +1,29 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(1000)
+	assert.True(t, b.Acquire(600))
+	assert.True(t, b.Acquire(400))
+	assert.False(t, b.Acquire(1))
+	b.Release(400)
+	assert.True(t, b.Acquire(300))
+	used, limit, dropped := b.Stats()
+	assert.Equal(t, int64(900), used)
+	assert.Equal(t, int64(1000), limit)
+	assert.Equal(t, int64(1), dropped)
+
+	var unlimited *Budget
+	assert.True(t, unlimited.Acquire(1<<30))
+	unlimited.Release(1 << 30)
+
+	b = NewBudget(0)
+	assert.True(t, b.Acquire(1<<30))
+	used, _, _ = b.Stats()
+	assert.Equal(t, int64(1<<30), used)
+}
@@ -26,6 +26,13 @@ func (t *Device) RemoveSubnet(ctx context.Context, subnet *net.IPNet) error {
 	return t.removeSubnet(ctx, subnet)
 }
 
+// SetRoutingTable makes the routes for the subnets and the static routes of this device go into the given
+// routing table instead of the main table, so that only traffic that a routing policy rule directs to that
+// table reaches the device. It must be called before any subnet or route is added. Only supported on Linux.
+func (t *Device) SetRoutingTable(table int) error {
+	return t.setRoutingTable(table)
+}
+
 // AddStaticRoute adds a specific route. This can be used to prevent certain IP addresses
 // from being routed to the TUN device.
 func (t *Device) AddStaticRoute(ctx context.Context, route routing.Route) error {
@@ -98,6 +98,10 @@ func (t *Device) removeStaticRoute(ctx context.Context, route routing.Route) err
 	})
 }
 
+func (t *Device) setRoutingTable(int) error {
+	return errors.New("routing tables are only supported on Linux")
+}
+
 func (t *Device) setMTU(mtu int) error {
 	return withSocket(unix.AF_INET, func(fd int) error {
 		var ifr unix.IfreqMTU
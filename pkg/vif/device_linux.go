@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"runtime"
+	"strconv"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
@@ -21,6 +22,9 @@ type Device struct {
 	*os.File
 	name  string
 	index int32
+
+	// table is the routing table that routes are added to, or zero for the main table
+	table int
 }
 
 func openTun(_ context.Context) (*Device, error) {
@@ -92,20 +96,83 @@ func openTun(_ context.Context) (*Device, error) {
 	return &Device{File: os.NewFile(uintptr(fd), devicePath), name: name, index: index}, nil
 }
 
+func (t *Device) setRoutingTable(table int) error {
+	t.table = table
+	return nil
+}
+
+// tableArgs returns the arguments that direct an "ip route" command to the routing table of the device.
+func (t *Device) tableArgs() []string {
+	if t.table == 0 {
+		return nil
+	}
+	return []string{"table", strconv.Itoa(t.table)}
+}
+
 func (t *Device) addSubnet(ctx context.Context, subnet *net.IPNet) error {
-	return dexec.CommandContext(ctx, "ip", "a", "add", subnet.String(), "dev", t.name).Run()
+	var args []string
+	if subnet.IP.To4() != nil {
+		args = []string{"a", "add", subnet.String(), "dev", t.name}
+	} else {
+		if err := t.enableIPv6(); err != nil {
+			return err
+		}
+		// Duplicate address detection is pointless on a TUN device and would delay the address from
+		// becoming usable.
+		args = []string{"-6", "a", "add", ipv6Addr(subnet), "dev", t.name, "nodad"}
+	}
+	if t.table == 0 {
+		return dexec.CommandContext(ctx, "ip", args...).Run()
+	}
+
+	// The route that the kernel adds for the address would end up in the main table, so it's
+	// added explicitly to the routing table of the device instead.
+	if err := dexec.CommandContext(ctx, "ip", append(args, "noprefixroute")...).Run(); err != nil {
+		return err
+	}
+	return dexec.CommandContext(ctx, "ip", append([]string{"route", "add", subnet.String(), "dev", t.name}, t.tableArgs()...)...).Run()
 }
 
 func (t *Device) removeSubnet(ctx context.Context, subnet *net.IPNet) error {
-	return dexec.CommandContext(ctx, "ip", "a", "del", subnet.String(), "dev", t.name).Run()
+	if t.table != 0 {
+		_ = dexec.CommandContext(ctx, "ip", append([]string{"route", "del", subnet.String(), "dev", t.name}, t.tableArgs()...)...).Run()
+	}
+	if subnet.IP.To4() != nil {
+		return dexec.CommandContext(ctx, "ip", "a", "del", subnet.String(), "dev", t.name).Run()
+	}
+	return dexec.CommandContext(ctx, "ip", "-6", "a", "del", ipv6Addr(subnet), "dev", t.name).Run()
+}
+
+// ipv6Addr returns the first host address of the given subnet in CIDR notation. The subnet address
+// itself is the subnet-router anycast address in IPv6 and can't be used for the device.
+func ipv6Addr(subnet *net.IPNet) string {
+	to := make(net.IP, len(subnet.IP))
+	copy(to, subnet.IP)
+	to[len(to)-1] = 1
+	return (&net.IPNet{IP: to, Mask: subnet.Mask}).String()
+}
+
+// enableIPv6 ensures that IPv6 isn't disabled on the device. Newly created devices inherit the
+// setting of net.ipv6.conf.default.disable_ipv6.
+func (t *Device) enableIPv6() error {
+	p := fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/disable_ipv6", t.name)
+	if _, err := os.Stat(p); err != nil {
+		return fmt.Errorf("IPv6 is not available on this host: %w", err)
+	}
+	if err := os.WriteFile(p, []byte("0"), 0644); err != nil {
+		return fmt.Errorf("failed to enable IPv6 on %s: %w", t.name, err)
+	}
+	return nil
 }
 
 func (t *Device) addStaticRoute(ctx context.Context, route routing.Route) error {
-	return dexec.CommandContext(ctx, "ip", "route", "add", route.RoutedNet.String(), "via", route.Gateway.String(), "dev", route.Interface.Name).Run()
+	args := []string{"route", "add", route.RoutedNet.String(), "via", route.Gateway.String(), "dev", route.Interface.Name}
+	return dexec.CommandContext(ctx, "ip", append(args, t.tableArgs()...)...).Run()
 }
 
 func (t *Device) removeStaticRoute(ctx context.Context, route routing.Route) error {
-	return dexec.CommandContext(ctx, "ip", "route", "del", route.RoutedNet.String(), "via", route.Gateway.String(), "dev", route.Interface.Name).Run()
+	args := []string{"route", "del", route.RoutedNet.String(), "via", route.Gateway.String(), "dev", route.Interface.Name}
+	return dexec.CommandContext(ctx, "ip", append(args, t.tableArgs()...)...).Run()
 }
 
 // Index returns the index of this device
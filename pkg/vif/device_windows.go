@@ -193,6 +193,10 @@ func (t *Device) removeStaticRoute(ctx context.Context, route routing.Route) err
 	return nil
 }
 
+func (t *Device) setRoutingTable(int) error {
+	return errors.New("routing tables are only supported on Linux")
+}
+
 func (t *Device) setMTU(mtu int) error {
 	return errors.New("not implemented")
 }
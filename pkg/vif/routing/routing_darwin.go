@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"regexp"
+	"strings"
 
 	"golang.org/x/net/route"
 	"golang.org/x/sys/unix"
@@ -13,7 +14,9 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 )
 
-const findInterfaceRegex = "gateway:\\s+([0-9.]+)\\s+.*interface:\\s+([a-z0-9]+)"
+// findInterfaceRegex matches the output of "route -n get". An IPv6 link-local gateway will have a zone suffix
+// such as "%en0" which isn't included in the gateway IP.
+const findInterfaceRegex = "gateway:\\s+([0-9a-f.:]+)(?:%[a-z0-9]+)?\\s+.*interface:\\s+([a-z0-9]+)"
 
 var findInterfaceRe = regexp.MustCompile(findInterfaceRegex)
 
@@ -102,11 +105,16 @@ func GetRoutingTable(ctx context.Context) ([]Route, error) {
 
 func GetRoute(ctx context.Context, routedNet *net.IPNet) (Route, error) {
 	ip := routedNet.IP
-	cmd := dexec.CommandContext(ctx, "route", "-n", "get", ip.String())
+	args := []string{"-n", "get"}
+	if ip.To4() == nil {
+		args = append(args, "-inet6")
+	}
+	args = append(args, ip.String())
+	cmd := dexec.CommandContext(ctx, "route", args...)
 	cmd.DisableLogging = true
 	out, err := cmd.Output()
 	if err != nil {
-		return Route{}, fmt.Errorf("unable to run 'route -n get %s': %w", ip, err)
+		return Route{}, fmt.Errorf("unable to run 'route %s': %w", strings.Join(args, " "), err)
 	}
 	match := findInterfaceRe.FindStringSubmatch(string(out))
 	// This might fail because no "gateway" is listed. The problem is that without a gateway IP we can't
@@ -14,7 +14,9 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 )
 
-const findInterfaceRegex = "[0-9.]+( via (?P<gw>[0-9.]+))? dev (?P<dev>[a-z0-9]+) src (?P<src>[0-9.]+)"
+// findInterfaceRegex matches the output of "ip route get" for both IPv4 and IPv6 destinations. The latter
+// typically contains a "from ::" and a "proto" before the "src".
+const findInterfaceRegex = "[0-9a-f.:]+( from [0-9a-f.:]+)?( via (?P<gw>[0-9a-f.:]+))? dev (?P<dev>[a-z0-9]+)( proto [a-z0-9]+)? src (?P<src>[0-9a-f.:]+)"
 
 var (
 	findInterfaceRe = regexp.MustCompile(findInterfaceRegex)
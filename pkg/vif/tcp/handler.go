@@ -97,6 +97,10 @@ type handler struct {
 	// remove is the function that removes this instance from the pool
 	remove func()
 
+	// budget limits the memory used by the packets queued in fromTun and toMgrCh, for this
+	// and all other handlers
+	budget *buffer.Budget
+
 	// TUN I/O
 	toTun   ip.Writer
 	fromTun chan Packet
@@ -189,11 +193,13 @@ func NewHandler(
 	id tunnel.ConnID,
 	remove func(),
 	rndSource rand.Source,
+	budget *buffer.Budget,
 ) PacketHandler {
 	h := &handler{
 		streamCreator:     streamCreator,
 		id:                id,
 		remove:            remove,
+		budget:            budget,
 		toTun:             toTun,
 		dispatcherClosing: dispatcherClosing,
 		fromTun:           make(chan Packet, ioChannelSize),
@@ -214,15 +220,29 @@ func (h *handler) RandomSequence() int32 {
 }
 
 func (h *handler) HandlePacket(ctx context.Context, pkt Packet) {
+	sz := packetSize(pkt)
+	if !h.budget.Acquire(sz) {
+		// The peer will resend the packet since it isn't acked, which slows it down
+		dlog.Tracef(ctx, "!! TUN %s discarded because the packet buffer limit is reached", pkt)
+		pkt.Release()
+		return
+	}
 	select {
 	case <-ctx.Done():
+		h.budget.Release(sz)
 		dlog.Debugf(ctx, "!! TUN %s discarded because context is cancelled", pkt)
 	case <-h.tunDone:
+		h.budget.Release(sz)
 		dlog.Debugf(ctx, "!! TUN %s discarded because TCP handler's input processing was cancelled", pkt)
 	case h.fromTun <- pkt:
 	}
 }
 
+// packetSize returns the number of bytes that the given packet accounts for in the budget.
+func packetSize(pkt Packet) int {
+	return len(pkt.Data().Buf())
+}
+
 func (h *handler) Close(ctx context.Context) {
 	if h.state() == stateEstablished || h.state() == stateSynReceived {
 		h.setState(ctx, stateFinWait1)
@@ -256,10 +276,13 @@ func (h *handler) Start(ctx context.Context) {
 		defer cancel()
 		defer func() {
 			h.remove()
+			// Packets that were queued for the manager after its write loop ended are never sent
+			h.drainToMgr()
 			// Drain any incoming to unblock
 			for {
 				select {
-				case <-h.fromTun:
+				case pkt := <-h.fromTun:
+					h.budget.Release(packetSize(pkt))
 				default:
 					return
 				}
@@ -698,6 +721,7 @@ func (h *handler) processPacketsWithProcessor(ctx context.Context, process func(
 	for {
 		select {
 		case pkt := <-h.fromTun:
+			h.budget.Release(packetSize(pkt))
 			if !process(ctx, pkt) {
 				return
 			}
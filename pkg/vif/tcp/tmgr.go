@@ -21,6 +21,13 @@ func (h *handler) handleStreamControl(ctx context.Context, ctrl tunnel.Message)
 }
 
 func (h *handler) sendToMgr(ctx context.Context, pkt Packet) bool {
+	sz := packetSize(pkt)
+	if !h.budget.Acquire(sz) {
+		// Treated as packet loss. The peer resends the packet since it isn't acked.
+		dlog.Tracef(ctx, "-> MGR %s discarded because the packet buffer limit is reached", pkt)
+		pkt.Release()
+		return false
+	}
 	select {
 	case h.toMgrCh <- pkt:
 		h.adjustReceiveWindow()
@@ -32,6 +39,7 @@ func (h *handler) sendToMgr(ctx context.Context, pkt Packet) bool {
 	default:
 		// Manager doesn't keep up. Packet loss!
 		dlog.Debugf(ctx, "-> MGR %s packet lost!", pkt)
+		h.budget.Release(sz)
 		pkt.Release()
 		if h.packetLostTimer == nil {
 			h.packetLostTimer = time.AfterFunc(5*time.Second, func() {
@@ -104,6 +112,7 @@ func (h *handler) writeToMgrLoop(ctx context.Context) {
 
 	var mgrWrite func(payload []byte) bool
 	defer close(h.toMgrMsgCh)
+	defer h.drainToMgr()
 	tunnel.WriteLoop(ctx, h.stream, h.toMgrMsgCh)
 	mgrWrite = func(payload []byte) bool {
 		select {
@@ -140,12 +149,14 @@ func (h *handler) writeToMgrLoop(ctx context.Context) {
 			if pkt == nil {
 				return
 			}
+			h.budget.Release(packetSize(pkt))
 			h.adjustReceiveWindow()
 			tcpHdr := pkt.Header()
 			payload := tcpHdr.Payload()
 			if tcpHdr.PSH() || buf.Len()+len(payload) >= maxBufSize {
 				if buf.Len() == 0 {
 					if mgrWrite(payload) { // save extra copying by bypassing buf.
+						pkt.Release()
 						return
 					}
 				} else {
@@ -164,6 +175,23 @@ func (h *handler) writeToMgrLoop(ctx context.Context) {
 	}
 }
 
+// drainToMgr releases the packets that are queued for the traffic-manager but will never be sent, so that
+// they no longer count against the buffer budget.
+func (h *handler) drainToMgr() {
+	for {
+		select {
+		case pkt := <-h.toMgrCh:
+			if pkt == nil {
+				return
+			}
+			h.budget.Release(packetSize(pkt))
+			pkt.Release()
+		default:
+			return
+		}
+	}
+}
+
 func (h *handler) sendStreamControl(ctx context.Context, code tunnel.MessageCode) {
 	select {
 	case <-ctx.Done():
@@ -0,0 +1,69 @@
+package tcp
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/buffer"
+)
+
+// stalledStream is a stream to a traffic-manager that never accepts a message.
+type stalledStream struct {
+	id     tunnel.ConnID
+	closed chan struct{}
+}
+
+func (s *stalledStream) Tag() string                     { return "TST" }
+func (s *stalledStream) ID() tunnel.ConnID               { return s.id }
+func (s *stalledStream) PeerVersion() uint16             { return 2 }
+func (s *stalledStream) SessionID() string               { return "" }
+func (s *stalledStream) DialTimeout() time.Duration      { return time.Second }
+func (s *stalledStream) RoundtripLatency() time.Duration { return time.Second }
+
+func (s *stalledStream) CloseSend(context.Context) error {
+	close(s.closed)
+	return nil
+}
+
+func (s *stalledStream) Receive(ctx context.Context) (tunnel.Message, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s *stalledStream) Send(ctx context.Context, _ tunnel.Message) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestHandler_writeToMgrLoopReleasesBudget(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+	id := tunnel.NewConnID(ipproto.TCP, net.IP{127, 0, 0, 1}, net.IP{10, 0, 0, 1}, 4711, 80)
+	budget := buffer.NewBudget(1024 * 1024)
+	h := NewHandler(nil, new(int32), nil, id, func() {}, rand.NewSource(1), budget).(*handler)
+	s := &stalledStream{id: id, closed: make(chan struct{})}
+	h.stream = s
+
+	for i := 0; i < 8; i++ {
+		require.True(t, h.sendToMgr(ctx, h.newResponse(HeaderLen+100, false)))
+	}
+	used, _, _ := budget.Stats()
+	require.Greater(t, used, int64(0))
+
+	// The connection closes while packets are still queued for the manager
+	cancel()
+	h.writeToMgrLoop(ctx)
+	<-s.closed
+	used, _, _ = budget.Stats()
+	assert.Equal(t, int64(0), used)
+	assert.Len(t, h.toMgrCh, 0)
+}
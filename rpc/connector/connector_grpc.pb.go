@@ -5,6 +5,7 @@ package connector
 import (
 	context "context"
 	common "github.com/telepresenceio/telepresence/rpc/v2/common"
+	daemon "github.com/telepresenceio/telepresence/rpc/v2/daemon"
 	manager "github.com/telepresenceio/telepresence/rpc/v2/manager"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
@@ -30,19 +31,34 @@ type ConnectorClient interface {
 	// MUST_RESTART is returned, based on whether the current connection
 	// is in agreement with the ConnectionRequest.
 	Connect(ctx context.Context, in *ConnectRequest, opts ...grpc.CallOption) (*ConnectInfo, error)
+	// ConnectWithProgress is like Connect but streams the progress of the
+	// connect while it's in progress. The last message of the stream
+	// contains the result.
+	ConnectWithProgress(ctx context.Context, in *ConnectRequest, opts ...grpc.CallOption) (Connector_ConnectWithProgressClient, error)
 	// Disconnects the cluster
 	Disconnect(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	// Status returns the status of the current connection or DISCONNECTED
 	// if no connection has been established.
 	Status(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ConnectInfo, error)
+	// SetMappedNamespaces replaces the namespaces that the current session maps,
+	// without disconnecting or affecting its intercepts. Requires having already
+	// called Connect.
+	SetMappedNamespaces(ctx context.Context, in *SetMappedNamespacesRequest, opts ...grpc.CallOption) (*SetMappedNamespacesResult, error)
 	// Queries the connector whether it is possible to create the given intercept.
 	CanIntercept(ctx context.Context, in *CreateInterceptRequest, opts ...grpc.CallOption) (*InterceptResult, error)
 	// Adds an intercept to a workload.  Requires having already called
 	// Connect.
 	CreateIntercept(ctx context.Context, in *CreateInterceptRequest, opts ...grpc.CallOption) (*InterceptResult, error)
+	// CreateInterceptWithProgress is like CreateIntercept but streams the
+	// progress of the intercept while it's created. The last message of
+	// the stream contains the result.
+	CreateInterceptWithProgress(ctx context.Context, in *CreateInterceptRequest, opts ...grpc.CallOption) (Connector_CreateInterceptWithProgressClient, error)
 	// Deactivates and removes an existent workload intercept.
 	// Requires having already called Connect.
 	RemoveIntercept(ctx context.Context, in *manager.RemoveInterceptRequest2, opts ...grpc.CallOption) (*InterceptResult, error)
+	// Deactivates and removes all intercepts of the current session, including
+	// the local-only ones. Requires having already called Connect.
+	RemoveAllIntercepts(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*RemoveAllInterceptsResult, error)
 	// Uninstalls traffic-agents and traffic-manager from the cluster.
 	// Requires having already called Connect.
 	Uninstall(ctx context.Context, in *UninstallRequest, opts ...grpc.CallOption) (*UninstallResult, error)
@@ -59,8 +75,18 @@ type ConnectorClient interface {
 	Logout(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	GetCloudUserInfo(ctx context.Context, in *UserInfoRequest, opts ...grpc.CallOption) (*UserInfo, error)
 	GetCloudAPIKey(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyData, error)
+	// RotateCloudAPIKeys replaces cached API keys with new ones, updates the
+	// keys that the traffic-manager and the traffic-agents use, and then
+	// revokes the replaced keys.
+	RotateCloudAPIKeys(ctx context.Context, in *RotateKeysRequest, opts ...grpc.CallOption) (*RotateKeysResult, error)
 	GetCloudLicense(ctx context.Context, in *LicenseRequest, opts ...grpc.CallOption) (*LicenseData, error)
 	GetIngressInfos(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*IngressInfos, error)
+	// ApplyRoutes re-reads the also-proxy and never-proxy subnets from the kubeconfig
+	// and applies them to the current session without reconnecting.
+	ApplyRoutes(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*RoutesInfo, error)
+	// GetNetworkConfig returns the routes, DNS configuration, and TUN device that the
+	// root daemon has put in effect for the current session.
+	GetNetworkConfig(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*daemon.NetworkConfig, error)
 	// SetLogLevel will temporarily set the log-level for the daemon for a duration that is determined by the request.
 	SetLogLevel(ctx context.Context, in *manager.LogLevelRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	// Quits (terminates) the connector process.
@@ -97,6 +123,38 @@ func (c *connectorClient) Connect(ctx context.Context, in *ConnectRequest, opts
 	return out, nil
 }
 
+func (c *connectorClient) ConnectWithProgress(ctx context.Context, in *ConnectRequest, opts ...grpc.CallOption) (Connector_ConnectWithProgressClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Connector_ServiceDesc.Streams[0], "/telepresence.connector.Connector/ConnectWithProgress", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &connectorConnectWithProgressClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Connector_ConnectWithProgressClient interface {
+	Recv() (*ConnectProgress, error)
+	grpc.ClientStream
+}
+
+type connectorConnectWithProgressClient struct {
+	grpc.ClientStream
+}
+
+func (x *connectorConnectWithProgressClient) Recv() (*ConnectProgress, error) {
+	m := new(ConnectProgress)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *connectorClient) Disconnect(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	out := new(emptypb.Empty)
 	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/Disconnect", in, out, opts...)
@@ -115,6 +173,15 @@ func (c *connectorClient) Status(ctx context.Context, in *emptypb.Empty, opts ..
 	return out, nil
 }
 
+func (c *connectorClient) SetMappedNamespaces(ctx context.Context, in *SetMappedNamespacesRequest, opts ...grpc.CallOption) (*SetMappedNamespacesResult, error) {
+	out := new(SetMappedNamespacesResult)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/SetMappedNamespaces", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *connectorClient) CanIntercept(ctx context.Context, in *CreateInterceptRequest, opts ...grpc.CallOption) (*InterceptResult, error) {
 	out := new(InterceptResult)
 	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/CanIntercept", in, out, opts...)
@@ -133,6 +200,38 @@ func (c *connectorClient) CreateIntercept(ctx context.Context, in *CreateInterce
 	return out, nil
 }
 
+func (c *connectorClient) CreateInterceptWithProgress(ctx context.Context, in *CreateInterceptRequest, opts ...grpc.CallOption) (Connector_CreateInterceptWithProgressClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Connector_ServiceDesc.Streams[1], "/telepresence.connector.Connector/CreateInterceptWithProgress", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &connectorCreateInterceptWithProgressClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Connector_CreateInterceptWithProgressClient interface {
+	Recv() (*InterceptProgress, error)
+	grpc.ClientStream
+}
+
+type connectorCreateInterceptWithProgressClient struct {
+	grpc.ClientStream
+}
+
+func (x *connectorCreateInterceptWithProgressClient) Recv() (*InterceptProgress, error) {
+	m := new(InterceptProgress)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *connectorClient) RemoveIntercept(ctx context.Context, in *manager.RemoveInterceptRequest2, opts ...grpc.CallOption) (*InterceptResult, error) {
 	out := new(InterceptResult)
 	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/RemoveIntercept", in, out, opts...)
@@ -142,6 +241,15 @@ func (c *connectorClient) RemoveIntercept(ctx context.Context, in *manager.Remov
 	return out, nil
 }
 
+func (c *connectorClient) RemoveAllIntercepts(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*RemoveAllInterceptsResult, error) {
+	out := new(RemoveAllInterceptsResult)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/RemoveAllIntercepts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *connectorClient) Uninstall(ctx context.Context, in *UninstallRequest, opts ...grpc.CallOption) (*UninstallResult, error) {
 	out := new(UninstallResult)
 	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/Uninstall", in, out, opts...)
@@ -161,7 +269,7 @@ func (c *connectorClient) List(ctx context.Context, in *ListRequest, opts ...grp
 }
 
 func (c *connectorClient) WatchWorkloads(ctx context.Context, in *WatchWorkloadsRequest, opts ...grpc.CallOption) (Connector_WatchWorkloadsClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Connector_ServiceDesc.Streams[0], "/telepresence.connector.Connector/WatchWorkloads", opts...)
+	stream, err := c.cc.NewStream(ctx, &Connector_ServiceDesc.Streams[2], "/telepresence.connector.Connector/WatchWorkloads", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -193,7 +301,7 @@ func (x *connectorWatchWorkloadsClient) Recv() (*WorkloadInfoSnapshot, error) {
 }
 
 func (c *connectorClient) UserNotifications(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Connector_UserNotificationsClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Connector_ServiceDesc.Streams[1], "/telepresence.connector.Connector/UserNotifications", opts...)
+	stream, err := c.cc.NewStream(ctx, &Connector_ServiceDesc.Streams[3], "/telepresence.connector.Connector/UserNotifications", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -260,6 +368,15 @@ func (c *connectorClient) GetCloudAPIKey(ctx context.Context, in *KeyRequest, op
 	return out, nil
 }
 
+func (c *connectorClient) RotateCloudAPIKeys(ctx context.Context, in *RotateKeysRequest, opts ...grpc.CallOption) (*RotateKeysResult, error) {
+	out := new(RotateKeysResult)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/RotateCloudAPIKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *connectorClient) GetCloudLicense(ctx context.Context, in *LicenseRequest, opts ...grpc.CallOption) (*LicenseData, error) {
 	out := new(LicenseData)
 	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/GetCloudLicense", in, out, opts...)
@@ -278,6 +395,24 @@ func (c *connectorClient) GetIngressInfos(ctx context.Context, in *emptypb.Empty
 	return out, nil
 }
 
+func (c *connectorClient) ApplyRoutes(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*RoutesInfo, error) {
+	out := new(RoutesInfo)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/ApplyRoutes", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connectorClient) GetNetworkConfig(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*daemon.NetworkConfig, error) {
+	out := new(daemon.NetworkConfig)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/GetNetworkConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *connectorClient) SetLogLevel(ctx context.Context, in *manager.LogLevelRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	out := new(emptypb.Empty)
 	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/SetLogLevel", in, out, opts...)
@@ -327,19 +462,34 @@ type ConnectorServer interface {
 	// MUST_RESTART is returned, based on whether the current connection
 	// is in agreement with the ConnectionRequest.
 	Connect(context.Context, *ConnectRequest) (*ConnectInfo, error)
+	// ConnectWithProgress is like Connect but streams the progress of the
+	// connect while it's in progress. The last message of the stream
+	// contains the result.
+	ConnectWithProgress(*ConnectRequest, Connector_ConnectWithProgressServer) error
 	// Disconnects the cluster
 	Disconnect(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
 	// Status returns the status of the current connection or DISCONNECTED
 	// if no connection has been established.
 	Status(context.Context, *emptypb.Empty) (*ConnectInfo, error)
+	// SetMappedNamespaces replaces the namespaces that the current session maps,
+	// without disconnecting or affecting its intercepts. Requires having already
+	// called Connect.
+	SetMappedNamespaces(context.Context, *SetMappedNamespacesRequest) (*SetMappedNamespacesResult, error)
 	// Queries the connector whether it is possible to create the given intercept.
 	CanIntercept(context.Context, *CreateInterceptRequest) (*InterceptResult, error)
 	// Adds an intercept to a workload.  Requires having already called
 	// Connect.
 	CreateIntercept(context.Context, *CreateInterceptRequest) (*InterceptResult, error)
+	// CreateInterceptWithProgress is like CreateIntercept but streams the
+	// progress of the intercept while it's created. The last message of
+	// the stream contains the result.
+	CreateInterceptWithProgress(*CreateInterceptRequest, Connector_CreateInterceptWithProgressServer) error
 	// Deactivates and removes an existent workload intercept.
 	// Requires having already called Connect.
 	RemoveIntercept(context.Context, *manager.RemoveInterceptRequest2) (*InterceptResult, error)
+	// Deactivates and removes all intercepts of the current session, including
+	// the local-only ones. Requires having already called Connect.
+	RemoveAllIntercepts(context.Context, *emptypb.Empty) (*RemoveAllInterceptsResult, error)
 	// Uninstalls traffic-agents and traffic-manager from the cluster.
 	// Requires having already called Connect.
 	Uninstall(context.Context, *UninstallRequest) (*UninstallResult, error)
@@ -356,8 +506,18 @@ type ConnectorServer interface {
 	Logout(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
 	GetCloudUserInfo(context.Context, *UserInfoRequest) (*UserInfo, error)
 	GetCloudAPIKey(context.Context, *KeyRequest) (*KeyData, error)
+	// RotateCloudAPIKeys replaces cached API keys with new ones, updates the
+	// keys that the traffic-manager and the traffic-agents use, and then
+	// revokes the replaced keys.
+	RotateCloudAPIKeys(context.Context, *RotateKeysRequest) (*RotateKeysResult, error)
 	GetCloudLicense(context.Context, *LicenseRequest) (*LicenseData, error)
 	GetIngressInfos(context.Context, *emptypb.Empty) (*IngressInfos, error)
+	// ApplyRoutes re-reads the also-proxy and never-proxy subnets from the kubeconfig
+	// and applies them to the current session without reconnecting.
+	ApplyRoutes(context.Context, *emptypb.Empty) (*RoutesInfo, error)
+	// GetNetworkConfig returns the routes, DNS configuration, and TUN device that the
+	// root daemon has put in effect for the current session.
+	GetNetworkConfig(context.Context, *emptypb.Empty) (*daemon.NetworkConfig, error)
 	// SetLogLevel will temporarily set the log-level for the daemon for a duration that is determined by the request.
 	SetLogLevel(context.Context, *manager.LogLevelRequest) (*emptypb.Empty, error)
 	// Quits (terminates) the connector process.
@@ -379,21 +539,33 @@ func (UnimplementedConnectorServer) Version(context.Context, *emptypb.Empty) (*c
 func (UnimplementedConnectorServer) Connect(context.Context, *ConnectRequest) (*ConnectInfo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Connect not implemented")
 }
+func (UnimplementedConnectorServer) ConnectWithProgress(*ConnectRequest, Connector_ConnectWithProgressServer) error {
+	return status.Errorf(codes.Unimplemented, "method ConnectWithProgress not implemented")
+}
 func (UnimplementedConnectorServer) Disconnect(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Disconnect not implemented")
 }
 func (UnimplementedConnectorServer) Status(context.Context, *emptypb.Empty) (*ConnectInfo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
 }
+func (UnimplementedConnectorServer) SetMappedNamespaces(context.Context, *SetMappedNamespacesRequest) (*SetMappedNamespacesResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetMappedNamespaces not implemented")
+}
 func (UnimplementedConnectorServer) CanIntercept(context.Context, *CreateInterceptRequest) (*InterceptResult, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CanIntercept not implemented")
 }
 func (UnimplementedConnectorServer) CreateIntercept(context.Context, *CreateInterceptRequest) (*InterceptResult, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateIntercept not implemented")
 }
+func (UnimplementedConnectorServer) CreateInterceptWithProgress(*CreateInterceptRequest, Connector_CreateInterceptWithProgressServer) error {
+	return status.Errorf(codes.Unimplemented, "method CreateInterceptWithProgress not implemented")
+}
 func (UnimplementedConnectorServer) RemoveIntercept(context.Context, *manager.RemoveInterceptRequest2) (*InterceptResult, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RemoveIntercept not implemented")
 }
+func (UnimplementedConnectorServer) RemoveAllIntercepts(context.Context, *emptypb.Empty) (*RemoveAllInterceptsResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveAllIntercepts not implemented")
+}
 func (UnimplementedConnectorServer) Uninstall(context.Context, *UninstallRequest) (*UninstallResult, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Uninstall not implemented")
 }
@@ -418,12 +590,21 @@ func (UnimplementedConnectorServer) GetCloudUserInfo(context.Context, *UserInfoR
 func (UnimplementedConnectorServer) GetCloudAPIKey(context.Context, *KeyRequest) (*KeyData, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetCloudAPIKey not implemented")
 }
+func (UnimplementedConnectorServer) RotateCloudAPIKeys(context.Context, *RotateKeysRequest) (*RotateKeysResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RotateCloudAPIKeys not implemented")
+}
 func (UnimplementedConnectorServer) GetCloudLicense(context.Context, *LicenseRequest) (*LicenseData, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetCloudLicense not implemented")
 }
 func (UnimplementedConnectorServer) GetIngressInfos(context.Context, *emptypb.Empty) (*IngressInfos, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetIngressInfos not implemented")
 }
+func (UnimplementedConnectorServer) ApplyRoutes(context.Context, *emptypb.Empty) (*RoutesInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApplyRoutes not implemented")
+}
+func (UnimplementedConnectorServer) GetNetworkConfig(context.Context, *emptypb.Empty) (*daemon.NetworkConfig, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNetworkConfig not implemented")
+}
 func (UnimplementedConnectorServer) SetLogLevel(context.Context, *manager.LogLevelRequest) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetLogLevel not implemented")
 }
@@ -485,6 +666,27 @@ func _Connector_Connect_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Connector_ConnectWithProgress_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ConnectRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConnectorServer).ConnectWithProgress(m, &connectorConnectWithProgressServer{stream})
+}
+
+type Connector_ConnectWithProgressServer interface {
+	Send(*ConnectProgress) error
+	grpc.ServerStream
+}
+
+type connectorConnectWithProgressServer struct {
+	grpc.ServerStream
+}
+
+func (x *connectorConnectWithProgressServer) Send(m *ConnectProgress) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Connector_Disconnect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(emptypb.Empty)
 	if err := dec(in); err != nil {
@@ -521,6 +723,24 @@ func _Connector_Status_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Connector_SetMappedNamespaces_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetMappedNamespacesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).SetMappedNamespaces(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.Connector/SetMappedNamespaces",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).SetMappedNamespaces(ctx, req.(*SetMappedNamespacesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Connector_CanIntercept_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(CreateInterceptRequest)
 	if err := dec(in); err != nil {
@@ -557,6 +777,27 @@ func _Connector_CreateIntercept_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Connector_CreateInterceptWithProgress_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CreateInterceptRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConnectorServer).CreateInterceptWithProgress(m, &connectorCreateInterceptWithProgressServer{stream})
+}
+
+type Connector_CreateInterceptWithProgressServer interface {
+	Send(*InterceptProgress) error
+	grpc.ServerStream
+}
+
+type connectorCreateInterceptWithProgressServer struct {
+	grpc.ServerStream
+}
+
+func (x *connectorCreateInterceptWithProgressServer) Send(m *InterceptProgress) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Connector_RemoveIntercept_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(manager.RemoveInterceptRequest2)
 	if err := dec(in); err != nil {
@@ -575,6 +816,24 @@ func _Connector_RemoveIntercept_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Connector_RemoveAllIntercepts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).RemoveAllIntercepts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.Connector/RemoveAllIntercepts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).RemoveAllIntercepts(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Connector_Uninstall_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(UninstallRequest)
 	if err := dec(in); err != nil {
@@ -725,6 +984,24 @@ func _Connector_GetCloudAPIKey_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Connector_RotateCloudAPIKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RotateKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).RotateCloudAPIKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.Connector/RotateCloudAPIKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).RotateCloudAPIKeys(ctx, req.(*RotateKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Connector_GetCloudLicense_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(LicenseRequest)
 	if err := dec(in); err != nil {
@@ -761,6 +1038,42 @@ func _Connector_GetIngressInfos_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Connector_ApplyRoutes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).ApplyRoutes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.Connector/ApplyRoutes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).ApplyRoutes(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connector_GetNetworkConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).GetNetworkConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.Connector/GetNetworkConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).GetNetworkConfig(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Connector_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(manager.LogLevelRequest)
 	if err := dec(in); err != nil {
@@ -856,6 +1169,10 @@ var Connector_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Status",
 			Handler:    _Connector_Status_Handler,
 		},
+		{
+			MethodName: "SetMappedNamespaces",
+			Handler:    _Connector_SetMappedNamespaces_Handler,
+		},
 		{
 			MethodName: "CanIntercept",
 			Handler:    _Connector_CanIntercept_Handler,
@@ -868,6 +1185,10 @@ var Connector_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RemoveIntercept",
 			Handler:    _Connector_RemoveIntercept_Handler,
 		},
+		{
+			MethodName: "RemoveAllIntercepts",
+			Handler:    _Connector_RemoveAllIntercepts_Handler,
+		},
 		{
 			MethodName: "Uninstall",
 			Handler:    _Connector_Uninstall_Handler,
@@ -892,6 +1213,10 @@ var Connector_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetCloudAPIKey",
 			Handler:    _Connector_GetCloudAPIKey_Handler,
 		},
+		{
+			MethodName: "RotateCloudAPIKeys",
+			Handler:    _Connector_RotateCloudAPIKeys_Handler,
+		},
 		{
 			MethodName: "GetCloudLicense",
 			Handler:    _Connector_GetCloudLicense_Handler,
@@ -900,6 +1225,14 @@ var Connector_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetIngressInfos",
 			Handler:    _Connector_GetIngressInfos_Handler,
 		},
+		{
+			MethodName: "ApplyRoutes",
+			Handler:    _Connector_ApplyRoutes_Handler,
+		},
+		{
+			MethodName: "GetNetworkConfig",
+			Handler:    _Connector_GetNetworkConfig_Handler,
+		},
 		{
 			MethodName: "SetLogLevel",
 			Handler:    _Connector_SetLogLevel_Handler,
@@ -918,6 +1251,16 @@ var Connector_ServiceDesc = grpc.ServiceDesc{
 		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ConnectWithProgress",
+			Handler:       _Connector_ConnectWithProgress_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "CreateInterceptWithProgress",
+			Handler:       _Connector_CreateInterceptWithProgress_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "WatchWorkloads",
 			Handler:       _Connector_WatchWorkloads_Handler,
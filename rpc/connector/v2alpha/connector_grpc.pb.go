@@ -0,0 +1,447 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package v2alpha
+
+import (
+	context "context"
+	common "github.com/telepresenceio/telepresence/rpc/v2/common"
+	connector "github.com/telepresenceio/telepresence/rpc/v2/connector"
+	manager "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// ConnectorClient is the client API for Connector service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ConnectorClient interface {
+	// Returns version information from the Connector
+	Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*common.VersionInfo, error)
+	// Connects to the cluster and connects the laptop's network (via
+	// the daemon process) to the cluster's network.
+	Connect(ctx context.Context, in *connector.ConnectRequest, opts ...grpc.CallOption) (*connector.ConnectInfo, error)
+	// Disconnects the cluster
+	Disconnect(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Returns the status of the connection to the cluster.
+	Status(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*connector.ConnectInfo, error)
+	// Adds an intercept to a workload. Requires having already called
+	// Connect.
+	CreateIntercept(ctx context.Context, in *connector.CreateInterceptRequest, opts ...grpc.CallOption) (*connector.InterceptResult, error)
+	// Deactivates and removes an existent workload intercept.
+	// Requires having already called Connect.
+	RemoveIntercept(ctx context.Context, in *manager.RemoveInterceptRequest2, opts ...grpc.CallOption) (*connector.InterceptResult, error)
+	// Returns a list of workloads and their current intercept status.
+	// Requires having already called Connect.
+	List(ctx context.Context, in *connector.ListRequest, opts ...grpc.CallOption) (*connector.WorkloadInfoSnapshot, error)
+	// Watch all workloads in the mapped namespaces
+	WatchWorkloads(ctx context.Context, in *connector.WatchWorkloadsRequest, opts ...grpc.CallOption) (Connector_WatchWorkloadsClient, error)
+	// Quits (terminates) the connector process.
+	Quit(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+}
+
+type connectorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewConnectorClient(cc grpc.ClientConnInterface) ConnectorClient {
+	return &connectorClient{cc}
+}
+
+func (c *connectorClient) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*common.VersionInfo, error) {
+	out := new(common.VersionInfo)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.v2alpha.Connector/Version", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connectorClient) Connect(ctx context.Context, in *connector.ConnectRequest, opts ...grpc.CallOption) (*connector.ConnectInfo, error) {
+	out := new(connector.ConnectInfo)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.v2alpha.Connector/Connect", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connectorClient) Disconnect(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.v2alpha.Connector/Disconnect", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connectorClient) Status(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*connector.ConnectInfo, error) {
+	out := new(connector.ConnectInfo)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.v2alpha.Connector/Status", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connectorClient) CreateIntercept(ctx context.Context, in *connector.CreateInterceptRequest, opts ...grpc.CallOption) (*connector.InterceptResult, error) {
+	out := new(connector.InterceptResult)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.v2alpha.Connector/CreateIntercept", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connectorClient) RemoveIntercept(ctx context.Context, in *manager.RemoveInterceptRequest2, opts ...grpc.CallOption) (*connector.InterceptResult, error) {
+	out := new(connector.InterceptResult)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.v2alpha.Connector/RemoveIntercept", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connectorClient) List(ctx context.Context, in *connector.ListRequest, opts ...grpc.CallOption) (*connector.WorkloadInfoSnapshot, error) {
+	out := new(connector.WorkloadInfoSnapshot)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.v2alpha.Connector/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connectorClient) WatchWorkloads(ctx context.Context, in *connector.WatchWorkloadsRequest, opts ...grpc.CallOption) (Connector_WatchWorkloadsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Connector_ServiceDesc.Streams[0], "/telepresence.connector.v2alpha.Connector/WatchWorkloads", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &connectorWatchWorkloadsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Connector_WatchWorkloadsClient interface {
+	Recv() (*connector.WorkloadInfoSnapshot, error)
+	grpc.ClientStream
+}
+
+type connectorWatchWorkloadsClient struct {
+	grpc.ClientStream
+}
+
+func (x *connectorWatchWorkloadsClient) Recv() (*connector.WorkloadInfoSnapshot, error) {
+	m := new(connector.WorkloadInfoSnapshot)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *connectorClient) Quit(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.v2alpha.Connector/Quit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ConnectorServer is the server API for Connector service.
+// All implementations must embed UnimplementedConnectorServer
+// for forward compatibility
+type ConnectorServer interface {
+	// Returns version information from the Connector
+	Version(context.Context, *emptypb.Empty) (*common.VersionInfo, error)
+	// Connects to the cluster and connects the laptop's network (via
+	// the daemon process) to the cluster's network.
+	Connect(context.Context, *connector.ConnectRequest) (*connector.ConnectInfo, error)
+	// Disconnects the cluster
+	Disconnect(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	// Returns the status of the connection to the cluster.
+	Status(context.Context, *emptypb.Empty) (*connector.ConnectInfo, error)
+	// Adds an intercept to a workload. Requires having already called
+	// Connect.
+	CreateIntercept(context.Context, *connector.CreateInterceptRequest) (*connector.InterceptResult, error)
+	// Deactivates and removes an existent workload intercept.
+	// Requires having already called Connect.
+	RemoveIntercept(context.Context, *manager.RemoveInterceptRequest2) (*connector.InterceptResult, error)
+	// Returns a list of workloads and their current intercept status.
+	// Requires having already called Connect.
+	List(context.Context, *connector.ListRequest) (*connector.WorkloadInfoSnapshot, error)
+	// Watch all workloads in the mapped namespaces
+	WatchWorkloads(*connector.WatchWorkloadsRequest, Connector_WatchWorkloadsServer) error
+	// Quits (terminates) the connector process.
+	Quit(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	mustEmbedUnimplementedConnectorServer()
+}
+
+// UnimplementedConnectorServer must be embedded to have forward compatible implementations.
+type UnimplementedConnectorServer struct {
+}
+
+func (UnimplementedConnectorServer) Version(context.Context, *emptypb.Empty) (*common.VersionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
+}
+func (UnimplementedConnectorServer) Connect(context.Context, *connector.ConnectRequest) (*connector.ConnectInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Connect not implemented")
+}
+func (UnimplementedConnectorServer) Disconnect(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Disconnect not implemented")
+}
+func (UnimplementedConnectorServer) Status(context.Context, *emptypb.Empty) (*connector.ConnectInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedConnectorServer) CreateIntercept(context.Context, *connector.CreateInterceptRequest) (*connector.InterceptResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateIntercept not implemented")
+}
+func (UnimplementedConnectorServer) RemoveIntercept(context.Context, *manager.RemoveInterceptRequest2) (*connector.InterceptResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveIntercept not implemented")
+}
+func (UnimplementedConnectorServer) List(context.Context, *connector.ListRequest) (*connector.WorkloadInfoSnapshot, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedConnectorServer) WatchWorkloads(*connector.WatchWorkloadsRequest, Connector_WatchWorkloadsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchWorkloads not implemented")
+}
+func (UnimplementedConnectorServer) Quit(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Quit not implemented")
+}
+func (UnimplementedConnectorServer) mustEmbedUnimplementedConnectorServer() {}
+
+// UnsafeConnectorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ConnectorServer will
+// result in compilation errors.
+type UnsafeConnectorServer interface {
+	mustEmbedUnimplementedConnectorServer()
+}
+
+func RegisterConnectorServer(s grpc.ServiceRegistrar, srv ConnectorServer) {
+	s.RegisterService(&Connector_ServiceDesc, srv)
+}
+
+func _Connector_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.v2alpha.Connector/Version",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).Version(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connector_Connect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(connector.ConnectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).Connect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.v2alpha.Connector/Connect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).Connect(ctx, req.(*connector.ConnectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connector_Disconnect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).Disconnect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.v2alpha.Connector/Disconnect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).Disconnect(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connector_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.v2alpha.Connector/Status",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).Status(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connector_CreateIntercept_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(connector.CreateInterceptRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).CreateIntercept(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.v2alpha.Connector/CreateIntercept",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).CreateIntercept(ctx, req.(*connector.CreateInterceptRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connector_RemoveIntercept_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(manager.RemoveInterceptRequest2)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).RemoveIntercept(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.v2alpha.Connector/RemoveIntercept",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).RemoveIntercept(ctx, req.(*manager.RemoveInterceptRequest2))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connector_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(connector.ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.v2alpha.Connector/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).List(ctx, req.(*connector.ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connector_WatchWorkloads_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(connector.WatchWorkloadsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConnectorServer).WatchWorkloads(m, &connectorWatchWorkloadsServer{stream})
+}
+
+type Connector_WatchWorkloadsServer interface {
+	Send(*connector.WorkloadInfoSnapshot) error
+	grpc.ServerStream
+}
+
+type connectorWatchWorkloadsServer struct {
+	grpc.ServerStream
+}
+
+func (x *connectorWatchWorkloadsServer) Send(m *connector.WorkloadInfoSnapshot) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Connector_Quit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).Quit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.v2alpha.Connector/Quit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).Quit(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Connector_ServiceDesc is the grpc.ServiceDesc for Connector service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Connector_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "telepresence.connector.v2alpha.Connector",
+	HandlerType: (*ConnectorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Version",
+			Handler:    _Connector_Version_Handler,
+		},
+		{
+			MethodName: "Connect",
+			Handler:    _Connector_Connect_Handler,
+		},
+		{
+			MethodName: "Disconnect",
+			Handler:    _Connector_Disconnect_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _Connector_Status_Handler,
+		},
+		{
+			MethodName: "CreateIntercept",
+			Handler:    _Connector_CreateIntercept_Handler,
+		},
+		{
+			MethodName: "RemoveIntercept",
+			Handler:    _Connector_RemoveIntercept_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _Connector_List_Handler,
+		},
+		{
+			MethodName: "Quit",
+			Handler:    _Connector_Quit_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchWorkloads",
+			Handler:       _Connector_WatchWorkloads_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "rpc/connector/v2alpha/connector.proto",
+}
@@ -31,10 +31,28 @@ type DaemonClient interface {
 	Connect(ctx context.Context, in *OutboundInfo, opts ...grpc.CallOption) (*DaemonStatus, error)
 	// Disconnect disconnects the current session.
 	Disconnect(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Reconnect replaces the traffic-manager session of the current session, and
+	// reconciles the routes and DNS configuration with the current network. It's
+	// called by the connector after it has reconnected to the traffic-manager.
+	Reconnect(ctx context.Context, in *OutboundInfo, opts ...grpc.CallOption) (*DaemonStatus, error)
 	// GetClusterSubnets gets the outbound info that has been set on daemon
 	GetClusterSubnets(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ClusterSubnets, error)
+	// SetProxySubnets replaces the also-proxy and never-proxy subnets of the current session
+	// and reconciles the routes of the TUN device accordingly.
+	SetProxySubnets(ctx context.Context, in *ProxySubnets, opts ...grpc.CallOption) (*DaemonStatus, error)
+	// GetNetworkConfig returns the routes, DNS configuration, and TUN device that are
+	// in effect for the current session.
+	GetNetworkConfig(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*NetworkConfig, error)
+	// RouteProcess makes the traffic of the calling process, and of the processes
+	// that it starts from then on, go through the TUN device when the session uses
+	// process routing. The caller is identified by the credentials of its connection,
+	// so a process can only route its own traffic. Only supported on Linux.
+	RouteProcess(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	// SetDnsSearchPath sets a new search path.
 	SetDnsSearchPath(ctx context.Context, in *Paths, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// LookupDNS resolves a name using the DNS resolver of the current session and
+	// reports how the name was resolved.
+	LookupDNS(ctx context.Context, in *DNSRequest, opts ...grpc.CallOption) (*DNSResponse, error)
 	// SetLogLevel will temporarily set the log-level for the daemon for a duration that is determined b the request.
 	SetLogLevel(ctx context.Context, in *manager.LogLevelRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
@@ -92,6 +110,15 @@ func (c *daemonClient) Disconnect(ctx context.Context, in *emptypb.Empty, opts .
 	return out, nil
 }
 
+func (c *daemonClient) Reconnect(ctx context.Context, in *OutboundInfo, opts ...grpc.CallOption) (*DaemonStatus, error) {
+	out := new(DaemonStatus)
+	err := c.cc.Invoke(ctx, "/telepresence.daemon.Daemon/Reconnect", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *daemonClient) GetClusterSubnets(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ClusterSubnets, error) {
 	out := new(ClusterSubnets)
 	err := c.cc.Invoke(ctx, "/telepresence.daemon.Daemon/GetClusterSubnets", in, out, opts...)
@@ -101,6 +128,33 @@ func (c *daemonClient) GetClusterSubnets(ctx context.Context, in *emptypb.Empty,
 	return out, nil
 }
 
+func (c *daemonClient) SetProxySubnets(ctx context.Context, in *ProxySubnets, opts ...grpc.CallOption) (*DaemonStatus, error) {
+	out := new(DaemonStatus)
+	err := c.cc.Invoke(ctx, "/telepresence.daemon.Daemon/SetProxySubnets", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *daemonClient) GetNetworkConfig(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*NetworkConfig, error) {
+	out := new(NetworkConfig)
+	err := c.cc.Invoke(ctx, "/telepresence.daemon.Daemon/GetNetworkConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *daemonClient) RouteProcess(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/telepresence.daemon.Daemon/RouteProcess", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *daemonClient) SetDnsSearchPath(ctx context.Context, in *Paths, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	out := new(emptypb.Empty)
 	err := c.cc.Invoke(ctx, "/telepresence.daemon.Daemon/SetDnsSearchPath", in, out, opts...)
@@ -110,6 +164,15 @@ func (c *daemonClient) SetDnsSearchPath(ctx context.Context, in *Paths, opts ...
 	return out, nil
 }
 
+func (c *daemonClient) LookupDNS(ctx context.Context, in *DNSRequest, opts ...grpc.CallOption) (*DNSResponse, error) {
+	out := new(DNSResponse)
+	err := c.cc.Invoke(ctx, "/telepresence.daemon.Daemon/LookupDNS", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *daemonClient) SetLogLevel(ctx context.Context, in *manager.LogLevelRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	out := new(emptypb.Empty)
 	err := c.cc.Invoke(ctx, "/telepresence.daemon.Daemon/SetLogLevel", in, out, opts...)
@@ -133,10 +196,28 @@ type DaemonServer interface {
 	Connect(context.Context, *OutboundInfo) (*DaemonStatus, error)
 	// Disconnect disconnects the current session.
 	Disconnect(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	// Reconnect replaces the traffic-manager session of the current session, and
+	// reconciles the routes and DNS configuration with the current network. It's
+	// called by the connector after it has reconnected to the traffic-manager.
+	Reconnect(context.Context, *OutboundInfo) (*DaemonStatus, error)
 	// GetClusterSubnets gets the outbound info that has been set on daemon
 	GetClusterSubnets(context.Context, *emptypb.Empty) (*ClusterSubnets, error)
+	// SetProxySubnets replaces the also-proxy and never-proxy subnets of the current session
+	// and reconciles the routes of the TUN device accordingly.
+	SetProxySubnets(context.Context, *ProxySubnets) (*DaemonStatus, error)
+	// GetNetworkConfig returns the routes, DNS configuration, and TUN device that are
+	// in effect for the current session.
+	GetNetworkConfig(context.Context, *emptypb.Empty) (*NetworkConfig, error)
+	// RouteProcess makes the traffic of the calling process, and of the processes
+	// that it starts from then on, go through the TUN device when the session uses
+	// process routing. The caller is identified by the credentials of its connection,
+	// so a process can only route its own traffic. Only supported on Linux.
+	RouteProcess(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
 	// SetDnsSearchPath sets a new search path.
 	SetDnsSearchPath(context.Context, *Paths) (*emptypb.Empty, error)
+	// LookupDNS resolves a name using the DNS resolver of the current session and
+	// reports how the name was resolved.
+	LookupDNS(context.Context, *DNSRequest) (*DNSResponse, error)
 	// SetLogLevel will temporarily set the log-level for the daemon for a duration that is determined b the request.
 	SetLogLevel(context.Context, *manager.LogLevelRequest) (*emptypb.Empty, error)
 	mustEmbedUnimplementedDaemonServer()
@@ -161,12 +242,27 @@ func (UnimplementedDaemonServer) Connect(context.Context, *OutboundInfo) (*Daemo
 func (UnimplementedDaemonServer) Disconnect(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Disconnect not implemented")
 }
+func (UnimplementedDaemonServer) Reconnect(context.Context, *OutboundInfo) (*DaemonStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reconnect not implemented")
+}
 func (UnimplementedDaemonServer) GetClusterSubnets(context.Context, *emptypb.Empty) (*ClusterSubnets, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetClusterSubnets not implemented")
 }
+func (UnimplementedDaemonServer) SetProxySubnets(context.Context, *ProxySubnets) (*DaemonStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetProxySubnets not implemented")
+}
+func (UnimplementedDaemonServer) GetNetworkConfig(context.Context, *emptypb.Empty) (*NetworkConfig, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNetworkConfig not implemented")
+}
+func (UnimplementedDaemonServer) RouteProcess(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RouteProcess not implemented")
+}
 func (UnimplementedDaemonServer) SetDnsSearchPath(context.Context, *Paths) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetDnsSearchPath not implemented")
 }
+func (UnimplementedDaemonServer) LookupDNS(context.Context, *DNSRequest) (*DNSResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LookupDNS not implemented")
+}
 func (UnimplementedDaemonServer) SetLogLevel(context.Context, *manager.LogLevelRequest) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetLogLevel not implemented")
 }
@@ -273,6 +369,24 @@ func _Daemon_Disconnect_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Daemon_Reconnect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OutboundInfo)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).Reconnect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.daemon.Daemon/Reconnect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).Reconnect(ctx, req.(*OutboundInfo))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Daemon_GetClusterSubnets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(emptypb.Empty)
 	if err := dec(in); err != nil {
@@ -291,6 +405,60 @@ func _Daemon_GetClusterSubnets_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Daemon_SetProxySubnets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProxySubnets)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).SetProxySubnets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.daemon.Daemon/SetProxySubnets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).SetProxySubnets(ctx, req.(*ProxySubnets))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Daemon_GetNetworkConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).GetNetworkConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.daemon.Daemon/GetNetworkConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).GetNetworkConfig(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Daemon_RouteProcess_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).RouteProcess(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.daemon.Daemon/RouteProcess",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).RouteProcess(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Daemon_SetDnsSearchPath_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(Paths)
 	if err := dec(in); err != nil {
@@ -309,6 +477,24 @@ func _Daemon_SetDnsSearchPath_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Daemon_LookupDNS_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DNSRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).LookupDNS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.daemon.Daemon/LookupDNS",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).LookupDNS(ctx, req.(*DNSRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Daemon_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(manager.LogLevelRequest)
 	if err := dec(in); err != nil {
@@ -354,14 +540,34 @@ var Daemon_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Disconnect",
 			Handler:    _Daemon_Disconnect_Handler,
 		},
+		{
+			MethodName: "Reconnect",
+			Handler:    _Daemon_Reconnect_Handler,
+		},
 		{
 			MethodName: "GetClusterSubnets",
 			Handler:    _Daemon_GetClusterSubnets_Handler,
 		},
+		{
+			MethodName: "SetProxySubnets",
+			Handler:    _Daemon_SetProxySubnets_Handler,
+		},
+		{
+			MethodName: "GetNetworkConfig",
+			Handler:    _Daemon_GetNetworkConfig_Handler,
+		},
+		{
+			MethodName: "RouteProcess",
+			Handler:    _Daemon_RouteProcess_Handler,
+		},
 		{
 			MethodName: "SetDnsSearchPath",
 			Handler:    _Daemon_SetDnsSearchPath_Handler,
 		},
+		{
+			MethodName: "LookupDNS",
+			Handler:    _Daemon_LookupDNS_Handler,
+		},
 		{
 			MethodName: "SetLogLevel",
 			Handler:    _Daemon_SetLogLevel_Handler,
@@ -32,6 +32,14 @@ type ManagerClient interface {
 	GetCloudConfig(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*AmbassadorCloudConfig, error)
 	// GetTelepresenceAPI returns information about the TelepresenceAPI server
 	GetTelepresenceAPI(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*TelepresenceAPIInfo, error)
+	// GetClientRequirements returns the settings that the traffic-manager runs
+	// with, so that clients can detect when their configuration has drifted
+	// from them.
+	GetClientRequirements(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ClientRequirements, error)
+	// GetCloudArtifact streams an Ambassador Cloud artifact that the traffic-manager
+	// downloads and caches on behalf of clients that can't reach Ambassador Cloud
+	// directly.
+	GetCloudArtifact(ctx context.Context, in *CloudArtifactRequest, opts ...grpc.CallOption) (Manager_GetCloudArtifactClient, error)
 	// ArriveAsClient establishes a session between a client and the Manager.
 	ArriveAsClient(ctx context.Context, in *ClientInfo, opts ...grpc.CallOption) (*SessionInfo, error)
 	// ArriveAsAgent establishes a session between an agent and the Manager.
@@ -47,6 +55,10 @@ type ManagerClient interface {
 	// GetLogs will acquire logs for the various Telepresence components in kubernetes
 	// (pending the request) and return them to the caller
 	GetLogs(ctx context.Context, in *GetLogsRequest, opts ...grpc.CallOption) (*LogsResponse, error)
+	// StreamLogs streams the logs of the traffic-manager and the traffic-agents
+	// (pending the request) to the caller, line by line. Lines from different
+	// pods are interleaved in the order they arrive.
+	StreamLogs(ctx context.Context, in *StreamLogsRequest, opts ...grpc.CallOption) (Manager_StreamLogsClient, error)
 	// WatchAgents notifies a client of the set of known Agents.
 	//
 	// A session ID is required; if no session ID is given then the call
@@ -62,6 +74,10 @@ type ManagerClient interface {
 	// WatchClusterInfo returns information needed when establishing
 	// connectivity to the cluster.
 	WatchClusterInfo(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchClusterInfoClient, error)
+	// WatchServices notifies a client of the services in the cluster. The
+	// traffic-manager watches the services using a shared informer, so that
+	// clients don't have to poll or watch the API server themselves.
+	WatchServices(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchServicesClient, error)
 	// CreateIntercept lets a client create an intercept.  It will be
 	// created in the "WATING" disposition, and it will remain in that
 	// state until the Agent (the app-sidecar) calls ReviewIntercept()
@@ -73,6 +89,10 @@ type ManagerClient interface {
 	UpdateIntercept(ctx context.Context, in *UpdateInterceptRequest, opts ...grpc.CallOption) (*InterceptInfo, error)
 	// GetIntercept gets info from intercept name
 	GetIntercept(ctx context.Context, in *GetInterceptRequest, opts ...grpc.CallOption) (*InterceptInfo, error)
+	// GetInterceptAffinity returns the workloads that depend on the workload of
+	// the named intercept, so that the client can intercept them using the same
+	// matchers.
+	GetInterceptAffinity(ctx context.Context, in *GetInterceptRequest, opts ...grpc.CallOption) (*InterceptAffinity, error)
 	// ReviewIntercept lets an agent approve or reject an intercept by
 	// changing the disposition from "WATING" to "ACTIVE" or to an
 	// error, and setting a human-readable status message.
@@ -165,6 +185,47 @@ func (c *managerClient) GetTelepresenceAPI(ctx context.Context, in *emptypb.Empt
 	return out, nil
 }
 
+func (c *managerClient) GetClientRequirements(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ClientRequirements, error) {
+	out := new(ClientRequirements)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.Manager/GetClientRequirements", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) GetCloudArtifact(ctx context.Context, in *CloudArtifactRequest, opts ...grpc.CallOption) (Manager_GetCloudArtifactClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[0], "/telepresence.manager.Manager/GetCloudArtifact", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerGetCloudArtifactClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Manager_GetCloudArtifactClient interface {
+	Recv() (*CloudArtifactChunk, error)
+	grpc.ClientStream
+}
+
+type managerGetCloudArtifactClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerGetCloudArtifactClient) Recv() (*CloudArtifactChunk, error) {
+	m := new(CloudArtifactChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *managerClient) ArriveAsClient(ctx context.Context, in *ClientInfo, opts ...grpc.CallOption) (*SessionInfo, error) {
 	out := new(SessionInfo)
 	err := c.cc.Invoke(ctx, "/telepresence.manager.Manager/ArriveAsClient", in, out, opts...)
@@ -219,8 +280,40 @@ func (c *managerClient) GetLogs(ctx context.Context, in *GetLogsRequest, opts ..
 	return out, nil
 }
 
+func (c *managerClient) StreamLogs(ctx context.Context, in *StreamLogsRequest, opts ...grpc.CallOption) (Manager_StreamLogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[1], "/telepresence.manager.Manager/StreamLogs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerStreamLogsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Manager_StreamLogsClient interface {
+	Recv() (*LogLine, error)
+	grpc.ClientStream
+}
+
+type managerStreamLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerStreamLogsClient) Recv() (*LogLine, error) {
+	m := new(LogLine)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *managerClient) WatchAgents(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchAgentsClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[0], "/telepresence.manager.Manager/WatchAgents", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[2], "/telepresence.manager.Manager/WatchAgents", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -252,7 +345,7 @@ func (x *managerWatchAgentsClient) Recv() (*AgentInfoSnapshot, error) {
 }
 
 func (c *managerClient) WatchIntercepts(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchInterceptsClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[1], "/telepresence.manager.Manager/WatchIntercepts", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[3], "/telepresence.manager.Manager/WatchIntercepts", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -284,7 +377,7 @@ func (x *managerWatchInterceptsClient) Recv() (*InterceptInfoSnapshot, error) {
 }
 
 func (c *managerClient) WatchClusterInfo(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchClusterInfoClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[2], "/telepresence.manager.Manager/WatchClusterInfo", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[4], "/telepresence.manager.Manager/WatchClusterInfo", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -315,6 +408,38 @@ func (x *managerWatchClusterInfoClient) Recv() (*ClusterInfo, error) {
 	return m, nil
 }
 
+func (c *managerClient) WatchServices(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchServicesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[5], "/telepresence.manager.Manager/WatchServices", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerWatchServicesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Manager_WatchServicesClient interface {
+	Recv() (*ServiceSnapshot, error)
+	grpc.ClientStream
+}
+
+type managerWatchServicesClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerWatchServicesClient) Recv() (*ServiceSnapshot, error) {
+	m := new(ServiceSnapshot)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *managerClient) CreateIntercept(ctx context.Context, in *CreateInterceptRequest, opts ...grpc.CallOption) (*InterceptInfo, error) {
 	out := new(InterceptInfo)
 	err := c.cc.Invoke(ctx, "/telepresence.manager.Manager/CreateIntercept", in, out, opts...)
@@ -351,6 +476,15 @@ func (c *managerClient) GetIntercept(ctx context.Context, in *GetInterceptReques
 	return out, nil
 }
 
+func (c *managerClient) GetInterceptAffinity(ctx context.Context, in *GetInterceptRequest, opts ...grpc.CallOption) (*InterceptAffinity, error) {
+	out := new(InterceptAffinity)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.Manager/GetInterceptAffinity", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *managerClient) ReviewIntercept(ctx context.Context, in *ReviewInterceptRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	out := new(emptypb.Empty)
 	err := c.cc.Invoke(ctx, "/telepresence.manager.Manager/ReviewIntercept", in, out, opts...)
@@ -361,7 +495,7 @@ func (c *managerClient) ReviewIntercept(ctx context.Context, in *ReviewIntercept
 }
 
 func (c *managerClient) ClientTunnel(ctx context.Context, opts ...grpc.CallOption) (Manager_ClientTunnelClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[3], "/telepresence.manager.Manager/ClientTunnel", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[6], "/telepresence.manager.Manager/ClientTunnel", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -392,7 +526,7 @@ func (x *managerClientTunnelClient) Recv() (*ConnMessage, error) {
 }
 
 func (c *managerClient) AgentTunnel(ctx context.Context, opts ...grpc.CallOption) (Manager_AgentTunnelClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[4], "/telepresence.manager.Manager/AgentTunnel", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[7], "/telepresence.manager.Manager/AgentTunnel", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -441,7 +575,7 @@ func (c *managerClient) AgentLookupHostResponse(ctx context.Context, in *LookupH
 }
 
 func (c *managerClient) WatchLookupHost(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchLookupHostClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[5], "/telepresence.manager.Manager/WatchLookupHost", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[8], "/telepresence.manager.Manager/WatchLookupHost", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -473,7 +607,7 @@ func (x *managerWatchLookupHostClient) Recv() (*LookupHostRequest, error) {
 }
 
 func (c *managerClient) WatchLogLevel(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Manager_WatchLogLevelClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[6], "/telepresence.manager.Manager/WatchLogLevel", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[9], "/telepresence.manager.Manager/WatchLogLevel", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -505,7 +639,7 @@ func (x *managerWatchLogLevelClient) Recv() (*LogLevelRequest, error) {
 }
 
 func (c *managerClient) Tunnel(ctx context.Context, opts ...grpc.CallOption) (Manager_TunnelClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[7], "/telepresence.manager.Manager/Tunnel", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[10], "/telepresence.manager.Manager/Tunnel", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -536,7 +670,7 @@ func (x *managerTunnelClient) Recv() (*TunnelMessage, error) {
 }
 
 func (c *managerClient) WatchDial(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchDialClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[8], "/telepresence.manager.Manager/WatchDial", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[11], "/telepresence.manager.Manager/WatchDial", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -584,6 +718,14 @@ type ManagerServer interface {
 	GetCloudConfig(context.Context, *emptypb.Empty) (*AmbassadorCloudConfig, error)
 	// GetTelepresenceAPI returns information about the TelepresenceAPI server
 	GetTelepresenceAPI(context.Context, *emptypb.Empty) (*TelepresenceAPIInfo, error)
+	// GetClientRequirements returns the settings that the traffic-manager runs
+	// with, so that clients can detect when their configuration has drifted
+	// from them.
+	GetClientRequirements(context.Context, *emptypb.Empty) (*ClientRequirements, error)
+	// GetCloudArtifact streams an Ambassador Cloud artifact that the traffic-manager
+	// downloads and caches on behalf of clients that can't reach Ambassador Cloud
+	// directly.
+	GetCloudArtifact(*CloudArtifactRequest, Manager_GetCloudArtifactServer) error
 	// ArriveAsClient establishes a session between a client and the Manager.
 	ArriveAsClient(context.Context, *ClientInfo) (*SessionInfo, error)
 	// ArriveAsAgent establishes a session between an agent and the Manager.
@@ -599,6 +741,10 @@ type ManagerServer interface {
 	// GetLogs will acquire logs for the various Telepresence components in kubernetes
 	// (pending the request) and return them to the caller
 	GetLogs(context.Context, *GetLogsRequest) (*LogsResponse, error)
+	// StreamLogs streams the logs of the traffic-manager and the traffic-agents
+	// (pending the request) to the caller, line by line. Lines from different
+	// pods are interleaved in the order they arrive.
+	StreamLogs(*StreamLogsRequest, Manager_StreamLogsServer) error
 	// WatchAgents notifies a client of the set of known Agents.
 	//
 	// A session ID is required; if no session ID is given then the call
@@ -614,6 +760,10 @@ type ManagerServer interface {
 	// WatchClusterInfo returns information needed when establishing
 	// connectivity to the cluster.
 	WatchClusterInfo(*SessionInfo, Manager_WatchClusterInfoServer) error
+	// WatchServices notifies a client of the services in the cluster. The
+	// traffic-manager watches the services using a shared informer, so that
+	// clients don't have to poll or watch the API server themselves.
+	WatchServices(*SessionInfo, Manager_WatchServicesServer) error
 	// CreateIntercept lets a client create an intercept.  It will be
 	// created in the "WATING" disposition, and it will remain in that
 	// state until the Agent (the app-sidecar) calls ReviewIntercept()
@@ -625,6 +775,10 @@ type ManagerServer interface {
 	UpdateIntercept(context.Context, *UpdateInterceptRequest) (*InterceptInfo, error)
 	// GetIntercept gets info from intercept name
 	GetIntercept(context.Context, *GetInterceptRequest) (*InterceptInfo, error)
+	// GetInterceptAffinity returns the workloads that depend on the workload of
+	// the named intercept, so that the client can intercept them using the same
+	// matchers.
+	GetInterceptAffinity(context.Context, *GetInterceptRequest) (*InterceptAffinity, error)
 	// ReviewIntercept lets an agent approve or reject an intercept by
 	// changing the disposition from "WATING" to "ACTIVE" or to an
 	// error, and setting a human-readable status message.
@@ -684,6 +838,12 @@ func (UnimplementedManagerServer) GetCloudConfig(context.Context, *emptypb.Empty
 func (UnimplementedManagerServer) GetTelepresenceAPI(context.Context, *emptypb.Empty) (*TelepresenceAPIInfo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetTelepresenceAPI not implemented")
 }
+func (UnimplementedManagerServer) GetClientRequirements(context.Context, *emptypb.Empty) (*ClientRequirements, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetClientRequirements not implemented")
+}
+func (UnimplementedManagerServer) GetCloudArtifact(*CloudArtifactRequest, Manager_GetCloudArtifactServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetCloudArtifact not implemented")
+}
 func (UnimplementedManagerServer) ArriveAsClient(context.Context, *ClientInfo) (*SessionInfo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ArriveAsClient not implemented")
 }
@@ -702,6 +862,9 @@ func (UnimplementedManagerServer) SetLogLevel(context.Context, *LogLevelRequest)
 func (UnimplementedManagerServer) GetLogs(context.Context, *GetLogsRequest) (*LogsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetLogs not implemented")
 }
+func (UnimplementedManagerServer) StreamLogs(*StreamLogsRequest, Manager_StreamLogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLogs not implemented")
+}
 func (UnimplementedManagerServer) WatchAgents(*SessionInfo, Manager_WatchAgentsServer) error {
 	return status.Errorf(codes.Unimplemented, "method WatchAgents not implemented")
 }
@@ -711,6 +874,9 @@ func (UnimplementedManagerServer) WatchIntercepts(*SessionInfo, Manager_WatchInt
 func (UnimplementedManagerServer) WatchClusterInfo(*SessionInfo, Manager_WatchClusterInfoServer) error {
 	return status.Errorf(codes.Unimplemented, "method WatchClusterInfo not implemented")
 }
+func (UnimplementedManagerServer) WatchServices(*SessionInfo, Manager_WatchServicesServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchServices not implemented")
+}
 func (UnimplementedManagerServer) CreateIntercept(context.Context, *CreateInterceptRequest) (*InterceptInfo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateIntercept not implemented")
 }
@@ -723,6 +889,9 @@ func (UnimplementedManagerServer) UpdateIntercept(context.Context, *UpdateInterc
 func (UnimplementedManagerServer) GetIntercept(context.Context, *GetInterceptRequest) (*InterceptInfo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetIntercept not implemented")
 }
+func (UnimplementedManagerServer) GetInterceptAffinity(context.Context, *GetInterceptRequest) (*InterceptAffinity, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInterceptAffinity not implemented")
+}
 func (UnimplementedManagerServer) ReviewIntercept(context.Context, *ReviewInterceptRequest) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ReviewIntercept not implemented")
 }
@@ -853,6 +1022,45 @@ func _Manager_GetTelepresenceAPI_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Manager_GetClientRequirements_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).GetClientRequirements(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.Manager/GetClientRequirements",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).GetClientRequirements(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_GetCloudArtifact_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CloudArtifactRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ManagerServer).GetCloudArtifact(m, &managerGetCloudArtifactServer{stream})
+}
+
+type Manager_GetCloudArtifactServer interface {
+	Send(*CloudArtifactChunk) error
+	grpc.ServerStream
+}
+
+type managerGetCloudArtifactServer struct {
+	grpc.ServerStream
+}
+
+func (x *managerGetCloudArtifactServer) Send(m *CloudArtifactChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Manager_ArriveAsClient_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ClientInfo)
 	if err := dec(in); err != nil {
@@ -961,6 +1169,27 @@ func _Manager_GetLogs_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Manager_StreamLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamLogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ManagerServer).StreamLogs(m, &managerStreamLogsServer{stream})
+}
+
+type Manager_StreamLogsServer interface {
+	Send(*LogLine) error
+	grpc.ServerStream
+}
+
+type managerStreamLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *managerStreamLogsServer) Send(m *LogLine) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Manager_WatchAgents_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(SessionInfo)
 	if err := stream.RecvMsg(m); err != nil {
@@ -1024,6 +1253,27 @@ func (x *managerWatchClusterInfoServer) Send(m *ClusterInfo) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Manager_WatchServices_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SessionInfo)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ManagerServer).WatchServices(m, &managerWatchServicesServer{stream})
+}
+
+type Manager_WatchServicesServer interface {
+	Send(*ServiceSnapshot) error
+	grpc.ServerStream
+}
+
+type managerWatchServicesServer struct {
+	grpc.ServerStream
+}
+
+func (x *managerWatchServicesServer) Send(m *ServiceSnapshot) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Manager_CreateIntercept_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(CreateInterceptRequest)
 	if err := dec(in); err != nil {
@@ -1096,6 +1346,24 @@ func _Manager_GetIntercept_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Manager_GetInterceptAffinity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInterceptRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).GetInterceptAffinity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.Manager/GetInterceptAffinity",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).GetInterceptAffinity(ctx, req.(*GetInterceptRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Manager_ReviewIntercept_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ReviewInterceptRequest)
 	if err := dec(in); err != nil {
@@ -1318,6 +1586,10 @@ var Manager_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetTelepresenceAPI",
 			Handler:    _Manager_GetTelepresenceAPI_Handler,
 		},
+		{
+			MethodName: "GetClientRequirements",
+			Handler:    _Manager_GetClientRequirements_Handler,
+		},
 		{
 			MethodName: "ArriveAsClient",
 			Handler:    _Manager_ArriveAsClient_Handler,
@@ -1358,6 +1630,10 @@ var Manager_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetIntercept",
 			Handler:    _Manager_GetIntercept_Handler,
 		},
+		{
+			MethodName: "GetInterceptAffinity",
+			Handler:    _Manager_GetInterceptAffinity_Handler,
+		},
 		{
 			MethodName: "ReviewIntercept",
 			Handler:    _Manager_ReviewIntercept_Handler,
@@ -1372,6 +1648,16 @@ var Manager_ServiceDesc = grpc.ServiceDesc{
 		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetCloudArtifact",
+			Handler:       _Manager_GetCloudArtifact_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamLogs",
+			Handler:       _Manager_StreamLogs_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "WatchAgents",
 			Handler:       _Manager_WatchAgents_Handler,
@@ -1387,6 +1673,11 @@ var Manager_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Manager_WatchClusterInfo_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchServices",
+			Handler:       _Manager_WatchServices_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "ClientTunnel",
 			Handler:       _Manager_ClientTunnel_Handler,
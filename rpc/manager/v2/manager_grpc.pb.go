@@ -0,0 +1,468 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package v2
+
+import (
+	context "context"
+	manager "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// ManagerClient is the client API for Manager service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ManagerClient interface {
+	// Version returns the version information of the Manager.
+	Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*manager.VersionInfo2, error)
+	// ArriveAsClient establishes a session between a client and the Manager.
+	ArriveAsClient(ctx context.Context, in *manager.ClientInfo, opts ...grpc.CallOption) (*manager.SessionInfo, error)
+	// Remain indicates that the session is still valid, and potentially
+	// updates the auth token for the session.
+	Remain(ctx context.Context, in *manager.RemainRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Depart terminates a session.
+	Depart(ctx context.Context, in *manager.SessionInfo, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// WatchAgents notifies a client of the set of known Agents.
+	WatchAgents(ctx context.Context, in *manager.SessionInfo, opts ...grpc.CallOption) (Manager_WatchAgentsClient, error)
+	// WatchIntercepts notifies a client of the set of intercepts that it
+	// created.
+	WatchIntercepts(ctx context.Context, in *manager.SessionInfo, opts ...grpc.CallOption) (Manager_WatchInterceptsClient, error)
+	// CreateIntercept lets a client create an intercept.
+	CreateIntercept(ctx context.Context, in *manager.CreateInterceptRequest, opts ...grpc.CallOption) (*manager.InterceptInfo, error)
+	// RemoveIntercept lets a client remove an intercept.
+	RemoveIntercept(ctx context.Context, in *manager.RemoveInterceptRequest2, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// GetIntercept gets info from intercept name
+	GetIntercept(ctx context.Context, in *manager.GetInterceptRequest, opts ...grpc.CallOption) (*manager.InterceptInfo, error)
+}
+
+type managerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewManagerClient(cc grpc.ClientConnInterface) ManagerClient {
+	return &managerClient{cc}
+}
+
+func (c *managerClient) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*manager.VersionInfo2, error) {
+	out := new(manager.VersionInfo2)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.v2.Manager/Version", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) ArriveAsClient(ctx context.Context, in *manager.ClientInfo, opts ...grpc.CallOption) (*manager.SessionInfo, error) {
+	out := new(manager.SessionInfo)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.v2.Manager/ArriveAsClient", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) Remain(ctx context.Context, in *manager.RemainRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.v2.Manager/Remain", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) Depart(ctx context.Context, in *manager.SessionInfo, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.v2.Manager/Depart", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) WatchAgents(ctx context.Context, in *manager.SessionInfo, opts ...grpc.CallOption) (Manager_WatchAgentsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[0], "/telepresence.manager.v2.Manager/WatchAgents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerWatchAgentsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Manager_WatchAgentsClient interface {
+	Recv() (*manager.AgentInfoSnapshot, error)
+	grpc.ClientStream
+}
+
+type managerWatchAgentsClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerWatchAgentsClient) Recv() (*manager.AgentInfoSnapshot, error) {
+	m := new(manager.AgentInfoSnapshot)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *managerClient) WatchIntercepts(ctx context.Context, in *manager.SessionInfo, opts ...grpc.CallOption) (Manager_WatchInterceptsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[1], "/telepresence.manager.v2.Manager/WatchIntercepts", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerWatchInterceptsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Manager_WatchInterceptsClient interface {
+	Recv() (*manager.InterceptInfoSnapshot, error)
+	grpc.ClientStream
+}
+
+type managerWatchInterceptsClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerWatchInterceptsClient) Recv() (*manager.InterceptInfoSnapshot, error) {
+	m := new(manager.InterceptInfoSnapshot)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *managerClient) CreateIntercept(ctx context.Context, in *manager.CreateInterceptRequest, opts ...grpc.CallOption) (*manager.InterceptInfo, error) {
+	out := new(manager.InterceptInfo)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.v2.Manager/CreateIntercept", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) RemoveIntercept(ctx context.Context, in *manager.RemoveInterceptRequest2, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.v2.Manager/RemoveIntercept", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) GetIntercept(ctx context.Context, in *manager.GetInterceptRequest, opts ...grpc.CallOption) (*manager.InterceptInfo, error) {
+	out := new(manager.InterceptInfo)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.v2.Manager/GetIntercept", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ManagerServer is the server API for Manager service.
+// All implementations must embed UnimplementedManagerServer
+// for forward compatibility
+type ManagerServer interface {
+	// Version returns the version information of the Manager.
+	Version(context.Context, *emptypb.Empty) (*manager.VersionInfo2, error)
+	// ArriveAsClient establishes a session between a client and the Manager.
+	ArriveAsClient(context.Context, *manager.ClientInfo) (*manager.SessionInfo, error)
+	// Remain indicates that the session is still valid, and potentially
+	// updates the auth token for the session.
+	Remain(context.Context, *manager.RemainRequest) (*emptypb.Empty, error)
+	// Depart terminates a session.
+	Depart(context.Context, *manager.SessionInfo) (*emptypb.Empty, error)
+	// WatchAgents notifies a client of the set of known Agents.
+	WatchAgents(*manager.SessionInfo, Manager_WatchAgentsServer) error
+	// WatchIntercepts notifies a client of the set of intercepts that it
+	// created.
+	WatchIntercepts(*manager.SessionInfo, Manager_WatchInterceptsServer) error
+	// CreateIntercept lets a client create an intercept.
+	CreateIntercept(context.Context, *manager.CreateInterceptRequest) (*manager.InterceptInfo, error)
+	// RemoveIntercept lets a client remove an intercept.
+	RemoveIntercept(context.Context, *manager.RemoveInterceptRequest2) (*emptypb.Empty, error)
+	// GetIntercept gets info from intercept name
+	GetIntercept(context.Context, *manager.GetInterceptRequest) (*manager.InterceptInfo, error)
+	mustEmbedUnimplementedManagerServer()
+}
+
+// UnimplementedManagerServer must be embedded to have forward compatible implementations.
+type UnimplementedManagerServer struct {
+}
+
+func (UnimplementedManagerServer) Version(context.Context, *emptypb.Empty) (*manager.VersionInfo2, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
+}
+func (UnimplementedManagerServer) ArriveAsClient(context.Context, *manager.ClientInfo) (*manager.SessionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ArriveAsClient not implemented")
+}
+func (UnimplementedManagerServer) Remain(context.Context, *manager.RemainRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remain not implemented")
+}
+func (UnimplementedManagerServer) Depart(context.Context, *manager.SessionInfo) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Depart not implemented")
+}
+func (UnimplementedManagerServer) WatchAgents(*manager.SessionInfo, Manager_WatchAgentsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchAgents not implemented")
+}
+func (UnimplementedManagerServer) WatchIntercepts(*manager.SessionInfo, Manager_WatchInterceptsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchIntercepts not implemented")
+}
+func (UnimplementedManagerServer) CreateIntercept(context.Context, *manager.CreateInterceptRequest) (*manager.InterceptInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateIntercept not implemented")
+}
+func (UnimplementedManagerServer) RemoveIntercept(context.Context, *manager.RemoveInterceptRequest2) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveIntercept not implemented")
+}
+func (UnimplementedManagerServer) GetIntercept(context.Context, *manager.GetInterceptRequest) (*manager.InterceptInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetIntercept not implemented")
+}
+func (UnimplementedManagerServer) mustEmbedUnimplementedManagerServer() {}
+
+// UnsafeManagerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ManagerServer will
+// result in compilation errors.
+type UnsafeManagerServer interface {
+	mustEmbedUnimplementedManagerServer()
+}
+
+func RegisterManagerServer(s grpc.ServiceRegistrar, srv ManagerServer) {
+	s.RegisterService(&Manager_ServiceDesc, srv)
+}
+
+func _Manager_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.v2.Manager/Version",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).Version(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_ArriveAsClient_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(manager.ClientInfo)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).ArriveAsClient(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.v2.Manager/ArriveAsClient",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).ArriveAsClient(ctx, req.(*manager.ClientInfo))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_Remain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(manager.RemainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).Remain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.v2.Manager/Remain",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).Remain(ctx, req.(*manager.RemainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_Depart_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(manager.SessionInfo)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).Depart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.v2.Manager/Depart",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).Depart(ctx, req.(*manager.SessionInfo))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_WatchAgents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(manager.SessionInfo)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ManagerServer).WatchAgents(m, &managerWatchAgentsServer{stream})
+}
+
+type Manager_WatchAgentsServer interface {
+	Send(*manager.AgentInfoSnapshot) error
+	grpc.ServerStream
+}
+
+type managerWatchAgentsServer struct {
+	grpc.ServerStream
+}
+
+func (x *managerWatchAgentsServer) Send(m *manager.AgentInfoSnapshot) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Manager_WatchIntercepts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(manager.SessionInfo)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ManagerServer).WatchIntercepts(m, &managerWatchInterceptsServer{stream})
+}
+
+type Manager_WatchInterceptsServer interface {
+	Send(*manager.InterceptInfoSnapshot) error
+	grpc.ServerStream
+}
+
+type managerWatchInterceptsServer struct {
+	grpc.ServerStream
+}
+
+func (x *managerWatchInterceptsServer) Send(m *manager.InterceptInfoSnapshot) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Manager_CreateIntercept_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(manager.CreateInterceptRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).CreateIntercept(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.v2.Manager/CreateIntercept",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).CreateIntercept(ctx, req.(*manager.CreateInterceptRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_RemoveIntercept_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(manager.RemoveInterceptRequest2)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).RemoveIntercept(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.v2.Manager/RemoveIntercept",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).RemoveIntercept(ctx, req.(*manager.RemoveInterceptRequest2))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_GetIntercept_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(manager.GetInterceptRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).GetIntercept(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.v2.Manager/GetIntercept",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).GetIntercept(ctx, req.(*manager.GetInterceptRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Manager_ServiceDesc is the grpc.ServiceDesc for Manager service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Manager_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "telepresence.manager.v2.Manager",
+	HandlerType: (*ManagerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Version",
+			Handler:    _Manager_Version_Handler,
+		},
+		{
+			MethodName: "ArriveAsClient",
+			Handler:    _Manager_ArriveAsClient_Handler,
+		},
+		{
+			MethodName: "Remain",
+			Handler:    _Manager_Remain_Handler,
+		},
+		{
+			MethodName: "Depart",
+			Handler:    _Manager_Depart_Handler,
+		},
+		{
+			MethodName: "CreateIntercept",
+			Handler:    _Manager_CreateIntercept_Handler,
+		},
+		{
+			MethodName: "RemoveIntercept",
+			Handler:    _Manager_RemoveIntercept_Handler,
+		},
+		{
+			MethodName: "GetIntercept",
+			Handler:    _Manager_GetIntercept_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchAgents",
+			Handler:       _Manager_WatchAgents_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchIntercepts",
+			Handler:       _Manager_WatchIntercepts_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "rpc/manager/v2/manager.proto",
+}